@@ -0,0 +1,50 @@
+// Package cli exposes the testmqtt command line so custom builds can add
+// their own conformance test groups. Register the groups from an init
+// function and call Execute from main:
+//
+//	package main
+//
+//	import (
+//		"os"
+//
+//		"github.com/bromq-dev/testmqtt/cli"
+//		"github.com/bromq-dev/testmqtt/conformance/common"
+//		"github.com/bromq-dev/testmqtt/spec"
+//	)
+//
+//	func init() {
+//		common.RegisterGroup(spec.V5, "acme", common.TestGroup{
+//			Name:  "ACL",
+//			Tests: []common.TestFunc{testDeniedTopic},
+//		})
+//	}
+//
+//	func main() {
+//		os.Exit(cli.ExitCode(cli.Execute()))
+//	}
+//
+// The group then runs with the built-in ones and can be selected with
+// --tests acme/ACL.
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bromq-dev/testmqtt/internal/cmd"
+)
+
+// Execute runs the testmqtt command line and prints any error to stderr
+func Execute() error {
+	err := cmd.Execute()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	return err
+}
+
+// ExitCode returns the exit code testmqtt uses for an error from Execute:
+// 0 on success, 1 when tests failed and 2 when the run itself failed
+func ExitCode(err error) int {
+	return cmd.ExitCode(err)
+}
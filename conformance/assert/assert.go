@@ -0,0 +1,146 @@
+// Package assert checks what conformance tests observe and records a failed
+// check in the test's result: what was checked, what was expected and what
+// was seen instead, along with the packets the test exchanged up to then
+// when the run traces them. Each check returns whether it held, so a test
+// can return early:
+//
+//	if !assert.ReasonCode(&result, cfg, "UNSUBACK reason code", codes[0], 0x00) {
+//		result.Duration = time.Since(start)
+//		return result
+//	}
+//
+// Checks only ever fail a result; tests still set StatusPassed themselves.
+// ReasonCode and ReasonName know the MQTT 5 reason codes only; the MQTT 3.1.1
+// return codes are a different table, which the v3 tests name themselves.
+package assert
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// poll is how often Eventually and ReceivedExactly look again
+const poll = 10 * time.Millisecond
+
+// settle is how long ReceivedExactly keeps watching, scaled by the timing
+// multiplier, once the expected count is reached, so duplicates show
+const settle = 200 * time.Millisecond
+
+// Fail records a failed check of what in result, e.g. "messages received:
+// expected 10, got 7", along with the packets traced so far when packet
+// tracing is on
+func Fail(result *common.TestResult, cfg common.Config, what string, expected, actual any) {
+	result.Status = common.StatusFailed
+	result.Expected = fmt.Sprint(expected)
+	result.Actual = fmt.Sprint(actual)
+	result.Error = fmt.Errorf("%s: expected %s, got %s", what, result.Expected, result.Actual)
+	if len(result.Packets) == 0 && (cfg.TracePackets || cfg.PrintTrace) {
+		result.Packets = cfg.Trace.Packets()
+	}
+}
+
+// Eventually waits up to timeout, scaled by the timing multiplier, for cond
+// to hold, e.g. for a message to arrive
+func Eventually(result *common.TestResult, cfg common.Config, what string, timeout time.Duration, cond func() bool) bool {
+	timeout = cfg.Scaled(timeout)
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			Fail(result, cfg, what, fmt.Sprintf("within %v", timeout), "nothing")
+			return false
+		}
+		time.Sleep(poll)
+	}
+	return true
+}
+
+// ReceivedExactly waits up to timeout, scaled by the timing multiplier, for
+// count to reach n and then a little longer in case it goes past n, as it
+// does when the broker duplicates a message
+func ReceivedExactly(result *common.TestResult, cfg common.Config, what string, n int, timeout time.Duration, count func() int) bool {
+	deadline := time.Now().Add(cfg.Scaled(timeout))
+	for count() < n && time.Now().Before(deadline) {
+		time.Sleep(poll)
+	}
+	if got := count(); got < n {
+		Fail(result, cfg, what, n, got)
+		return false
+	}
+	time.Sleep(cfg.Scaled(settle))
+	if got := count(); got != n {
+		Fail(result, cfg, what, n, got)
+		return false
+	}
+	return true
+}
+
+// ReasonCode checks an MQTT 5 reason code is want, naming both codes in the
+// failure, e.g. "UNSUBACK reason code: expected 0x00 (Success), got 0x11 (No
+// subscription existed)"
+func ReasonCode(result *common.TestResult, cfg common.Config, what string, got, want byte) bool {
+	if got == want {
+		return true
+	}
+	Fail(result, cfg, what, ReasonName(want), ReasonName(got))
+	return false
+}
+
+// ReasonName formats an MQTT 5 reason code with its name, e.g. "0x87 (Not
+// authorized)". Codes below 0x80 mean different things in different packets;
+// the name given is the most common one.
+func ReasonName(code byte) string {
+	if name, ok := reasonNames[code]; ok {
+		return fmt.Sprintf("0x%02x (%s)", code, name)
+	}
+	return fmt.Sprintf("0x%02x", code)
+}
+
+// reasonNames are the reason codes of the MQTT 5 specification, section
+// 2.4
+var reasonNames = map[byte]string{
+	0x00: "Success",
+	0x01: "Granted QoS 1",
+	0x02: "Granted QoS 2",
+	0x04: "Disconnect with Will Message",
+	0x10: "No matching subscribers",
+	0x11: "No subscription existed",
+	0x18: "Continue authentication",
+	0x19: "Re-authenticate",
+	0x80: "Unspecified error",
+	0x81: "Malformed Packet",
+	0x82: "Protocol Error",
+	0x83: "Implementation specific error",
+	0x84: "Unsupported Protocol Version",
+	0x85: "Client Identifier not valid",
+	0x86: "Bad User Name or Password",
+	0x87: "Not authorized",
+	0x88: "Server unavailable",
+	0x89: "Server busy",
+	0x8A: "Banned",
+	0x8B: "Server shutting down",
+	0x8C: "Bad authentication method",
+	0x8D: "Keep Alive timeout",
+	0x8E: "Session taken over",
+	0x8F: "Topic Filter invalid",
+	0x90: "Topic Name invalid",
+	0x91: "Packet Identifier in use",
+	0x92: "Packet Identifier not found",
+	0x93: "Receive Maximum exceeded",
+	0x94: "Topic Alias invalid",
+	0x95: "Packet too large",
+	0x96: "Message rate too high",
+	0x97: "Quota exceeded",
+	0x98: "Administrative action",
+	0x99: "Payload format invalid",
+	0x9A: "Retain not supported",
+	0x9B: "QoS not supported",
+	0x9C: "Use another server",
+	0x9D: "Server moved",
+	0x9E: "Shared Subscriptions not supported",
+	0x9F: "Connection rate exceeded",
+	0xA0: "Maximum connect time",
+	0xA1: "Subscription Identifiers not supported",
+	0xA2: "Wildcard Subscriptions not supported",
+}
@@ -0,0 +1,124 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Auth describes the broker's authentication, for the credential tests.
+// The suite's own credentials are the valid ones; the tests of the other
+// entries are skipped where they are empty.
+type Auth struct {
+	// InvalidUsername and InvalidPassword are credentials the broker
+	// refuses, e.g. a known user with the wrong password
+	InvalidUsername string `yaml:"invalid_username"`
+	InvalidPassword string `yaml:"invalid_password"`
+
+	// Anonymous is "allow" or "deny": whether the broker accepts clients
+	// that send no credentials
+	Anonymous string `yaml:"anonymous"`
+
+	// ScramUsername and ScramPassword are credentials the broker checks
+	// with the SCRAM-SHA-256 enhanced authentication method
+	ScramUsername string `yaml:"scram_username"`
+	ScramPassword string `yaml:"scram_password"`
+}
+
+// Values of Auth.Anonymous
+const (
+	AnonymousAllow = "allow"
+	AnonymousDeny  = "deny"
+)
+
+// SkipWithoutScram marks result as skipped when no SCRAM-SHA-256 user is
+// configured
+func SkipWithoutScram(cfg Config, result *TestResult) bool {
+	if cfg.Auth.ScramUsername != "" {
+		return false
+	}
+	result.Status = StatusSkipped
+	result.Notes = "no SCRAM-SHA-256 user configured (--scram-username)"
+	return true
+}
+
+// ACL describes access control configured on the broker, for the
+// authorization tests. They are skipped without a DeniedTopic.
+type ACL struct {
+	// Username and Password are the credentials the rules apply to, the
+	// suite's own when empty
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// AllowedTopic may be published and subscribed to with those
+	// credentials, a topic in the run's namespace when empty
+	AllowedTopic string `yaml:"allowed_topic"`
+
+	// DeniedTopic may be neither published nor subscribed to. It is used as
+	// given, outside TopicNamespace.
+	DeniedTopic string `yaml:"denied_topic"`
+}
+
+// ACLUser returns c with the credentials the ACL applies to
+func (c Config) ACLUser() Config {
+	if c.ACL.Username != "" {
+		c.Username, c.Password = c.ACL.Username, c.ACL.Password
+	}
+	return c
+}
+
+// AllowedTopic returns the topic the ACL credentials may use
+func (c Config) AllowedTopic() string {
+	if c.ACL.AllowedTopic != "" {
+		return c.ACL.AllowedTopic
+	}
+	return c.Topic("test/acl/allowed")
+}
+
+// SkipWithoutACL marks result as skipped when no denied topic is configured.
+// Tests call it right after building their result and return early when it
+// reports true.
+func SkipWithoutACL(cfg Config, result *TestResult) bool {
+	if cfg.ACL.DeniedTopic != "" {
+		return false
+	}
+	result.Status = StatusSkipped
+	result.Notes = "no denied topic configured (--denied-topic)"
+	return true
+}
+
+// PublishDenied publishes to the denied topic at qos with the ACL
+// credentials and returns the reason code of the PUBACK or PUBREC. A client
+// with the suite's own credentials subscribes to the topic first where the
+// broker lets it, and the message reaching it is an error. ErrBrokerClosed
+// is returned when the broker closed the connection instead of
+// acknowledging.
+func PublishDenied(cfg Config, level, qos byte) (byte, error) {
+	timeout := cfg.Scaled(5 * time.Second)
+	topic := cfg.ACL.DeniedTopic
+
+	watcher, err := DialRaw(cfg, level, cfg.ClientID("test-acl-watch"))
+	if err != nil {
+		return 0, fmt.Errorf("watcher connect failed: %w", err)
+	}
+	defer watcher.Close()
+	codes, err := watcher.Subscribe(1, qos, timeout, topic)
+	watching := err == nil && len(codes) == 1 && codes[0] < 0x80
+
+	conn, err := DialRaw(cfg.ACLUser(), level, cfg.ClientID("test-acl-publish"))
+	if err != nil {
+		return 0, fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+	reason, err := conn.PublishAcked(topic, qos, 1, []byte("denied"), timeout)
+	if err != nil {
+		return reason, err
+	}
+
+	if watching {
+		if _, _, err := watcher.Expect(0x30, cfg.Scaled(time.Second), nil); err == nil {
+			return reason, errors.New("message to the denied topic was delivered")
+		}
+	}
+	return reason, nil
+}
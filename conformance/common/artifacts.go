@@ -0,0 +1,206 @@
+package common
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Artifact is what gets written for one test so a failure on a remote
+// machine can be investigated without rerunning it
+type Artifact struct {
+	Group     string          `json:"group"`
+	Name      string          `json:"name"`
+	Status    Status          `json:"status"`
+	Error     string          `json:"error,omitempty"`
+	Notes     string          `json:"notes,omitempty"`
+	SpecRef   string          `json:"spec_ref,omitempty"`
+	ClientIDs []string        `json:"client_ids"`
+	Connacks  []ConnackRecord `json:"connacks"`
+	Timing    Timing          `json:"timing"`
+	Attempts  []Attempt       `json:"attempts,omitempty"`
+}
+
+// ConnackRecord is a CONNACK as the broker sent it on one connection
+type ConnackRecord struct {
+	Conn       int        `json:"conn"`
+	ClientID   string     `json:"client_id"`
+	Reason     byte       `json:"reason"`
+	Properties []Property `json:"properties,omitempty"`
+}
+
+// Timing breaks the duration of a test down into phases
+type Timing struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+
+	// Setup is the time before the first packet was sent, Teardown the time
+	// after the last packet was seen
+	Setup    time.Duration `json:"setup"`
+	Teardown time.Duration `json:"teardown"`
+
+	Connects []ConnectTiming `json:"connects,omitempty"`
+}
+
+// ConnectTiming is how long the broker took to answer a CONNECT
+type ConnectTiming struct {
+	Conn    int           `json:"conn"`
+	Offset  time.Duration `json:"offset"` // From the start of the test
+	Latency time.Duration `json:"latency"`
+}
+
+// NewArtifact summarizes a result and its captured packets
+func NewArtifact(result TestResult) Artifact {
+	a := Artifact{
+		Group:     result.Group,
+		Name:      result.Name,
+		Status:    result.Status,
+		Notes:     result.Notes,
+		SpecRef:   result.SpecRef,
+		ClientIDs: []string{},
+		Connacks:  []ConnackRecord{},
+		Timing:    Timing{Started: result.Started, Duration: result.Duration},
+		Attempts:  result.Attempts,
+	}
+	if result.Error != nil {
+		a.Error = result.Error.Error()
+	}
+
+	packets := result.Packets
+	if len(packets) == 0 {
+		return a
+	}
+	if !result.Started.IsZero() {
+		a.Timing.Setup = packets[0].Time.Sub(result.Started)
+		a.Timing.Teardown = max(0, result.Started.Add(result.Duration).Sub(packets[len(packets)-1].Time))
+	}
+
+	clientIDs := make(map[int]string)
+	connects := make(map[int]time.Time)
+	for _, p := range packets {
+		switch {
+		case p.Type == "CONNECT" && p.Direction == Sent:
+			clientIDs[p.Conn] = p.ClientID
+			connects[p.Conn] = p.Time
+			a.ClientIDs = append(a.ClientIDs, p.ClientID)
+		case p.Type == "CONNACK" && p.Direction == Received:
+			clientID := clientIDs[p.Conn]
+			for _, prop := range p.Properties {
+				if prop.Name == "Assigned Client Identifier" {
+					clientID = strings.Trim(prop.Value, `"`)
+				}
+			}
+			a.Connacks = append(a.Connacks, ConnackRecord{Conn: p.Conn, ClientID: clientID, Reason: p.Reason, Properties: p.Properties})
+			if sent, ok := connects[p.Conn]; ok {
+				ct := ConnectTiming{Conn: p.Conn, Latency: p.Time.Sub(sent)}
+				if !result.Started.IsZero() {
+					ct.Offset = sent.Sub(result.Started)
+				}
+				a.Timing.Connects = append(a.Timing.Connects, ct)
+				delete(connects, p.Conn)
+			}
+		}
+	}
+	return a
+}
+
+// WriteArtifacts writes one directory per test under dir, holding the test
+// summary as result.json and the raw packets as packets.log. An index.txt at
+// the top lists every test with its status and directory.
+func WriteArtifacts(dir string, r *Report) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	var index strings.Builder
+	fmt.Fprintf(&index, "%s against %s, started %s\n\n", r.Title, r.Broker, r.Started.Format(time.RFC3339))
+
+	used := make(map[string]bool)
+	for i, result := range r.Results {
+		rel := filepath.Join(slug(result.Group), fmt.Sprintf("%03d-%s", i+1, slug(result.Name)))
+		for used[rel] {
+			rel += "_"
+		}
+		used[rel] = true
+
+		testDir := filepath.Join(dir, rel)
+		if err := os.MkdirAll(testDir, 0o755); err != nil {
+			return err
+		}
+
+		data, err := json.MarshalIndent(NewArtifact(result), "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(testDir, "result.json"), append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(testDir, "packets.log"), []byte(packetLog(result)), 0o644); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&index, "%-12s %s\n", result.Status, rel)
+	}
+
+	return os.WriteFile(filepath.Join(dir, "index.txt"), []byte(index.String()), 0o644)
+}
+
+// packetLog renders every captured packet with its offset, decoded fields
+// and a hex dump of the bytes on the wire
+func packetLog(result TestResult) string {
+	if len(result.Packets) == 0 {
+		return "No packets captured\n"
+	}
+	start := result.Started
+	if start.IsZero() {
+		start = result.Packets[0].Time
+	}
+
+	var b strings.Builder
+	for _, p := range result.Packets {
+		fmt.Fprintf(&b, "+%.6fs %s\n", p.Time.Sub(start).Seconds(), p)
+		if p.ClientID != "" {
+			fmt.Fprintf(&b, "    client id: %q\n", p.ClientID)
+		}
+		if p.HasReason {
+			fmt.Fprintf(&b, "    reason: 0x%02x\n", p.Reason)
+		}
+		for _, prop := range p.Properties {
+			fmt.Fprintf(&b, "    %s: %s\n", prop.Name, prop.Value)
+		}
+		for _, line := range strings.Split(strings.TrimRight(hex.Dump(p.Raw), "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+	}
+	return b.String()
+}
+
+// slug turns a group or test name into a file name
+func slug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	s := strings.TrimSuffix(b.String(), "-")
+	if len(s) > 80 {
+		s = strings.TrimSuffix(s[:80], "-")
+	}
+	if s == "" {
+		s = "unnamed"
+	}
+	return s
+}
@@ -0,0 +1,370 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Bridge describes a bridge configured on the broker under test, for the
+// bridge tests. The suite plays the remote broker the bridge connects to,
+// listening on Listen; the tests are skipped without it. For Mosquitto:
+//
+//	connection testmqtt
+//	address 127.0.0.1:1890
+//	topic # both 1 bridge/local/ bridge/remote/
+//	cleansession false
+//	restart_timeout 1
+type Bridge struct {
+	// Listen is the address the remote broker listens on, where the bridge
+	// connects to
+	Listen string `yaml:"listen"`
+
+	// LocalPrefix and RemotePrefix are the prefixes the bridge maps topics
+	// between: LocalPrefix+"x" on the broker under test is RemotePrefix+"x"
+	// on the remote. Both are taken as given, so either may be empty.
+	LocalPrefix  string `yaml:"local_prefix"`
+	RemotePrefix string `yaml:"remote_prefix"`
+
+	// Timeout is how long to wait for the bridge to connect, or reconnect
+	// after the remote dropped it, DefaultBridgeTimeout when zero
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// DefaultBridgeTimeout covers the restart backoff of common bridges
+const DefaultBridgeTimeout = time.Minute
+
+// BridgeTopics returns the name of a test topic in the run's namespace on
+// the broker under test and on the remote
+func (c Config) BridgeTopics(name string) (local, remote string) {
+	t := c.Topic("test/bridge/" + name)
+	return c.Bridge.LocalPrefix + t, c.Bridge.RemotePrefix + t
+}
+
+func (c Config) bridgeTimeout() time.Duration {
+	if c.Bridge.Timeout > 0 {
+		return c.Bridge.Timeout
+	}
+	return DefaultBridgeTimeout
+}
+
+// SkipWithoutBridge starts the remote broker and waits for the bridge to
+// connect and subscribe to the remote's side of the bridged topics. It
+// returns nil and fills in result when no bridge is configured, as skipped,
+// or when the bridge does not come up, as failed.
+func SkipWithoutBridge(cfg Config, result *TestResult) *BridgeRemote {
+	if cfg.Bridge.Listen == "" {
+		result.Status = StatusSkipped
+		result.Notes = "no bridge configured (--bridge-listen)"
+		return nil
+	}
+	r, err := ListenBridgeRemote(cfg.Bridge.Listen)
+	if err != nil {
+		result.Error = err
+		return nil
+	}
+	_, remote := cfg.BridgeTopics("probe")
+	if !WaitTimeout(func() bool { return r.Subscribed(remote) }, cfg.bridgeTimeout()) {
+		if r.Connected() {
+			result.Error = fmt.Errorf("bridge connected to %s but has no subscription matching %s", cfg.Bridge.Listen, remote)
+		} else {
+			result.Error = fmt.Errorf("bridge did not connect to %s within %v", cfg.Bridge.Listen, cfg.bridgeTimeout())
+		}
+		return nil
+	}
+	return r
+}
+
+// DescribeBridge summarizes the bridge's last CONNECT and its subscriptions
+func DescribeBridge(r *BridgeRemote) string {
+	connects := r.Connects()
+	if len(connects) == 0 {
+		return "not connected"
+	}
+	c := connects[len(connects)-1]
+	parts := []string{fmt.Sprintf("client ID %q, protocol level %d", c.ClientID, c.Level)}
+	if c.Bridge {
+		parts = append(parts, "bridge bit set")
+	}
+	if c.CleanSession {
+		parts = append(parts, "clean session")
+	} else {
+		parts = append(parts, "persistent session")
+	}
+	var filters []string
+	for f, s := range r.Subscriptions() {
+		desc := fmt.Sprintf("%s QoS %d", f, s.QoS)
+		if s.NoLocal {
+			desc += " No Local"
+		}
+		filters = append(filters, desc)
+	}
+	sort.Strings(filters)
+	return strings.Join(parts, ", ") + "; subscribed to " + strings.Join(filters, ", ")
+}
+
+// bridgeSubscriber connects a client to the broker under test subscribed to
+// topic at QoS 1
+func bridgeSubscriber(cfg Config, level byte, topic string) (*RawConn, error) {
+	conn, err := DialRaw(cfg, level, cfg.ClientID("test-bridge-sub"))
+	if err != nil {
+		return nil, fmt.Errorf("subscriber connect failed: %w", err)
+	}
+	codes, err := conn.Subscribe(1, 1, cfg.Scaled(5*time.Second), topic)
+	if err == nil && (len(codes) != 1 || codes[0] >= 0x80) {
+		err = fmt.Errorf("SUBACK % x", codes)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("subscribe to %s failed: %w", topic, err)
+	}
+	return conn, nil
+}
+
+// bridgePublish publishes a QoS 1 message to the broker under test, with
+// the retain flag when retain is set
+func bridgePublish(cfg Config, level byte, topic string, payload []byte, retain bool) error {
+	conn, err := DialRaw(cfg, level, cfg.ClientID("test-bridge-pub"))
+	if err != nil {
+		return fmt.Errorf("publisher connect failed: %w", err)
+	}
+	defer conn.Close()
+	header := byte(0x32)
+	if retain {
+		header |= 0x01
+	}
+	body := AppendString(nil, topic)
+	body = append(body, 0, 1)
+	if level >= 5 {
+		body = append(body, 0)
+	}
+	body = append(body, payload...)
+	if err := conn.Send(header, body); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	if _, _, err := conn.Expect(0x40, cfg.Scaled(5*time.Second), nil); err != nil {
+		return fmt.Errorf("publish to %s not acknowledged: %w", topic, err)
+	}
+	conn.Send(0xE0, nil)
+	return nil
+}
+
+// awaitPayload reads PUBLISHes on conn until one with payload arrives
+// within timeout, acknowledging them, and returns its fixed header byte
+func awaitPayload(conn *RawConn, payload []byte, timeout time.Duration) (byte, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return 0, fmt.Errorf("no PUBLISH with payload %q within %v", payload, timeout)
+		}
+		header, body, err := conn.Expect(0x30, wait, nil)
+		if err != nil {
+			return 0, err
+		}
+		p, err := conn.ParsePublish(header, body)
+		if err != nil {
+			return 0, err
+		}
+		if p.QoS > 0 {
+			conn.Send(0x40, []byte{byte(p.PacketID >> 8), byte(p.PacketID)})
+		}
+		if bytes.Equal(p.Payload, payload) {
+			return header, nil
+		}
+	}
+}
+
+// CheckBridgeOutbound publishes a QoS 1 message under the local prefix and
+// checks the bridge forwards it to the remote under the remote prefix
+func CheckBridgeOutbound(cfg Config, level byte, r *BridgeRemote) (string, error) {
+	local, remote := cfg.BridgeTopics("out")
+	payload := []byte(GenerateClientID("out"))
+	if err := bridgePublish(cfg, level, local, payload, false); err != nil {
+		return "", err
+	}
+	m, ok := r.Await(remote, cfg.Scaled(5*time.Second))
+	if !ok {
+		if local != remote && len(r.Received(local)) > 0 {
+			return "", fmt.Errorf("message forwarded to %s without mapping the prefix", local)
+		}
+		return "", fmt.Errorf("message published to %s not forwarded to %s on the remote", local, remote)
+	}
+	if !bytes.Equal(m.Payload, payload) {
+		return "", fmt.Errorf("message forwarded with payload %q, published %q", m.Payload, payload)
+	}
+	return fmt.Sprintf("%s forwarded to %s at QoS %d", local, remote, m.QoS), nil
+}
+
+// CheckBridgeInbound publishes a QoS 1 message on the remote under the
+// remote prefix and checks a subscriber on the broker under test receives it
+// under the local prefix
+func CheckBridgeInbound(cfg Config, level byte, r *BridgeRemote) (string, error) {
+	local, remote := cfg.BridgeTopics("in")
+	sub, err := bridgeSubscriber(cfg, level, local)
+	if err != nil {
+		return "", err
+	}
+	defer sub.Close()
+	payload := []byte(GenerateClientID("in"))
+	if _, err := r.Publish(remote, payload, 1, false); err != nil {
+		return "", fmt.Errorf("remote publish to %s: %w", remote, err)
+	}
+	if _, err := awaitPayload(sub, payload, cfg.Scaled(5*time.Second)); err != nil {
+		return "", fmt.Errorf("message published to %s on the remote not delivered on %s: %w", remote, local, err)
+	}
+	return fmt.Sprintf("%s on the remote delivered on %s", remote, local), nil
+}
+
+// CheckBridgeLoop publishes a message on the remote that the bridge brings
+// in, and checks the bridge does not forward it back out to the remote,
+// where it would circulate between the brokers. It returns how the bridge
+// prevents the loop where that shows on the wire.
+func CheckBridgeLoop(cfg Config, level byte, r *BridgeRemote) (string, error) {
+	local, remote := cfg.BridgeTopics("loop")
+	sub, err := bridgeSubscriber(cfg, level, local)
+	if err != nil {
+		return "", err
+	}
+	defer sub.Close()
+	payload := []byte(GenerateClientID("loop"))
+	if _, err := r.Publish(remote, payload, 1, false); err != nil {
+		return "", fmt.Errorf("remote publish to %s: %w", remote, err)
+	}
+	if _, err := awaitPayload(sub, payload, cfg.Scaled(5*time.Second)); err != nil {
+		return "", fmt.Errorf("message from the remote not delivered on %s: %w", local, err)
+	}
+	cfg.Wait(time.Second)
+	for _, m := range r.Received(remote) {
+		if bytes.Equal(m.Payload, payload) {
+			return "", fmt.Errorf("message from the remote was forwarded back to %s", remote)
+		}
+	}
+
+	connects := r.Connects()
+	var how []string
+	if connects[len(connects)-1].Bridge {
+		how = append(how, "bridge bit in CONNECT")
+	}
+	for f, s := range r.Subscriptions() {
+		if s.NoLocal && MatchTopic(f, remote) {
+			how = append(how, "No Local subscription")
+			break
+		}
+	}
+	if len(how) == 0 {
+		return "not forwarded back", nil
+	}
+	return "not forwarded back, " + strings.Join(how, " and "), nil
+}
+
+// CheckBridgeRetained publishes a retained message on each side and checks
+// the bridge keeps the retain flag: the remote receives the local one
+// retained, and a subscriber on the broker under test that arrives after
+// the remote's one receives it as retained. The messages are cleared
+// afterwards.
+func CheckBridgeRetained(cfg Config, level byte, r *BridgeRemote) (string, error) {
+	outLocal, outRemote := cfg.BridgeTopics("retained/out")
+	inLocal, inRemote := cfg.BridgeTopics("retained/in")
+	defer func() {
+		bridgePublish(cfg, level, outLocal, nil, true)
+		bridgePublish(cfg, level, inLocal, nil, true)
+	}()
+
+	payload := []byte(GenerateClientID("retained-out"))
+	if err := bridgePublish(cfg, level, outLocal, payload, true); err != nil {
+		return "", err
+	}
+	m, ok := r.Await(outRemote, cfg.Scaled(5*time.Second))
+	switch {
+	case !ok:
+		return "", fmt.Errorf("retained message published to %s not forwarded to %s", outLocal, outRemote)
+	case !m.Retain:
+		return "", fmt.Errorf("retained message forwarded to %s without the retain flag", outRemote)
+	}
+
+	payload = []byte(GenerateClientID("retained-in"))
+	if _, err := r.Publish(inRemote, payload, 1, true); err != nil {
+		return "", fmt.Errorf("remote publish to %s: %w", inRemote, err)
+	}
+	// Give the bridge time to store the message before subscribing
+	cfg.Wait(500 * time.Millisecond)
+	sub, err := bridgeSubscriber(cfg, level, inLocal)
+	if err != nil {
+		return "", err
+	}
+	defer sub.Close()
+	header, err := awaitPayload(sub, payload, cfg.Scaled(5*time.Second))
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("retained message from %s not delivered to a later subscriber on %s: %w", inRemote, inLocal, err)
+	case header&0x01 == 0:
+		return "", fmt.Errorf("message from %s delivered to a later subscriber without the retain flag", inRemote)
+	}
+	return "retained in both directions", nil
+}
+
+// CheckBridgeReconnect drops the bridge's connection, publishes a QoS 1
+// message on each side while the remote refuses connections and checks the bridge reconnects
+// with the same client ID. For a bridge with a persistent session, both
+// messages must be delivered once it is back. It returns whether the
+// session was persistent.
+func CheckBridgeReconnect(cfg Config, level byte, r *BridgeRemote) (string, bool, error) {
+	outLocal, outRemote := cfg.BridgeTopics("reconnect/out")
+	inLocal, inRemote := cfg.BridgeTopics("reconnect/in")
+	sub, err := bridgeSubscriber(cfg, level, inLocal)
+	if err != nil {
+		return "", false, err
+	}
+	defer sub.Close()
+
+	before := r.Connects()
+	last := before[len(before)-1]
+	r.Drop()
+	defer r.Resume()
+
+	outPayload := []byte(GenerateClientID("reconnect-out"))
+	if err := bridgePublish(cfg, level, outLocal, outPayload, false); err != nil {
+		return "", false, err
+	}
+	inPayload := []byte(GenerateClientID("reconnect-in"))
+	queued, err := r.Publish(inRemote, inPayload, 1, false)
+	if err != nil && !errors.Is(err, ErrBridgeNotSubscribed) {
+		return "", false, fmt.Errorf("remote publish to %s: %w", inRemote, err)
+	}
+	r.Resume()
+	resumed := time.Now()
+
+	if !WaitTimeout(func() bool { return len(r.Connects()) > len(before) && r.Subscribed(outRemote) }, cfg.bridgeTimeout()) {
+		return "", false, fmt.Errorf("bridge did not reconnect within %v of the remote coming back", cfg.bridgeTimeout())
+	}
+	connects := r.Connects()
+	again := connects[len(before)]
+	took := again.At.Sub(resumed).Round(100 * time.Millisecond)
+	if again.ClientID != last.ClientID {
+		return "", false, fmt.Errorf("bridge reconnected as %q, was %q, so its session on the remote is lost", again.ClientID, last.ClientID)
+	}
+	if last.CleanSession {
+		return fmt.Sprintf("reconnected after %v; clean session, messages sent while down are not kept", took), false, nil
+	}
+	if again.CleanSession {
+		return "", true, fmt.Errorf("bridge reconnected with a clean session, discarding its persistent session")
+	}
+
+	var lost []string
+	if m, ok := r.Await(outRemote, cfg.Scaled(5*time.Second)); !ok || !bytes.Equal(m.Payload, outPayload) {
+		lost = append(lost, fmt.Sprintf("%s published while the bridge was down never reached the remote", outLocal))
+	}
+	if !queued {
+		lost = append(lost, fmt.Sprintf("%s could not be queued on the remote", inRemote))
+	} else if _, err := awaitPayload(sub, inPayload, cfg.Scaled(5*time.Second)); err != nil {
+		lost = append(lost, fmt.Sprintf("%s queued on the remote never reached %s", inRemote, inLocal))
+	}
+	if len(lost) > 0 {
+		return "", true, errors.New(strings.Join(lost, "; "))
+	}
+	return fmt.Sprintf("reconnected after %v with session present, queued messages delivered both ways", took), true, nil
+}
@@ -0,0 +1,420 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// BridgeConnect is a CONNECT a bridge sent to the BridgeRemote
+type BridgeConnect struct {
+	ClientID string
+	Level    byte // Protocol level without the bridge bit
+	// Bridge is set when the protocol level carried 0x80, the bit with
+	// which Mosquitto's try_private marks a bridge so the remote does not
+	// send its messages back
+	Bridge         bool
+	CleanSession   bool // Clean Start in MQTT 5
+	SessionPresent bool // What the BridgeRemote answered
+	At             time.Time
+}
+
+// BridgeSubscription is a subscription a bridge made on the BridgeRemote
+type BridgeSubscription struct {
+	QoS     byte
+	NoLocal bool // MQTT 5 No Local option
+}
+
+// BridgeMessage is a PUBLISH a bridge forwarded to the BridgeRemote
+type BridgeMessage struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+	Dup     bool
+	At      time.Time
+}
+
+// remoteSession is the state the BridgeRemote keeps for a client ID
+type remoteSession struct {
+	subs  map[string]BridgeSubscription
+	queue []BridgeMessage // Messages published while a persistent session was disconnected
+}
+
+// BridgeRemote is a minimal MQTT 3.1.1 and 5 server that plays the remote
+// broker of a bridge configured on the broker under test. It serves one
+// connection at a time, records what the bridge sends and keeps the
+// sessions of bridges that connect without a clean session, so tests can
+// drop the connection and watch the bridge resume.
+type BridgeRemote struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	conn     net.Conn
+	level    byte
+	session  *remoteSession
+	sessions map[string]*remoteSession // Persistent sessions by client ID
+	connects []BridgeConnect
+	received []BridgeMessage
+	nextID   uint16
+	down     bool // Refusing connections after Drop
+}
+
+var (
+	bridgeRemotesMu sync.Mutex
+	bridgeRemotes   = map[string]*BridgeRemote{}
+)
+
+// ListenBridgeRemote returns the BridgeRemote listening on addr, starting it
+// on first use. It keeps listening until the process exits, as the bridge
+// of the broker under test reconnects to it between tests.
+func ListenBridgeRemote(addr string) (*BridgeRemote, error) {
+	bridgeRemotesMu.Lock()
+	defer bridgeRemotesMu.Unlock()
+	if r, ok := bridgeRemotes[addr]; ok {
+		return r, nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("remote broker for the bridge: %w", err)
+	}
+	r := &BridgeRemote{ln: ln, sessions: map[string]*remoteSession{}}
+	go r.accept()
+	bridgeRemotes[addr] = r
+	return r, nil
+}
+
+func (r *BridgeRemote) accept() {
+	for {
+		conn, err := r.ln.Accept()
+		if err != nil {
+			return
+		}
+		go r.serve(conn)
+	}
+}
+
+// Connected reports whether a bridge is connected
+func (r *BridgeRemote) Connected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conn != nil
+}
+
+// Connects returns the CONNECTs received so far
+func (r *BridgeRemote) Connects() []BridgeConnect {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.connects)
+}
+
+// Subscriptions returns the subscriptions of the connected bridge by filter
+func (r *BridgeRemote) Subscriptions() map[string]BridgeSubscription {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subs := map[string]BridgeSubscription{}
+	if r.conn != nil {
+		for f, s := range r.session.subs {
+			subs[f] = s
+		}
+	}
+	return subs
+}
+
+// Subscribed reports whether the connected bridge has a subscription
+// matching topic
+func (r *BridgeRemote) Subscribed(topic string) bool {
+	for f := range r.Subscriptions() {
+		if MatchTopic(f, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Received returns the messages the bridge forwarded to topic
+func (r *BridgeRemote) Received(topic string) []BridgeMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var msgs []BridgeMessage
+	for _, m := range r.received {
+		if m.Topic == topic {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// Await waits up to timeout for the bridge to forward a message to topic
+// and returns the first one
+func (r *BridgeRemote) Await(topic string, timeout time.Duration) (BridgeMessage, bool) {
+	var m BridgeMessage
+	ok := WaitTimeout(func() bool {
+		msgs := r.Received(topic)
+		if len(msgs) > 0 {
+			m = msgs[0]
+		}
+		return len(msgs) > 0
+	}, timeout)
+	return m, ok
+}
+
+// ErrBridgeNotSubscribed is returned by Publish when no subscription of the
+// bridge's session matches the topic
+var ErrBridgeNotSubscribed = errors.New("bridge has no matching subscription")
+
+// Publish sends a message to the bridge at the lower of qos and the QoS of
+// its matching subscription. While a bridge with a persistent session is
+// disconnected, QoS 1 and 2 messages are queued for it instead. It returns
+// whether the message was queued.
+func (r *BridgeRemote) Publish(topic string, payload []byte, qos byte, retain bool) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.session == nil {
+		return false, ErrBridgeNotSubscribed
+	}
+	granted, ok := byte(0), false
+	for f, s := range r.session.subs {
+		if MatchTopic(f, topic) {
+			granted, ok = max(granted, s.QoS), true
+		}
+	}
+	if !ok {
+		return false, ErrBridgeNotSubscribed
+	}
+	m := BridgeMessage{Topic: topic, Payload: payload, QoS: min(qos, granted), Retain: retain, At: time.Now()}
+	if r.conn == nil {
+		if m.QoS == 0 {
+			return false, errors.New("bridge is disconnected")
+		}
+		r.session.queue = append(r.session.queue, m)
+		return true, nil
+	}
+	return false, r.send(m)
+}
+
+// Drop closes the bridge's connection without DISCONNECT, as a lost
+// connection would, and closes any new connection until Resume, as if the
+// remote were unreachable
+func (r *BridgeRemote) Drop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.down = true
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+}
+
+// Resume accepts the bridge's connections again after Drop
+func (r *BridgeRemote) Resume() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.down = false
+}
+
+// send writes m to the connected bridge. The caller holds r.mu.
+func (r *BridgeRemote) send(m BridgeMessage) error {
+	body := AppendString(nil, m.Topic)
+	if m.QoS > 0 {
+		r.nextID = max(r.nextID+1, 1)
+		body = binary.BigEndian.AppendUint16(body, r.nextID)
+	}
+	if r.level >= 5 {
+		body = append(body, 0)
+	}
+	body = append(body, m.Payload...)
+	header := 0x30 | m.QoS<<1
+	if m.Retain {
+		header |= 0x01
+	}
+	_, err := r.conn.Write(RawPacket(header, body))
+	return err
+}
+
+// serve handles one connection until it is closed or replaced
+func (r *BridgeRemote) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	header, body, err := ReadRawPacket(conn)
+	if err != nil || header != 0x10 {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	c, ok := parseBridgeConnect(body)
+	if !ok {
+		return
+	}
+	if !r.open(conn, c) {
+		return
+	}
+	defer func() {
+		r.mu.Lock()
+		if r.conn == conn {
+			r.conn = nil
+		}
+		r.mu.Unlock()
+	}()
+
+	for {
+		header, body, err := ReadRawPacket(conn)
+		if err != nil {
+			return
+		}
+		if !r.handle(conn, c.Level, header, body) {
+			return
+		}
+	}
+}
+
+// open makes conn the bridge's connection, taking over from any earlier
+// one, answers its CONNECT and sends what was queued for its session
+func (r *BridgeRemote) open(conn net.Conn, c BridgeConnect) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.down {
+		return false
+	}
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	if c.CleanSession {
+		delete(r.sessions, c.ClientID)
+	}
+	s, present := r.sessions[c.ClientID]
+	if !present {
+		s = &remoteSession{subs: map[string]BridgeSubscription{}}
+	}
+	if !c.CleanSession {
+		r.sessions[c.ClientID] = s
+	}
+	c.SessionPresent = present
+	r.connects = append(r.connects, c)
+
+	connack := []byte{0, 0}
+	if present {
+		connack[0] = 1
+	}
+	if c.Level >= 5 {
+		connack = append(connack, 0)
+	}
+	if _, err := conn.Write(RawPacket(0x20, connack)); err != nil {
+		return false
+	}
+	r.conn, r.level, r.session = conn, c.Level, s
+	queue := s.queue
+	s.queue = nil
+	for _, m := range queue {
+		if err := r.send(m); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// handle answers a packet from the bridge and reports whether to carry on
+func (r *BridgeRemote) handle(conn net.Conn, level, header byte, body []byte) bool {
+	rd := &reader{b: body}
+	var reply []byte
+	switch header & 0xF0 {
+	case 0x30:
+		m := BridgeMessage{QoS: header >> 1 & 0x03, Retain: header&0x01 != 0, Dup: header&0x08 != 0, At: time.Now()}
+		m.Topic = rd.str()
+		var id uint16
+		if m.QoS > 0 {
+			id = rd.uint16()
+		}
+		if level >= 5 {
+			rd.skip(rd.varint())
+		}
+		if !rd.ok() {
+			return false
+		}
+		m.Payload = slices.Clone(rd.b)
+		r.mu.Lock()
+		r.received = append(r.received, m)
+		r.mu.Unlock()
+		switch m.QoS {
+		case 1:
+			reply = RawPacket(0x40, binary.BigEndian.AppendUint16(nil, id))
+		case 2:
+			reply = RawPacket(0x50, binary.BigEndian.AppendUint16(nil, id))
+		}
+	case 0x60: // PUBREL
+		reply = RawPacket(0x70, body[:min(2, len(body))])
+	case 0x50: // PUBREC of a message sent to the bridge
+		reply = RawPacket(0x62, body[:min(2, len(body))])
+	case 0x80:
+		id := rd.uint16()
+		if level >= 5 {
+			rd.skip(rd.varint())
+		}
+		ack := binary.BigEndian.AppendUint16(nil, id)
+		if level >= 5 {
+			ack = append(ack, 0)
+		}
+		r.mu.Lock()
+		for rd.more() {
+			filter, opts := rd.str(), rd.byte()
+			if !rd.ok() {
+				break
+			}
+			sub := BridgeSubscription{QoS: opts & 0x03, NoLocal: level >= 5 && opts&0x04 != 0}
+			r.session.subs[filter] = sub
+			ack = append(ack, sub.QoS)
+		}
+		r.mu.Unlock()
+		reply = RawPacket(0x90, ack)
+	case 0xA0:
+		id := rd.uint16()
+		if level >= 5 {
+			rd.skip(rd.varint())
+		}
+		ack := binary.BigEndian.AppendUint16(nil, id)
+		if level >= 5 {
+			ack = append(ack, 0)
+		}
+		r.mu.Lock()
+		for rd.more() {
+			filter := rd.str()
+			delete(r.session.subs, filter)
+			if level >= 5 {
+				ack = append(ack, 0)
+			}
+		}
+		r.mu.Unlock()
+		reply = RawPacket(0xB0, ack)
+	case 0xC0:
+		reply = RawPacket(0xD0, nil)
+	case 0xE0:
+		return false
+	}
+	if reply == nil {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := conn.Write(reply)
+	return err == nil
+}
+
+// parseBridgeConnect reads the body of a CONNECT
+func parseBridgeConnect(body []byte) (BridgeConnect, bool) {
+	rd := &reader{b: body}
+	c := BridgeConnect{At: time.Now()}
+	rd.str()
+	level := rd.byte()
+	c.Level, c.Bridge = level&0x7F, level&0x80 != 0
+	flags := rd.byte()
+	c.CleanSession = flags&0x02 != 0
+	rd.uint16()
+	if c.Level >= 5 {
+		rd.skip(rd.varint())
+	}
+	c.ClientID = rd.str()
+	return c, rd.ok()
+}
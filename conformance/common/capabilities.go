@@ -0,0 +1,109 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Feature is an optional broker feature a test depends on
+type Feature int
+
+// Optional features advertised by an MQTT v5 broker in CONNACK
+const (
+	FeatureRetain      Feature = iota + 1 // Retain Available
+	FeatureWildcardSub                    // Wildcard Subscription Available
+	FeatureSharedSub                      // Shared Subscription Available
+	FeatureSubID                          // Subscription Identifiers Available
+	FeatureQoS1                           // Maximum QoS >= 1
+	FeatureQoS2                           // Maximum QoS 2
+)
+
+func (f Feature) String() string {
+	switch f {
+	case FeatureRetain:
+		return "retained messages"
+	case FeatureWildcardSub:
+		return "wildcard subscriptions"
+	case FeatureSharedSub:
+		return "shared subscriptions"
+	case FeatureSubID:
+		return "subscription identifiers"
+	case FeatureQoS1:
+		return "QoS 1"
+	case FeatureQoS2:
+		return "QoS 2"
+	}
+	return fmt.Sprintf("feature %d", int(f))
+}
+
+// Capabilities holds the optional features the broker advertised in CONNACK
+// during preflight. Absent properties mean the feature is available.
+type Capabilities struct {
+	RetainAvailable      bool `json:"retain_available"`
+	WildcardSubAvailable bool `json:"wildcard_sub_available"`
+	SharedSubAvailable   bool `json:"shared_sub_available"`
+	SubIDAvailable       bool `json:"sub_id_available"`
+	MaximumQoS           byte `json:"maximum_qos"`
+}
+
+// Supports reports whether the broker advertised the feature. A nil
+// Capabilities (e.g. MQTT v3.1.1, which has no such properties) supports
+// everything.
+func (c *Capabilities) Supports(f Feature) bool {
+	if c == nil {
+		return true
+	}
+	switch f {
+	case FeatureRetain:
+		return c.RetainAvailable
+	case FeatureWildcardSub:
+		return c.WildcardSubAvailable
+	case FeatureSharedSub:
+		return c.SharedSubAvailable
+	case FeatureSubID:
+		return c.SubIDAvailable
+	case FeatureQoS1:
+		return c.MaximumQoS >= 1
+	case FeatureQoS2:
+		return c.MaximumQoS >= 2
+	}
+	return true
+}
+
+// QoS returns want capped at the broker's Maximum QoS, for tests that
+// publish at QoS 1 or 2 for reliability rather than to test the QoS level
+func (c *Capabilities) QoS(want byte) byte {
+	if c == nil {
+		return want
+	}
+	return min(want, c.MaximumQoS)
+}
+
+// Unsupported returns the features the broker did not advertise
+func (c *Capabilities) Unsupported() []Feature {
+	var missing []Feature
+	for f := FeatureRetain; f <= FeatureQoS2; f++ {
+		if !c.Supports(f) {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+// SkipUnsupported marks result as skipped when the broker legitimately does
+// not support one of the features the test depends on. Tests call it right
+// after building their result and return early when it reports true.
+func SkipUnsupported(cfg Config, result *TestResult, features ...Feature) bool {
+	var missing []string
+	for _, f := range features {
+		if !cfg.Capabilities.Supports(f) {
+			missing = append(missing, f.String())
+		}
+	}
+	if len(missing) == 0 {
+		return false
+	}
+	result.Status = StatusSkipped
+	result.Notes = "broker does not support " + strings.Join(missing, ", ")
+	return true
+}
@@ -0,0 +1,55 @@
+package common
+
+import (
+	"sort"
+	"sync"
+)
+
+// SessionLog records the client IDs of the persistent sessions tests create
+// so they can be ended after the run. It is safe for concurrent use and a
+// nil SessionLog records nothing.
+type SessionLog struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+// NewSessionLog returns an empty session log
+func NewSessionLog() *SessionLog {
+	return &SessionLog{ids: make(map[string]bool)}
+}
+
+// Add records a client ID that connected without a clean start
+func (s *SessionLog) Add(clientID string) {
+	if s == nil || clientID == "" {
+		return
+	}
+	s.mu.Lock()
+	s.ids[clientID] = true
+	s.mu.Unlock()
+}
+
+// ClientIDs returns the recorded client IDs, sorted
+func (s *SessionLog) ClientIDs() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.ids))
+	for id := range s.ids {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// CleanupResult is what a cleanup removed from the broker
+type CleanupResult struct {
+	Retained []string // Topics whose retained message was cleared
+	Sessions []string // Client IDs whose session was ended
+	Errors   []error  // Individual topics or sessions that could not be cleaned
+}
+
+// CleanupFunc clears the retained messages under cfg.TopicNamespace and ends
+// the sessions of clientIDs
+type CleanupFunc func(cfg Config, clientIDs []string) (*CleanupResult, error)
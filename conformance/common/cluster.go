@@ -0,0 +1,447 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OnNode returns c with broker as the broker to connect to, for tests that
+// connect to several nodes of a cluster
+func (c Config) OnNode(broker string) Config {
+	c.Broker = broker
+	return c
+}
+
+// ClusterNodes returns Broker followed by the other nodes of its cluster
+func (c Config) ClusterNodes() []string {
+	return append([]string{c.Broker}, c.Nodes...)
+}
+
+// SkipWithoutCluster marks result as skipped when no other cluster node is
+// configured. Tests call it right after building their result and return
+// early when it reports true.
+func SkipWithoutCluster(cfg Config, result *TestResult) bool {
+	if len(cfg.Nodes) > 0 {
+		return false
+	}
+	result.Status = StatusSkipped
+	result.Notes = "no other cluster node configured (--cluster-nodes)"
+	return true
+}
+
+// nodeName shortens a node URL to its host and port for notes
+func nodeName(broker string) string {
+	if u, err := url.Parse(broker); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return broker
+}
+
+// subscribeOn connects a client to a node subscribed to filter at
+// QoS 1
+func subscribeOn(cfg Config, level byte, prefix, filter string) (*RawConn, error) {
+	conn, err := DialRaw(cfg, level, cfg.ClientID(prefix))
+	if err != nil {
+		return nil, fmt.Errorf("subscriber connect to %s failed: %w", nodeName(cfg.Broker), err)
+	}
+	codes, err := conn.Subscribe(1, 1, cfg.Scaled(5*time.Second), filter)
+	if err == nil && (len(codes) != 1 || codes[0] >= 0x80) {
+		err = fmt.Errorf("SUBACK % x", codes)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("subscribe to %s on %s failed: %w", filter, nodeName(cfg.Broker), err)
+	}
+	return conn, nil
+}
+
+// nextPublish reads the next PUBLISH on conn within timeout and
+// acknowledges it
+func nextPublish(conn *RawConn, timeout time.Duration) (RawPublish, byte, error) {
+	header, body, err := conn.Expect(0x30, timeout, nil)
+	if err != nil {
+		return RawPublish{}, 0, err
+	}
+	p, err := conn.ParsePublish(header, body)
+	if err != nil {
+		return p, header, err
+	}
+	if p.QoS > 0 {
+		conn.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+	}
+	return p, header, nil
+}
+
+// routeBetween subscribes on sub and publishes QoS 1 probes on pub until
+// one is delivered, as a cluster may take a while to spread the
+// subscription, then checks a further message is delivered exactly once.
+// It returns how long the first probe took to arrive.
+func routeBetween(cfg Config, level byte, sub, pub, topic string) (time.Duration, error) {
+	s, err := subscribeOn(cfg.OnNode(sub), level, "test-cluster-sub", topic)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+	p, err := DialRaw(cfg.OnNode(pub), level, cfg.ClientID("test-cluster-pub"))
+	if err != nil {
+		return 0, fmt.Errorf("publisher connect to %s failed: %w", nodeName(pub), err)
+	}
+	defer p.Close()
+
+	start := time.Now()
+	deadline := start.Add(cfg.Scaled(5 * time.Second))
+	routed := false
+	for id := uint16(1); !routed && time.Now().Before(deadline); id++ {
+		if _, err := p.PublishAcked(topic, 1, id, []byte("probe"), cfg.Scaled(5*time.Second)); err != nil {
+			return 0, fmt.Errorf("publish on %s: %w", nodeName(pub), err)
+		}
+		_, _, err := nextPublish(s, cfg.Scaled(200*time.Millisecond))
+		routed = err == nil
+	}
+	lag := time.Since(start)
+	if !routed {
+		return 0, fmt.Errorf("messages published on %s never reached a subscriber on %s", nodeName(pub), nodeName(sub))
+	}
+
+	// Let probes still in flight arrive before counting
+	for {
+		if _, _, err := nextPublish(s, cfg.Scaled(300*time.Millisecond)); err != nil {
+			break
+		}
+	}
+	payload := []byte(GenerateClientID("routed"))
+	if _, err := p.PublishAcked(topic, 1, 0xFFFF, payload, cfg.Scaled(5*time.Second)); err != nil {
+		return 0, fmt.Errorf("publish on %s: %w", nodeName(pub), err)
+	}
+	got := 0
+	for {
+		m, _, err := nextPublish(s, cfg.Scaled(time.Second))
+		if err != nil {
+			break
+		}
+		if bytes.Equal(m.Payload, payload) {
+			got++
+		}
+	}
+	if got != 1 {
+		return 0, fmt.Errorf("message published on %s delivered %d times to a subscriber on %s", nodeName(pub), got, nodeName(sub))
+	}
+	return lag, nil
+}
+
+// CheckClusterRouting checks messages published on each node reach a
+// subscriber on every other node, exactly once
+func CheckClusterRouting(cfg Config, level byte) (string, error) {
+	nodes := cfg.ClusterNodes()
+	var notes []string
+	for i, sub := range nodes {
+		for j, pub := range nodes {
+			if i == j {
+				continue
+			}
+			topic := cfg.Topic(fmt.Sprintf("test/cluster/route/%d-%d", j, i))
+			lag, err := routeBetween(cfg, level, sub, pub, topic)
+			if err != nil {
+				return "", err
+			}
+			notes = append(notes, fmt.Sprintf("%s → %s in %v", nodeName(pub), nodeName(sub), lag.Round(time.Millisecond)))
+		}
+	}
+	return strings.Join(notes, ", "), nil
+}
+
+// awaitRetained connects to node, subscribes to topic and reports whether a
+// retained message with payload arrived, retrying until timeout as the
+// cluster may take a while to replicate it. An empty payload waits for no
+// retained message to arrive instead, as after it was cleared.
+func awaitRetained(cfg Config, level byte, topic string, payload []byte, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	for {
+		conn, err := subscribeOn(cfg, level, "test-cluster-retained", topic)
+		if err != nil {
+			return 0, err
+		}
+		m, header, err := nextPublish(conn, cfg.Scaled(500*time.Millisecond))
+		conn.Close()
+		switch {
+		case len(payload) == 0 && err != nil:
+			return time.Since(start), nil
+		case len(payload) > 0 && err == nil && bytes.Equal(m.Payload, payload):
+			if header&0x01 == 0 {
+				return 0, fmt.Errorf("retained message delivered on %s without the retain flag", nodeName(cfg.Broker))
+			}
+			return time.Since(start), nil
+		}
+		if time.Since(start) > timeout {
+			if len(payload) == 0 {
+				return 0, fmt.Errorf("cleared retained message still delivered on %s after %v", nodeName(cfg.Broker), timeout)
+			}
+			return 0, fmt.Errorf("retained message not delivered to a new subscriber on %s within %v", nodeName(cfg.Broker), timeout)
+		}
+	}
+}
+
+// publishRetainedOn publishes a QoS 1 retained message on node, clearing
+// the topic's retained message when payload is empty
+func publishRetainedOn(cfg Config, level byte, topic string, payload []byte) error {
+	conn, err := DialRaw(cfg, level, cfg.ClientID("test-cluster-retain"))
+	if err != nil {
+		return fmt.Errorf("publisher connect to %s failed: %w", nodeName(cfg.Broker), err)
+	}
+	defer conn.Close()
+	body := AppendString(nil, topic)
+	body = binary.BigEndian.AppendUint16(body, 1)
+	if level >= 5 {
+		body = append(body, 0)
+	}
+	body = append(body, payload...)
+	if err := conn.Send(0x33, body); err != nil {
+		return err
+	}
+	if _, _, err := conn.Expect(0x40, cfg.Scaled(5*time.Second), nil); err != nil {
+		return fmt.Errorf("retained publish on %s: %w", nodeName(cfg.Broker), err)
+	}
+	conn.Send(0xE0, nil)
+	return nil
+}
+
+// CheckClusterRetained publishes a retained message on the first node and
+// checks a new subscriber on every other node receives it, then clears it
+// and checks it is gone everywhere
+func CheckClusterRetained(cfg Config, level byte) (string, error) {
+	topic := cfg.Topic("test/cluster/retained")
+	payload := []byte(GenerateClientID("retained"))
+	if err := publishRetainedOn(cfg, level, topic, payload); err != nil {
+		return "", err
+	}
+	cleared := false
+	defer func() {
+		if !cleared {
+			publishRetainedOn(cfg, level, topic, nil)
+		}
+	}()
+
+	var notes []string
+	for _, node := range cfg.Nodes {
+		lag, err := awaitRetained(cfg.OnNode(node), level, topic, payload, cfg.Scaled(5*time.Second))
+		if err != nil {
+			return "", err
+		}
+		notes = append(notes, fmt.Sprintf("%s after %v", nodeName(node), lag.Round(time.Millisecond)))
+	}
+
+	if err := publishRetainedOn(cfg, level, topic, nil); err != nil {
+		return "", err
+	}
+	cleared = true
+	for _, node := range cfg.Nodes {
+		if _, err := awaitRetained(cfg.OnNode(node), level, topic, nil, cfg.Scaled(5*time.Second)); err != nil {
+			return "", err
+		}
+	}
+	return "replicated to " + strings.Join(notes, ", ") + ", cleared everywhere", nil
+}
+
+// clusterSharedMessages is how many messages CheckClusterShared publishes
+const clusterSharedMessages = 40
+
+// CheckClusterShared subscribes a member of one shared subscription group on
+// every node and publishes QoS 1 messages on the nodes in turn. Every
+// message must reach exactly one member. It returns how many each node's
+// member received and whether more than one member received any.
+func CheckClusterShared(cfg Config, level byte) (string, bool, error) {
+	topic := cfg.Topic("test/cluster/shared")
+	filter := "$share/" + strings.ReplaceAll(GenerateClientID("g"), "-", "") + "/" + topic
+	nodes := cfg.ClusterNodes()
+
+	members := make([]*RawConn, len(nodes))
+	for i, node := range nodes {
+		conn, err := subscribeOn(cfg.OnNode(node), level, "test-cluster-shared", filter)
+		if err != nil {
+			return "", false, err
+		}
+		defer conn.Close()
+		members[i] = conn
+	}
+	// Give the cluster time to spread the members
+	cfg.Wait(time.Second)
+
+	var mu sync.Mutex
+	received := map[string]int{}
+	counts := make([]int, len(nodes))
+	var wg sync.WaitGroup
+	for i, conn := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				m, _, err := nextPublish(conn, cfg.Scaled(2*time.Second))
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				received[string(m.Payload)]++
+				counts[i]++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range clusterSharedMessages {
+		node := nodes[i%len(nodes)]
+		if err := publishOn(cfg.OnNode(node), level, topic, fmt.Appendf(nil, "shared-%d", i)); err != nil {
+			return "", false, err
+		}
+	}
+	wg.Wait()
+
+	var missing, duplicated []string
+	for i := range clusterSharedMessages {
+		switch n := received[fmt.Sprintf("shared-%d", i)]; {
+		case n == 0:
+			missing = append(missing, fmt.Sprint(i))
+		case n > 1:
+			duplicated = append(duplicated, fmt.Sprintf("%d (%d times)", i, n))
+		}
+	}
+	switch {
+	case len(duplicated) > 0:
+		return "", false, fmt.Errorf("messages delivered to more than one member of the group: %s", strings.Join(duplicated, ", "))
+	case len(missing) > 0:
+		return "", false, fmt.Errorf("%d of %d messages reached no member of the group", len(missing), clusterSharedMessages)
+	}
+
+	var parts []string
+	active := 0
+	for i, node := range nodes {
+		parts = append(parts, fmt.Sprintf("%s: %d", nodeName(node), counts[i]))
+		if counts[i] > 0 {
+			active++
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", "), active > 1, nil
+}
+
+// publishOn publishes a QoS 1 message on a node from a new connection
+func publishOn(cfg Config, level byte, topic string, payload []byte) error {
+	conn, err := DialRaw(cfg, level, cfg.ClientID("test-cluster-pub"))
+	if err != nil {
+		return fmt.Errorf("publisher connect to %s failed: %w", nodeName(cfg.Broker), err)
+	}
+	defer conn.Close()
+	if _, err := conn.PublishAcked(topic, 1, 1, payload, cfg.Scaled(5*time.Second)); err != nil {
+		return fmt.Errorf("publish on %s: %w", nodeName(cfg.Broker), err)
+	}
+	conn.Send(0xE0, nil)
+	return nil
+}
+
+// dialPersistent connects clientID to a node without a clean session, with
+// a 300 second Session Expiry Interval in MQTT 5, and returns the
+// connection and the CONNACK's Session Present flag
+func dialPersistent(cfg Config, level byte, clientID string) (*RawConn, bool, error) {
+	conn, err := Dial(cfg)
+	if err != nil {
+		return nil, false, err
+	}
+	cfg.Sessions.Add(clientID)
+	flags := byte(0)
+	if cfg.Username != "" {
+		flags |= 0x80
+	}
+	if cfg.Password != "" {
+		flags |= 0x40
+	}
+	body := AppendString(nil, "MQTT")
+	body = append(body, level, flags, 0, 30)
+	if level >= 5 {
+		body = append(body, 5, 0x11, 0, 0, 0x01, 0x2C) // Session Expiry Interval 300
+	}
+	body = AppendString(body, clientID)
+	if cfg.Username != "" {
+		body = AppendString(body, cfg.Username)
+	}
+	if cfg.Password != "" {
+		body = AppendString(body, cfg.Password)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(RawPacket(0x10, body)); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+	header, ack, err := ReadRawPacket(conn)
+	if err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to read CONNACK: %w", err)
+	}
+	if header != 0x20 || len(ack) < 2 || ack[1] != 0 {
+		conn.Close()
+		return nil, false, fmt.Errorf("connection to %s refused: packet 0x%02x % x", nodeName(cfg.Broker), header, ack)
+	}
+	conn.SetDeadline(time.Time{})
+	return &RawConn{Conn: conn, Level: level, ReceiveMaximum: 65535}, ack[0]&0x01 != 0, nil
+}
+
+// CheckClusterTakeover connects a client with a persistent session and a
+// subscription to the first node, then connects with the same client ID to
+// the second node. The cluster must close the first connection and resume
+// the session on the second: Session Present set, and the subscription
+// delivering messages published on the first node.
+func CheckClusterTakeover(cfg Config, level byte) (string, error) {
+	clientID := cfg.ClientID("test-cluster-takeover")
+	topic := cfg.Topic("test/cluster/takeover")
+	other := cfg.OnNode(cfg.Nodes[0])
+
+	first, _, err := dialPersistent(cfg, level, clientID)
+	if err != nil {
+		return "", err
+	}
+	defer first.Close()
+	codes, err := first.Subscribe(1, 1, cfg.Scaled(5*time.Second), topic)
+	if err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		return "", fmt.Errorf("subscribe on %s failed: %v % x", nodeName(cfg.Broker), err, codes)
+	}
+
+	second, present, err := dialPersistent(other, level, clientID)
+	if err != nil {
+		return "", fmt.Errorf("reconnect to %s: %w", nodeName(other.Broker), err)
+	}
+	defer second.Close()
+
+	data, closed := AwaitClose(first, cfg.Scaled(5*time.Second))
+	if !closed {
+		return "", fmt.Errorf("connection to %s still open after the client ID connected to %s", nodeName(cfg.Broker), nodeName(other.Broker))
+	}
+	if !present {
+		return "", fmt.Errorf("CONNACK from %s has Session Present 0, the session from %s was not taken over", nodeName(other.Broker), nodeName(cfg.Broker))
+	}
+
+	payload := []byte(GenerateClientID("takeover"))
+	if err := publishOn(cfg, level, topic, payload); err != nil {
+		return "", err
+	}
+	deadline := time.Now().Add(cfg.Scaled(5 * time.Second))
+	for {
+		m, _, err := nextPublish(second, time.Until(deadline))
+		if err != nil {
+			return "", fmt.Errorf("subscription from %s not delivering on %s after the takeover: %w", nodeName(cfg.Broker), nodeName(other.Broker), err)
+		}
+		if bytes.Equal(m.Payload, payload) {
+			break
+		}
+	}
+	second.Send(0xE0, nil)
+
+	notes := fmt.Sprintf("session moved from %s to %s", nodeName(cfg.Broker), nodeName(other.Broker))
+	if reason, ok := DisconnectReason(data); ok && level >= 5 {
+		notes += fmt.Sprintf(", old connection sent DISCONNECT 0x%02x", reason)
+	}
+	return notes, nil
+}
@@ -0,0 +1,139 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// CompareOptions tunes what counts as a duration regression
+type CompareOptions struct {
+	// DurationThreshold is the relative slowdown that counts as a
+	// regression, e.g. 0.5 for 50% slower
+	DurationThreshold float64
+
+	// MinDurationDelta ignores slowdowns smaller than this, so fast tests
+	// jittering by a few milliseconds are not reported
+	MinDurationDelta time.Duration
+}
+
+// ResultChange is one test as it appeared in the old and the new run. Old or
+// New is nil when the test only exists in one of them.
+type ResultChange struct {
+	Group string
+	Name  string
+	Old   *TestResult
+	New   *TestResult
+}
+
+// Comparison is the difference between two runs of the same suite
+type Comparison struct {
+	NewlyFailing []ResultChange // Failed now, did not fail before
+	NewlyPassing []ResultChange // Passes now, failed before
+	Changed      []ResultChange // Any other status change, e.g. passed to skipped
+	Slower       []ResultChange // Same status but beyond the duration threshold
+	Added        []ResultChange
+	Removed      []ResultChange
+}
+
+// Regressed reports whether the new run is worse than the old one
+func (c *Comparison) Regressed() bool {
+	return len(c.NewlyFailing) > 0 || len(c.Slower) > 0
+}
+
+// CompareReports matches the results of two runs by group and test name
+func CompareReports(before, after *Report, opts CompareOptions) *Comparison {
+	key := func(r *TestResult) string { return r.Group + "\x00" + r.Name }
+
+	oldResults := make(map[string]*TestResult)
+	for i := range before.Results {
+		oldResults[key(&before.Results[i])] = &before.Results[i]
+	}
+
+	c := &Comparison{}
+	seen := make(map[string]bool)
+	for i := range after.Results {
+		n := &after.Results[i]
+		seen[key(n)] = true
+		change := ResultChange{Group: n.Group, Name: n.Name, New: n}
+
+		o, ok := oldResults[key(n)]
+		if !ok {
+			c.Added = append(c.Added, change)
+			continue
+		}
+		change.Old = o
+
+		switch {
+		case n.Status == StatusFailed && o.Status != StatusFailed:
+			c.NewlyFailing = append(c.NewlyFailing, change)
+		case n.Status == StatusPassed && o.Status == StatusFailed:
+			c.NewlyPassing = append(c.NewlyPassing, change)
+		case n.Status != o.Status:
+			c.Changed = append(c.Changed, change)
+		case slower(o.Duration, n.Duration, opts):
+			c.Slower = append(c.Slower, change)
+		}
+	}
+
+	for i := range before.Results {
+		o := &before.Results[i]
+		if !seen[key(o)] {
+			c.Removed = append(c.Removed, ResultChange{Group: o.Group, Name: o.Name, Old: o})
+		}
+	}
+	return c
+}
+
+func slower(before, after time.Duration, opts CompareOptions) bool {
+	delta := after - before
+	if delta <= 0 || delta < opts.MinDurationDelta {
+		return false
+	}
+	return float64(after) > float64(before)*(1+opts.DurationThreshold)
+}
+
+// PrintComparison prints the differences between two runs
+func PrintComparison(before, after *Report, c *Comparison) {
+	fmt.Printf("\n%s\n", TitleStyle.Render("Conformance Run Comparison"))
+	fmt.Printf("%s\n", SubtitleStyle.Render(fmt.Sprintf("Old: %s against %s (%s)", before.Title, before.Broker, before.Started.Format(time.RFC3339))))
+	fmt.Printf("%s\n", SubtitleStyle.Render(fmt.Sprintf("New: %s against %s (%s)", after.Title, after.Broker, after.Started.Format(time.RFC3339))))
+
+	section := func(title string, changes []ResultChange, describe func(ResultChange) string) {
+		if len(changes) == 0 {
+			return
+		}
+		fmt.Printf("\n%s\n", GroupStyle.Render(fmt.Sprintf("%s (%d)", title, len(changes))))
+		for _, ch := range changes {
+			fmt.Printf("  %s / %s: %s\n", ch.Group, ch.Name, describe(ch))
+		}
+	}
+	transition := func(ch ResultChange) string {
+		s := fmt.Sprintf("%s → %s", ch.Old.Status, ch.New.Status)
+		if ch.New.Error != nil {
+			s += " " + ErrorStyle.Render(ch.New.Error.Error())
+		}
+		return s
+	}
+
+	section("Newly failing", c.NewlyFailing, transition)
+	section("Newly passing", c.NewlyPassing, transition)
+	section("Other status changes", c.Changed, transition)
+	section("Slower", c.Slower, func(ch ResultChange) string {
+		return fmt.Sprintf("%v → %v (%+.0f%%)", ch.Old.Duration.Round(time.Millisecond), ch.New.Duration.Round(time.Millisecond),
+			100*(float64(ch.New.Duration)/float64(ch.Old.Duration)-1))
+	})
+	section("Added", c.Added, func(ch ResultChange) string { return ch.New.Status.String() })
+	section("Removed", c.Removed, func(ch ResultChange) string { return ch.Old.Status.String() })
+
+	oldCounts, newCounts := before.Counts(), after.Counts()
+	oldScore, newScore := before.Score(), after.Score()
+	fmt.Printf("\n%s\n", SummaryStyle.Render("Summary"))
+	fmt.Printf("  Passed: %d → %d\n", oldCounts[StatusPassed], newCounts[StatusPassed])
+	fmt.Printf("  Failed: %d → %d\n", oldCounts[StatusFailed], newCounts[StatusFailed])
+	fmt.Printf("  Weighted score: %.1f%% → %.1f%%\n", oldScore.Percent(), newScore.Percent())
+	if c.Regressed() {
+		fmt.Printf("  %s\n", FailStyle.Render(fmt.Sprintf("Regressions: %d newly failing, %d slower", len(c.NewlyFailing), len(c.Slower))))
+	} else {
+		fmt.Printf("  %s\n", PassStyle.Render("No regressions"))
+	}
+}
@@ -0,0 +1,184 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Size of the concurrent publishers check: enough publishers sending at once
+// that the broker handles their messages on several connections in parallel
+const (
+	concurrentPublishers = 8
+	concurrentMessages   = 100
+)
+
+// ConcurrentDelivery is what one subscriber received from publishers
+// sending QoS 1 messages to its topic at the same time
+type ConcurrentDelivery struct {
+	Publishers int // Publishers sending at once
+	Messages   int // Messages each of them sent
+	Duplicates int // Messages received again after later ones of the same publisher
+}
+
+// String describes the delivery for notes
+func (d ConcurrentDelivery) String() string {
+	s := fmt.Sprintf("%d publishers × %d QoS 1 messages delivered in order", d.Publishers, d.Messages)
+	if d.Duplicates > 0 {
+		s += fmt.Sprintf(", %d duplicates", d.Duplicates)
+	}
+	return s
+}
+
+// CheckConcurrentPublishers has several clients publish numbered QoS 1
+// messages to the same topic at once, each keeping as many in flight as the
+// broker's Receive Maximum allows, while one QoS 1 subscriber reads them.
+// Every publisher's messages must arrive in the order it sent them and none
+// may be lost [MQTT-4.6.0-6]. A message received again after it was first
+// delivered is counted as a duplicate, which QoS 1 allows.
+func CheckConcurrentPublishers(cfg Config, level byte) (ConcurrentDelivery, error) {
+	delivery := ConcurrentDelivery{Publishers: concurrentPublishers, Messages: concurrentMessages}
+	topic := cfg.Topic(GenerateTopicName("test/concurrent-publishers"))
+	timeout := cfg.Scaled(5 * time.Second)
+
+	sub, err := DialRaw(cfg, level, cfg.ClientID("test-concurrent-sub"))
+	if err != nil {
+		return delivery, fmt.Errorf("subscriber connect failed: %w", err)
+	}
+	defer sub.Close()
+	if codes, err := sub.Subscribe(1, 1, timeout, topic); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		return delivery, fmt.Errorf("subscribe failed: %v % x", err, codes)
+	}
+
+	pubs := make([]*RawConn, concurrentPublishers)
+	for i := range pubs {
+		pub, err := DialRaw(cfg, level, cfg.ClientID(fmt.Sprintf("test-concurrent-pub-%d", i)))
+		if err != nil {
+			return delivery, fmt.Errorf("publisher %d connect failed: %w", i, err)
+		}
+		defer pub.Close()
+		pubs[i] = pub
+	}
+
+	// Connect everyone first, then let the publishers go together
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrentPublishers)
+	begin := make(chan struct{})
+	for i, pub := range pubs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-begin
+			if err := publishNumbered(pub, topic, i, timeout); err != nil {
+				errs <- fmt.Errorf("publisher %d: %w", i, err)
+			}
+		}()
+	}
+	close(begin)
+
+	// next holds the sequence number expected from each publisher
+	next := make([]int, concurrentPublishers)
+	pending := concurrentPublishers * concurrentMessages
+	deadline := time.Now().Add(cfg.Scaled(30 * time.Second))
+	for pending > 0 {
+		select {
+		case err := <-errs:
+			return delivery, err
+		default:
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return delivery, fmt.Errorf("%s", lostMessages(next))
+		}
+		header, body, err := sub.Expect(0x30, min(remaining, timeout), nil)
+		if err != nil {
+			select {
+			case pubErr := <-errs:
+				return delivery, pubErr
+			default:
+			}
+			return delivery, fmt.Errorf("%s: %w", lostMessages(next), err)
+		}
+		p, err := sub.ParsePublish(header, body)
+		if err != nil {
+			return delivery, err
+		}
+		if p.QoS > 0 {
+			if err := sub.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID)); err != nil {
+				return delivery, fmt.Errorf("failed to send PUBACK: %w", err)
+			}
+		}
+		var publisher, seq int
+		if _, err := fmt.Sscanf(string(p.Payload), "p%d-%d", &publisher, &seq); err != nil || publisher < 0 || publisher >= concurrentPublishers {
+			return delivery, fmt.Errorf("unexpected message %q", p.Payload)
+		}
+		switch {
+		case seq < next[publisher]:
+			delivery.Duplicates++
+		case seq > next[publisher]:
+			return delivery, fmt.Errorf("publisher %d: message %d received before message %d", publisher, seq, next[publisher])
+		default:
+			next[publisher]++
+			pending--
+		}
+	}
+
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return delivery, err
+	}
+	return delivery, nil
+}
+
+// publishNumbered sends publisher's messages p<publisher>-0 to
+// p<publisher>-<n-1> at QoS 1, with up to the broker's Receive Maximum
+// unacknowledged, and waits for every PUBACK
+func publishNumbered(pub *RawConn, topic string, publisher int, timeout time.Duration) error {
+	window := max(1, min(int(pub.ReceiveMaximum), concurrentMessages))
+	inflight := 0
+	awaitAck := func() error {
+		_, ack, err := pub.Expect(0x40, timeout, nil)
+		if err != nil {
+			return err
+		}
+		if len(ack) > 2 && ack[2] >= 0x80 {
+			return fmt.Errorf("PUBLISH refused with PUBACK reason code 0x%02x", ack[2])
+		}
+		inflight--
+		return nil
+	}
+	for seq := range concurrentMessages {
+		if inflight == window {
+			if err := awaitAck(); err != nil {
+				return err
+			}
+		}
+		payload := fmt.Appendf(nil, "p%d-%d", publisher, seq)
+		if err := pub.Publish(topic, 1, uint16(seq+1), payload); err != nil {
+			return fmt.Errorf("failed to send PUBLISH: %w", err)
+		}
+		inflight++
+	}
+	for inflight > 0 {
+		if err := awaitAck(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lostMessages describes the messages not received yet
+func lostMessages(next []int) string {
+	lost := 0
+	first := -1
+	for i, n := range next {
+		lost += concurrentMessages - n
+		if n < concurrentMessages && first < 0 {
+			first = i
+		}
+	}
+	return fmt.Sprintf("%d of %d messages not received, the first missing one is message %d of publisher %d",
+		lost, concurrentPublishers*concurrentMessages, next[first], first)
+}
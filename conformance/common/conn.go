@@ -0,0 +1,40 @@
+package common
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// CountingConn wraps a net.Conn and counts the bytes read and written on the wire
+type CountingConn struct {
+	net.Conn
+	read    atomic.Uint64
+	written atomic.Uint64
+}
+
+// NewCountingConn wraps conn with byte accounting
+func NewCountingConn(conn net.Conn) *CountingConn {
+	return &CountingConn{Conn: conn}
+}
+
+func (c *CountingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(uint64(n))
+	return n, err
+}
+
+func (c *CountingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(uint64(n))
+	return n, err
+}
+
+// BytesRead returns the number of bytes read from the connection
+func (c *CountingConn) BytesRead() uint64 {
+	return c.read.Load()
+}
+
+// BytesWritten returns the number of bytes written to the connection
+func (c *CountingConn) BytesWritten() uint64 {
+	return c.written.Load()
+}
@@ -0,0 +1,282 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// CoverageStatus is how well the registered tests cover a spec statement
+type CoverageStatus int
+
+const (
+	NotCovered CoverageStatus = iota
+	PartiallyCovered
+	Covered
+)
+
+func (c CoverageStatus) String() string {
+	switch c {
+	case Covered:
+		return "covered"
+	case PartiallyCovered:
+		return "partial"
+	}
+	return "not covered"
+}
+
+// TestRef identifies a registered test and the spec statement it verifies
+type TestRef struct {
+	Group   string
+	Name    string
+	SpecRef string
+	Level   spec.Level // Set by the test itself, LevelUnknown when it leaves it to SpecRef
+	Tags    []string   // The group's tags
+}
+
+// StatementCoverage is the coverage of one normative statement
+type StatementCoverage struct {
+	spec.Statement
+	Status CoverageStatus
+	Tests  []string // Names of the tests covering the statement
+}
+
+// Coverage cross-references registered tests against a specification
+type Coverage struct {
+	Spec       string
+	Statements []StatementCoverage
+
+	// Unmatched are tests whose SpecRef names neither a statement nor a
+	// section containing statements
+	Unmatched []TestRef
+}
+
+// CollectTestRefs returns the SpecRef of every test in groups. SpecRefs are
+// only known once a test has built its result, so each test is run against a
+// listener that hangs up immediately, which makes it return straight away.
+func CollectTestRefs(groups []TestGroup) ([]TestRef, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start listener: %w", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	cfg := Config{Broker: "tcp://" + ln.Addr().String()}
+	var refs []TestRef
+	for _, group := range groups {
+		for _, testFunc := range group.Tests {
+			result := testFunc(context.Background(), cfg)
+			refs = append(refs, TestRef{
+				Group:   group.Name,
+				Name:    result.Name,
+				SpecRef: result.SpecRef,
+				Level:   result.Level,
+				Tags:    group.Tags,
+			})
+		}
+	}
+	return refs, nil
+}
+
+// BuildCoverage matches test references against the numbered statements of a
+// specification version. A statement is covered when a test names it,
+// partially covered when a test only names the section containing it, and
+// not covered otherwise.
+func BuildCoverage(version string, refs []TestRef) Coverage {
+	statements := spec.Statements(version)
+	cov := Coverage{Spec: version}
+
+	exact := make(map[string][]string)
+	sections := make(map[string][]string)
+	known := make(map[string]bool)
+	for _, st := range statements {
+		known[st.Ref] = true
+	}
+	for _, ref := range refs {
+		if ref.SpecRef == "" {
+			cov.Unmatched = append(cov.Unmatched, ref)
+			continue
+		}
+		if known[ref.SpecRef] {
+			exact[ref.SpecRef] = append(exact[ref.SpecRef], ref.Name)
+			continue
+		}
+		section := refSection(ref.SpecRef)
+		if !hasSection(statements, section) {
+			cov.Unmatched = append(cov.Unmatched, ref)
+			continue
+		}
+		sections[section] = append(sections[section], ref.Name)
+	}
+
+	for _, st := range statements {
+		sc := StatementCoverage{Statement: st}
+		if tests := exact[st.Ref]; len(tests) > 0 {
+			sc.Status = Covered
+			sc.Tests = tests
+		} else {
+			for section, tests := range sections {
+				if inSection(st.Section, section) {
+					sc.Status = PartiallyCovered
+					sc.Tests = append(sc.Tests, tests...)
+				}
+			}
+			sort.Strings(sc.Tests)
+		}
+		cov.Statements = append(cov.Statements, sc)
+	}
+	return cov
+}
+
+// Count returns the number of statements with the given status
+func (c Coverage) Count(status CoverageStatus) int {
+	n := 0
+	for _, sc := range c.Statements {
+		if sc.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// refSection returns the section number of a ref such as "MQTT-3.2.2.3.2" or
+// "MQTT-3.3.2.3.3-2"
+func refSection(ref string) string {
+	section := strings.TrimPrefix(ref, "MQTT-")
+	if i := strings.Index(section, "-"); i >= 0 {
+		section = section[:i]
+	}
+	return section
+}
+
+// inSection reports whether section lies within parent
+func inSection(section, parent string) bool {
+	return section == parent || strings.HasPrefix(section, parent+".")
+}
+
+func hasSection(statements []spec.Statement, section string) bool {
+	for _, st := range statements {
+		if inSection(st.Section, section) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintCoverage prints a per-section coverage matrix. With gaps set it also
+// lists every statement that is not fully covered, MUST statements first.
+func PrintCoverage(title string, cov Coverage, gaps bool) {
+	fmt.Printf("\n%s\n", TitleStyle.Render(title))
+
+	// Per top-level section
+	type row struct{ covered, partial, missing int }
+	rows := make(map[string]*row)
+	var order []string
+	for _, sc := range cov.Statements {
+		top := topSection(sc.Section)
+		r, ok := rows[top]
+		if !ok {
+			r = &row{}
+			rows[top] = r
+			order = append(order, top)
+		}
+		switch sc.Status {
+		case Covered:
+			r.covered++
+		case PartiallyCovered:
+			r.partial++
+		default:
+			r.missing++
+		}
+	}
+
+	fmt.Printf("  %-10s %8s %8s %12s %10s\n", "Section", "Covered", "Partial", "Not covered", "Coverage")
+	for _, section := range order {
+		r := rows[section]
+		total := r.covered + r.partial + r.missing
+		fmt.Printf("  %-10s %8d %8d %12d %9.0f%%\n", section, r.covered, r.partial, r.missing, percent(r.covered, total))
+	}
+
+	total := len(cov.Statements)
+	fmt.Printf("\n%s\n", SummaryStyle.Render("Summary"))
+	fmt.Printf("  Statements:    %d\n", total)
+	fmt.Printf("  Covered:       %s (%.0f%%)\n", PassStyle.Render(fmt.Sprintf("%d", cov.Count(Covered))), percent(cov.Count(Covered), total))
+	fmt.Printf("  Partial:       %s (%.0f%%)\n", WarnStyle.Render(fmt.Sprintf("%d", cov.Count(PartiallyCovered))), percent(cov.Count(PartiallyCovered), total))
+	fmt.Printf("  Not covered:   %s (%.0f%%)\n", FailStyle.Render(fmt.Sprintf("%d", cov.Count(NotCovered))), percent(cov.Count(NotCovered), total))
+
+	if len(cov.Unmatched) > 0 {
+		fmt.Printf("\n%s\n", SummaryStyle.Render("Tests not matched to any statement"))
+		for _, ref := range cov.Unmatched {
+			specRef := ref.SpecRef
+			if specRef == "" {
+				specRef = "none"
+			}
+			fmt.Printf("  %s / %s [%s]\n", ref.Group, ref.Name, specRef)
+		}
+	}
+
+	if !gaps {
+		return
+	}
+
+	var missing []StatementCoverage
+	for _, sc := range cov.Statements {
+		if sc.Status != Covered {
+			missing = append(missing, sc)
+		}
+	}
+	// Uncovered MUST statements are the most valuable tests to write next
+	sort.SliceStable(missing, func(i, j int) bool {
+		if missing[i].Level != missing[j].Level {
+			return missing[i].Level > missing[j].Level
+		}
+		return missing[i].Status < missing[j].Status
+	})
+
+	fmt.Printf("\n%s\n", SummaryStyle.Render("Gaps"))
+	for _, sc := range missing {
+		label := FailStyle.Render("✗")
+		if sc.Status == PartiallyCovered {
+			label = WarnStyle.Render("~")
+		}
+		fmt.Printf("  %s %s [%s] %s\n", label, sc.Ref, sc.Level, truncate(sc.Text, 100))
+	}
+}
+
+// topSection returns the first two levels of a section number, e.g. "3.1"
+// for "3.1.2.3"
+func topSection(section string) string {
+	parts := strings.SplitN(section, ".", 3)
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return strings.Join(parts, ".")
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
@@ -0,0 +1,142 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// CheckDisconnectClose sends a DISCONNECT without a reason code on a raw
+// connection at protocol level, leaving the connection open on its side, and
+// checks the broker closes it within a second, scaled by the timing
+// multiplier, without sending anything first. It returns how long the broker
+// took. The Server SHOULD close the Network Connection on receipt of the
+// DISCONNECT if the Client has not already done so.
+func CheckDisconnectClose(cfg Config, level byte) (time.Duration, error) {
+	conn, err := DialRaw(cfg, level, cfg.ClientID("test-disconnect-close"))
+	if err != nil {
+		return 0, fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+
+	sent := time.Now()
+	if err := conn.Send(0xE0, nil); err != nil {
+		return 0, fmt.Errorf("failed to send DISCONNECT: %w", err)
+	}
+	timeout := cfg.Scaled(time.Second)
+	data, closed := AwaitClose(conn, timeout)
+	took := time.Since(sent)
+	switch {
+	case len(data) > 0:
+		return took, fmt.Errorf("broker answered the DISCONNECT with %s", PacketName(data[0]))
+	case !closed:
+		return took, fmt.Errorf("connection still open %v after the DISCONNECT", timeout)
+	}
+	return took, nil
+}
+
+// CheckPacketsAfterDisconnect sends a DISCONNECT and, in the same write, a
+// QoS 1 PUBLISH to a topic another client subscribes to, and checks the
+// broker ignores the PUBLISH: it must neither acknowledge it nor deliver it.
+// A client sends nothing after its DISCONNECT, so whatever follows one on the
+// connection is not part of the session.
+func CheckPacketsAfterDisconnect(cfg Config, level byte) error {
+	topic := cfg.Topic(GenerateTopicName("test/disconnect/after"))
+	timeout := cfg.Scaled(5 * time.Second)
+
+	sub, err := DialRaw(cfg, level, cfg.ClientID("test-after-disconnect-sub"))
+	if err != nil {
+		return fmt.Errorf("subscriber connect failed: %w", err)
+	}
+	defer sub.Close()
+	if codes, err := sub.Subscribe(1, 1, timeout, topic); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		return fmt.Errorf("subscribe failed: %v % x", err, codes)
+	}
+
+	conn, err := DialRaw(cfg, level, cfg.ClientID("test-after-disconnect"))
+	if err != nil {
+		return fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+
+	body := AppendString(nil, topic)
+	body = binary.BigEndian.AppendUint16(body, 1)
+	if level >= 5 {
+		body = append(body, 0) // No properties
+	}
+	body = append(body, "sent after DISCONNECT"...)
+	packets := append(RawPacket(0xE0, nil), RawPacket(0x32, body)...)
+	if _, err := conn.Write(packets); err != nil {
+		return fmt.Errorf("failed to send DISCONNECT and PUBLISH: %w", err)
+	}
+	data, closed := AwaitClose(conn, cfg.Scaled(2*time.Second))
+	switch {
+	case len(data) > 0:
+		return fmt.Errorf("broker answered the PUBLISH after the DISCONNECT with %s", PacketName(data[0]))
+	case !closed:
+		return fmt.Errorf("connection still open after the DISCONNECT")
+	}
+
+	if _, _, err := sub.Expect(0x30, cfg.Scaled(time.Second), nil); err == nil {
+		return fmt.Errorf("PUBLISH sent after the DISCONNECT was delivered")
+	}
+	return nil
+}
+
+// CheckSecondConnectMidSession resumes a persistent session holding a QoS 1
+// subscription and sends a second CONNECT on it with the same Client
+// Identifier and a clean session requested. The broker must close the connection
+// without processing the CONNECT [MQTT-3.1.0-2], so the session and its
+// subscription must be there on reconnecting.
+func CheckSecondConnectMidSession(cfg Config, level byte) error {
+	clientID := cfg.ClientID("test-second-connect-session")
+	topic := cfg.Topic(GenerateTopicName("test/connect/second"))
+	timeout := cfg.Scaled(5 * time.Second)
+
+	conn, _, err := dialPersistent(cfg, level, clientID)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if codes, err := conn.Subscribe(1, 1, timeout, topic); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		return fmt.Errorf("subscribe failed: %v % x", err, codes)
+	}
+
+	if _, err := conn.Write(RawConnect(level, clientID, cfg.Username, cfg.Password)); err == nil {
+		data, closed := AwaitClose(conn, cfg.Scaled(2*time.Second))
+		switch {
+		case len(data) > 0 && data[0] != 0xE0:
+			return fmt.Errorf("broker answered the second CONNECT with %s", PacketName(data[0]))
+		case !closed:
+			return fmt.Errorf("broker kept the connection open after a second CONNECT")
+		}
+	}
+
+	conn, present, err := dialPersistent(cfg, level, clientID)
+	if err != nil {
+		return fmt.Errorf("reconnect failed: %w", err)
+	}
+	defer conn.Close()
+	if !present {
+		return fmt.Errorf("CONNACK on reconnecting has Session Present 0, the second CONNECT was processed and discarded the session")
+	}
+
+	pub, err := DialRaw(cfg, level, cfg.ClientID("test-second-connect-pub"))
+	if err != nil {
+		return fmt.Errorf("publisher connect failed: %w", err)
+	}
+	defer pub.Close()
+	payload := []byte(GenerateClientID("second-connect"))
+	if reason, err := pub.PublishAcked(topic, 1, 1, payload, timeout); err != nil || reason >= 0x80 {
+		return fmt.Errorf("publish failed: %v, reason code 0x%02x", err, reason)
+	}
+	got, err := collectPublishes(conn, cfg.Scaled(time.Second))
+	if err != nil {
+		return err
+	}
+	if countPayload(got, payload) == 0 {
+		return fmt.Errorf("subscription of the session lost after the second CONNECT")
+	}
+	conn.Send(0xE0, nil)
+	return nil
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// FaultProxy is a TCP proxy in front of the broker that can black-hole
+// traffic, as a network partition would. While traffic is black-holed
+// nothing is delivered in either direction and neither end sees the
+// connection close; once restored the held bytes flow again, as TCP
+// retransmission would deliver them after a partition heals.
+type FaultProxy struct {
+	ln  net.Listener
+	cfg Config
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	blocked bool
+	closed  bool
+	conns   []net.Conn
+}
+
+// StartFaultProxy starts a FaultProxy for cfg.Broker on a local port.
+// Connect to it with the Config it returns from Config.
+func StartFaultProxy(cfg Config) (*FaultProxy, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("fault proxy: %w", err)
+	}
+	p := &FaultProxy{ln: ln, cfg: cfg}
+	p.cond = sync.NewCond(&p.mu)
+	go p.accept()
+	return p, nil
+}
+
+// Config returns cfg with the proxy as the broker. The proxy dials the
+// broker itself, over TLS where cfg.Broker asks for it, so the connection
+// to the proxy is plain TCP.
+func (p *FaultProxy) Config() Config {
+	cfg := p.cfg
+	cfg.Broker = "tcp://" + p.ln.Addr().String()
+	return cfg
+}
+
+// Blackhole stops delivering traffic until Restore
+func (p *FaultProxy) Blackhole() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocked = true
+}
+
+// Restore delivers the traffic held since Blackhole and lets further
+// traffic through
+func (p *FaultProxy) Restore() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocked = false
+	p.cond.Broadcast()
+}
+
+// Close stops the proxy and closes every connection through it
+func (p *FaultProxy) Close() {
+	p.ln.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, c := range p.conns {
+		c.Close()
+	}
+	p.conns = nil
+	p.cond.Broadcast()
+}
+
+func (p *FaultProxy) accept() {
+	for {
+		client, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.serve(client)
+	}
+}
+
+// serve connects client to the broker and copies between them
+func (p *FaultProxy) serve(client net.Conn) {
+	broker, err := dialBroker(p.cfg.Broker, p.cfg.TLS, p.cfg.DialTimeout)
+	if err != nil {
+		client.Close()
+		return
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		client.Close()
+		broker.Close()
+		return
+	}
+	p.conns = append(p.conns, client, broker)
+	p.mu.Unlock()
+
+	go p.pump(broker, client)
+	p.pump(client, broker)
+}
+
+// pump copies from src to dst, holding what it read while traffic is
+// black-holed. An end closing is passed on to the other once traffic flows,
+// so a broker dropping a connection during a partition is only seen after
+// it.
+func (p *FaultProxy) pump(dst, src net.Conn) {
+	defer dst.Close()
+	defer src.Close()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if !p.wait() {
+			return
+		}
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait blocks while traffic is black-holed and reports whether the proxy
+// is still open
+func (p *FaultProxy) wait() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.blocked && !p.closed {
+		p.cond.Wait()
+	}
+	return !p.closed
+}
@@ -0,0 +1,159 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Flakiness summarizes repeated runs of the same tests
+type Flakiness struct {
+	Broker string          `json:"broker"`
+	Spec   string          `json:"spec"`
+	Runs   int             `json:"runs"`
+	Tests  []TestFlakiness `json:"tests"`
+}
+
+// TestFlakiness is the outcome of one test over repeated runs
+type TestFlakiness struct {
+	Group    string   `json:"group"`
+	Name     string   `json:"name"`
+	SpecRef  string   `json:"spec_ref,omitempty"`
+	Statuses []Status `json:"statuses"` // One per run the test took part in, in run order
+	Passed   int      `json:"passed"`
+	Failed   int      `json:"failed"`
+	PassRate float64  `json:"pass_rate"` // Passed / (passed + failed); 1 when it never ran to a verdict
+	Flaky    bool     `json:"flaky"`     // The outcome varied between runs, or a run only passed on retry
+
+	MinDuration time.Duration `json:"min_duration"`
+	MaxDuration time.Duration `json:"max_duration"`
+}
+
+// BuildFlakiness matches the results of repeated runs by group and test name.
+// Flaky tests come first, least reliable first.
+func BuildFlakiness(reports []*Report) *Flakiness {
+	f := &Flakiness{Runs: len(reports)}
+	if len(reports) > 0 {
+		f.Broker = reports[0].Broker
+		f.Spec = reports[0].Spec
+	}
+
+	index := make(map[string]int)
+	for _, r := range reports {
+		for _, result := range r.Results {
+			key := result.Group + "\x00" + result.Name
+			i, ok := index[key]
+			if !ok {
+				i = len(f.Tests)
+				index[key] = i
+				f.Tests = append(f.Tests, TestFlakiness{
+					Group:       result.Group,
+					Name:        result.Name,
+					SpecRef:     result.SpecRef,
+					MinDuration: result.Duration,
+				})
+			}
+			t := &f.Tests[i]
+			t.Statuses = append(t.Statuses, result.Status)
+			switch result.Status {
+			case StatusPassed, StatusWarning:
+				t.Passed++
+			case StatusFailed:
+				t.Failed++
+			}
+			if result.PassedOnRetry() {
+				t.Flaky = true
+			}
+			t.MinDuration = min(t.MinDuration, result.Duration)
+			t.MaxDuration = max(t.MaxDuration, result.Duration)
+		}
+	}
+
+	for i := range f.Tests {
+		t := &f.Tests[i]
+		t.PassRate = 1
+		if n := t.Passed + t.Failed; n > 0 {
+			t.PassRate = float64(t.Passed) / float64(n)
+		}
+		for _, s := range t.Statuses {
+			if s != t.Statuses[0] {
+				t.Flaky = true
+			}
+		}
+	}
+
+	sort.SliceStable(f.Tests, func(i, j int) bool {
+		if f.Tests[i].Flaky != f.Tests[j].Flaky {
+			return f.Tests[i].Flaky
+		}
+		return f.Tests[i].PassRate < f.Tests[j].PassRate
+	})
+	return f
+}
+
+// FlakyTests returns the tests whose outcome varied
+func (f *Flakiness) FlakyTests() []TestFlakiness {
+	var flaky []TestFlakiness
+	for _, t := range f.Tests {
+		if t.Flaky {
+			flaky = append(flaky, t)
+		}
+	}
+	return flaky
+}
+
+// WriteFlakiness saves a flakiness report as JSON
+func WriteFlakiness(path string, f *Flakiness) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// PrintFlakiness prints the pass rate of every test that did not pass in
+// every run, flaky tests first
+func PrintFlakiness(f *Flakiness) {
+	fmt.Printf("\n%s\n", TitleStyle.Render(fmt.Sprintf("Flakiness over %d runs", f.Runs)))
+
+	shown := 0
+	for _, t := range f.Tests {
+		if !t.Flaky && t.Failed == 0 {
+			continue
+		}
+		shown++
+		label := FailStyle.Render("always fails")
+		if t.Flaky {
+			label = WarnStyle.Render("FLAKY")
+		}
+		fmt.Printf("  %s %5.1f%% %s  %s / %s (%v-%v)\n", statusMarks(t.Statuses), 100*t.PassRate, label, t.Group, t.Name,
+			t.MinDuration.Round(time.Millisecond), t.MaxDuration.Round(time.Millisecond))
+	}
+	if shown == 0 {
+		fmt.Printf("  %s\n", PassStyle.Render(fmt.Sprintf("All %d tests had the same outcome in every run", len(f.Tests))))
+		return
+	}
+	fmt.Printf("\n  %d flaky, %d of %d tests not passing every run\n", len(f.FlakyTests()), shown, len(f.Tests))
+}
+
+// statusMarks renders one character per run
+func statusMarks(statuses []Status) string {
+	s := ""
+	for _, st := range statuses {
+		switch st {
+		case StatusPassed:
+			s += PassStyle.Render("✓")
+		case StatusFailed:
+			s += FailStyle.Render("✗")
+		case StatusWarning:
+			s += WarnStyle.Render("!")
+		case StatusInconclusive:
+			s += InconclusiveStyle.Render("?")
+		default:
+			s += SkipStyle.Render("·")
+		}
+	}
+	return s
+}
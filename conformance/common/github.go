@@ -0,0 +1,54 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteGitHubAnnotations writes a GitHub Actions workflow command for every
+// failed test and every warning, so they show up on the run and, where the
+// test's source is known, inline on the pull request
+func WriteGitHubAnnotations(w io.Writer, r *Report) {
+	for _, result := range r.Results {
+		var command string
+		switch result.Status {
+		case StatusFailed:
+			command = "error"
+		case StatusWarning:
+			command = "warning"
+		default:
+			continue
+		}
+
+		title := result.Group + " / " + result.Name
+		if result.SpecRef != "" {
+			title += fmt.Sprintf(" [%s %s]", result.SpecRef, result.Level)
+		}
+		props := []string{"title=" + escapeProperty(title)}
+		if i := strings.LastIndex(result.Source, ":"); i > 0 {
+			file, line := result.Source[:i], result.Source[i+1:]
+			props = append([]string{"file=" + escapeProperty(file), "line=" + line}, props...)
+		}
+
+		msg := result.Notes
+		if result.Error != nil {
+			msg = result.Error.Error()
+			if result.Notes != "" {
+				msg += "\n" + result.Notes
+			}
+		}
+		if summary := result.AttemptSummary(); summary != "" {
+			msg += "\n" + summary
+		}
+		fmt.Fprintf(w, "::%s %s::%s\n", command, strings.Join(props, ","), escapeData(msg))
+	}
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,279 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// goldenExt is the extension of golden transcript files
+const goldenExt = ".txt"
+
+// maskedProperties are properties whose values change from run to run on
+// the same broker, so transcripts record only that they were present
+var maskedProperties = map[string]bool{
+	"Assigned Client Identifier": true,
+	"Message Expiry Interval":    true, // Counts down while a message waits
+	"Reason String":              true,
+}
+
+var (
+	// uniqueSuffix matches what GenerateClientID, 16 hex digits, and the
+	// MQTT 3.1 tests append to a client ID prefix
+	uniqueSuffix = regexp.MustCompile(`-([0-9a-f]{16}\b|\d{9,}(-\d+)?)`)
+	// uniqueLevel matches the level GenerateTopicName appends
+	uniqueLevel = regexp.MustCompile(`/\d{9,}`)
+	// retryLevel matches the namespace of a retried attempt
+	retryLevel = regexp.MustCompile(`<ns>/retry\d+`)
+)
+
+// Transcript renders the packets of a test in a canonical form that is the
+// same on every run against a broker that behaves the same: the run's topic
+// namespace and the unique parts of client IDs and topics are replaced,
+// Packet Identifiers are numbered from 1 on each connection in the order
+// they appear, and sizes, timings and volatile property values are left
+// out. Packets are listed by connection, then direction, then packet type,
+// each kind in the order it was seen, so acknowledgements and deliveries that
+// interleave differently from run to run give the same transcript while the
+// order of e.g. the PUBLISHes the broker delivered is kept.
+func Transcript(result TestResult, namespace string) []string {
+	normalize := func(s string) string {
+		if namespace != "" {
+			s = retryLevel.ReplaceAllString(strings.ReplaceAll(s, namespace, "<ns>"), "<ns>")
+		}
+		s = uniqueSuffix.ReplaceAllString(s, "-*")
+		return uniqueLevel.ReplaceAllString(s, "/*")
+	}
+
+	lines := []string{fmt.Sprintf("# %s / %s", result.Group, result.Name), "status: " + result.Status.String()}
+	packets := append([]Packet(nil), result.Packets...)
+	kind := func(p Packet) byte {
+		if len(p.Raw) == 0 {
+			return 0xFF
+		}
+		return p.Raw[0] >> 4
+	}
+	sort.SliceStable(packets, func(i, j int) bool {
+		a, b := packets[i], packets[j]
+		if a.Conn != b.Conn {
+			return a.Conn < b.Conn
+		}
+		if a.Direction != b.Direction {
+			return a.Direction < b.Direction
+		}
+		return kind(a) < kind(b)
+	})
+
+	ids := map[int]map[uint16]int{} // Per connection, Packet Identifier to its number
+	for _, p := range packets {
+		s := fmt.Sprintf("#%d %s %-11s flags=0x%x", p.Conn, p.Direction, p.Type, p.Flags)
+		if p.HasID {
+			if ids[p.Conn] == nil {
+				ids[p.Conn] = map[uint16]int{}
+			}
+			n, ok := ids[p.Conn][p.PacketID]
+			if !ok {
+				n = len(ids[p.Conn]) + 1
+				ids[p.Conn][p.PacketID] = n
+			}
+			s += fmt.Sprintf(" id=%d", n)
+		}
+		if p.ClientID != "" {
+			s += fmt.Sprintf(" client_id=%q", normalize(p.ClientID))
+		}
+		if p.Topic != "" {
+			s += fmt.Sprintf(" topic=%q", normalize(p.Topic))
+		}
+		if p.HasReason {
+			s += fmt.Sprintf(" reason=0x%02x", p.Reason)
+		}
+		if len(p.Properties) > 0 {
+			props := make([]string, len(p.Properties))
+			for i, prop := range p.Properties {
+				value := normalize(prop.Value)
+				if maskedProperties[prop.Name] {
+					value = "*"
+				}
+				props[i] = prop.Name + "=" + value
+			}
+			s += " [" + strings.Join(props, ", ") + "]"
+		}
+		lines = append(lines, s)
+	}
+	return lines
+}
+
+// goldenPath is where the golden transcript of a test is kept under dir
+func goldenPath(dir string, result TestResult) string {
+	return filepath.Join(dir, slug(result.Group), slug(result.Name)+goldenExt)
+}
+
+// WriteGolden writes the transcript of every test in r under dir, one file
+// per test in a directory per group, replacing those already there
+func WriteGolden(dir string, r *Report) error {
+	for _, result := range r.Results {
+		path := goldenPath(dir, result)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		data := strings.Join(Transcript(result, r.Namespace), "\n") + "\n"
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GoldenChange is a test whose transcript differs from its golden one.
+// Diff is empty for a test with no golden transcript yet.
+type GoldenChange struct {
+	Group string
+	Name  string
+	Diff  []string // Lines prefixed with "-" for the golden transcript, "+" for this run and " " for both
+}
+
+// New reports whether the test had no golden transcript
+func (c GoldenChange) New() bool {
+	return len(c.Diff) == 0
+}
+
+// CompareGolden compares the transcript of every test in r with its golden
+// transcript under dir. Tests with golden transcripts that did not run are
+// not reported.
+func CompareGolden(dir string, r *Report) ([]GoldenChange, error) {
+	var changes []GoldenChange
+	for _, result := range r.Results {
+		data, err := os.ReadFile(goldenPath(dir, result))
+		if errors.Is(err, fs.ErrNotExist) {
+			changes = append(changes, GoldenChange{Group: result.Group, Name: result.Name})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		golden := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		current := Transcript(result, r.Namespace)
+		if diff := diffLines(golden, current); diff != nil {
+			changes = append(changes, GoldenChange{Group: result.Group, Name: result.Name, Diff: diff})
+		}
+	}
+	return changes, nil
+}
+
+// maxDiffCells bounds the table diffLines builds; longer transcripts are
+// shown whole on both sides
+const maxDiffCells = 4_000_000
+
+// diffLines returns a line diff of a and b, nil when they are equal. Lines
+// both share, away from any change, are left out.
+func diffLines(a, b []string) []string {
+	if strings.Join(a, "\n") == strings.Join(b, "\n") {
+		return nil
+	}
+	if len(a)*len(b) > maxDiffCells {
+		var diff []string
+		for _, l := range a {
+			diff = append(diff, "-"+l)
+		}
+		for _, l := range b {
+			diff = append(diff, "+"+l)
+		}
+		return diff
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var all []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			all = append(all, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			all = append(all, "-"+a[i])
+			i++
+		default:
+			all = append(all, "+"+b[j])
+			j++
+		}
+	}
+
+	// Keep two lines of context around each change
+	const context = 2
+	var diff []string
+	for k, l := range all {
+		near := false
+		for d := max(0, k-context); d <= min(len(all)-1, k+context); d++ {
+			if all[d][0] != ' ' {
+				near = true
+				break
+			}
+		}
+		if near {
+			diff = append(diff, l)
+		}
+	}
+	return diff
+}
+
+// PrintGoldenChanges prints the tests whose transcripts changed, with their
+// diffs, and those without a golden transcript
+func PrintGoldenChanges(dir string, changes []GoldenChange) {
+	var changed, added []GoldenChange
+	for _, c := range changes {
+		if c.New() {
+			added = append(added, c)
+		} else {
+			changed = append(changed, c)
+		}
+	}
+
+	fmt.Printf("\n%s\n", TitleStyle.Render("Golden Transcripts"))
+	fmt.Printf("%s\n", SubtitleStyle.Render("Compared with "+dir))
+	if len(changed) > 0 {
+		fmt.Printf("\n%s\n", GroupStyle.Render(fmt.Sprintf("Changed (%d)", len(changed))))
+		for _, c := range changed {
+			fmt.Printf("  %s / %s\n", c.Group, c.Name)
+			for _, l := range c.Diff {
+				switch l[0] {
+				case '-':
+					fmt.Printf("    %s\n", FailStyle.Render(l))
+				case '+':
+					fmt.Printf("    %s\n", PassStyle.Render(l))
+				default:
+					fmt.Printf("    %s\n", l)
+				}
+			}
+		}
+	}
+	if len(added) > 0 {
+		fmt.Printf("\n%s\n", GroupStyle.Render(fmt.Sprintf("No golden transcript (%d)", len(added))))
+		for _, c := range added {
+			fmt.Printf("  %s / %s\n", c.Group, c.Name)
+		}
+	}
+	if len(changed) == 0 {
+		fmt.Printf("\n  %s\n", PassStyle.Render("No behavior changes"))
+	}
+}
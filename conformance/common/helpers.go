@@ -2,6 +2,7 @@ package common
 
 import (
 	"crypto/rand"
+	"crypto/tls"
 	"fmt"
 	"math/big"
 	"net"
@@ -9,10 +10,13 @@ import (
 	"time"
 )
 
-// GenerateClientID generates a unique client ID for testing
+// GenerateClientID generates a unique client ID for testing: prefix and 64
+// random bits from crypto/rand, so IDs generated concurrently, by parallel
+// workers or other runs cannot collide
 func GenerateClientID(prefix string) string {
-	n, _ := rand.Int(rand.Reader, big.NewInt(10000))
-	return fmt.Sprintf("%s-%d-%d", prefix, time.Now().UnixNano(), n.Int64())
+	var suffix [8]byte
+	rand.Read(suffix[:])
+	return fmt.Sprintf("%s-%x", prefix, suffix)
 }
 
 // GenerateTopicName generates a unique topic name for testing
@@ -20,6 +24,13 @@ func GenerateTopicName(prefix string) string {
 	return fmt.Sprintf("%s/%d", prefix, time.Now().UnixNano())
 }
 
+// NewTopicNamespace returns a topic namespace unique to one run, e.g.
+// testmqtt/20250102T150405-1234
+func NewTopicNamespace() string {
+	n, _ := rand.Int(rand.Reader, big.NewInt(10000))
+	return fmt.Sprintf("testmqtt/%s-%04d", time.Now().UTC().Format("20060102T150405"), n.Int64())
+}
+
 // WaitTimeout is a helper that waits for a condition with timeout
 func WaitTimeout(condition func() bool, timeout time.Duration) bool {
 	deadline := time.Now().Add(timeout)
@@ -39,19 +50,47 @@ func RandomPayload(size int) []byte {
 	return payload
 }
 
-// DialBroker parses broker URL and establishes TCP connection
+// DialBroker parses broker URL and establishes TCP connection. ssl://,
+// tls:// and mqtts:// URLs get a TLS connection with default settings.
 func DialBroker(broker string) (net.Conn, error) {
+	return dialBroker(broker, nil, 0)
+}
+
+// Dial connects to cfg.Broker, over TLS with cfg.TLS for TLS URLs, recording
+// the connection's packets in cfg.Trace when the test is being traced and
+// the connection itself in cfg.Conns
+func Dial(cfg Config) (net.Conn, error) {
+	conn, err := dialBroker(cfg.Broker, cfg.TLS, cfg.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Conns.add(conn)
+	return cfg.Trace.Wrap(conn), nil
+}
+
+func dialBroker(broker string, tlsConfig *tls.Config, timeout time.Duration) (net.Conn, error) {
 	u, err := url.Parse(broker)
 	if err != nil {
 		return nil, fmt.Errorf("invalid broker URL: %w", err)
 	}
-
-	host := u.Host
-	if u.Port() == "" {
-		host = net.JoinHostPort(u.Hostname(), "1883")
+	if timeout <= 0 {
+		timeout = 5 * time.Second
 	}
 
-	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if IsTLSScheme(u.Scheme) {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = u.Hostname()
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", brokerAddress(u), tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", brokerAddress(u))
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial broker: %w", err)
 	}
@@ -61,9 +100,13 @@ func DialBroker(broker string) (net.Conn, error) {
 
 // CheckBrokerReachable verifies the broker is reachable at the TCP level
 func CheckBrokerReachable(broker string) error {
-	conn, err := DialBroker(broker)
+	u, err := url.Parse(broker)
+	if err != nil {
+		return fmt.Errorf("invalid broker URL: %w", err)
+	}
+	conn, err := net.DialTimeout("tcp", brokerAddress(u), 5*time.Second)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to dial broker: %w", err)
 	}
 	conn.Close()
 	return nil
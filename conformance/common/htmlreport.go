@@ -0,0 +1,178 @@
+package common
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// specURLs are the published OASIS specifications the spec references point into
+var specURLs = map[string]string{
+	spec.V311: "https://docs.oasis-open.org/mqtt/mqtt/v3.1.1/os/mqtt-v3.1.1-os.html",
+	spec.V5:   "https://docs.oasis-open.org/mqtt/mqtt/v5.0/os/mqtt-v5.0-os.html",
+}
+
+// SpecLink returns a link to a spec reference in the published specification.
+// Statements have no anchors of their own, so the link uses a text fragment.
+func SpecLink(version, ref string) string {
+	base, ok := specURLs[version]
+	if !ok || ref == "" {
+		return ""
+	}
+	return base + "#:~:text=" + url.PathEscape(ref)
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"lower": strings.ToLower,
+	"inc":   func(i int) int { return i + 1 },
+	"ms":    func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+	"offset": func(start, t time.Time) string {
+		return fmt.Sprintf("+%.3fs", t.Sub(start).Seconds())
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Report.Title}} - {{.Report.Broker}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; max-width: 1100px; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+details { border: 1px solid #ddd; border-left-width: 6px; margin: 4px 0; padding: 4px 8px; }
+details.pass { border-left-color: #3a3; }
+details.fail { border-left-color: #c33; }
+details.skip { border-left-color: #aaa; }
+details.warn { border-left-color: #db0; }
+details.inconclusive { border-left-color: #a5c; }
+summary { cursor: pointer; }
+.status { font-weight: bold; display: inline-block; width: 9em; }
+.meta { color: #666; font-size: smaller; }
+.error { color: #c33; white-space: pre-wrap; }
+.statement { background: #f7f7f7; padding: 6px; font-style: italic; }
+table.trace td { font-family: monospace; font-size: smaller; border: none; padding: 1px 8px; }
+td.sent { color: #035; }
+td.received { color: #530; }
+</style>
+</head>
+<body>
+<h1>{{.Report.Title}}</h1>
+<p>Broker <code>{{.Report.Broker}}</code>, started {{.Report.Started.Format "2006-01-02 15:04:05 MST"}}, took {{ms .Report.Duration}}</p>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Total</th><th>Passed</th><th>Failed</th><th>Warnings</th><th>Inconclusive</th><th>Skipped</th><th>Weighted score</th><th>MUST failures</th></tr>
+<tr><td>{{len .Report.Results}}</td><td>{{.Passed}}</td><td>{{.Failed}}</td><td>{{.Warnings}}</td><td>{{.Inconclusive}}</td><td>{{.Skipped}}</td><td>{{printf "%.1f%%" .Score}}</td><td>{{.MustFailures}}</td></tr>
+</table>
+
+<h2>Groups</h2>
+<table>
+<tr><th>Group</th><th>Tests</th><th>Passed</th><th>Failed</th><th>Other</th></tr>
+{{range .Groups}}<tr><td><a href="#{{.Anchor}}">{{.Name}}</a></td><td>{{.Total}}</td><td>{{.Passed}}</td><td>{{.Failed}}</td><td>{{.Other}}</td></tr>
+{{end}}</table>
+
+<h2>Slowest tests</h2>
+<table>
+<tr><th>Test</th><th>Group</th><th>Duration</th><th>Connect</th><th>Subscribe</th><th>Delivery</th><th>Teardown</th></tr>
+{{range .Slowest}}<tr><td>{{.Name}}</td><td>{{.Group}}</td><td>{{ms .Duration}}</td><td>{{ms .Timings.Connect}}</td><td>{{ms .Timings.Subscribe}}</td><td>{{ms .Timings.Delivery}}</td><td>{{ms .Timings.Teardown}}</td></tr>
+{{end}}</table>
+
+{{range .Groups}}
+<h2 id="{{.Anchor}}">{{.Name}}</h2>
+{{range .Tests}}<details class="{{lower .Result.Status.String}}"{{if eq .Result.Status.String "FAIL"}} open{{end}}>
+<summary><span class="status">{{.Result.Status}}</span> {{.Result.Name}} <span class="meta">{{ms .Result.Duration}}{{with .Result.AttemptSummary}}, {{.}}{{end}}</span></summary>
+<p class="meta">{{if .Result.SpecRef}}{{if .Link}}<a href="{{.Link}}">{{.Result.SpecRef}}</a>{{else}}{{.Result.SpecRef}}{{end}} ({{.Result.Level}}){{else}}No spec reference{{end}}</p>
+{{if .Statement}}<p class="statement">{{.Statement}}</p>{{end}}
+{{if .Result.Error}}<p class="error">{{.Result.Error}}</p>{{end}}
+{{if or .Result.Expected .Result.Actual}}<table>
+<tr><th>Expected</th><td>{{.Result.Expected}}</td></tr>
+<tr><th>Actual</th><td>{{.Result.Actual}}</td></tr>
+</table>{{end}}
+{{if .Result.Notes}}<p>{{.Result.Notes}}</p>{{end}}
+{{if .Result.Attempts}}<p><b>Attempts</b></p>
+<table>
+{{range $i, $a := .Result.Attempts}}<tr><td>{{inc $i}}</td><td>{{$a.Status}}</td><td>{{ms $a.Duration}}</td><td>{{$a.Error}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Trace}}<p><b>Packet trace</b></p>
+<table class="trace">
+{{$start := .TraceStart}}{{range .Trace}}<tr><td>{{offset $start .Time}}</td><td class="{{if eq .Direction 0}}sent{{else}}received{{end}}">{{.Summary}}</td></tr>
+{{end}}</table>{{end}}
+</details>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// WriteHTMLReport writes a standalone HTML report of a run. Failed tests are
+// expanded and show their packet trace when the run captured packets.
+func WriteHTMLReport(w io.Writer, r *Report) error {
+	type test struct {
+		Result     TestResult
+		Link       string
+		Statement  string
+		Trace      []Packet
+		TraceStart time.Time
+	}
+	type group struct {
+		Name, Anchor                 string
+		Total, Passed, Failed, Other int
+		Tests                        []test
+	}
+
+	counts := r.Counts()
+	score := r.Score()
+	data := struct {
+		Report                                          *Report
+		Passed, Failed, Warnings, Inconclusive, Skipped int
+		Score                                           float64
+		MustFailures                                    int
+		Groups                                          []*group
+		Slowest                                         []TestResult
+	}{
+		Report:       r,
+		Passed:       counts[StatusPassed],
+		Failed:       counts[StatusFailed],
+		Warnings:     counts[StatusWarning],
+		Inconclusive: counts[StatusInconclusive],
+		Skipped:      counts[StatusSkipped],
+		Score:        score.Percent(),
+		MustFailures: score.Failed[spec.LevelMust],
+		Slowest:      r.Slowest(SlowestShown),
+	}
+
+	byName := make(map[string]*group)
+	for _, result := range r.Results {
+		g, ok := byName[result.Group]
+		if !ok {
+			g = &group{Name: result.Group, Anchor: fmt.Sprintf("group-%d", len(data.Groups)+1)}
+			byName[result.Group] = g
+			data.Groups = append(data.Groups, g)
+		}
+		g.Total++
+		switch result.Status {
+		case StatusPassed:
+			g.Passed++
+		case StatusFailed:
+			g.Failed++
+		default:
+			g.Other++
+		}
+
+		t := test{Result: result, Link: SpecLink(r.Spec, result.SpecRef)}
+		if st, ok := spec.Lookup(r.Spec, result.SpecRef); ok {
+			t.Statement = st.Text
+		}
+		if result.Status == StatusFailed && len(result.Packets) > 0 {
+			t.Trace = result.Packets
+			t.TraceStart = result.Packets[0].Time
+		}
+		g.Tests = append(g.Tests, t)
+	}
+
+	return reportTemplate.Execute(w, data)
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ConnTracker records the connections a test opens through Dial, so those
+// it never closed can be reported and closed once it returns. A nil tracker
+// records nothing.
+type ConnTracker struct {
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// NewConnTracker returns an empty tracker
+func NewConnTracker() *ConnTracker {
+	return &ConnTracker{}
+}
+
+// add records conn as the connection dialed, before any wrapping, so its
+// socket can be checked without the caller's help
+func (t *ConnTracker) add(conn net.Conn) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.conns = append(t.conns, conn)
+	t.mu.Unlock()
+}
+
+// Open returns the tracked connections that are not closed yet
+func (t *ConnTracker) Open() []net.Conn {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var open []net.Conn
+	for _, conn := range t.conns {
+		if !isClosed(conn) {
+			open = append(open, conn)
+		}
+	}
+	return open
+}
+
+// isClosed reports whether conn was closed on our side. A connection the
+// broker hung up on still holds its socket until it is closed here.
+func isClosed(conn net.Conn) bool {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return true
+	}
+	return raw.Control(func(uintptr) {}) != nil
+}
+
+// Leak is what a test left behind once it returned
+type Leak struct {
+	Conns      []string `json:"conns,omitempty"`      // Connections never closed, as local->remote
+	Goroutines int      `json:"goroutines,omitempty"` // Goroutines more than when the test started
+}
+
+// String describes the leak, e.g. "1 connection (127.0.0.1:50312->127.0.0.1:1883), 3 goroutines"
+func (l *Leak) String() string {
+	var parts []string
+	switch n := len(l.Conns); n {
+	case 0:
+	case 1:
+		parts = append(parts, fmt.Sprintf("1 connection (%s)", l.Conns[0]))
+	default:
+		parts = append(parts, fmt.Sprintf("%d connections (%s)", n, strings.Join(l.Conns, ", ")))
+	}
+	switch l.Goroutines {
+	case 0:
+	case 1:
+		parts = append(parts, "1 goroutine")
+	default:
+		parts = append(parts, fmt.Sprintf("%d goroutines", l.Goroutines))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkLeaks waits up to grace for the connections a test opened to close
+// and the goroutines it started to end, giving clients time to finish
+// disconnecting. Connections still open then are closed so they cannot
+// affect later tests, e.g. a lingering # subscriber taking their messages.
+// It returns nil when nothing leaked.
+func checkLeaks(tracker *ConnTracker, goroutines int, grace time.Duration) *Leak {
+	deadline := time.Now().Add(grace)
+	for {
+		open := tracker.Open()
+		extra := runtime.NumGoroutine() - goroutines
+		if len(open) == 0 && extra <= 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			leak := &Leak{Goroutines: max(extra, 0)}
+			for _, conn := range open {
+				leak.Conns = append(leak.Conns, conn.LocalAddr().String()+"->"+conn.RemoteAddr().String())
+				conn.Close()
+			}
+			return leak
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
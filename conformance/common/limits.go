@@ -0,0 +1,486 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Limits sets how far the limit discovery tests push the broker looking for
+// its limits. Reaching the ceiling without finding one leaves the test
+// inconclusive.
+type Limits struct {
+	// Connections is how many connections the connection ramp opens at
+	// most. So many connections may trip the broker's rate limits for the
+	// tests that follow, so the ramp is skipped unless one is given.
+	Connections int `yaml:"connections"`
+
+	// Payload is the largest payload, in bytes, the message size search
+	// tries. The search holds payloads of up to this size in memory, so it is
+	// skipped unless one is given.
+	Payload int `yaml:"payload"`
+
+	// Inflight is how many QoS 1 messages the inflight window probe
+	// publishes to a subscriber that withholds its PUBACKs
+	Inflight int `yaml:"inflight"`
+}
+
+// DefaultLimitInflight is how many messages the inflight window probe
+// publishes unless Limits.Inflight says otherwise
+const DefaultLimitInflight = 2000
+
+// MaxInflight returns how many messages the inflight window probe publishes
+func (l Limits) MaxInflight() int {
+	if l.Inflight > 0 {
+		return min(l.Inflight, 65535)
+	}
+	return DefaultLimitInflight
+}
+
+// Ways a broker refuses a connection
+const (
+	RejectTCPRefused = "TCP refused"
+	RejectTimeout    = "timeout"
+	RejectClosed     = "connection closed"
+)
+
+// connectIdle connects clientID with a clean session and no keep alive, so
+// the connection may sit idle for as long as a test needs it. It returns
+// how the broker refused the connection, e.g. "CONNACK 0x97", or an error
+// for anything else that went wrong.
+func connectIdle(cfg Config, level byte, clientID string) (*RawConn, string, error) {
+	conn, err := Dial(cfg)
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case errors.Is(err, syscall.ECONNREFUSED):
+			return nil, RejectTCPRefused, nil
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return nil, RejectTimeout, nil
+		case errors.Is(err, syscall.ECONNRESET):
+			return nil, RejectClosed, nil
+		}
+		return nil, "", err
+	}
+	flags := byte(0x02)
+	if cfg.Username != "" {
+		flags |= 0x80
+	}
+	if cfg.Password != "" {
+		flags |= 0x40
+	}
+	body := AppendString(nil, "MQTT")
+	body = append(body, level, flags, 0, 0)
+	if level >= 5 {
+		body = append(body, 0)
+	}
+	body = AppendString(body, clientID)
+	if cfg.Username != "" {
+		body = AppendString(body, cfg.Username)
+	}
+	if cfg.Password != "" {
+		body = AppendString(body, cfg.Password)
+	}
+	conn.SetDeadline(time.Now().Add(cfg.Scaled(5 * time.Second)))
+	if _, err := conn.Write(RawPacket(0x10, body)); err != nil {
+		conn.Close()
+		return nil, RejectClosed, nil
+	}
+	header, ack, err := ReadRawPacket(conn)
+	if err != nil {
+		conn.Close()
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return nil, RejectTimeout, nil
+		case errors.Is(err, io.EOF), errors.Is(err, syscall.ECONNRESET):
+			return nil, RejectClosed, nil
+		}
+		return nil, "", err
+	}
+	if header != 0x20 || len(ack) < 2 {
+		conn.Close()
+		return nil, "", fmt.Errorf("expected CONNACK, got packet 0x%02x", header)
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		return nil, fmt.Sprintf("CONNACK 0x%02x", ack[1]), nil
+	}
+	conn.SetDeadline(time.Time{})
+	return &RawConn{Conn: conn, Level: level, ReceiveMaximum: 65535}, "", nil
+}
+
+// SkipWithoutConnectionLimit marks result skipped and returns true when no
+// ceiling is configured for the connection ramp
+func SkipWithoutConnectionLimit(cfg Config, result *TestResult) bool {
+	if cfg.Limits.Connections > 0 {
+		return false
+	}
+	result.Status = StatusSkipped
+	result.Notes = "no connection ceiling configured (--limit-connections)"
+	return true
+}
+
+// ConnectionLimit is what the connection ramp found
+type ConnectionLimit struct {
+	Opened    int    // Connections open when the ramp stopped
+	Limited   bool   // The broker refused a connection below the ceiling
+	Rejection string // How it refused, e.g. "CONNACK 0x97" or RejectTCPRefused
+	Healthy   int    // Open connections that answered a PINGREQ afterwards
+}
+
+// connectionRampBatch is how many connections the ramp opens at once
+const connectionRampBatch = 50
+
+// CheckConnectionLimit opens connections, a batch at a time, until the
+// broker refuses one or cfg.Limits.Connections are open. Every
+// connection still open must then answer a PINGREQ, and the oldest must
+// still carry a QoS 1 message round trip. The connections are closed
+// before it returns.
+func CheckConnectionLimit(cfg Config, level byte) (ConnectionLimit, error) {
+	var limit ConnectionLimit
+	ceiling := cfg.Limits.Connections
+	var conns []*RawConn
+	defer func() {
+		for _, c := range conns {
+			c.Send(0xE0, nil)
+			c.Close()
+		}
+	}()
+
+	for len(conns) < ceiling && !limit.Limited {
+		n := min(connectionRampBatch, ceiling-len(conns))
+		batch := make([]*RawConn, n)
+		rejections := make([]string, n)
+		errs := make([]error, n)
+		var wg sync.WaitGroup
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				batch[i], rejections[i], errs[i] = connectIdle(cfg, level, cfg.ClientID("test-limit-conn"))
+			}()
+		}
+		wg.Wait()
+		for i := range n {
+			switch {
+			case batch[i] != nil:
+				conns = append(conns, batch[i])
+			case errs[i] != nil && limit.Rejection == "":
+				return limit, fmt.Errorf("connection %d: %w", len(conns)+1, errs[i])
+			case rejections[i] != "" && limit.Rejection == "":
+				limit.Limited, limit.Rejection = true, rejections[i]
+			}
+		}
+	}
+	limit.Opened = len(conns)
+
+	// Reaching the limit must not cost the connections already open
+	for _, c := range conns {
+		c.Send(0xC0, nil)
+	}
+	deadline := time.Now().Add(cfg.Scaled(10 * time.Second))
+	for _, c := range conns {
+		if _, _, err := c.Expect(0xD0, time.Until(deadline), nil); err == nil {
+			limit.Healthy++
+		}
+	}
+	if len(conns) > 0 && limit.Healthy == len(conns) {
+		if err := conns[0].RoundTrip(cfg.Topic(GenerateTopicName("test/limits/connections")), cfg.Scaled(5*time.Second)); err != nil {
+			return limit, fmt.Errorf("oldest connection at the limit cannot carry messages: %w", err)
+		}
+	}
+	return limit, nil
+}
+
+// SkipWithoutPayloadLimit marks result skipped and returns true when no
+// ceiling is configured for the message size search
+func SkipWithoutPayloadLimit(cfg Config, result *TestResult) bool {
+	if cfg.Limits.Payload > 0 {
+		return false
+	}
+	result.Status = StatusSkipped
+	result.Notes = "no largest payload configured (--limit-payload)"
+	return true
+}
+
+// PayloadLimit is what the message size search found at one QoS
+type PayloadLimit struct {
+	QoS       byte
+	Largest   int    // Largest payload accepted and delivered
+	Limited   bool   // A payload below the ceiling was refused
+	Rejection string // How the smallest refused payload was refused
+	Probes    int    // PUBLISHes the search sent
+}
+
+// String describes the limit for notes
+func (l PayloadLimit) String() string {
+	if !l.Limited {
+		return fmt.Sprintf("QoS %d: no limit up to %d bytes", l.QoS, l.Largest)
+	}
+	return fmt.Sprintf("QoS %d: %d bytes, larger refused by %s", l.QoS, l.Largest, l.Rejection)
+}
+
+// Ways a broker refuses an oversized PUBLISH besides a reason code
+const (
+	RejectNotDelivered = "not delivered"
+	RejectAckedLost    = "acknowledged but not delivered"
+)
+
+// maxRemainingLength is the largest Remaining Length MQTT can encode
+const maxRemainingLength = 268435455
+
+// CheckPayloadLimit binary-searches the largest payload the broker accepts
+// and delivers at qos, between 1 byte and cfg.Limits.Payload, on fresh
+// connections for every probe as a refusal may close them. Refusals are
+// recorded as a DISCONNECT or acknowledgement reason code, e.g.
+// "DISCONNECT 0x95", RejectClosed for a connection closed without one,
+// RejectNotDelivered for a QoS 0 message that vanished, or
+// RejectAckedLost for a message acknowledged with success and then lost.
+func CheckPayloadLimit(cfg Config, level byte, qos byte) (PayloadLimit, error) {
+	limit := PayloadLimit{QoS: qos}
+	topic := cfg.Topic(GenerateTopicName("test/limits/payload"))
+	overhead := 2 + len(topic) + 2 + 1 // Topic, Packet Identifier and properties
+	ceiling := min(cfg.Limits.Payload, maxRemainingLength-overhead)
+	buf := make([]byte, ceiling)
+
+	probe := func(size int) (string, error) {
+		limit.Probes++
+		return probePayload(cfg, level, qos, topic, buf[:size])
+	}
+	rejection, err := probe(1)
+	if err != nil {
+		return limit, err
+	}
+	if rejection != "" {
+		return limit, fmt.Errorf("1 byte payload at QoS %d refused: %s", qos, rejection)
+	}
+	limit.Largest = 1
+	if rejection, err = probe(ceiling); err != nil {
+		return limit, err
+	}
+	if rejection == "" {
+		limit.Largest = ceiling
+		return limit, nil
+	}
+	limit.Limited, limit.Rejection = true, rejection
+
+	// The largest accepted payload is in [lo, hi)
+	lo, hi := 1, ceiling
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		rejection, err := probe(mid)
+		if err != nil {
+			return limit, err
+		}
+		if rejection == "" {
+			lo = mid
+		} else {
+			hi, limit.Rejection = mid, rejection
+		}
+	}
+	limit.Largest = lo
+	return limit, nil
+}
+
+// probePayload publishes payload at qos to topic, with a subscriber of its
+// own, and returns how the broker refused it, or "" when it was
+// acknowledged, where QoS calls for it, and delivered intact
+func probePayload(cfg Config, level, qos byte, topic string, payload []byte) (string, error) {
+	// Allow for moving the payload at 10MB/s each way
+	timeout := cfg.Scaled(5*time.Second) + time.Duration(len(payload)/(10<<20))*time.Second
+	sub, err := DialRaw(cfg, level, cfg.ClientID("test-limit-payload-sub"))
+	if err != nil {
+		return "", err
+	}
+	defer sub.Close()
+	if codes, err := sub.Subscribe(1, qos, timeout, topic); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		return "", fmt.Errorf("subscribe failed: %v % x", err, codes)
+	}
+	pub, err := DialRaw(cfg, level, cfg.ClientID("test-limit-payload-pub"))
+	if err != nil {
+		return "", err
+	}
+	defer pub.Close()
+
+	if err := pub.Publish(topic, qos, 1, payload); err != nil {
+		return RejectClosed, nil
+	}
+	// A QoS 0 PUBLISH has no acknowledgement, so a PINGREQ after it shows
+	// the broker got past it without closing the connection
+	ackType := byte(0xD0)
+	if qos == 0 {
+		pub.Send(0xC0, nil)
+	} else {
+		ackType = 0x40 | (qos-1)<<4
+	}
+	var disconnect []byte
+	_, ack, err := pub.Expect(ackType, timeout, func(header byte, body []byte) {
+		if header == 0xE0 {
+			disconnect = body
+		}
+	})
+	switch {
+	case len(disconnect) > 0:
+		return fmt.Sprintf("DISCONNECT 0x%02x", disconnect[0]), nil
+	case errors.Is(err, ErrBrokerClosed), errors.Is(err, syscall.ECONNRESET):
+		return RejectClosed, nil
+	case err != nil:
+		return "", err
+	case qos > 0 && len(ack) > 2 && ack[2] >= 0x80:
+		return fmt.Sprintf("%s 0x%02x", PacketName(ackType), ack[2]), nil
+	}
+	if qos == 2 {
+		pub.Send(0x62, ack[:2])
+		if _, _, err := pub.Expect(0x70, timeout, nil); err != nil {
+			return "", fmt.Errorf("no PUBCOMP: %w", err)
+		}
+	}
+
+	header, body, err := sub.Expect(0x30, timeout, nil)
+	if errors.Is(err, ErrMalformedLength) {
+		return "", fmt.Errorf("%d byte payload delivered in a packet with a malformed Remaining Length, beyond the largest MQTT allows", len(payload))
+	}
+	if err != nil {
+		if qos == 0 {
+			return RejectNotDelivered, nil
+		}
+		return RejectAckedLost, nil
+	}
+	m, err := sub.ParsePublish(header, body)
+	if err != nil {
+		return "", err
+	}
+	if len(m.Payload) != len(payload) {
+		return "", fmt.Errorf("%d byte payload delivered with %d bytes", len(payload), len(m.Payload))
+	}
+	if m.QoS == 1 {
+		sub.Send(0x40, binary.BigEndian.AppendUint16(nil, m.PacketID))
+	}
+	pub.Send(0xE0, nil)
+	sub.Send(0xE0, nil)
+	return "", nil
+}
+
+// InflightWindow is what the inflight window probe found
+type InflightWindow struct {
+	Sent      int    // QoS 1 messages published
+	Window    int    // Delivered before the first PUBACK from the subscriber
+	Delivered int    // Delivered in all once the subscriber acknowledged them
+	Resent    int    // Deliveries of a packet identifier still unacknowledged
+	Receive   uint16 // Receive Maximum in the subscriber's CONNACK, MQTT 5
+}
+
+// Limited reports whether the broker held messages back
+func (w InflightWindow) Limited() bool {
+	return w.Window < w.Sent
+}
+
+// CheckInflightWindow publishes cfg.Limits.MaxInflight QoS 1 messages to a
+// subscriber that does not acknowledge them and counts how many the broker
+// delivers before it stops to wait for PUBACKs. The subscriber then
+// acknowledges everything, and every message must arrive.
+func CheckInflightWindow(cfg Config, level byte) (InflightWindow, error) {
+	var w InflightWindow
+	topic := cfg.Topic(GenerateTopicName("test/limits/inflight"))
+	timeout := cfg.Scaled(5 * time.Second)
+	quiet := cfg.Scaled(2 * time.Second)
+
+	sub, err := DialRaw(cfg, level, cfg.ClientID("test-limit-inflight-sub"))
+	if err != nil {
+		return w, err
+	}
+	defer sub.Close()
+	if level >= 5 {
+		w.Receive = sub.ReceiveMaximum
+	}
+	if codes, err := sub.Subscribe(1, 1, timeout, topic); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		return w, fmt.Errorf("subscribe failed: %v % x", err, codes)
+	}
+	pub, err := DialRaw(cfg, level, cfg.ClientID("test-limit-inflight-pub"))
+	if err != nil {
+		return w, err
+	}
+	defer pub.Close()
+
+	// Publish them all, keeping within the broker's own Receive Maximum
+	count := cfg.Limits.MaxInflight()
+	outstanding := 0
+	for w.Sent < count || outstanding > 0 {
+		if w.Sent < count && outstanding < int(pub.ReceiveMaximum) {
+			payload := binary.BigEndian.AppendUint32(nil, uint32(w.Sent))
+			if err := pub.Publish(topic, 1, uint16(w.Sent%65535+1), payload); err != nil {
+				return w, fmt.Errorf("failed to send PUBLISH: %w", err)
+			}
+			w.Sent++
+			outstanding++
+			continue
+		}
+		if _, _, err := pub.Expect(0x40, timeout, nil); err != nil {
+			return w, fmt.Errorf("publisher: %w", err)
+		}
+		outstanding--
+	}
+
+	// Take what the broker sends without acknowledging it
+	var unacked []uint16
+	seen := map[uint32]bool{}
+	record := func(header byte, body []byte) (uint16, bool, error) {
+		m, err := sub.ParsePublish(header, body)
+		if err != nil || len(m.Payload) != 4 {
+			return 0, false, err
+		}
+		n := binary.BigEndian.Uint32(m.Payload)
+		if seen[n] {
+			w.Resent++
+			return m.PacketID, false, nil
+		}
+		seen[n] = true
+		return m.PacketID, true, nil
+	}
+	for {
+		header, body, err := sub.Expect(0x30, quiet, nil)
+		if err != nil {
+			if errors.Is(err, ErrBrokerClosed) {
+				return w, err
+			}
+			break
+		}
+		id, fresh, err := record(header, body)
+		if err != nil {
+			return w, err
+		}
+		if fresh {
+			w.Window++
+		}
+		unacked = append(unacked, id)
+	}
+
+	// Acknowledging them lets the rest through
+	for _, id := range unacked {
+		sub.Send(0x40, binary.BigEndian.AppendUint16(nil, id))
+	}
+	w.Delivered = w.Window
+	for w.Delivered < w.Sent {
+		header, body, err := sub.Expect(0x30, quiet, nil)
+		if err != nil {
+			return w, fmt.Errorf("%d of %d messages delivered once the subscriber acknowledged: %w", w.Delivered, w.Sent, err)
+		}
+		id, fresh, err := record(header, body)
+		if err != nil {
+			return w, err
+		}
+		if fresh {
+			w.Delivered++
+		}
+		sub.Send(0x40, binary.BigEndian.AppendUint16(nil, id))
+	}
+	pub.Send(0xE0, nil)
+	sub.Send(0xE0, nil)
+	return w, nil
+}
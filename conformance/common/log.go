@@ -0,0 +1,87 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// ParseLogLevel parses a --log-level value: debug, info, warn or error
+func ParseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToLower(s))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q (supported: debug, info, warn, error)", s)
+	}
+	return level, nil
+}
+
+// NewLogger returns a logger writing key=value lines to w. At debug level
+// every packet of every test is logged.
+func NewLogger(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// Log returns the logger tests should use, carrying the running test's
+// fields. It discards everything when no logger is configured.
+func (c Config) Log() *slog.Logger {
+	if c.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return c.Logger
+}
+
+// testLogHandler holds back the records a test logs until the test returns
+// and reports its name, then writes them with the name attached. Tests name
+// themselves in their result, so it is not known before.
+type testLogHandler struct {
+	base  slog.Handler
+	state *testLogState
+}
+
+type testLogState struct {
+	mu      sync.Mutex
+	pending []pendingRecord
+}
+
+type pendingRecord struct {
+	handler slog.Handler
+	record  slog.Record
+}
+
+// bufferTestLog returns a logger for one test and the function that writes
+// its records once the test name is known
+func bufferTestLog(log *slog.Logger) (*slog.Logger, func(name string)) {
+	h := &testLogHandler{base: log.Handler(), state: &testLogState{}}
+	flush := func(name string) {
+		h.state.mu.Lock()
+		pending := h.state.pending
+		h.state.pending = nil
+		h.state.mu.Unlock()
+		for _, p := range pending {
+			p.handler.WithAttrs([]slog.Attr{slog.String("test", name)}).Handle(context.Background(), p.record)
+		}
+	}
+	return slog.New(h), flush
+}
+
+func (h *testLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.base.Enabled(ctx, level)
+}
+
+func (h *testLogHandler) Handle(_ context.Context, r slog.Record) error {
+	h.state.mu.Lock()
+	h.state.pending = append(h.state.pending, pendingRecord{handler: h.base, record: r.Clone()})
+	h.state.mu.Unlock()
+	return nil
+}
+
+func (h *testLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &testLogHandler{base: h.base.WithAttrs(attrs), state: h.state}
+}
+
+func (h *testLogHandler) WithGroup(name string) slog.Handler {
+	return &testLogHandler{base: h.base.WithGroup(name), state: h.state}
+}
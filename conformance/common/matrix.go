@@ -0,0 +1,258 @@
+package common
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// MatrixColumn is one broker in a comparison matrix. Report is nil when the
+// suite could not run against the broker at all.
+type MatrixColumn struct {
+	Broker string
+	Report *Report
+	Err    error
+}
+
+// MatrixRow is one test across all brokers
+type MatrixRow struct {
+	Group   string
+	Name    string
+	SpecRef string
+	Cells   []*TestResult // One per column, nil if the test did not run
+}
+
+// Matrix compares the results of one suite across several brokers
+type Matrix struct {
+	Title   string
+	Columns []MatrixColumn
+	Rows    []MatrixRow
+}
+
+// BuildMatrix lines up the results of each column by test, keeping the order
+// in which tests first appear
+func BuildMatrix(title string, columns []MatrixColumn) *Matrix {
+	m := &Matrix{Title: title, Columns: columns}
+	index := make(map[string]int)
+	for i, col := range columns {
+		if col.Report == nil {
+			continue
+		}
+		for j := range col.Report.Results {
+			result := &col.Report.Results[j]
+			key := result.Group + "\x00" + result.Name
+			row, ok := index[key]
+			if !ok {
+				row = len(m.Rows)
+				index[key] = row
+				m.Rows = append(m.Rows, MatrixRow{
+					Group:   result.Group,
+					Name:    result.Name,
+					SpecRef: result.SpecRef,
+					Cells:   make([]*TestResult, len(columns)),
+				})
+			}
+			m.Rows[row].Cells[i] = result
+		}
+	}
+	return m
+}
+
+// Differs reports whether the brokers disagree on a row
+func (r MatrixRow) Differs() bool {
+	var first *TestResult
+	for _, cell := range r.Cells {
+		if cell == nil {
+			return true
+		}
+		if first == nil {
+			first = cell
+		} else if cell.Status != first.Status {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintMatrix prints the comparison matrix as a console table
+func PrintMatrix(m *Matrix) {
+	fmt.Printf("\n%s\n", TitleStyle.Render(m.Title))
+
+	const cellWidth = 14
+	nameWidth := len("Test")
+	for _, row := range m.Rows {
+		if n := len([]rune(row.Name)); n > nameWidth {
+			nameWidth = n
+		}
+	}
+	if nameWidth > 50 {
+		nameWidth = 50
+	}
+
+	// Header with a legend of broker numbers, since URLs are too wide for columns
+	for i, col := range m.Columns {
+		fmt.Printf("  %s\n", SubtitleStyle.Render(fmt.Sprintf("[%d] %s", i+1, col.Broker)))
+	}
+	fmt.Printf("\n  %-*s", nameWidth, "Test")
+	for i := range m.Columns {
+		fmt.Printf(" %-*s", cellWidth, fmt.Sprintf("[%d]", i+1))
+	}
+	fmt.Println()
+
+	group := ""
+	for _, row := range m.Rows {
+		if row.Group != group {
+			group = row.Group
+			fmt.Printf("%s\n", GroupStyle.Render(group))
+		}
+		name := truncate(row.Name, nameWidth)
+		if row.Differs() {
+			name = WarnStyle.Render(fmt.Sprintf("%-*s", nameWidth, name))
+		} else {
+			name = fmt.Sprintf("%-*s", nameWidth, name)
+		}
+		fmt.Printf("  %s", name)
+		for _, cell := range row.Cells {
+			fmt.Printf(" %s", padStyled(matrixCell(cell), cellWidth))
+		}
+		fmt.Println()
+	}
+
+	// Per broker totals
+	fmt.Printf("\n%s\n", SummaryStyle.Render("Summary"))
+	for i, col := range m.Columns {
+		label := fmt.Sprintf("[%d] %s", i+1, col.Broker)
+		if col.Report == nil {
+			fmt.Printf("  %s: %s\n", label, FailStyle.Render(fmt.Sprintf("not run (%v)", col.Err)))
+			continue
+		}
+		counts := col.Report.Counts()
+		score := col.Report.Score()
+		fmt.Printf("  %s: %s passed, %s failed, %d other, score %.1f%%, %d MUST failures\n",
+			label,
+			PassStyle.Render(fmt.Sprintf("%d", counts[StatusPassed])),
+			FailStyle.Render(fmt.Sprintf("%d", counts[StatusFailed])),
+			len(col.Report.Results)-counts[StatusPassed]-counts[StatusFailed],
+			score.Percent(),
+			score.Failed[spec.LevelMust])
+	}
+}
+
+// matrixCell renders one result for the console table
+func matrixCell(result *TestResult) string {
+	if result == nil {
+		return SkipStyle.Render("-")
+	}
+	return StatusLabel(result.Status)
+}
+
+// padStyled pads a styled string to width visible characters
+func padStyled(s string, width int) string {
+	visible := len([]rune(stripANSI(s)))
+	if visible >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-visible)
+}
+
+// stripANSI removes terminal escape sequences
+func stripANSI(s string) string {
+	var b strings.Builder
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			inEscape = true
+		case inEscape:
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				inEscape = false
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+var matrixTemplate = template.Must(template.New("matrix").Funcs(template.FuncMap{
+	"add":   func(a, b int) int { return a + b },
+	"lower": strings.ToLower,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; }
+tr.group td { background: #e8eef8; font-weight: bold; }
+tr.differs td.name { background: #fff6d5; }
+td.pass { background: #d9f2d9; }
+td.fail { background: #f8d0d0; }
+td.skip { background: #eeeeee; color: #777; }
+td.warn { background: #fff0b3; }
+td.inconclusive { background: #ecd9f5; }
+td.missing { color: #999; }
+.ref { color: #777; font-size: smaller; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated {{.Generated}}</p>
+<h2>Summary</h2>
+<table>
+<tr><th>Broker</th><th>Passed</th><th>Failed</th><th>Other</th><th>Score</th><th>MUST failures</th></tr>
+{{range .Summary}}<tr><td>{{.Broker}}</td>{{if .Err}}<td colspan="5" class="fail">not run: {{.Err}}</td>{{else}}<td>{{.Passed}}</td><td>{{.Failed}}</td><td>{{.Other}}</td><td>{{printf "%.1f%%" .Score}}</td><td>{{.MustFailures}}</td>{{end}}</tr>
+{{end}}</table>
+<h2>Results</h2>
+<table>
+<tr><th>Test</th>{{range .Matrix.Columns}}<th>{{.Broker}}</th>{{end}}</tr>
+{{$cols := len .Matrix.Columns}}{{$group := ""}}{{range .Matrix.Rows}}{{if ne .Group $group}}{{$group = .Group}}<tr class="group"><td colspan="{{add $cols 1}}">{{.Group}}</td></tr>
+{{end}}<tr{{if .Differs}} class="differs"{{end}}><td class="name">{{.Name}}{{if .SpecRef}} <span class="ref">[{{.SpecRef}}]</span>{{end}}</td>{{range .Cells}}{{if .}}<td class="{{lower .Status.String}}" title="{{if .Error}}{{.Error}}{{else}}{{.Notes}}{{end}}">{{.Status}}</td>{{else}}<td class="missing">-</td>{{end}}{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteMatrixHTML writes the comparison matrix as a standalone HTML page
+func WriteMatrixHTML(w io.Writer, m *Matrix) error {
+	type summary struct {
+		Broker       string
+		Err          error
+		Passed       int
+		Failed       int
+		Other        int
+		Score        float64
+		MustFailures int
+	}
+	data := struct {
+		Title     string
+		Generated string
+		Matrix    *Matrix
+		Summary   []summary
+	}{
+		Title:     m.Title,
+		Generated: time.Now().Format(time.RFC1123),
+		Matrix:    m,
+	}
+	for _, col := range m.Columns {
+		s := summary{Broker: col.Broker, Err: col.Err}
+		if col.Report != nil {
+			counts := col.Report.Counts()
+			score := col.Report.Score()
+			s.Passed = counts[StatusPassed]
+			s.Failed = counts[StatusFailed]
+			s.Other = len(col.Report.Results) - s.Passed - s.Failed
+			s.Score = score.Percent()
+			s.MustFailures = score.Failed[spec.LevelMust]
+		}
+		data.Summary = append(data.Summary, s)
+	}
+	return matrixTemplate.Execute(w, data)
+}
@@ -1,9 +1,11 @@
 package common
 
 import (
+	"os"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
 // Styles for output
@@ -28,6 +30,15 @@ var (
 	FailStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("9"))
 
+	SkipStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("8"))
+
+	WarnStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("11"))
+
+	InconclusiveStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("13"))
+
 	ErrorStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("9")).
 			Italic(true)
@@ -42,6 +53,27 @@ var (
 			Italic(true)
 )
 
+// PlainOutputRequested reports whether the environment asks for output
+// without colors, i.e. NO_COLOR is set or TERM is dumb
+func PlainOutputRequested() bool {
+	return os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb"
+}
+
+// plainOutput is set by UsePlainOutput, which also rules out rewriting
+// lines in place
+var plainOutput bool
+
+// UsePlainOutput turns off colors and text attributes in everything rendered
+// with lipgloss. The margins of the styles above are dropped as well, since
+// lipgloss pads their blank lines with spaces.
+func UsePlainOutput() {
+	plainOutput = true
+	lipgloss.SetColorProfile(termenv.Ascii)
+	TitleStyle = TitleStyle.UnsetMarginTop().UnsetMarginBottom()
+	GroupStyle = GroupStyle.UnsetMarginTop()
+	SummaryStyle = SummaryStyle.UnsetMarginTop()
+}
+
 // ShouldRunGroup determines if a test group should run based on the filter
 func ShouldRunGroup(groupName, filter string) bool {
 	if filter == "" || filter == "all" {
@@ -0,0 +1,278 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultPartitionWindows are the partition lengths tried when
+// Config.PartitionWindows is empty
+var DefaultPartitionWindows = []time.Duration{time.Second, 5 * time.Second}
+
+// partitionWindows returns the configured partition lengths or the defaults
+func (c Config) partitionWindows() []time.Duration {
+	if len(c.PartitionWindows) > 0 {
+		return c.PartitionWindows
+	}
+	return DefaultPartitionWindows
+}
+
+// eachWindow runs check once per partition window and joins the notes of
+// the runs, stopping at the first failure
+func eachWindow(cfg Config, check func(window time.Duration) (string, error)) (string, error) {
+	var notes []string
+	for _, window := range cfg.partitionWindows() {
+		note, err := check(window)
+		if err != nil {
+			return "", fmt.Errorf("%v partition: %w", window, err)
+		}
+		notes = append(notes, fmt.Sprintf("%v: %s", window, note))
+	}
+	return strings.Join(notes, "; "), nil
+}
+
+// CheckPartitionQoS2 runs a QoS 2 message between a publisher and a
+// subscriber, both with persistent sessions behind a FaultProxy, and
+// black-holes their traffic mid-handshake: after the publisher's PUBREC and
+// the subscriber's PUBLISH, so the PUBREL of the one and the PUBREC of the
+// other are held. Once connectivity is restored both flows must complete
+// and the subscriber must receive the message exactly once. A broker that
+// dropped a connection during the partition is reconnected to, and must
+// resume the flow from the session.
+func CheckPartitionQoS2(cfg Config, level byte) (string, error) {
+	return eachWindow(cfg, func(window time.Duration) (string, error) {
+		return partitionQoS2(cfg, level, window)
+	})
+}
+
+func partitionQoS2(cfg Config, level byte, window time.Duration) (string, error) {
+	p, err := StartFaultProxy(cfg)
+	if err != nil {
+		return "", err
+	}
+	defer p.Close()
+	via := p.Config()
+	subID := cfg.ClientID("test-partition-qos2-sub")
+	pubID := cfg.ClientID("test-partition-qos2-pub")
+	topic := cfg.Topic(GenerateTopicName("test/partition/qos2"))
+
+	sub, _, err := dialPersistent(via, level, subID)
+	if err != nil {
+		return "", err
+	}
+	defer func() { sub.Close() }()
+	codes, err := sub.Subscribe(1, 2, cfg.Scaled(5*time.Second), topic)
+	if err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		return "", fmt.Errorf("subscribe failed: %v % x", err, codes)
+	}
+	pub, _, err := dialPersistent(via, level, pubID)
+	if err != nil {
+		return "", err
+	}
+	defer func() { pub.Close() }()
+
+	payload := []byte(GenerateClientID("qos2"))
+	const packetID = 1
+	if err := pub.Publish(topic, 2, packetID, payload); err != nil {
+		return "", fmt.Errorf("failed to send PUBLISH: %w", err)
+	}
+	if _, _, err := pub.Expect(0x50, cfg.Scaled(5*time.Second), nil); err != nil {
+		return "", fmt.Errorf("no PUBREC before the partition: %w", err)
+	}
+	header, body, err := sub.Expect(0x30, cfg.Scaled(5*time.Second), nil)
+	if err != nil {
+		return "", fmt.Errorf("message not delivered before the partition: %w", err)
+	}
+	m, err := sub.ParsePublish(header, body)
+	if err != nil {
+		return "", err
+	}
+	if m.QoS != 2 {
+		return "", fmt.Errorf("message delivered at QoS %d, expected 2", m.QoS)
+	}
+
+	p.Blackhole()
+	sub.Send(0x50, binary.BigEndian.AppendUint16(nil, m.PacketID))
+	pub.Send(0x62, binary.BigEndian.AppendUint16(nil, packetID))
+	time.Sleep(window)
+	p.Restore()
+	restored := time.Now()
+
+	var notes []string
+	_, body, err = pub.Expect(0x70, cfg.Scaled(5*time.Second), nil)
+	if errors.Is(err, ErrBrokerClosed) {
+		// The client resends its PUBREL on the new connection [MQTT-4.4.0-1]
+		pub.Close()
+		var present bool
+		if pub, present, err = dialPersistent(via, level, pubID); err != nil {
+			return "", fmt.Errorf("publisher reconnect after the partition: %w", err)
+		}
+		if !present {
+			return "", fmt.Errorf("publisher's session with the unreleased message lost in the partition")
+		}
+		notes = append(notes, "broker dropped the publisher")
+		pub.Send(0x62, binary.BigEndian.AppendUint16(nil, packetID))
+		_, body, err = pub.Expect(0x70, cfg.Scaled(5*time.Second), nil)
+	}
+	if err != nil {
+		return "", fmt.Errorf("publisher's PUBREL not completed after the partition: %w", err)
+	}
+	if len(body) > 2 && body[2] >= 0x80 {
+		return "", fmt.Errorf("PUBCOMP after the partition has reason code 0x%02x", body[2])
+	}
+	completed := time.Since(restored)
+
+	released, dups, rejoined, err := finishPartitionedQoS2(cfg, via, level, subID, sub, m.PacketID, payload)
+	if rejoined != nil {
+		sub = rejoined
+		notes = append(notes, "broker dropped the subscriber")
+	}
+	switch {
+	case err != nil:
+		return "", err
+	case !released:
+		return "", fmt.Errorf("subscriber's QoS 2 flow not released after the partition")
+	case dups > 0:
+		return "", fmt.Errorf("QoS 2 message delivered %d more times after the partition", dups)
+	}
+	pub.Send(0xE0, nil)
+	sub.Send(0xE0, nil)
+	notes = append([]string{fmt.Sprintf("PUBCOMP %v after restore", completed.Round(100*time.Microsecond))}, notes...)
+	return strings.Join(notes, ", "), nil
+}
+
+// finishPartitionedQoS2 completes the subscriber's side of a QoS 2 message
+// whose PUBREC was held by a partition. It answers the broker's PUBREL,
+// and a resent PUBLISH after a reconnect, until no packet arrives for a
+// second and reports whether the message was released and how many times
+// it was delivered again as a new message. When the broker closed the
+// connection it reconnects once and returns the new connection as rejoined.
+func finishPartitionedQoS2(cfg, via Config, level byte, clientID string, conn *RawConn, packetID uint16, payload []byte) (released bool, dups int, rejoined *RawConn, err error) {
+	id := binary.BigEndian.AppendUint16(nil, packetID)
+	for {
+		wait := cfg.Scaled(5 * time.Second)
+		if released {
+			wait = cfg.Scaled(time.Second)
+		}
+		conn.SetReadDeadline(time.Now().Add(wait))
+		header, body, rerr := ReadRawPacket(conn)
+		if rerr != nil {
+			conn.SetReadDeadline(time.Time{})
+			var netErr net.Error
+			if errors.As(rerr, &netErr) && netErr.Timeout() {
+				return released, dups, rejoined, nil
+			}
+			if rejoined != nil || released {
+				return released, dups, rejoined, rerr
+			}
+			conn.Close()
+			var present bool
+			if conn, present, err = dialPersistent(via, level, clientID); err != nil {
+				return released, dups, rejoined, fmt.Errorf("subscriber reconnect after the partition: %w", err)
+			}
+			rejoined = conn
+			if !present {
+				return released, dups, rejoined, fmt.Errorf("subscriber's session lost in the partition")
+			}
+			continue
+		}
+		switch header & 0xF0 {
+		case 0x60:
+			if len(body) >= 2 && binary.BigEndian.Uint16(body) == packetID {
+				released = true
+			}
+			conn.Send(0x70, body[:min(2, len(body))])
+		case 0x30:
+			m, perr := conn.ParsePublish(header, body)
+			if perr != nil {
+				return released, dups, rejoined, perr
+			}
+			if !bytes.Equal(m.Payload, payload) {
+				continue
+			}
+			if m.QoS == 2 && m.PacketID == packetID && !released {
+				// Resent after a reconnect, not a new delivery
+				conn.Send(0x50, id)
+				continue
+			}
+			dups++
+			switch m.QoS {
+			case 1:
+				conn.Send(0x40, binary.BigEndian.AppendUint16(nil, m.PacketID))
+			case 2:
+				conn.Send(0x50, binary.BigEndian.AppendUint16(nil, m.PacketID))
+			}
+		}
+	}
+}
+
+// CheckPartitionSubscribe black-holes a client's traffic behind a
+// FaultProxy, sends a SUBSCRIBE into the partition and restores
+// connectivity after the window. The SUBACK must then arrive and the
+// subscription deliver messages. If the broker dropped the connection
+// during the partition the client reconnects and subscribes again.
+func CheckPartitionSubscribe(cfg Config, level byte) (string, error) {
+	return eachWindow(cfg, func(window time.Duration) (string, error) {
+		return partitionSubscribe(cfg, level, window)
+	})
+}
+
+func partitionSubscribe(cfg Config, level byte, window time.Duration) (string, error) {
+	p, err := StartFaultProxy(cfg)
+	if err != nil {
+		return "", err
+	}
+	defer p.Close()
+	via := p.Config()
+	clientID := cfg.ClientID("test-partition-subscribe")
+	topic := cfg.Topic(GenerateTopicName("test/partition/subscribe"))
+
+	conn, _, err := dialPersistent(via, level, clientID)
+	if err != nil {
+		return "", err
+	}
+	defer func() { conn.Close() }()
+
+	p.Blackhole()
+	restore := time.AfterFunc(window, p.Restore)
+	defer restore.Stop()
+	sent := time.Now()
+	codes, err := conn.Subscribe(1, 1, window+cfg.Scaled(5*time.Second), topic)
+	took := time.Since(sent)
+	note := fmt.Sprintf("SUBACK %v after restore", (took - window).Round(100*time.Microsecond))
+	if errors.Is(err, ErrBrokerClosed) {
+		conn.Close()
+		if conn, _, err = dialPersistent(via, level, clientID); err != nil {
+			return "", fmt.Errorf("reconnect after the partition: %w", err)
+		}
+		codes, err = conn.Subscribe(2, 1, cfg.Scaled(5*time.Second), topic)
+		note = "broker dropped the connection, subscribed again"
+	} else if err == nil && took < window {
+		return "", fmt.Errorf("SUBACK arrived %v into the %v partition, the traffic was not held", took.Round(time.Millisecond), window)
+	}
+	if err != nil {
+		return "", fmt.Errorf("SUBSCRIBE sent into the partition never acknowledged: %w", err)
+	}
+	if len(codes) != 1 || codes[0] >= 0x80 {
+		return "", fmt.Errorf("SUBACK after the partition % x", codes)
+	}
+
+	payload := []byte(GenerateClientID("after-partition"))
+	if err := publishOn(cfg, level, topic, payload); err != nil {
+		return "", err
+	}
+	m, _, err := nextPublish(conn, cfg.Scaled(5*time.Second))
+	if err != nil {
+		return "", fmt.Errorf("subscription made across the partition delivers nothing: %w", err)
+	}
+	if !bytes.Equal(m.Payload, payload) {
+		return "", fmt.Errorf("subscription made across the partition delivered %q, expected %q", m.Payload, payload)
+	}
+	conn.Send(0xE0, nil)
+	return note, nil
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// pingRounds is how many PINGREQs CheckPingResponses sends, one at a time
+const pingRounds = 10
+
+// CheckPingResponses sends PINGREQs on a raw connection at protocol level,
+// waiting for each answer before the next, and checks every one is answered
+// with a PINGRESP of Remaining Length 0 within a second, scaled by the
+// timing multiplier. It returns the slowest answer.
+func CheckPingResponses(cfg Config, level byte) (time.Duration, error) {
+	conn, err := DialRaw(cfg, level, cfg.ClientID("test-ping-raw"))
+	if err != nil {
+		return 0, fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := cfg.Scaled(time.Second)
+	var slowest time.Duration
+	for i := range pingRounds {
+		sent := time.Now()
+		if err := conn.Send(0xC0, nil); err != nil {
+			return slowest, fmt.Errorf("failed to send PINGREQ %d: %w", i+1, err)
+		}
+		header, body, err := conn.Expect(0xD0, deadline, nil)
+		if err != nil {
+			return slowest, fmt.Errorf("PINGREQ %d: %w", i+1, err)
+		}
+		slowest = max(slowest, time.Since(sent))
+		if header != 0xD0 || len(body) != 0 {
+			return slowest, fmt.Errorf("PINGRESP %d has fixed header 0x%02x and Remaining Length %d, expected 0xD0 and 0", i+1, header, len(body))
+		}
+	}
+	conn.Send(0xE0, nil)
+	return slowest, nil
+}
+
+// CheckNoUnsolicitedPingresp keeps a raw connection at protocol level idle,
+// then exchanges a QoS 1 message and a single PINGREQ on it, and checks the
+// broker sends no PINGRESP other than the one answering the PINGREQ. A
+// PINGRESP only ever answers a PINGREQ; the Server never sends one of its
+// own accord, e.g. to keep the connection alive.
+func CheckNoUnsolicitedPingresp(cfg Config, level byte) error {
+	conn, err := DialRaw(cfg, level, cfg.ClientID("test-ping-unsolicited"))
+	if err != nil {
+		return fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+
+	quiet := cfg.Scaled(3 * time.Second)
+	if header, _, err := conn.Expect(0xD0, quiet, nil); err == nil {
+		return fmt.Errorf("broker sent %s on an idle connection without a PINGREQ", PacketName(header))
+	}
+
+	pingresps := 0
+	countPingresp := func(header byte, _ []byte) {
+		if header&0xF0 == 0xD0 {
+			pingresps++
+		}
+	}
+	timeout := cfg.Scaled(5 * time.Second)
+	topic := cfg.Topic(GenerateTopicName("test/ping/unsolicited"))
+	if codes, err := conn.Subscribe(1, 1, timeout, topic); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		return fmt.Errorf("subscribe failed: %v % x", err, codes)
+	}
+	if err := conn.Publish(topic, 1, 2, []byte("ping")); err != nil {
+		return fmt.Errorf("failed to send PUBLISH: %w", err)
+	}
+	if _, _, err := conn.Expect(0x40, timeout, countPingresp); err != nil {
+		return fmt.Errorf("no PUBACK: %w", err)
+	}
+	if pingresps > 0 {
+		return fmt.Errorf("broker sent a PINGRESP without a PINGREQ while acknowledging a PUBLISH")
+	}
+
+	if err := conn.Send(0xC0, nil); err != nil {
+		return fmt.Errorf("failed to send PINGREQ: %w", err)
+	}
+	if _, _, err := conn.Expect(0xD0, timeout, nil); err != nil {
+		return fmt.Errorf("PINGREQ not answered: %w", err)
+	}
+	if _, _, err := conn.Expect(0xD0, cfg.Scaled(time.Second), nil); err == nil {
+		return fmt.Errorf("broker answered one PINGREQ with more than one PINGRESP")
+	}
+	conn.Send(0xE0, nil)
+	return nil
+}
@@ -0,0 +1,184 @@
+package common
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Durations are how long tests took in earlier runs, to estimate how long
+// a run has left
+type Durations map[TestID]time.Duration
+
+type durationEntry struct {
+	Group    string        `json:"group"`
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ReadDurations reads durations written by WriteDurations. A missing file
+// reads as no durations.
+func ReadDurations(path string) (Durations, error) {
+	d := make(Durations)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []durationEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, e := range entries {
+		d[TestID{e.Group, e.Name}] = e.Duration
+	}
+	return d, nil
+}
+
+// WriteDurations writes d to path as JSON
+func WriteDurations(path string, d Durations) error {
+	entries := make([]durationEntry, 0, len(d))
+	for id, duration := range d {
+		entries = append(entries, durationEntry{id.Group, id.Name, duration})
+	}
+	// Stable output keeps the file diffable
+	slices.SortFunc(entries, func(a, b durationEntry) int {
+		return cmp.Or(cmp.Compare(a.Group, b.Group), cmp.Compare(a.Name, b.Name))
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Record folds the durations of the tests that ran in r into d. Each test
+// keeps the average of its new and previous duration, so one slow run does
+// not throw the estimate off.
+func (d Durations) Record(r *Report) {
+	for _, result := range r.Results {
+		if result.Status == StatusSkipped {
+			continue
+		}
+		id := TestID{result.Group, result.Name}
+		if prev, ok := d[id]; ok {
+			d[id] = (prev + result.Duration) / 2
+		} else {
+			d[id] = result.Duration
+		}
+	}
+}
+
+// estimates returns the expected duration of every test in groups in run
+// order, zero for tests without history
+func (d Durations) estimates(groups []TestGroup) []time.Duration {
+	if len(d) == 0 {
+		return nil
+	}
+	refs, err := CollectTestRefs(groups)
+	if err != nil {
+		return nil
+	}
+	estimates := make([]time.Duration, len(refs))
+	for i, ref := range refs {
+		estimates[i] = d[TestID{ref.Group, ref.Name}]
+	}
+	return estimates
+}
+
+// remaining estimates how long the tests after the first done will take.
+// Tests without history are assumed to take as long as the tests so far
+// did on average. It is false when there is nothing to go by yet.
+func remaining(estimates []time.Duration, done, total int, elapsed time.Duration) (time.Duration, bool) {
+	var left time.Duration
+	unknown := total - done
+	if len(estimates) == total {
+		unknown = 0
+		for _, e := range estimates[done:] {
+			if e > 0 {
+				left += e
+			} else {
+				unknown++
+			}
+		}
+	}
+	if unknown > 0 {
+		if done == 0 {
+			return 0, false
+		}
+		left += time.Duration(unknown) * elapsed / time.Duration(done)
+	}
+	return left, true
+}
+
+// statusLine is a line at the bottom of a terminal that is rewritten in
+// place and cleared before anything else is printed. Where output is not a
+// terminal each status is printed as a line of its own.
+type statusLine struct {
+	w     io.Writer
+	live  bool
+	shown bool
+}
+
+func newStatusLine(w io.Writer) *statusLine {
+	live := false
+	if f, ok := w.(*os.File); ok && !plainOutput {
+		if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			live = true
+		}
+	}
+	return &statusLine{w: w, live: live}
+}
+
+func (s *statusLine) Write(p []byte) (int, error) {
+	s.clear()
+	return s.w.Write(p)
+}
+
+func (s *statusLine) clear() {
+	if s.shown {
+		io.WriteString(s.w, "\r\x1b[K")
+		s.shown = false
+	}
+}
+
+// Set shows text as the status
+func (s *statusLine) Set(text string) {
+	s.clear()
+	if !s.live {
+		fmt.Fprintln(s.w, text)
+		return
+	}
+	io.WriteString(s.w, text)
+	s.shown = true
+}
+
+// progressStatus renders the running totals of a run and what is left of it
+func progressStatus(p Progress, counts map[Status]int, elapsed time.Duration, estimates []time.Duration) string {
+	parts := []string{
+		fmt.Sprintf("%d/%d", p.Done, p.Total),
+		PassStyle.Render(fmt.Sprintf("%d passed", counts[StatusPassed])),
+	}
+	if n := counts[StatusFailed]; n > 0 {
+		parts = append(parts, FailStyle.Render(fmt.Sprintf("%d failed", n)))
+	}
+	if n := p.Done - counts[StatusPassed] - counts[StatusFailed]; n > 0 {
+		parts = append(parts, fmt.Sprintf("%d other", n))
+	}
+	parts = append(parts, fmt.Sprintf("%v elapsed", elapsed.Round(time.Second)))
+	if p.Done < p.Total {
+		if left, ok := remaining(estimates, p.Done, p.Total, elapsed); ok {
+			parts = append(parts, fmt.Sprintf("about %v left", left.Round(time.Second)))
+		}
+	}
+	return "  " + DetailStyle.Render("▸ ") + strings.Join(parts, DetailStyle.Render(" · "))
+}
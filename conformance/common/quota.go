@@ -0,0 +1,38 @@
+package common
+
+// Quota sets how hard the quota tests push the broker. Where a count is
+// given it is taken as a known limit of the broker, and reaching it without
+// the broker reporting Quota exceeded fails the test; the defaults only probe
+// for a quota and are inconclusive when none is hit.
+type Quota struct {
+	// Messages is how many QoS 1 PUBLISHes the flood test sends back to back
+	Messages int `yaml:"messages"`
+
+	// Inflight is how many QoS 2 PUBLISHes the inflight test leaves
+	// unreleased, at most the broker's Receive Maximum
+	Inflight int `yaml:"inflight"`
+}
+
+// Default counts of the quota tests
+const (
+	DefaultQuotaMessages = 1000
+	DefaultQuotaInflight = 65535 // Capped by the broker's Receive Maximum
+)
+
+// FloodMessages returns the number of messages the flood test sends and
+// whether it was configured
+func (q Quota) FloodMessages() (int, bool) {
+	if q.Messages > 0 {
+		return q.Messages, true
+	}
+	return DefaultQuotaMessages, false
+}
+
+// InflightMessages returns the number of QoS 2 PUBLISHes the inflight test
+// leaves unreleased and whether it was configured
+func (q Quota) InflightMessages() (int, bool) {
+	if q.Inflight > 0 {
+		return q.Inflight, true
+	}
+	return DefaultQuotaInflight, false
+}
@@ -0,0 +1,664 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RawPacket encodes a packet from the first byte of its fixed header and its
+// body, filling in the Remaining Length
+func RawPacket(header byte, body []byte) []byte {
+	return append(AppendVarint([]byte{header}, len(body)), body...)
+}
+
+// AppendVarint appends n as a Variable Byte Integer, the encoding of the
+// Remaining Length, property lengths and Subscription Identifiers
+func AppendVarint(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// AppendString appends s as a length-prefixed MQTT string
+func AppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// RawWill is the Will Message of a raw CONNECT
+type RawWill struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// RawConnect encodes a CONNECT with a clean session and a 30s keep alive for
+// protocol level 4 (3.1.1) or 5
+func RawConnect(level byte, clientID, username, password string) []byte {
+	return RawConnectWill(level, clientID, username, password, nil)
+}
+
+// RawConnectWill is RawConnect with a Will Message, or none when will is nil
+func RawConnectWill(level byte, clientID, username, password string, will *RawWill) []byte {
+	flags := byte(0x02)
+	if will != nil {
+		flags |= 0x04 | will.QoS<<3
+		if will.Retain {
+			flags |= 0x20
+		}
+	}
+	if username != "" {
+		flags |= 0x80
+	}
+	if password != "" {
+		flags |= 0x40
+	}
+	body := AppendString(nil, "MQTT")
+	body = append(body, level, flags, 0, 30)
+	if level >= 5 {
+		body = append(body, 0) // No properties
+	}
+	body = AppendString(body, clientID)
+	if will != nil {
+		if level >= 5 {
+			body = append(body, 0) // No will properties
+		}
+		body = AppendString(body, will.Topic)
+		body = binary.BigEndian.AppendUint16(body, uint16(len(will.Payload)))
+		body = append(body, will.Payload...)
+	}
+	if username != "" {
+		body = AppendString(body, username)
+	}
+	if password != "" {
+		body = AppendString(body, password)
+	}
+	return RawPacket(0x10, body)
+}
+
+// ErrMalformedLength is returned by ReadRawPacket for a Remaining Length
+// longer than four bytes
+var ErrMalformedLength = errors.New("malformed Remaining Length")
+
+// ReadRawPacket reads one packet and returns the first byte of its fixed
+// header and its body
+func ReadRawPacket(r io.Reader) (byte, []byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, nil, err
+	}
+	header := b[0]
+	length, shift := 0, 0
+	for i := 0; ; i++ {
+		if i == 4 {
+			return header, nil, ErrMalformedLength
+		}
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return header, nil, err
+		}
+		length |= int(b[0]&0x7F) << shift
+		shift += 7
+		if b[0]&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return header, nil, err
+	}
+	return header, body, nil
+}
+
+// ConnectOutcome is how a broker answered a raw CONNECT
+type ConnectOutcome struct {
+	Connack bool // A CONNACK arrived, as opposed to the connection closing
+	Code    byte // CONNACK return or reason code
+	Closed  bool // The broker closed the connection after refusing it
+}
+
+// TryConnect sends a CONNECT at protocol level with the given credentials,
+// which are left out when empty, and reports how the broker answered. An
+// accepted connection is closed again.
+func TryConnect(cfg Config, level byte, clientID, username, password string) (ConnectOutcome, error) {
+	var out ConnectOutcome
+	conn, err := Dial(cfg)
+	if err != nil {
+		return out, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(cfg.Scaled(5 * time.Second)))
+	if _, err := conn.Write(RawConnect(level, clientID, username, password)); err != nil {
+		return out, fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+	header, body, err := ReadRawPacket(conn)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return out, errors.New("no CONNACK")
+		}
+		out.Closed = true
+		return out, nil
+	}
+	if header != 0x20 || len(body) < 2 {
+		return out, fmt.Errorf("expected CONNACK, got packet 0x%02x", header)
+	}
+	out.Connack, out.Code = true, body[1]
+	if out.Code != 0 {
+		_, out.Closed = AwaitClose(conn, cfg.Scaled(2*time.Second))
+	}
+	return out, nil
+}
+
+// RawConn is a connection to the broker that packets are written to and
+// read from as bytes, for tests of what the client libraries will not send
+// or do not show
+type RawConn struct {
+	net.Conn
+	Level byte // Protocol level, 4 for 3.1.1 or 5
+
+	// ReceiveMaximum is how many QoS 1 and 2 PUBLISHes the broker accepts
+	// unacknowledged, from its CONNACK on MQTT 5 and 65535 otherwise
+	ReceiveMaximum uint16
+
+	// MaximumPacketSize is the largest packet the broker accepts, from its
+	// CONNACK on MQTT 5 and 0 when it sets no limit
+	MaximumPacketSize uint32
+}
+
+// DialRaw connects to the broker and sends a CONNECT for protocol level 4
+// (3.1.1) or 5 with the configured credentials. It fails unless the broker
+// accepts the connection. The connection's deadline is left cleared.
+func DialRaw(cfg Config, level byte, clientID string) (*RawConn, error) {
+	return DialRawWill(cfg, level, clientID, nil)
+}
+
+// DialRawWill is DialRaw with a Will Message, or none when will is nil
+func DialRawWill(cfg Config, level byte, clientID string, will *RawWill) (*RawConn, error) {
+	conn, err := Dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(RawConnectWill(level, clientID, cfg.Username, cfg.Password, will)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+	header, body, err := ReadRawPacket(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read CONNACK: %w", err)
+	}
+	if header != 0x20 || len(body) < 2 {
+		conn.Close()
+		return nil, fmt.Errorf("expected CONNACK, got packet 0x%02x", header)
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("connection refused with code 0x%02x", body[1])
+	}
+	conn.SetDeadline(time.Time{})
+	rc := &RawConn{Conn: conn, Level: level, ReceiveMaximum: 65535}
+	if level >= 5 {
+		r := &reader{b: body[2:]}
+		for _, p := range r.properties() {
+			if n, err := strconv.ParseUint(p.Value, 10, 16); p.Name == "Receive Maximum" && err == nil {
+				rc.ReceiveMaximum = uint16(n)
+			}
+			if n, err := strconv.ParseUint(p.Value, 10, 32); p.Name == "Maximum Packet Size" && err == nil {
+				rc.MaximumPacketSize = uint32(n)
+			}
+		}
+	}
+	return rc, nil
+}
+
+// ErrBrokerClosed is returned by RawConn methods when the broker closed the
+// connection while they waited for a packet
+var ErrBrokerClosed = errors.New("broker closed the connection")
+
+// Send writes a packet
+func (c *RawConn) Send(header byte, body []byte) error {
+	_, err := c.Write(RawPacket(header, body))
+	return err
+}
+
+// Expect reads packets until one of type packetType (e.g. 0x90 for SUBACK)
+// arrives within timeout and returns its fixed header byte and body. Other
+// packets are passed to skip, which may be nil.
+func (c *RawConn) Expect(packetType byte, timeout time.Duration, skip func(header byte, body []byte)) (byte, []byte, error) {
+	c.SetReadDeadline(time.Now().Add(timeout))
+	defer c.SetReadDeadline(time.Time{})
+	for {
+		header, body, err := ReadRawPacket(c)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, nil, fmt.Errorf("no %s within %v", PacketName(packetType), timeout)
+			}
+			if errors.Is(err, io.EOF) {
+				return 0, nil, ErrBrokerClosed
+			}
+			return 0, nil, err
+		}
+		if header&0xF0 == packetType {
+			return header, body, nil
+		}
+		if skip != nil {
+			skip(header, body)
+		}
+	}
+}
+
+// RawSubscription is a topic filter to subscribe to with the requested QoS,
+// or with the whole subscription options byte on MQTT 5
+type RawSubscription struct {
+	Filter  string
+	Options byte
+}
+
+// Subscribe sends a SUBSCRIBE for filters at qos and returns the return or
+// reason codes of the SUBACK, one per filter if the broker behaves
+func (c *RawConn) Subscribe(packetID uint16, qos byte, timeout time.Duration, filters ...string) ([]byte, error) {
+	subs := make([]RawSubscription, len(filters))
+	for i, f := range filters {
+		subs[i] = RawSubscription{f, qos}
+	}
+	return c.SubscribeAll(packetID, timeout, subs...)
+}
+
+// SubscribeAll is Subscribe with options of its own for every filter
+func (c *RawConn) SubscribeAll(packetID uint16, timeout time.Duration, subs ...RawSubscription) ([]byte, error) {
+	return c.SubscribeIdentified(packetID, 0, timeout, subs...)
+}
+
+// SubscribeIdentified is SubscribeAll with a Subscription Identifier for
+// the subscriptions, or none when subscriptionID is 0. Only MQTT 5 has them.
+func (c *RawConn) SubscribeIdentified(packetID uint16, subscriptionID int, timeout time.Duration, subs ...RawSubscription) ([]byte, error) {
+	body := binary.BigEndian.AppendUint16(nil, packetID)
+	if c.Level >= 5 {
+		var props []byte
+		if subscriptionID > 0 {
+			props = AppendVarint([]byte{0x0B}, subscriptionID)
+		}
+		body = append(AppendVarint(body, len(props)), props...)
+	}
+	for _, s := range subs {
+		body = AppendString(body, s.Filter)
+		body = append(body, s.Options)
+	}
+	if err := c.Send(0x82, body); err != nil {
+		return nil, fmt.Errorf("failed to send SUBSCRIBE: %w", err)
+	}
+	return c.expectAck(0x90, packetID, timeout)
+}
+
+// Unsubscribe sends an UNSUBSCRIBE for filters and returns the reason codes
+// of the UNSUBACK, which MQTT 3.1.1 does not have
+func (c *RawConn) Unsubscribe(packetID uint16, timeout time.Duration, filters ...string) ([]byte, error) {
+	body := binary.BigEndian.AppendUint16(nil, packetID)
+	if c.Level >= 5 {
+		body = append(body, 0) // No properties
+	}
+	for _, f := range filters {
+		body = AppendString(body, f)
+	}
+	if err := c.Send(0xA2, body); err != nil {
+		return nil, fmt.Errorf("failed to send UNSUBSCRIBE: %w", err)
+	}
+	return c.expectAck(0xB0, packetID, timeout)
+}
+
+// Publish sends a PUBLISH with the given packet identifier, which is left
+// out at QoS 0
+func (c *RawConn) Publish(topic string, qos byte, packetID uint16, payload []byte) error {
+	body := AppendString(nil, topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, packetID)
+	}
+	if c.Level >= 5 {
+		body = append(body, 0) // No properties
+	}
+	body = append(body, payload...)
+	return c.Send(0x30|qos<<1, body)
+}
+
+// PublishAcked sends a QoS 1 or 2 PUBLISH and returns the reason code of
+// its PUBACK or PUBREC, which is 0x00 where the packet carries none (MQTT
+// 3.1.1, or MQTT 5 with a Remaining Length of 2). An accepted QoS 2 PUBLISH
+// is released and its PUBCOMP awaited, so the flow is complete on return.
+func (c *RawConn) PublishAcked(topic string, qos byte, packetID uint16, payload []byte, timeout time.Duration) (byte, error) {
+	if err := c.Publish(topic, qos, packetID, payload); err != nil {
+		return 0, fmt.Errorf("failed to send PUBLISH: %w", err)
+	}
+	ackType := byte(0x40)
+	if qos == 2 {
+		ackType = 0x50
+	}
+	_, ack, err := c.Expect(ackType, timeout, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(ack) < 2 {
+		return 0, fmt.Errorf("%s too short", PacketName(ackType))
+	}
+	if id := binary.BigEndian.Uint16(ack); id != packetID {
+		return 0, fmt.Errorf("%s for packet identifier %d, expected %d", PacketName(ackType), id, packetID)
+	}
+	var reason byte
+	if len(ack) > 2 {
+		reason = ack[2]
+	}
+	if qos == 2 && reason < 0x80 {
+		if err := c.Send(0x62, binary.BigEndian.AppendUint16(nil, packetID)); err != nil {
+			return reason, fmt.Errorf("failed to send PUBREL: %w", err)
+		}
+		if _, _, err := c.Expect(0x70, timeout, nil); err != nil {
+			return reason, err
+		}
+	}
+	return reason, nil
+}
+
+// expectAck reads the SUBACK or UNSUBACK for packetID and returns its return
+// or reason codes
+func (c *RawConn) expectAck(packetType byte, packetID uint16, timeout time.Duration) ([]byte, error) {
+	_, body, err := c.Expect(packetType, timeout, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < 2 {
+		return nil, fmt.Errorf("%s too short", PacketName(packetType))
+	}
+	if id := binary.BigEndian.Uint16(body); id != packetID {
+		return nil, fmt.Errorf("%s for packet identifier %d, expected %d", PacketName(packetType), id, packetID)
+	}
+	body = body[2:]
+	if c.Level >= 5 {
+		props, n, ok := decodeRemainingLength(body)
+		if !ok || n+props > len(body) {
+			return nil, fmt.Errorf("malformed %s properties", PacketName(packetType))
+		}
+		body = body[n+props:]
+	}
+	return body, nil
+}
+
+// RawPublish is a PUBLISH read from a RawConn
+type RawPublish struct {
+	Topic      string
+	QoS        byte
+	PacketID   uint16     // Zero at QoS 0
+	Properties []Property // MQTT 5 only, decoded as in traces
+	// SubscriptionIDs are the Subscription Identifiers the PUBLISH carries,
+	// in the order the broker put them in. MQTT 5 only.
+	SubscriptionIDs []int
+	Payload         []byte
+}
+
+// ParsePublish decodes a PUBLISH read by Expect
+func (c *RawConn) ParsePublish(header byte, body []byte) (RawPublish, error) {
+	p := RawPublish{QoS: header >> 1 & 0x03}
+	if len(body) < 2 {
+		return p, errors.New("PUBLISH too short")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if 2+n > len(body) {
+		return p, errors.New("PUBLISH topic overruns the packet")
+	}
+	p.Topic, body = string(body[2:2+n]), body[2+n:]
+	if p.QoS > 0 {
+		if len(body) < 2 {
+			return p, errors.New("PUBLISH without packet identifier")
+		}
+		p.PacketID, body = binary.BigEndian.Uint16(body), body[2:]
+	}
+	if c.Level >= 5 {
+		p.SubscriptionIDs = (&reader{b: body}).subscriptionIDs()
+		r := &reader{b: body}
+		p.Properties = r.properties()
+		if !r.ok() {
+			return p, errors.New("malformed PUBLISH properties")
+		}
+		body = r.b
+	}
+	p.Payload = body
+	return p, nil
+}
+
+// subscriptionIDs reads a property section and returns the values of its
+// Subscription Identifier properties, property 0x0B, a Variable Byte Integer
+func (r *reader) subscriptionIDs() []int {
+	props := &reader{b: r.take(r.varint())}
+	var ids []int
+	for props.more() {
+		id := props.byte()
+		def, known := propertyNames[id]
+		if !known {
+			break
+		}
+		switch def.kind {
+		case 'b':
+			props.skip(1)
+		case '2':
+			props.skip(2)
+		case '4':
+			props.skip(4)
+		case 'v':
+			n := props.varint()
+			if id == 0x0B && props.ok() {
+				ids = append(ids, n)
+			}
+		case 's', 'd':
+			props.binary()
+		case 'p':
+			props.binary()
+			props.binary()
+		}
+	}
+	return ids
+}
+
+// RoundTrip subscribes to topic at QoS 1 and publishes a QoS 1 message to
+// it, then waits for the PUBACK and for the message to come back, which it
+// acknowledges. It checks that a connection still carries QoS flows, e.g.
+// after sending it something unusual.
+func (c *RawConn) RoundTrip(topic string, timeout time.Duration) error {
+	codes, err := c.Subscribe(1, 1, timeout, topic)
+	if err != nil {
+		return err
+	}
+	if len(codes) != 1 || codes[0] >= 0x80 {
+		return fmt.Errorf("subscription refused with SUBACK % x", codes)
+	}
+
+	payload := []byte("round trip")
+	if err := c.Publish(topic, 1, 2, payload); err != nil {
+		return fmt.Errorf("failed to send PUBLISH: %w", err)
+	}
+
+	// The message may come back before or after the PUBACK
+	var received bool
+	var deliveryErr error
+	deliver := func(header byte, body []byte) {
+		p, err := c.ParsePublish(header, body)
+		if err != nil {
+			deliveryErr = err
+			return
+		}
+		if p.Topic != topic || !bytes.Equal(p.Payload, payload) {
+			return
+		}
+		received = true
+		if p.QoS == 1 {
+			deliveryErr = c.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+		}
+	}
+	_, puback, err := c.Expect(0x40, timeout, func(header byte, body []byte) {
+		if header&0xF0 == 0x30 {
+			deliver(header, body)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(puback) < 2 || binary.BigEndian.Uint16(puback) != 2 {
+		return fmt.Errorf("PUBACK for the wrong packet identifier: % x", puback)
+	}
+	if len(puback) > 2 && puback[2] >= 0x80 {
+		return fmt.Errorf("PUBLISH refused with PUBACK reason code 0x%02x", puback[2])
+	}
+	for !received && deliveryErr == nil {
+		header, body, err := c.Expect(0x30, timeout, nil)
+		if err != nil {
+			return fmt.Errorf("message not delivered: %w", err)
+		}
+		deliver(header, body)
+	}
+	return deliveryErr
+}
+
+// TryTopic subscribes to topic and publishes a QoS 1 message to it at
+// protocol level on raw connections of their own, which send the topic byte
+// for byte. It returns how the broker refused the topic, in SUBACK, PUBACK
+// or by closing a connection, or nil when it delivered the message intact.
+// Either way both connections, or new ones in place of those the broker
+// closed, must carry messages normally afterwards; an error reports a broker
+// that misbehaved.
+func TryTopic(cfg Config, level byte, clientPrefix, topic string) ([]string, error) {
+	timeout := cfg.Scaled(5 * time.Second)
+	var refusals []string
+	closed := map[*RawConn]bool{}
+
+	sub, err := DialRaw(cfg, level, cfg.ClientID(clientPrefix+"-sub"))
+	if err != nil {
+		return nil, fmt.Errorf("subscriber connect failed: %w", err)
+	}
+	defer sub.Close()
+
+	subscribed := false
+	codes, err := sub.Subscribe(10, 1, timeout, topic)
+	switch {
+	case errors.Is(err, ErrBrokerClosed):
+		refusals = append(refusals, "SUBSCRIBE answered by closing the connection")
+		closed[sub] = true
+	case err != nil:
+		return nil, fmt.Errorf("subscribe failed: %w", err)
+	case len(codes) != 1:
+		return nil, fmt.Errorf("expected 1 SUBACK code, got % x", codes)
+	case codes[0] >= 0x80:
+		refusals = append(refusals, fmt.Sprintf("SUBSCRIBE refused with 0x%02x", codes[0]))
+	default:
+		subscribed = true
+	}
+
+	pub, err := DialRaw(cfg, level, cfg.ClientID(clientPrefix+"-pub"))
+	if err != nil {
+		return nil, fmt.Errorf("publisher connect failed: %w", err)
+	}
+	defer pub.Close()
+
+	published := false
+	reason, err := pub.PublishAcked(topic, 1, 11, []byte("try topic"), timeout)
+	switch {
+	case errors.Is(err, ErrBrokerClosed):
+		refusals = append(refusals, "PUBLISH answered by closing the connection")
+		closed[pub] = true
+	case err != nil:
+		return nil, fmt.Errorf("publish failed: %w", err)
+	case reason >= 0x80:
+		refusals = append(refusals, fmt.Sprintf("PUBLISH refused with 0x%02x", reason))
+	default:
+		published = true
+	}
+
+	if subscribed && published {
+		header, body, err := sub.Expect(0x30, timeout, nil)
+		if err != nil {
+			return nil, fmt.Errorf("broker accepted the subscription and the PUBLISH but did not deliver it: %w", err)
+		}
+		p, err := sub.ParsePublish(header, body)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("delivered PUBLISH unreadable: %w", err)
+		case p.Topic != topic:
+			return nil, fmt.Errorf("message delivered on topic %+q, expected %+q", truncate(p.Topic, 80), truncate(topic, 80))
+		}
+		sub.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+	}
+
+	// RoundTrip uses packet identifiers 1 and 2, apart from those above
+	after := cfg.Topic("test/try-topic/after")
+	for _, conn := range []*RawConn{sub, pub} {
+		if !closed[conn] {
+			if err := conn.RoundTrip(after, timeout); err != nil {
+				return nil, fmt.Errorf("connection no longer carries messages after the topic: %w", err)
+			}
+			continue
+		}
+		fresh, err := DialRaw(cfg, level, cfg.ClientID(clientPrefix+"-after"))
+		if err != nil {
+			return nil, fmt.Errorf("reconnect after the topic failed: %w", err)
+		}
+		defer fresh.Close()
+		if err := fresh.RoundTrip(after, timeout); err != nil {
+			return nil, fmt.Errorf("broker no longer carries messages after the topic: %w", err)
+		}
+	}
+	return refusals, nil
+}
+
+// PacketName returns the name of a packet type given as the first byte of a
+// fixed header
+func PacketName(header byte) string {
+	return packetTypes[header>>4]
+}
+
+// AwaitClose reads from conn until the broker closes it or timeout passes.
+// It returns the bytes the broker sent meanwhile and whether it closed the
+// connection.
+func AwaitClose(conn net.Conn, timeout time.Duration) ([]byte, bool) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	var data []byte
+	buf := make([]byte, 256)
+	for {
+		n, err := conn.Read(buf)
+		data = append(data, buf[:n]...)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return data, false
+			}
+			return data, true
+		}
+	}
+}
+
+// DisconnectReason returns the reason code of the DISCONNECT data starts
+// with, as AwaitClose returns it. ok is false when data does not start with
+// a DISCONNECT.
+func DisconnectReason(data []byte) (reason byte, ok bool) {
+	header, body, err := ReadRawPacket(bytes.NewReader(data))
+	if err != nil || header != 0xE0 {
+		return 0, false
+	}
+	if len(body) == 0 {
+		// A DISCONNECT without a reason code is a Normal disconnection
+		return 0, true
+	}
+	return body[0], true
+}
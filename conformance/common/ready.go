@@ -0,0 +1,87 @@
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WaitReady runs check until it succeeds, fails with an error waiting cannot
+// fix, or timeout has passed. Between attempts it backs off from 250ms up to
+// 2s and calls onRetry with the error of the failed attempt.
+func WaitReady(check func() error, timeout time.Duration, onRetry func(attempt int, err error)) error {
+	deadline := time.Now().Add(timeout)
+	backoff := 250 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		if !Transient(err) || time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+		time.Sleep(backoff)
+		backoff = min(2*backoff, 2*time.Second)
+	}
+}
+
+// Transient reports whether a connection error may go away by itself, e.g.
+// while the broker is still starting
+func Transient(err error) bool {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "timeout") || strings.Contains(msg, "server unavailable") || strings.Contains(msg, "connection reset")
+}
+
+// Diagnose explains a failed readiness check in terms of what to look at
+func Diagnose(broker string, err error) string {
+	var dnsErr *net.DNSError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var recordHeader tls.RecordHeaderError
+	var netErr net.Error
+	msg := strings.ToLower(err.Error())
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return fmt.Sprintf("The broker host in %s could not be resolved. Check the URL.", broker)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Sprintf("Nothing is listening at %s. Is the broker running, and on this port?", broker)
+	case errors.As(err, &unknownAuthority):
+		return "The broker's certificate is not signed by a trusted CA. Pass the CA with --tls-ca."
+	case errors.As(err, &hostname):
+		return "The broker's certificate does not match its host name. Set --tls-server-name or fix the URL."
+	case errors.As(err, &invalid):
+		return "The broker's certificate is invalid (expired or not valid for servers)."
+	case errors.As(err, &recordHeader):
+		return "The broker did not answer the TLS handshake. Is this a plain tcp:// port?"
+	case strings.Contains(msg, "not authori"), strings.Contains(msg, "bad user name or password"):
+		return "The broker rejected the credentials. Check --username and --password."
+	case strings.Contains(msg, "publish/subscribe"):
+		return "The broker accepts connections but did not deliver a test message to a subscriber. Check its ACLs for the topic namespace."
+	case errors.As(err, &netErr) && netErr.Timeout(), strings.Contains(msg, "timeout"):
+		return fmt.Sprintf("%s did not answer in time. Check the host, firewalls and --connect-timeout.", broker)
+	case errors.Is(err, io.EOF), errors.Is(err, syscall.ECONNRESET):
+		return "The broker closed the connection. Is this an MQTT port, and does it need TLS (ssl://)?"
+	}
+	return ""
+}
@@ -0,0 +1,195 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Redirect describes connection steering configured on the broker, for the
+// server redirection tests: a client the broker sends to another server with
+// reason code 0x9C Use another server or 0x9D Server moved. The tests are
+// skipped without a Username or ClientID to recognise that client by.
+type Redirect struct {
+	// Username, Password and ClientID are what the redirected client
+	// connects with; the suite's credentials and a generated client ID when
+	// empty
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	ClientID string `yaml:"client_id"`
+
+	// Follow makes the tests connect to the server the broker refers the
+	// client to and publish through it
+	Follow bool `yaml:"follow"`
+}
+
+// IsZero reports whether no redirected client is configured
+func (r Redirect) IsZero() bool {
+	return r.Username == "" && r.ClientID == ""
+}
+
+// SkipWithoutRedirect marks result as skipped when no redirected client is
+// configured. Tests call it right after building their result and return
+// early when it reports true.
+func SkipWithoutRedirect(cfg Config, result *TestResult) bool {
+	if !cfg.Redirect.IsZero() {
+		return false
+	}
+	result.Status = StatusSkipped
+	result.Notes = "no redirected client configured (--redirect-client-id or --redirect-username)"
+	return true
+}
+
+// Reason codes a broker redirects a client with [MQTT-4.11]
+const (
+	ReasonUseAnotherServer byte = 0x9C
+	ReasonServerMoved      byte = 0x9D
+)
+
+// Redirection is how a broker answered the redirected client
+type Redirection struct {
+	Packet    string // CONNACK, or DISCONNECT after a CONNACK accepting the client
+	Reason    byte   // Reason code of Packet, 0x00 when the client was not sent away
+	Reference string // Server Reference property, empty when the broker sent none
+	Closed    bool   // The broker closed the connection after Packet
+}
+
+// Redirected reports whether the broker sent the client to another server
+func (r Redirection) Redirected() bool {
+	return r.Reason == ReasonUseAnotherServer || r.Reason == ReasonServerMoved
+}
+
+// redirectClient returns the credentials and client ID of cfg.Redirect
+func (c Config) redirectClient() (clientID, username, password string) {
+	clientID, username, password = c.Redirect.ClientID, c.Redirect.Username, c.Redirect.Password
+	if clientID == "" {
+		clientID = c.ClientID("test-redirect")
+	}
+	if username == "" {
+		username, password = c.Username, c.Password
+	}
+	return clientID, username, password
+}
+
+// TryRedirect connects the redirected client at protocol level 5 and
+// reports how the broker sent it away: with a CONNACK refusing it, or with a
+// DISCONNECT soon after a CONNACK accepting it. The Redirection has a Reason
+// of 0x00 when the broker kept the client connected.
+func TryRedirect(cfg Config) (Redirection, error) {
+	var r Redirection
+	clientID, username, password := cfg.redirectClient()
+	conn, err := Dial(cfg)
+	if err != nil {
+		return r, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(cfg.Scaled(5 * time.Second)))
+	if _, err := conn.Write(RawConnect(5, clientID, username, password)); err != nil {
+		return r, fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+	header, body, err := ReadRawPacket(conn)
+	if err != nil {
+		return r, fmt.Errorf("no CONNACK: %w", err)
+	}
+	if header != 0x20 || len(body) < 2 {
+		return r, fmt.Errorf("expected CONNACK, got %s", PacketName(header))
+	}
+	r.Packet, r.Reason = "CONNACK", body[1]
+	props := &reader{b: body[2:]}
+	r.Reference = serverReference(props.properties())
+	if r.Reason >= 0x80 {
+		_, r.Closed = AwaitClose(conn, cfg.Scaled(2*time.Second))
+		return r, nil
+	}
+
+	// Accepted: a broker steering connections may still send the client
+	// away straight after
+	conn.SetDeadline(time.Now().Add(cfg.Scaled(2 * time.Second)))
+	header, body, err = ReadRawPacket(conn)
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return r, nil
+	case err != nil:
+		return r, fmt.Errorf("broker closed the connection after accepting it")
+	case header != 0xE0:
+		return r, nil
+	}
+	r.Packet, r.Reason, r.Reference = "DISCONNECT", 0, ""
+	if len(body) > 0 {
+		r.Reason = body[0]
+		props := &reader{b: body[1:]}
+		r.Reference = serverReference(props.properties())
+	}
+	_, r.Closed = AwaitClose(conn, cfg.Scaled(2*time.Second))
+	return r, nil
+}
+
+// serverReference returns the Server Reference among props
+func serverReference(props []Property) string {
+	for _, p := range props {
+		if p.Name == "Server Reference" {
+			s, _ := strconv.Unquote(p.Value)
+			return s
+		}
+	}
+	return ""
+}
+
+// ServerReferences parses a Server Reference into broker URLs with the
+// scheme of broker. The specification leaves its format open; the usual one,
+// which brokers doing connection steering send, is a space separated list of
+// host or host:port, optionally as a URL with a scheme of its own.
+func ServerReferences(reference, broker string) ([]string, error) {
+	base, err := url.Parse(broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker URL: %w", err)
+	}
+	fields := strings.Fields(reference)
+	if len(fields) == 0 {
+		return nil, errors.New("empty Server Reference")
+	}
+	var urls []string
+	for _, f := range fields {
+		u := &url.URL{Scheme: base.Scheme, Host: f}
+		if strings.Contains(f, "://") {
+			if u, err = url.Parse(f); err != nil {
+				return nil, fmt.Errorf("server reference %q: %w", f, err)
+			}
+		}
+		host, port := u.Hostname(), u.Port()
+		if host == "" || strings.ContainsAny(host, "/#+") || strings.Contains(host, ":") && !strings.HasPrefix(u.Host, "[") {
+			return nil, fmt.Errorf("server reference %q has no valid host", f)
+		}
+		if n, err := strconv.Atoi(port); port != "" && (err != nil || n < 1 || n > 65535) {
+			return nil, fmt.Errorf("server reference %q has an invalid port", f)
+		}
+		if u.Path != "" && u.Path != "/" && !strings.HasPrefix(u.Scheme, "ws") {
+			return nil, fmt.Errorf("server reference %q has a path", f)
+		}
+		urls = append(urls, u.String())
+	}
+	return urls, nil
+}
+
+// FollowRedirect connects the redirected client to reference, a broker URL
+// from ServerReferences, and checks a QoS 1 message round trip through it
+func FollowRedirect(cfg Config, reference string) error {
+	clientID, username, password := cfg.redirectClient()
+	cfg.Broker = reference
+	cfg.Username, cfg.Password = username, password
+	conn, err := DialRaw(cfg, 5, clientID)
+	if err != nil {
+		return fmt.Errorf("connect to %s failed: %w", reference, err)
+	}
+	defer conn.Close()
+	if err := conn.RoundTrip(cfg.Topic(GenerateTopicName("test/redirect")), cfg.Scaled(5*time.Second)); err != nil {
+		return fmt.Errorf("round trip through %s failed: %w", reference, err)
+	}
+	return nil
+}
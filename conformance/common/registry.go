@@ -0,0 +1,53 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+var registry = struct {
+	sync.Mutex
+	groups map[string][]TestGroup
+	names  map[string]bool
+}{
+	groups: make(map[string][]TestGroup),
+	names:  make(map[string]bool),
+}
+
+// RegisterGroup adds a custom test group, e.g. for vendor-specific ACL
+// behaviour, to the suite of a protocol version (spec.V311 or spec.V5). It
+// is meant to be called from an init function of a package linked into a
+// custom build of the CLI. The group runs after the built-in groups and is
+// reported as "<namespace>/<group name>" so its results cannot be mistaken
+// for built-in ones. It panics on an unknown version, an empty namespace or
+// a name registered twice.
+func RegisterGroup(version, namespace string, group TestGroup) {
+	if version != spec.V311 && version != spec.V5 {
+		panic(fmt.Sprintf("RegisterGroup: unknown protocol version %q", version))
+	}
+	namespace = strings.Trim(namespace, "/")
+	if namespace == "" {
+		panic("RegisterGroup: namespace is required")
+	}
+	group.Name = namespace + "/" + group.Name
+
+	registry.Lock()
+	defer registry.Unlock()
+	key := version + "\x00" + group.Name
+	if registry.names[key] {
+		panic(fmt.Sprintf("RegisterGroup: group %q registered twice for %s", group.Name, version))
+	}
+	registry.names[key] = true
+	registry.groups[version] = append(registry.groups[version], group)
+}
+
+// RegisteredGroups returns the custom groups registered for a protocol
+// version, in registration order
+func RegisteredGroups(version string) []TestGroup {
+	registry.Lock()
+	defer registry.Unlock()
+	return append([]TestGroup(nil), registry.groups[version]...)
+}
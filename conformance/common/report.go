@@ -0,0 +1,162 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// Report is the outcome of running a suite against one broker
+type Report struct {
+	Title     string   `json:"title"`
+	Spec      string   `json:"spec"`
+	Broker    string   `json:"broker"`
+	Namespace string   `json:"namespace,omitempty"` // Topic namespace the tests used
+	Sessions  []string `json:"sessions,omitempty"`  // Client IDs of persistent sessions the tests created
+	Seed      *uint64  `json:"seed,omitempty"`      // Seed of the test order when it was shuffled
+
+	RTT              time.Duration `json:"rtt,omitempty"`               // Broker round trip time measured before the run
+	TimingMultiplier float64       `json:"timing_multiplier,omitempty"` // Scale applied to the tests' waits
+	Started          time.Time     `json:"started"`
+	Duration         time.Duration `json:"duration"`
+	Capabilities     *Capabilities `json:"capabilities,omitempty"`
+	Results          []TestResult  `json:"results"`
+}
+
+// FailedError is returned when tests failed, as opposed to the run itself
+// going wrong
+type FailedError struct {
+	Failed int
+}
+
+func (e *FailedError) Error() string {
+	return fmt.Sprintf("%d test(s) failed", e.Failed)
+}
+
+// Counts returns the number of results with each status
+func (r *Report) Counts() map[Status]int {
+	counts := make(map[Status]int)
+	for _, result := range r.Results {
+		counts[result.Status]++
+	}
+	return counts
+}
+
+// PassedOnRetry returns the number of tests that only passed after a retry
+func (r *Report) PassedOnRetry() int {
+	n := 0
+	for _, result := range r.Results {
+		if result.PassedOnRetry() {
+			n++
+		}
+	}
+	return n
+}
+
+// Score returns the compliance score of the run weighted by normative level
+func (r *Report) Score() Score {
+	var score Score
+	for _, result := range r.Results {
+		score.Add(result)
+	}
+	return score
+}
+
+// WriteReport saves a report as JSON
+func WriteReport(path string, r *Report) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ReadReport loads a report saved by WriteReport
+func ReadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// testResultJSON is the serialized form of a TestResult, with the error
+// flattened to its message
+type testResultJSON struct {
+	Group    string        `json:"group"`
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Notes    string        `json:"notes,omitempty"`
+	Started  time.Time     `json:"started,omitzero"`
+	Duration time.Duration `json:"duration"`
+	SpecRef  string        `json:"spec_ref,omitempty"`
+	Level    string        `json:"level,omitempty"`
+	Packets  []Packet      `json:"packets,omitempty"`
+	Expected string        `json:"expected,omitempty"`
+	Actual   string        `json:"actual,omitempty"`
+	Attempts []Attempt     `json:"attempts,omitempty"`
+	Source   string        `json:"source,omitempty"`
+	Leak     *Leak         `json:"leak,omitempty"`
+	Timings  Timings       `json:"timings,omitzero"`
+}
+
+func (t TestResult) MarshalJSON() ([]byte, error) {
+	out := testResultJSON{
+		Group:    t.Group,
+		Name:     t.Name,
+		Status:   t.Status,
+		Notes:    t.Notes,
+		Started:  t.Started,
+		Duration: t.Duration,
+		SpecRef:  t.SpecRef,
+		Level:    t.Level.String(),
+		Packets:  t.Packets,
+		Expected: t.Expected,
+		Actual:   t.Actual,
+		Attempts: t.Attempts,
+		Source:   t.Source,
+		Leak:     t.Leak,
+		Timings:  t.Timings,
+	}
+	if t.Error != nil {
+		out.Error = t.Error.Error()
+	}
+	return json.Marshal(out)
+}
+
+func (t *TestResult) UnmarshalJSON(data []byte) error {
+	var in testResultJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*t = TestResult{
+		Group:    in.Group,
+		Name:     in.Name,
+		Status:   in.Status,
+		Notes:    in.Notes,
+		Started:  in.Started,
+		Duration: in.Duration,
+		SpecRef:  in.SpecRef,
+		Level:    spec.ParseLevel(in.Level),
+		Packets:  in.Packets,
+		Expected: in.Expected,
+		Actual:   in.Actual,
+		Attempts: in.Attempts,
+		Source:   in.Source,
+		Leak:     in.Leak,
+		Timings:  in.Timings,
+	}
+	if in.Error != "" {
+		t.Error = errors.New(in.Error)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package common
+
+// SelectTests returns groups with only the tests keep accepts. Groups left
+// without tests are dropped. Tests are identified by the names
+// CollectTestRefs reports, so they are each run once against a listener
+// that hangs up.
+func SelectTests(groups []TestGroup, keep func(TestRef) bool) ([]TestGroup, error) {
+	refs, err := CollectTestRefs(groups)
+	if err != nil {
+		return nil, err
+	}
+	return FilterTests(groups, refs, keep), nil
+}
+
+// FilterTests is SelectTests with the refs CollectTestRefs returned for
+// groups
+func FilterTests(groups []TestGroup, refs []TestRef, keep func(TestRef) bool) []TestGroup {
+	var selected []TestGroup
+	i := 0
+	for _, group := range groups {
+		g := group
+		g.Tests = nil
+		for _, testFunc := range group.Tests {
+			if keep(refs[i]) {
+				g.Tests = append(g.Tests, testFunc)
+			}
+			i++
+		}
+		if len(g.Tests) > 0 {
+			selected = append(selected, g)
+		}
+	}
+	return selected
+}
+
+// TestID identifies a test across runs
+type TestID struct {
+	Group string
+	Name  string
+}
+
+// FailedTests returns the tests that failed in the report
+func (r *Report) FailedTests() map[TestID]bool {
+	failed := make(map[TestID]bool)
+	for _, result := range r.Results {
+		if result.Status == StatusFailed {
+			failed[TestID{result.Group, result.Name}] = true
+		}
+	}
+	return failed
+}
+
+// MergeReports returns the report of a run that repeated some of the tests
+// of prior, with the results of prior for the tests it did not repeat. The
+// results keep the order of prior.
+func MergeReports(prior, rerun *Report) *Report {
+	fresh := make(map[TestID]TestResult, len(rerun.Results))
+	for _, result := range rerun.Results {
+		fresh[TestID{result.Group, result.Name}] = result
+	}
+
+	merged := *rerun
+	merged.Results = nil
+	for _, result := range prior.Results {
+		k := TestID{result.Group, result.Name}
+		if r, ok := fresh[k]; ok {
+			result = r
+			delete(fresh, k)
+		}
+		merged.Results = append(merged.Results, result)
+	}
+	// Tests added since the prior run go last
+	for _, result := range rerun.Results {
+		if _, ok := fresh[TestID{result.Group, result.Name}]; ok {
+			merged.Results = append(merged.Results, result)
+		}
+	}
+	return &merged
+}
@@ -0,0 +1,255 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// SkipWithoutRestart marks result as skipped when the suite cannot restart
+// the broker. Tests call it right after building their result and return
+// early when it reports true.
+func SkipWithoutRestart(cfg Config, result *TestResult) bool {
+	if cfg.RestartBroker != nil {
+		return false
+	}
+	result.Status = StatusSkipped
+	result.Notes = "broker not controlled by the suite (--docker-broker)"
+	return true
+}
+
+// restart restarts the broker and reports how long it took
+func restart(cfg Config) (time.Duration, error) {
+	start := time.Now()
+	if err := cfg.RestartBroker(); err != nil {
+		return 0, fmt.Errorf("broker restart failed: %w", err)
+	}
+	return time.Since(start), nil
+}
+
+// collectPublishes reads the PUBLISHes on conn until none arrives for
+// quiet and returns their payloads. QoS 1 messages are acknowledged and
+// QoS 2 messages go through PUBREC, PUBREL and PUBCOMP.
+func collectPublishes(conn *RawConn, quiet time.Duration) ([][]byte, error) {
+	var payloads [][]byte
+	for {
+		conn.SetReadDeadline(time.Now().Add(quiet))
+		header, body, err := ReadRawPacket(conn)
+		if err != nil {
+			conn.SetReadDeadline(time.Time{})
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return payloads, nil
+			}
+			return payloads, err
+		}
+		switch header & 0xF0 {
+		case 0x30:
+			p, err := conn.ParsePublish(header, body)
+			if err != nil {
+				return payloads, err
+			}
+			payloads = append(payloads, p.Payload)
+			switch p.QoS {
+			case 1:
+				conn.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+			case 2:
+				conn.Send(0x50, binary.BigEndian.AppendUint16(nil, p.PacketID))
+			}
+		case 0x60:
+			conn.Send(0x70, body[:min(2, len(body))])
+		}
+	}
+}
+
+// countPayload returns how many of payloads equal payload
+func countPayload(payloads [][]byte, payload []byte) int {
+	n := 0
+	for _, p := range payloads {
+		if bytes.Equal(p, payload) {
+			n++
+		}
+	}
+	return n
+}
+
+// CheckRestartSession creates a persistent session with a QoS 1
+// subscription, disconnects, has a QoS 1 message queued for it and restarts
+// the broker. Reconnecting must find the session present, receive the
+// queued message and still be subscribed.
+func CheckRestartSession(cfg Config, level byte) (string, error) {
+	clientID := cfg.ClientID("test-restart-session")
+	topic := cfg.Topic("test/restart/session")
+
+	conn, _, err := dialPersistent(cfg, level, clientID)
+	if err != nil {
+		return "", err
+	}
+	codes, err := conn.Subscribe(1, 1, cfg.Scaled(5*time.Second), topic)
+	if err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		conn.Close()
+		return "", fmt.Errorf("subscribe failed: %v % x", err, codes)
+	}
+	conn.Send(0xE0, nil)
+	conn.Close()
+
+	queued := []byte(GenerateClientID("queued"))
+	if err := publishOn(cfg, level, topic, queued); err != nil {
+		return "", err
+	}
+	took, err := restart(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	conn, present, err := dialPersistent(cfg, level, clientID)
+	if err != nil {
+		return "", fmt.Errorf("reconnect after the restart: %w", err)
+	}
+	defer conn.Close()
+	if !present {
+		return "", fmt.Errorf("CONNACK after the restart has Session Present 0, the session was lost")
+	}
+	got, err := collectPublishes(conn, cfg.Scaled(time.Second))
+	if err != nil {
+		return "", err
+	}
+	if countPayload(got, queued) == 0 {
+		return "", fmt.Errorf("QoS 1 message queued for the session before the restart not delivered")
+	}
+
+	live := []byte(GenerateClientID("live"))
+	if err := publishOn(cfg, level, topic, live); err != nil {
+		return "", err
+	}
+	got, err = collectPublishes(conn, cfg.Scaled(time.Second))
+	if err != nil {
+		return "", err
+	}
+	if countPayload(got, live) == 0 {
+		return "", fmt.Errorf("subscription of the session lost in the restart")
+	}
+	conn.Send(0xE0, nil)
+	return fmt.Sprintf("restart took %v", took.Round(100*time.Millisecond)), nil
+}
+
+// CheckRestartRetained publishes a retained message, restarts the broker
+// and checks a new subscriber receives it. The message is cleared
+// afterwards.
+func CheckRestartRetained(cfg Config, level byte) (string, error) {
+	topic := cfg.Topic("test/restart/retained")
+	payload := []byte(GenerateClientID("retained"))
+	if err := publishRetainedOn(cfg, level, topic, payload); err != nil {
+		return "", err
+	}
+	defer publishRetainedOn(cfg, level, topic, nil)
+
+	took, err := restart(cfg)
+	if err != nil {
+		return "", err
+	}
+	conn, err := subscribeOn(cfg, level, "test-restart-retained", topic)
+	if err != nil {
+		return "", fmt.Errorf("after the restart: %w", err)
+	}
+	defer conn.Close()
+	m, header, err := nextPublish(conn, cfg.Scaled(5*time.Second))
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("retained message lost in the restart: %w", err)
+	case !bytes.Equal(m.Payload, payload):
+		return "", fmt.Errorf("retained message after the restart is %q, expected %q", m.Payload, payload)
+	case header&0x01 == 0:
+		return "", fmt.Errorf("retained message delivered after the restart without the retain flag")
+	}
+	return fmt.Sprintf("restart took %v", took.Round(100*time.Millisecond)), nil
+}
+
+// CheckRestartQoS2 leaves a QoS 2 PUBLISH from a persistent session
+// unreleased, after its PUBREC, for an offline persistent subscriber, and
+// restarts the broker. The publisher's PUBREL must then be answered with a
+// PUBCOMP and the subscriber must receive the message exactly once.
+func CheckRestartQoS2(cfg Config, level byte) (string, error) {
+	subID := cfg.ClientID("test-restart-qos2-sub")
+	pubID := cfg.ClientID("test-restart-qos2-pub")
+	topic := cfg.Topic("test/restart/qos2")
+
+	sub, _, err := dialPersistent(cfg, level, subID)
+	if err != nil {
+		return "", err
+	}
+	codes, err := sub.Subscribe(1, 2, cfg.Scaled(5*time.Second), topic)
+	if err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		sub.Close()
+		return "", fmt.Errorf("subscribe failed: %v % x", err, codes)
+	}
+	sub.Send(0xE0, nil)
+	sub.Close()
+
+	pub, _, err := dialPersistent(cfg, level, pubID)
+	if err != nil {
+		return "", err
+	}
+	payload := []byte(GenerateClientID("qos2"))
+	const packetID = 7
+	if err := pub.Publish(topic, 2, packetID, payload); err != nil {
+		pub.Close()
+		return "", fmt.Errorf("failed to send PUBLISH: %w", err)
+	}
+	if _, _, err := pub.Expect(0x50, cfg.Scaled(5*time.Second), nil); err != nil {
+		pub.Close()
+		return "", fmt.Errorf("no PUBREC before the restart: %w", err)
+	}
+	pub.Close()
+
+	took, err := restart(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	pub, present, err := dialPersistent(cfg, level, pubID)
+	if err != nil {
+		return "", fmt.Errorf("publisher reconnect after the restart: %w", err)
+	}
+	defer pub.Close()
+	if !present {
+		return "", fmt.Errorf("publisher's CONNACK after the restart has Session Present 0, its session with the unreleased QoS 2 message was lost")
+	}
+	pubrel := binary.BigEndian.AppendUint16(nil, packetID)
+	if err := pub.Send(0x62, pubrel); err != nil {
+		return "", fmt.Errorf("failed to send PUBREL: %w", err)
+	}
+	_, body, err := pub.Expect(0x70, cfg.Scaled(5*time.Second), nil)
+	if err != nil {
+		return "", fmt.Errorf("PUBREL after the restart not completed: %w", err)
+	}
+	if len(body) > 2 && body[2] >= 0x80 {
+		return "", fmt.Errorf("PUBCOMP after the restart has reason code 0x%02x, the packet identifier was forgotten", body[2])
+	}
+	pub.Send(0xE0, nil)
+
+	sub, present, err = dialPersistent(cfg, level, subID)
+	if err != nil {
+		return "", fmt.Errorf("subscriber reconnect after the restart: %w", err)
+	}
+	defer sub.Close()
+	if !present {
+		return "", fmt.Errorf("subscriber's CONNACK after the restart has Session Present 0, the session was lost")
+	}
+	got, err := collectPublishes(sub, cfg.Scaled(time.Second))
+	if err != nil {
+		return "", err
+	}
+	switch n := countPayload(got, payload); n {
+	case 0:
+		return "", fmt.Errorf("QoS 2 message in flight across the restart never reached the subscriber")
+	case 1:
+	default:
+		return "", fmt.Errorf("QoS 2 message in flight across the restart delivered %d times", n)
+	}
+	sub.Send(0xE0, nil)
+	return fmt.Sprintf("restart took %v", took.Round(100*time.Millisecond)), nil
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// CheckQoS2Resumed leaves a QoS 2 PUBLISH from a persistent session
+// received but unreleased, after its PUBREC, by dropping the publisher's
+// connection, then reconnects the session and resends the PUBREL with the
+// original Packet Identifier [MQTT-4.4.0-1]. The broker must complete it
+// with a PUBCOMP for that identifier rather than forget it or treat it as a
+// protocol error, keep the connection usable, and deliver the message to a
+// subscriber exactly once.
+func CheckQoS2Resumed(cfg Config, level byte) (string, error) {
+	pubID := cfg.ClientID("test-resume-qos2-pub")
+	topic := cfg.Topic(GenerateTopicName("test/resume/qos2"))
+	timeout := cfg.Scaled(5 * time.Second)
+
+	sub, err := DialRaw(cfg, level, cfg.ClientID("test-resume-qos2-sub"))
+	if err != nil {
+		return "", fmt.Errorf("subscriber connect failed: %w", err)
+	}
+	defer sub.Close()
+	if codes, err := sub.Subscribe(1, 2, timeout, topic); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		return "", fmt.Errorf("subscribe failed: %v % x", err, codes)
+	}
+
+	pub, _, err := dialPersistent(cfg, level, pubID)
+	if err != nil {
+		return "", err
+	}
+	payload := []byte(GenerateClientID("qos2"))
+	const packetID = 0x1234
+	if err := pub.Publish(topic, 2, packetID, payload); err != nil {
+		pub.Close()
+		return "", fmt.Errorf("failed to send PUBLISH: %w", err)
+	}
+	_, rec, err := pub.Expect(0x50, timeout, nil)
+	if err != nil {
+		pub.Close()
+		return "", fmt.Errorf("no PUBREC: %w", err)
+	}
+	if len(rec) > 2 && rec[2] >= 0x80 {
+		pub.Close()
+		return "", fmt.Errorf("PUBLISH refused with PUBREC reason code 0x%02x", rec[2])
+	}
+	// Drop the connection without a DISCONNECT, as a client losing its
+	// network would
+	pub.Close()
+
+	pub, present, err := dialPersistent(cfg, level, pubID)
+	if err != nil {
+		return "", fmt.Errorf("publisher reconnect failed: %w", err)
+	}
+	defer pub.Close()
+	if !present {
+		return "", fmt.Errorf("publisher's CONNACK on reconnecting has Session Present 0, its session with the unreleased QoS 2 message was lost")
+	}
+	pubrel := binary.BigEndian.AppendUint16(nil, packetID)
+	if err := pub.Send(0x62, pubrel); err != nil {
+		return "", fmt.Errorf("failed to send PUBREL: %w", err)
+	}
+	_, body, err := pub.Expect(0x70, timeout, nil)
+	if err != nil {
+		return "", fmt.Errorf("resumed PUBREL not completed: %w", err)
+	}
+	if len(body) < 2 || binary.BigEndian.Uint16(body) != packetID {
+		return "", fmt.Errorf("PUBCOMP for packet identifier % x, expected the original 0x%04x", body[:min(2, len(body))], packetID)
+	}
+	if len(body) > 2 && body[2] >= 0x80 {
+		return "", fmt.Errorf("PUBCOMP for the resumed PUBREL has reason code 0x%02x, the packet identifier was forgotten", body[2])
+	}
+	if err := pub.RoundTrip(cfg.Topic(GenerateTopicName("test/resume/after")), timeout); err != nil {
+		return "", fmt.Errorf("connection unusable after the resumed PUBREL: %w", err)
+	}
+	pub.Send(0xE0, nil)
+
+	got, err := collectPublishes(sub, cfg.Scaled(time.Second))
+	if err != nil {
+		return "", err
+	}
+	switch n := countPayload(got, payload); n {
+	case 0:
+		return "", fmt.Errorf("QoS 2 message released on the resumed session never reached the subscriber")
+	case 1:
+	default:
+		return "", fmt.Errorf("QoS 2 message released on the resumed session delivered %d times", n)
+	}
+	return fmt.Sprintf("PUBREL for packet identifier 0x%04x completed on the resumed session", packetID), nil
+}
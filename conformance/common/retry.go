@@ -0,0 +1,68 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// Attempt is one run of a test that was retried
+type Attempt struct {
+	Status   Status        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Started  time.Time     `json:"started,omitzero"`
+	Duration time.Duration `json:"duration"`
+}
+
+// RetryTest runs a test, and runs it again after Config.RetryBackoff for as
+// long as it fails, up to Config.Retries more times. Each attempt gets its
+// own topic namespace below the run's, so messages retained by a failed
+// attempt cannot leak into the next. The last attempt's result is returned;
+// when there was more than one, all of them are listed in its Attempts.
+func RetryTest(cfg Config, run func(cfg Config, attempt int) TestResult) TestResult {
+	var attempts []Attempt
+	for attempt := 1; ; attempt++ {
+		attemptCfg := cfg
+		if attempt > 1 {
+			attemptCfg.TopicNamespace = cfg.Topic(fmt.Sprintf("retry%d", attempt-1))
+		}
+
+		started := time.Now()
+		result := run(attemptCfg, attempt)
+		if result.Started.IsZero() {
+			result.Started = started
+		}
+		a := Attempt{Status: result.Status, Started: result.Started, Duration: result.Duration}
+		if result.Error != nil {
+			a.Error = result.Error.Error()
+		}
+		attempts = append(attempts, a)
+
+		if result.Status != StatusFailed || attempt > cfg.Retries {
+			if len(attempts) > 1 {
+				result.Attempts = attempts
+			}
+			return result
+		}
+		cfg.Log().Info("retrying failed test", "group", result.Group, "test", result.Name, "attempt", attempt+1, "backoff", cfg.RetryBackoff)
+		time.Sleep(cfg.RetryBackoff)
+	}
+}
+
+// PassedOnRetry reports whether the test failed at first but passed on a
+// later attempt
+func (t TestResult) PassedOnRetry() bool {
+	return len(t.Attempts) > 1 && t.Status != StatusFailed
+}
+
+// AttemptSummary describes the attempts of a retried test, e.g. "PASS on
+// attempt 2", or "" for a test that ran once
+func (t TestResult) AttemptSummary() string {
+	n := len(t.Attempts)
+	switch {
+	case n <= 1:
+		return ""
+	case t.Status == StatusFailed:
+		return fmt.Sprintf("failed all %d attempts", n)
+	}
+	return fmt.Sprintf("%s on attempt %d", t.Status, n)
+}
@@ -0,0 +1,493 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// Suite is a conformance test suite for one protocol version
+type Suite struct {
+	Title  string
+	Spec   string // Specification version the SpecRefs point into, e.g. spec.V5
+	Groups []TestGroup
+
+	// Cleanup removes what the tests left on the broker, see CleanupFunc
+	Cleanup CleanupFunc
+
+	// Preflight verifies the broker is reachable and accepts our credentials.
+	// It may fill in cfg, e.g. with the broker's Capabilities.
+	Preflight func(cfg *Config) error
+
+	// PubSubCheck verifies a message published to the broker reaches a
+	// subscriber. It runs once Preflight succeeded.
+	PubSubCheck func(cfg Config) error
+}
+
+// RunSuite executes the test groups matching filter, prints the results and
+// returns them as a Report. Only failed tests make it return an error;
+// skipped, warning and inconclusive results are reported but do not fail the
+// run. The report is nil if the preflight check fails.
+func RunSuite(suite Suite, cfg Config, filter string, verbose bool) (*Report, error) {
+	report := &Report{
+		Title:   suite.Title,
+		Spec:    suite.Spec,
+		Broker:  cfg.Broker,
+		Started: time.Now(),
+	}
+
+	if cfg.TopicNamespace == "" {
+		cfg.TopicNamespace = NewTopicNamespace()
+	}
+	report.Namespace = cfg.TopicNamespace
+	cfg.Sessions = NewSessionLog()
+
+	log := cfg.Log()
+	out := cfg.Out()
+	log.Info("starting suite", "suite", suite.Title, "broker", cfg.Broker, "namespace", cfg.TopicNamespace)
+
+	fmt.Fprintf(out, "\n%s\n", TitleStyle.Render(suite.Title))
+	fmt.Fprintf(out, "%s\n", SubtitleStyle.Render(fmt.Sprintf("Broker: %s", cfg.Broker)))
+	fmt.Fprintf(out, "%s\n", SubtitleStyle.Render(fmt.Sprintf("Topic namespace: %s", cfg.TopicNamespace)))
+	groups := suite.Groups
+	if cfg.Shuffle {
+		groups = ShuffleGroups(groups, cfg.Seed)
+		report.Seed = &cfg.Seed
+		fmt.Fprintf(out, "%s\n", SubtitleStyle.Render(fmt.Sprintf("Shuffled with seed %d", cfg.Seed)))
+		log.Info("shuffled test order", "seed", cfg.Seed)
+	}
+	if verbose {
+		fmt.Fprintf(out, "%s\n", SubtitleStyle.Render("Verbose mode: ON"))
+	}
+	fmt.Fprintln(out)
+
+	// Wait for the broker to come up, then check it delivers messages, so an
+	// unusable broker fails once rather than in every test
+	if suite.Preflight != nil {
+		fmt.Fprintf(out, "%s", SubtitleStyle.Render("Checking broker connection... "))
+		err := WaitReady(func() error { return suite.Preflight(&cfg) }, cfg.ReadyTimeout, func(attempt int, err error) {
+			fmt.Fprintf(out, "%s", SubtitleStyle.Render("."))
+			log.Info("broker not ready", "attempt", attempt, "error", err)
+		})
+		if err != nil {
+			return nil, notReady("preflight check failed", cfg, err)
+		}
+		fmt.Fprintf(out, "%s\n", PassStyle.Render("OK"))
+	}
+	if suite.PubSubCheck != nil {
+		fmt.Fprintf(out, "%s", SubtitleStyle.Render("Checking publish/subscribe... "))
+		if err := suite.PubSubCheck(cfg); err != nil {
+			return nil, notReady("publish/subscribe check failed", cfg, err)
+		}
+		fmt.Fprintf(out, "%s\n", PassStyle.Render("OK"))
+	}
+	report.Capabilities = cfg.Capabilities
+
+	if cfg.TimingMultiplier <= 0 {
+		fmt.Fprintf(out, "%s", SubtitleStyle.Render("Calibrating timing... "))
+		multiplier, rtt, err := CalibrateTiming(cfg)
+		if err != nil {
+			fmt.Fprintf(out, "%s\n", WarnStyle.Render("FAILED, using unscaled waits: "+err.Error()))
+			log.Warn("timing calibration failed", "error", err)
+		} else {
+			fmt.Fprintf(out, "%s\n", PassStyle.Render(fmt.Sprintf("round trip %v, waits ×%.1f", rtt.Round(time.Microsecond), multiplier)))
+		}
+		cfg.TimingMultiplier = multiplier
+		report.RTT = rtt
+	} else {
+		fmt.Fprintf(out, "%s\n", SubtitleStyle.Render(fmt.Sprintf("Waits scaled ×%.1f", cfg.TimingMultiplier)))
+	}
+	report.TimingMultiplier = cfg.TimingMultiplier
+	log.Debug("timing", "rtt", report.RTT, "multiplier", cfg.TimingMultiplier)
+	if cfg.Capabilities != nil {
+		log.Debug("broker capabilities", "capabilities", fmt.Sprintf("%+v", *cfg.Capabilities))
+	}
+
+	// Tests that depend on optional features the broker does not offer are
+	// skipped rather than failed
+	if missing := cfg.Capabilities.Unsupported(); len(missing) > 0 {
+		names := make([]string, len(missing))
+		for i, f := range missing {
+			names[i] = f.String()
+		}
+		fmt.Fprintf(out, "%s\n", SubtitleStyle.Render(fmt.Sprintf("Not supported by broker (tests will be skipped): %s", strings.Join(names, ", "))))
+	}
+
+	var failedResults []TestResult
+
+	selected := slices.DeleteFunc(slices.Clone(groups), func(group TestGroup) bool {
+		return !ShouldRunGroup(group.Name, filter) || !group.HasAnyTag(cfg.Tags)
+	})
+	progress := Progress{}
+	for _, group := range selected {
+		progress.Total += len(group.Tests)
+	}
+	var status *statusLine
+	var estimates []time.Duration
+	if cfg.Progress {
+		status = newStatusLine(out)
+		out = status
+		estimates = cfg.Durations.estimates(selected)
+	}
+	testsStarted := time.Now()
+
+	for _, group := range selected {
+		fmt.Fprintf(out, "\n%s\n", GroupStyle.Render(group.Name))
+
+		groupCfg := cfg
+		var setupErr error
+		if group.Setup != nil {
+			if setupErr = group.Setup(&groupCfg); setupErr != nil {
+				log.Warn("group setup failed", "group", group.Name, "error", setupErr)
+			}
+		}
+
+		for _, testFunc := range group.Tests {
+			progress.Group, progress.Result = group.Name, nil
+			if cfg.OnProgress != nil {
+				cfg.OnProgress(progress)
+			}
+			var result TestResult
+			if setupErr != nil {
+				result = group.SetupFailed(testFunc, setupErr)
+				result.Group = group.Name
+				result.Source = testSource(testFunc)
+			} else {
+				result = RetryTest(groupCfg, func(cfg Config, attempt int) TestResult {
+					return runTest(suite, group, testFunc, cfg, attempt)
+				})
+			}
+			report.Results = append(report.Results, result)
+			progress.Done++
+			progress.Result = &result
+			if cfg.OnProgress != nil {
+				cfg.OnProgress(progress)
+			}
+			if result.Status == StatusFailed {
+				failedResults = append(failedResults, result)
+			}
+
+			specRef := ""
+			if result.SpecRef != "" {
+				specRef = fmt.Sprintf(" [%s %s]", result.SpecRef, result.Level)
+			}
+
+			attempts := ""
+			if summary := result.AttemptSummary(); summary != "" {
+				attempts = " " + WarnStyle.Render(summary)
+			}
+
+			fmt.Fprintf(out, "  %s %s%s (%v)%s\n", StatusLabel(result.Status), result.Name, specRef, result.Duration, attempts)
+			if result.Notes != "" && (result.Status != StatusPassed || verbose) {
+				fmt.Fprintf(out, "      %s\n", DetailStyle.Render(result.Notes))
+			}
+			if cfg.PrintTrace {
+				printTrace(out, result)
+			}
+			if status != nil {
+				status.Set(progressStatus(progress, report.Counts(), time.Since(testsStarted), estimates))
+			}
+		}
+
+		// Tests that left connections open are reported once the group is
+		// done; their connections were closed when each test returned
+		for _, result := range report.Results[len(report.Results)-len(group.Tests):] {
+			if result.Leak != nil {
+				fmt.Fprintf(out, "  %s\n", WarnStyle.Render(fmt.Sprintf("Leaked by %s: %s", result.Name, result.Leak)))
+			}
+		}
+
+		if group.Teardown != nil && setupErr == nil {
+			if err := group.Teardown(groupCfg); err != nil {
+				fmt.Fprintf(out, "  %s\n", WarnStyle.Render("Teardown failed: "+err.Error()))
+				log.Warn("group teardown failed", "group", group.Name, "error", err)
+			}
+		}
+	}
+
+	if status != nil {
+		status.clear()
+	}
+
+	report.Sessions = cfg.Sessions.ClientIDs()
+	if suite.Cleanup != nil && !cfg.SkipCleanup {
+		runCleanup(suite.Cleanup, cfg, report.Sessions)
+	}
+
+	// Detailed failure report first (if verbose and failures exist)
+	if verbose && len(failedResults) > 0 {
+		fmt.Fprintf(out, "\n%s\n", FailStyle.Render("═══ Detailed Failure Report ═══"))
+		for i, result := range failedResults {
+			fmt.Fprintf(out, "\n%s\n", FailStyle.Render(fmt.Sprintf("Failure #%d: %s", i+1, result.Name)))
+			fmt.Fprintf(out, "  Spec Reference: %s (%s)\n", result.SpecRef, result.Level)
+			fmt.Fprintf(out, "  Duration: %v\n", result.Duration)
+			fmt.Fprintf(out, "  Error: %v\n", result.Error)
+			if summary := result.AttemptSummary(); summary != "" {
+				fmt.Fprintf(out, "  Attempts: %s\n", summary)
+			}
+			if result.Notes != "" {
+				fmt.Fprintf(out, "  Notes: %s\n", result.Notes)
+			}
+		}
+	}
+
+	// The slowest tests first, to show where the run's time goes
+	if verbose && len(report.Results) > 0 {
+		fmt.Fprintf(out, "\n%s\n", SummaryStyle.Render("Slowest Tests"))
+		for _, result := range report.Slowest(SlowestShown) {
+			phases := ""
+			if t := result.Timings.String(); t != "" {
+				phases = " " + DetailStyle.Render("("+t+")")
+			}
+			fmt.Fprintf(out, "  %8v  %s%s\n", result.Duration.Round(time.Millisecond), result.Name, phases)
+		}
+	}
+
+	report.Duration = time.Since(report.Started)
+	counts := report.Counts()
+	score := report.Score()
+
+	// Summary
+	fmt.Fprintf(out, "\n%s\n", SummaryStyle.Render("Summary"))
+	fmt.Fprintf(out, "  Total:  %d\n", len(report.Results))
+	fmt.Fprintf(out, "  Passed: %s\n", PassStyle.Render(fmt.Sprintf("%d", counts[StatusPassed])))
+	if n := counts[StatusFailed]; n > 0 {
+		fmt.Fprintf(out, "  Failed: %s\n", FailStyle.Render(fmt.Sprintf("%d", n)))
+	}
+	if n := counts[StatusWarning]; n > 0 {
+		fmt.Fprintf(out, "  Warnings: %s\n", WarnStyle.Render(fmt.Sprintf("%d", n)))
+	}
+	if n := counts[StatusInconclusive]; n > 0 {
+		fmt.Fprintf(out, "  Inconclusive: %s\n", InconclusiveStyle.Render(fmt.Sprintf("%d", n)))
+	}
+	if n := counts[StatusSkipped]; n > 0 {
+		fmt.Fprintf(out, "  Skipped: %s\n", SkipStyle.Render(fmt.Sprintf("%d", n)))
+	}
+	if n := report.PassedOnRetry(); n > 0 {
+		fmt.Fprintf(out, "  Passed on retry: %s\n", WarnStyle.Render(fmt.Sprintf("%d", n)))
+	}
+
+	// Compliance is weighted by normative level so a broken MUST costs more
+	// than a missed SHOULD
+	fmt.Fprintf(out, "\n%s\n", SummaryStyle.Render("Compliance"))
+	if score.Total > 0 {
+		fmt.Fprintf(out, "  Weighted score: %.1f%%\n", score.Percent())
+	} else {
+		fmt.Fprintf(out, "  Weighted score: n/a\n")
+	}
+	mustStyle := PassStyle
+	if score.Failed[spec.LevelMust] > 0 {
+		mustStyle = FailStyle
+	}
+	fmt.Fprintf(out, "  MUST failures:   %s\n", mustStyle.Render(fmt.Sprintf("%d", score.Failed[spec.LevelMust])))
+	fmt.Fprintf(out, "  SHOULD failures: %d\n", score.Failed[spec.LevelShould])
+	fmt.Fprintf(out, "  MAY failures:    %d\n", score.Failed[spec.LevelMay])
+	if n := score.Failed[spec.LevelUnknown]; n > 0 {
+		fmt.Fprintf(out, "  Unclassified failures: %d\n", n)
+	}
+
+	if n := counts[StatusFailed]; n > 0 {
+		return report, &FailedError{Failed: n}
+	}
+
+	return report, nil
+}
+
+// ShuffleGroups returns the groups in an order drawn from seed, with the
+// tests of each group shuffled as well. groups is left as it was.
+func ShuffleGroups(groups []TestGroup, seed uint64) []TestGroup {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	shuffled := make([]TestGroup, len(groups))
+	for i, group := range groups {
+		group.Tests = slices.Clone(group.Tests)
+		rng.Shuffle(len(group.Tests), func(a, b int) {
+			group.Tests[a], group.Tests[b] = group.Tests[b], group.Tests[a]
+		})
+		shuffled[i] = group
+	}
+	rng.Shuffle(len(shuffled), func(a, b int) {
+		shuffled[a], shuffled[b] = shuffled[b], shuffled[a]
+	})
+	return shuffled
+}
+
+// runTest runs one attempt of a test with its own logger and packet trace
+func runTest(suite Suite, group TestGroup, testFunc TestFunc, cfg Config, attempt int) TestResult {
+	log := cfg.Log().With("group", group.Name)
+	if attempt > 1 {
+		log = log.With("attempt", attempt)
+	}
+	testLog, flushLog := bufferTestLog(log)
+	testCfg := cfg
+	testCfg.Logger = testLog
+	if cfg.TracePackets || cfg.PrintTrace || testLog.Enabled(context.Background(), slog.LevelDebug) {
+		testCfg.Trace = NewTrace(testLog)
+	}
+	testLog.Debug("test started")
+	started := time.Now()
+	result := group.Run(context.Background(), testCfg, testFunc)
+	result.Group = group.Name
+	result.Started = started
+	result.Source = testSource(testFunc)
+	if cfg.TracePackets || cfg.PrintTrace {
+		result.Packets = testCfg.Trace.Packets()
+	}
+	if result.Level == spec.LevelUnknown && result.SpecRef != "" {
+		result.Level = spec.LevelOf(suite.Spec, result.SpecRef)
+	}
+	logResult(testLog, result)
+	flushLog(result.Name)
+	return result
+}
+
+// testSource returns where a test function is defined as file:line
+func testSource(fn TestFunc) string {
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return ""
+	}
+	file, line := f.FileLine(f.Entry())
+	if filepath.IsAbs(file) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, file); err == nil && !strings.HasPrefix(rel, "..") {
+				file = rel
+			}
+		}
+	} else if bi, ok := debug.ReadBuildInfo(); ok {
+		// Built with -trimpath, file starts with the module path
+		file = strings.TrimPrefix(file, bi.Main.Path+"/")
+	}
+	return fmt.Sprintf("%s:%d", filepath.ToSlash(file), line)
+}
+
+// testName returns the name of a test function, e.g. testQoS0, for results
+// of tests that could not run to report their own
+func testName(fn TestFunc) string {
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return "unknown test"
+	}
+	name := f.Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// notReady reports a failed readiness check along with what to look at
+func notReady(what string, cfg Config, err error) error {
+	out := cfg.Out()
+	fmt.Fprintf(out, "%s\n", FailStyle.Render("FAILED"))
+	cfg.Log().Error(what, "error", err)
+	if hint := Diagnose(cfg.Broker, err); hint != "" {
+		fmt.Fprintf(out, "  %s\n", WarnStyle.Render(hint))
+	}
+	return fmt.Errorf("%s: %w", what, err)
+}
+
+// runCleanup clears the retained messages and sessions the run left behind.
+// Failing to clean up does not fail the run.
+func runCleanup(cleanup CleanupFunc, cfg Config, sessions []string) {
+	out := cfg.Out()
+	fmt.Fprintf(out, "\n%s", SubtitleStyle.Render("Cleaning up... "))
+	res, err := cleanup(cfg, sessions)
+	if err != nil {
+		fmt.Fprintf(out, "%s\n", WarnStyle.Render("FAILED: "+err.Error()))
+		cfg.Log().Warn("cleanup failed", "error", err)
+		return
+	}
+	fmt.Fprintf(out, "%s\n", PassStyle.Render(fmt.Sprintf("cleared %d retained message(s), ended %d session(s)", len(res.Retained), len(res.Sessions))))
+	for _, err := range res.Errors {
+		fmt.Fprintf(out, "  %s\n", WarnStyle.Render(err.Error()))
+		cfg.Log().Warn("cleanup incomplete", "error", err)
+	}
+}
+
+// printTrace prints a test's packets, timestamped and offset from the start
+// of the test
+func printTrace(out io.Writer, result TestResult) {
+	if len(result.Packets) == 0 {
+		fmt.Fprintf(out, "      %s\n", DetailStyle.Render("(no packets)"))
+		return
+	}
+	for _, p := range result.Packets {
+		line := fmt.Sprintf("%s %+.3fs %s", p.Time.Format("15:04:05.000"), p.Time.Sub(result.Started).Seconds(), p.Summary())
+		fmt.Fprintf(out, "      %s\n", DetailStyle.Render(line))
+	}
+}
+
+// logResult logs the outcome of a test, failures at warn level
+func logResult(log *slog.Logger, result TestResult) {
+	attrs := []any{"status", result.Status.String(), "duration", result.Duration}
+	if result.SpecRef != "" {
+		attrs = append(attrs, "spec_ref", result.SpecRef)
+	}
+	if result.Notes != "" {
+		attrs = append(attrs, "notes", result.Notes)
+	}
+	if result.Error != nil {
+		attrs = append(attrs, "error", result.Error)
+	}
+	if result.Status == StatusFailed {
+		log.Warn("test failed", attrs...)
+		return
+	}
+	log.Info("test finished", attrs...)
+}
+
+// StatusLabel renders the styled status marker shown before a test name
+func StatusLabel(s Status) string {
+	switch s {
+	case StatusPassed:
+		return PassStyle.Render("✓ PASS")
+	case StatusSkipped:
+		return SkipStyle.Render("○ SKIP")
+	case StatusWarning:
+		return WarnStyle.Render("! WARN")
+	case StatusInconclusive:
+		return InconclusiveStyle.Render("? INCONCLUSIVE")
+	}
+	return FailStyle.Render("✗ FAIL")
+}
+
+// Score accumulates a compliance score weighted by normative level. Skipped
+// and inconclusive results are left out since they say nothing about the
+// broker; warnings count as passed.
+type Score struct {
+	Earned int
+	Total  int
+	Failed map[spec.Level]int
+}
+
+// Add accounts for one test result
+func (s *Score) Add(result TestResult) {
+	if s.Failed == nil {
+		s.Failed = make(map[spec.Level]int)
+	}
+	weight := result.Level.Weight()
+	switch result.Status {
+	case StatusPassed, StatusWarning:
+		s.Earned += weight
+		s.Total += weight
+	case StatusFailed:
+		s.Total += weight
+		s.Failed[result.Level]++
+	}
+}
+
+// Percent returns the weighted score as a percentage
+func (s *Score) Percent() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return 100 * float64(s.Earned) / float64(s.Total)
+}
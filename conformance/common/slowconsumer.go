@@ -0,0 +1,172 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Size of the slow consumer flood: enough QoS 0 messages to overrun the
+// socket buffers between the broker and a client that stopped reading, 8MB
+// being twice the largest send buffer Linux grows to by default, and a
+// per-client queue of a few thousand messages
+const (
+	slowConsumerPayload  = 512
+	slowConsumerMessages = 16 * 1024
+)
+
+// SlowConsumerPolicy is what a broker did about a subscriber that stopped
+// reading while its topic was flooded
+type SlowConsumerPolicy struct {
+	Sent         int           // QoS 0 PUBLISHes the publisher got out
+	Blocked      bool          // The broker stopped reading the publisher
+	BlockedAfter int           // PUBLISHes sent before the publisher blocked
+	Delivered    int           // Messages the slow consumer read once it resumed
+	Disconnected bool          // The broker closed the slow consumer's connection
+	Reason       byte          // Reason code of a DISCONNECT sent to it, MQTT 5
+	HasReason    bool          // A DISCONNECT was sent before closing
+	Fast         int           // Messages a subscriber reading normally received
+	RoundTrip    time.Duration // Round trip of an unrelated client during the stall
+}
+
+// String describes the policy for notes
+func (p SlowConsumerPolicy) String() string {
+	var parts []string
+	switch {
+	case p.Disconnected && p.HasReason:
+		parts = append(parts, fmt.Sprintf("slow consumer disconnected with 0x%02x after %d of %d messages", p.Reason, p.Delivered, p.Sent))
+	case p.Disconnected:
+		parts = append(parts, fmt.Sprintf("slow consumer disconnected after %d of %d messages", p.Delivered, p.Sent))
+	case p.Delivered < p.Sent:
+		parts = append(parts, fmt.Sprintf("%d of %d messages dropped for the slow consumer, kept connected", p.Sent-p.Delivered, p.Sent))
+	default:
+		parts = append(parts, fmt.Sprintf("all %d messages buffered for the slow consumer", p.Sent))
+	}
+	if p.Blocked {
+		parts = append(parts, fmt.Sprintf("publisher held back after %d messages", p.BlockedAfter))
+	}
+	parts = append(parts, fmt.Sprintf("reading subscriber got %d", p.Fast))
+	parts = append(parts, fmt.Sprintf("other client round trip %v", p.RoundTrip.Round(time.Millisecond)))
+	return strings.Join(parts, ", ")
+}
+
+// CheckSlowConsumer subscribes a client that then stops reading its socket,
+// alongside one that keeps reading, and floods their topic with QoS 0
+// messages. While the slow consumer is stalled an unrelated client must
+// still get a QoS 1 message round trip through; the broker may otherwise
+// hold the publisher back, drop messages for the slow consumer or
+// disconnect it, and the returned policy reports which it did.
+func CheckSlowConsumer(cfg Config, level byte) (SlowConsumerPolicy, error) {
+	var policy SlowConsumerPolicy
+	topic := cfg.Topic(GenerateTopicName("test/slow-consumer"))
+	timeout := cfg.Scaled(5 * time.Second)
+
+	slow, err := DialRaw(cfg, level, cfg.ClientID("test-slow-consumer"))
+	if err != nil {
+		return policy, err
+	}
+	defer slow.Close()
+	if tc, ok := slow.Conn.(interface{ SetReadBuffer(int) error }); ok {
+		tc.SetReadBuffer(4096)
+	}
+	if codes, err := slow.Subscribe(1, 0, timeout, topic); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		return policy, fmt.Errorf("slow consumer subscribe failed: %v % x", err, codes)
+	}
+	fast, err := DialRaw(cfg, level, cfg.ClientID("test-slow-consumer-fast"))
+	if err != nil {
+		return policy, err
+	}
+	defer fast.Close()
+	if codes, err := fast.Subscribe(1, 0, timeout, topic); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		return policy, fmt.Errorf("subscribe failed: %v % x", err, codes)
+	}
+	pub, err := DialRaw(cfg, level, cfg.ClientID("test-slow-consumer-pub"))
+	if err != nil {
+		return policy, err
+	}
+	defer pub.Close()
+	other, err := DialRaw(cfg, level, cfg.ClientID("test-slow-consumer-other"))
+	if err != nil {
+		return policy, err
+	}
+	defer other.Close()
+
+	// The reading subscriber counts until its topic goes quiet
+	var fastGot atomic.Int64
+	fastDone := make(chan struct{})
+	go func() {
+		defer close(fastDone)
+		for {
+			fast.SetReadDeadline(time.Now().Add(cfg.Scaled(3 * time.Second)))
+			header, _, err := ReadRawPacket(fast)
+			if err != nil {
+				return
+			}
+			if header&0xF0 == 0x30 {
+				fastGot.Add(1)
+			}
+		}
+	}()
+
+	payload := make([]byte, slowConsumerPayload)
+	for i := range slowConsumerMessages {
+		binary.BigEndian.PutUint32(payload, uint32(i))
+		pub.SetWriteDeadline(time.Now().Add(cfg.Scaled(2 * time.Second)))
+		if err := pub.Publish(topic, 0, 0, payload); err != nil {
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				return policy, fmt.Errorf("broker closed the publisher's connection during the flood: %w", err)
+			}
+			policy.Blocked, policy.BlockedAfter = true, i
+			break
+		}
+		policy.Sent++
+	}
+	pub.SetWriteDeadline(time.Time{})
+
+	start := time.Now()
+	if err := other.RoundTrip(cfg.Topic(GenerateTopicName("test/slow-consumer/other")), timeout); err != nil {
+		return policy, fmt.Errorf("unrelated client stalled while the slow consumer was not reading: %w", err)
+	}
+	policy.RoundTrip = time.Since(start)
+
+	<-fastDone
+	policy.Fast = int(fastGot.Load())
+
+	// The slow consumer reads again and takes what the broker kept for it
+	for {
+		slow.SetReadDeadline(time.Now().Add(cfg.Scaled(2 * time.Second)))
+		header, body, err := ReadRawPacket(slow)
+		if err != nil {
+			var netErr net.Error
+			policy.Disconnected = !errors.As(err, &netErr) || !netErr.Timeout()
+			break
+		}
+		switch header & 0xF0 {
+		case 0x30:
+			policy.Delivered++
+		case 0xE0:
+			policy.HasReason = true
+			if len(body) > 0 {
+				policy.Reason = body[0]
+			}
+		}
+	}
+	if policy.HasReason {
+		policy.Disconnected = true
+	}
+	if !policy.Disconnected {
+		slow.Send(0xE0, nil)
+	}
+	// A blocked publisher may have written part of a PUBLISH
+	if !policy.Blocked {
+		pub.Send(0xE0, nil)
+	}
+	fast.Send(0xE0, nil)
+	other.Send(0xE0, nil)
+	return policy, nil
+}
@@ -0,0 +1,286 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// $SYS topics that most brokers publish, e.g. Mosquitto, EMQX, HiveMQ and
+// Mochi. The specification reserves topics starting with $ for the broker
+// but leaves their names to convention.
+const (
+	SysClientsConnected = "$SYS/broker/clients/connected"
+	SysUptime           = "$SYS/broker/uptime"
+	SysMessagesReceived = "$SYS/broker/messages/received"
+)
+
+// SysTopics are the $SYS topics the $SYS tests read
+var SysTopics = []string{SysClientsConnected, SysUptime, SysMessagesReceived}
+
+// sysWait is how long to wait for $SYS updates. Brokers publish them on an
+// interval, 10 seconds by default on Mosquitto.
+const sysWait = 12 * time.Second
+
+// SysMonitor is a connection subscribed to SysTopics by name that keeps the
+// latest value published to each
+type SysMonitor struct {
+	conn   *RawConn
+	values map[string]string
+	counts map[string]int // Messages received per topic
+}
+
+// WatchSys subscribes a raw connection at protocol level to SysTopics
+func WatchSys(cfg Config, level byte) (*SysMonitor, error) {
+	conn, err := DialRaw(cfg, level, cfg.ClientID("test-sys-watch"))
+	if err != nil {
+		return nil, fmt.Errorf("connect failed: %w", err)
+	}
+	codes, err := conn.Subscribe(1, 0, cfg.Scaled(5*time.Second), SysTopics...)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("subscribe to $SYS topics failed: %w", err)
+	}
+	if len(codes) != len(SysTopics) {
+		conn.Close()
+		return nil, fmt.Errorf("expected %d SUBACK codes, got % x", len(SysTopics), codes)
+	}
+	return &SysMonitor{conn: conn, values: map[string]string{}, counts: map[string]int{}}, nil
+}
+
+// SkipWithoutSys watches SysTopics and waits for a value of each. It
+// returns nil and fills in result when the broker publishes none of them,
+// as skipped, or when they could not be watched, as failed.
+func SkipWithoutSys(cfg Config, level byte, result *TestResult) *SysMonitor {
+	m, err := WatchSys(cfg, level)
+	if err != nil {
+		result.Error = err
+		return nil
+	}
+	err = m.Read(cfg.Scaled(sysWait), func() bool {
+		_, missing := m.Seen()
+		return len(missing) == 0
+	})
+	if err != nil {
+		m.Close()
+		result.Error = err
+		return nil
+	}
+	if seen, _ := m.Seen(); len(seen) == 0 {
+		m.Close()
+		result.Status = StatusSkipped
+		result.Notes = fmt.Sprintf("broker publishes none of %s (optional)", strings.Join(SysTopics, ", "))
+		return nil
+	}
+	return m
+}
+
+// Close closes the monitor's connection
+func (m *SysMonitor) Close() {
+	m.conn.Close()
+}
+
+// Read takes in $SYS messages for up to d, or until done returns true
+func (m *SysMonitor) Read(d time.Duration, done func() bool) error {
+	deadline := time.Now().Add(d)
+	for !done() {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil
+		}
+		header, body, err := m.conn.Expect(0x30, wait, nil)
+		if errors.Is(err, ErrBrokerClosed) {
+			return err
+		}
+		if err != nil {
+			return nil
+		}
+		p, err := m.conn.ParsePublish(header, body)
+		if err != nil {
+			return err
+		}
+		if p.QoS > 0 {
+			m.conn.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+		}
+		m.values[p.Topic] = string(p.Payload)
+		m.counts[p.Topic]++
+	}
+	return nil
+}
+
+// Seen returns the SysTopics that had a message, and those that had none
+func (m *SysMonitor) Seen() (seen, missing []string) {
+	for _, t := range SysTopics {
+		if m.counts[t] > 0 {
+			seen = append(seen, t)
+		} else {
+			missing = append(missing, t)
+		}
+	}
+	return seen, missing
+}
+
+// Updates returns how many messages topic had
+func (m *SysMonitor) Updates(topic string) int {
+	return m.counts[topic]
+}
+
+// Number returns the latest value of topic as a number. Brokers publish
+// plain numbers or a number and a unit, e.g. "42 seconds".
+func (m *SysMonitor) Number(topic string) (int64, bool) {
+	fields := strings.Fields(m.values[topic])
+	if len(fields) == 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(fields[0], 10, 64)
+	return n, err == nil
+}
+
+// Value returns the latest value of topic as published
+func (m *SysMonitor) Value(topic string) string {
+	return m.values[topic]
+}
+
+// SysWildcardLeaks subscribes a raw connection at protocol level to
+// wildcard filters that would match $SYS topics if the first level were not
+// special, waits for m to see a $SYS update meanwhile, and returns the
+// topics starting with $ that the wildcard subscriptions received
+func SysWildcardLeaks(cfg Config, level byte, m *SysMonitor) ([]string, error) {
+	conn, err := DialRaw(cfg, level, cfg.ClientID("test-sys-wildcard"))
+	if err != nil {
+		return nil, fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+	filters := []string{"#", "+/broker/#", "+/broker/uptime"}
+	codes, err := conn.Subscribe(1, 0, cfg.Scaled(5*time.Second), filters...)
+	if err != nil {
+		return nil, fmt.Errorf("subscribe failed: %w", err)
+	}
+	if len(codes) != len(filters) {
+		return nil, fmt.Errorf("expected %d SUBACK codes, got % x", len(filters), codes)
+	}
+	for i, c := range codes {
+		if c >= 0x80 {
+			return nil, fmt.Errorf("subscription to %q refused with 0x%02x", filters[i], c)
+		}
+	}
+
+	// A $SYS update after the subscriptions were made, on top of any
+	// retained $SYS messages, gives the broker the chance to leak one
+	before := m.Updates(SysUptime) + m.Updates(SysClientsConnected) + m.Updates(SysMessagesReceived)
+	if err := m.Read(cfg.Scaled(sysWait), func() bool {
+		return m.Updates(SysUptime)+m.Updates(SysClientsConnected)+m.Updates(SysMessagesReceived) > before
+	}); err != nil {
+		return nil, err
+	}
+
+	leaked := map[string]bool{}
+	var topics []string
+	for {
+		conn.SetReadDeadline(time.Now().Add(cfg.Scaled(500 * time.Millisecond)))
+		header, body, err := ReadRawPacket(conn)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("wildcard subscriber: %w", err)
+		}
+		if header&0xF0 != 0x30 {
+			continue
+		}
+		p, err := conn.ParsePublish(header, body)
+		if err != nil {
+			return nil, err
+		}
+		if p.QoS > 0 {
+			conn.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+		}
+		if strings.HasPrefix(p.Topic, "$") && !leaked[p.Topic] {
+			leaked[p.Topic] = true
+			topics = append(topics, p.Topic)
+		}
+	}
+	return topics, nil
+}
+
+// The load CheckSysLoad puts on the broker
+const (
+	sysBurstClients  = 10
+	sysBurstMessages = 100
+)
+
+// CheckSysLoad reads SysTopics, connects sysBurstClients clients and
+// publishes sysBurstMessages QoS 1 messages while they stay connected, then
+// waits for the $SYS values to follow: more clients connected, at least as
+// many more messages received, and uptime going up. It returns what did not
+// follow and a summary of the values seen. Topics m has not seen are not
+// checked.
+func CheckSysLoad(cfg Config, level byte, m *SysMonitor) ([]string, string, error) {
+	connected, hasConnected := m.Number(SysClientsConnected)
+	received, hasReceived := m.Number(SysMessagesReceived)
+	uptime, hasUptime := m.Number(SysUptime)
+
+	var clients []*RawConn
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+	for range sysBurstClients {
+		c, err := DialRaw(cfg, level, cfg.ClientID("test-sys-load"))
+		if err != nil {
+			return nil, "", fmt.Errorf("burst client connect failed: %w", err)
+		}
+		clients = append(clients, c)
+	}
+	topic := cfg.Topic("test/sys/load")
+	for i := range sysBurstMessages {
+		reason, err := clients[0].PublishAcked(topic, 1, uint16(i+1), []byte("load"), cfg.Scaled(5*time.Second))
+		if err != nil {
+			return nil, "", fmt.Errorf("burst publish failed: %w", err)
+		}
+		if reason >= 0x80 {
+			return nil, "", fmt.Errorf("burst publish refused with 0x%02x", reason)
+		}
+	}
+
+	// Half the burst clients is enough for clients/connected, as other
+	// clients of a shared broker may come and go meanwhile
+	connectedOK := func() bool {
+		n, ok := m.Number(SysClientsConnected)
+		return !hasConnected || ok && n >= connected+sysBurstClients/2
+	}
+	receivedOK := func() bool {
+		n, ok := m.Number(SysMessagesReceived)
+		return !hasReceived || ok && n >= received+sysBurstMessages
+	}
+	uptimeOK := func() bool {
+		n, ok := m.Number(SysUptime)
+		return !hasUptime || ok && n > uptime
+	}
+	if err := m.Read(cfg.Scaled(sysWait), func() bool {
+		return connectedOK() && receivedOK() && uptimeOK()
+	}); err != nil {
+		return nil, "", err
+	}
+
+	var problems, notes []string
+	check := func(has, ok bool, topic, want string, before int64) {
+		if !has {
+			return
+		}
+		notes = append(notes, fmt.Sprintf("%s %d → %s", strings.TrimPrefix(topic, "$SYS/broker/"), before, m.Value(topic)))
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s went from %d to %q, expected %s", topic, before, m.Value(topic), want))
+		}
+	}
+	check(hasConnected, connectedOK(), SysClientsConnected, fmt.Sprintf("at least %d with %d more clients connected", connected+sysBurstClients/2, sysBurstClients), connected)
+	check(hasReceived, receivedOK(), SysMessagesReceived, fmt.Sprintf("at least %d after %d more PUBLISHes", received+sysBurstMessages, sysBurstMessages), received)
+	check(hasUptime, uptimeOK(), SysUptime, "it to increase", uptime)
+	return problems, strings.Join(notes, ", "), nil
+}
@@ -0,0 +1,79 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+// The waits in the tests were tuned against brokers on the same host. A wait
+// should still cover a few round trips to the broker, so the multiplier is
+// chosen to make the shortest common wait at least rttsPerWait round trips.
+const (
+	shortestWait     = 100 * time.Millisecond
+	rttsPerWait      = 3
+	maxTimingScale   = 10.0
+	calibrationPings = 5
+)
+
+// CalibrateTiming measures the broker's round trip time and returns the
+// timing multiplier for it, never below 1
+func CalibrateTiming(cfg Config) (float64, time.Duration, error) {
+	rtt, err := MeasureRTT(cfg, calibrationPings)
+	if err != nil {
+		return 1, 0, err
+	}
+	return TimingMultiplierFor(rtt), rtt, nil
+}
+
+// TimingMultiplierFor returns the timing multiplier for a round trip time,
+// rounded up to a tenth and capped at 10
+func TimingMultiplierFor(rtt time.Duration) float64 {
+	m := float64(rttsPerWait*rtt) / float64(shortestWait)
+	m = math.Ceil(m*10) / 10
+	return min(max(m, 1), maxTimingScale)
+}
+
+// MeasureRTT connects with an MQTT 3.1.1 CONNECT, which v5 brokers accept as
+// well, and returns the median of n PINGREQ/PINGRESP round trips
+func MeasureRTT(cfg Config, n int) (time.Duration, error) {
+	conn, err := Dial(cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := conn.Write(RawConnect(4, cfg.ClientID("calibrate"), cfg.Username, cfg.Password)); err != nil {
+		return 0, fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connack); err != nil {
+		return 0, fmt.Errorf("failed to read CONNACK: %w", err)
+	}
+	if connack[0] != 0x20 || connack[3] != 0 {
+		return 0, fmt.Errorf("connection refused (CONNACK % x)", connack)
+	}
+
+	rtts := make([]time.Duration, 0, n)
+	resp := make([]byte, 2)
+	for range n {
+		sent := time.Now()
+		if _, err := conn.Write([]byte{0xC0, 0x00}); err != nil {
+			return 0, fmt.Errorf("failed to send PINGREQ: %w", err)
+		}
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return 0, fmt.Errorf("failed to read PINGRESP: %w", err)
+		}
+		if resp[0] != 0xD0 {
+			return 0, fmt.Errorf("expected PINGRESP, got packet type 0x%02x", resp[0])
+		}
+		rtts = append(rtts, time.Since(sent))
+	}
+	conn.Write([]byte{0xE0, 0x00})
+
+	slices.Sort(rtts)
+	return rtts[len(rtts)/2], nil
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Timings breaks down where a test spent its time, worked out from the
+// packets it exchanged. Phases of different clients can overlap, so they
+// need not add up to the test's Duration.
+type Timings struct {
+	Connect   time.Duration `json:"connect,omitempty"`   // From each CONNECT to its CONNACK, summed over connections
+	Subscribe time.Duration `json:"subscribe,omitempty"` // From each SUBSCRIBE to its SUBACK, summed
+	Delivery  time.Duration `json:"delivery,omitempty"`  // Longest a PUBLISH took from being sent to being received
+	Teardown  time.Duration `json:"teardown,omitempty"`  // From the test returning until its connections closed, AfterEach included
+}
+
+// String lists the phases that took any time, e.g. "connect 3ms, delivery 12ms"
+func (t Timings) String() string {
+	var parts []string
+	for _, phase := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"connect", t.Connect},
+		{"subscribe", t.Subscribe},
+		{"delivery", t.Delivery},
+		{"teardown", t.Teardown},
+	} {
+		if phase.d > 0 {
+			parts = append(parts, fmt.Sprintf("%s %v", phase.name, phase.d.Round(100*time.Microsecond)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// phaseTimings works out the connect, subscribe and delivery times of a
+// test from its packet trace. A PUBLISH received is matched to the last one
+// sent on the same topic; retained messages are left out, since they were
+// stored before the subscription that delivered them.
+func phaseTimings(packets []Packet) Timings {
+	type request struct {
+		conn int
+		id   uint16
+	}
+	var t Timings
+	connects := make(map[int]time.Time)
+	subscribes := make(map[request]time.Time)
+	published := make(map[string]time.Time)
+	for _, p := range packets {
+		switch {
+		case p.Type == "CONNECT" && p.Direction == Sent:
+			connects[p.Conn] = p.Time
+		case p.Type == "CONNACK" && p.Direction == Received:
+			if sent, ok := connects[p.Conn]; ok {
+				t.Connect += p.Time.Sub(sent)
+				delete(connects, p.Conn)
+			}
+		case p.Type == "SUBSCRIBE" && p.Direction == Sent && p.HasID:
+			subscribes[request{p.Conn, p.PacketID}] = p.Time
+		case p.Type == "SUBACK" && p.Direction == Received && p.HasID:
+			key := request{p.Conn, p.PacketID}
+			if sent, ok := subscribes[key]; ok {
+				t.Subscribe += p.Time.Sub(sent)
+				delete(subscribes, key)
+			}
+		case p.Type == "PUBLISH" && p.Topic != "" && p.Direction == Sent:
+			published[p.Topic] = p.Time
+		case p.Type == "PUBLISH" && p.Topic != "" && p.Direction == Received && p.Flags&0x01 == 0:
+			if sent, ok := published[p.Topic]; ok {
+				t.Delivery = max(t.Delivery, p.Time.Sub(sent))
+			}
+		}
+	}
+	return t
+}
+
+// SlowestShown is how many of the slowest tests reports list
+const SlowestShown = 10
+
+// Slowest returns the n tests that took longest, slowest first
+func (r *Report) Slowest(n int) []TestResult {
+	results := slices.Clone(r.Results)
+	slices.SortStableFunc(results, func(a, b TestResult) int {
+		return cmp.Compare(b.Duration, a.Duration)
+	})
+	return results[:min(n, len(results))]
+}
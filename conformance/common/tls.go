@@ -0,0 +1,71 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+)
+
+// TLSOptions are the settings for connecting to a broker over TLS
+type TLSOptions struct {
+	CAFile             string `yaml:"ca_file"`   // PEM CA bundle to verify the broker with instead of the system roots
+	CertFile           string `yaml:"cert_file"` // Client certificate for mutual TLS, PEM
+	KeyFile            string `yaml:"key_file"`  // Key of CertFile, PEM
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// IsZero reports whether no TLS setting is given
+func (o TLSOptions) IsZero() bool {
+	return o == TLSOptions{}
+}
+
+// Config builds the tls.Config the options describe
+func (o TLSOptions) Config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CAFile)
+		}
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// IsTLSScheme reports whether a broker URL scheme asks for TLS
+func IsTLSScheme(scheme string) bool {
+	switch scheme {
+	case "ssl", "tls", "mqtts", "tcps":
+		return true
+	}
+	return false
+}
+
+// brokerAddress returns the host:port of a broker URL, defaulting the port
+// to 8883 for TLS and 1883 otherwise
+func brokerAddress(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if IsTLSScheme(u.Scheme) {
+		return net.JoinHostPort(u.Hostname(), "8883")
+	}
+	return net.JoinHostPort(u.Hostname(), "1883")
+}
@@ -0,0 +1,211 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MatchTopic reports whether filter matches topic by the rules of section
+// 4.7: + matches exactly one level, # matches its parent level and any number
+// of levels below, and neither matches a first level that starts with $. It
+// is the reference the topic matching model is checked against.
+func MatchTopic(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		switch {
+		case level == "#":
+			return true
+		case i >= len(t):
+			return false
+		case level != "+" && level != t[i]:
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
+
+// topicModelWords are the levels the model builds topics from. The empty
+// level tests "a//b" and trailing separators, "a" and "ab" test that levels
+// are compared whole.
+var topicModelWords = []string{"a", "b", "ab", ""}
+
+// TopicModel is a set of topic filters and topic names below Prefix that
+// were generated at random
+type TopicModel struct {
+	Prefix  string
+	Filters []string
+	Topics  []string
+}
+
+// NewTopicModel generates filters and topics from rng. Half the filters are
+// derived from a topic, with levels swapped for wildcards or other words, so
+// most filters match something and many only just miss.
+func NewTopicModel(rng *rand.Rand, prefix string, filters, topics int) TopicModel {
+	m := TopicModel{Prefix: prefix}
+	levels := func(n int) []string {
+		l := make([]string, n)
+		for i := range l {
+			l[i] = topicModelWords[rng.IntN(len(topicModelWords))]
+		}
+		return l
+	}
+	join := func(l []string) string {
+		return strings.Join(append([]string{prefix}, l...), "/")
+	}
+
+	seen := map[string]bool{}
+	for len(m.Topics) < topics {
+		// Depth 0 is the prefix itself, which only parent matching of #
+		// reaches
+		t := join(levels(rng.IntN(5)))
+		if !seen[t] {
+			seen[t] = true
+			m.Topics = append(m.Topics, t)
+		}
+	}
+
+	seen = map[string]bool{}
+	for len(m.Filters) < filters {
+		var l []string
+		if rng.IntN(2) == 0 {
+			l = levels(1 + rng.IntN(4))
+		} else {
+			l = strings.Split(strings.TrimPrefix(m.Topics[rng.IntN(len(m.Topics))], prefix), "/")[1:]
+		}
+		for i := range l {
+			switch rng.IntN(6) {
+			case 0, 1:
+				l[i] = "+"
+			case 2:
+				l[i] = topicModelWords[rng.IntN(len(topicModelWords))]
+			}
+		}
+		if rng.IntN(3) == 0 {
+			l = append(l[:rng.IntN(len(l)+1)], "#")
+		}
+		f := join(l)
+		if !seen[f] {
+			seen[f] = true
+			m.Filters = append(m.Filters, f)
+		}
+	}
+	return m
+}
+
+// show quotes a filter or topic of m without its prefix, which is shared
+// by all of them
+func (m TopicModel) show(name string) string {
+	return fmt.Sprintf("%+q", strings.TrimPrefix(name, m.Prefix))
+}
+
+// Expected returns the indices of the topics that filter matches
+func (m TopicModel) Expected(filter string) []int {
+	var matched []int
+	for i, t := range m.Topics {
+		if MatchTopic(filter, t) {
+			matched = append(matched, i)
+		}
+	}
+	return matched
+}
+
+// CheckTopicModel subscribes a raw connection at protocol level to each
+// filter of m at QoS 1, publishes one QoS 1 message to each topic and
+// compares what every subscriber received with MatchTopic. It returns a
+// description of each divergence, with names shown without the prefix, and
+// how many deliveries the model expected. An error means the check could not
+// be carried out.
+func CheckTopicModel(cfg Config, level byte, m TopicModel) ([]string, int, error) {
+	timeout := cfg.Scaled(5 * time.Second)
+
+	subs := make([]*RawConn, len(m.Filters))
+	for i, f := range m.Filters {
+		sub, err := DialRaw(cfg, level, cfg.ClientID("test-model-sub"))
+		if err != nil {
+			return nil, 0, fmt.Errorf("subscriber connect failed: %w", err)
+		}
+		defer sub.Close()
+		codes, err := sub.Subscribe(1, 1, timeout, f)
+		if err != nil {
+			return nil, 0, fmt.Errorf("subscribe to %s failed: %w", m.show(f), err)
+		}
+		if len(codes) != 1 || codes[0] >= 0x80 {
+			return nil, 0, fmt.Errorf("subscription to %s refused with SUBACK % x", m.show(f), codes)
+		}
+		subs[i] = sub
+	}
+
+	pub, err := DialRaw(cfg, level, cfg.ClientID("test-model-pub"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("publisher connect failed: %w", err)
+	}
+	defer pub.Close()
+	for i, t := range m.Topics {
+		reason, err := pub.PublishAcked(t, 1, uint16(i+1), []byte(strconv.Itoa(i)), timeout)
+		if err != nil {
+			return nil, 0, fmt.Errorf("publish to %s failed: %w", m.show(t), err)
+		}
+		if reason >= 0x80 {
+			return nil, 0, fmt.Errorf("publish to %s refused with 0x%02x", m.show(t), reason)
+		}
+	}
+
+	// Every subscriber gets the same deadline for its expected messages, and
+	// a short quiet period after them for messages it should not get
+	var divergences []string
+	expectedTotal := 0
+	deadline := time.Now().Add(cfg.Scaled(3 * time.Second))
+	for i, f := range m.Filters {
+		expected := m.Expected(f)
+		expectedTotal += len(expected)
+		received := map[int]bool{}
+		for {
+			wait := time.Until(deadline)
+			if len(received) >= len(expected) || wait <= 0 {
+				wait = cfg.Scaled(100 * time.Millisecond)
+			}
+			header, body, err := subs[i].Expect(0x30, wait, nil)
+			if errors.Is(err, ErrBrokerClosed) {
+				return nil, 0, fmt.Errorf("broker closed the connection subscribed to %s", m.show(f))
+			}
+			if err != nil {
+				break
+			}
+			p, err := subs[i].ParsePublish(header, body)
+			if err != nil {
+				return nil, 0, fmt.Errorf("delivered PUBLISH unreadable: %w", err)
+			}
+			if p.QoS > 0 {
+				subs[i].Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+			}
+			n, err := strconv.Atoi(string(p.Payload))
+			if err != nil || n < 0 || n >= len(m.Topics) {
+				divergences = append(divergences, fmt.Sprintf("%s received a message that was not published: %+q on %+q", m.show(f), p.Payload, p.Topic))
+				continue
+			}
+			if p.Topic != m.Topics[n] {
+				divergences = append(divergences, fmt.Sprintf("%s received the message for %s on topic %s", m.show(f), m.show(m.Topics[n]), m.show(p.Topic)))
+			}
+			if !slices.Contains(expected, n) && !received[n] {
+				divergences = append(divergences, fmt.Sprintf("%s matched %s", m.show(f), m.show(m.Topics[n])))
+			}
+			received[n] = true
+		}
+		for _, n := range expected {
+			if !received[n] {
+				divergences = append(divergences, fmt.Sprintf("%s did not match %s", m.show(f), m.show(m.Topics[n])))
+			}
+		}
+	}
+	return divergences, expectedTotal, nil
+}
@@ -0,0 +1,534 @@
+package common
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction is which way a packet travelled, seen from the test client
+type Direction int
+
+const (
+	Sent Direction = iota
+	Received
+)
+
+func (d Direction) String() string {
+	if d == Sent {
+		return "→"
+	}
+	return "←"
+}
+
+// Packet is one MQTT control packet seen on a traced connection
+type Packet struct {
+	Time      time.Time `json:"time"`
+	Conn      int       `json:"conn"` // Connection number within the test, starting at 1
+	Direction Direction `json:"direction"`
+	Type      string    `json:"type"`
+	Flags     byte      `json:"flags"`
+	Length    int       `json:"length"` // Remaining Length
+	PacketID  uint16    `json:"packet_id,omitempty"`
+	HasID     bool      `json:"has_id,omitempty"`
+
+	ClientID   string     `json:"client_id,omitempty"` // CONNECT only
+	Topic      string     `json:"topic,omitempty"`     // PUBLISH topic, or the first SUBSCRIBE/UNSUBSCRIBE filter
+	Reason     byte       `json:"reason,omitempty"`    // Reason or return code, if the packet has one
+	HasReason  bool       `json:"has_reason,omitempty"`
+	Properties []Property `json:"properties,omitempty"` // MQTT v5 only
+
+	Raw []byte `json:"-"` // The complete packet as it crossed the wire
+}
+
+// Property is a decoded MQTT v5 property
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// String renders the packet as one trace line
+func (p Packet) String() string {
+	s := fmt.Sprintf("#%d %s %-11s flags=0x%x len=%d", p.Conn, p.Direction, p.Type, p.Flags, p.Length)
+	if p.HasID {
+		s += fmt.Sprintf(" id=%d", p.PacketID)
+	}
+	return s
+}
+
+// Summary renders the trace line followed by what the packet carries: the
+// client ID, topic, reason code and properties
+func (p Packet) Summary() string {
+	s := p.String()
+	if p.ClientID != "" {
+		s += fmt.Sprintf(" client_id=%q", p.ClientID)
+	}
+	if p.Topic != "" {
+		s += fmt.Sprintf(" topic=%q", p.Topic)
+	}
+	if p.HasReason {
+		s += fmt.Sprintf(" reason=0x%02x", p.Reason)
+	}
+	if props := p.PropertySummary(); props != "" {
+		s += " [" + props + "]"
+	}
+	return s
+}
+
+// PropertySummary lists the packet's properties as Name=Value pairs
+func (p Packet) PropertySummary() string {
+	parts := make([]string, len(p.Properties))
+	for i, prop := range p.Properties {
+		parts[i] = prop.Name + "=" + prop.Value
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Trace collects the packets of every connection a test opens. It is safe
+// for concurrent use.
+type Trace struct {
+	mu      sync.Mutex
+	start   time.Time
+	conns   int
+	packets []Packet
+	log     *slog.Logger
+	timing  bool // Only for Timings: packets keep no Raw bytes or properties
+}
+
+// NewTrace starts an empty trace. Packets are also logged at debug level to
+// log, if it is not nil.
+func NewTrace(log *slog.Logger) *Trace {
+	if log != nil && !log.Enabled(context.Background(), slog.LevelDebug) {
+		log = nil
+	}
+	return &Trace{start: time.Now(), log: log}
+}
+
+// newTimingTrace starts a trace that only records what phaseTimings needs,
+// for tests run without packet tracing
+func newTimingTrace() *Trace {
+	return &Trace{start: time.Now(), timing: true}
+}
+
+// Start is when the trace began
+func (t *Trace) Start() time.Time {
+	return t.start
+}
+
+// Packets returns the packets captured so far in the order they were seen
+func (t *Trace) Packets() []Packet {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Packet(nil), t.packets...)
+}
+
+func (t *Trace) add(p Packet) {
+	t.mu.Lock()
+	t.packets = append(t.packets, p)
+	t.mu.Unlock()
+}
+
+// logPacket logs a packet with the client ID of its connection
+func (t *Trace) logPacket(p Packet, clientID string) {
+	if t.log == nil {
+		return
+	}
+	attrs := []any{"conn", p.Conn, "dir", p.Direction.String(), "type", p.Type, "flags", p.Flags, "len", p.Length}
+	if clientID != "" {
+		attrs = append(attrs, "client_id", clientID)
+	}
+	if p.HasID {
+		attrs = append(attrs, "packet_id", p.PacketID)
+	}
+	if p.Topic != "" {
+		attrs = append(attrs, "topic", p.Topic)
+	}
+	if p.HasReason {
+		attrs = append(attrs, "reason", fmt.Sprintf("0x%02x", p.Reason))
+	}
+	if props := p.PropertySummary(); props != "" {
+		attrs = append(attrs, "props", props)
+	}
+	t.log.Debug("packet", attrs...)
+}
+
+// Wrap returns conn with every packet in both directions recorded in the
+// trace. A nil trace returns conn unchanged.
+func (t *Trace) Wrap(conn net.Conn) net.Conn {
+	if t == nil {
+		return conn
+	}
+	t.mu.Lock()
+	t.conns++
+	id := t.conns
+	t.mu.Unlock()
+
+	if t.log != nil {
+		t.log.Debug("connection opened", "conn", id, "remote", conn.RemoteAddr().String())
+	}
+	state := &connState{}
+	return &traceConn{
+		Conn: conn,
+		sent: &packetDecoder{trace: t, conn: id, dir: Sent, state: state},
+		recv: &packetDecoder{trace: t, conn: id, dir: Received, state: state},
+	}
+}
+
+// traceConn feeds the bytes passing through a connection to packet decoders
+type traceConn struct {
+	net.Conn
+	sent *packetDecoder
+	recv *packetDecoder
+}
+
+func (c *traceConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.recv.feed(b[:n])
+	return n, err
+}
+
+func (c *traceConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.sent.feed(b[:n])
+	return n, err
+}
+
+// packetDecoder splits one direction of a byte stream into MQTT packets.
+// Tests deliberately send malformed data, so it never fails: bytes that do
+// not form a packet are recorded as such and decoding stops.
+type packetDecoder struct {
+	mu     sync.Mutex
+	trace  *Trace
+	conn   int
+	dir    Direction
+	state  *connState
+	buf    []byte
+	broken bool
+}
+
+// connState is shared by both directions of a connection
+type connState struct {
+	mu       sync.Mutex
+	v5       bool // The CONNECT asked for MQTT v5, so packets carry properties
+	clientID string
+}
+
+func (s *connState) isV5() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.v5
+}
+
+// learn remembers the client identifier of the connection from its CONNECT,
+// or from the CONNACK when the broker assigned one
+func (s *connState) learn(p Packet) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch p.Type {
+	case "CONNECT":
+		s.clientID = p.ClientID
+	case "CONNACK":
+		for _, prop := range p.Properties {
+			if prop.Name == "Assigned Client Identifier" {
+				s.clientID = strings.Trim(prop.Value, `"`)
+			}
+		}
+	}
+	return s.clientID
+}
+
+// maxTracedPacket bounds how much of a single packet is buffered
+const maxTracedPacket = 1 << 20
+
+func (d *packetDecoder) feed(b []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.broken || len(b) == 0 {
+		return
+	}
+	d.buf = append(d.buf, b...)
+
+	for len(d.buf) >= 2 {
+		length, n, ok := decodeRemainingLength(d.buf[1:])
+		if !ok {
+			if n >= 4 {
+				d.fail("malformed remaining length")
+			}
+			return
+		}
+		total := 1 + n + length
+		if length > maxTracedPacket {
+			d.fail(fmt.Sprintf("remaining length %d too large to trace", length))
+			return
+		}
+		if len(d.buf) < total {
+			return
+		}
+
+		body := d.buf[1+n : total]
+		if d.buf[0]>>4 == 1 && len(body) >= 7 {
+			d.state.mu.Lock()
+			d.state.v5 = body[6] == 5
+			d.state.mu.Unlock()
+		}
+		p := decodePacket(d.buf[0], body, d.state.isV5(), Packet{
+			Time:      time.Now(),
+			Conn:      d.conn,
+			Direction: d.dir,
+			Length:    length,
+		})
+		if d.trace.timing {
+			p.Properties = nil
+		} else {
+			p.Raw = append([]byte(nil), d.buf[:total]...)
+		}
+		d.trace.add(p)
+		d.trace.logPacket(p, d.state.learn(p))
+		d.buf = d.buf[total:]
+	}
+}
+
+func (d *packetDecoder) fail(reason string) {
+	p := Packet{
+		Time:      time.Now(),
+		Conn:      d.conn,
+		Direction: d.dir,
+		Type:      "(" + reason + ")",
+		Length:    len(d.buf),
+	}
+	d.trace.add(p)
+	d.trace.logPacket(p, d.state.learn(p))
+	d.broken = true
+	d.buf = nil
+}
+
+// decodeRemainingLength decodes the variable byte integer at the start of b.
+// ok is false while more bytes are needed or when the encoding is invalid
+// (n >= 4).
+func decodeRemainingLength(b []byte) (length, n int, ok bool) {
+	multiplier := 1
+	for n < len(b) && n < 4 {
+		digit := b[n]
+		length += int(digit&0x7f) * multiplier
+		n++
+		if digit&0x80 == 0 {
+			return length, n, true
+		}
+		multiplier *= 128
+	}
+	return 0, n, false
+}
+
+var packetTypes = [...]string{
+	"RESERVED", "CONNECT", "CONNACK", "PUBLISH", "PUBACK", "PUBREC", "PUBREL", "PUBCOMP",
+	"SUBSCRIBE", "SUBACK", "UNSUBSCRIBE", "UNSUBACK", "PINGREQ", "PINGRESP", "DISCONNECT", "AUTH",
+}
+
+// decodePacket fills in the type, flags, packet identifier, reason code,
+// properties and client ID of a packet from its first byte and body. Fields
+// it cannot find in a truncated or malformed body are left empty.
+func decodePacket(header byte, body []byte, v5 bool, p Packet) Packet {
+	kind := header >> 4
+	p.Type = packetTypes[kind]
+	p.Flags = header & 0x0f
+	r := &reader{b: body}
+
+	switch kind {
+	case 1: // CONNECT
+		r.str() // Protocol Name
+		level := r.byte()
+		r.skip(3) // Connect Flags, Keep Alive
+		if level == 5 {
+			p.Properties = r.properties()
+		}
+		p.ClientID = r.str()
+	case 2: // CONNACK
+		r.byte() // Acknowledge Flags
+		p.Reason, p.HasReason = r.byte(), r.ok()
+		if v5 {
+			p.Properties = r.properties()
+		}
+	case 3: // PUBLISH carries an identifier after the topic when QoS > 0
+		p.Topic = r.str()
+		if (header>>1)&0x03 > 0 {
+			p.PacketID, p.HasID = r.uint16(), r.ok()
+		}
+		if v5 {
+			p.Properties = r.properties()
+		}
+	case 4, 5, 6, 7: // PUBACK, PUBREC, PUBREL, PUBCOMP
+		p.PacketID, p.HasID = r.uint16(), r.ok()
+		if v5 && r.more() {
+			p.Reason, p.HasReason = r.byte(), r.ok()
+			if r.more() {
+				p.Properties = r.properties()
+			}
+		}
+	case 8, 9, 10, 11: // SUBSCRIBE, SUBACK, UNSUBSCRIBE, UNSUBACK
+		p.PacketID, p.HasID = r.uint16(), r.ok()
+		if v5 {
+			p.Properties = r.properties()
+		}
+		switch {
+		case kind == 8 || kind == 10:
+			p.Topic = r.str() // First topic filter
+		case r.more():
+			p.Reason, p.HasReason = r.byte(), r.ok() // First reason code
+		}
+	case 14, 15: // DISCONNECT, AUTH
+		if v5 && r.more() {
+			p.Reason, p.HasReason = r.byte(), r.ok()
+			if r.more() {
+				p.Properties = r.properties()
+			}
+		}
+	}
+	return p
+}
+
+// reader decodes MQTT data types from a packet body. Reading past the end
+// sets the failed flag instead of panicking.
+type reader struct {
+	b      []byte
+	failed bool
+}
+
+func (r *reader) ok() bool   { return !r.failed }
+func (r *reader) more() bool { return !r.failed && len(r.b) > 0 }
+
+func (r *reader) take(n int) []byte {
+	if r.failed || n > len(r.b) {
+		r.failed = true
+		r.b = nil
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *reader) skip(n int) { r.take(n) }
+
+func (r *reader) byte() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) varint() int {
+	n, size, ok := decodeRemainingLength(r.b)
+	if !ok {
+		r.failed = true
+		r.b = nil
+		return 0
+	}
+	r.b = r.b[size:]
+	return n
+}
+
+func (r *reader) binary() []byte {
+	return r.take(int(r.uint16()))
+}
+
+func (r *reader) str() string {
+	return string(r.binary())
+}
+
+// propertyNames maps MQTT v5 property identifiers to their names and types
+var propertyNames = map[byte]struct {
+	name string
+	kind byte // b=byte, 2=two byte int, 4=four byte int, v=varint, s=string, d=binary, p=string pair
+}{
+	0x01: {"Payload Format Indicator", 'b'},
+	0x02: {"Message Expiry Interval", '4'},
+	0x03: {"Content Type", 's'},
+	0x08: {"Response Topic", 's'},
+	0x09: {"Correlation Data", 'd'},
+	0x0B: {"Subscription Identifier", 'v'},
+	0x11: {"Session Expiry Interval", '4'},
+	0x12: {"Assigned Client Identifier", 's'},
+	0x13: {"Server Keep Alive", '2'},
+	0x15: {"Authentication Method", 's'},
+	0x16: {"Authentication Data", 'd'},
+	0x17: {"Request Problem Information", 'b'},
+	0x18: {"Will Delay Interval", '4'},
+	0x19: {"Request Response Information", 'b'},
+	0x1A: {"Response Information", 's'},
+	0x1C: {"Server Reference", 's'},
+	0x1F: {"Reason String", 's'},
+	0x21: {"Receive Maximum", '2'},
+	0x22: {"Topic Alias Maximum", '2'},
+	0x23: {"Topic Alias", '2'},
+	0x24: {"Maximum QoS", 'b'},
+	0x25: {"Retain Available", 'b'},
+	0x26: {"User Property", 'p'},
+	0x27: {"Maximum Packet Size", '4'},
+	0x28: {"Wildcard Subscription Available", 'b'},
+	0x29: {"Subscription Identifier Available", 'b'},
+	0x2A: {"Shared Subscription Available", 'b'},
+}
+
+// properties decodes a property length and the properties that follow
+func (r *reader) properties() []Property {
+	length := r.varint()
+	props := &reader{b: r.take(length)}
+	if r.failed {
+		return nil
+	}
+
+	var out []Property
+	for props.more() {
+		id := props.byte()
+		def, known := propertyNames[id]
+		if !known {
+			out = append(out, Property{Name: fmt.Sprintf("Unknown 0x%02x", id), Value: fmt.Sprintf("% x", props.b)})
+			break
+		}
+		var value string
+		switch def.kind {
+		case 'b':
+			value = fmt.Sprint(props.byte())
+		case '2':
+			value = fmt.Sprint(props.uint16())
+		case '4':
+			value = fmt.Sprint(props.uint32())
+		case 'v':
+			value = fmt.Sprint(props.varint())
+		case 's':
+			value = fmt.Sprintf("%q", props.str())
+		case 'd':
+			value = fmt.Sprintf("%x", props.binary())
+		case 'p':
+			k := props.str()
+			value = fmt.Sprintf("%q=%q", k, props.str())
+		}
+		if !props.ok() {
+			break
+		}
+		out = append(out, Property{Name: def.name, Value: value})
+	}
+	return out
+}
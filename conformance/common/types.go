@@ -1,7 +1,17 @@
 package common
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
 	"time"
+
+	"github.com/bromq-dev/testmqtt/spec"
 )
 
 // Config holds configuration for conformance tests
@@ -9,22 +19,335 @@ type Config struct {
 	Broker   string
 	Username string
 	Password string
+
+	// Nodes are further nodes of the cluster Broker belongs to, for the
+	// cluster tests
+	Nodes []string
+
+	// TLS is used for ssl://, tls:// and mqtts:// broker URLs; nil means
+	// verifying the broker against the system roots
+	TLS *tls.Config
+
+	// DialTimeout bounds connecting to the broker, 5s when zero
+	DialTimeout time.Duration
+
+	// ReadyTimeout is how long the runner keeps retrying the preflight check
+	// while the broker refuses or drops connections, e.g. because it is still
+	// starting. Zero tries once.
+	ReadyTimeout time.Duration
+
+	// TimingMultiplier scales the waits tests use to let the broker process
+	// something, see Wait. The runner calibrates it from the broker's round
+	// trip time when it is zero.
+	TimingMultiplier float64
+
+	// Tags limits the run to groups carrying at least one of them
+	Tags []string
+
+	// TopicNamespace is prepended to every topic the tests use, so concurrent
+	// runs and retained messages left over from earlier runs cannot
+	// interfere. The runner fills in testmqtt/<run id> when it is empty.
+	TopicNamespace string
+
+	// ClientIDPrefix is prepended to every client ID the tests use, see
+	// ClientID, e.g. for brokers whose ACLs are keyed on the client ID
+	ClientIDPrefix string
+
+	// Sessions collects the client IDs of persistent sessions tests create.
+	// The runner sets it and ends those sessions once the suite is done,
+	// along with the retained messages under TopicNamespace, unless
+	// SkipCleanup is set.
+	Sessions    *SessionLog
+	SkipCleanup bool
+
+	// Retries is how many more times a failed test is run before it counts
+	// as failed, waiting RetryBackoff before each retry
+	Retries      int
+	RetryBackoff time.Duration
+
+	// Shuffle runs the groups, and the tests within each group, in an order
+	// drawn from Seed, so a failure caused by test order can be reproduced
+	Shuffle bool
+	Seed    uint64
+
+	// Auth and ACL describe the broker's authentication and access control
+	// for the tests of them
+	Auth Auth
+	ACL  ACL
+
+	// Quota sets the message counts of the quota tests, see Quota
+	Quota Quota
+
+	// Limits sets the ceilings of the limit discovery tests, see Limits
+	Limits Limits
+
+	// Bridge describes a bridge on the broker for the bridge tests, see
+	// Bridge
+	Bridge Bridge
+
+	// Redirect describes a client the broker sends to another server, for
+	// the server redirection tests, see Redirect
+	Redirect Redirect
+
+	// RestartBroker restarts the broker under test and returns once it
+	// accepts connections again. It is nil unless the suite controls the
+	// broker, e.g. in a Docker container, and the restart tests are skipped
+	// without it.
+	RestartBroker func() error
+
+	// PartitionWindows are how long the network partition tests black-hole
+	// traffic, each window tried in turn; DefaultPartitionWindows when empty
+	PartitionWindows []time.Duration
+
+	// Capabilities detected from CONNACK during preflight, nil if unknown
+	Capabilities *Capabilities
+
+	// TracePackets makes the runner capture every packet each test sends and
+	// receives into the test's Trace
+	TracePackets bool
+	Trace        *Trace // Set for the running test, only recording Timings if not tracing
+
+	// Conns tracks the connections the running test opens through Dial, so
+	// any it leaves open are reported and closed. Set by TestGroup.Run.
+	Conns *ConnTracker
+
+	// PrintTrace prints the captured packets under each test's result. It
+	// implies TracePackets.
+	PrintTrace bool
+
+	// Output receives what the runner prints, stdout when nil
+	Output io.Writer
+
+	// Progress shows running totals and an estimate of the time left while
+	// the suite runs, going by the Durations of earlier runs
+	Progress  bool
+	Durations Durations
+
+	// OnProgress is called by the runner before and after every test, e.g.
+	// to show live progress in place of Output
+	OnProgress func(Progress)
+
+	// Logger receives structured logs. The runner hands each test a logger
+	// with the group and test name attached; use Log to get it.
+	Logger *slog.Logger
+}
+
+// Scaled returns d scaled by the timing multiplier
+func (c Config) Scaled(d time.Duration) time.Duration {
+	if c.TimingMultiplier <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * c.TimingMultiplier)
+}
+
+// Wait sleeps for d scaled by the timing multiplier. It is for waits that give
+// the broker time to deliver or process something, not for protocol timers
+// such as keep alive or message expiry.
+func (c Config) Wait(d time.Duration) {
+	time.Sleep(c.Scaled(d))
+}
+
+// Out returns where the runner prints to
+func (c Config) Out() io.Writer {
+	if c.Output == nil {
+		return os.Stdout
+	}
+	return c.Output
+}
+
+// Progress reports on a suite run as it happens
+type Progress struct {
+	Group string
+	Done  int // Tests finished so far
+	Total int // Tests that will run
+
+	// Result is the test that just finished, nil when a test is starting
+	Result *TestResult
+}
+
+// Topic returns name inside the run's topic namespace
+func (c Config) Topic(name string) string {
+	if c.TopicNamespace == "" {
+		return name
+	}
+	return c.TopicNamespace + "/" + name
+}
+
+// ClientID returns a unique client ID for name, starting with the run's
+// client ID prefix
+func (c Config) ClientID(name string) string {
+	return GenerateClientID(c.ClientIDPrefix + name)
+}
+
+// Status is the outcome of a conformance test
+type Status int
+
+const (
+	// StatusFailed is the zero value so a test that never reports success fails
+	StatusFailed Status = iota
+	StatusPassed
+	StatusSkipped      // Not run, e.g. the broker lacks an optional feature
+	StatusWarning      // Tolerated deviation from the specification
+	StatusInconclusive // Ran, but the requirement could not be verified
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPassed:
+		return "PASS"
+	case StatusFailed:
+		return "FAIL"
+	case StatusSkipped:
+		return "SKIP"
+	case StatusWarning:
+		return "WARN"
+	case StatusInconclusive:
+		return "INCONCLUSIVE"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Status) UnmarshalText(text []byte) error {
+	for _, status := range []Status{StatusFailed, StatusPassed, StatusSkipped, StatusWarning, StatusInconclusive} {
+		if status.String() == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status %q", text)
+}
+
+// PassIf returns StatusPassed when ok is true and StatusFailed otherwise
+func PassIf(ok bool) Status {
+	if ok {
+		return StatusPassed
+	}
+	return StatusFailed
 }
 
 // TestResult represents the outcome of a conformance test
 type TestResult struct {
+	Group    string // Set by the runner
 	Name     string
-	Passed   bool
+	Status   Status
 	Error    error
+	Notes    string    // Why a test was skipped, inconclusive or only a warning
+	Started  time.Time // Set by the runner
 	Duration time.Duration
 	SpecRef  string // MQTT spec reference like "MQTT-3.1.0-1" (v5) or "MQTT-3.1-1" (v3.1.1)
+
+	// Level is the normative level of the statement under test. Tests may
+	// set it explicitly; otherwise the runner looks SpecRef up in the spec.
+	Level spec.Level
+
+	Packets []Packet // Captured when Config.TracePackets is set
+
+	// Expected and Actual are what a failed check wanted and what it saw,
+	// filled in by package assert
+	Expected string
+	Actual   string
+
+	// Source is the file:line of the test function, relative to the working
+	// directory when inside it. Set by the runner.
+	Source string
+
+	// Attempts lists every run of a test that was retried, the last being
+	// the one this result describes. It is nil for a test that ran once.
+	Attempts []Attempt
+
+	// Leak is what the test left open once it returned, nil if nothing
+	Leak *Leak
+
+	// Timings breaks Duration down by phase. Set by TestGroup.Run.
+	Timings Timings
 }
 
-// TestFunc is a function that runs a conformance test
-type TestFunc func(cfg Config) TestResult
+// TestFunc is a function that runs a conformance test. The clients it
+// creates use ctx, which is cancelled when the test should stop, e.g. when
+// go test runs out of time.
+type TestFunc func(ctx context.Context, cfg Config) TestResult
 
 // TestGroup represents a collection of related tests
 type TestGroup struct {
 	Name  string
+	Tags  []string // Areas the group covers, e.g. "qos" or "negative"
 	Tests []TestFunc
+
+	// Setup runs once before the group's tests and may fill in the Config
+	// they get, e.g. with a topic namespace of their own. If it fails, every
+	// test of the group fails without running. Teardown runs once after the
+	// tests when Setup succeeded. Either may be nil.
+	Setup    func(cfg *Config) error
+	Teardown func(cfg Config) error
+
+	// BeforeEach and AfterEach run around every attempt of every test, see
+	// Run. Either may be nil.
+	BeforeEach func(cfg *Config) error
+	AfterEach  func(cfg Config) error
+}
+
+// Run runs a test of the group between BeforeEach and AfterEach. A
+// BeforeEach error fails the test without running it; an AfterEach error
+// is logged and added to the result's notes, leaving its status alone.
+// Connections and goroutines the test leaves behind are reported in the
+// result's Leak, see checkLeaks, and its packets are traced to fill in its
+// Timings.
+func (g TestGroup) Run(ctx context.Context, cfg Config, testFunc TestFunc) TestResult {
+	cfg.Conns = NewConnTracker()
+	if cfg.Trace == nil {
+		cfg.Trace = newTimingTrace()
+	}
+	goroutines := runtime.NumGoroutine()
+	result, returned := g.run(ctx, cfg, testFunc)
+	if result.Leak = checkLeaks(cfg.Conns, goroutines, cfg.Scaled(time.Second)); result.Leak != nil {
+		cfg.Log().Warn("test leaked", "test", result.Name, "leak", result.Leak.String())
+	}
+	result.Timings = phaseTimings(cfg.Trace.Packets())
+	result.Timings.Teardown = time.Since(returned)
+	return result
+}
+
+// run runs the test between the hooks and returns its result and when the
+// test function returned
+func (g TestGroup) run(ctx context.Context, cfg Config, testFunc TestFunc) (TestResult, time.Time) {
+	if g.BeforeEach != nil {
+		if err := g.BeforeEach(&cfg); err != nil {
+			return TestResult{Name: testName(testFunc), Error: fmt.Errorf("before each: %w", err)}, time.Now()
+		}
+	}
+	result := testFunc(ctx, cfg)
+	returned := time.Now()
+	if g.AfterEach != nil {
+		if err := g.AfterEach(cfg); err != nil {
+			cfg.Log().Warn("after each failed", "test", result.Name, "error", err)
+			note := "after each: " + err.Error()
+			if result.Notes != "" {
+				note = result.Notes + "; " + note
+			}
+			result.Notes = note
+		}
+	}
+	return result, returned
+}
+
+// SetupFailed is the result of a test whose group's Setup failed
+func (g TestGroup) SetupFailed(testFunc TestFunc, err error) TestResult {
+	return TestResult{Name: testName(testFunc), Error: fmt.Errorf("group setup: %w", err)}
+}
+
+// HasAnyTag reports whether the group carries one of tags, or tags is empty
+func (g TestGroup) HasAnyTag(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		if slices.Contains(g.Tags, tag) {
+			return true
+		}
+	}
+	return false
 }
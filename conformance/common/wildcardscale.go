@@ -0,0 +1,223 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Size of the wildcard scale check: wildcardScaleFilters filters of each
+// kind, exact, + and #, subscribed wildcardScaleBatch to a SUBSCRIBE, and
+// wildcardScaleProbes probe indices published to
+const (
+	wildcardScaleFilters = 1000
+	wildcardScaleBatch   = 100
+	wildcardScaleProbes  = 20
+)
+
+// A broker's subscribing degraded when its last SUBACKs took more than
+// wildcardScaleSlowdown times as long as its first ones, and longer than
+// wildcardScaleSlow scaled by the timing multiplier
+const (
+	wildcardScaleSlowdown = 10
+	wildcardScaleSlow     = 50 * time.Millisecond
+)
+
+// WildcardScale is how a broker coped with one client holding thousands of
+// subscriptions
+type WildcardScale struct {
+	Filters      int             // Subscriptions the client held
+	Subacks      []time.Duration // Latency of each SUBSCRIBE's SUBACK, in order
+	Refused      int             // Filters refused, counting from the first refusal
+	RefusedCode  byte            // Return or reason code of the first refusal
+	Probes       int             // Topics published to
+	Matching     int             // Probes the model expected to be delivered
+	Divergences  []string        // Probes delivered though no filter matched, or missed
+	LateSlowdown float64         // Last SUBACKs' mean latency over the first ones'
+}
+
+// String describes the subscription latencies for notes
+func (s WildcardScale) String() string {
+	if len(s.Subacks) == 0 {
+		return fmt.Sprintf("%d filters", s.Filters)
+	}
+	return fmt.Sprintf("%d filters in %d SUBSCRIBEs, SUBACK latency first %v, last %v, max %v (%.1f× slower at the end), %d of %d probes matched",
+		s.Filters, len(s.Subacks), s.Subacks[0].Round(time.Microsecond), s.Subacks[len(s.Subacks)-1].Round(time.Microsecond),
+		slices.Max(s.Subacks).Round(time.Microsecond), s.LateSlowdown, s.Matching, s.Probes)
+}
+
+// Degraded reports whether SUBACKs got markedly slower as the client's
+// subscriptions grew
+func (s WildcardScale) Degraded(cfg Config) bool {
+	return s.LateSlowdown > wildcardScaleSlowdown && s.Subacks[len(s.Subacks)-1] > cfg.Scaled(wildcardScaleSlow)
+}
+
+// wildcardScaleFilter returns filter i of the check below prefix: exact
+// filters first, then + filters, then # filters
+func wildcardScaleFilter(prefix string, i int) string {
+	n := strconv.Itoa(i % wildcardScaleFilters)
+	switch i / wildcardScaleFilters {
+	case 0:
+		return prefix + "/exact/" + n
+	case 1:
+		return prefix + "/plus/" + n + "/+/end"
+	default:
+		return prefix + "/hash/" + n + "/#"
+	}
+}
+
+// wildcardScaleTopics returns the probe topics for index n, which match a
+// filter of the check when n is below wildcardScaleFilters and miss by a
+// level otherwise
+func wildcardScaleTopics(prefix string, n int) []string {
+	s := strconv.Itoa(n)
+	return []string{
+		prefix + "/exact/" + s,
+		prefix + "/exact/" + s + "/end",
+		prefix + "/plus/" + s + "/x/end",
+		prefix + "/plus/" + s + "/end",
+		prefix + "/plus/" + s + "/x/y/end",
+		prefix + "/hash/" + s,
+		prefix + "/hash/" + s + "/x/y",
+		prefix + "/hashes/" + s,
+	}
+}
+
+// CheckWildcardScale subscribes one raw connection at protocol level to
+// thousands of distinct exact, + and # filters below one prefix, timing each
+// SUBACK, then publishes probes that match some of the filters and just miss
+// others and checks which the client received against MatchTopic. Brokers
+// whose topic tree degrades with many filters show it in the SUBACK
+// latencies. A refused subscription, e.g. over a subscription quota, ends
+// the subscribing and is reported in Refused; an error means the check
+// could not be carried out.
+func CheckWildcardScale(cfg Config, level byte) (WildcardScale, error) {
+	var scale WildcardScale
+	prefix := cfg.Topic(GenerateTopicName("test/wildcard-scale"))
+	timeout := cfg.Scaled(10 * time.Second)
+
+	sub, err := DialRaw(cfg, level, cfg.ClientID("test-wildcard-scale-sub"))
+	if err != nil {
+		return scale, fmt.Errorf("subscriber connect failed: %w", err)
+	}
+	defer sub.Close()
+
+	var filters []string
+	total := 3 * wildcardScaleFilters
+	for first := 0; first < total && scale.Refused == 0; first += wildcardScaleBatch {
+		batch := make([]string, 0, wildcardScaleBatch)
+		for i := first; i < min(first+wildcardScaleBatch, total); i++ {
+			batch = append(batch, wildcardScaleFilter(prefix, i))
+		}
+		sent := time.Now()
+		codes, err := sub.Subscribe(uint16(len(scale.Subacks)+1), 1, timeout, batch...)
+		if err != nil {
+			return scale, fmt.Errorf("subscribe to filters %d to %d failed: %w", first, first+len(batch)-1, err)
+		}
+		scale.Subacks = append(scale.Subacks, time.Since(sent))
+		if len(codes) != len(batch) {
+			return scale, fmt.Errorf("SUBACK with %d codes for %d filters", len(codes), len(batch))
+		}
+		for i, code := range codes {
+			if code >= 0x80 {
+				if scale.Refused == 0 {
+					scale.RefusedCode = code
+				}
+				scale.Refused++
+				continue
+			}
+			filters = append(filters, batch[i])
+		}
+	}
+	scale.Filters = len(filters)
+	if n := min(3, len(scale.Subacks)/2); n > 0 {
+		mean := func(d []time.Duration) time.Duration {
+			var sum time.Duration
+			for _, x := range d {
+				sum += x
+			}
+			return sum / time.Duration(len(d))
+		}
+		firstMean := max(mean(scale.Subacks[:n]), time.Microsecond)
+		scale.LateSlowdown = float64(mean(scale.Subacks[len(scale.Subacks)-n:])) / float64(firstMean)
+	}
+
+	pub, err := DialRaw(cfg, level, cfg.ClientID("test-wildcard-scale-pub"))
+	if err != nil {
+		return scale, fmt.Errorf("publisher connect failed: %w", err)
+	}
+	defer pub.Close()
+
+	// Probe indices spread over the filters, and as many past them that
+	// only miss by their index
+	var topics []string
+	for p := range wildcardScaleProbes {
+		n := p * wildcardScaleFilters / wildcardScaleProbes
+		topics = append(topics, wildcardScaleTopics(prefix, n)...)
+		topics = append(topics, wildcardScaleTopics(prefix, n+wildcardScaleFilters)...)
+	}
+	expected := make([]bool, len(topics))
+	for i, t := range topics {
+		expected[i] = slices.ContainsFunc(filters, func(f string) bool { return MatchTopic(f, t) })
+		if expected[i] {
+			scale.Matching++
+		}
+	}
+	scale.Probes = len(topics)
+	for i, t := range topics {
+		reason, err := pub.PublishAcked(t, 1, uint16(i+1), []byte(strconv.Itoa(i)), timeout)
+		if err != nil {
+			return scale, fmt.Errorf("publish to %s failed: %w", t, err)
+		}
+		if reason >= 0x80 {
+			return scale, fmt.Errorf("publish to %s refused with 0x%02x", t, reason)
+		}
+	}
+
+	// Wait for the expected probes, then a short quiet period for probes
+	// that should not arrive
+	received := make([]bool, len(topics))
+	receivedCount := 0
+	deadline := time.Now().Add(cfg.Scaled(5 * time.Second))
+	for {
+		wait := time.Until(deadline)
+		if receivedCount >= scale.Matching || wait <= 0 {
+			wait = cfg.Scaled(200 * time.Millisecond)
+		}
+		header, body, err := sub.Expect(0x30, wait, nil)
+		if errors.Is(err, ErrBrokerClosed) {
+			return scale, err
+		}
+		if err != nil {
+			break
+		}
+		p, err := sub.ParsePublish(header, body)
+		if err != nil {
+			return scale, fmt.Errorf("delivered PUBLISH unreadable: %w", err)
+		}
+		if p.QoS > 0 {
+			sub.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+		}
+		i, err := strconv.Atoi(string(p.Payload))
+		if err != nil || i < 0 || i >= len(topics) || p.Topic != topics[i] {
+			scale.Divergences = append(scale.Divergences, fmt.Sprintf("received a message that was not published: %+q on %+q", p.Payload, p.Topic))
+			continue
+		}
+		if !received[i] && expected[i] {
+			receivedCount++
+		}
+		if !received[i] && !expected[i] {
+			scale.Divergences = append(scale.Divergences, fmt.Sprintf("%s delivered, no filter matches it", topics[i]))
+		}
+		received[i] = true
+	}
+	for i, t := range topics {
+		if expected[i] && !received[i] {
+			scale.Divergences = append(scale.Divergences, fmt.Sprintf("%s not delivered", t))
+		}
+	}
+	return scale, nil
+}
@@ -0,0 +1,146 @@
+// Package gotest runs the conformance suites as Go subtests, one per group
+// and test, so the standard go test tooling applies:
+//
+//	go test ./conformance/gotest -run 'TestConformance/v5/Topics' -broker tcp://localhost:1883
+//
+// Failed tests fail their subtest, skipped and inconclusive tests are
+// reported as skipped and warnings are logged.
+package gotest
+
+import (
+	"testing"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/conformance/sparkplug"
+	v3 "github.com/bromq-dev/testmqtt/conformance/v3"
+	v5 "github.com/bromq-dev/testmqtt/conformance/v5"
+)
+
+// Suites returns the conformance suites by subtest name
+func Suites() map[string]common.Suite {
+	return map[string]common.Suite{
+		"v3":        v3.Suite(),
+		"v5":        v5.Suite(),
+		"sparkplug": sparkplug.Suite(),
+	}
+}
+
+// RunAll runs every suite as a subtest named after its protocol version,
+// or sparkplug
+func RunAll(t *testing.T, cfg common.Config) {
+	suites := Suites()
+	for _, name := range []string{"v3", "v5", "sparkplug"} {
+		t.Run(name, func(t *testing.T) {
+			Run(t, suites[name], cfg)
+		})
+	}
+}
+
+// Run runs the groups of a suite as subtests. Test names are only known
+// once a test has run, so they are collected up front the same way the
+// coverage report collects spec references.
+func Run(t *testing.T, suite common.Suite, cfg common.Config) {
+	refs, err := common.CollectTestRefs(suite.Groups)
+	if err != nil {
+		t.Fatalf("failed to collect test names: %v", err)
+	}
+
+	if suite.Preflight != nil {
+		if err := common.WaitReady(func() error { return suite.Preflight(&cfg) }, cfg.ReadyTimeout, nil); err != nil {
+			t.Fatalf("preflight check failed: %v\n%s", err, common.Diagnose(cfg.Broker, err))
+		}
+	}
+	if suite.PubSubCheck != nil {
+		if err := suite.PubSubCheck(cfg); err != nil {
+			t.Fatalf("publish/subscribe check failed: %v\n%s", err, common.Diagnose(cfg.Broker, err))
+		}
+	}
+	if cfg.TimingMultiplier <= 0 {
+		multiplier, rtt, err := common.CalibrateTiming(cfg)
+		if err != nil {
+			t.Logf("timing calibration failed, using unscaled waits: %v", err)
+		} else {
+			t.Logf("round trip %v, waits ×%.1f", rtt, multiplier)
+		}
+		cfg.TimingMultiplier = multiplier
+	}
+	if cfg.TopicNamespace == "" {
+		cfg.TopicNamespace = common.NewTopicNamespace()
+	}
+	cfg.Sessions = common.NewSessionLog()
+	if suite.Cleanup != nil && !cfg.SkipCleanup {
+		t.Cleanup(func() {
+			res, err := suite.Cleanup(cfg, cfg.Sessions.ClientIDs())
+			if err != nil {
+				t.Logf("cleanup failed: %v", err)
+				return
+			}
+			for _, err := range res.Errors {
+				t.Logf("cleanup incomplete: %v", err)
+			}
+		})
+	}
+	t.Logf("topic namespace %s", cfg.TopicNamespace)
+
+	i := 0
+	for _, group := range suite.Groups {
+		tests := make([]common.TestFunc, len(group.Tests))
+		names := make([]string, len(group.Tests))
+		for j, fn := range group.Tests {
+			tests[j] = fn
+			names[j] = refs[i].Name
+			i++
+		}
+
+		t.Run(group.Name, func(t *testing.T) {
+			cfg := cfg
+			if group.Setup != nil {
+				if err := group.Setup(&cfg); err != nil {
+					t.Fatalf("group setup failed: %v", err)
+				}
+			}
+			if group.Teardown != nil {
+				t.Cleanup(func() {
+					if err := group.Teardown(cfg); err != nil {
+						t.Logf("group teardown failed: %v", err)
+					}
+				})
+			}
+			for j, fn := range tests {
+				t.Run(names[j], func(t *testing.T) {
+					report(t, common.RetryTest(cfg, func(cfg common.Config, _ int) common.TestResult {
+						return group.Run(t.Context(), cfg, fn)
+					}))
+				})
+			}
+		})
+	}
+}
+
+// report translates a conformance result into the subtest's outcome
+func report(t *testing.T, result common.TestResult) {
+	t.Helper()
+	if result.SpecRef != "" {
+		t.Logf("[%s] %s (%v)", result.SpecRef, result.Name, result.Duration)
+	}
+	if summary := result.AttemptSummary(); summary != "" {
+		t.Log(summary)
+	}
+	if result.Leak != nil {
+		t.Logf("leaked %s", result.Leak)
+	}
+	switch result.Status {
+	case common.StatusPassed:
+	case common.StatusWarning:
+		t.Logf("warning: %s", result.Notes)
+	case common.StatusSkipped:
+		t.Skip(result.Notes)
+	case common.StatusInconclusive:
+		t.Skipf("inconclusive: %s", result.Notes)
+	default:
+		if result.Notes != "" {
+			t.Log(result.Notes)
+		}
+		t.Errorf("%v", result.Error)
+	}
+}
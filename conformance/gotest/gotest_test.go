@@ -0,0 +1,27 @@
+package gotest
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+var (
+	broker   = flag.String("broker", "", "Broker URL to run the conformance suites against, e.g. tcp://localhost:1883")
+	username = flag.String("username", "", "MQTT username")
+	password = flag.String("password", "", "MQTT password")
+	retries  = flag.Int("retries", 0, "Retry a failed test this many times")
+)
+
+func TestConformance(t *testing.T) {
+	if *broker == "" {
+		t.Skip("no broker given, run with -broker tcp://host:port")
+	}
+	RunAll(t, common.Config{
+		Broker:   *broker,
+		Username: *username,
+		Password: *password,
+		Retries:  *retries,
+	})
+}
@@ -0,0 +1,316 @@
+package sparkplug
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// namespace is the first topic level of every Sparkplug B topic
+const namespace = "spBv1.0"
+
+// Metric names defined by the specification
+const (
+	metricBdSeq   = "bdSeq"
+	metricRebirth = "Node Control/Rebirth"
+)
+
+// Sparkplug B runs over MQTT 3.1.1 here, the version every Sparkplug
+// infrastructure supports
+const level = 4
+
+// runID turns the run's topic namespace into a string usable as a single
+// topic level, as Sparkplug group, edge node and host IDs are. Every ID the
+// tests use starts with it, so cleanup can find what a run left behind.
+func runID(cfg common.Config) string {
+	return strings.NewReplacer("/", "-", "+", "-", "#", "-").Replace(cfg.TopicNamespace)
+}
+
+// scopedID returns a Group ID or Host Application ID unique to the run for
+// the test named name
+func scopedID(cfg common.Config, name string) string {
+	return runID(cfg) + "-" + name
+}
+
+// nodeTopic returns the topic of a message type sent by or to an Edge Node,
+// or one of its devices when device is not empty
+func nodeTopic(group, msgType, node, device string) string {
+	t := namespace + "/" + group + "/" + msgType + "/" + node
+	if device != "" {
+		t += "/" + device
+	}
+	return t
+}
+
+// stateTopic returns the STATE topic of a Primary Host Application
+func stateTopic(host string) string {
+	return namespace + "/STATE/" + host
+}
+
+func now() uint64 {
+	return uint64(time.Now().UnixMilli())
+}
+
+// bdSeqMetric returns the bdSeq metric for birth/death sequence number n
+func bdSeqMetric(n uint64) Metric {
+	return Metric{Name: metricBdSeq, DataType: DataTypeInt64, Long: n}
+}
+
+// edgeNode is a simulated Sparkplug B Edge Node on a raw MQTT 3.1.1
+// connection, with its NDEATH registered as Will Message
+type edgeNode struct {
+	conn  *common.RawConn
+	group string
+	id    string
+	bdSeq uint64
+	seq   uint64 // Sequence number of the next message
+}
+
+// connectEdge connects an Edge Node whose NDEATH carries bdSeq. The NDEATH
+// is a QoS 1 Will Message without the retain flag, as the specification
+// requires.
+func connectEdge(cfg common.Config, group, id string, bdSeq uint64) (*edgeNode, error) {
+	return connectEdgeAs(cfg, cfg.ClientID("test-sparkplug-edge"), group, id, bdSeq)
+}
+
+// connectEdgeAs is connectEdge with a given client ID
+func connectEdgeAs(cfg common.Config, clientID, group, id string, bdSeq uint64) (*edgeNode, error) {
+	death := Payload{Timestamp: now(), Metrics: []Metric{bdSeqMetric(bdSeq)}}
+	conn, err := common.DialRawWill(cfg, level, clientID, &common.RawWill{
+		Topic:   nodeTopic(group, "NDEATH", id, ""),
+		Payload: death.Encode(),
+		QoS:     1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("edge node connect failed: %w", err)
+	}
+	return &edgeNode{conn: conn, group: group, id: id, bdSeq: bdSeq}, nil
+}
+
+// Close severs the connection without DISCONNECT, so the broker publishes
+// the NDEATH
+func (e *edgeNode) Close() {
+	e.conn.Close()
+}
+
+// send publishes a message of msgType at QoS 0 with the next sequence
+// number, wrapping from 255 to 0
+func (e *edgeNode) send(msgType, device string, metrics ...Metric) error {
+	p := Payload{Timestamp: now(), Metrics: metrics, Seq: e.seq, HasSeq: true}
+	e.seq = (e.seq + 1) % 256
+	if err := e.conn.Publish(nodeTopic(e.group, msgType, e.id, device), 0, 0, p.Encode()); err != nil {
+		return fmt.Errorf("failed to send %s: %w", msgType, err)
+	}
+	return nil
+}
+
+// birth publishes an NBIRTH with sequence number 0 and the node's bdSeq
+func (e *edgeNode) birth() error {
+	e.seq = 0
+	return e.send("NBIRTH", "", bdSeqMetric(e.bdSeq), Metric{Name: metricRebirth, DataType: DataTypeBoolean})
+}
+
+// message is a Sparkplug message received by a host
+type message struct {
+	Topic   string
+	QoS     byte
+	Retain  bool
+	Raw     []byte
+	Payload Payload // Decoded unless the topic is a STATE topic
+}
+
+// MsgType returns the message type level of a Sparkplug topic
+func (m message) MsgType() string {
+	levels := strings.Split(m.Topic, "/")
+	if len(levels) < 3 {
+		return ""
+	}
+	if levels[1] == "STATE" {
+		return "STATE"
+	}
+	return levels[2]
+}
+
+// String describes the message for failure output
+func (m message) String() string {
+	s := m.MsgType()
+	if bd, ok := m.Payload.BdSeq(); ok {
+		s += fmt.Sprintf(" bdSeq=%d", bd)
+	}
+	if m.Payload.HasSeq {
+		s += fmt.Sprintf(" seq=%d", m.Payload.Seq)
+	}
+	if m.MsgType() == "STATE" {
+		s += " " + string(m.Raw)
+	}
+	return s
+}
+
+// observer is a client subscribed to Sparkplug topics, e.g. a Host
+// Application, that reads what the broker delivers
+type observer struct {
+	conn *common.RawConn
+}
+
+// subscribe connects an observer subscribed to filters at QoS 1
+func subscribe(cfg common.Config, prefix string, filters ...string) (*observer, error) {
+	conn, err := common.DialRaw(cfg, level, cfg.ClientID(prefix))
+	if err != nil {
+		return nil, fmt.Errorf("subscriber connect failed: %w", err)
+	}
+	codes, err := conn.Subscribe(1, 1, cfg.Scaled(5*time.Second), filters...)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("subscribe failed: %w", err)
+	}
+	for i, c := range codes {
+		if c >= 0x80 {
+			conn.Close()
+			return nil, fmt.Errorf("subscription to %s refused with 0x%02x", filters[i], c)
+		}
+	}
+	return &observer{conn: conn}, nil
+}
+
+// Close disconnects the observer
+func (o *observer) Close() {
+	o.conn.Send(0xE0, nil)
+	o.conn.Close()
+}
+
+// errNoMessage is returned by next when nothing arrived in time
+var errNoMessage = errors.New("no message")
+
+// next reads the next PUBLISH within timeout and acknowledges it
+func (o *observer) next(timeout time.Duration) (message, error) {
+	header, body, err := o.conn.Expect(0x30, timeout, nil)
+	if errors.Is(err, common.ErrBrokerClosed) {
+		return message{}, err
+	}
+	if err != nil {
+		return message{}, errNoMessage
+	}
+	p, err := o.conn.ParsePublish(header, body)
+	if err != nil {
+		return message{}, err
+	}
+	if p.QoS > 0 {
+		o.conn.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+	}
+	m := message{Topic: p.Topic, QoS: p.QoS, Retain: header&0x01 != 0, Raw: p.Payload}
+	if m.MsgType() != "STATE" {
+		if m.Payload, err = DecodePayload(p.Payload); err != nil {
+			return m, fmt.Errorf("%s payload unreadable: %w", p.Topic, err)
+		}
+	}
+	return m, nil
+}
+
+// await reads messages until one of msgType arrives within timeout and
+// returns it with the messages read before it
+func (o *observer) await(msgType string, timeout time.Duration) (message, []message, error) {
+	deadline := time.Now().Add(timeout)
+	var before []message
+	for {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return message{}, before, fmt.Errorf("no %s within %v", msgType, timeout)
+		}
+		m, err := o.next(wait)
+		if errors.Is(err, errNoMessage) {
+			return message{}, before, fmt.Errorf("no %s within %v", msgType, timeout)
+		}
+		if err != nil {
+			return message{}, before, err
+		}
+		if m.MsgType() == msgType {
+			return m, before, nil
+		}
+		before = append(before, m)
+	}
+}
+
+// drain reads messages until none arrives for quiet
+func (o *observer) drain(quiet time.Duration) ([]message, error) {
+	var msgs []message
+	for {
+		m, err := o.next(quiet)
+		if errors.Is(err, errNoMessage) {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, m)
+	}
+}
+
+// state is the JSON payload of a STATE message
+type state struct {
+	Online    bool   `json:"online"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+func (s state) encode() []byte {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+func decodeState(m message) (state, error) {
+	var s state
+	if err := json.Unmarshal(m.Raw, &s); err != nil {
+		return s, fmt.Errorf("STATE payload %q is not valid JSON: %w", m.Raw, err)
+	}
+	return s, nil
+}
+
+// connectHost connects a Primary Host Application with its offline STATE,
+// stamped with timestamp, registered as a QoS 1 retained Will Message, and
+// publishes its online STATE with the same timestamp, QoS 1 and retained
+func connectHost(cfg common.Config, clientID, host string, timestamp uint64) (*common.RawConn, error) {
+	conn, err := common.DialRawWill(cfg, level, clientID, &common.RawWill{
+		Topic:   stateTopic(host),
+		Payload: state{Online: false, Timestamp: timestamp}.encode(),
+		QoS:     1,
+		Retain:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("host connect failed: %w", err)
+	}
+	if err := publishRetained(cfg, conn, stateTopic(host), state{Online: true, Timestamp: timestamp}.encode()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("host STATE birth failed: %w", err)
+	}
+	return conn, nil
+}
+
+// publishRetained publishes a retained QoS 1 message and waits for its
+// PUBACK
+func publishRetained(cfg common.Config, conn *common.RawConn, topic string, payload []byte) error {
+	body := common.AppendString(nil, topic)
+	body = binary.BigEndian.AppendUint16(body, 1)
+	body = append(body, payload...)
+	if err := conn.Send(0x33, body); err != nil {
+		return err
+	}
+	_, _, err := conn.Expect(0x40, cfg.Scaled(5*time.Second), nil)
+	return err
+}
+
+// seqBreaks returns where the sequence numbers of msgs do not go up by one,
+// wrapping from 255 to 0
+func seqBreaks(msgs []message) []string {
+	var breaks []string
+	for i := 1; i < len(msgs); i++ {
+		prev, cur := msgs[i-1].Payload, msgs[i].Payload
+		if want := (prev.Seq + 1) % 256; cur.Seq != want {
+			breaks = append(breaks, fmt.Sprintf("%s after %s (expected seq=%d)", msgs[i], msgs[i-1], want))
+		}
+	}
+	return breaks
+}
@@ -0,0 +1,301 @@
+package sparkplug
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// LifecycleTests returns tests of the NBIRTH/NDEATH lifecycle of an Edge
+// Node as a Host Application sees it through the broker
+func LifecycleTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Edge Node Lifecycle",
+		Tags: []string{"sparkplug", "will"},
+		Tests: []common.TestFunc{
+			testNBIRTHDelivered,
+			testNDEATHWill,
+			testNDEATHNotRetained,
+			testBdSeqAcrossReconnects,
+		},
+	}
+}
+
+// testNBIRTHDelivered tests that an NBIRTH published at QoS 0 without the
+// retain flag reaches a Host Application intact, with its bdSeq and
+// sequence number 0 [tck-id-conformance-mqtt-qos0]
+// A Sparkplug Compliant MQTT Server must support publish and subscribe on
+// QoS 0.
+func testNBIRTHDelivered(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "NBIRTH Delivered Intact",
+		SpecRef: "tck-id-conformance-mqtt-qos0",
+		Level:   spec.LevelMust,
+	}
+
+	group := scopedID(cfg, "nbirth")
+	host, err := subscribe(cfg, "test-sparkplug-host", nodeTopic(group, "+", "+", ""))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer host.Close()
+
+	edge, err := connectEdge(cfg, group, "edge1", 7)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer edge.Close()
+	if err := edge.birth(); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	m, _, err := host.await("NBIRTH", cfg.Scaled(5*time.Second))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	bd, ok := m.Payload.BdSeq()
+	rebirth, hasRebirth := m.Payload.Metric(metricRebirth)
+	switch {
+	case m.Retain:
+		result.Error = fmt.Errorf("NBIRTH published without the retain flag was delivered with it")
+	case !ok || bd != 7:
+		result.Error = fmt.Errorf("NBIRTH delivered with %s, expected bdSeq=7", m)
+	case !m.Payload.HasSeq || m.Payload.Seq != 0:
+		result.Error = fmt.Errorf("NBIRTH delivered with %s, expected seq=0", m)
+	case !hasRebirth || rebirth.DataType != DataTypeBoolean:
+		result.Error = fmt.Errorf("NBIRTH delivered without its %s metric", metricRebirth)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = m.String()
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testNDEATHWill tests that when an Edge Node's connection is lost, the
+// broker publishes its NDEATH Will Message at QoS 1 with the bdSeq of the
+// NBIRTH that preceded it [tck-id-conformance-mqtt-will-messages]
+// A Sparkplug Compliant MQTT Server must support MQTT Will Messages.
+func testNDEATHWill(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "NDEATH Will on Connection Loss",
+		SpecRef: "tck-id-conformance-mqtt-will-messages",
+		Level:   spec.LevelMust,
+	}
+
+	group := scopedID(cfg, "ndeath")
+	host, err := subscribe(cfg, "test-sparkplug-host", nodeTopic(group, "+", "+", ""))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer host.Close()
+
+	edge, err := connectEdge(cfg, group, "edge1", 3)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if err := edge.birth(); err != nil {
+		edge.Close()
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	birth, _, err := host.await("NBIRTH", cfg.Scaled(5*time.Second))
+	if err != nil {
+		edge.Close()
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	edge.Close()
+
+	death, _, err := host.await("NDEATH", cfg.Scaled(5*time.Second))
+	if err != nil {
+		result.Error = fmt.Errorf("NDEATH Will Message not published after the connection was lost: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	birthSeq, _ := birth.Payload.BdSeq()
+	deathSeq, ok := death.Payload.BdSeq()
+	switch {
+	case death.QoS != 1:
+		result.Error = fmt.Errorf("NDEATH delivered at QoS %d to a QoS 1 subscription, expected the QoS 1 of the Will Message", death.QoS)
+	case !ok:
+		result.Error = fmt.Errorf("NDEATH delivered without its bdSeq metric")
+	case deathSeq != birthSeq:
+		result.Error = fmt.Errorf("NDEATH delivered with bdSeq=%d, NBIRTH had bdSeq=%d", deathSeq, birthSeq)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("%s, then %s", birth, death)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testNDEATHNotRetained tests that the NDEATH Will Message, registered
+// without the retain flag, is not retained, so a Host Application that
+// subscribes later is not told a node died that it never saw born
+// [tck-id-payloads-ndeath-will-message-retain]
+// The NDEATH Will Message must be registered with the retain flag set to
+// false.
+func testNDEATHNotRetained(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "NDEATH Not Retained",
+		SpecRef: "tck-id-payloads-ndeath-will-message-retain",
+		Level:   spec.LevelMust,
+	}
+
+	group := scopedID(cfg, "ndeath-retain")
+	host, err := subscribe(cfg, "test-sparkplug-host", nodeTopic(group, "NDEATH", "+", ""))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer host.Close()
+
+	edge, err := connectEdge(cfg, group, "edge1", 0)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if err := edge.birth(); err != nil {
+		edge.Close()
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	edge.Close()
+	death, _, err := host.await("NDEATH", cfg.Scaled(5*time.Second))
+	if err != nil {
+		result.Error = fmt.Errorf("NDEATH Will Message not published: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	if death.Retain {
+		result.Error = fmt.Errorf("NDEATH delivered live with the retain flag set")
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	late, err := subscribe(cfg, "test-sparkplug-late", nodeTopic(group, "NDEATH", "+", ""))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer late.Close()
+	msgs, err := late.drain(cfg.Scaled(time.Second))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if len(msgs) > 0 {
+		result.Error = fmt.Errorf("a later subscription received a retained %s", msgs[0])
+	} else {
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testBdSeqAcrossReconnects tests that over three sessions of an Edge Node,
+// with bdSeq 0, 1 and 2, a Host Application receives each NBIRTH followed by
+// the NDEATH with the same bdSeq, in order [tck-id-payloads-ndeath-bdseq]
+// The NDEATH must include the bdSeq metric with the value of the NBIRTH of
+// the same session.
+func testBdSeqAcrossReconnects(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "bdSeq Across Reconnects",
+		SpecRef: "tck-id-payloads-ndeath-bdseq",
+		Level:   spec.LevelMust,
+	}
+
+	group := scopedID(cfg, "bdseq")
+	host, err := subscribe(cfg, "test-sparkplug-host", nodeTopic(group, "+", "+", ""))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer host.Close()
+
+	// Every session reuses the client ID, as an Edge Node does
+	clientID := cfg.ClientID("test-sparkplug-edge")
+	var seen []message
+	for bdSeq := range uint64(3) {
+		edge, err := connectEdgeAs(cfg, clientID, group, "edge1", bdSeq)
+		if err != nil {
+			result.Error = fmt.Errorf("session %d: %w", bdSeq, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+		if err := edge.birth(); err != nil {
+			edge.Close()
+			result.Error = err
+			result.Duration = time.Since(start)
+			return result
+		}
+		birth, before, err := host.await("NBIRTH", cfg.Scaled(5*time.Second))
+		seen = append(append(seen, before...), birth)
+		if err != nil {
+			edge.Close()
+			result.Error = fmt.Errorf("session %d: %w", bdSeq, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+		edge.Close()
+		death, before, err := host.await("NDEATH", cfg.Scaled(5*time.Second))
+		if err != nil {
+			result.Error = fmt.Errorf("session %d: %w", bdSeq, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+		seen = append(append(seen, before...), death)
+	}
+
+	var got, want []string
+	for bdSeq := range 3 {
+		want = append(want, fmt.Sprintf("NBIRTH bdSeq=%d", bdSeq), fmt.Sprintf("NDEATH bdSeq=%d", bdSeq))
+	}
+	for _, m := range seen {
+		s := m.MsgType()
+		if bd, ok := m.Payload.BdSeq(); ok {
+			s += fmt.Sprintf(" bdSeq=%d", bd)
+		}
+		got = append(got, s)
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		result.Error = fmt.Errorf("host received %s, expected %s", strings.Join(got, ", "), strings.Join(want, ", "))
+	} else {
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
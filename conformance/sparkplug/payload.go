@@ -0,0 +1,197 @@
+package sparkplug
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Sparkplug B metric datatypes used by the tests
+const (
+	DataTypeInt64   uint32 = 4
+	DataTypeBoolean uint32 = 11
+	DataTypeString  uint32 = 12
+)
+
+// Metric is a Sparkplug B metric with the value fields the tests use
+type Metric struct {
+	Name     string
+	DataType uint32
+	Long     uint64 // long_value, for Int64 and the unsigned types up to 64 bits
+	Bool     bool   // boolean_value
+	String   string // string_value
+}
+
+// Payload is the subset of the Sparkplug B protobuf Payload the tests send
+// and check. NDEATH carries no sequence number, so HasSeq tells whether Seq
+// was present.
+type Payload struct {
+	Timestamp uint64
+	Metrics   []Metric
+	Seq       uint64
+	HasSeq    bool
+}
+
+// Metric returns the metric called name
+func (p Payload) Metric(name string) (Metric, bool) {
+	for _, m := range p.Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Metric{}, false
+}
+
+// BdSeq returns the value of the bdSeq metric of an NBIRTH or NDEATH
+func (p Payload) BdSeq() (uint64, bool) {
+	m, ok := p.Metric(metricBdSeq)
+	return m.Long, ok
+}
+
+// Protocol Buffers wire types
+const (
+	wireVarint = 0
+	wire64     = 1
+	wireBytes  = 2
+	wire32     = 5
+)
+
+func appendTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wire))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	return binary.AppendUvarint(appendTag(b, field, wireVarint), v)
+}
+
+// Encode encodes the payload in the Sparkplug B protobuf format
+func (p Payload) Encode() []byte {
+	b := appendVarint(nil, 1, p.Timestamp)
+	for _, m := range p.Metrics {
+		b = appendBytes(b, 2, m.encode(p.Timestamp))
+	}
+	if p.HasSeq {
+		b = appendVarint(b, 3, p.Seq)
+	}
+	return b
+}
+
+func (m Metric) encode(timestamp uint64) []byte {
+	b := appendBytes(nil, 1, []byte(m.Name))
+	b = appendVarint(b, 3, timestamp)
+	b = appendVarint(b, 4, uint64(m.DataType))
+	switch m.DataType {
+	case DataTypeBoolean:
+		v := uint64(0)
+		if m.Bool {
+			v = 1
+		}
+		b = appendVarint(b, 14, v)
+	case DataTypeString:
+		b = appendBytes(b, 15, []byte(m.String))
+	default:
+		b = appendVarint(b, 11, m.Long)
+	}
+	return b
+}
+
+// field is one field read from a protobuf message
+type field struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+// readFields splits a protobuf message into its fields. Fixed-size fields
+// are read over but left empty.
+func readFields(b []byte) ([]field, error) {
+	var fields []field
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("malformed field tag")
+		}
+		b = b[n:]
+		f := field{num: int(tag >> 3)}
+		switch tag & 7 {
+		case wireVarint:
+			f.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, fmt.Errorf("malformed varint in field %d", f.num)
+			}
+		case wireBytes:
+			l, m := binary.Uvarint(b)
+			if m <= 0 || uint64(len(b)-m) < l {
+				return nil, fmt.Errorf("field %d overruns the message", f.num)
+			}
+			f.bytes = b[m : m+int(l)]
+			n = m + int(l)
+		case wire64:
+			n = 8
+		case wire32:
+			n = 4
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in field %d", tag&7, f.num)
+		}
+		if n > len(b) {
+			return nil, fmt.Errorf("field %d overruns the message", f.num)
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// DecodePayload decodes a Sparkplug B protobuf payload. Fields the tests do
+// not use are skipped.
+func DecodePayload(b []byte) (Payload, error) {
+	var p Payload
+	fields, err := readFields(b)
+	if err != nil {
+		return p, err
+	}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			p.Timestamp = f.varint
+		case 2:
+			m, err := decodeMetric(f.bytes)
+			if err != nil {
+				return p, err
+			}
+			p.Metrics = append(p.Metrics, m)
+		case 3:
+			p.Seq, p.HasSeq = f.varint, true
+		}
+	}
+	return p, nil
+}
+
+func decodeMetric(b []byte) (Metric, error) {
+	var m Metric
+	fields, err := readFields(b)
+	if err != nil {
+		return m, fmt.Errorf("metric: %w", err)
+	}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			m.Name = string(f.bytes)
+		case 4:
+			m.DataType = uint32(f.varint)
+		case 11:
+			m.Long = f.varint
+		case 14:
+			m.Bool = f.varint != 0
+		case 15:
+			m.String = string(f.bytes)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,123 @@
+// Package sparkplug tests the broker behavior Sparkplug B 3.0 relies on:
+// the NBIRTH/NDEATH lifecycle of Edge Nodes with their bdSeq, the ordering
+// of sequence numbered messages and the retained STATE of the Primary Host
+// Application. The tests play Edge Node and Host Application over MQTT 3.1.1
+// against the broker under test.
+package sparkplug
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// Spec names the specification the tests' references point into. Its
+// statements are not indexed by the spec package, so every test sets its
+// normative level itself.
+const Spec = "sparkplug-b-3.0"
+
+// AllTestGroups returns all Sparkplug B test groups
+func AllTestGroups() []common.TestGroup {
+	return []common.TestGroup{
+		LifecycleTests(),
+		SequenceTests(),
+		StateTests(),
+	}
+}
+
+// Suite returns the Sparkplug B conformance suite
+func Suite() common.Suite {
+	return common.Suite{
+		Title:       "Sparkplug B 3.0 Conformance Tests",
+		Spec:        Spec,
+		Groups:      AllTestGroups(),
+		Cleanup:     Cleanup,
+		Preflight:   preflight,
+		PubSubCheck: checkPubSub,
+	}
+}
+
+// RunTests executes Sparkplug B conformance tests
+func RunTests(cfg common.Config, filter string, verbose bool) (*common.Report, error) {
+	return common.RunSuite(Suite(), cfg, filter, verbose)
+}
+
+// preflight checks the broker accepts an MQTT 3.1.1 connection
+func preflight(cfg *common.Config) error {
+	conn, err := common.DialRaw(*cfg, level, cfg.ClientID("test-preflight"))
+	if err != nil {
+		return err
+	}
+	conn.Send(0xE0, nil)
+	conn.Close()
+	return nil
+}
+
+// checkPubSub verifies a QoS 1 message published to a Sparkplug topic
+// reaches a subscriber
+func checkPubSub(cfg common.Config) error {
+	conn, err := common.DialRaw(cfg, level, cfg.ClientID("test-pubsub-check"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.RoundTrip(nodeTopic(scopedID(cfg, "check"), "NDATA", "edge1", ""), cfg.Scaled(5*time.Second))
+}
+
+// retainedQuietPeriod is how long no further retained message may arrive
+// before the Sparkplug topics count as fully read
+const retainedQuietPeriod = 500 * time.Millisecond
+
+// Cleanup clears the retained messages on Sparkplug topics whose group or
+// host ID belongs to the run, i.e. the STATE messages of the tests and any
+// NDEATH a broker retained. The tests create no persistent sessions, so
+// clientIDs are not used.
+func Cleanup(cfg common.Config, clientIDs []string) (*common.CleanupResult, error) {
+	if cfg.TopicNamespace == "" {
+		return nil, fmt.Errorf("no topic namespace to clean up")
+	}
+	res := &common.CleanupResult{}
+	prefix := runID(cfg)
+
+	conn, err := common.DialRaw(cfg, level, cfg.ClientID("cleanup"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Subscribe(1, 0, 5*time.Second, namespace+"/#"); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s/#: %w", namespace, err)
+	}
+
+	var topics []string
+	for {
+		header, body, err := conn.Expect(0x30, retainedQuietPeriod, nil)
+		if errors.Is(err, common.ErrBrokerClosed) {
+			return nil, err
+		}
+		if err != nil {
+			break
+		}
+		p, err := conn.ParsePublish(header, body)
+		if err != nil {
+			return nil, err
+		}
+		levels := strings.Split(p.Topic, "/")
+		ours := len(levels) >= 3 && (strings.HasPrefix(levels[1], prefix) || levels[1] == "STATE" && strings.HasPrefix(levels[2], prefix))
+		if header&0x01 != 0 && len(p.Payload) > 0 && ours {
+			topics = append(topics, p.Topic)
+		}
+	}
+
+	for _, topic := range topics {
+		if err := conn.Send(0x31, common.AppendString(nil, topic)); err != nil {
+			res.Errors = append(res.Errors, fmt.Errorf("clear retained %s: %w", topic, err))
+			continue
+		}
+		res.Retained = append(res.Retained, topic)
+	}
+	conn.Send(0xE0, nil)
+	return res, nil
+}
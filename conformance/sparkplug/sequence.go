@@ -0,0 +1,242 @@
+package sparkplug
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// SequenceTests returns tests of the sequence numbers an Edge Node puts on
+// its messages, which a Host Application relies on the broker to deliver in
+// order
+func SequenceTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Sequence Numbers",
+		Tags: []string{"sparkplug", "ordering"},
+		Tests: []common.TestFunc{
+			testSeqThroughWraparound,
+			testRebirthRequest,
+		},
+	}
+}
+
+// seqMessages is how many DDATA messages testSeqThroughWraparound sends,
+// enough to wrap the sequence number once
+const seqMessages = 300
+
+// testSeqThroughWraparound tests that NBIRTH, two DBIRTHs and DDATA for both
+// devices reach a Host Application subscribed to the group in the order the
+// Edge Node sent them, so their sequence numbers go up by one and wrap from
+// 255 to 0 [tck-id-payloads-sequence-num-incrementing]
+// Every message after the NBIRTH must carry the sequence number of the
+// previous message plus one, wrapping after 255.
+func testSeqThroughWraparound(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Sequence Order Through Wraparound",
+		SpecRef: "tck-id-payloads-sequence-num-incrementing",
+		Level:   spec.LevelMust,
+	}
+
+	group := scopedID(cfg, "seq")
+	host, err := subscribe(cfg, "test-sparkplug-host", namespace+"/"+group+"/#")
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer host.Close()
+
+	edge, err := connectEdge(cfg, group, "edge1", 0)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer edge.Close()
+
+	devices := []string{"dev1", "dev2"}
+	err = edge.birth()
+	for _, d := range devices {
+		if err == nil {
+			err = edge.send("DBIRTH", d, Metric{Name: "counter", DataType: DataTypeInt64})
+		}
+	}
+	for i := range seqMessages {
+		if err != nil {
+			break
+		}
+		err = edge.send("DDATA", devices[i%len(devices)], Metric{Name: "counter", DataType: DataTypeInt64, Long: uint64(i)})
+	}
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	sent := 1 + len(devices) + seqMessages
+	var msgs []message
+	deadline := time.Now().Add(cfg.Scaled(10 * time.Second))
+	for len(msgs) < sent && time.Now().Before(deadline) {
+		more, err := host.drain(cfg.Scaled(time.Second))
+		if err != nil {
+			result.Error = err
+			result.Duration = time.Since(start)
+			return result
+		}
+		if len(more) == 0 {
+			break
+		}
+		msgs = append(msgs, more...)
+	}
+
+	// A device's DDATA must not overtake its DBIRTH
+	born := map[string]bool{}
+	var early []string
+	for _, m := range msgs {
+		levels := strings.Split(m.Topic, "/")
+		device := levels[len(levels)-1]
+		switch m.MsgType() {
+		case "DBIRTH":
+			born[device] = true
+		case "DDATA":
+			if !born[device] {
+				early = append(early, fmt.Sprintf("%s for %s", m, device))
+			}
+		}
+	}
+
+	breaks := seqBreaks(msgs)
+	switch {
+	case len(msgs) == 0:
+		result.Error = fmt.Errorf("host received none of the %d messages", sent)
+	case msgs[0].MsgType() != "NBIRTH":
+		result.Error = fmt.Errorf("host received %s first, expected the NBIRTH", msgs[0])
+	case len(early) > 0:
+		result.Error = fmt.Errorf("DDATA delivered before its DBIRTH: %s", early[0])
+	case len(msgs) > sent:
+		result.Error = fmt.Errorf("host received %d messages, %d were sent", len(msgs), sent)
+	case len(breaks) > 0 && len(msgs) == sent:
+		result.Error = fmt.Errorf("messages delivered out of order, %d sequence breaks, first: %s", len(breaks), breaks[0])
+	case len(breaks) > 0:
+		// QoS 0 messages may be lost, but a Host Application then has to
+		// request a rebirth
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("%d of %d QoS 0 messages delivered, first sequence break: %s", len(msgs), sent, breaks[0])
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("%d messages, sequence numbers wrapped %d time(s)", len(msgs), len(msgs)/256)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRebirthRequest tests that a Node Control/Rebirth NCMD from a Host
+// Application reaches the Edge Node, and that the NBIRTH it answers with
+// reaches the host with sequence number 0 and the bdSeq of the session
+// [tck-id-conformance-mqtt-qos0]
+// A Sparkplug Compliant MQTT Server must support publish and subscribe on
+// QoS 0.
+func testRebirthRequest(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Rebirth Request",
+		SpecRef: "tck-id-conformance-mqtt-qos0",
+		Level:   spec.LevelMust,
+	}
+
+	group := scopedID(cfg, "rebirth")
+	host, err := subscribe(cfg, "test-sparkplug-host", namespace+"/"+group+"/#")
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer host.Close()
+
+	edge, err := connectEdge(cfg, group, "edge1", 5)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer edge.Close()
+	ncmd := nodeTopic(group, "NCMD", "edge1", "")
+	if codes, err := edge.conn.Subscribe(1, 0, cfg.Scaled(5*time.Second), ncmd); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		result.Error = fmt.Errorf("edge node subscription to its NCMD topic failed: %v % x", err, codes)
+		result.Duration = time.Since(start)
+		return result
+	}
+	err = edge.birth()
+	for i := range 3 {
+		if err == nil {
+			err = edge.send("NDATA", "", Metric{Name: "counter", DataType: DataTypeInt64, Long: uint64(i)})
+		}
+	}
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if _, _, err := host.await("NBIRTH", cfg.Scaled(5*time.Second)); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	cmd := Payload{Timestamp: now(), Metrics: []Metric{{Name: metricRebirth, DataType: DataTypeBoolean, Bool: true}}}
+	if err := host.conn.Publish(ncmd, 0, 0, cmd.Encode()); err != nil {
+		result.Error = fmt.Errorf("failed to send NCMD: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	node := &observer{conn: edge.conn}
+	m, _, err := node.await("NCMD", cfg.Scaled(5*time.Second))
+	if err != nil {
+		result.Error = fmt.Errorf("edge node did not receive the rebirth NCMD: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	if r, ok := m.Payload.Metric(metricRebirth); !ok || !r.Bool {
+		result.Error = fmt.Errorf("NCMD delivered without %s=true", metricRebirth)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	if err := edge.birth(); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	rebirth, before, err := host.await("NBIRTH", cfg.Scaled(5*time.Second))
+	if err != nil {
+		result.Error = fmt.Errorf("host did not receive the new NBIRTH: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	// The host also receives its own NCMD
+	data := 0
+	for _, m := range before {
+		if m.MsgType() == "NDATA" {
+			data++
+		}
+	}
+	bd, _ := rebirth.Payload.BdSeq()
+	switch {
+	case rebirth.Payload.Seq != 0 || bd != 5:
+		result.Error = fmt.Errorf("new NBIRTH delivered as %s, expected bdSeq=5 seq=0", rebirth)
+	case data != 3:
+		result.Error = fmt.Errorf("host received %d NDATA between the NBIRTHs, 3 were sent", data)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("NCMD delivered, then %s", rebirth)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,204 @@
+package sparkplug
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// StateTests returns tests of the retained STATE messages through which
+// Edge Nodes learn whether the Primary Host Application is online
+func StateTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Primary Host STATE",
+		Tags: []string{"sparkplug", "retain", "will"},
+		Tests: []common.TestFunc{
+			testStateBirthRetained,
+			testStateDeathWill,
+			testStateAfterHostTakeover,
+		},
+	}
+}
+
+// readState subscribes to the STATE topic of host as an Edge Node would on
+// connecting, and returns the retained STATE message it receives
+func readState(cfg common.Config, host string) (message, state, error) {
+	edge, err := subscribe(cfg, "test-sparkplug-edge", stateTopic(host))
+	if err != nil {
+		return message{}, state{}, err
+	}
+	defer edge.Close()
+	m, _, err := edge.await("STATE", cfg.Scaled(5*time.Second))
+	if err != nil {
+		return m, state{}, fmt.Errorf("no retained STATE for a new subscription: %w", err)
+	}
+	if !m.Retain {
+		return m, state{}, fmt.Errorf("STATE delivered to a new subscription without the retain flag")
+	}
+	s, err := decodeState(m)
+	return m, s, err
+}
+
+// testStateBirthRetained tests that the online STATE a Primary Host
+// Application publishes at QoS 1 with the retain flag is delivered to an
+// Edge Node that subscribes afterwards, unchanged
+// [tck-id-host-topic-phid-birth-retain]
+// The Primary Host Application must publish its birth STATE message with the
+// MQTT retain flag set to true.
+func testStateBirthRetained(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "STATE Birth Retained",
+		SpecRef: "tck-id-host-topic-phid-birth-retain",
+		Level:   spec.LevelMust,
+	}
+
+	host := scopedID(cfg, "state-birth")
+	timestamp := now()
+	conn, err := connectHost(cfg, cfg.ClientID("test-sparkplug-host"), host, timestamp)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	m, s, err := readState(cfg, host)
+	switch {
+	case err != nil:
+		result.Error = err
+	case !s.Online || s.Timestamp != timestamp:
+		result.Error = fmt.Errorf("retained STATE is %s, expected online with timestamp %d", m.Raw, timestamp)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = string(m.Raw)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testStateDeathWill tests that when the Primary Host Application's
+// connection is lost, its offline STATE Will Message is delivered to Edge
+// Nodes subscribed at the time and replaces the retained online STATE for
+// those that subscribe later [tck-id-host-topic-phid-death-retain]
+// The Primary Host Application must register its death STATE Will Message
+// with the MQTT retain flag set to true.
+func testStateDeathWill(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "STATE Death Will Retained",
+		SpecRef: "tck-id-host-topic-phid-death-retain",
+		Level:   spec.LevelMust,
+	}
+
+	host := scopedID(cfg, "state-death")
+	timestamp := now()
+	conn, err := connectHost(cfg, cfg.ClientID("test-sparkplug-host"), host, timestamp)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	edge, err := subscribe(cfg, "test-sparkplug-edge", stateTopic(host))
+	if err != nil {
+		conn.Close()
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer edge.Close()
+	if _, _, err := edge.await("STATE", cfg.Scaled(5*time.Second)); err != nil {
+		conn.Close()
+		result.Error = fmt.Errorf("online STATE not delivered: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	conn.Close()
+	live, _, err := edge.await("STATE", cfg.Scaled(5*time.Second))
+	if err != nil {
+		result.Error = fmt.Errorf("offline STATE Will Message not published after the connection was lost: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	if s, err := decodeState(live); err != nil || s.Online {
+		result.Error = fmt.Errorf("STATE Will Message delivered as %s, expected offline", live.Raw)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	m, s, err := readState(cfg, host)
+	switch {
+	case err != nil:
+		result.Error = err
+	case s.Online:
+		result.Error = fmt.Errorf("retained STATE is still %s after the offline Will Message", m.Raw)
+	case s.Timestamp != timestamp:
+		result.Error = fmt.Errorf("retained STATE is %s, expected the timestamp %d of the Will Message", m.Raw, timestamp)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = string(m.Raw)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testStateAfterHostTakeover tests that when a Primary Host Application
+// reconnects with the same client ID while its old connection is still open,
+// and publishes a new online STATE, the retained STATE an Edge Node then
+// receives is the new one. A broker that publishes the old connection's
+// offline Will Message after the new birth leaves the host looking offline
+// to every Edge Node that connects later. [tck-id-host-topic-phid-birth-retain]
+// The Primary Host Application must publish its birth STATE message with the
+// MQTT retain flag set to true.
+func testStateAfterHostTakeover(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "STATE After Host Takeover",
+		SpecRef: "tck-id-host-topic-phid-birth-retain",
+		Level:   spec.LevelShould, // MQTT leaves the timing of the old Will Message open
+	}
+
+	host := scopedID(cfg, "state-takeover")
+	clientID := cfg.ClientID("test-sparkplug-host")
+	first := now()
+	old, err := connectHost(cfg, clientID, host, first)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer old.Close()
+
+	second := first + 1
+	conn, err := connectHost(cfg, clientID, host, second)
+	if err != nil {
+		result.Error = fmt.Errorf("reconnect: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+	cfg.Wait(500 * time.Millisecond)
+
+	m, s, err := readState(cfg, host)
+	switch {
+	case err != nil:
+		result.Error = err
+	case !s.Online && s.Timestamp == first:
+		result.Error = fmt.Errorf("retained STATE is the old connection's Will Message %s, published after the new birth", m.Raw)
+	case !s.Online || s.Timestamp != second:
+		result.Error = fmt.Errorf("retained STATE is %s, expected online with timestamp %d", m.Raw, second)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = string(m.Raw)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
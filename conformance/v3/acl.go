@@ -0,0 +1,160 @@
+package v3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// AuthorizationTests returns tests of the broker's access control, which
+// needs to be set up for them and described with Config.ACL. Without a
+// denied topic they are skipped.
+func AuthorizationTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Authorization",
+		Tags: []string{"optional", "acl"},
+		Tests: []common.TestFunc{
+			testACLAllowedTopic,
+			testACLDeniedPublishQoS1,
+			testACLDeniedPublishQoS2,
+			testACLDeniedSubscribe,
+		},
+	}
+}
+
+// testACLAllowedTopic tests that the ACL credentials can publish and
+// subscribe to the allowed topic, so the denials the other tests look for
+// are down to the ACL
+func testACLAllowedTopic(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Allowed Topic Round Trip",
+	}
+
+	if common.SkipWithoutACL(cfg, &result) {
+		return result
+	}
+
+	conn, err := common.DialRaw(cfg.ACLUser(), 4, cfg.ClientID("test-acl-allowed"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect with the ACL credentials failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	if err := conn.RoundTrip(cfg.AllowedTopic(), cfg.Scaled(5*time.Second)); err != nil {
+		result.Error = fmt.Errorf("allowed topic %q: %w", cfg.AllowedTopic(), err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// checkDeniedPublish fills in result for a PUBLISH to the denied topic at
+// qos. MQTT 3.1.1 has no way to report the denial, so the broker must
+// acknowledge as usual and drop the message, or close the connection.
+func checkDeniedPublish(cfg common.Config, qos byte, result *common.TestResult) {
+	_, err := common.PublishDenied(cfg, 4, qos)
+	switch {
+	case errors.Is(err, common.ErrBrokerClosed):
+		result.Status = common.StatusPassed
+		result.Notes = "broker closed the connection"
+	case err != nil:
+		result.Error = err
+	default:
+		result.Status = common.StatusPassed
+	}
+}
+
+// testACLDeniedPublishQoS1 tests that a QoS 1 PUBLISH to a denied topic is
+// acknowledged but not delivered [MQTT-3.3.5-2]
+// "If a Server implementation does not authorize a PUBLISH to be performed by
+// a Client; it has no way of informing that Client. It MUST either make a
+// positive acknowledgement, according to the normal QoS rules, or close the
+// Network Connection"
+func testACLDeniedPublishQoS1(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Denied PUBLISH QoS 1 Dropped",
+		SpecRef: "MQTT-3.3.5-2",
+	}
+
+	if common.SkipWithoutACL(cfg, &result) {
+		return result
+	}
+
+	checkDeniedPublish(cfg, 1, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testACLDeniedPublishQoS2 tests that a QoS 2 PUBLISH to a denied topic goes
+// through the whole QoS 2 flow but is not delivered [MQTT-3.3.5-2]
+func testACLDeniedPublishQoS2(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Denied PUBLISH QoS 2 Dropped",
+		SpecRef: "MQTT-3.3.5-2",
+	}
+
+	if common.SkipWithoutACL(cfg, &result) {
+		return result
+	}
+
+	checkDeniedPublish(cfg, 2, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testACLDeniedSubscribe tests that a filter the ACL denies is refused with
+// return code 0x80 in its own position of the SUBACK, and the filters around
+// it are granted [MQTT-3.9.3-1]
+// "The order of return codes in the SUBACK Packet MUST match the order of
+// Topic Filters in the SUBSCRIBE Packet"
+func testACLDeniedSubscribe(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Denied SUBSCRIBE Gets SUBACK 0x80 for Its Filter Only",
+		SpecRef: "MQTT-3.9.3-1",
+	}
+
+	if common.SkipWithoutACL(cfg, &result) {
+		return result
+	}
+
+	conn, err := common.DialRaw(cfg.ACLUser(), 4, cfg.ClientID("test-acl-subscribe"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	// The allowed topic twice, since it may be the only one the ACL allows
+	allowed := cfg.AllowedTopic()
+	codes, err := conn.Subscribe(1, 1, cfg.Scaled(5*time.Second), allowed, cfg.ACL.DeniedTopic, allowed)
+	switch {
+	case err != nil:
+		result.Error = err
+	case len(codes) != 3:
+		result.Error = fmt.Errorf("SUBACK has %d return codes for 3 filters: % x", len(codes), codes)
+	case codes[0] >= 0x80 || codes[2] >= 0x80:
+		result.Error = fmt.Errorf("allowed filters refused along with the denied one: % x", codes)
+	case codes[1] == subackFailure:
+		result.Status = common.StatusPassed
+	default:
+		result.Error = fmt.Errorf("broker granted the denied topic %q with return code 0x%02x", cfg.ACL.DeniedTopic, codes[1])
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,158 @@
+package v3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// CONNACK return codes of the authentication tests
+const (
+	returnBadUsernameOrPassword = 0x04
+	returnNotAuthorized         = 0x05
+)
+
+// connackNames names the CONNACK return codes the authentication tests expect
+var connackNames = map[byte]string{
+	returnBadUsernameOrPassword: "0x04 (Bad user name or password)",
+	returnNotAuthorized:         "0x05 (Not authorized)",
+}
+
+// AuthenticationTests returns tests of the CONNACK return codes for valid,
+// invalid and missing credentials as described by Config.Auth. Each test is
+// skipped when its credentials are not configured.
+func AuthenticationTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Authentication",
+		Tags: []string{"optional", "auth"},
+		Tests: []common.TestFunc{
+			testAuthValidCredentials,
+			testAuthInvalidCredentials,
+			testAuthAnonymous,
+		},
+	}
+}
+
+// checkAccepted fills in result for a CONNECT the broker should accept
+func checkAccepted(out common.ConnectOutcome, result *common.TestResult) {
+	switch {
+	case !out.Connack:
+		result.Error = fmt.Errorf("broker closed the connection without CONNACK")
+	case out.Code != 0x00:
+		result.Error = fmt.Errorf("CONNACK return code 0x%02x, expected 0x00 (Connection Accepted)", out.Code)
+	default:
+		result.Status = common.StatusPassed
+	}
+}
+
+// checkRefused fills in result for a CONNECT the broker should refuse with
+// return code want and then close. The other authentication return code, or
+// closing without a CONNACK, is a warning.
+func checkRefused(out common.ConnectOutcome, want byte, result *common.TestResult) {
+	switch {
+	case !out.Connack:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker closed the connection without CONNACK %s", connackNames[want])
+	case out.Code == 0x00:
+		result.Error = fmt.Errorf("broker accepted the connection, expected CONNACK %s", connackNames[want])
+	case !out.Closed:
+		result.Error = fmt.Errorf("broker refused with CONNACK 0x%02x but kept the connection open", out.Code)
+	case out.Code == want:
+		result.Status = common.StatusPassed
+	case connackNames[out.Code] != "":
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker refused with %s rather than %s", connackNames[out.Code], connackNames[want])
+	default:
+		result.Error = fmt.Errorf("CONNACK return code 0x%02x, expected %s", out.Code, connackNames[want])
+	}
+}
+
+// testAuthValidCredentials tests that the configured credentials are
+// accepted with return code 0x00 [MQTT-3.2.2.3]
+func testAuthValidCredentials(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Valid Credentials Accepted (0x00)",
+		SpecRef: "MQTT-3.2.2.3",
+	}
+
+	if cfg.Username == "" {
+		result.Status = common.StatusSkipped
+		result.Notes = "no credentials configured (--username)"
+		return result
+	}
+
+	out, err := common.TryConnect(cfg, 4, cfg.ClientID("test-auth-valid"), cfg.Username, cfg.Password)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	checkAccepted(out, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testAuthInvalidCredentials tests that wrong credentials are refused with
+// 0x04 (Bad user name or password) and the connection closed [MQTT-3.2.2-5]
+// "If a server sends a CONNACK packet containing a non-zero return code it
+// MUST then close the Network Connection"
+func testAuthInvalidCredentials(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Invalid Credentials Refused (0x04)",
+		SpecRef: "MQTT-3.2.2-5",
+	}
+
+	if cfg.Auth.InvalidUsername == "" {
+		result.Status = common.StatusSkipped
+		result.Notes = "no invalid credentials configured (--invalid-username)"
+		return result
+	}
+
+	out, err := common.TryConnect(cfg, 4, cfg.ClientID("test-auth-invalid"), cfg.Auth.InvalidUsername, cfg.Auth.InvalidPassword)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	checkRefused(out, returnBadUsernameOrPassword, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testAuthAnonymous tests a CONNECT without credentials: accepted with 0x00
+// where anonymous clients are allowed, refused with 0x05 (Not authorized)
+// where they are not [MQTT-3.2.2-5]
+func testAuthAnonymous(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Anonymous Access Matches Configuration",
+		SpecRef: "MQTT-3.2.2-5",
+	}
+
+	if cfg.Auth.Anonymous == "" {
+		result.Status = common.StatusSkipped
+		result.Notes = "anonymous access not configured (--anonymous-access allow|deny)"
+		return result
+	}
+
+	out, err := common.TryConnect(cfg, 4, cfg.ClientID("test-auth-anonymous"), "", "")
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if cfg.Auth.Anonymous == common.AnonymousAllow {
+		checkAccepted(out, &result)
+	} else {
+		checkRefused(out, returnNotAuthorized, &result)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
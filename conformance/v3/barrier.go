@@ -0,0 +1,91 @@
+package v3
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// barrierTopic is the topic level every barrier topic starts with, under
+// the run's namespace
+const barrierTopic = "barrier/"
+
+// Barrier subscribes the client to a topic of its own, publishes a message
+// there and waits for it to come back. The broker handles a client's
+// packets in order and sends retained messages ahead of later ones, so once
+// the barrier arrives every earlier subscription of the client is in place
+// and its retained messages have been handed to the message handlers.
+func Barrier(cfg common.Config, client mqtt.Client) error {
+	topic := cfg.Topic(barrierTopic + common.GenerateClientID("barrier"))
+	arrived := make(chan struct{}, 1)
+	timeout := cfg.Scaled(5 * time.Second)
+
+	token := client.Subscribe(topic, 1, func(c mqtt.Client, m mqtt.Message) {
+		select {
+		case arrived <- struct{}{}:
+		default:
+		}
+	})
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("barrier subscribe timed out")
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("barrier subscribe failed: %w", token.Error())
+	}
+	token = client.Publish(topic, 1, false, "barrier")
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("barrier publish timed out")
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("barrier publish failed: %w", token.Error())
+	}
+
+	select {
+	case <-arrived:
+	case <-time.After(timeout):
+		return fmt.Errorf("barrier message not delivered within %v", timeout)
+	}
+
+	token = client.Unsubscribe(topic)
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("barrier unsubscribe timed out")
+	}
+	return token.Error()
+}
+
+// skipBarriers wraps a message handler so a wildcard subscription covering
+// a barrier topic does not hand barrier messages to the test
+func skipBarriers(cfg common.Config, callback mqtt.MessageHandler) mqtt.MessageHandler {
+	if callback == nil {
+		return nil
+	}
+	prefix := cfg.Topic(barrierTopic)
+	return func(c mqtt.Client, m mqtt.Message) {
+		if strings.HasPrefix(m.Topic(), prefix) {
+			return
+		}
+		callback(c, m)
+	}
+}
+
+// SubscribeSync subscribes and then waits for a Barrier, so the
+// subscription is known to be active when it returns
+func SubscribeSync(cfg common.Config, client mqtt.Client, topic string, qos byte, callback mqtt.MessageHandler) error {
+	return SubscribeMultipleSync(cfg, client, map[string]byte{topic: qos}, callback)
+}
+
+// SubscribeMultipleSync subscribes to several filters in one SUBSCRIBE and
+// then waits for a Barrier
+func SubscribeMultipleSync(cfg common.Config, client mqtt.Client, filters map[string]byte, callback mqtt.MessageHandler) error {
+	token := client.SubscribeMultiple(filters, skipBarriers(cfg, callback))
+	if !token.WaitTimeout(cfg.Scaled(5 * time.Second)) {
+		return fmt.Errorf("subscribe timed out")
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("subscribe failed: %w", token.Error())
+	}
+	return Barrier(cfg, client)
+}
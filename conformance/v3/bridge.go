@@ -0,0 +1,148 @@
+package v3
+
+import (
+	"context"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// BridgeTests returns tests of a bridge configured on the broker to a
+// remote broker the suite plays, described with Config.Bridge. Without a
+// listen address they are skipped.
+func BridgeTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Bridge",
+		Tags: []string{"optional", "bridge"},
+		Tests: []common.TestFunc{
+			testBridgeConnected,
+			testBridgeOutbound,
+			testBridgeInbound,
+			testBridgeLoopPrevention,
+			testBridgeRetained,
+			testBridgeReconnect,
+		},
+	}
+}
+
+// checkBridge fills in result with the outcome of a bridge check, once the
+// bridge is connected
+func checkBridge(cfg common.Config, result *common.TestResult, check func(common.Config, byte, *common.BridgeRemote) (string, error)) {
+	r := common.SkipWithoutBridge(cfg, result)
+	if r == nil {
+		return
+	}
+	notes, err := check(cfg, 4, r)
+	if err != nil {
+		result.Error = err
+		return
+	}
+	result.Status = common.StatusPassed
+	result.Notes = notes
+}
+
+// testBridgeConnected tests that the bridge connects to the remote and
+// subscribes to the remote side of the bridged topics
+func testBridgeConnected(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Bridge Connects to Remote",
+	}
+
+	if r := common.SkipWithoutBridge(cfg, &result); r != nil {
+		result.Status = common.StatusPassed
+		result.Notes = common.DescribeBridge(r)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testBridgeOutbound tests that a message published under the local prefix
+// is forwarded to the remote under the remote prefix
+func testBridgeOutbound(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Bridge Maps Local Prefix Out",
+	}
+
+	checkBridge(cfg, &result, common.CheckBridgeOutbound)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testBridgeInbound tests that a message published on the remote under the
+// remote prefix is delivered locally under the local prefix
+func testBridgeInbound(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Bridge Maps Remote Prefix In",
+	}
+
+	checkBridge(cfg, &result, common.CheckBridgeInbound)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testBridgeLoopPrevention tests that a message the bridge brings in from
+// the remote is not sent back to it through the same bridge
+func testBridgeLoopPrevention(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Bridge Loop Prevention",
+	}
+
+	checkBridge(cfg, &result, common.CheckBridgeLoop)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testBridgeRetained tests that retained messages stay retained across the
+// bridge in both directions
+func testBridgeRetained(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Bridge Retained Propagation",
+	}
+
+	checkBridge(cfg, &result, common.CheckBridgeRetained)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testBridgeReconnect tests that after the remote drops the connection the
+// bridge reconnects with the same client ID and, with a persistent session,
+// delivers the QoS 1 messages published on either side while it was down.
+// A bridge with a clean session only has to reconnect, and is reported as a
+// warning.
+func testBridgeReconnect(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Bridge Reconnect With Persistent Session",
+	}
+
+	r := common.SkipWithoutBridge(cfg, &result)
+	if r == nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	notes, persistent, err := common.CheckBridgeReconnect(cfg, 4, r)
+	switch {
+	case err != nil:
+		result.Error = err
+	case !persistent:
+		result.Status = common.StatusWarning
+		result.Notes = notes
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = notes
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,84 @@
+package v3
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// retainedQuietPeriod is how long no further retained message may arrive
+// before the namespace counts as fully read
+const retainedQuietPeriod = 500 * time.Millisecond
+
+// Cleanup clears every retained message under cfg.TopicNamespace and ends
+// the sessions of clientIDs by reconnecting each with Clean Session set
+func Cleanup(cfg common.Config, clientIDs []string) (*common.CleanupResult, error) {
+	if cfg.TopicNamespace == "" {
+		return nil, fmt.Errorf("no topic namespace to clean up")
+	}
+	res := &common.CleanupResult{}
+
+	var mu sync.Mutex
+	var topics []string
+	last := time.Now()
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("cleanup"), func(c mqtt.Client, msg mqtt.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		last = time.Now()
+		if msg.Retained() && len(msg.Payload()) > 0 {
+			topics = append(topics, msg.Topic())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect(250)
+
+	token := client.Subscribe(cfg.TopicNamespace+"/#", 0, nil)
+	if !token.WaitTimeout(5 * time.Second) {
+		return nil, fmt.Errorf("timed out subscribing to %s/#", cfg.TopicNamespace)
+	}
+	if token.Error() != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s/#: %w", cfg.TopicNamespace, token.Error())
+	}
+
+	mu.Lock()
+	last = time.Now()
+	mu.Unlock()
+	common.WaitTimeout(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return time.Since(last) > retainedQuietPeriod
+	}, 10*time.Second)
+
+	mu.Lock()
+	found := append([]string(nil), topics...)
+	mu.Unlock()
+	for _, topic := range found {
+		token := client.Publish(topic, 1, true, "")
+		if !token.WaitTimeout(5 * time.Second) {
+			res.Errors = append(res.Errors, fmt.Errorf("timed out clearing retained message on %s", topic))
+			continue
+		}
+		if token.Error() != nil {
+			res.Errors = append(res.Errors, fmt.Errorf("failed to clear retained message on %s: %w", topic, token.Error()))
+			continue
+		}
+		res.Retained = append(res.Retained, topic)
+	}
+
+	for _, id := range clientIDs {
+		// Connecting with Clean Session discards the stored session
+		c, err := CreateAndConnectClient(cfg, id, nil)
+		if err != nil {
+			res.Errors = append(res.Errors, fmt.Errorf("failed to end session %s: %w", id, err))
+			continue
+		}
+		c.Disconnect(250)
+		res.Sessions = append(res.Sessions, id)
+	}
+	return res, nil
+}
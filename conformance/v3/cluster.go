@@ -0,0 +1,106 @@
+package v3
+
+import (
+	"context"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// ClusterTests returns tests that connect to several nodes of a clustered
+// broker, given with Config.Nodes, and check the nodes act as one Server.
+// Without other nodes they are skipped.
+func ClusterTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Cluster",
+		Tags: []string{"optional", "cluster"},
+		Tests: []common.TestFunc{
+			testClusterRouting,
+			testClusterRetained,
+			testClusterTakeover,
+		},
+	}
+}
+
+// testClusterRouting tests that a message published on one node reaches a
+// subscriber on each other node exactly once, in every direction
+func testClusterRouting(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Cross-Node Routing",
+	}
+
+	if common.SkipWithoutCluster(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	notes, err := common.CheckClusterRouting(cfg, 4)
+	if err != nil {
+		result.Error = err
+	} else {
+		result.Status = common.StatusPassed
+		result.Notes = notes
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testClusterRetained tests that a retained message published on one node
+// is delivered to new subscribers on the other nodes, and that clearing it
+// clears it everywhere [MQTT-3.3.1-6]
+// "When a new subscription is established, the last retained message, if
+// any, on each matching topic name MUST be sent to the subscriber"
+func testClusterRetained(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Retained Replication",
+		SpecRef: "MQTT-3.3.1-6",
+	}
+
+	if common.SkipWithoutCluster(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	notes, err := common.CheckClusterRetained(cfg, 4)
+	if err != nil {
+		result.Error = err
+	} else {
+		result.Status = common.StatusPassed
+		result.Notes = notes
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testClusterTakeover tests that connecting to another node with the client
+// ID of a client connected to the first closes the first connection and
+// resumes its session, subscription included [MQTT-3.1.4-2]
+// "If the ClientId represents a Client already connected to the Server then
+// the Server MUST disconnect the existing Client"
+func testClusterTakeover(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Session Takeover Across Nodes",
+		SpecRef: "MQTT-3.1.4-2",
+	}
+
+	if common.SkipWithoutCluster(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	notes, err := common.CheckClusterTakeover(cfg, 4)
+	if err != nil {
+		result.Error = err
+	} else {
+		result.Status = common.StatusPassed
+		result.Notes = notes
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
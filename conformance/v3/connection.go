@@ -1,6 +1,7 @@
 package v3
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 func ConnectionTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "Connection",
+		Tags: []string{"core", "connect"},
 		Tests: []common.TestFunc{
 			testBasicConnect,
 			testConnectWithClientID,
@@ -30,14 +32,14 @@ func ConnectionTests() common.TestGroup {
 }
 
 // testBasicConnect tests a basic MQTT v3.1.1 connection [MQTT-3.1.0-1]
-func testBasicConnect(cfg common.Config) common.TestResult {
+func testBasicConnect(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Basic Connect",
 		SpecRef: "MQTT-3.1.0-1",
 	}
 
-	clientID := common.GenerateClientID("test-basic-connect")
+	clientID := cfg.ClientID("test-basic-connect")
 	client, err := CreateAndConnectClient(cfg, clientID, nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
@@ -49,7 +51,7 @@ func testBasicConnect(cfg common.Config) common.TestResult {
 	if !client.IsConnected() {
 		result.Error = fmt.Errorf("client not connected")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -57,7 +59,7 @@ func testBasicConnect(cfg common.Config) common.TestResult {
 }
 
 // testConnectWithClientID tests connection with specific client ID [MQTT-3.1.3-2]
-func testConnectWithClientID(cfg common.Config) common.TestResult {
+func testConnectWithClientID(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Connect with Specific Client ID",
@@ -65,7 +67,7 @@ func testConnectWithClientID(cfg common.Config) common.TestResult {
 	}
 
 	// Test with valid characters [MQTT-3.1.3-5]
-	clientID := "test-ClientID-123"
+	clientID := cfg.ClientID("test-ClientID-123")
 	client, err := CreateAndConnectClient(cfg, clientID, nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect with client ID failed: %w", err)
@@ -74,20 +76,20 @@ func testConnectWithClientID(cfg common.Config) common.TestResult {
 	}
 	defer client.Disconnect(250)
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testCleanSessionTrue tests Clean Session = true [MQTT-3.1.2-6]
-func testCleanSessionTrue(cfg common.Config) common.TestResult {
+func testCleanSessionTrue(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Clean Session True",
 		SpecRef: "MQTT-3.1.2-6",
 	}
 
-	clientID := common.GenerateClientID("test-clean-session-true")
+	clientID := cfg.ClientID("test-clean-session-true")
 
 	// Connect with Clean Session = true (should start fresh)
 	client, err := CreateAndConnectClientWithSession(cfg, clientID, true, nil)
@@ -98,20 +100,20 @@ func testCleanSessionTrue(cfg common.Config) common.TestResult {
 	}
 	defer client.Disconnect(250)
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testCleanSessionFalse tests Clean Session = false [MQTT-3.1.2-4]
-func testCleanSessionFalse(cfg common.Config) common.TestResult {
+func testCleanSessionFalse(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Clean Session False",
 		SpecRef: "MQTT-3.1.2-4",
 	}
 
-	clientID := common.GenerateClientID("test-clean-session-false")
+	clientID := cfg.ClientID("test-clean-session-false")
 
 	// Connect with Clean Session = false
 	client1, err := CreateAndConnectClientWithSession(cfg, clientID, false, nil)
@@ -122,7 +124,7 @@ func testCleanSessionFalse(cfg common.Config) common.TestResult {
 	}
 	client1.Disconnect(250)
 
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	// Reconnect with same client ID and Clean Session = false
 	client2, err := CreateAndConnectClientWithSession(cfg, clientID, false, nil)
@@ -133,13 +135,13 @@ func testCleanSessionFalse(cfg common.Config) common.TestResult {
 	}
 	defer client2.Disconnect(250)
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testZeroLengthClientID tests zero-length client ID with Clean Session = 1 [MQTT-3.1.3-6, MQTT-3.1.3-7]
-func testZeroLengthClientID(cfg common.Config) common.TestResult {
+func testZeroLengthClientID(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Zero-Length Client ID with Clean Session",
@@ -155,13 +157,13 @@ func testZeroLengthClientID(cfg common.Config) common.TestResult {
 	}
 	defer client.Disconnect(250)
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testZeroLengthClientIDWithCleanSessionFalse tests zero-length client ID with Clean Session = 0 [MQTT-3.1.3-8]
-func testZeroLengthClientIDWithCleanSessionFalse(cfg common.Config) common.TestResult {
+func testZeroLengthClientIDWithCleanSessionFalse(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Zero-Length Client ID with Clean Session False (Should Reject)",
@@ -171,6 +173,7 @@ func testZeroLengthClientIDWithCleanSessionFalse(cfg common.Config) common.TestR
 	// Empty client ID with Clean Session = false should be rejected with CONNACK 0x02
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID("")
 	opts.SetCleanSession(false)
 	opts.SetConnectTimeout(5 * time.Second)
@@ -186,10 +189,11 @@ func testZeroLengthClientIDWithCleanSessionFalse(cfg common.Config) common.TestR
 
 	// Should be rejected
 	if token.Error() == nil {
+		client.Disconnect(250)
 		result.Error = fmt.Errorf("connection should have been rejected but succeeded")
 	} else {
 		// Expected to fail
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -197,14 +201,14 @@ func testZeroLengthClientIDWithCleanSessionFalse(cfg common.Config) common.TestR
 }
 
 // testDuplicateClientIDTakeover tests session takeover with duplicate client ID [MQTT-3.1.4-2]
-func testDuplicateClientIDTakeover(cfg common.Config) common.TestResult {
+func testDuplicateClientIDTakeover(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Duplicate Client ID Takeover",
 		SpecRef: "MQTT-3.1.4-2",
 	}
 
-	clientID := common.GenerateClientID("test-takeover")
+	clientID := cfg.ClientID("test-takeover")
 
 	// First connection
 	client1, err := CreateAndConnectClient(cfg, clientID, nil)
@@ -224,13 +228,13 @@ func testDuplicateClientIDTakeover(cfg common.Config) common.TestResult {
 	}
 	defer client2.Disconnect(250)
 
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// First client should be disconnected
 	if client1.IsConnected() {
 		result.Error = fmt.Errorf("first client still connected after takeover")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -238,16 +242,17 @@ func testDuplicateClientIDTakeover(cfg common.Config) common.TestResult {
 }
 
 // testConnectWithUsername tests connection with username (no password) [MQTT-3.1.2-18, MQTT-3.1.2-19]
-func testConnectWithUsername(cfg common.Config) common.TestResult {
+func testConnectWithUsername(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Connect with Username",
 		SpecRef: "MQTT-3.1.2-19",
 	}
 
-	clientID := common.GenerateClientID("test-username")
+	clientID := cfg.ClientID("test-username")
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetUsername("testuser")
 	opts.SetCleanSession(true)
@@ -264,10 +269,11 @@ func testConnectWithUsername(cfg common.Config) common.TestResult {
 
 	if token.Error() != nil {
 		// Broker may reject due to auth requirements, which is acceptable
-		result.Passed = true
+		result.Status = common.StatusInconclusive
+		result.Notes = "broker rejected the credentials, username handling not verified"
 	} else {
 		defer client.Disconnect(250)
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -275,16 +281,17 @@ func testConnectWithUsername(cfg common.Config) common.TestResult {
 }
 
 // testConnectWithUsernameAndPassword tests connection with username and password [MQTT-3.1.2-21]
-func testConnectWithUsernameAndPassword(cfg common.Config) common.TestResult {
+func testConnectWithUsernameAndPassword(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Connect with Username and Password",
 		SpecRef: "MQTT-3.1.2-21",
 	}
 
-	clientID := common.GenerateClientID("test-username-password")
+	clientID := cfg.ClientID("test-username-password")
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetUsername("testuser")
 	opts.SetPassword("testpass")
@@ -302,10 +309,11 @@ func testConnectWithUsernameAndPassword(cfg common.Config) common.TestResult {
 
 	if token.Error() != nil {
 		// Broker may reject due to auth requirements, which is acceptable
-		result.Passed = true
+		result.Status = common.StatusInconclusive
+		result.Notes = "broker rejected the credentials, password handling not verified"
 	} else {
 		defer client.Disconnect(250)
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -313,16 +321,17 @@ func testConnectWithUsernameAndPassword(cfg common.Config) common.TestResult {
 }
 
 // testPasswordWithoutUsername tests that password without username is invalid [MQTT-3.1.2-22]
-func testPasswordWithoutUsername(cfg common.Config) common.TestResult {
+func testPasswordWithoutUsername(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Password Without Username (Should Fail)",
 		SpecRef: "MQTT-3.1.2-22",
 	}
 
-	clientID := common.GenerateClientID("test-password-only")
+	clientID := cfg.ClientID("test-password-only")
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetPassword("testpass") // Password without username
 	opts.SetCleanSession(true)
@@ -335,7 +344,8 @@ func testPasswordWithoutUsername(cfg common.Config) common.TestResult {
 
 	// The paho.mqtt.golang library should handle this, but if connection succeeds, it's a library issue
 	// We pass the test either way since we're testing broker conformance
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "password without username is rejected by the client library, broker behavior not observed"
 	if token.Error() == nil {
 		client.Disconnect(250)
 	}
@@ -345,16 +355,17 @@ func testPasswordWithoutUsername(cfg common.Config) common.TestResult {
 }
 
 // testProtocolLevel tests MQTT v3.1.1 protocol level [MQTT-3.1.2-2]
-func testProtocolLevel(cfg common.Config) common.TestResult {
+func testProtocolLevel(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Protocol Level 3.1.1",
 		SpecRef: "MQTT-3.1.2-2",
 	}
 
-	clientID := common.GenerateClientID("test-protocol-level")
+	clientID := cfg.ClientID("test-protocol-level")
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetProtocolVersion(4) // MQTT 3.1.1
 	opts.SetCleanSession(true)
@@ -373,7 +384,7 @@ func testProtocolLevel(cfg common.Config) common.TestResult {
 		result.Error = fmt.Errorf("connect failed: %w", token.Error())
 	} else {
 		defer client.Disconnect(250)
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -381,16 +392,17 @@ func testProtocolLevel(cfg common.Config) common.TestResult {
 }
 
 // testKeepAlive tests keep-alive functionality [MQTT-3.1.2-23, MQTT-3.1.2-24]
-func testKeepAlive(cfg common.Config) common.TestResult {
+func testKeepAlive(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Keep Alive",
 		SpecRef: "MQTT-3.1.2-23",
 	}
 
-	clientID := common.GenerateClientID("test-keepalive")
+	clientID := cfg.ClientID("test-keepalive")
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetCleanSession(true)
 	opts.SetConnectTimeout(5 * time.Second)
@@ -419,7 +431,7 @@ func testKeepAlive(cfg common.Config) common.TestResult {
 	if !client.IsConnected() {
 		result.Error = fmt.Errorf("client disconnected during keep-alive")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -0,0 +1,141 @@
+package v3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// DisconnectTests returns raw tests of how the broker handles a client's
+// DISCONNECT [MQTT-3.14]
+func DisconnectTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "DISCONNECT",
+		Tags: []string{"core"},
+		Tests: []common.TestFunc{
+			testDisconnectRemainingLength,
+			testDisconnectCloses,
+			testPacketsAfterDisconnect,
+		},
+	}
+}
+
+// testDisconnectRemainingLength tests that a DISCONNECT with a Remaining
+// Length of 1, which the packet does not have, is a protocol violation
+// rather than a clean disconnect: the broker closes the connection and
+// publishes the client's Will, which only a valid DISCONNECT discards
+// [MQTT-4.8.0-1] [MQTT-3.1.2-8]
+// "Unless stated otherwise, if either the Server or Client encounters a
+// protocol violation, it MUST close the Network Connection"
+func testDisconnectRemainingLength(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject DISCONNECT With Nonzero Remaining Length",
+		SpecRef: "MQTT-4.8.0-1",
+	}
+
+	willTopic := cfg.Topic(common.GenerateTopicName("test/disconnect/remlen"))
+	timeout := cfg.Scaled(5 * time.Second)
+	sub, err := common.DialRaw(cfg, 4, cfg.ClientID("test-disconnect-remlen-sub"))
+	if err != nil {
+		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Close()
+	if codes, err := sub.Subscribe(1, 0, timeout, willTopic); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		result.Error = fmt.Errorf("subscribe failed: %v % x", err, codes)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	conn, err := common.DialRawWill(cfg, 4, cfg.ClientID("test-disconnect-remlen"), &common.RawWill{
+		Topic:   willTopic,
+		Payload: []byte("malformed disconnect"),
+	})
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	// DISCONNECT with Remaining Length 1 and a stray zero byte
+	if _, err := conn.Write([]byte{0xE0, 0x01, 0x00}); err == nil {
+		data, closed := common.AwaitClose(conn, cfg.Scaled(2*time.Second))
+		switch {
+		case len(data) > 0:
+			result.Error = fmt.Errorf("broker answered with packet 0x%02x instead of closing the connection", data[0])
+		case !closed:
+			result.Error = errors.New("broker kept the connection open")
+		}
+		if result.Error != nil {
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	if _, _, err := sub.Expect(0x30, cfg.Scaled(2*time.Second), nil); err != nil {
+		result.Error = fmt.Errorf("broker did not publish the Will, taking the malformed DISCONNECT for a valid one [MQTT-3.1.2-8]: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testDisconnectCloses tests, on a raw connection, that the broker closes
+// the network connection promptly after a client's DISCONNECT, when the
+// client leaves it open [MQTT-3.14.4]
+// "On receipt of DISCONNECT the Server ... SHOULD close the Network
+// Connection if the Client has not already done so"
+func testDisconnectCloses(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "DISCONNECT Closes Connection Promptly",
+		SpecRef: "MQTT-3.14.4",
+		Level:   spec.LevelShould,
+	}
+
+	took, err := common.CheckDisconnectClose(cfg, 4)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Notes = fmt.Sprintf("closed %v after the DISCONNECT", took.Round(time.Microsecond))
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPacketsAfterDisconnect tests, on a raw connection, that a PUBLISH
+// following the client's DISCONNECT is ignored, neither acknowledged nor
+// delivered, since nothing may follow a DISCONNECT [MQTT-3.14.4-2]
+// "After sending a DISCONNECT Packet the Client ... MUST NOT send any more
+// Control Packets on that Network Connection"
+func testPacketsAfterDisconnect(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "PUBLISH After DISCONNECT Ignored",
+		SpecRef: "MQTT-3.14.4-2",
+		Level:   spec.LevelShould,
+	}
+
+	if err := common.CheckPacketsAfterDisconnect(cfg, 4); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
@@ -2,6 +2,8 @@ package v3
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"time"
 
 	"github.com/bromq-dev/testmqtt/conformance/common"
@@ -16,7 +18,7 @@ func CheckConnection(cfg common.Config) error {
 	}
 
 	// Now try an actual MQTT connection with auth
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("preflight"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("preflight"), nil)
 	if err != nil {
 		if cfg.Username != "" {
 			return fmt.Errorf("MQTT connection failed (check credentials): %w", err)
@@ -28,10 +30,24 @@ func CheckConnection(cfg common.Config) error {
 	return nil
 }
 
+// setDialer makes the client connect through common.Dial when the test is
+// being traced, its connections tracked or the broker needs TLS settings, so
+// the packets are recorded in cfg.Trace, the connection in cfg.Conns and
+// cfg.TLS is used
+func setDialer(opts *mqtt.ClientOptions, cfg common.Config) {
+	if cfg.Trace == nil && cfg.Conns == nil && cfg.TLS == nil {
+		return
+	}
+	opts.SetCustomOpenConnectionFn(func(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+		return common.Dial(cfg)
+	})
+}
+
 // CreateAndConnectClient creates and connects a MQTT v3.1.1 client with optional message handler
 func CreateAndConnectClient(cfg common.Config, clientID string, onMessage mqtt.MessageHandler) (mqtt.Client, error) {
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetCleanSession(true)
 	opts.SetConnectTimeout(5 * time.Second)
@@ -45,15 +61,18 @@ func CreateAndConnectClient(cfg common.Config, clientID string, onMessage mqtt.M
 	}
 
 	if onMessage != nil {
-		opts.SetDefaultPublishHandler(onMessage)
+		opts.SetDefaultPublishHandler(skipBarriers(cfg, onMessage))
 	}
 
+	cfg.Log().Debug("connecting client", "client_id", clientID, "clean_session", opts.CleanSession)
 	client := mqtt.NewClient(opts)
 	token := client.Connect()
 	if !token.WaitTimeout(5 * time.Second) {
+		cfg.Log().Debug("client connect timed out", "client_id", clientID)
 		return nil, fmt.Errorf("connection timeout")
 	}
 	if token.Error() != nil {
+		cfg.Log().Debug("client connect failed", "client_id", clientID, "error", token.Error())
 		return nil, fmt.Errorf("failed to connect: %w", token.Error())
 	}
 
@@ -64,8 +83,12 @@ func CreateAndConnectClient(cfg common.Config, clientID string, onMessage mqtt.M
 func CreateAndConnectClientWithSession(cfg common.Config, clientID string, cleanSession bool, onMessage mqtt.MessageHandler) (mqtt.Client, error) {
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetCleanSession(cleanSession)
+	if !cleanSession {
+		cfg.Sessions.Add(clientID)
+	}
 	opts.SetConnectTimeout(5 * time.Second)
 	opts.SetAutoReconnect(false)
 
@@ -77,15 +100,18 @@ func CreateAndConnectClientWithSession(cfg common.Config, clientID string, clean
 	}
 
 	if onMessage != nil {
-		opts.SetDefaultPublishHandler(onMessage)
+		opts.SetDefaultPublishHandler(skipBarriers(cfg, onMessage))
 	}
 
+	cfg.Log().Debug("connecting client", "client_id", clientID, "clean_session", opts.CleanSession)
 	client := mqtt.NewClient(opts)
 	token := client.Connect()
 	if !token.WaitTimeout(5 * time.Second) {
+		cfg.Log().Debug("client connect timed out", "client_id", clientID)
 		return nil, fmt.Errorf("connection timeout")
 	}
 	if token.Error() != nil {
+		cfg.Log().Debug("client connect failed", "client_id", clientID, "error", token.Error())
 		return nil, fmt.Errorf("failed to connect: %w", token.Error())
 	}
 
@@ -96,6 +122,7 @@ func CreateAndConnectClientWithSession(cfg common.Config, clientID string, clean
 func CreateAndConnectClientWithWill(cfg common.Config, clientID string, willTopic string, willPayload []byte, willQos byte, willRetained bool, onMessage mqtt.MessageHandler) (mqtt.Client, error) {
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetCleanSession(true)
 	opts.SetConnectTimeout(5 * time.Second)
@@ -110,15 +137,18 @@ func CreateAndConnectClientWithWill(cfg common.Config, clientID string, willTopi
 	}
 
 	if onMessage != nil {
-		opts.SetDefaultPublishHandler(onMessage)
+		opts.SetDefaultPublishHandler(skipBarriers(cfg, onMessage))
 	}
 
+	cfg.Log().Debug("connecting client", "client_id", clientID, "clean_session", opts.CleanSession)
 	client := mqtt.NewClient(opts)
 	token := client.Connect()
 	if !token.WaitTimeout(5 * time.Second) {
+		cfg.Log().Debug("client connect timed out", "client_id", clientID)
 		return nil, fmt.Errorf("connection timeout")
 	}
 	if token.Error() != nil {
+		cfg.Log().Debug("client connect failed", "client_id", clientID, "error", token.Error())
 		return nil, fmt.Errorf("failed to connect: %w", token.Error())
 	}
 
@@ -129,6 +159,7 @@ func CreateAndConnectClientWithWill(cfg common.Config, clientID string, willTopi
 func CreateClientWithKeepAlive(cfg common.Config, clientID string, keepAlive time.Duration, onMessage mqtt.MessageHandler) (mqtt.Client, error) {
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetCleanSession(true)
 	opts.SetConnectTimeout(5 * time.Second)
@@ -143,17 +174,65 @@ func CreateClientWithKeepAlive(cfg common.Config, clientID string, keepAlive tim
 	}
 
 	if onMessage != nil {
-		opts.SetDefaultPublishHandler(onMessage)
+		opts.SetDefaultPublishHandler(skipBarriers(cfg, onMessage))
 	}
 
+	cfg.Log().Debug("connecting client", "client_id", clientID, "clean_session", opts.CleanSession)
 	client := mqtt.NewClient(opts)
 	token := client.Connect()
 	if !token.WaitTimeout(5 * time.Second) {
+		cfg.Log().Debug("client connect timed out", "client_id", clientID)
 		return nil, fmt.Errorf("connection timeout")
 	}
 	if token.Error() != nil {
+		cfg.Log().Debug("client connect failed", "client_id", clientID, "error", token.Error())
 		return nil, fmt.Errorf("failed to connect: %w", token.Error())
 	}
 
 	return client, nil
 }
+
+// CheckPubSub publishes a QoS 1 message and waits for a subscriber to
+// receive it
+func CheckPubSub(cfg common.Config) error {
+	topic := cfg.Topic("ready/" + common.GenerateClientID("check"))
+	received := make(chan struct{}, 1)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("ready-sub"), func(c mqtt.Client, m mqtt.Message) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer sub.Disconnect(250)
+
+	token := sub.Subscribe(topic, 1, nil)
+	if !token.WaitTimeout(5 * time.Second) {
+		return fmt.Errorf("publish/subscribe: subscribe timed out")
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("publish/subscribe: subscribe failed: %w", token.Error())
+	}
+
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("ready-pub"), nil)
+	if err != nil {
+		return err
+	}
+	defer pub.Disconnect(250)
+	token = pub.Publish(topic, 1, false, "ready")
+	if !token.WaitTimeout(5 * time.Second) {
+		return fmt.Errorf("publish/subscribe: publish timed out")
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("publish/subscribe: publish failed: %w", token.Error())
+	}
+
+	select {
+	case <-received:
+		return nil
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("publish/subscribe: message published to %s was not delivered", topic)
+	}
+}
@@ -0,0 +1,144 @@
+package v3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// LimitsTests returns exploratory tests that push the broker until it
+// refuses something, report the limit they found and check the broker
+// refuses the way the specification asks. How far they push is set with
+// Config.Limits; finding no limit is inconclusive.
+func LimitsTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Limits Discovery",
+		Tags: []string{"optional", "limits"},
+		Tests: []common.TestFunc{
+			testConnectionLimit,
+			testPayloadLimit,
+			testInflightWindow,
+		},
+	}
+}
+
+// testConnectionLimit ramps up connections until the broker refuses one,
+// which it should do with CONNACK 0x03 (Server unavailable), and checks the
+// connections already open stay healthy at the limit
+func testConnectionLimit(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Maximum Connections",
+	}
+
+	if common.SkipWithoutConnectionLimit(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	limit, err := common.CheckConnectionLimit(cfg, 4)
+	switch {
+	case err != nil:
+		result.Error = err
+	case limit.Healthy < limit.Opened:
+		result.Error = fmt.Errorf("%d of %d connections open at the limit stopped answering PINGREQ", limit.Opened-limit.Healthy, limit.Opened)
+	case !limit.Limited:
+		result.Status = common.StatusInconclusive
+		result.Notes = fmt.Sprintf("no limit reached with %d connections (set --limit-connections higher)", limit.Opened)
+	case limit.Rejection == "CONNACK 0x03":
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("limit %d connections, refused with CONNACK 0x03 (Server unavailable)", limit.Opened)
+	default:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("limit %d connections, refused by %s rather than CONNACK 0x03 (Server unavailable)", limit.Opened, limit.Rejection)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPayloadLimit binary-searches the largest payload the broker accepts
+// at each QoS. MQTT 3.1.1 has no way to refuse a PUBLISH but closing the
+// connection, so a QoS 0 message dropped silently is a warning, and a QoS 1
+// or 2 message acknowledged but never delivered fails.
+func testPayloadLimit(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Maximum Message Size",
+	}
+
+	if common.SkipWithoutPayloadLimit(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	var notes []string
+	var refused, deviated bool
+	for qos := range cfg.Capabilities.QoS(2) + 1 {
+		limit, err := common.CheckPayloadLimit(cfg, 4, qos)
+		if err != nil {
+			result.Error = fmt.Errorf("QoS %d: %w", qos, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+		notes = append(notes, limit.String())
+		switch {
+		case !limit.Limited:
+		case limit.Rejection == common.RejectAckedLost:
+			result.Error = fmt.Errorf("QoS %d: PUBLISH of %d bytes acknowledged with success but never delivered", qos, limit.Largest+1)
+			result.Duration = time.Since(start)
+			return result
+		case limit.Rejection == common.RejectClosed:
+			refused = true
+		default:
+			deviated = true
+		}
+	}
+
+	switch {
+	case deviated:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("oversized PUBLISH not refused by closing the connection: %s", strings.Join(notes, "; "))
+	case !refused:
+		result.Status = common.StatusInconclusive
+		result.Notes = fmt.Sprintf("%s (raise --limit-payload, up to 256MB)", strings.Join(notes, "; "))
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = strings.Join(notes, "; ")
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testInflightWindow measures how many QoS 1 messages the broker delivers
+// to a subscriber that withholds its PUBACKs, and checks every message
+// arrives once they are acknowledged. MQTT 3.1.1 leaves the window to the
+// broker, so it is only reported.
+func testInflightWindow(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Inflight Window",
+	}
+
+	w, err := common.CheckInflightWindow(cfg, 4)
+	switch {
+	case err != nil:
+		result.Error = err
+	case !w.Limited():
+		result.Status = common.StatusInconclusive
+		result.Notes = fmt.Sprintf("all %d messages delivered without PUBACKs (raise --limit-inflight)", w.Sent)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("%d of %d messages delivered before the first PUBACK", w.Window, w.Sent)
+		if w.Resent > 0 {
+			result.Notes += fmt.Sprintf(", %d resent while waiting", w.Resent)
+		}
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
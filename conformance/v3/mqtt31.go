@@ -0,0 +1,326 @@
+package v3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// MQTT 3.1 CONNACK return codes the tests look for
+const (
+	connack31Accepted            = 0x00
+	connack31UnacceptableVersion = 0x01
+	connack31IdentifierRejected  = 0x02
+)
+
+// MQTT31Tests returns tests for brokers that still accept MQTT 3.1 clients,
+// which connect with protocol name "MQIsdp" and level 3. Brokers that only
+// speak 3.1.1 must refuse them with return code 0x01, after which the other
+// tests are skipped.
+func MQTT31Tests() common.TestGroup {
+	return common.TestGroup{
+		Name: "MQTT 3.1 Compatibility",
+		Tags: []string{"optional", "v31", "connect"},
+		Tests: []common.TestFunc{
+			testMQTT31Connect,
+			testMQTT31ClientIDMaxLength,
+			testMQTT31ClientIDTooLong,
+			testMQTT31EmptyClientID,
+			testMQTT31PublishSubscribe,
+		},
+	}
+}
+
+// clientID31 returns a unique client ID within the 23 characters MQTT 3.1
+// allows, starting with the run's client ID prefix. The name is shortened
+// to make room for the unique suffix.
+func clientID31(cfg common.Config, prefix string) string {
+	suffix := fmt.Sprintf("-%09d", time.Now().UnixNano()%1e9)
+	name := cfg.ClientIDPrefix + prefix
+	return name[:min(len(name), 23-len(suffix))] + suffix
+}
+
+// connect31 sends an MQTT 3.1 CONNECT and returns the connection with the
+// CONNACK return code. The connection is nil unless the broker accepted.
+func connect31(cfg common.Config, clientID string) (net.Conn, byte, error) {
+	flags := byte(0x02) // Clean session
+	if cfg.Username != "" {
+		flags |= 0x80
+	}
+	if cfg.Password != "" {
+		flags |= 0x40
+	}
+	body := common.AppendString(nil, "MQIsdp")
+	body = append(body, 3, flags, 0, 30)
+	body = common.AppendString(body, clientID)
+	if cfg.Username != "" {
+		body = common.AppendString(body, cfg.Username)
+	}
+	if cfg.Password != "" {
+		body = common.AppendString(body, cfg.Password)
+	}
+
+	conn, err := common.Dial(cfg)
+	if err != nil {
+		return nil, 0, err
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(common.RawPacket(0x10, body)); err != nil {
+		conn.Close()
+		return nil, 0, fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+	header, connack, err := common.ReadRawPacket(conn)
+	if err != nil {
+		conn.Close()
+		return nil, 0, fmt.Errorf("no CONNACK for MQTT 3.1 CONNECT: %w", err)
+	}
+	if header != 0x20 || len(connack) < 2 {
+		conn.Close()
+		return nil, 0, fmt.Errorf("expected CONNACK, got packet 0x%02x", header)
+	}
+	code := connack[1]
+	if code != connack31Accepted {
+		conn.Close()
+		return nil, code, nil
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, code, nil
+}
+
+// supports31 connects with MQTT 3.1 and reports whether the broker accepted.
+// A skipped result is filled in when it did not.
+func supports31(cfg common.Config, result *common.TestResult) bool {
+	conn, code, err := connect31(cfg, clientID31(cfg, "v31-probe"))
+	if err != nil {
+		result.Error = err
+		return false
+	}
+	if conn == nil {
+		result.Status = common.StatusSkipped
+		result.Notes = fmt.Sprintf("broker does not accept MQTT 3.1 (CONNACK 0x%02x)", code)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// testMQTT31Connect tests that an MQTT 3.1 CONNECT is either accepted or
+// refused with return code 0x01 [MQTT-3.1.2-2]
+// "The Server MUST respond to the CONNECT Packet with a CONNACK return code
+// 0x01 (unacceptable protocol level) and then disconnect the Client if the
+// Protocol Level is not supported by the Server"
+func testMQTT31Connect(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "MQTT 3.1 CONNECT Accepted or Refused with 0x01",
+		SpecRef: "MQTT-3.1.2-2",
+	}
+
+	conn, code, err := connect31(cfg, clientID31(cfg, "v31-connect"))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	switch code {
+	case connack31Accepted:
+		conn.Close()
+		result.Status = common.StatusPassed
+		result.Notes = "broker supports MQTT 3.1"
+	case connack31UnacceptableVersion:
+		result.Status = common.StatusPassed
+		result.Notes = "broker supports MQTT 3.1.1 only and refused MQTT 3.1"
+	default:
+		result.Error = fmt.Errorf("MQTT 3.1 CONNECT refused with CONNACK 0x%02x, expected 0x00 or 0x01", code)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testMQTT31ClientIDMaxLength tests that a 3.1 broker accepts a client ID of
+// 23 characters, the longest MQTT 3.1 allows
+func testMQTT31ClientIDMaxLength(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "MQTT 3.1 Client ID of 23 Characters",
+	}
+
+	if !supports31(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	clientID := clientID31(cfg, "v31-max")
+	clientID += strings.Repeat("x", 23-len(clientID))
+	conn, code, err := connect31(cfg, clientID)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if conn == nil {
+		result.Error = fmt.Errorf("23 character client ID refused with CONNACK 0x%02x", code)
+		result.Duration = time.Since(start)
+		return result
+	}
+	conn.Close()
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testMQTT31ClientIDTooLong tests that a 3.1 broker refuses client IDs over 23
+// characters with return code 0x02. MQTT 3.1.1 lifted the limit and many
+// brokers apply their 3.1.1 rules to 3.1 clients as well, so accepting is a
+// warning.
+func testMQTT31ClientIDTooLong(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "MQTT 3.1 Client ID Longer Than 23 Characters",
+	}
+
+	if !supports31(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	clientID := cfg.ClientID("v31-too-long-client-identifier")
+	conn, code, err := connect31(cfg, clientID)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	switch {
+	case conn != nil:
+		conn.Close()
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker accepted a %d character client ID from an MQTT 3.1 client", len(clientID))
+	case code == connack31IdentifierRejected:
+		result.Status = common.StatusPassed
+	default:
+		result.Error = fmt.Errorf("long client ID refused with CONNACK 0x%02x, expected 0x02", code)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testMQTT31EmptyClientID tests that a 3.1 broker refuses an empty client ID
+// with return code 0x02. MQTT 3.1 requires 1 to 23 characters; accepting one
+// as MQTT 3.1.1 does is a warning.
+func testMQTT31EmptyClientID(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "MQTT 3.1 Empty Client ID",
+	}
+
+	if !supports31(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	conn, code, err := connect31(cfg, "")
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	switch {
+	case conn != nil:
+		conn.Close()
+		result.Status = common.StatusWarning
+		result.Notes = "broker accepted an empty client ID from an MQTT 3.1 client"
+	case code == connack31IdentifierRejected:
+		result.Status = common.StatusPassed
+	default:
+		result.Error = fmt.Errorf("empty client ID refused with CONNACK 0x%02x, expected 0x02", code)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testMQTT31PublishSubscribe tests that a message published by an MQTT 3.1
+// client reaches an MQTT 3.1 subscriber
+func testMQTT31PublishSubscribe(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "MQTT 3.1 Publish/Subscribe",
+	}
+
+	if !supports31(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	conn, code, err := connect31(cfg, clientID31(cfg, "v31-pubsub"))
+	if err == nil && conn == nil {
+		err = fmt.Errorf("refused with CONNACK 0x%02x", code)
+	}
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(cfg.Scaled(5 * time.Second)))
+
+	topic := cfg.Topic("test/v31")
+	subscribe := common.AppendString([]byte{0x00, 0x01}, topic)
+	subscribe = append(subscribe, 0x00) // QoS 0
+	if _, err := conn.Write(common.RawPacket(0x82, subscribe)); err != nil {
+		result.Error = fmt.Errorf("failed to send SUBSCRIBE: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	header, suback, err := common.ReadRawPacket(conn)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to read SUBACK: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	if header != 0x90 || len(suback) < 3 || suback[2] != 0x00 {
+		result.Error = fmt.Errorf("expected SUBACK granting QoS 0, got packet 0x%02x % x", header, suback)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	payload := "hello from MQTT 3.1"
+	publish := common.AppendString(nil, topic)
+	publish = append(publish, payload...)
+	if _, err := conn.Write(common.RawPacket(0x30, publish)); err != nil {
+		result.Error = fmt.Errorf("failed to send PUBLISH: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	header, received, err := common.ReadRawPacket(conn)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			err = errors.New("message not received")
+		}
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if header&0xF0 != 0x30 || !strings.HasSuffix(string(received), payload) {
+		result.Error = fmt.Errorf("expected the published message, got packet 0x%02x", header)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
@@ -1,6 +1,7 @@
 package v3
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -12,10 +13,12 @@ import (
 func NegativeTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "Negative Tests",
+		Tags: []string{"negative"},
 		Tests: []common.TestFunc{
 			testPublishWithWildcardTopic,
 			testInvalidQoS,
 			testSecondConnectPacket,
+			testSecondConnectMidSession,
 			testEmptySubscribe,
 			testInvalidProtocolName,
 			testInvalidProtocolLevel,
@@ -25,14 +28,14 @@ func NegativeTests() common.TestGroup {
 }
 
 // testPublishWithWildcardTopic tests PUBLISH with wildcards in topic is invalid [MQTT-3.3.2-2]
-func testPublishWithWildcardTopic(cfg common.Config) common.TestResult {
+func testPublishWithWildcardTopic(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "PUBLISH with Wildcard Topic (Invalid)",
 		SpecRef: "MQTT-3.3.2-2",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-pub-wildcard"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-wildcard"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -41,26 +44,27 @@ func testPublishWithWildcardTopic(cfg common.Config) common.TestResult {
 	defer client.Disconnect(250)
 
 	// Try to publish to topic with wildcard (should fail or be rejected)
-	token := client.Publish("test/+/wildcard", 0, false, "invalid")
+	token := client.Publish(cfg.Topic("test/+/wildcard"), 0, false, "invalid")
 	token.WaitTimeout(2 * time.Second)
 
 	// The library may catch this, or the broker will reject it
 	// Test passes if we're still connected or if publish fails
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "cannot observe whether the broker rejected the wildcard topic"
 
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testInvalidQoS tests QoS value of 3 is invalid [MQTT-3.3.1-4]
-func testInvalidQoS(cfg common.Config) common.TestResult {
+func testInvalidQoS(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Invalid QoS 3",
 		SpecRef: "MQTT-3.3.1-4",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-invalid-qos"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-invalid-qos"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -71,71 +75,106 @@ func testInvalidQoS(cfg common.Config) common.TestResult {
 	// The paho.mqtt.golang library should prevent QoS 3
 	// If we try to use it, library will reject or clamp it
 	// This test verifies the behavior is handled correctly
-	token := client.Publish("test/qos/invalid", 2, false, "test") // Library won't allow QoS 3
+	token := client.Publish(cfg.Topic("test/qos/invalid"), 2, false, "test") // Library won't allow QoS 3
 	token.Wait()
 
 	// Test passes if library handles it gracefully
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "the client library cannot send QoS 3"
 
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testSecondConnectPacket tests second CONNECT packet causes disconnect [MQTT-3.1.0-2]
-func testSecondConnectPacket(cfg common.Config) common.TestResult {
+// "The Server MUST process a second CONNECT Packet sent from a Client as a
+// protocol violation and disconnect the Client"
+func testSecondConnectPacket(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Second CONNECT Packet (Protocol Violation)",
 		SpecRef: "MQTT-3.1.0-2",
 	}
 
-	// The paho.mqtt.golang library prevents sending a second CONNECT packet
-	// This test verifies that the library behaves correctly
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-second-connect"), nil)
+	// The client library never sends a second CONNECT, so both go out as
+	// raw bytes
+	clientID := cfg.ClientID("test-second-connect")
+	conn, err := common.DialRaw(cfg, 4, clientID)
 	if err != nil {
 		result.Error = fmt.Errorf("first connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
-	defer client.Disconnect(250)
+	defer conn.Close()
+
+	if _, err := conn.Write(common.RawConnect(4, clientID, cfg.Username, cfg.Password)); err == nil {
+		data, closed := common.AwaitClose(conn, cfg.Scaled(2*time.Second))
+		switch {
+		case len(data) > 0:
+			result.Error = fmt.Errorf("broker answered the second CONNECT with packet 0x%02x", data[0])
+			result.Duration = time.Since(start)
+			return result
+		case !closed:
+			result.Error = fmt.Errorf("broker kept the connection open after a second CONNECT")
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
 
-	// Already connected - library won't allow second CONNECT
-	// If we call Connect() again, it should either no-op or handle gracefully
-	if client.IsConnected() {
-		result.Passed = true
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSecondConnectMidSession tests that a second CONNECT with Clean Session
+// set, sent on a connection resuming a persistent session, is not processed:
+// the broker disconnects the client and the session keeps its subscription
+// [MQTT-3.1.0-2]
+// "The Server MUST process a second CONNECT Packet sent from a Client as a
+// protocol violation and disconnect the Client"
+func testSecondConnectMidSession(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Second CONNECT Leaves Session Intact",
+		SpecRef: "MQTT-3.1.0-2",
 	}
 
+	if err := common.CheckSecondConnectMidSession(cfg, 4); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
-// testEmptySubscribe tests SUBSCRIBE with no payload is invalid [MQTT-3.8.3-3]
-func testEmptySubscribe(cfg common.Config) common.TestResult {
+// testEmptySubscribe tests that a SUBSCRIBE with no payload closes the
+// connection [MQTT-3.8.3-3]
+// "The payload of a SUBSCRIBE packet MUST contain at least one Topic Filter /
+// QoS pair. A SUBSCRIBE packet with no payload is a protocol violation"
+func testEmptySubscribe(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Empty SUBSCRIBE (Invalid)",
 		SpecRef: "MQTT-3.8.3-3",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-empty-sub"), nil)
-	if err != nil {
-		result.Error = fmt.Errorf("connect failed: %w", err)
+	packet := common.RawPacket(0x82, []byte{0x00, 0x01}) // Packet identifier only
+	if err := expectClosed(cfg, "test-empty-sub", packet); err != nil {
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
-	defer client.Disconnect(250)
-
-	// The paho.mqtt.golang library requires at least one topic
-	// This test verifies proper handling
-	// We can't actually send empty SUBSCRIBE with this library, so test passes
-	result.Passed = true
 
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testInvalidProtocolName tests invalid protocol name is rejected [MQTT-3.1.2-1]
-func testInvalidProtocolName(cfg common.Config) common.TestResult {
+func testInvalidProtocolName(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Invalid Protocol Name",
@@ -145,23 +184,25 @@ func testInvalidProtocolName(cfg common.Config) common.TestResult {
 	// The paho.mqtt.golang library sends correct protocol name
 	// We can't easily test this without raw packet manipulation
 	// Test documents the requirement
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "the client library always sends the correct protocol name"
 
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testInvalidProtocolLevel tests unsupported protocol level [MQTT-3.1.2-2]
-func testInvalidProtocolLevel(cfg common.Config) common.TestResult {
+func testInvalidProtocolLevel(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Invalid Protocol Level",
 		SpecRef: "MQTT-3.1.2-2",
 	}
 
-	clientID := common.GenerateClientID("test-proto-level")
+	clientID := cfg.ClientID("test-proto-level")
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetProtocolVersion(3) // MQTT 3.1 (not 3.1.1)
 	opts.SetCleanSession(true)
@@ -174,7 +215,8 @@ func testInvalidProtocolLevel(cfg common.Config) common.TestResult {
 
 	// May be rejected with CONNACK return code 0x01
 	// Test passes either way (broker may support 3.1)
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "broker may legitimately support MQTT 3.1"
 	if token.Error() == nil {
 		client.Disconnect(250)
 	}
@@ -184,7 +226,7 @@ func testInvalidProtocolLevel(cfg common.Config) common.TestResult {
 }
 
 // testReservedFlagViolation tests reserved flags must be as specified [MQTT-3.1.2-3]
-func testReservedFlagViolation(cfg common.Config) common.TestResult {
+func testReservedFlagViolation(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Reserved Flag Validation",
@@ -194,7 +236,7 @@ func testReservedFlagViolation(cfg common.Config) common.TestResult {
 	// The paho.mqtt.golang library sets reserved flags correctly
 	// We can't easily violate this without raw packet manipulation
 	// Test documents the requirement
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-reserved"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-reserved"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -202,7 +244,8 @@ func testReservedFlagViolation(cfg common.Config) common.TestResult {
 	}
 	defer client.Disconnect(250)
 
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "the client library always sets reserved flags correctly"
 
 	result.Duration = time.Since(start)
 	return result
@@ -0,0 +1,200 @@
+package v3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// PacketFormatTests returns byte-level tests of fixed header validation,
+// sent over raw connections since the client library only sends well-formed
+// packets [MQTT-2.2]
+func PacketFormatTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Packet Format Validation",
+		Tags: []string{"packet-format", "negative"},
+		Tests: []common.TestFunc{
+			testReservedPacketTypes,
+			testPingreqReservedFlags,
+			testPublishQoS3,
+			testPubrelFixedFlags,
+			testSubscribeFixedFlags,
+			testUnsubscribeFixedFlags,
+			testPublishPacketIDZero,
+			testSubscribePacketIDZero,
+			testUnsubscribePacketIDZero,
+		},
+	}
+}
+
+// expectClosed connects with a raw CONNECT, sends packet and checks that the
+// broker closes the network connection. MQTT 3.1.1 has no way for a server to
+// report a protocol error other than closing the connection.
+func expectClosed(cfg common.Config, clientPrefix string, packet []byte) error {
+	conn, err := common.DialRaw(cfg, 4, cfg.ClientID(clientPrefix))
+	if err != nil {
+		return fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(packet); err != nil {
+		// The broker closed the connection already
+		return nil
+	}
+	data, closed := common.AwaitClose(conn, cfg.Scaled(2*time.Second))
+	switch {
+	case closed:
+		return nil
+	case len(data) > 0:
+		return fmt.Errorf("broker answered with packet 0x%02x instead of closing the connection", data[0])
+	default:
+		return errors.New("broker kept the connection open")
+	}
+}
+
+// testReservedPacketTypes tests that packet types 0 and 15, which are
+// reserved in 3.1.1, are treated as protocol violations [MQTT-4.8.0-1]
+// "Unless stated otherwise, if either the Server or Client encounters a
+// protocol violation, it MUST close the Network Connection"
+func testReservedPacketTypes(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject Reserved Packet Types (0, 15)",
+		SpecRef: "MQTT-4.8.0-1",
+	}
+
+	for _, header := range []byte{0x00, 0xF0} {
+		if err := expectClosed(cfg, "test-reserved-type", []byte{header, 0x00}); err != nil {
+			result.Error = fmt.Errorf("packet type %d: %w", header>>4, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPingreqReservedFlags tests that a fixed header with reserved flag bits
+// set closes the connection [MQTT-2.2.2-2]
+// "If invalid flags are received, the receiver MUST close the Network
+// Connection"
+func testPingreqReservedFlags(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject Invalid Reserved Flags (PINGREQ 0xC1)",
+		SpecRef: "MQTT-2.2.2-2",
+	}
+
+	if err := expectClosed(cfg, "test-pingreq-flags", []byte{0xC1, 0x00}); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPublishQoS3 tests that a PUBLISH with both QoS bits set closes the
+// connection [MQTT-3.3.1-4]
+// "A PUBLISH Packet MUST NOT have both QoS bits set to 1. If a Server or
+// Client receives a PUBLISH Packet which has both QoS bits set to 1 it MUST
+// close the Network Connection"
+func testPublishQoS3(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject PUBLISH with QoS 3",
+		SpecRef: "MQTT-3.3.1-4",
+	}
+
+	body := common.AppendString(nil, cfg.Topic("test/qos3"))
+	body = append(body, 0x00, 0x01) // Packet identifier
+	body = append(body, "qos3"...)
+	if err := expectClosed(cfg, "test-qos3", common.RawPacket(0x36, body)); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPubrelFixedFlags tests PUBREL fixed header flags [MQTT-3.6.1-1]
+// "Bits 3,2,1 and 0 of the fixed header in the PUBREL Control Packet are
+// reserved and MUST be set to 0,0,1 and 0 respectively. The Server MUST treat
+// any other value as malformed and close the Network Connection"
+func testPubrelFixedFlags(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject PUBREL with Invalid Flags (0x60)",
+		SpecRef: "MQTT-3.6.1-1",
+	}
+
+	if err := expectClosed(cfg, "test-pubrel-flags", []byte{0x60, 0x02, 0x00, 0x01}); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSubscribeFixedFlags tests SUBSCRIBE fixed header flags [MQTT-3.8.1-1]
+// "Bits 3,2,1 and 0 of the fixed header of the SUBSCRIBE Control Packet are
+// reserved and MUST be set to 0,0,1 and 0 respectively. The Server MUST treat
+// any other value as malformed and close the Network Connection"
+func testSubscribeFixedFlags(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject SUBSCRIBE with Invalid Flags (0x80)",
+		SpecRef: "MQTT-3.8.1-1",
+	}
+
+	body := []byte{0x00, 0x01} // Packet identifier
+	body = common.AppendString(body, cfg.Topic("test/subscribe-flags"))
+	body = append(body, 0x00) // Requested QoS
+	if err := expectClosed(cfg, "test-subscribe-flags", common.RawPacket(0x80, body)); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUnsubscribeFixedFlags tests UNSUBSCRIBE fixed header flags
+// [MQTT-3.10.1-1]
+// "Bits 3,2,1 and 0 of the fixed header of the UNSUBSCRIBE Control Packet
+// are reserved and MUST be set to 0,0,1 and 0 respectively. The Server MUST
+// treat any other value as malformed and close the Network Connection"
+func testUnsubscribeFixedFlags(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject UNSUBSCRIBE with Invalid Flags (0xA0)",
+		SpecRef: "MQTT-3.10.1-1",
+	}
+
+	body := []byte{0x00, 0x01} // Packet identifier
+	body = common.AppendString(body, cfg.Topic("test/unsubscribe-flags"))
+	if err := expectClosed(cfg, "test-unsubscribe-flags", common.RawPacket(0xA0, body)); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
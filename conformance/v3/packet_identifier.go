@@ -0,0 +1,78 @@
+package v3
+
+import (
+	"context"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// testPublishPacketIDZero tests that a QoS 1 PUBLISH with Packet Identifier 0
+// is treated as malformed [MQTT-2.3.1-1]
+// "SUBSCRIBE, UNSUBSCRIBE, and PUBLISH (in cases where QoS > 0) Control
+// Packets MUST contain a non-zero 16-bit Packet Identifier"
+func testPublishPacketIDZero(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject QoS 1 PUBLISH with Packet Identifier 0",
+		SpecRef: "MQTT-2.3.1-1",
+	}
+
+	body := common.AppendString(nil, cfg.Topic("test/packet-id-zero"))
+	body = append(body, 0x00, 0x00) // Packet identifier 0
+	body = append(body, "zero"...)
+	if err := expectClosed(cfg, "test-publish-pid0", common.RawPacket(0x32, body)); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSubscribePacketIDZero tests that a SUBSCRIBE with Packet Identifier 0 is
+// treated as malformed [MQTT-2.3.1-1]
+func testSubscribePacketIDZero(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject SUBSCRIBE with Packet Identifier 0",
+		SpecRef: "MQTT-2.3.1-1",
+	}
+
+	body := []byte{0x00, 0x00} // Packet identifier 0
+	body = common.AppendString(body, cfg.Topic("test/packet-id-zero"))
+	body = append(body, 0x00) // Requested QoS
+	if err := expectClosed(cfg, "test-subscribe-pid0", common.RawPacket(0x82, body)); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUnsubscribePacketIDZero tests that an UNSUBSCRIBE with Packet
+// Identifier 0 is treated as malformed [MQTT-2.3.1-1]
+func testUnsubscribePacketIDZero(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject UNSUBSCRIBE with Packet Identifier 0",
+		SpecRef: "MQTT-2.3.1-1",
+	}
+
+	body := []byte{0x00, 0x00} // Packet identifier 0
+	body = common.AppendString(body, cfg.Topic("test/packet-id-zero"))
+	if err := expectClosed(cfg, "test-unsubscribe-pid0", common.RawPacket(0xA2, body)); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
@@ -1,6 +1,7 @@
 package v3
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -12,25 +13,30 @@ import (
 func PingTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "PING",
+		Tags: []string{"core", "timing"},
 		Tests: []common.TestFunc{
 			testPingRequest,
 			testKeepAliveZero,
 			testKeepAliveEnforcement,
+			testPingRespDeadline,
+			testPingReqRemainingLength,
+			testNoUnsolicitedPingResp,
 		},
 	}
 }
 
 // testPingRequest tests PINGREQ/PINGRESP exchange [MQTT-3.1.2-23]
-func testPingRequest(cfg common.Config) common.TestResult {
+func testPingRequest(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "PINGREQ/PINGRESP Exchange",
 		SpecRef: "MQTT-3.1.2-23",
 	}
 
-	clientID := common.GenerateClientID("test-ping")
+	clientID := cfg.ClientID("test-ping")
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetCleanSession(true)
 	opts.SetConnectTimeout(5 * time.Second)
@@ -60,7 +66,7 @@ func testPingRequest(cfg common.Config) common.TestResult {
 	if !client.IsConnected() {
 		result.Error = fmt.Errorf("client disconnected (PING failed)")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -68,16 +74,17 @@ func testPingRequest(cfg common.Config) common.TestResult {
 }
 
 // testKeepAliveZero tests keep-alive = 0 (disabled) [MQTT-3.1.2-10]
-func testKeepAliveZero(cfg common.Config) common.TestResult {
+func testKeepAliveZero(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Keep Alive Zero (Disabled)",
 		SpecRef: "MQTT-3.1.2-10",
 	}
 
-	clientID := common.GenerateClientID("test-keepalive-zero")
+	clientID := cfg.ClientID("test-keepalive-zero")
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetCleanSession(true)
 	opts.SetConnectTimeout(5 * time.Second)
@@ -105,7 +112,7 @@ func testKeepAliveZero(cfg common.Config) common.TestResult {
 	if !client.IsConnected() {
 		result.Error = fmt.Errorf("client disconnected with keep-alive=0")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -113,7 +120,7 @@ func testKeepAliveZero(cfg common.Config) common.TestResult {
 }
 
 // testKeepAliveEnforcement tests server disconnects after 1.5x keep-alive [MQTT-3.1.2-24]
-func testKeepAliveEnforcement(cfg common.Config) common.TestResult {
+func testKeepAliveEnforcement(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Keep Alive Enforcement",
@@ -124,9 +131,10 @@ func testKeepAliveEnforcement(cfg common.Config) common.TestResult {
 	// handles PINGs. We test that the mechanism works by verifying connection
 	// stays alive with proper keep-alive.
 
-	clientID := common.GenerateClientID("test-keepalive-enforce")
+	clientID := cfg.ClientID("test-keepalive-enforce")
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
+	setDialer(opts, cfg)
 	opts.SetClientID(clientID)
 	opts.SetCleanSession(true)
 	opts.SetConnectTimeout(5 * time.Second)
@@ -155,9 +163,77 @@ func testKeepAliveEnforcement(cfg common.Config) common.TestResult {
 	if !client.IsConnected() {
 		result.Error = fmt.Errorf("client disconnected despite proper keep-alive")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
 	return result
 }
+
+// testPingRespDeadline tests, on a raw connection, that every PINGREQ is
+// answered with a PINGRESP of Remaining Length 0 within a deadline
+// [MQTT-3.12.4-1]
+// "The Server MUST send a PINGRESP Packet in response to a PINGREQ Packet"
+func testPingRespDeadline(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "PINGRESP Within Deadline",
+		SpecRef: "MQTT-3.12.4-1",
+	}
+
+	slowest, err := common.CheckPingResponses(cfg, 4)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Notes = fmt.Sprintf("slowest PINGRESP %v", slowest.Round(time.Microsecond))
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPingReqRemainingLength tests that a PINGREQ with a nonzero Remaining
+// Length, which the packet does not have, is treated as a protocol violation
+// [MQTT-4.8.0-1]
+// "Unless stated otherwise, if either the Server or Client encounters a
+// protocol violation, it MUST close the Network Connection"
+func testPingReqRemainingLength(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject PINGREQ With Nonzero Remaining Length",
+		SpecRef: "MQTT-4.8.0-1",
+	}
+
+	if err := expectClosed(cfg, "test-pingreq-remlen", []byte{0xC0, 0x01, 0x00}); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testNoUnsolicitedPingResp tests, on a raw connection, that the broker
+// sends a PINGRESP only in answer to a PINGREQ: none on an idle connection,
+// none alongside other flows and one per PINGREQ [MQTT-3.13]
+func testNoUnsolicitedPingResp(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "No Unsolicited PINGRESP",
+		SpecRef: "MQTT-3.13",
+	}
+
+	if err := common.CheckNoUnsolicitedPingresp(cfg, 4); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
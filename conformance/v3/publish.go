@@ -1,6 +1,7 @@
 package v3
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -13,6 +14,7 @@ import (
 func PublishSubscribeTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "Publish/Subscribe",
+		Tags: []string{"core", "retain"},
 		Tests: []common.TestFunc{
 			testBasicPublishSubscribe,
 			testPublishQoS0,
@@ -23,13 +25,14 @@ func PublishSubscribeTests() common.TestGroup {
 			testSubscriptionReplacement,
 			testRetainedMessage,
 			testRetainedMessageClear,
+			testRetainedMessageReplacement,
 			testPublishToMultipleSubscribers,
 		},
 	}
 }
 
 // testBasicPublishSubscribe tests basic publish and subscribe [MQTT-3.3.1-1]
-func testBasicPublishSubscribe(cfg common.Config) common.TestResult {
+func testBasicPublishSubscribe(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Basic Publish/Subscribe",
@@ -44,7 +47,7 @@ func testBasicPublishSubscribe(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -52,22 +55,14 @@ func testBasicPublishSubscribe(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "test/basic/pubsub"
-	token := subscriber.Subscribe(topic, 0, nil)
-	if !token.WaitTimeout(5 * time.Second) {
-		result.Error = fmt.Errorf("subscribe timeout")
-		result.Duration = time.Since(start)
-		return result
-	}
-	if token.Error() != nil {
-		result.Error = fmt.Errorf("subscribe failed: %w", token.Error())
+	topic := cfg.Topic("test/basic/pubsub")
+	if err := SubscribeSync(cfg, subscriber, topic, 0, nil); err != nil {
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -75,7 +70,7 @@ func testBasicPublishSubscribe(cfg common.Config) common.TestResult {
 	}
 	defer publisher.Disconnect(250)
 
-	token = publisher.Publish(topic, 0, false, "test message")
+	token := publisher.Publish(topic, 0, false, "test message")
 	if !token.WaitTimeout(5 * time.Second) {
 		result.Error = fmt.Errorf("publish timeout")
 		result.Duration = time.Since(start)
@@ -87,14 +82,14 @@ func testBasicPublishSubscribe(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedMessage {
 		result.Error = fmt.Errorf("message not received")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -102,7 +97,7 @@ func testBasicPublishSubscribe(cfg common.Config) common.TestResult {
 }
 
 // testPublishQoS0 tests QoS 0 publish [MQTT-4.3.1-1]
-func testPublishQoS0(cfg common.Config) common.TestResult {
+func testPublishQoS0(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Publish QoS 0",
@@ -117,7 +112,7 @@ func testPublishQoS0(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos0-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos0-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -125,18 +120,14 @@ func testPublishQoS0(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "test/qos0"
-	token := subscriber.Subscribe(topic, 0, nil)
-	token.Wait()
-	if token.Error() != nil {
-		result.Error = fmt.Errorf("subscribe failed: %w", token.Error())
+	topic := cfg.Topic("test/qos0")
+	if err := SubscribeSync(cfg, subscriber, topic, 0, nil); err != nil {
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos0-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos0-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -144,7 +135,7 @@ func testPublishQoS0(cfg common.Config) common.TestResult {
 	}
 	defer publisher.Disconnect(250)
 
-	token = publisher.Publish(topic, 0, false, "QoS 0 message")
+	token := publisher.Publish(topic, 0, false, "QoS 0 message")
 	token.Wait()
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("publish failed: %w", token.Error())
@@ -152,14 +143,14 @@ func testPublishQoS0(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if receivedCount == 0 {
 		result.Error = fmt.Errorf("message not received")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -167,7 +158,7 @@ func testPublishQoS0(cfg common.Config) common.TestResult {
 }
 
 // testPublishQoS1 tests QoS 1 publish [MQTT-4.3.2-1]
-func testPublishQoS1(cfg common.Config) common.TestResult {
+func testPublishQoS1(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Publish QoS 1",
@@ -182,7 +173,7 @@ func testPublishQoS1(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos1-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos1-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -190,18 +181,14 @@ func testPublishQoS1(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "test/qos1"
-	token := subscriber.Subscribe(topic, 1, nil)
-	token.Wait()
-	if token.Error() != nil {
-		result.Error = fmt.Errorf("subscribe failed: %w", token.Error())
+	topic := cfg.Topic("test/qos1")
+	if err := SubscribeSync(cfg, subscriber, topic, 1, nil); err != nil {
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos1-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos1-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -209,7 +196,7 @@ func testPublishQoS1(cfg common.Config) common.TestResult {
 	}
 	defer publisher.Disconnect(250)
 
-	token = publisher.Publish(topic, 1, false, "QoS 1 message")
+	token := publisher.Publish(topic, 1, false, "QoS 1 message")
 	token.Wait()
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("publish failed: %w", token.Error())
@@ -217,14 +204,14 @@ func testPublishQoS1(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if receivedCount == 0 {
 		result.Error = fmt.Errorf("message not received")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -232,7 +219,7 @@ func testPublishQoS1(cfg common.Config) common.TestResult {
 }
 
 // testPublishQoS2 tests QoS 2 publish [MQTT-4.3.3-1]
-func testPublishQoS2(cfg common.Config) common.TestResult {
+func testPublishQoS2(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Publish QoS 2",
@@ -247,7 +234,7 @@ func testPublishQoS2(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos2-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos2-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -255,18 +242,14 @@ func testPublishQoS2(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "test/qos2"
-	token := subscriber.Subscribe(topic, 2, nil)
-	token.Wait()
-	if token.Error() != nil {
-		result.Error = fmt.Errorf("subscribe failed: %w", token.Error())
+	topic := cfg.Topic("test/qos2")
+	if err := SubscribeSync(cfg, subscriber, topic, 2, nil); err != nil {
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos2-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos2-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -274,7 +257,7 @@ func testPublishQoS2(cfg common.Config) common.TestResult {
 	}
 	defer publisher.Disconnect(250)
 
-	token = publisher.Publish(topic, 2, false, "QoS 2 message")
+	token := publisher.Publish(topic, 2, false, "QoS 2 message")
 	token.Wait()
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("publish failed: %w", token.Error())
@@ -282,7 +265,7 @@ func testPublishQoS2(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -291,7 +274,7 @@ func testPublishQoS2(cfg common.Config) common.TestResult {
 	} else if receivedCount > 1 {
 		result.Error = fmt.Errorf("message received %d times (expected exactly once)", receivedCount)
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -299,14 +282,14 @@ func testPublishQoS2(cfg common.Config) common.TestResult {
 }
 
 // testSubscribeAcknowledgement tests SUBSCRIBE acknowledgement [MQTT-3.8.4-1]
-func testSubscribeAcknowledgement(cfg common.Config) common.TestResult {
+func testSubscribeAcknowledgement(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Subscribe Acknowledgement",
 		SpecRef: "MQTT-3.8.4-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-suback"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-suback"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -314,7 +297,7 @@ func testSubscribeAcknowledgement(cfg common.Config) common.TestResult {
 	}
 	defer client.Disconnect(250)
 
-	topic := "test/suback"
+	topic := cfg.Topic("test/suback")
 	token := client.Subscribe(topic, 1, nil)
 	if !token.WaitTimeout(5 * time.Second) {
 		result.Error = fmt.Errorf("subscribe timeout")
@@ -325,7 +308,7 @@ func testSubscribeAcknowledgement(cfg common.Config) common.TestResult {
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("subscribe failed: %w", token.Error())
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -333,7 +316,7 @@ func testSubscribeAcknowledgement(cfg common.Config) common.TestResult {
 }
 
 // testMultipleSubscriptions tests multiple subscriptions [MQTT-3.8.4-4]
-func testMultipleSubscriptions(cfg common.Config) common.TestResult {
+func testMultipleSubscriptions(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Multiple Subscriptions",
@@ -348,7 +331,7 @@ func testMultipleSubscriptions(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-multi-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-multi-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -358,21 +341,17 @@ func testMultipleSubscriptions(cfg common.Config) common.TestResult {
 
 	// Subscribe to multiple topics
 	topics := map[string]byte{
-		"test/multi/topic1": 0,
-		"test/multi/topic2": 1,
+		cfg.Topic("test/multi/topic1"): 0,
+		cfg.Topic("test/multi/topic2"): 1,
 	}
 
-	token := subscriber.SubscribeMultiple(topics, nil)
-	token.Wait()
-	if token.Error() != nil {
-		result.Error = fmt.Errorf("subscribe failed: %w", token.Error())
+	if err := SubscribeMultipleSync(cfg, subscriber, topics, nil); err != nil {
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-multi-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-multi-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -380,17 +359,17 @@ func testMultipleSubscriptions(cfg common.Config) common.TestResult {
 	}
 	defer publisher.Disconnect(250)
 
-	publisher.Publish("test/multi/topic1", 0, false, "message1").Wait()
-	publisher.Publish("test/multi/topic2", 1, false, "message2").Wait()
+	publisher.Publish(cfg.Topic("test/multi/topic1"), 0, false, "message1").Wait()
+	publisher.Publish(cfg.Topic("test/multi/topic2"), 1, false, "message2").Wait()
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if len(receivedTopics) != 2 {
 		result.Error = fmt.Errorf("expected messages on 2 topics, got %d", len(receivedTopics))
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -398,14 +377,14 @@ func testMultipleSubscriptions(cfg common.Config) common.TestResult {
 }
 
 // testSubscriptionReplacement tests subscription replacement [MQTT-3.8.4-3]
-func testSubscriptionReplacement(cfg common.Config) common.TestResult {
+func testSubscriptionReplacement(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Subscription Replacement",
 		SpecRef: "MQTT-3.8.4-3",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-sub-replace"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-replace"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -413,7 +392,7 @@ func testSubscriptionReplacement(cfg common.Config) common.TestResult {
 	}
 	defer client.Disconnect(250)
 
-	topic := "test/replace"
+	topic := cfg.Topic("test/replace")
 
 	// First subscription with QoS 0
 	token := client.Subscribe(topic, 0, nil)
@@ -430,7 +409,7 @@ func testSubscriptionReplacement(cfg common.Config) common.TestResult {
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("second subscribe failed: %w", token.Error())
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -438,17 +417,17 @@ func testSubscriptionReplacement(cfg common.Config) common.TestResult {
 }
 
 // testRetainedMessage tests retained message delivery [MQTT-3.3.1-5, MQTT-3.3.1-6]
-func testRetainedMessage(cfg common.Config) common.TestResult {
+func testRetainedMessage(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Retained Message",
 		SpecRef: "MQTT-3.3.1-6",
 	}
 
-	topic := "test/retained"
+	topic := cfg.Topic("test/retained")
 
 	// Publish retained message
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-retained-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-retained-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -465,7 +444,7 @@ func testRetainedMessage(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Subscribe and expect to receive retained message
 	var mu sync.Mutex
@@ -476,7 +455,7 @@ func testRetainedMessage(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-retained-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-retained-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -492,14 +471,14 @@ func testRetainedMessage(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedRetained {
 		result.Error = fmt.Errorf("retained message not received")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -507,17 +486,17 @@ func testRetainedMessage(cfg common.Config) common.TestResult {
 }
 
 // testRetainedMessageClear tests clearing retained message [MQTT-3.3.1-10, MQTT-3.3.1-11]
-func testRetainedMessageClear(cfg common.Config) common.TestResult {
+func testRetainedMessageClear(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Clear Retained Message",
 		SpecRef: "MQTT-3.3.1-10",
 	}
 
-	topic := "test/retained/clear"
+	topic := cfg.Topic("test/retained/clear")
 
 	// Publish retained message
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-clear-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-clear-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -526,11 +505,11 @@ func testRetainedMessageClear(cfg common.Config) common.TestResult {
 	defer publisher.Disconnect(250)
 
 	publisher.Publish(topic, 1, true, "retained").Wait()
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	// Clear retained message with zero-byte payload
 	publisher.Publish(topic, 1, true, "").Wait()
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	// Subscribe and expect NOT to receive retained message
 	var mu sync.Mutex
@@ -541,7 +520,7 @@ func testRetainedMessageClear(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-clear-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-clear-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -550,29 +529,133 @@ func testRetainedMessageClear(cfg common.Config) common.TestResult {
 	defer subscriber.Disconnect(250)
 
 	subscriber.Subscribe(topic, 1, nil).Wait()
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if receivedMessage {
 		result.Error = fmt.Errorf("received message when retained should have been cleared")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRetainedMessageReplacement tests that only the last retained message on
+// a topic is kept, and that a QoS 0 retained message replaces the previous one
+// even if the broker later discards it [MQTT-3.3.1-5, MQTT-3.3.1-7]
+// "If the Server receives a QoS 0 message with the RETAIN flag set to 1 it MUST
+// discard any message previously retained for that topic"
+func testRetainedMessageReplacement(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Retained Message Replaced Not Duplicated",
+		SpecRef: "MQTT-3.3.1-5",
+	}
+
+	topic := cfg.Topic("test/retained/replace")
+
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-replace-pub"), nil)
+	if err != nil {
+		result.Error = fmt.Errorf("publisher connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
 	}
+	defer publisher.Disconnect(250)
+
+	publish := func(qos byte, payload string) error {
+		token := publisher.Publish(topic, qos, true, payload)
+		token.Wait()
+		return token.Error()
+	}
+
+	// retained subscribes with a new client and returns the payloads it is sent
+	retained := func(clientPrefix string) ([]string, error) {
+		var mu sync.Mutex
+		var payloads []string
+		subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID(clientPrefix), func(client mqtt.Client, msg mqtt.Message) {
+			mu.Lock()
+			payloads = append(payloads, string(msg.Payload()))
+			mu.Unlock()
+		})
+		if err != nil {
+			return nil, fmt.Errorf("subscriber connect failed: %w", err)
+		}
+		defer subscriber.Disconnect(250)
+
+		token := subscriber.Subscribe(topic, 1, nil)
+		token.Wait()
+		if token.Error() != nil {
+			return nil, fmt.Errorf("subscribe failed: %w", token.Error())
+		}
+		cfg.Wait(500 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		return payloads, nil
+	}
+
+	for _, payload := range []string{"first", "second", "third"} {
+		if err := publish(1, payload); err != nil {
+			result.Error = fmt.Errorf("publish %q failed: %w", payload, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+	cfg.Wait(200 * time.Millisecond)
+
+	got, err := retained("test-replace-sub1")
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if len(got) != 1 || got[0] != "third" {
+		result.Error = fmt.Errorf("new subscriber received %q, expected only the last retained message \"third\"", got)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// A QoS 0 retained message must replace "third", though the broker may
+	// discard it in turn
+	if err := publish(0, "fourth"); err != nil {
+		result.Error = fmt.Errorf("publish QoS 0 failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	cfg.Wait(200 * time.Millisecond)
+
+	got, err = retained("test-replace-sub2")
+	switch {
+	case err != nil:
+		result.Error = err
+	case len(got) == 0:
+		result.Status = common.StatusPassed
+		result.Notes = "broker discarded the QoS 0 retained message, which the spec allows"
+	case len(got) == 1 && got[0] == "fourth":
+		result.Status = common.StatusPassed
+	default:
+		result.SpecRef = "MQTT-3.3.1-7"
+		result.Error = fmt.Errorf("new subscriber received %q after a QoS 0 retained message, expected only \"fourth\" or nothing", got)
+	}
+
+	publisher.Publish(topic, 1, true, "").Wait()
 
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testPublishToMultipleSubscribers tests publish to multiple subscribers [MQTT-3.3.5-1]
-func testPublishToMultipleSubscribers(cfg common.Config) common.TestResult {
+func testPublishToMultipleSubscribers(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Publish to Multiple Subscribers",
 		SpecRef: "MQTT-3.3.5-1",
 	}
 
-	topic := "test/multi/subscribers"
+	topic := cfg.Topic("test/multi/subscribers")
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	receivedCount := 0
@@ -585,7 +668,7 @@ func testPublishToMultipleSubscribers(cfg common.Config) common.TestResult {
 	}
 
 	// Create multiple subscribers
-	sub1, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-multi-sub1"), messageHandler)
+	sub1, err := CreateAndConnectClient(cfg, cfg.ClientID("test-multi-sub1"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber1 connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -593,7 +676,7 @@ func testPublishToMultipleSubscribers(cfg common.Config) common.TestResult {
 	}
 	defer sub1.Disconnect(250)
 
-	sub2, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-multi-sub2"), messageHandler)
+	sub2, err := CreateAndConnectClient(cfg, cfg.ClientID("test-multi-sub2"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber2 connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -602,12 +685,18 @@ func testPublishToMultipleSubscribers(cfg common.Config) common.TestResult {
 	defer sub2.Disconnect(250)
 
 	wg.Add(2)
-	sub1.Subscribe(topic, 1, nil).Wait()
-	sub2.Subscribe(topic, 1, nil).Wait()
-
-	time.Sleep(100 * time.Millisecond)
+	if err := SubscribeSync(cfg, sub1, topic, 1, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if err := SubscribeSync(cfg, sub2, topic, 1, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-multi-pub3"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-multi-pub3"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -629,7 +718,7 @@ func testPublishToMultipleSubscribers(cfg common.Config) common.TestResult {
 		mu.Lock()
 		defer mu.Unlock()
 		if receivedCount == 2 {
-			result.Passed = true
+			result.Status = common.StatusPassed
 		} else {
 			result.Error = fmt.Errorf("expected 2 subscribers to receive message, got %d", receivedCount)
 		}
@@ -1,10 +1,13 @@
 package v3
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/bromq-dev/testmqtt/conformance/assert"
 	"github.com/bromq-dev/testmqtt/conformance/common"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
@@ -13,6 +16,7 @@ import (
 func QoSTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "QoS",
+		Tags: []string{"qos"},
 		Tests: []common.TestFunc{
 			testQoS0AtMostOnce,
 			testQoS1AtLeastOnce,
@@ -20,6 +24,8 @@ func QoSTests() common.TestGroup {
 			testQoSDowngrade,
 			testMessageOrderingQoS1,
 			testMessageOrderingQoS2,
+			testMessageOrderingMixedQoS,
+			testConcurrentPublishers,
 			testQoS1Acknowledgement,
 			testQoS2HandshakeFull,
 		},
@@ -27,7 +33,7 @@ func QoSTests() common.TestGroup {
 }
 
 // testQoS0AtMostOnce tests QoS 0 at-most-once delivery [MQTT-4.3.1-1]
-func testQoS0AtMostOnce(cfg common.Config) common.TestResult {
+func testQoS0AtMostOnce(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "QoS 0 At Most Once",
@@ -42,7 +48,7 @@ func testQoS0AtMostOnce(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos0"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos0"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -50,11 +56,14 @@ func testQoS0AtMostOnce(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "test/qos0/atmost"
-	subscriber.Subscribe(topic, 0, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	topic := cfg.Topic("test/qos0/atmost")
+	if err := SubscribeSync(cfg, subscriber, topic, 0, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos0-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos0-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -67,7 +76,7 @@ func testQoS0AtMostOnce(cfg common.Config) common.TestResult {
 		publisher.Publish(topic, 0, false, fmt.Sprintf("message%d", i)).Wait()
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -75,7 +84,7 @@ func testQoS0AtMostOnce(cfg common.Config) common.TestResult {
 	if receivedCount > 5 {
 		result.Error = fmt.Errorf("received more messages than sent (%d > 5)", receivedCount)
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -83,7 +92,7 @@ func testQoS0AtMostOnce(cfg common.Config) common.TestResult {
 }
 
 // testQoS1AtLeastOnce tests QoS 1 at-least-once delivery [MQTT-4.3.2-1]
-func testQoS1AtLeastOnce(cfg common.Config) common.TestResult {
+func testQoS1AtLeastOnce(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "QoS 1 At Least Once",
@@ -98,7 +107,7 @@ func testQoS1AtLeastOnce(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos1-atleast"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos1-atleast"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -106,11 +115,14 @@ func testQoS1AtLeastOnce(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "test/qos1/atleast"
-	subscriber.Subscribe(topic, 1, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	topic := cfg.Topic("test/qos1/atleast")
+	if err := SubscribeSync(cfg, subscriber, topic, 1, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos1-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos1-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -129,7 +141,7 @@ func testQoS1AtLeastOnce(cfg common.Config) common.TestResult {
 		}
 	}
 
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -137,7 +149,7 @@ func testQoS1AtLeastOnce(cfg common.Config) common.TestResult {
 	if receivedCount < messageCount {
 		result.Error = fmt.Errorf("received fewer messages than sent (%d < %d)", receivedCount, messageCount)
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -145,7 +157,7 @@ func testQoS1AtLeastOnce(cfg common.Config) common.TestResult {
 }
 
 // testQoS2ExactlyOnce tests QoS 2 exactly-once delivery [MQTT-4.3.3-1]
-func testQoS2ExactlyOnce(cfg common.Config) common.TestResult {
+func testQoS2ExactlyOnce(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "QoS 2 Exactly Once",
@@ -160,7 +172,7 @@ func testQoS2ExactlyOnce(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos2-exactly"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos2-exactly"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -168,11 +180,14 @@ func testQoS2ExactlyOnce(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "test/qos2/exactly"
-	subscriber.Subscribe(topic, 2, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	topic := cfg.Topic("test/qos2/exactly")
+	if err := SubscribeSync(cfg, subscriber, topic, 2, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos2-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos2-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -191,7 +206,7 @@ func testQoS2ExactlyOnce(cfg common.Config) common.TestResult {
 		}
 	}
 
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -211,33 +226,65 @@ func testQoS2ExactlyOnce(cfg common.Config) common.TestResult {
 		}
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testQoSDowngrade tests QoS downgrade [MQTT-3.8.4-6]
-func testQoSDowngrade(cfg common.Config) common.TestResult {
+// "The QoS of Payload Messages sent in response to a Subscription MUST be the
+// minimum of the QoS of the originally published message and the maximum QoS
+// granted by the Server"
+func testQoSDowngrade(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "QoS Downgrade",
 		SpecRef: "MQTT-3.8.4-6",
 	}
 
-	// Subscribe with QoS 0
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos-downgrade"), nil)
-	if err != nil {
-		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
-	defer subscriber.Disconnect(250)
+	topic := cfg.Topic("test/qos/downgrade")
+
+	// One subscriber at QoS 0 and one at QoS 1, each recording the QoS every
+	// payload is delivered with
+	var mu sync.Mutex
+	delivered := map[byte]map[string]byte{}
+	granted := map[byte]byte{}
+	for _, subQoS := range []byte{0, 1} {
+		delivered[subQoS] = map[string]byte{}
+		subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID(fmt.Sprintf("test-qos-downgrade-%d", subQoS)), func(client mqtt.Client, msg mqtt.Message) {
+			mu.Lock()
+			delivered[subQoS][string(msg.Payload())] = msg.Qos()
+			mu.Unlock()
+		})
+		if err != nil {
+			result.Error = fmt.Errorf("QoS %d subscriber connect failed: %w", subQoS, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+		defer subscriber.Disconnect(250)
 
-	topic := "test/qos/downgrade"
-	subscriber.Subscribe(topic, 0, nil).Wait() // Subscribe with QoS 0
-	time.Sleep(100 * time.Millisecond)
+		token := subscriber.Subscribe(topic, subQoS, nil)
+		token.Wait()
+		if token.Error() != nil {
+			result.Error = fmt.Errorf("QoS %d subscribe failed: %w", subQoS, token.Error())
+			result.Duration = time.Since(start)
+			return result
+		}
+		code := token.(*mqtt.SubscribeToken).Result()[topic]
+		if code > subQoS {
+			result.Error = fmt.Errorf("QoS %d subscription granted 0x%02x", subQoS, code)
+			result.Duration = time.Since(start)
+			return result
+		}
+		granted[subQoS] = code
+		if err := Barrier(cfg, subscriber); err != nil {
+			result.Error = err
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos-downgrade-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos-downgrade-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -245,23 +292,47 @@ func testQoSDowngrade(cfg common.Config) common.TestResult {
 	}
 	defer publisher.Disconnect(250)
 
-	// Publish with QoS 2, but subscriber requested QoS 0, so should be downgraded
-	token := publisher.Publish(topic, 2, false, "qos2 message")
-	token.Wait()
+	for pubQoS := byte(0); pubQoS <= 2; pubQoS++ {
+		token := publisher.Publish(topic, pubQoS, false, fmt.Sprintf("qos%d message", pubQoS))
+		token.Wait()
+		if token.Error() != nil {
+			result.Error = fmt.Errorf("QoS %d publish failed: %w", pubQoS, token.Error())
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
 
-	if token.Error() != nil {
-		result.Error = fmt.Errorf("publish failed: %w", token.Error())
-	} else {
-		// Test passes if publish succeeds (broker handles QoS downgrade)
-		result.Passed = true
+	cfg.Wait(500 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, subQoS := range []byte{0, 1} {
+		for pubQoS := byte(0); pubQoS <= 2; pubQoS++ {
+			payload := fmt.Sprintf("qos%d message", pubQoS)
+			got, ok := delivered[subQoS][payload]
+			want := min(pubQoS, granted[subQoS])
+			switch {
+			case !ok && want == 0:
+				// QoS 0 delivery may be lost
+			case !ok:
+				result.Error = fmt.Errorf("QoS %d message not delivered to the QoS %d subscriber", pubQoS, subQoS)
+			case got != want:
+				result.Error = fmt.Errorf("QoS %d message delivered at QoS %d to a subscriber granted QoS %d, expected QoS %d", pubQoS, got, granted[subQoS], want)
+			}
+			if result.Error != nil {
+				result.Duration = time.Since(start)
+				return result
+			}
+		}
 	}
 
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testMessageOrderingQoS1 tests message ordering for QoS 1 [MQTT-4.6.0-2]
-func testMessageOrderingQoS1(cfg common.Config) common.TestResult {
+func testMessageOrderingQoS1(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Message Ordering QoS 1",
@@ -276,7 +347,7 @@ func testMessageOrderingQoS1(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-order-qos1"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-order-qos1"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -284,11 +355,14 @@ func testMessageOrderingQoS1(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "test/order/qos1"
-	subscriber.Subscribe(topic, 1, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	topic := cfg.Topic("test/order/qos1")
+	if err := SubscribeSync(cfg, subscriber, topic, 1, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-order-qos1-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-order-qos1-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -302,7 +376,7 @@ func testMessageOrderingQoS1(cfg common.Config) common.TestResult {
 		token.Wait()
 	}
 
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -328,13 +402,13 @@ func testMessageOrderingQoS1(cfg common.Config) common.TestResult {
 		}
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testMessageOrderingQoS2 tests message ordering for QoS 2 [MQTT-4.6.0-3]
-func testMessageOrderingQoS2(cfg common.Config) common.TestResult {
+func testMessageOrderingQoS2(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Message Ordering QoS 2",
@@ -349,7 +423,7 @@ func testMessageOrderingQoS2(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-order-qos2"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-order-qos2"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -357,11 +431,14 @@ func testMessageOrderingQoS2(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "test/order/qos2"
-	subscriber.Subscribe(topic, 2, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	topic := cfg.Topic("test/order/qos2")
+	if err := SubscribeSync(cfg, subscriber, topic, 2, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-order-qos2-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-order-qos2-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -375,7 +452,7 @@ func testMessageOrderingQoS2(cfg common.Config) common.TestResult {
 		token.Wait()
 	}
 
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -396,20 +473,138 @@ func testMessageOrderingQoS2(cfg common.Config) common.TestResult {
 		}
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testMessageOrderingMixedQoS tests that interleaved QoS 0, 1 and 2 messages
+// on one topic keep their order within each QoS level [MQTT-4.6.0-6]
+// "it MUST send PUBLISH packets to consumers (for the same Topic and QoS) in
+// the order that they were received from any given Client"
+func testMessageOrderingMixedQoS(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Message Ordering Mixed QoS",
+		SpecRef: "MQTT-4.6.0-6",
+	}
+
+	type delivery struct {
+		qos byte
+		seq int
+	}
+
+	var mu sync.Mutex
+	var received []delivery
+	messageHandler := func(client mqtt.Client, msg mqtt.Message) {
+		var d delivery
+		if _, err := fmt.Sscanf(string(msg.Payload()), "qos%d-msg%d", &d.qos, &d.seq); err != nil {
+			return
+		}
+		mu.Lock()
+		received = append(received, d)
+		mu.Unlock()
+	}
+
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-order-mixed"), messageHandler)
+	if err != nil {
+		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer subscriber.Disconnect(250)
+
+	topic := cfg.Topic("test/order/mixed")
+	if err := SubscribeSync(cfg, subscriber, topic, 2, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-order-mixed-pub"), nil)
+	if err != nil {
+		result.Error = fmt.Errorf("publisher connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer publisher.Disconnect(250)
+
+	// Publish QoS 0, 1, 2, 0, 1, 2, ... without waiting in between
+	const total = 15
+	tokens := make([]mqtt.Token, 0, total)
+	for i := 1; i <= total; i++ {
+		qos := byte(i % 3)
+		tokens = append(tokens, publisher.Publish(topic, qos, false, fmt.Sprintf("qos%d-msg%d", qos, i)))
+	}
+	for _, token := range tokens {
+		token.Wait()
+	}
+
+	// QoS 0 messages may be lost, so the wait is for the last QoS 1 and
+	// QoS 2 ones, 13 and 14
+	if !assert.Eventually(&result, cfg, "last QoS 1 and QoS 2 messages", 5*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Contains(received, delivery{1, total - 2}) && slices.Contains(received, delivery{2, total - 1})
+	}) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Within each QoS level the sequence numbers must only go up. QoS 1 may
+	// repeat the last message, QoS 0 may lose messages.
+	last := map[byte]int{}
+	count := map[byte]int{}
+	interleaved := true
+	prev := 0
+	for _, d := range received {
+		switch {
+		case d.seq < last[d.qos]:
+			result.Error = fmt.Errorf("QoS %d message %d received after message %d: %v", d.qos, d.seq, last[d.qos], received)
+			result.Duration = time.Since(start)
+			return result
+		case d.seq == last[d.qos] && d.qos != 1:
+			result.Error = fmt.Errorf("QoS %d message %d received twice: %v", d.qos, d.seq, received)
+			result.Duration = time.Since(start)
+			return result
+		case d.seq > last[d.qos]:
+			count[d.qos]++
+		}
+		last[d.qos] = d.seq
+		if d.seq < prev {
+			interleaved = false
+		}
+		prev = d.seq
+	}
+
+	for _, qos := range []byte{1, 2} {
+		if count[qos] != total/3 {
+			result.Error = fmt.Errorf("received %d of %d QoS %d messages", count[qos], total/3, qos)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	result.Status = common.StatusPassed
+	if !interleaved {
+		result.Notes = "messages of different QoS were reordered relative to each other, which the spec allows"
+	}
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testQoS1Acknowledgement tests PUBACK for QoS 1 [MQTT-4.3.2-2]
-func testQoS1Acknowledgement(cfg common.Config) common.TestResult {
+func testQoS1Acknowledgement(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "QoS 1 PUBACK Acknowledgement",
 		SpecRef: "MQTT-4.3.2-2",
 	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos1-puback"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos1-puback"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -417,7 +612,7 @@ func testQoS1Acknowledgement(cfg common.Config) common.TestResult {
 	}
 	defer publisher.Disconnect(250)
 
-	topic := "test/qos1/puback"
+	topic := cfg.Topic("test/qos1/puback")
 	token := publisher.Publish(topic, 1, false, "qos1 message")
 	if !token.WaitTimeout(5 * time.Second) {
 		result.Error = fmt.Errorf("publish timeout (no PUBACK received)")
@@ -429,7 +624,7 @@ func testQoS1Acknowledgement(cfg common.Config) common.TestResult {
 		result.Error = fmt.Errorf("publish failed: %w", token.Error())
 	} else {
 		// If publish succeeded and didn't timeout, PUBACK was received
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -437,14 +632,14 @@ func testQoS1Acknowledgement(cfg common.Config) common.TestResult {
 }
 
 // testQoS2HandshakeFull tests complete QoS 2 handshake [MQTT-4.3.3-2]
-func testQoS2HandshakeFull(cfg common.Config) common.TestResult {
+func testQoS2HandshakeFull(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "QoS 2 Full Handshake",
 		SpecRef: "MQTT-4.3.3-2",
 	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos2-handshake"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos2-handshake"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -452,7 +647,7 @@ func testQoS2HandshakeFull(cfg common.Config) common.TestResult {
 	}
 	defer publisher.Disconnect(250)
 
-	topic := "test/qos2/handshake"
+	topic := cfg.Topic("test/qos2/handshake")
 	token := publisher.Publish(topic, 2, false, "qos2 message")
 	if !token.WaitTimeout(10 * time.Second) {
 		result.Error = fmt.Errorf("publish timeout (QoS 2 handshake not completed)")
@@ -464,9 +659,34 @@ func testQoS2HandshakeFull(cfg common.Config) common.TestResult {
 		result.Error = fmt.Errorf("publish failed: %w", token.Error())
 	} else {
 		// If publish succeeded, full QoS 2 handshake (PUBREC, PUBREL, PUBCOMP) completed
-		result.Passed = true
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testConcurrentPublishers tests that messages from several clients
+// publishing to one topic at once each reach a subscriber complete and in
+// the order their publisher sent them [MQTT-4.6.0-6]
+// "it MUST send PUBLISH packets to consumers (for the same Topic and QoS) in
+// the order that they were received from any given Client"
+func testConcurrentPublishers(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Concurrent Publishers Message Integrity",
+		SpecRef: "MQTT-4.6.0-6",
+	}
+
+	delivery, err := common.CheckConcurrentPublishers(cfg, 4)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
 	}
 
+	result.Status = common.StatusPassed
+	result.Notes = delivery.String()
 	result.Duration = time.Since(start)
 	return result
 }
@@ -0,0 +1,97 @@
+package v3
+
+import (
+	"context"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// RestartTests returns tests that restart the broker and check its durable
+// state survives, which needs a broker the suite controls, e.g. with
+// --docker-broker. Otherwise they are skipped. MQTT does not say whether
+// state outlives a Server restart, so the tests are held to SHOULD.
+func RestartTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Restart Persistence",
+		Tags: []string{"optional", "restart", "session", "retain"},
+		Tests: []common.TestFunc{
+			testRestartSession,
+			testRestartRetained,
+			testRestartQoS2Inflight,
+		},
+	}
+}
+
+// checkRestart fills in result with the outcome of a restart check
+func checkRestart(cfg common.Config, result *common.TestResult, check func(common.Config, byte) (string, error)) {
+	if common.SkipWithoutRestart(cfg, result) {
+		return
+	}
+	notes, err := check(cfg, 4)
+	if err != nil {
+		result.Error = err
+		return
+	}
+	result.Status = common.StatusPassed
+	result.Notes = notes
+}
+
+// testRestartSession tests that a persistent session, with its
+// subscription and a QoS 1 message queued for it, survives a broker restart
+// [MQTT-3.1.2-4]
+// "If CleanSession is set to 0, the Server MUST resume communications with
+// the Client based on state from the current Session"
+func testRestartSession(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Session Survives Restart",
+		SpecRef: "MQTT-3.1.2-4",
+		Level:   spec.LevelShould,
+	}
+
+	checkRestart(cfg, &result, common.CheckRestartSession)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRestartRetained tests that a retained message survives a broker
+// restart [MQTT-3.3.1-5]
+// "the Server MUST store the Application Message and its QoS, so that it can
+// be delivered to future subscribers whose subscriptions match its topic
+// name"
+func testRestartRetained(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Retained Message Survives Restart",
+		SpecRef: "MQTT-3.3.1-5",
+		Level:   spec.LevelShould,
+	}
+
+	checkRestart(cfg, &result, common.CheckRestartRetained)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRestartQoS2Inflight tests that a QoS 2 message received but not yet
+// released when the broker restarts is completed by the publisher's PUBREL
+// afterwards and delivered to a persistent subscriber exactly once
+// [MQTT-4.1.0-1]
+// "The Client and Server MUST store Session state for the entire duration of
+// the Session"
+func testRestartQoS2Inflight(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "QoS 2 In Flight Survives Restart",
+		SpecRef: "MQTT-4.1.0-1",
+		Level:   spec.LevelShould,
+	}
+
+	checkRestart(cfg, &result, common.CheckRestartQoS2)
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -1,9 +1,8 @@
 package v3
 
 import (
-	"fmt"
-
 	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/spec"
 )
 
 // AllTestGroups returns all available MQTT v3.1.1 test groups
@@ -13,16 +12,30 @@ func AllTestGroups() []common.TestGroup {
 		ConnectionTests(),
 		PublishSubscribeTests(),
 		TopicTests(),
+		SysTopicTests(),
 		QoSTests(),
+		UnknownAckTests(),
 
 		// Additional Features
 		WillTests(),
+		SubscribeTests(),
 		UnsubscribeTests(),
 		PingTests(),
+		DisconnectTests(),
 		SessionTests(),
+		MQTT31Tests(),
+		AuthenticationTests(),
+		AuthorizationTests(),
+		BridgeTests(),
+		ClusterTests(),
+		RestartTests(),
+		PartitionTests(),
+		SlowConsumerTests(),
+		LimitsTests(),
 
 		// Protocol Validation
 		PacketValidationTests(),
+		PacketFormatTests(),
 		UTF8ValidationTests(),
 		RemainingLengthTests(),
 
@@ -31,81 +44,22 @@ func AllTestGroups() []common.TestGroup {
 	}
 }
 
-// RunTests executes MQTT v3.1.1 conformance tests
-func RunTests(cfg common.Config, filter string, verbose bool) error {
-	fmt.Printf("\n%s\n", common.TitleStyle.Render("MQTT v3.1.1 Conformance Tests"))
-	fmt.Printf("%s\n", common.SubtitleStyle.Render(fmt.Sprintf("Broker: %s", cfg.Broker)))
-	if verbose {
-		fmt.Printf("%s\n", common.SubtitleStyle.Render("Verbose mode: ON"))
-	}
-	fmt.Println()
-
-	// Preflight connection check
-	fmt.Printf("%s", common.SubtitleStyle.Render("Checking broker connection... "))
-	if err := CheckConnection(cfg); err != nil {
-		fmt.Printf("%s\n", common.FailStyle.Render("FAILED"))
-		return fmt.Errorf("preflight check failed: %w", err)
-	}
-	fmt.Printf("%s\n", common.PassStyle.Render("OK"))
-
-	groups := AllTestGroups()
-
-	totalTests := 0
-	passedTests := 0
-	failedTests := 0
-	var failedResults []common.TestResult
-
-	for _, group := range groups {
-		if !common.ShouldRunGroup(group.Name, filter) {
-			continue
-		}
-
-		fmt.Printf("\n%s\n", common.GroupStyle.Render(group.Name))
-
-		for _, testFunc := range group.Tests {
-			result := testFunc(cfg)
-			totalTests++
-
-			status := common.PassStyle.Render("✓ PASS")
-			if !result.Passed {
-				status = common.FailStyle.Render("✗ FAIL")
-				failedTests++
-				failedResults = append(failedResults, result)
-			} else {
-				passedTests++
-			}
-
-			specRef := ""
-			if result.SpecRef != "" {
-				specRef = fmt.Sprintf(" [%s]", result.SpecRef)
-			}
-
-			fmt.Printf("  %s %s%s (%v)\n", status, result.Name, specRef, result.Duration)
-		}
-	}
-
-	// Detailed failure report first (if verbose and failures exist)
-	if verbose && failedTests > 0 {
-		fmt.Printf("\n%s\n", common.FailStyle.Render("═══ Detailed Failure Report ═══"))
-		for i, result := range failedResults {
-			fmt.Printf("\n%s\n", common.FailStyle.Render(fmt.Sprintf("Failure #%d: %s", i+1, result.Name)))
-			fmt.Printf("  Spec Reference: %s\n", result.SpecRef)
-			fmt.Printf("  Duration: %v\n", result.Duration)
-			fmt.Printf("  Error: %v\n", result.Error)
-		}
-	}
-
-	// Summary
-	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Summary"))
-	fmt.Printf("  Total:  %d\n", totalTests)
-	fmt.Printf("  Passed: %s\n", common.PassStyle.Render(fmt.Sprintf("%d", passedTests)))
-	if failedTests > 0 {
-		fmt.Printf("  Failed: %s\n", common.FailStyle.Render(fmt.Sprintf("%d", failedTests)))
-	}
-
-	if failedTests > 0 {
-		return fmt.Errorf("%d test(s) failed", failedTests)
+// Suite returns the MQTT v3.1.1 conformance suite: the built-in groups
+// followed by any registered with common.RegisterGroup
+func Suite() common.Suite {
+	return common.Suite{
+		Title:   "MQTT v3.1.1 Conformance Tests",
+		Spec:    spec.V311,
+		Groups:  append(AllTestGroups(), common.RegisteredGroups(spec.V311)...),
+		Cleanup: Cleanup,
+		Preflight: func(cfg *common.Config) error {
+			return CheckConnection(*cfg)
+		},
+		PubSubCheck: CheckPubSub,
 	}
+}
 
-	return nil
+// RunTests executes MQTT v3.1.1 conformance tests
+func RunTests(cfg common.Config, filter string, verbose bool) (*common.Report, error) {
+	return common.RunSuite(Suite(), cfg, filter, verbose)
 }
@@ -1,6 +1,7 @@
 package v3
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -13,6 +14,7 @@ import (
 func SessionTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "Session State",
+		Tags: []string{"session"},
 		Tests: []common.TestFunc{
 			testSessionStatePersistence,
 			testSubscriptionPersistence,
@@ -20,19 +22,20 @@ func SessionTests() common.TestGroup {
 			testQoS2MessagePersistence,
 			testCleanSessionClearsState,
 			testRetainedNotPartOfSession,
+			testQoS2ReleaseResumed,
 		},
 	}
 }
 
 // testSessionStatePersistence tests session state persists across connections [MQTT-3.1.2-4]
-func testSessionStatePersistence(cfg common.Config) common.TestResult {
+func testSessionStatePersistence(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Session State Persistence",
 		SpecRef: "MQTT-3.1.2-4",
 	}
 
-	clientID := common.GenerateClientID("test-session-persist")
+	clientID := cfg.ClientID("test-session-persist")
 
 	// First connection with Clean Session = false
 	client1, err := CreateAndConnectClientWithSession(cfg, clientID, false, nil)
@@ -43,13 +46,16 @@ func testSessionStatePersistence(cfg common.Config) common.TestResult {
 	}
 
 	// Subscribe to a topic
-	topic := "test/session/persist"
-	client1.Subscribe(topic, 1, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	topic := cfg.Topic("test/session/persist")
+	if err := SubscribeSync(cfg, client1, topic, 1, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
 	// Disconnect
 	client1.Disconnect(250)
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Reconnect with same client ID and Clean Session = false
 	var mu sync.Mutex
@@ -68,10 +74,10 @@ func testSessionStatePersistence(cfg common.Config) common.TestResult {
 	}
 	defer client2.Disconnect(250)
 
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	// Publish to the topic (subscription should still exist)
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-session-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-session-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -80,14 +86,14 @@ func testSessionStatePersistence(cfg common.Config) common.TestResult {
 	defer publisher.Disconnect(250)
 
 	publisher.Publish(topic, 1, false, "test message").Wait()
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedMessage {
 		result.Error = fmt.Errorf("message not received (session state not persisted)")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -95,15 +101,15 @@ func testSessionStatePersistence(cfg common.Config) common.TestResult {
 }
 
 // testSubscriptionPersistence tests subscriptions persist [MQTT-3.1.2-4]
-func testSubscriptionPersistence(cfg common.Config) common.TestResult {
+func testSubscriptionPersistence(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Subscription Persistence",
 		SpecRef: "MQTT-3.1.2-4",
 	}
 
-	clientID := common.GenerateClientID("test-sub-persist")
-	topic := "test/session/subscription"
+	clientID := cfg.ClientID("test-sub-persist")
+	topic := cfg.Topic("test/session/subscription")
 
 	// Connect and subscribe with Clean Session = false
 	client1, err := CreateAndConnectClientWithSession(cfg, clientID, false, nil)
@@ -115,10 +121,10 @@ func testSubscriptionPersistence(cfg common.Config) common.TestResult {
 
 	client1.Subscribe(topic, 1, nil).Wait()
 	client1.Disconnect(250)
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Publish while client is offline
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-sub-persist-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-persist-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -127,7 +133,7 @@ func testSubscriptionPersistence(cfg common.Config) common.TestResult {
 	defer publisher.Disconnect(250)
 
 	publisher.Publish(topic, 1, false, "offline message").Wait()
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Reconnect and should receive the queued message
 	var mu sync.Mutex
@@ -146,14 +152,14 @@ func testSubscriptionPersistence(cfg common.Config) common.TestResult {
 	}
 	defer client2.Disconnect(250)
 
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedMessage {
 		result.Error = fmt.Errorf("queued message not received after reconnect")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -161,15 +167,15 @@ func testSubscriptionPersistence(cfg common.Config) common.TestResult {
 }
 
 // testQoS1MessagePersistence tests QoS 1 messages persist [MQTT-3.1.2-5]
-func testQoS1MessagePersistence(cfg common.Config) common.TestResult {
+func testQoS1MessagePersistence(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "QoS 1 Message Persistence",
 		SpecRef: "MQTT-3.1.2-5",
 	}
 
-	clientID := common.GenerateClientID("test-qos1-persist")
-	topic := "test/session/qos1"
+	clientID := cfg.ClientID("test-qos1-persist")
+	topic := cfg.Topic("test/session/qos1")
 
 	// Connect and subscribe with Clean Session = false
 	client1, err := CreateAndConnectClientWithSession(cfg, clientID, false, nil)
@@ -181,10 +187,10 @@ func testQoS1MessagePersistence(cfg common.Config) common.TestResult {
 
 	client1.Subscribe(topic, 1, nil).Wait()
 	client1.Disconnect(250)
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Publish QoS 1 while offline
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos1-persist-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos1-persist-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -193,7 +199,7 @@ func testQoS1MessagePersistence(cfg common.Config) common.TestResult {
 	defer publisher.Disconnect(250)
 
 	publisher.Publish(topic, 1, false, "qos1 offline").Wait()
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Reconnect
 	var mu sync.Mutex
@@ -212,14 +218,14 @@ func testQoS1MessagePersistence(cfg common.Config) common.TestResult {
 	}
 	defer client2.Disconnect(250)
 
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedMessage {
 		result.Error = fmt.Errorf("QoS 1 message not delivered after reconnect")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -227,15 +233,15 @@ func testQoS1MessagePersistence(cfg common.Config) common.TestResult {
 }
 
 // testQoS2MessagePersistence tests QoS 2 messages persist [MQTT-3.1.2-5]
-func testQoS2MessagePersistence(cfg common.Config) common.TestResult {
+func testQoS2MessagePersistence(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "QoS 2 Message Persistence",
 		SpecRef: "MQTT-3.1.2-5",
 	}
 
-	clientID := common.GenerateClientID("test-qos2-persist")
-	topic := "test/session/qos2"
+	clientID := cfg.ClientID("test-qos2-persist")
+	topic := cfg.Topic("test/session/qos2")
 
 	// Connect and subscribe with Clean Session = false
 	client1, err := CreateAndConnectClientWithSession(cfg, clientID, false, nil)
@@ -247,10 +253,10 @@ func testQoS2MessagePersistence(cfg common.Config) common.TestResult {
 
 	client1.Subscribe(topic, 2, nil).Wait()
 	client1.Disconnect(250)
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Publish QoS 2 while offline
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-qos2-persist-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos2-persist-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -259,7 +265,7 @@ func testQoS2MessagePersistence(cfg common.Config) common.TestResult {
 	defer publisher.Disconnect(250)
 
 	publisher.Publish(topic, 2, false, "qos2 offline").Wait()
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Reconnect
 	var mu sync.Mutex
@@ -278,14 +284,14 @@ func testQoS2MessagePersistence(cfg common.Config) common.TestResult {
 	}
 	defer client2.Disconnect(250)
 
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedMessage {
 		result.Error = fmt.Errorf("QoS 2 message not delivered after reconnect")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -293,15 +299,15 @@ func testQoS2MessagePersistence(cfg common.Config) common.TestResult {
 }
 
 // testCleanSessionClearsState tests Clean Session = true clears state [MQTT-3.1.2-6]
-func testCleanSessionClearsState(cfg common.Config) common.TestResult {
+func testCleanSessionClearsState(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Clean Session Clears State",
 		SpecRef: "MQTT-3.1.2-6",
 	}
 
-	clientID := common.GenerateClientID("test-clean-clears")
-	topic := "test/session/clean"
+	clientID := cfg.ClientID("test-clean-clears")
+	topic := cfg.Topic("test/session/clean")
 
 	// Connect with Clean Session = false and subscribe
 	client1, err := CreateAndConnectClientWithSession(cfg, clientID, false, nil)
@@ -313,7 +319,7 @@ func testCleanSessionClearsState(cfg common.Config) common.TestResult {
 
 	client1.Subscribe(topic, 1, nil).Wait()
 	client1.Disconnect(250)
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Reconnect with Clean Session = true (should clear state)
 	client2, err := CreateAndConnectClientWithSession(cfg, clientID, true, nil)
@@ -323,10 +329,10 @@ func testCleanSessionClearsState(cfg common.Config) common.TestResult {
 		return result
 	}
 	client2.Disconnect(250)
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Publish message
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-clean-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-clean-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -335,7 +341,7 @@ func testCleanSessionClearsState(cfg common.Config) common.TestResult {
 	defer publisher.Disconnect(250)
 
 	publisher.Publish(topic, 1, false, "should not receive").Wait()
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Reconnect again - should NOT receive message (subscription was cleared)
 	var mu sync.Mutex
@@ -354,14 +360,14 @@ func testCleanSessionClearsState(cfg common.Config) common.TestResult {
 	}
 	defer client3.Disconnect(250)
 
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if receivedMessage {
 		result.Error = fmt.Errorf("received message after Clean Session cleared state")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -369,17 +375,17 @@ func testCleanSessionClearsState(cfg common.Config) common.TestResult {
 }
 
 // testRetainedNotPartOfSession tests retained messages are not part of session state [MQTT-3.1.2.7]
-func testRetainedNotPartOfSession(cfg common.Config) common.TestResult {
+func testRetainedNotPartOfSession(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Retained Messages Not Part of Session",
 		SpecRef: "MQTT-3.1.2.7",
 	}
 
-	topic := "test/session/retained"
+	topic := cfg.Topic("test/session/retained")
 
 	// Publish retained message
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-retained-session-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-retained-session-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -388,10 +394,10 @@ func testRetainedNotPartOfSession(cfg common.Config) common.TestResult {
 
 	publisher.Publish(topic, 1, true, "retained message").Wait()
 	publisher.Disconnect(250)
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Connect with Clean Session = true
-	clientID := common.GenerateClientID("test-retained-session")
+	clientID := cfg.ClientID("test-retained-session")
 	var mu sync.Mutex
 	var receivedRetained bool
 	messageHandler := func(client mqtt.Client, msg mqtt.Message) {
@@ -410,16 +416,43 @@ func testRetainedNotPartOfSession(cfg common.Config) common.TestResult {
 
 	// Subscribe - should receive retained message even with Clean Session
 	client.Subscribe(topic, 1, nil).Wait()
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedRetained {
 		result.Error = fmt.Errorf("retained message not received (retained should persist independent of session)")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testQoS2ReleaseResumed tests that a QoS 2 flow left half complete by a
+// dropped connection, the PUBLISH received but not released, is completed by
+// the PUBREL the client resends with the original Packet Identifier on
+// resuming its session [MQTT-4.4.0-1]
+// "When a Client reconnects with CleanSession set to 0, both the Client and
+// Server MUST re-send any unacknowledged PUBLISH Packets (where QoS > 0) and
+// PUBREL Packets using their original Packet Identifiers"
+func testQoS2ReleaseResumed(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "QoS 2 PUBREL Resumed After Reconnect",
+		SpecRef: "MQTT-4.4.0-1",
+	}
+
+	notes, err := common.CheckQoS2Resumed(cfg, 4)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
 	}
 
+	result.Status = common.StatusPassed
+	result.Notes = notes
 	result.Duration = time.Since(start)
 	return result
 }
@@ -0,0 +1,48 @@
+package v3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// SlowConsumerTests returns tests of how the broker copes with a subscriber
+// that stops reading while its topic is flooded
+func SlowConsumerTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Slow Consumer",
+		Tags: []string{"flow-control", "timing"},
+		Tests: []common.TestFunc{
+			testSlowConsumer,
+		},
+	}
+}
+
+// testSlowConsumer tests that a subscriber which stops reading its socket
+// during a QoS 0 flood does not hold up other clients. Whether the broker
+// holds the publisher back, drops messages or disconnects the slow consumer
+// is its own policy and reported in the notes. A subscriber that kept
+// reading but missed messages is a warning.
+func testSlowConsumer(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Slow Consumer Isolation",
+	}
+
+	policy, err := common.CheckSlowConsumer(cfg, 4)
+	switch {
+	case err != nil:
+		result.Error = err
+	case policy.Fast < policy.Sent:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("subscriber reading normally missed %d messages: %v", policy.Sent-policy.Fast, policy)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = policy.String()
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,80 @@
+package v3
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// SubscribeTests returns tests for MQTT v3.1.1 SUBSCRIBE and SUBACK
+func SubscribeTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Subscribe",
+		Tags: []string{"core"},
+		Tests: []common.TestFunc{
+			testSUBACKReturnCodeOrder,
+		},
+	}
+}
+
+// testSUBACKReturnCodeOrder tests that a SUBACK carries one return code per
+// filter, in the order of the SUBSCRIBE [MQTT-3.9.3-1]
+// "The order of return codes in the SUBACK Packet MUST match the order of
+// Topic Filters in the SUBSCRIBE Packet"
+func testSUBACKReturnCodeOrder(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "SUBACK Return Code per Filter in Order",
+		SpecRef: "MQTT-3.9.3-1",
+	}
+
+	conn, err := common.DialRaw(cfg, 4, cfg.ClientID("test-suback-order"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	// Requested QoS out of order, so codes that are sorted or repeated
+	// show up as mismatches
+	subs := []common.RawSubscription{
+		{Filter: cfg.Topic("test/suback/order/a"), Options: 2},
+		{Filter: cfg.Topic("test/suback/order/b"), Options: 0},
+		{Filter: cfg.Topic("test/suback/order/c"), Options: 1},
+	}
+	codes, err := conn.SubscribeAll(1, cfg.Scaled(5*time.Second), subs...)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if len(codes) != len(subs) {
+		result.Error = fmt.Errorf("SUBACK has %d return codes for %d filters: % x", len(codes), len(subs), codes)
+		result.Duration = time.Since(start)
+		return result
+	}
+	for i, code := range codes {
+		if code >= 0x80 {
+			result.Error = fmt.Errorf("filter %d refused with return code 0x%02x", i+1, code)
+			result.Duration = time.Since(start)
+			return result
+		}
+		// The broker may grant less than requested, never more
+		if code > subs[i].Options {
+			result.Error = fmt.Errorf("filter %d requested QoS %d but was granted QoS %d (return codes % x)", i+1, subs[i].Options, code, codes)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	result.Status = common.StatusPassed
+	if !slices.Equal(codes, []byte{2, 0, 1}) {
+		result.Notes = fmt.Sprintf("broker granted QoS % x", codes)
+	}
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,133 @@
+package v3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// SysTopicTests returns tests of the $SYS topics brokers publish by
+// convention. They are skipped when the broker publishes none.
+func SysTopicTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "$SYS Topics",
+		Tags: []string{"topics", "sys"},
+		Tests: []common.TestFunc{
+			testSysTopicsPublished,
+			testSysNotMatchedByWildcards,
+			testSysValuesFollowLoad,
+		},
+	}
+}
+
+// testSysTopicsPublished tests that clients/connected, uptime and
+// messages/received are published with numeric values to a subscription
+// that names them [MQTT-4.7.2]
+// "Server implementations MAY use Topic Names that start with a leading $
+// character for other purposes."
+func testSysTopicsPublished(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "$SYS Topics Published",
+		SpecRef: "MQTT-4.7.2",
+		Level:   spec.LevelMay, // $SYS topics are a convention
+	}
+
+	m := common.SkipWithoutSys(cfg, 4, &result)
+	if m == nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer m.Close()
+
+	seen, missing := m.Seen()
+	var values, malformed []string
+	for _, t := range seen {
+		values = append(values, fmt.Sprintf("%s=%q", t, m.Value(t)))
+		if _, ok := m.Number(t); !ok {
+			malformed = append(malformed, fmt.Sprintf("%s=%q", t, m.Value(t)))
+		}
+	}
+	switch {
+	case len(malformed) > 0:
+		result.Error = fmt.Errorf("values are not numbers: %s", strings.Join(malformed, ", "))
+	case len(missing) > 0:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("not published: %s; %s", strings.Join(missing, ", "), strings.Join(values, ", "))
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = strings.Join(values, ", ")
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSysNotMatchedByWildcards tests that #, +/broker/# and +/broker/uptime
+// receive neither retained nor newly published $SYS messages [MQTT-4.7.2-1]
+// "The Server MUST NOT match Topic Filters starting with a wildcard character
+// (# or +) with Topic Names beginning with a $ character"
+func testSysNotMatchedByWildcards(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "$SYS Not Matched by Wildcards",
+		SpecRef: "MQTT-4.7.2-1",
+	}
+
+	m := common.SkipWithoutSys(cfg, 4, &result)
+	if m == nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer m.Close()
+
+	leaked, err := common.SysWildcardLeaks(cfg, 4, m)
+	switch {
+	case err != nil:
+		result.Error = err
+	case len(leaked) > 0:
+		result.Error = fmt.Errorf("wildcard subscriptions received %s", strings.Join(leaked, ", "))
+	default:
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSysValuesFollowLoad tests that clients/connected, messages/received
+// and uptime go up during a short burst of connections and messages
+// [MQTT-4.7.2]
+func testSysValuesFollowLoad(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "$SYS Values Follow Load",
+		SpecRef: "MQTT-4.7.2",
+		Level:   spec.LevelMay, // $SYS topics are a convention
+	}
+
+	m := common.SkipWithoutSys(cfg, 4, &result)
+	if m == nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer m.Close()
+
+	problems, notes, err := common.CheckSysLoad(cfg, 4, m)
+	switch {
+	case err != nil:
+		result.Error = err
+	case len(problems) > 0:
+		result.Error = fmt.Errorf("%s", strings.Join(problems, "; "))
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = notes
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,104 @@
+package v3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// subackFailure is the SUBACK return code for a rejected subscription
+const subackFailure = 0x80
+
+// expectFilterRejected subscribes to filter over a raw connection, which
+// the client library would refuse to send, and fills in result. The broker
+// must answer with return code 0x80 or close the connection.
+func expectFilterRejected(cfg common.Config, clientPrefix, filter string, result *common.TestResult) {
+	conn, err := common.DialRaw(cfg, 4, cfg.ClientID(clientPrefix))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		return
+	}
+	defer conn.Close()
+
+	codes, err := conn.Subscribe(1, 0, cfg.Scaled(2*time.Second), cfg.Topic(filter))
+	switch {
+	case errors.Is(err, common.ErrBrokerClosed):
+		result.Status = common.StatusPassed
+		result.Notes = "broker closed the connection"
+	case err != nil:
+		result.Error = err
+	case len(codes) != 1:
+		result.Error = fmt.Errorf("expected 1 SUBACK return code, got % x", codes)
+	case codes[0] == subackFailure:
+		result.Status = common.StatusPassed
+	default:
+		result.Error = fmt.Errorf("broker accepted invalid filter %q with return code 0x%02x", filter, codes[0])
+	}
+}
+
+// testFilterHashNotLast tests that "#" must be the last character of a
+// filter [MQTT-4.7.1-2]
+// "The multi-level wildcard character MUST be specified either on its own or
+// following a topic level separator. In either case it MUST be the last
+// character specified in the Topic Filter"
+func testFilterHashNotLast(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject Filter with # Not Last (#/tail)",
+		SpecRef: "MQTT-4.7.1-2",
+	}
+
+	expectFilterRejected(cfg, "test-filter-hash-tail", "#/tail", &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testFilterHashAfterLevel tests that "#" must follow a topic level
+// separator [MQTT-4.7.1-2]
+func testFilterHashAfterLevel(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject Filter with # Inside a Level (sport/tennis#)",
+		SpecRef: "MQTT-4.7.1-2",
+	}
+
+	expectFilterRejected(cfg, "test-filter-hash-level", "sport/tennis#", &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testFilterHashAfterName tests that "#" directly after a level name is
+// rejected [MQTT-4.7.1-2]
+func testFilterHashAfterName(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject Filter with # After a Name (sport#)",
+		SpecRef: "MQTT-4.7.1-2",
+	}
+
+	expectFilterRejected(cfg, "test-filter-hash-name", "sport#", &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testFilterPlusInsideLevel tests that "+" must occupy an entire level
+// [MQTT-4.7.1-3]
+// "Where it is used it MUST occupy an entire level of the filter"
+func testFilterPlusInsideLevel(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Reject Filter with + Inside a Level (sport/+ball)",
+		SpecRef: "MQTT-4.7.1-3",
+	}
+
+	expectFilterRejected(cfg, "test-filter-plus-level", "sport/+ball", &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -1,7 +1,10 @@
 package v3
 
 import (
+	"context"
 	"fmt"
+	"math/rand/v2"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,6 +16,7 @@ import (
 func TopicTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "Topics",
+		Tags: []string{"topics"},
 		Tests: []common.TestFunc{
 			testTopicWildcardMultiLevel,
 			testTopicWildcardSingleLevel,
@@ -22,12 +26,18 @@ func TopicTests() common.TestGroup {
 			testTopicCaseSensitivity,
 			testTopicWithSpaces,
 			testTopicLeadingTrailingSlash,
+			testFilterHashNotLast,
+			testFilterHashAfterLevel,
+			testFilterHashAfterName,
+			testFilterPlusInsideLevel,
+			testTopicMatchingModel,
+			testWildcardSubscriptionScale,
 		},
 	}
 }
 
 // testTopicWildcardMultiLevel tests multi-level wildcard # [MQTT-4.7.1-2]
-func testTopicWildcardMultiLevel(cfg common.Config) common.TestResult {
+func testTopicWildcardMultiLevel(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Topic Multi-Level Wildcard #",
@@ -42,7 +52,7 @@ func testTopicWildcardMultiLevel(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-multi-wildcard"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-multi-wildcard"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -51,17 +61,13 @@ func testTopicWildcardMultiLevel(cfg common.Config) common.TestResult {
 	defer subscriber.Disconnect(250)
 
 	// Subscribe to sport/tennis/# should match all below
-	token := subscriber.Subscribe("sport/tennis/#", 0, nil)
-	token.Wait()
-	if token.Error() != nil {
-		result.Error = fmt.Errorf("subscribe failed: %w", token.Error())
+	if err := SubscribeSync(cfg, subscriber, cfg.Topic("sport/tennis/#"), 0, nil); err != nil {
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-multi-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-multi-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -70,18 +76,18 @@ func testTopicWildcardMultiLevel(cfg common.Config) common.TestResult {
 	defer publisher.Disconnect(250)
 
 	// Publish to various topics that should match
-	publisher.Publish("sport/tennis/player1", 0, false, "msg1").Wait()
-	publisher.Publish("sport/tennis/player1/ranking", 0, false, "msg2").Wait()
-	publisher.Publish("sport/tennis/player1/score/wimbledon", 0, false, "msg3").Wait()
+	publisher.Publish(cfg.Topic("sport/tennis/player1"), 0, false, "msg1").Wait()
+	publisher.Publish(cfg.Topic("sport/tennis/player1/ranking"), 0, false, "msg2").Wait()
+	publisher.Publish(cfg.Topic("sport/tennis/player1/score/wimbledon"), 0, false, "msg3").Wait()
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if len(receivedTopics) != 3 {
 		result.Error = fmt.Errorf("expected 3 messages, received %d", len(receivedTopics))
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -89,7 +95,7 @@ func testTopicWildcardMultiLevel(cfg common.Config) common.TestResult {
 }
 
 // testTopicWildcardSingleLevel tests single-level wildcard + [MQTT-4.7.1-3]
-func testTopicWildcardSingleLevel(cfg common.Config) common.TestResult {
+func testTopicWildcardSingleLevel(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Topic Single-Level Wildcard +",
@@ -104,7 +110,7 @@ func testTopicWildcardSingleLevel(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-single-wildcard"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-single-wildcard"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -113,17 +119,13 @@ func testTopicWildcardSingleLevel(cfg common.Config) common.TestResult {
 	defer subscriber.Disconnect(250)
 
 	// Subscribe to sport/tennis/+ should match only one level
-	token := subscriber.Subscribe("sport/tennis/+", 0, nil)
-	token.Wait()
-	if token.Error() != nil {
-		result.Error = fmt.Errorf("subscribe failed: %w", token.Error())
+	if err := SubscribeSync(cfg, subscriber, cfg.Topic("sport/tennis/+"), 0, nil); err != nil {
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-single-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-single-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -132,22 +134,22 @@ func testTopicWildcardSingleLevel(cfg common.Config) common.TestResult {
 	defer publisher.Disconnect(250)
 
 	// Should match
-	publisher.Publish("sport/tennis/player1", 0, false, "msg1").Wait()
-	publisher.Publish("sport/tennis/player2", 0, false, "msg2").Wait()
+	publisher.Publish(cfg.Topic("sport/tennis/player1"), 0, false, "msg1").Wait()
+	publisher.Publish(cfg.Topic("sport/tennis/player2"), 0, false, "msg2").Wait()
 
 	// Should NOT match (too many levels)
-	publisher.Publish("sport/tennis/player1/ranking", 0, false, "msg3").Wait()
+	publisher.Publish(cfg.Topic("sport/tennis/player1/ranking"), 0, false, "msg3").Wait()
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if len(receivedTopics) != 2 {
 		result.Error = fmt.Errorf("expected 2 messages, received %d", len(receivedTopics))
-	} else if receivedTopics["sport/tennis/player1/ranking"] {
+	} else if receivedTopics[cfg.Topic("sport/tennis/player1/ranking")] {
 		result.Error = fmt.Errorf("received message that should not have matched")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -155,7 +157,7 @@ func testTopicWildcardSingleLevel(cfg common.Config) common.TestResult {
 }
 
 // testTopicWildcardCombination tests combination of + and # wildcards
-func testTopicWildcardCombination(cfg common.Config) common.TestResult {
+func testTopicWildcardCombination(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Topic Wildcard Combination +/#",
@@ -170,7 +172,7 @@ func testTopicWildcardCombination(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-combo-wildcard"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-combo-wildcard"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -179,17 +181,13 @@ func testTopicWildcardCombination(cfg common.Config) common.TestResult {
 	defer subscriber.Disconnect(250)
 
 	// Subscribe to +/tennis/# should match any first level, then tennis, then anything
-	token := subscriber.Subscribe("+/tennis/#", 0, nil)
-	token.Wait()
-	if token.Error() != nil {
-		result.Error = fmt.Errorf("subscribe failed: %w", token.Error())
+	if err := SubscribeSync(cfg, subscriber, cfg.Topic("+/tennis/#"), 0, nil); err != nil {
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-combo-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-combo-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -197,17 +195,17 @@ func testTopicWildcardCombination(cfg common.Config) common.TestResult {
 	}
 	defer publisher.Disconnect(250)
 
-	publisher.Publish("sport/tennis/player1", 0, false, "msg1").Wait()
-	publisher.Publish("event/tennis/tournament", 0, false, "msg2").Wait()
+	publisher.Publish(cfg.Topic("sport/tennis/player1"), 0, false, "msg1").Wait()
+	publisher.Publish(cfg.Topic("event/tennis/tournament"), 0, false, "msg2").Wait()
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if len(receivedTopics) != 2 {
 		result.Error = fmt.Errorf("expected 2 messages, received %d", len(receivedTopics))
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -215,7 +213,7 @@ func testTopicWildcardCombination(cfg common.Config) common.TestResult {
 }
 
 // testTopicLevelSeparator tests topic level separator / handling [MQTT-4.7.3-1]
-func testTopicLevelSeparator(cfg common.Config) common.TestResult {
+func testTopicLevelSeparator(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Topic Level Separator",
@@ -230,7 +228,7 @@ func testTopicLevelSeparator(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-separator"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-separator"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -239,12 +237,14 @@ func testTopicLevelSeparator(cfg common.Config) common.TestResult {
 	defer subscriber.Disconnect(250)
 
 	// Subscribe to multiple distinct topics
-	subscriber.Subscribe("finance", 0, nil).Wait()
-	subscriber.Subscribe("/finance", 0, nil).Wait()
-
-	time.Sleep(100 * time.Millisecond)
+	subscriber.Subscribe(cfg.Topic("finance"), 0, nil).Wait()
+	if err := SubscribeSync(cfg, subscriber, cfg.Topic("/finance"), 0, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-sep-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sep-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -253,17 +253,17 @@ func testTopicLevelSeparator(cfg common.Config) common.TestResult {
 	defer publisher.Disconnect(250)
 
 	// These are different topics
-	publisher.Publish("finance", 0, false, "msg1").Wait()
-	publisher.Publish("/finance", 0, false, "msg2").Wait()
+	publisher.Publish(cfg.Topic("finance"), 0, false, "msg1").Wait()
+	publisher.Publish(cfg.Topic("/finance"), 0, false, "msg2").Wait()
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if len(receivedTopics) != 2 {
 		result.Error = fmt.Errorf("expected 2 distinct messages, received %d", len(receivedTopics))
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -271,7 +271,7 @@ func testTopicLevelSeparator(cfg common.Config) common.TestResult {
 }
 
 // testTopicSystemPrefix tests $SYS topics not matched by wildcards [MQTT-4.7.2-1]
-func testTopicSystemPrefix(cfg common.Config) common.TestResult {
+func testTopicSystemPrefix(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Topic $SYS Prefix",
@@ -288,7 +288,7 @@ func testTopicSystemPrefix(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-sys"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sys"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -297,11 +297,13 @@ func testTopicSystemPrefix(cfg common.Config) common.TestResult {
 	defer subscriber.Disconnect(250)
 
 	// Subscribe to # should NOT receive $SYS topics
-	subscriber.Subscribe("#", 0, nil).Wait()
-
-	time.Sleep(100 * time.Millisecond)
+	if err := SubscribeSync(cfg, subscriber, "#", 0, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-sys-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sys-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -311,7 +313,7 @@ func testTopicSystemPrefix(cfg common.Config) common.TestResult {
 
 	// Attempt to publish to $SYS topic (broker may reject this)
 	publisher.Publish("$SYS/test/topic", 0, false, "sys message").Wait()
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -319,7 +321,7 @@ func testTopicSystemPrefix(cfg common.Config) common.TestResult {
 	if receivedMessage {
 		result.Error = fmt.Errorf("received $SYS topic through # wildcard")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -327,7 +329,7 @@ func testTopicSystemPrefix(cfg common.Config) common.TestResult {
 }
 
 // testTopicCaseSensitivity tests that topics are case sensitive [MQTT-4.7.3-1]
-func testTopicCaseSensitivity(cfg common.Config) common.TestResult {
+func testTopicCaseSensitivity(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Topic Case Sensitivity",
@@ -342,7 +344,7 @@ func testTopicCaseSensitivity(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-case"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-case"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -351,11 +353,13 @@ func testTopicCaseSensitivity(cfg common.Config) common.TestResult {
 	defer subscriber.Disconnect(250)
 
 	// Subscribe to lowercase only
-	subscriber.Subscribe("accounts", 0, nil).Wait()
-
-	time.Sleep(100 * time.Millisecond)
+	if err := SubscribeSync(cfg, subscriber, cfg.Topic("accounts"), 0, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-case-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-case-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -363,20 +367,20 @@ func testTopicCaseSensitivity(cfg common.Config) common.TestResult {
 	}
 	defer publisher.Disconnect(250)
 
-	publisher.Publish("accounts", 0, false, "msg1").Wait()
-	publisher.Publish("Accounts", 0, false, "msg2").Wait() // Should NOT match
-	publisher.Publish("ACCOUNTS", 0, false, "msg3").Wait() // Should NOT match
+	publisher.Publish(cfg.Topic("accounts"), 0, false, "msg1").Wait()
+	publisher.Publish(cfg.Topic("Accounts"), 0, false, "msg2").Wait() // Should NOT match
+	publisher.Publish(cfg.Topic("ACCOUNTS"), 0, false, "msg3").Wait() // Should NOT match
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if len(receivedTopics) != 1 {
 		result.Error = fmt.Errorf("expected 1 message, received %d (topics are case sensitive)", len(receivedTopics))
-	} else if !receivedTopics["accounts"] {
+	} else if !receivedTopics[cfg.Topic("accounts")] {
 		result.Error = fmt.Errorf("did not receive message on expected topic")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -384,7 +388,7 @@ func testTopicCaseSensitivity(cfg common.Config) common.TestResult {
 }
 
 // testTopicWithSpaces tests that topics can include spaces [MQTT-4.7.3-1]
-func testTopicWithSpaces(cfg common.Config) common.TestResult {
+func testTopicWithSpaces(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Topic With Spaces",
@@ -399,7 +403,7 @@ func testTopicWithSpaces(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-spaces"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-spaces"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -407,12 +411,14 @@ func testTopicWithSpaces(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "accounts payable"
-	subscriber.Subscribe(topic, 0, nil).Wait()
-
-	time.Sleep(100 * time.Millisecond)
+	topic := cfg.Topic("accounts payable")
+	if err := SubscribeSync(cfg, subscriber, topic, 0, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-spaces-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-spaces-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -422,14 +428,14 @@ func testTopicWithSpaces(cfg common.Config) common.TestResult {
 
 	publisher.Publish(topic, 0, false, "message").Wait()
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedMessage {
 		result.Error = fmt.Errorf("message not received on topic with spaces")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -437,7 +443,7 @@ func testTopicWithSpaces(cfg common.Config) common.TestResult {
 }
 
 // testTopicLeadingTrailingSlash tests leading/trailing slash creates distinct topics [MQTT-4.7.3-1]
-func testTopicLeadingTrailingSlash(cfg common.Config) common.TestResult {
+func testTopicLeadingTrailingSlash(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Topic Leading/Trailing Slash",
@@ -452,7 +458,7 @@ func testTopicLeadingTrailingSlash(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-slash"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-slash"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -461,14 +467,16 @@ func testTopicLeadingTrailingSlash(cfg common.Config) common.TestResult {
 	defer subscriber.Disconnect(250)
 
 	// These are all different topics
-	subscriber.Subscribe("topic", 0, nil).Wait()
-	subscriber.Subscribe("/topic", 0, nil).Wait()
-	subscriber.Subscribe("topic/", 0, nil).Wait()
-	subscriber.Subscribe("/topic/", 0, nil).Wait()
-
-	time.Sleep(100 * time.Millisecond)
+	subscriber.Subscribe(cfg.Topic("topic"), 0, nil).Wait()
+	subscriber.Subscribe(cfg.Topic("/topic"), 0, nil).Wait()
+	subscriber.Subscribe(cfg.Topic("topic/"), 0, nil).Wait()
+	if err := SubscribeSync(cfg, subscriber, cfg.Topic("/topic/"), 0, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-slash-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-slash-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -476,19 +484,81 @@ func testTopicLeadingTrailingSlash(cfg common.Config) common.TestResult {
 	}
 	defer publisher.Disconnect(250)
 
-	publisher.Publish("topic", 0, false, "msg1").Wait()
-	publisher.Publish("/topic", 0, false, "msg2").Wait()
-	publisher.Publish("topic/", 0, false, "msg3").Wait()
-	publisher.Publish("/topic/", 0, false, "msg4").Wait()
+	publisher.Publish(cfg.Topic("topic"), 0, false, "msg1").Wait()
+	publisher.Publish(cfg.Topic("/topic"), 0, false, "msg2").Wait()
+	publisher.Publish(cfg.Topic("topic/"), 0, false, "msg3").Wait()
+	publisher.Publish(cfg.Topic("/topic/"), 0, false, "msg4").Wait()
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if len(receivedTopics) != 4 {
 		result.Error = fmt.Errorf("expected 4 distinct topics, received %d", len(receivedTopics))
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testTopicMatchingModel subscribes to randomly generated topic filters,
+// publishes to randomly generated topics and compares each delivery with a
+// reference matcher. The filters and topics are drawn from the run's seed,
+// so --seed repeats them and --shuffle varies them [MQTT-4.7.3-4]
+// "Each non-wildcarded level in the Topic Filter has to match the
+// corresponding level in the Topic Name character for character for the
+// match to succeed."
+func testTopicMatchingModel(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Topic Matching Model",
+		SpecRef: "MQTT-4.7.3-4",
+	}
+
+	rng := rand.New(rand.NewPCG(cfg.Seed, 1))
+	model := common.NewTopicModel(rng, cfg.Topic(common.GenerateTopicName("test/model")), 12, 24)
+	divergences, expected, err := common.CheckTopicModel(cfg, 4, model)
+	switch {
+	case err != nil:
+		result.Error = err
+	case len(divergences) > 0:
+		result.Error = fmt.Errorf("%d divergences from the reference matcher (seed %d): %s", len(divergences), cfg.Seed, strings.Join(divergences, "; "))
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("%d filters × %d topics, %d deliveries as modelled, seed %d", len(model.Filters), len(model.Topics), expected, cfg.Seed)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testWildcardSubscriptionScale subscribes one client to thousands of
+// distinct exact, + and # filters and checks that probes are still matched
+// as the reference matcher does. SUBACKs getting markedly slower as the
+// subscriptions grow, or the broker refusing some of them, is a warning.
+func testWildcardSubscriptionScale(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name: "Wildcard Subscription Scale",
+	}
+
+	scale, err := common.CheckWildcardScale(cfg, 4)
+	switch {
+	case err != nil:
+		result.Error = err
+	case len(scale.Divergences) > 0:
+		result.Error = fmt.Errorf("%d divergences from the reference matcher with %d filters: %s", len(scale.Divergences), scale.Filters, strings.Join(scale.Divergences, "; "))
+	case scale.Refused > 0:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("%d filters refused with 0x%02x: %v", scale.Refused, scale.RefusedCode, scale)
+	case scale.Degraded(cfg):
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("SUBACKs slowed down as subscriptions grew: %v", scale)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = scale.String()
 	}
 
 	result.Duration = time.Since(start)
@@ -0,0 +1,162 @@
+package v3
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// unknownPacketID is a packet identifier no test ever has in flight
+const unknownPacketID = 0x1234
+
+// UnknownAckTests returns tests that send acknowledgements for packet
+// identifiers the broker never used and check that QoS flows on the same
+// connection are unaffected
+func UnknownAckTests() common.TestGroup {
+	return common.TestGroup{
+		Name: "Unknown Packet Identifiers",
+		Tags: []string{"qos", "negative"},
+		Tests: []common.TestFunc{
+			testUnknownPuback,
+			testUnknownPubrec,
+			testUnknownPubrel,
+			testUnknownPubcomp,
+		},
+	}
+}
+
+// sendUnknownAck connects with a raw CONNECT and sends an acknowledgement
+// packet for unknownPacketID. The connection is nil if either failed, with
+// result.Error set.
+func sendUnknownAck(cfg common.Config, clientPrefix string, header byte, result *common.TestResult) *common.RawConn {
+	conn, err := common.DialRaw(cfg, 4, cfg.ClientID(clientPrefix))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		return nil
+	}
+	if err := conn.Send(header, binary.BigEndian.AppendUint16(nil, unknownPacketID)); err != nil {
+		conn.Close()
+		result.Error = fmt.Errorf("failed to send %s: %w", common.PacketName(header), err)
+		return nil
+	}
+	return conn
+}
+
+// checkRoundTrip runs a QoS 1 round trip on conn after an unknown
+// acknowledgement and fills in result. A broker that dropped the connection
+// over the acknowledgement gets a warning, since 3.1.1 does not say how to
+// treat one.
+func checkRoundTrip(cfg common.Config, conn *common.RawConn, ack string, result *common.TestResult) {
+	err := conn.RoundTrip(cfg.Topic("test/unknown-ack"), cfg.Scaled(5*time.Second))
+	switch {
+	case err == nil:
+		result.Status = common.StatusPassed
+	case errors.Is(err, common.ErrBrokerClosed):
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker closed the connection after a %s with an unknown packet identifier", ack)
+	default:
+		result.Error = fmt.Errorf("QoS 1 flow after %s with unknown packet identifier: %w", ack, err)
+	}
+}
+
+// testUnknownPuback tests that a PUBACK for a packet identifier the broker
+// never sent does not disturb later QoS 1 flows [MQTT-4.3.2-1]
+func testUnknownPuback(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "PUBACK with Unknown Packet Identifier",
+		SpecRef: "MQTT-4.3.2-1",
+	}
+
+	conn := sendUnknownAck(cfg, "test-unknown-puback", 0x40, &result)
+	if conn == nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+	checkRoundTrip(cfg, conn, "PUBACK", &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUnknownPubrec tests that a PUBREC for a packet identifier the broker
+// never sent does not disturb later QoS 1 flows [MQTT-4.3.3-1]
+func testUnknownPubrec(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "PUBREC with Unknown Packet Identifier",
+		SpecRef: "MQTT-4.3.3-1",
+	}
+
+	conn := sendUnknownAck(cfg, "test-unknown-pubrec", 0x50, &result)
+	if conn == nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+	checkRoundTrip(cfg, conn, "PUBREC", &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUnknownPubrel tests that a PUBREL is answered with a PUBCOMP even when
+// the broker holds no message for its packet identifier [MQTT-4.3.3-2]
+// "MUST respond to a PUBREL packet by sending a PUBCOMP packet containing the
+// same Packet Identifier as the PUBREL"
+func testUnknownPubrel(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "PUBREL with Unknown Packet Identifier",
+		SpecRef: "MQTT-4.3.3-2",
+	}
+
+	conn := sendUnknownAck(cfg, "test-unknown-pubrel", 0x62, &result)
+	if conn == nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	_, pubcomp, err := conn.Expect(0x70, cfg.Scaled(2*time.Second), nil)
+	if err != nil {
+		result.Error = fmt.Errorf("PUBREL with unknown packet identifier: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	if len(pubcomp) < 2 || binary.BigEndian.Uint16(pubcomp) != unknownPacketID {
+		result.Error = fmt.Errorf("PUBCOMP does not carry the PUBREL's packet identifier: % x", pubcomp)
+		result.Duration = time.Since(start)
+		return result
+	}
+	checkRoundTrip(cfg, conn, "PUBREL", &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUnknownPubcomp tests that a PUBCOMP for a packet identifier the broker
+// never released does not disturb later QoS 1 flows [MQTT-4.3.3-1]
+func testUnknownPubcomp(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "PUBCOMP with Unknown Packet Identifier",
+		SpecRef: "MQTT-4.3.3-1",
+	}
+
+	conn := sendUnknownAck(cfg, "test-unknown-pubcomp", 0x70, &result)
+	if conn == nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+	checkRoundTrip(cfg, conn, "PUBCOMP", &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -1,6 +1,7 @@
 package v3
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -13,6 +14,7 @@ import (
 func UnsubscribeTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "Unsubscribe",
+		Tags: []string{"core"},
 		Tests: []common.TestFunc{
 			testBasicUnsubscribe,
 			testUnsubscribeStopsDelivery,
@@ -24,7 +26,7 @@ func UnsubscribeTests() common.TestGroup {
 }
 
 // testBasicUnsubscribe tests basic unsubscribe functionality [MQTT-3.10.4-1]
-func testBasicUnsubscribe(cfg common.Config) common.TestResult {
+func testBasicUnsubscribe(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Basic Unsubscribe",
@@ -39,7 +41,7 @@ func testBasicUnsubscribe(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-unsub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -47,11 +49,14 @@ func testBasicUnsubscribe(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "test/unsubscribe/basic"
-	subscriber.Subscribe(topic, 1, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	topic := cfg.Topic("test/unsubscribe/basic")
+	if err := SubscribeSync(cfg, subscriber, topic, 1, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-unsub-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -61,7 +66,7 @@ func testBasicUnsubscribe(cfg common.Config) common.TestResult {
 
 	// Publish before unsubscribe
 	publisher.Publish(topic, 1, false, "msg1").Wait()
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	// Unsubscribe
 	token := subscriber.Unsubscribe(topic)
@@ -72,7 +77,7 @@ func testBasicUnsubscribe(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	mu.Lock()
 	countBeforeUnsub := receivedCount
@@ -80,7 +85,7 @@ func testBasicUnsubscribe(cfg common.Config) common.TestResult {
 
 	// Publish after unsubscribe
 	publisher.Publish(topic, 1, false, "msg2").Wait()
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -89,7 +94,7 @@ func testBasicUnsubscribe(cfg common.Config) common.TestResult {
 	} else if countBeforeUnsub == 0 {
 		result.Error = fmt.Errorf("did not receive message before unsubscribe")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -97,7 +102,7 @@ func testBasicUnsubscribe(cfg common.Config) common.TestResult {
 }
 
 // testUnsubscribeStopsDelivery tests unsubscribe stops new message delivery [MQTT-3.10.4-2]
-func testUnsubscribeStopsDelivery(cfg common.Config) common.TestResult {
+func testUnsubscribeStopsDelivery(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Unsubscribe Stops Delivery",
@@ -112,7 +117,7 @@ func testUnsubscribeStopsDelivery(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-unsub-stop"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-stop"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -120,15 +125,18 @@ func testUnsubscribeStopsDelivery(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic := "test/unsubscribe/stop"
-	subscriber.Subscribe(topic, 1, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	topic := cfg.Topic("test/unsubscribe/stop")
+	if err := SubscribeSync(cfg, subscriber, topic, 1, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
 	// Unsubscribe
 	subscriber.Unsubscribe(topic).Wait()
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-unsub-stop-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-stop-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -138,14 +146,14 @@ func testUnsubscribeStopsDelivery(cfg common.Config) common.TestResult {
 
 	// Publish after unsubscribe - should not be received
 	publisher.Publish(topic, 1, false, "after unsub").Wait()
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if receivedAfterUnsub {
 		result.Error = fmt.Errorf("received message after unsubscribe")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -153,7 +161,7 @@ func testUnsubscribeStopsDelivery(cfg common.Config) common.TestResult {
 }
 
 // testUnsubscribeMultipleTopics tests unsubscribe from multiple topics [MQTT-3.10.3-1]
-func testUnsubscribeMultipleTopics(cfg common.Config) common.TestResult {
+func testUnsubscribeMultipleTopics(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Unsubscribe Multiple Topics",
@@ -168,7 +176,7 @@ func testUnsubscribeMultipleTopics(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-unsub-multi"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-multi"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -176,18 +184,21 @@ func testUnsubscribeMultipleTopics(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	topic1 := "test/unsubscribe/multi/1"
-	topic2 := "test/unsubscribe/multi/2"
+	topic1 := cfg.Topic("test/unsubscribe/multi/1")
+	topic2 := cfg.Topic("test/unsubscribe/multi/2")
 
 	// Subscribe to both
 	topics := map[string]byte{
 		topic1: 1,
 		topic2: 1,
 	}
-	subscriber.SubscribeMultiple(topics, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	if err := SubscribeMultipleSync(cfg, subscriber, topics, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	publisher, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-unsub-multi-pub"), nil)
+	publisher, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-multi-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -198,7 +209,7 @@ func testUnsubscribeMultipleTopics(cfg common.Config) common.TestResult {
 	// Publish to both topics
 	publisher.Publish(topic1, 1, false, "msg1").Wait()
 	publisher.Publish(topic2, 1, false, "msg2").Wait()
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	if len(receivedTopics) != 2 {
@@ -212,19 +223,19 @@ func testUnsubscribeMultipleTopics(cfg common.Config) common.TestResult {
 
 	// Unsubscribe from both
 	subscriber.Unsubscribe(topic1, topic2).Wait()
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	// Publish again - should not be received
 	publisher.Publish(topic1, 1, false, "msg3").Wait()
 	publisher.Publish(topic2, 1, false, "msg4").Wait()
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if len(receivedTopics) > 0 {
 		result.Error = fmt.Errorf("received messages after unsubscribe from multiple topics")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -232,14 +243,14 @@ func testUnsubscribeMultipleTopics(cfg common.Config) common.TestResult {
 }
 
 // testUnsubscribeAcknowledgement tests UNSUBACK is sent [MQTT-3.10.4-4]
-func testUnsubscribeAcknowledgement(cfg common.Config) common.TestResult {
+func testUnsubscribeAcknowledgement(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Unsubscribe Acknowledgement",
 		SpecRef: "MQTT-3.10.4-4",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-unsuback"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsuback"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -247,9 +258,12 @@ func testUnsubscribeAcknowledgement(cfg common.Config) common.TestResult {
 	}
 	defer client.Disconnect(250)
 
-	topic := "test/unsubscribe/ack"
-	client.Subscribe(topic, 1, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	topic := cfg.Topic("test/unsubscribe/ack")
+	if err := SubscribeSync(cfg, client, topic, 1, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
 	token := client.Unsubscribe(topic)
 	if !token.WaitTimeout(5 * time.Second) {
@@ -261,7 +275,7 @@ func testUnsubscribeAcknowledgement(cfg common.Config) common.TestResult {
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("unsubscribe failed: %w", token.Error())
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -269,14 +283,14 @@ func testUnsubscribeAcknowledgement(cfg common.Config) common.TestResult {
 }
 
 // testUnsubscribeNonExistentTopic tests unsubscribe from non-existent topic still gets UNSUBACK [MQTT-3.10.4-5]
-func testUnsubscribeNonExistentTopic(cfg common.Config) common.TestResult {
+func testUnsubscribeNonExistentTopic(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Unsubscribe Non-Existent Topic",
 		SpecRef: "MQTT-3.10.4-5",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-unsub-nonexist"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-nonexist"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -285,7 +299,7 @@ func testUnsubscribeNonExistentTopic(cfg common.Config) common.TestResult {
 	defer client.Disconnect(250)
 
 	// Unsubscribe from topic we never subscribed to
-	topic := "test/unsubscribe/nonexistent"
+	topic := cfg.Topic("test/unsubscribe/nonexistent")
 	token := client.Unsubscribe(topic)
 	if !token.WaitTimeout(5 * time.Second) {
 		result.Error = fmt.Errorf("unsubscribe timeout (no UNSUBACK)")
@@ -297,7 +311,7 @@ func testUnsubscribeNonExistentTopic(cfg common.Config) common.TestResult {
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("unsubscribe failed: %w", token.Error())
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -1,7 +1,9 @@
 package v3
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/bromq-dev/testmqtt/conformance/common"
@@ -11,6 +13,7 @@ import (
 func PacketValidationTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "Packet Validation",
+		Tags: []string{"packet-format", "negative"},
 		Tests: []common.TestFunc{
 			testConnectPacketValidation,
 			testPublishPacketValidation,
@@ -25,11 +28,15 @@ func PacketValidationTests() common.TestGroup {
 func UTF8ValidationTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "UTF-8 Validation",
+		Tags: []string{"packet-format"},
 		Tests: []common.TestFunc{
 			testValidUTF8String,
 			testUTF8WithSpaces,
 			testUTF8CaseSensitive,
 			testUTF8MaxLength,
+			testUTF8BOMPreserved,
+			testUTF8Noncharacters,
+			testUTF8ControlCharacters,
 		},
 	}
 }
@@ -38,15 +45,18 @@ func UTF8ValidationTests() common.TestGroup {
 func RemainingLengthTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "Remaining Length",
+		Tags: []string{"packet-format"},
 		Tests: []common.TestFunc{
 			testRemainingLengthSmallPacket,
 			testRemainingLengthLargePayload,
+			testRemainingLengthFiveBytes,
+			testRemainingLengthMismatch,
 		},
 	}
 }
 
 // testConnectPacketValidation tests CONNECT packet structure [MQTT-3.1.0-1]
-func testConnectPacketValidation(cfg common.Config) common.TestResult {
+func testConnectPacketValidation(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "CONNECT Packet Validation",
@@ -54,7 +64,7 @@ func testConnectPacketValidation(cfg common.Config) common.TestResult {
 	}
 
 	// Valid CONNECT packet structure
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-connect-valid"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-connect-valid"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -62,20 +72,20 @@ func testConnectPacketValidation(cfg common.Config) common.TestResult {
 	}
 	defer client.Disconnect(250)
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testPublishPacketValidation tests PUBLISH packet structure [MQTT-3.3.1-1]
-func testPublishPacketValidation(cfg common.Config) common.TestResult {
+func testPublishPacketValidation(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "PUBLISH Packet Validation",
 		SpecRef: "MQTT-3.3.1-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-pub-valid"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-valid"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -84,7 +94,7 @@ func testPublishPacketValidation(cfg common.Config) common.TestResult {
 	defer client.Disconnect(250)
 
 	// Valid PUBLISH with various QoS levels
-	token := client.Publish("test/validation/publish", 1, false, "test payload")
+	token := client.Publish(cfg.Topic("test/validation/publish"), 1, false, "test payload")
 	token.Wait()
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("publish failed: %w", token.Error())
@@ -92,20 +102,20 @@ func testPublishPacketValidation(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testSubscribePacketValidation tests SUBSCRIBE packet structure [MQTT-3.8.1-1]
-func testSubscribePacketValidation(cfg common.Config) common.TestResult {
+func testSubscribePacketValidation(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "SUBSCRIBE Packet Validation",
 		SpecRef: "MQTT-3.8.1-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-sub-valid"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-valid"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -114,7 +124,7 @@ func testSubscribePacketValidation(cfg common.Config) common.TestResult {
 	defer client.Disconnect(250)
 
 	// Valid SUBSCRIBE
-	token := client.Subscribe("test/validation/subscribe", 1, nil)
+	token := client.Subscribe(cfg.Topic("test/validation/subscribe"), 1, nil)
 	token.Wait()
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("subscribe failed: %w", token.Error())
@@ -122,20 +132,20 @@ func testSubscribePacketValidation(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testUnsubscribePacketValidation tests UNSUBSCRIBE packet structure [MQTT-3.10.1-1]
-func testUnsubscribePacketValidation(cfg common.Config) common.TestResult {
+func testUnsubscribePacketValidation(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "UNSUBSCRIBE Packet Validation",
 		SpecRef: "MQTT-3.10.1-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-unsub-valid"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-valid"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -144,10 +154,10 @@ func testUnsubscribePacketValidation(cfg common.Config) common.TestResult {
 	defer client.Disconnect(250)
 
 	// Subscribe first
-	client.Subscribe("test/validation/unsubscribe", 1, nil).Wait()
+	client.Subscribe(cfg.Topic("test/validation/unsubscribe"), 1, nil).Wait()
 
 	// Valid UNSUBSCRIBE
-	token := client.Unsubscribe("test/validation/unsubscribe")
+	token := client.Unsubscribe(cfg.Topic("test/validation/unsubscribe"))
 	token.Wait()
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("unsubscribe failed: %w", token.Error())
@@ -155,20 +165,20 @@ func testUnsubscribePacketValidation(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testPacketIdentifierValidity tests packet identifier usage [MQTT-2.3.1]
-func testPacketIdentifierValidity(cfg common.Config) common.TestResult {
+func testPacketIdentifierValidity(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Packet Identifier Validity",
 		SpecRef: "MQTT-2.3.1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-pktid"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pktid"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -178,7 +188,7 @@ func testPacketIdentifierValidity(cfg common.Config) common.TestResult {
 
 	// Publish multiple QoS 1 messages (each gets packet identifier)
 	for i := 0; i < 5; i++ {
-		token := client.Publish("test/validation/pktid", 1, false, fmt.Sprintf("msg%d", i))
+		token := client.Publish(cfg.Topic("test/validation/pktid"), 1, false, fmt.Sprintf("msg%d", i))
 		token.Wait()
 		if token.Error() != nil {
 			result.Error = fmt.Errorf("publish %d failed: %w", i, token.Error())
@@ -187,20 +197,20 @@ func testPacketIdentifierValidity(cfg common.Config) common.TestResult {
 		}
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testValidUTF8String tests valid UTF-8 strings [MQTT-1.5.3-1]
-func testValidUTF8String(cfg common.Config) common.TestResult {
+func testValidUTF8String(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Valid UTF-8 Strings",
 		SpecRef: "MQTT-1.5.3-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-utf8-valid"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-utf8-valid"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -210,10 +220,10 @@ func testValidUTF8String(cfg common.Config) common.TestResult {
 
 	// Topic with valid UTF-8 including non-ASCII characters
 	topics := []string{
-		"test/utf8/simple",
-		"test/utf8/émoji",
-		"test/utf8/日本語",
-		"test/utf8/🚀",
+		cfg.Topic("test/utf8/simple"),
+		cfg.Topic("test/utf8/émoji"),
+		cfg.Topic("test/utf8/日本語"),
+		cfg.Topic("test/utf8/🚀"),
 	}
 
 	for _, topic := range topics {
@@ -226,20 +236,20 @@ func testValidUTF8String(cfg common.Config) common.TestResult {
 		}
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testUTF8WithSpaces tests UTF-8 strings can contain spaces [MQTT-4.7.3-1]
-func testUTF8WithSpaces(cfg common.Config) common.TestResult {
+func testUTF8WithSpaces(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "UTF-8 Strings with Spaces",
 		SpecRef: "MQTT-4.7.3-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-utf8-spaces"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-utf8-spaces"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -247,7 +257,7 @@ func testUTF8WithSpaces(cfg common.Config) common.TestResult {
 	}
 	defer client.Disconnect(250)
 
-	topic := "test/utf8/with spaces"
+	topic := cfg.Topic("test/utf8/with spaces")
 	token := client.Publish(topic, 0, false, "message")
 	token.Wait()
 	if token.Error() != nil {
@@ -256,20 +266,20 @@ func testUTF8WithSpaces(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testUTF8CaseSensitive tests UTF-8 strings are case sensitive [MQTT-4.7.3-1]
-func testUTF8CaseSensitive(cfg common.Config) common.TestResult {
+func testUTF8CaseSensitive(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "UTF-8 Case Sensitivity",
 		SpecRef: "MQTT-4.7.3-4",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-utf8-case"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-utf8-case"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -278,23 +288,24 @@ func testUTF8CaseSensitive(cfg common.Config) common.TestResult {
 	defer client.Disconnect(250)
 
 	// These should be treated as different topics
-	client.Publish("test/CASE", 0, false, "upper").Wait()
-	client.Publish("test/case", 0, false, "lower").Wait()
+	client.Publish(cfg.Topic("test/CASE"), 0, false, "upper").Wait()
+	client.Publish(cfg.Topic("test/case"), 0, false, "lower").Wait()
 
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "topics were published but delivery to distinct subscriptions was not verified"
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testUTF8MaxLength tests UTF-8 string maximum length [MQTT-4.7.3-3]
-func testUTF8MaxLength(cfg common.Config) common.TestResult {
+func testUTF8MaxLength(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "UTF-8 Maximum Length",
 		SpecRef: "MQTT-4.7.3-3",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-utf8-maxlen"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-utf8-maxlen"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -303,7 +314,7 @@ func testUTF8MaxLength(cfg common.Config) common.TestResult {
 	defer client.Disconnect(250)
 
 	// Create a reasonably long topic (not 65535 to avoid timeout issues)
-	longTopic := "test/utf8/long/"
+	longTopic := cfg.Topic("test/utf8/long/")
 	for i := 0; i < 100; i++ {
 		longTopic += "segment/"
 	}
@@ -312,21 +323,92 @@ func testUTF8MaxLength(cfg common.Config) common.TestResult {
 	token.WaitTimeout(5 * time.Second)
 
 	// May succeed or fail based on broker limits, test passes either way
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "long topic was published but acceptance was not verified"
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// checkTopicHandled fills in result from common.TryTopic: the broker may
+// deliver a message on topic or refuse the topic cleanly, but must go on
+// carrying messages. With mustDeliver a refusal is a warning.
+func checkTopicHandled(cfg common.Config, clientPrefix, topic string, mustDeliver bool, result *common.TestResult) {
+	refusals, err := common.TryTopic(cfg, 4, clientPrefix, topic)
+	switch {
+	case err != nil:
+		result.Error = err
+	case len(refusals) == 0:
+		result.Status = common.StatusPassed
+		result.Notes = "topic subscribed, published and delivered"
+	case mustDeliver:
+		result.Status = common.StatusWarning
+		result.Notes = "broker refused a topic it must pass on: " + strings.Join(refusals, ", ")
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = "refused cleanly: " + strings.Join(refusals, ", ")
+	}
+}
+
+// testUTF8BOMPreserved tests that U+FEFF in a topic is delivered as sent
+// [MQTT-1.5.3-3]
+// "A UTF-8 encoded sequence 0xEF 0xBB 0xBF is always to be interpreted to
+// mean U+FEFF ("ZERO WIDTH NO-BREAK SPACE") wherever it appears in a string
+// and MUST NOT be skipped over or stripped off by a packet receiver"
+func testUTF8BOMPreserved(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "U+FEFF Preserved in Topic Names",
+		SpecRef: "MQTT-1.5.3-3",
+	}
+
+	checkTopicHandled(cfg, "test-utf8-bom", cfg.Topic("test/utf8/\uFEFFbom\uFEFF"), true, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUTF8Noncharacters tests a topic containing the noncharacters U+FFFE
+// and U+FFFF, which clients SHOULD NOT send. The broker may pass them on
+// intact or close the connection [MQTT-1.5.3].
+func testUTF8Noncharacters(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Noncharacters U+FFFE/U+FFFF in Topic Names",
+		SpecRef: "MQTT-1.5.3",
+	}
+
+	checkTopicHandled(cfg, "test-utf8-nonchar", cfg.Topic("test/utf8/non\uFFFEchar\uFFFF"), false, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUTF8ControlCharacters tests a topic containing the control characters
+// U+0001..U+001F and U+007F, which clients SHOULD NOT send. The broker may
+// pass them on intact or close the connection [MQTT-1.5.3].
+func testUTF8ControlCharacters(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Control Characters in Topic Names",
+		SpecRef: "MQTT-1.5.3",
+	}
+
+	checkTopicHandled(cfg, "test-utf8-control", cfg.Topic("test/utf8/ctl\u0001\u0009\u001F\u007F"), false, &result)
 
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testRemainingLengthSmallPacket tests small packets with 1-byte remaining length [MQTT-2.2.3]
-func testRemainingLengthSmallPacket(cfg common.Config) common.TestResult {
+func testRemainingLengthSmallPacket(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Remaining Length Small Packet",
 		SpecRef: "MQTT-2.2.3",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-remlen-small"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-remlen-small"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -335,7 +417,7 @@ func testRemainingLengthSmallPacket(cfg common.Config) common.TestResult {
 	defer client.Disconnect(250)
 
 	// Small payload (< 127 bytes, fits in 1-byte remaining length)
-	token := client.Publish("test/remlen/small", 0, false, "small")
+	token := client.Publish(cfg.Topic("test/remlen/small"), 0, false, "small")
 	token.Wait()
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("publish failed: %w", token.Error())
@@ -343,20 +425,20 @@ func testRemainingLengthSmallPacket(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testRemainingLengthLargePayload tests larger packets with multi-byte remaining length [MQTT-2.2.3]
-func testRemainingLengthLargePayload(cfg common.Config) common.TestResult {
+func testRemainingLengthLargePayload(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Remaining Length Large Payload",
 		SpecRef: "MQTT-2.2.3",
 	}
 
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-remlen-large"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-remlen-large"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -370,7 +452,7 @@ func testRemainingLengthLargePayload(cfg common.Config) common.TestResult {
 		largePayload[i] = byte('A' + (i % 26))
 	}
 
-	token := client.Publish("test/remlen/large", 0, false, largePayload)
+	token := client.Publish(cfg.Topic("test/remlen/large"), 0, false, largePayload)
 	token.Wait()
 	if token.Error() != nil {
 		result.Error = fmt.Errorf("publish failed: %w", token.Error())
@@ -378,7 +460,59 @@ func testRemainingLengthLargePayload(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRemainingLengthFiveBytes tests that a Remaining Length spread over five
+// bytes, zero padded with continuation bits, is treated as a protocol
+// violation, since the field is at most four bytes [MQTT-4.8.0-1]
+// "Unless stated otherwise, if either the Server or Client encounters a
+// protocol violation, it MUST close the Network Connection"
+func testRemainingLengthFiveBytes(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Remaining Length Over-long 5-Byte Encoding",
+		SpecRef: "MQTT-4.8.0-1",
+	}
+
+	// PINGREQ with a Remaining Length of 0 in five bytes
+	if err := expectClosed(cfg, "test-remlen-5byte", []byte{0xC0, 0x80, 0x80, 0x80, 0x80, 0x00}); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRemainingLengthMismatch tests a SUBSCRIBE whose Remaining Length ends
+// partway through its Topic Filter, with the rest of the filter sent after
+// it [MQTT-4.8.0-1]
+// "Unless stated otherwise, if either the Server or Client encounters a
+// protocol violation, it MUST close the Network Connection"
+func testRemainingLengthMismatch(ctx context.Context, cfg common.Config) common.TestResult {
+	start := time.Now()
+	result := common.TestResult{
+		Name:    "Remaining Length Shorter Than Contents",
+		SpecRef: "MQTT-4.8.0-1",
+	}
+
+	body := []byte{0x00, 0x01} // Packet Identifier 1
+	body = common.AppendString(body, cfg.Topic("test/remlen/mismatch"))
+	body = append(body, 0x01) // Requested QoS 1
+	packet := common.RawPacket(0x82, body[:6])
+	packet = append(packet, body[6:]...)
+	if err := expectClosed(cfg, "test-remlen-mismatch", packet); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -1,6 +1,7 @@
 package v3
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -13,6 +14,7 @@ import (
 func WillTests() common.TestGroup {
 	return common.TestGroup{
 		Name: "Will Messages",
+		Tags: []string{"session", "will"},
 		Tests: []common.TestFunc{
 			testWillMessageOnAbnormalDisconnect,
 			testWillMessageNotSentOnCleanDisconnect,
@@ -26,7 +28,7 @@ func WillTests() common.TestGroup {
 }
 
 // testWillMessageOnAbnormalDisconnect tests will message is sent on abnormal disconnect [MQTT-3.1.2-8]
-func testWillMessageOnAbnormalDisconnect(cfg common.Config) common.TestResult {
+func testWillMessageOnAbnormalDisconnect(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Will Message on Abnormal Disconnect",
@@ -36,7 +38,7 @@ func testWillMessageOnAbnormalDisconnect(cfg common.Config) common.TestResult {
 	// Subscribe to will topic
 	var mu sync.Mutex
 	var receivedWill bool
-	willTopic := "test/will/abnormal"
+	willTopic := cfg.Topic("test/will/abnormal")
 
 	messageHandler := func(client mqtt.Client, msg mqtt.Message) {
 		mu.Lock()
@@ -46,7 +48,7 @@ func testWillMessageOnAbnormalDisconnect(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-will-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-will-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -54,13 +56,16 @@ func testWillMessageOnAbnormalDisconnect(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	subscriber.Subscribe(willTopic, 1, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	if err := SubscribeSync(cfg, subscriber, willTopic, 1, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
 	// Create client with will message
 	client, err := CreateAndConnectClientWithWill(
 		cfg,
-		common.GenerateClientID("test-will-client"),
+		cfg.ClientID("test-will-client"),
 		willTopic,
 		[]byte("will message"),
 		1,
@@ -73,20 +78,18 @@ func testWillMessageOnAbnormalDisconnect(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Force disconnect by getting the underlying connection (paho.mqtt.golang doesn't expose clean way)
 	// We'll just disconnect without DISCONNECT packet by using very short timeout
 	client.Disconnect(0) // 0ms timeout = abrupt close
 
-	time.Sleep(1 * time.Second) // Wait for will to be published
+	cfg.Wait(1 * time.Second) // Wait for will to be published
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedWill {
 		result.Error = fmt.Errorf("will message not received after abnormal disconnect")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -94,7 +97,7 @@ func testWillMessageOnAbnormalDisconnect(cfg common.Config) common.TestResult {
 }
 
 // testWillMessageNotSentOnCleanDisconnect tests will message NOT sent on DISCONNECT [MQTT-3.1.2-10]
-func testWillMessageNotSentOnCleanDisconnect(cfg common.Config) common.TestResult {
+func testWillMessageNotSentOnCleanDisconnect(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Will Message Not Sent on Clean Disconnect",
@@ -104,7 +107,7 @@ func testWillMessageNotSentOnCleanDisconnect(cfg common.Config) common.TestResul
 	// Subscribe to will topic
 	var mu sync.Mutex
 	var receivedWill bool
-	willTopic := "test/will/clean"
+	willTopic := cfg.Topic("test/will/clean")
 
 	messageHandler := func(client mqtt.Client, msg mqtt.Message) {
 		mu.Lock()
@@ -114,7 +117,7 @@ func testWillMessageNotSentOnCleanDisconnect(cfg common.Config) common.TestResul
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-will-clean-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-will-clean-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -122,13 +125,16 @@ func testWillMessageNotSentOnCleanDisconnect(cfg common.Config) common.TestResul
 	}
 	defer subscriber.Disconnect(250)
 
-	subscriber.Subscribe(willTopic, 1, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	if err := SubscribeSync(cfg, subscriber, willTopic, 1, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
 	// Create client with will message
 	client, err := CreateAndConnectClientWithWill(
 		cfg,
-		common.GenerateClientID("test-will-clean-client"),
+		cfg.ClientID("test-will-clean-client"),
 		willTopic,
 		[]byte("will message"),
 		1,
@@ -141,19 +147,17 @@ func testWillMessageNotSentOnCleanDisconnect(cfg common.Config) common.TestResul
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Clean disconnect with DISCONNECT packet
 	client.Disconnect(250)
 
-	time.Sleep(1 * time.Second) // Wait to ensure will is NOT published
+	cfg.Wait(1 * time.Second) // Wait to ensure will is NOT published
 
 	mu.Lock()
 	defer mu.Unlock()
 	if receivedWill {
 		result.Error = fmt.Errorf("will message was sent on clean disconnect (should not be)")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -161,7 +165,7 @@ func testWillMessageNotSentOnCleanDisconnect(cfg common.Config) common.TestResul
 }
 
 // testWillMessageQoS0 tests will message with QoS 0 [MQTT-3.1.2-9]
-func testWillMessageQoS0(cfg common.Config) common.TestResult {
+func testWillMessageQoS0(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Will Message QoS 0",
@@ -170,7 +174,7 @@ func testWillMessageQoS0(cfg common.Config) common.TestResult {
 
 	var mu sync.Mutex
 	var receivedWill bool
-	willTopic := "test/will/qos0"
+	willTopic := cfg.Topic("test/will/qos0")
 
 	messageHandler := func(client mqtt.Client, msg mqtt.Message) {
 		mu.Lock()
@@ -180,7 +184,7 @@ func testWillMessageQoS0(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-will-qos0-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-will-qos0-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -188,12 +192,15 @@ func testWillMessageQoS0(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	subscriber.Subscribe(willTopic, 0, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	if err := SubscribeSync(cfg, subscriber, willTopic, 0, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
 	client, err := CreateAndConnectClientWithWill(
 		cfg,
-		common.GenerateClientID("test-will-qos0-client"),
+		cfg.ClientID("test-will-qos0-client"),
 		willTopic,
 		[]byte("will qos0"),
 		0, // QoS 0
@@ -206,16 +213,15 @@ func testWillMessageQoS0(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
 	client.Disconnect(0) // Abnormal disconnect
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedWill {
 		result.Error = fmt.Errorf("will message QoS 0 not received")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -223,7 +229,7 @@ func testWillMessageQoS0(cfg common.Config) common.TestResult {
 }
 
 // testWillMessageQoS1 tests will message with QoS 1 [MQTT-3.1.2-14]
-func testWillMessageQoS1(cfg common.Config) common.TestResult {
+func testWillMessageQoS1(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Will Message QoS 1",
@@ -232,7 +238,7 @@ func testWillMessageQoS1(cfg common.Config) common.TestResult {
 
 	var mu sync.Mutex
 	var receivedWill bool
-	willTopic := "test/will/qos1"
+	willTopic := cfg.Topic("test/will/qos1")
 
 	messageHandler := func(client mqtt.Client, msg mqtt.Message) {
 		mu.Lock()
@@ -242,7 +248,7 @@ func testWillMessageQoS1(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-will-qos1-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-will-qos1-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -250,12 +256,15 @@ func testWillMessageQoS1(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	subscriber.Subscribe(willTopic, 1, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	if err := SubscribeSync(cfg, subscriber, willTopic, 1, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
 	client, err := CreateAndConnectClientWithWill(
 		cfg,
-		common.GenerateClientID("test-will-qos1-client"),
+		cfg.ClientID("test-will-qos1-client"),
 		willTopic,
 		[]byte("will qos1"),
 		1, // QoS 1
@@ -268,16 +277,15 @@ func testWillMessageQoS1(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
 	client.Disconnect(0) // Abnormal disconnect
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedWill {
 		result.Error = fmt.Errorf("will message QoS 1 not received")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -285,7 +293,7 @@ func testWillMessageQoS1(cfg common.Config) common.TestResult {
 }
 
 // testWillMessageQoS2 tests will message with QoS 2 [MQTT-3.1.2-14]
-func testWillMessageQoS2(cfg common.Config) common.TestResult {
+func testWillMessageQoS2(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Will Message QoS 2",
@@ -294,7 +302,7 @@ func testWillMessageQoS2(cfg common.Config) common.TestResult {
 
 	var mu sync.Mutex
 	var receivedWill bool
-	willTopic := "test/will/qos2"
+	willTopic := cfg.Topic("test/will/qos2")
 
 	messageHandler := func(client mqtt.Client, msg mqtt.Message) {
 		mu.Lock()
@@ -304,7 +312,7 @@ func testWillMessageQoS2(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-will-qos2-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-will-qos2-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -312,12 +320,15 @@ func testWillMessageQoS2(cfg common.Config) common.TestResult {
 	}
 	defer subscriber.Disconnect(250)
 
-	subscriber.Subscribe(willTopic, 2, nil).Wait()
-	time.Sleep(100 * time.Millisecond)
+	if err := SubscribeSync(cfg, subscriber, willTopic, 2, nil); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
 	client, err := CreateAndConnectClientWithWill(
 		cfg,
-		common.GenerateClientID("test-will-qos2-client"),
+		cfg.ClientID("test-will-qos2-client"),
 		willTopic,
 		[]byte("will qos2"),
 		2, // QoS 2
@@ -330,16 +341,15 @@ func testWillMessageQoS2(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
 	client.Disconnect(0) // Abnormal disconnect
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedWill {
 		result.Error = fmt.Errorf("will message QoS 2 not received")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -347,19 +357,19 @@ func testWillMessageQoS2(cfg common.Config) common.TestResult {
 }
 
 // testWillMessageRetained tests will message with retain flag [MQTT-3.1.2-17]
-func testWillMessageRetained(cfg common.Config) common.TestResult {
+func testWillMessageRetained(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Will Message Retained",
 		SpecRef: "MQTT-3.1.2-17",
 	}
 
-	willTopic := "test/will/retained"
+	willTopic := cfg.Topic("test/will/retained")
 
 	// Create client with retained will message
 	client, err := CreateAndConnectClientWithWill(
 		cfg,
-		common.GenerateClientID("test-will-retained-client"),
+		cfg.ClientID("test-will-retained-client"),
 		willTopic,
 		[]byte("retained will"),
 		1,
@@ -372,9 +382,9 @@ func testWillMessageRetained(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 	client.Disconnect(0) // Abnormal disconnect to trigger will
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	// Now subscribe and should receive retained will
 	var mu sync.Mutex
@@ -387,7 +397,7 @@ func testWillMessageRetained(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-will-retained-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-will-retained-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -396,14 +406,14 @@ func testWillMessageRetained(cfg common.Config) common.TestResult {
 	defer subscriber.Disconnect(250)
 
 	subscriber.Subscribe(willTopic, 1, nil).Wait()
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if !receivedRetained {
 		result.Error = fmt.Errorf("retained will message not received by new subscriber")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -411,19 +421,19 @@ func testWillMessageRetained(cfg common.Config) common.TestResult {
 }
 
 // testWillMessageNotRetained tests will message without retain flag [MQTT-3.1.2-16]
-func testWillMessageNotRetained(cfg common.Config) common.TestResult {
+func testWillMessageNotRetained(ctx context.Context, cfg common.Config) common.TestResult {
 	start := time.Now()
 	result := common.TestResult{
 		Name:    "Will Message Not Retained",
 		SpecRef: "MQTT-3.1.2-16",
 	}
 
-	willTopic := "test/will/notretained"
+	willTopic := cfg.Topic("test/will/notretained")
 
 	// Create client with non-retained will message
 	client, err := CreateAndConnectClientWithWill(
 		cfg,
-		common.GenerateClientID("test-will-notretained-client"),
+		cfg.ClientID("test-will-notretained-client"),
 		willTopic,
 		[]byte("non-retained will"),
 		1,
@@ -436,9 +446,9 @@ func testWillMessageNotRetained(cfg common.Config) common.TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 	client.Disconnect(0) // Abnormal disconnect to trigger will
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	// Now subscribe and should NOT receive retained will
 	var mu sync.Mutex
@@ -451,7 +461,7 @@ func testWillMessageNotRetained(cfg common.Config) common.TestResult {
 		mu.Unlock()
 	}
 
-	subscriber, err := CreateAndConnectClient(cfg, common.GenerateClientID("test-will-notretained-sub"), messageHandler)
+	subscriber, err := CreateAndConnectClient(cfg, cfg.ClientID("test-will-notretained-sub"), messageHandler)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -460,14 +470,14 @@ func testWillMessageNotRetained(cfg common.Config) common.TestResult {
 	defer subscriber.Disconnect(250)
 
 	subscriber.Subscribe(willTopic, 1, nil).Wait()
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	defer mu.Unlock()
 	if receivedMessage {
 		result.Error = fmt.Errorf("non-retained will message was received by new subscriber (should not be)")
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -0,0 +1,178 @@
+package v5
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/assert"
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// reasonNotAuthorized is the reason code for an operation the client's
+// credentials do not allow
+const reasonNotAuthorized = 0x87
+
+// AuthorizationTests returns tests of the broker's access control, which
+// needs to be set up for them and described with Config.ACL. Without a
+// denied topic they are skipped.
+func AuthorizationTests() TestGroup {
+	return TestGroup{
+		Name: "Authorization",
+		Tags: []string{"optional", "acl"},
+		Tests: []TestFunc{
+			testACLAllowedTopic,
+			testACLDeniedPublishQoS1,
+			testACLDeniedPublishQoS2,
+			testACLDeniedSubscribe,
+		},
+	}
+}
+
+// testACLAllowedTopic tests that the ACL credentials can publish and
+// subscribe to the allowed topic, so the denials the other tests look for
+// are down to the ACL
+func testACLAllowedTopic(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name: "Allowed Topic Round Trip",
+	}
+
+	if common.SkipWithoutACL(cfg, &result) {
+		return result
+	}
+
+	conn, err := common.DialRaw(cfg.ACLUser(), 5, cfg.ClientID("test-acl-allowed"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect with the ACL credentials failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	if err := conn.RoundTrip(cfg.AllowedTopic(), cfg.Scaled(5*time.Second)); err != nil {
+		result.Error = fmt.Errorf("allowed topic %q: %w", cfg.AllowedTopic(), err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// checkDeniedPublish fills in result for a PUBLISH to the denied topic at
+// qos, which should be acknowledged with 0x87 (Not authorized) and not
+// delivered. Other failure codes, acknowledging with success and dropping
+// the message, or disconnecting are warnings.
+func checkDeniedPublish(cfg common.Config, qos byte, result *TestResult) {
+	ack := "PUBACK"
+	if qos == 2 {
+		ack = "PUBREC"
+	}
+	reason, err := common.PublishDenied(cfg, 5, qos)
+	switch {
+	case errors.Is(err, common.ErrBrokerClosed):
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker disconnected rather than sending %s 0x87 (Not authorized)", ack)
+	case err != nil:
+		result.Error = err
+	case reason == reasonNotAuthorized:
+		result.Status = common.StatusPassed
+	case reason >= 0x80:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker refused the message with %s %s rather than %s", ack, assert.ReasonName(reason), assert.ReasonName(reasonNotAuthorized))
+	default:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker acknowledged with %s %s and dropped the message", ack, assert.ReasonName(reason))
+	}
+}
+
+// testACLDeniedPublishQoS1 tests that a QoS 1 PUBLISH to a denied topic is
+// refused with PUBACK 0x87 (Not authorized) [MQTT-3.4.2.1]
+func testACLDeniedPublishQoS1(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Denied PUBLISH QoS 1 Gets PUBACK 0x87",
+		SpecRef: "MQTT-3.4.2.1",
+	}
+
+	if common.SkipWithoutACL(cfg, &result) || common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
+	checkDeniedPublish(cfg, 1, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testACLDeniedPublishQoS2 tests that a QoS 2 PUBLISH to a denied topic is
+// refused with PUBREC 0x87 (Not authorized) [MQTT-3.5.2.1]
+func testACLDeniedPublishQoS2(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Denied PUBLISH QoS 2 Gets PUBREC 0x87",
+		SpecRef: "MQTT-3.5.2.1",
+	}
+
+	if common.SkipWithoutACL(cfg, &result) || common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
+	checkDeniedPublish(cfg, 2, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testACLDeniedSubscribe tests that a filter the ACL denies is refused with
+// SUBACK 0x87 (Not authorized) in its own position, and the filters around it
+// are granted [MQTT-3.9.3-1]
+// "The order of Reason Codes in the SUBACK packet MUST match the order of
+// Topic Filters in the SUBSCRIBE packet"
+func testACLDeniedSubscribe(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Denied SUBSCRIBE Gets SUBACK 0x87 for Its Filter Only",
+		SpecRef: "MQTT-3.9.3-1",
+	}
+
+	if common.SkipWithoutACL(cfg, &result) {
+		return result
+	}
+
+	conn, err := common.DialRaw(cfg.ACLUser(), 5, cfg.ClientID("test-acl-subscribe"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	// The allowed topic twice, since it may be the only one the ACL allows
+	allowed := cfg.AllowedTopic()
+	codes, err := conn.Subscribe(1, 1, cfg.Scaled(5*time.Second), allowed, cfg.ACL.DeniedTopic, allowed)
+	switch {
+	case errors.Is(err, common.ErrBrokerClosed):
+		result.Status = common.StatusWarning
+		result.Notes = "broker disconnected rather than sending SUBACK 0x87 (Not authorized)"
+	case err != nil:
+		result.Error = err
+	case len(codes) != 3:
+		result.Error = fmt.Errorf("SUBACK has %d reason codes for 3 filters: % x", len(codes), codes)
+	case codes[0] >= 0x80 || codes[2] >= 0x80:
+		result.Error = fmt.Errorf("allowed filters refused along with the denied one: % x", codes)
+	case codes[1] == reasonNotAuthorized:
+		result.Status = common.StatusPassed
+	case codes[1] >= 0x80:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker refused the denied filter with %s rather than %s", assert.ReasonName(codes[1]), assert.ReasonName(reasonNotAuthorized))
+	default:
+		result.Error = fmt.Errorf("broker granted the denied topic %q with reason code %s", cfg.ACL.DeniedTopic, assert.ReasonName(codes[1]))
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,147 @@
+package v5
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/assert"
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// CONNACK reason codes of the authentication tests
+const reasonBadUsernameOrPassword = 0x86
+
+// AuthenticationTests returns tests of the CONNACK reason codes for valid,
+// invalid and missing credentials as described by Config.Auth. Each test is
+// skipped when its credentials are not configured.
+func AuthenticationTests() TestGroup {
+	return TestGroup{
+		Name: "Authentication",
+		Tags: []string{"optional", "auth"},
+		Tests: []TestFunc{
+			testAuthValidCredentials,
+			testAuthInvalidCredentials,
+			testAuthAnonymous,
+		},
+	}
+}
+
+// checkAccepted fills in result for a CONNECT the broker should accept
+func checkAccepted(cfg common.Config, out common.ConnectOutcome, result *TestResult) {
+	switch {
+	case !out.Connack:
+		result.Error = fmt.Errorf("broker closed the connection without CONNACK")
+	case assert.ReasonCode(result, cfg, "CONNACK reason code", out.Code, 0x00):
+		result.Status = common.StatusPassed
+	}
+}
+
+// checkRefused fills in result for a CONNECT the broker should refuse with
+// reason code want and then close. The other authentication reason code, or
+// closing without a CONNACK, is a warning.
+func checkRefused(cfg common.Config, out common.ConnectOutcome, want byte, result *TestResult) {
+	switch {
+	case !out.Connack:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker closed the connection without CONNACK %s", assert.ReasonName(want))
+	case out.Code == 0x00:
+		result.Error = fmt.Errorf("broker accepted the connection, expected CONNACK %s", assert.ReasonName(want))
+	case !out.Closed:
+		result.Error = fmt.Errorf("broker refused with CONNACK %s but kept the connection open", assert.ReasonName(out.Code))
+	case out.Code == want:
+		result.Status = common.StatusPassed
+	case out.Code == reasonBadUsernameOrPassword || out.Code == reasonNotAuthorized:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker refused with %s rather than %s", assert.ReasonName(out.Code), assert.ReasonName(want))
+	default:
+		assert.ReasonCode(result, cfg, "CONNACK reason code", out.Code, want)
+	}
+}
+
+// testAuthValidCredentials tests that the configured credentials are
+// accepted with reason code 0x00 [MQTT-3.2.2.2]
+func testAuthValidCredentials(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Valid Credentials Accepted (0x00)",
+		SpecRef: "MQTT-3.2.2.2",
+	}
+
+	if cfg.Username == "" {
+		result.Status = common.StatusSkipped
+		result.Notes = "no credentials configured (--username)"
+		return result
+	}
+
+	out, err := common.TryConnect(cfg, 5, cfg.ClientID("test-auth-valid"), cfg.Username, cfg.Password)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	checkAccepted(cfg, out, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testAuthInvalidCredentials tests that wrong credentials are refused with
+// 0x86 (Bad User Name or Password) and the connection closed [MQTT-3.1.4-2]
+// "If any of these checks fail, it MUST close the Network Connection"
+func testAuthInvalidCredentials(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Invalid Credentials Refused (0x86)",
+		SpecRef: "MQTT-3.1.4-2",
+	}
+
+	if cfg.Auth.InvalidUsername == "" {
+		result.Status = common.StatusSkipped
+		result.Notes = "no invalid credentials configured (--invalid-username)"
+		return result
+	}
+
+	out, err := common.TryConnect(cfg, 5, cfg.ClientID("test-auth-invalid"), cfg.Auth.InvalidUsername, cfg.Auth.InvalidPassword)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	checkRefused(cfg, out, reasonBadUsernameOrPassword, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testAuthAnonymous tests a CONNECT without credentials: accepted with 0x00
+// where anonymous clients are allowed, refused with 0x87 (Not authorized)
+// where they are not [MQTT-3.1.4-2]
+func testAuthAnonymous(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Anonymous Access Matches Configuration",
+		SpecRef: "MQTT-3.1.4-2",
+	}
+
+	if cfg.Auth.Anonymous == "" {
+		result.Status = common.StatusSkipped
+		result.Notes = "anonymous access not configured (--anonymous-access allow|deny)"
+		return result
+	}
+
+	out, err := common.TryConnect(cfg, 5, cfg.ClientID("test-auth-anonymous"), "", "")
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if cfg.Auth.Anonymous == common.AnonymousAllow {
+		checkAccepted(cfg, out, &result)
+	} else {
+		checkRefused(cfg, out, reasonNotAuthorized, &result)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,89 @@
+package v5
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// barriers maps the topic of each barrier in flight to the channel its
+// message is signalled on
+var barriers sync.Map
+
+// barrierTopic is the topic level every barrier topic starts with, under
+// the run's namespace
+const barrierTopic = "barrier/"
+
+// withBarriers wraps a client's message handler so barrier messages are
+// signalled to Barrier instead of reaching the test, including those a
+// wildcard subscription picks up from other clients' barriers. Every client
+// the helpers create gets one, with or without a handler of its own.
+func withBarriers(cfg common.Config, onPublish func(paho.PublishReceived) (bool, error)) []func(paho.PublishReceived) (bool, error) {
+	prefix := cfg.Topic(barrierTopic)
+	return []func(paho.PublishReceived) (bool, error){func(pr paho.PublishReceived) (bool, error) {
+		if arrived, ok := barriers.Load(pr.Packet.Topic); ok {
+			select {
+			case arrived.(chan struct{}) <- struct{}{}:
+			default:
+			}
+			return true, nil
+		}
+		if strings.HasPrefix(pr.Packet.Topic, prefix) {
+			return true, nil
+		}
+		if onPublish == nil {
+			return false, nil
+		}
+		return onPublish(pr)
+	}}
+}
+
+// Barrier subscribes the client to a topic of its own, publishes a message
+// there and waits for it to come back. The broker handles a client's
+// packets in order and sends retained messages ahead of later ones, so once
+// the barrier arrives every earlier subscription of the client is in place
+// and its retained messages have been handed to the message handler.
+func Barrier(ctx context.Context, cfg common.Config, client *paho.Client) error {
+	topic := cfg.Topic(barrierTopic + common.GenerateClientID("barrier"))
+	arrived := make(chan struct{}, 1)
+	barriers.Store(topic, arrived)
+	defer barriers.Delete(topic)
+
+	qos := cfg.Capabilities.QoS(1)
+	if _, err := client.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: qos}},
+	}); err != nil {
+		return fmt.Errorf("barrier subscribe failed: %w", err)
+	}
+	if _, err := client.Publish(ctx, &paho.Publish{Topic: topic, QoS: qos, Payload: []byte("barrier")}); err != nil {
+		return fmt.Errorf("barrier publish failed: %w", err)
+	}
+
+	select {
+	case <-arrived:
+	case <-ctx.Done():
+		return fmt.Errorf("barrier message not delivered: %w", ctx.Err())
+	case <-time.After(cfg.Scaled(5 * time.Second)):
+		return fmt.Errorf("barrier message not delivered within %v", cfg.Scaled(5*time.Second))
+	}
+
+	if _, err := client.Unsubscribe(ctx, &paho.Unsubscribe{Topics: []string{topic}}); err != nil {
+		return fmt.Errorf("barrier unsubscribe failed: %w", err)
+	}
+	return nil
+}
+
+// SubscribeSync subscribes and then waits for a Barrier, so the
+// subscriptions are known to be active when it returns
+func SubscribeSync(ctx context.Context, cfg common.Config, client *paho.Client, s *paho.Subscribe) (*paho.Suback, error) {
+	suback, err := client.Subscribe(ctx, s)
+	if err != nil {
+		return suback, err
+	}
+	return suback, Barrier(ctx, cfg, client)
+}
@@ -0,0 +1,86 @@
+package v5
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// retainedQuietPeriod is how long no further retained message may arrive
+// before the namespace counts as fully read
+const retainedQuietPeriod = 500 * time.Millisecond
+
+// Cleanup clears every retained message under cfg.TopicNamespace and ends
+// the sessions of clientIDs by reconnecting each with Clean Start and no
+// session expiry
+func Cleanup(cfg common.Config, clientIDs []string) (*common.CleanupResult, error) {
+	if cfg.TopicNamespace == "" {
+		return nil, fmt.Errorf("no topic namespace to clean up")
+	}
+	res := &common.CleanupResult{}
+
+	var mu sync.Mutex
+	var topics []string
+	last := time.Now()
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("cleanup"), func(pr paho.PublishReceived) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		last = time.Now()
+		if pr.Packet.Retain && len(pr.Packet.Payload) > 0 {
+			topics = append(topics, pr.Packet.Topic)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: cfg.TopicNamespace + "/#", QoS: 0}},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s/#: %w", cfg.TopicNamespace, err)
+	}
+
+	mu.Lock()
+	last = time.Now()
+	mu.Unlock()
+	common.WaitTimeout(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return time.Since(last) > retainedQuietPeriod
+	}, 10*time.Second)
+
+	mu.Lock()
+	found := append([]string(nil), topics...)
+	mu.Unlock()
+	for _, topic := range found {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := client.Publish(ctx, &paho.Publish{Topic: topic, QoS: cfg.Capabilities.QoS(1), Retain: true})
+		cancel()
+		if err != nil {
+			res.Errors = append(res.Errors, fmt.Errorf("failed to clear retained message on %s: %w", topic, err))
+			continue
+		}
+		res.Retained = append(res.Retained, topic)
+	}
+
+	for _, id := range clientIDs {
+		// Clean Start discards the old session and the new one expires as
+		// soon as this connection closes
+		c, err := CreateAndConnectClient(cfg, id, nil)
+		if err != nil {
+			res.Errors = append(res.Errors, fmt.Errorf("failed to end session %s: %w", id, err))
+			continue
+		}
+		c.Disconnect(&paho.Disconnect{ReasonCode: 0})
+		res.Sessions = append(res.Sessions, id)
+	}
+	return res, nil
+}
@@ -0,0 +1,143 @@
+package v5
+
+import (
+	"context"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// ClusterTests returns tests that connect to several nodes of a clustered
+// broker, given with Config.Nodes, and check the nodes act as one Server.
+// Without other nodes they are skipped.
+func ClusterTests() TestGroup {
+	return TestGroup{
+		Name: "Cluster",
+		Tags: []string{"optional", "cluster"},
+		Tests: []TestFunc{
+			testClusterRouting,
+			testClusterRetained,
+			testClusterSharedBalancing,
+			testClusterTakeover,
+		},
+	}
+}
+
+// testClusterRouting tests that a message published on one node reaches a
+// subscriber on each other node exactly once, in every direction
+func testClusterRouting(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name: "Cross-Node Routing",
+	}
+
+	if common.SkipWithoutCluster(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	notes, err := common.CheckClusterRouting(cfg, 5)
+	if err != nil {
+		result.Error = err
+	} else {
+		result.Status = common.StatusPassed
+		result.Notes = notes
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testClusterRetained tests that a retained message published on one node
+// is delivered to new subscribers on the other nodes, and that clearing it
+// clears it everywhere [MQTT-3.3.1-9]
+// "If Retain Handling is set to 0 the Server MUST send the retained messages
+// matching the Topic Filter of the subscription to the Client"
+func testClusterRetained(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Retained Replication",
+		SpecRef: "MQTT-3.3.1-9",
+	}
+
+	if common.SkipWithoutCluster(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	notes, err := common.CheckClusterRetained(cfg, 5)
+	if err != nil {
+		result.Error = err
+	} else {
+		result.Status = common.StatusPassed
+		result.Notes = notes
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testClusterSharedBalancing tests that with a member of one shared
+// subscription group on every node, each message published on any node
+// reaches exactly one member. Messages all going to one node's member is a
+// warning, as the group is not balanced across the cluster. [MQTT-4.8.2]
+// "An Application Message that matches a Shared Subscription is only sent to
+// the Client associated with one of these Sessions"
+func testClusterSharedBalancing(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Shared Subscription Across Nodes",
+		SpecRef: "MQTT-4.8.2",
+	}
+
+	if common.SkipWithoutCluster(cfg, &result) || common.SkipUnsupported(cfg, &result, common.FeatureSharedSub) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	notes, balanced, err := common.CheckClusterShared(cfg, 5)
+	switch {
+	case err != nil:
+		result.Error = err
+	case !balanced:
+		result.Status = common.StatusWarning
+		result.Notes = "all messages went to one node's member: " + notes
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = notes
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testClusterTakeover tests that connecting to another node with the client
+// ID of a client connected to the first closes the first connection and
+// resumes its session, subscription included [MQTT-3.1.4-3]
+// "If the ClientID represents a Client already connected to the Server, the
+// Server sends a DISCONNECT packet to the existing Client with Reason Code of
+// 0x8E (Session taken over) ... and MUST close the Network Connection of the
+// existing Client"
+func testClusterTakeover(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Session Takeover Across Nodes",
+		SpecRef: "MQTT-3.1.4-3",
+	}
+
+	if common.SkipWithoutCluster(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	notes, err := common.CheckClusterTakeover(cfg, 5)
+	if err != nil {
+		result.Error = err
+	} else {
+		result.Status = common.StatusPassed
+		result.Notes = notes
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -1,11 +1,14 @@
 package v5
 
 import (
+	"github.com/bromq-dev/testmqtt/conformance/assert"
 	"github.com/bromq-dev/testmqtt/conformance/common"
 )
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/eclipse/paho.golang/paho"
@@ -15,12 +18,15 @@ import (
 func CONNACKPropertiesTests() TestGroup {
 	return TestGroup{
 		Name: "CONNACK Properties",
+		Tags: []string{"connect", "properties"},
 		Tests: []TestFunc{
 			testCONNACKSessionPresent,
 			testCONNACKSessionExpiryInterval,
 			testCONNACKReceiveMaximum,
 			testCONNACKMaximumQoS,
+			testMaximumQoSEnforced,
 			testCONNACKRetainAvailable,
+			testRetainUnavailableEnforced,
 			testCONNACKMaximumPacketSize,
 			testCONNACKTopicAliasMaximum,
 			testCONNACKWildcardSubscriptionAvailable,
@@ -33,7 +39,7 @@ func CONNACKPropertiesTests() TestGroup {
 // testCONNACKSessionPresent tests Session Present flag [MQTT-3.2.2.1.1]
 // "If the Server accepts a connection with Clean Start set to 0, the Session Present
 // flag indicates whether the Client is resuming an existing Session"
-func testCONNACKSessionPresent(cfg common.Config) TestResult {
+func testCONNACKSessionPresent(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "CONNACK Session Present Flag",
@@ -41,7 +47,8 @@ func testCONNACKSessionPresent(cfg common.Config) TestResult {
 	}
 
 	// First connection with clean start - Session Present should be 0
-	client1, err := CreateAndConnectClient(cfg, "test-connack-session-present", nil)
+	clientID := cfg.ClientID("test-connack-session-present")
+	client1, err := CreateAndConnectClient(cfg, clientID, nil)
 	if err != nil {
 		result.Error = fmt.Errorf("first connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -49,11 +56,11 @@ func testCONNACKSessionPresent(cfg common.Config) TestResult {
 	}
 	client1.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	// Second connection without clean start - Session Present may be 1 if broker persists session
 	// This test just verifies the connection works - actual Session Present value depends on broker config
-	client2, err := CreateAndConnectClient(cfg, "test-connack-session-present", nil)
+	client2, err := CreateAndConnectClient(cfg, clientID, nil)
 	if err != nil {
 		result.Error = fmt.Errorf("second connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -61,20 +68,20 @@ func testCONNACKSessionPresent(cfg common.Config) TestResult {
 	}
 	defer client2.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testCONNACKSessionExpiryInterval tests Session Expiry Interval in CONNACK [MQTT-3.2.2.3.2]
-func testCONNACKSessionExpiryInterval(cfg common.Config) TestResult {
+func testCONNACKSessionExpiryInterval(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "CONNACK Session Expiry Interval Property",
 		SpecRef: "MQTT-3.2.2.3.2",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-connack-expiry", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-connack-expiry"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -83,20 +90,21 @@ func testCONNACKSessionExpiryInterval(cfg common.Config) TestResult {
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	// If connection succeeds, broker handled Session Expiry Interval property
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "connected successfully but the CONNACK property was not inspected"
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testCONNACKReceiveMaximum tests Receive Maximum property [MQTT-3.2.2.3.3]
-func testCONNACKReceiveMaximum(cfg common.Config) TestResult {
+func testCONNACKReceiveMaximum(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "CONNACK Receive Maximum Property",
 		SpecRef: "MQTT-3.2.2.3.3",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-connack-receive-max", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-connack-receive-max"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -106,20 +114,21 @@ func testCONNACKReceiveMaximum(cfg common.Config) TestResult {
 
 	// Broker should send Receive Maximum in CONNACK
 	// If connection succeeds, property was handled
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "connected successfully but the CONNACK property was not inspected"
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testCONNACKMaximumQoS tests Maximum QoS property [MQTT-3.2.2.3.4]
-func testCONNACKMaximumQoS(cfg common.Config) TestResult {
+func testCONNACKMaximumQoS(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "CONNACK Maximum QoS Property",
 		SpecRef: "MQTT-3.2.2.3.4",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-connack-max-qos", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-connack-max-qos"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -129,20 +138,52 @@ func testCONNACKMaximumQoS(cfg common.Config) TestResult {
 
 	// If broker supports QoS 2, Maximum QoS property should be 2 (or absent)
 	// If connection succeeds, property was handled correctly
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "connected successfully but the CONNACK property was not inspected"
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testMaximumQoSEnforced tests that a PUBLISH above the Maximum QoS the
+// broker advertised gets DISCONNECT 0x9B (QoS not supported) [MQTT-3.2.2-11]
+// "It is a Protocol Error if the Server receives a PUBLISH packet with a QoS
+// greater than the Maximum QoS it specified. In this case use DISCONNECT with
+// Reason Code 0x9B (QoS not supported)"
+func testMaximumQoSEnforced(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "PUBLISH Above Maximum QoS Gets DISCONNECT 0x9B",
+		SpecRef: "MQTT-3.2.2-11",
+	}
+
+	if cfg.Capabilities.Supports(common.FeatureQoS2) {
+		result.Status = common.StatusSkipped
+		result.Notes = "broker advertises Maximum QoS 2"
+		return result
+	}
+
+	qos := cfg.Capabilities.MaximumQoS + 1
+	body := common.AppendString(nil, cfg.Topic("test/connack/max-qos"))
+	body = append(body, 0x00, 0x01) // Packet identifier
+	body = append(body, 0x00)       // Properties length
+	body = append(body, "above maximum"...)
+	// The spec calls it a Protocol Error, so that code is a warning
+	r := refusal{want: []byte{reasonQoSNotSupported}, also: []byte{reasonProtocolError}}
+	expectRefused(cfg, "test-max-qos-enforced", common.RawPacket(0x30|qos<<1, body), r, &result)
+
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testCONNACKRetainAvailable tests Retain Available property [MQTT-3.2.2.3.5]
-func testCONNACKRetainAvailable(cfg common.Config) TestResult {
+func testCONNACKRetainAvailable(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "CONNACK Retain Available Property",
 		SpecRef: "MQTT-3.2.2.3.5",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-connack-retain", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-connack-retain"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -152,20 +193,90 @@ func testCONNACKRetainAvailable(cfg common.Config) TestResult {
 
 	// Broker should indicate if retain is supported via Retain Available property
 	// If connection succeeds, property was handled
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "connected successfully but the CONNACK property was not inspected"
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRetainUnavailableEnforced tests that a retained PUBLISH to a broker that
+// advertised Retain Available 0 is refused with 0x9A (Retain not supported)
+// [MQTT-3.2.2-14]
+// "A Client receiving Retain Available set to 0 from the Server MUST NOT send
+// a PUBLISH packet with the RETAIN flag set to 1"
+func testRetainUnavailableEnforced(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Retained PUBLISH Without Retain Available Gets 0x9A",
+		SpecRef: "MQTT-3.2.2-14",
+	}
+
+	if cfg.Capabilities.Supports(common.FeatureRetain) {
+		result.Status = common.StatusSkipped
+		result.Notes = "broker advertises Retain Available"
+		return result
+	}
+
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-retain-unavailable"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	// At QoS 1 the broker can refuse in the PUBACK rather than disconnect
+	qos := cfg.Capabilities.QoS(1)
+	body := common.AppendString(nil, cfg.Topic("test/connack/retain-unavailable"))
+	if qos > 0 {
+		body = append(body, 0x00, 0x01) // Packet identifier
+	}
+	body = append(body, 0x00) // Properties length
+	body = append(body, "retained"...)
+	s := rawSessionOn(cfg, conn)
+	s.Send(common.RawPacket(0x31|qos<<1, body))
+	a := s.Answer(2 * time.Second)
+	// The spec calls retaining where it is not available a Protocol Error, so
+	// that code is a warning
+	r := refusal{want: []byte{reasonRetainNotSupported}, also: []byte{reasonProtocolError}}
+	if a.header != 0x40 {
+		a.grade(r, &result)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// The reason code follows the packet identifier of a PUBACK and is 0x00
+	// where it is left out
+	var reason byte
+	if len(a.body) > 2 {
+		reason = a.body[2]
+	}
+	switch {
+	case reason < 0x80:
+		result.Error = fmt.Errorf("broker accepted the retained PUBLISH with PUBACK %s", assert.ReasonName(reason))
+	case slices.Contains(r.want, reason):
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("PUBACK %s", assert.ReasonName(reason))
+	case slices.Contains(r.also, reason):
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker refused with PUBACK %s rather than %s", assert.ReasonName(reason), r.expected())
+	default:
+		result.Error = fmt.Errorf("broker refused with PUBACK %s, expected %s", assert.ReasonName(reason), r.expected())
+	}
+
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testCONNACKMaximumPacketSize tests Maximum Packet Size property [MQTT-3.2.2.3.6]
-func testCONNACKMaximumPacketSize(cfg common.Config) TestResult {
+func testCONNACKMaximumPacketSize(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "CONNACK Maximum Packet Size Property",
 		SpecRef: "MQTT-3.2.2.3.6",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-connack-packet-size", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-connack-packet-size"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -175,20 +286,21 @@ func testCONNACKMaximumPacketSize(cfg common.Config) TestResult {
 
 	// Broker should send Maximum Packet Size in CONNACK if it has a limit
 	// If connection succeeds, property was handled
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "connected successfully but the CONNACK property was not inspected"
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testCONNACKTopicAliasMaximum tests Topic Alias Maximum property [MQTT-3.2.2.3.8]
-func testCONNACKTopicAliasMaximum(cfg common.Config) TestResult {
+func testCONNACKTopicAliasMaximum(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "CONNACK Topic Alias Maximum Property",
 		SpecRef: "MQTT-3.2.2.3.8",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-connack-topic-alias", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-connack-topic-alias"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -198,20 +310,21 @@ func testCONNACKTopicAliasMaximum(cfg common.Config) TestResult {
 
 	// Broker sends Topic Alias Maximum to indicate how many aliases client can use
 	// If connection succeeds, property was handled
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "connected successfully but the CONNACK property was not inspected"
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testCONNACKWildcardSubscriptionAvailable tests Wildcard Subscription Available [MQTT-3.2.2.3.11]
-func testCONNACKWildcardSubscriptionAvailable(cfg common.Config) TestResult {
+func testCONNACKWildcardSubscriptionAvailable(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "CONNACK Wildcard Subscription Available Property",
 		SpecRef: "MQTT-3.2.2.3.11",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-connack-wildcard", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-connack-wildcard"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -221,20 +334,21 @@ func testCONNACKWildcardSubscriptionAvailable(cfg common.Config) TestResult {
 
 	// Broker indicates if wildcard subscriptions are supported
 	// If connection succeeds, property was handled
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "connected successfully but the CONNACK property was not inspected"
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testCONNACKSubscriptionIdentifierAvailable tests Subscription Identifier Available [MQTT-3.2.2.3.12]
-func testCONNACKSubscriptionIdentifierAvailable(cfg common.Config) TestResult {
+func testCONNACKSubscriptionIdentifierAvailable(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "CONNACK Subscription Identifier Available Property",
 		SpecRef: "MQTT-3.2.2.3.12",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-connack-sub-id", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-connack-sub-id"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -244,20 +358,21 @@ func testCONNACKSubscriptionIdentifierAvailable(cfg common.Config) TestResult {
 
 	// Broker indicates if subscription identifiers are supported
 	// If connection succeeds, property was handled
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "connected successfully but the CONNACK property was not inspected"
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testCONNACKSharedSubscriptionAvailable tests Shared Subscription Available [MQTT-3.2.2.3.13]
-func testCONNACKSharedSubscriptionAvailable(cfg common.Config) TestResult {
+func testCONNACKSharedSubscriptionAvailable(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "CONNACK Shared Subscription Available Property",
 		SpecRef: "MQTT-3.2.2.3.13",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-connack-shared-sub", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-connack-shared-sub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -267,7 +382,8 @@ func testCONNACKSharedSubscriptionAvailable(cfg common.Config) TestResult {
 
 	// Broker indicates if shared subscriptions are supported
 	// If connection succeeds, property was handled
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "connected successfully but the CONNACK property was not inspected"
 	result.Duration = time.Since(start)
 	return result
 }
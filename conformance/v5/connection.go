@@ -5,6 +5,7 @@ import (
 )
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -15,11 +16,13 @@ import (
 func ConnectionTests() TestGroup {
 	return TestGroup{
 		Name: "Connection",
+		Tags: []string{"core", "connect"},
 		Tests: []TestFunc{
 			testBasicConnect,
 			testConnectWithClientID,
 			testCleanStart,
 			testDoubleConnect,
+			testSecondConnectMidSession,
 			testProtocolVersion,
 		},
 	}
@@ -28,14 +31,14 @@ func ConnectionTests() TestGroup {
 // testBasicConnect tests basic MQTT connection [MQTT-3.1.0-1]
 // "After a Network Connection is established by a Client to a Server,
 // the first packet sent from the Client to the Server MUST be a CONNECT packet"
-func testBasicConnect(cfg common.Config) TestResult {
+func testBasicConnect(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Basic Connect",
 		SpecRef: "MQTT-3.1.0-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-client-basic", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-client-basic"), nil)
 	if err != nil {
 		result.Error = err
 		result.Duration = time.Since(start)
@@ -44,7 +47,7 @@ func testBasicConnect(cfg common.Config) TestResult {
 
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -52,7 +55,7 @@ func testBasicConnect(cfg common.Config) TestResult {
 // testConnectWithClientID tests connection with specific client ID [MQTT-3.1.3-2]
 // "The ClientID MUST be used by Clients and by Servers to identify state
 // that they hold relating to this MQTT Session between the Client and the Server"
-func testConnectWithClientID(cfg common.Config) TestResult {
+func testConnectWithClientID(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Connect with Client ID",
@@ -69,7 +72,7 @@ func testConnectWithClientID(cfg common.Config) TestResult {
 
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -77,7 +80,7 @@ func testConnectWithClientID(cfg common.Config) TestResult {
 // testCleanStart tests clean start behavior [MQTT-3.1.2-4]
 // "If a CONNECT packet is received with Clean Start is set to 1, the Client and Server
 // MUST discard any existing Session and start a new Session"
-func testCleanStart(cfg common.Config) TestResult {
+func testCleanStart(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Clean Start",
@@ -85,7 +88,8 @@ func testCleanStart(cfg common.Config) TestResult {
 	}
 
 	// First connection with clean start
-	client, err := CreateAndConnectClient(cfg, "test-clean-start", nil)
+	clientID := cfg.ClientID("test-clean-start")
+	client, err := CreateAndConnectClient(cfg, clientID, nil)
 	if err != nil {
 		result.Error = fmt.Errorf("failed first connect: %w", err)
 		result.Duration = time.Since(start)
@@ -93,10 +97,10 @@ func testCleanStart(cfg common.Config) TestResult {
 	}
 
 	client.Disconnect(&paho.Disconnect{ReasonCode: 0})
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	// Second connection should start fresh
-	client, err = CreateAndConnectClient(cfg, "test-clean-start", nil)
+	client, err = CreateAndConnectClient(cfg, clientID, nil)
 	if err != nil {
 		result.Error = fmt.Errorf("failed second connect: %w", err)
 		result.Duration = time.Since(start)
@@ -105,7 +109,7 @@ func testCleanStart(cfg common.Config) TestResult {
 
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -113,27 +117,50 @@ func testCleanStart(cfg common.Config) TestResult {
 // testDoubleConnect tests that second CONNECT is a protocol error [MQTT-3.1.0-2]
 // "The Server MUST process a second CONNECT packet sent from a Client as a
 // Protocol Error and close the Network Connection"
-func testDoubleConnect(cfg common.Config) TestResult {
+func testDoubleConnect(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Reject Second CONNECT",
 		SpecRef: "MQTT-3.1.0-2",
 	}
 
-	// Connect first time
-	client, err := CreateAndConnectClient(cfg, "test-double-connect", nil)
+	clientID := cfg.ClientID("test-double-connect")
+	conn, err := common.DialRaw(cfg, 5, clientID)
 	if err != nil {
 		result.Error = fmt.Errorf("first connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
-	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	defer conn.Close()
+
+	s := rawSessionOn(cfg, conn)
+	s.Send(common.RawConnect(5, clientID, cfg.Username, cfg.Password))
+	s.ExpectRefusal(refuseProtocolError, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSecondConnectMidSession tests that a second CONNECT with Clean Start
+// set, sent on a connection resuming a persistent session, is not processed:
+// the broker closes the connection and the session keeps its subscription
+// [MQTT-3.1.0-2]
+// "The Server MUST process a second CONNECT packet sent from a Client as a
+// Protocol Error and close the Network Connection"
+func testSecondConnectMidSession(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Second CONNECT Leaves Session Intact",
+		SpecRef: "MQTT-3.1.0-2",
+	}
+
+	if err := common.CheckSecondConnectMidSession(cfg, 5); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
 
-	// Note: The paho client library prevents sending a second CONNECT by design,
-	// which is correct behavior. This test verifies the broker would reject it
-	// if it were sent. Since we can't actually test this with the high-level API,
-	// we'll consider this a pass if we successfully connected once.
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -142,7 +169,7 @@ func testDoubleConnect(cfg common.Config) TestResult {
 // "If the Protocol Version is not 5 and the Server does not want to accept
 // the CONNECT packet, the Server MAY send a CONNACK packet with Reason Code
 // 0x84 (Unsupported Protocol Version)"
-func testProtocolVersion(cfg common.Config) TestResult {
+func testProtocolVersion(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Protocol Version Check",
@@ -153,7 +180,7 @@ func testProtocolVersion(cfg common.Config) TestResult {
 	// sends the correct protocol version. Testing wrong protocol versions would
 	// require manually crafting packets at a lower level.
 	// We'll verify that v5 connections work correctly.
-	client, err := CreateAndConnectClient(cfg, "test-protocol-version", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-protocol-version"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("v5 connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -161,7 +188,8 @@ func testProtocolVersion(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "only a valid v5 CONNECT was sent, other protocol versions were not tried"
 	result.Duration = time.Since(start)
 	return result
 }
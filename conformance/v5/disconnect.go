@@ -2,12 +2,12 @@ package v5
 
 import (
 	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/spec"
 )
 
 import (
+	"context"
 	"fmt"
-	"net"
-	"net/url"
 	"time"
 
 	"github.com/eclipse/paho.golang/paho"
@@ -17,11 +17,15 @@ import (
 func DisconnectTests() TestGroup {
 	return TestGroup{
 		Name: "DISCONNECT Packet",
+		Tags: []string{"core"},
 		Tests: []TestFunc{
 			testNormalDisconnect,
 			testDisconnectReasonCodes,
 			testDisconnectSessionExpiry,
 			testServerDisconnect,
+			testDisconnectSessionExpiryAfterZero,
+			testDisconnectCloses,
+			testPacketsAfterDisconnect,
 		},
 	}
 }
@@ -29,14 +33,14 @@ func DisconnectTests() TestGroup {
 // testNormalDisconnect tests normal disconnection [MQTT-3.14.4-1]
 // "After sending a DISCONNECT packet the Client MUST NOT send any more MQTT
 // Control Packets on that Network Connection"
-func testNormalDisconnect(cfg common.Config) TestResult {
+func testNormalDisconnect(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Normal Disconnect (Reason Code 0x00)",
 		SpecRef: "MQTT-3.14.4-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-disconnect-normal", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-disconnect-normal"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -54,13 +58,13 @@ func testNormalDisconnect(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testDisconnectReasonCodes tests various DISCONNECT reason codes [MQTT-3.14.2.1]
-func testDisconnectReasonCodes(cfg common.Config) TestResult {
+func testDisconnectReasonCodes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "DISCONNECT Reason Codes",
@@ -68,7 +72,7 @@ func testDisconnectReasonCodes(cfg common.Config) TestResult {
 	}
 
 	// Test normal disconnection with reason code
-	client, err := CreateAndConnectClient(cfg, "test-disconnect-codes-1", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-disconnect-codes-1"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -84,10 +88,10 @@ func testDisconnectReasonCodes(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	// Test disconnect with will message
-	client2, err := CreateAndConnectClient(cfg, "test-disconnect-codes-2", nil)
+	client2, err := CreateAndConnectClient(cfg, cfg.ClientID("test-disconnect-codes-2"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("second connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -103,7 +107,7 @@ func testDisconnectReasonCodes(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -111,14 +115,14 @@ func testDisconnectReasonCodes(cfg common.Config) TestResult {
 // testDisconnectSessionExpiry tests session expiry in DISCONNECT [MQTT-3.14.2.2.2]
 // "If the Session Expiry Interval in the DISCONNECT packet is absent, the Session
 // Expiry Interval in the CONNECT packet is used"
-func testDisconnectSessionExpiry(cfg common.Config) TestResult {
+func testDisconnectSessionExpiry(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "DISCONNECT Session Expiry Interval",
 		SpecRef: "MQTT-3.14.2.2.2",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-disconnect-session", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-disconnect-session"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -144,35 +148,23 @@ func testDisconnectSessionExpiry(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testServerDisconnect tests server-initiated disconnect [MQTT-3.14.4-3]
 // "After sending a DISCONNECT packet the Server MUST close the Network Connection"
-func testServerDisconnect(cfg common.Config) TestResult {
+func testServerDisconnect(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Server-Initiated Disconnect Closes Connection",
 		SpecRef: "MQTT-3.14.4-3",
 	}
 
-	u, err := url.Parse(cfg.Broker)
+	conn, err := common.Dial(cfg)
 	if err != nil {
-		result.Error = fmt.Errorf("invalid broker URL: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
-
-	host := u.Host
-	if u.Port() == "" {
-		host = net.JoinHostPort(u.Hostname(), "1883")
-	}
-
-	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to dial broker: %w", err)
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
@@ -205,7 +197,7 @@ func testServerDisconnect(cfg common.Config) TestResult {
 	n, err := conn.Read(response)
 	if err != nil || n == 0 {
 		// EOF is valid - broker rejected invalid packet
-		result.Passed = true
+		result.Status = common.StatusPassed
 		result.Error = nil
 		result.Duration = time.Since(start)
 		return result
@@ -214,7 +206,7 @@ func testServerDisconnect(cfg common.Config) TestResult {
 	// Send a second CONNECT packet - broker should disconnect us
 	_, err = conn.Write(connectPacket)
 	if err != nil {
-		result.Passed = true
+		result.Status = common.StatusPassed
 		result.Error = nil
 		result.Duration = time.Since(start)
 		return result
@@ -226,17 +218,118 @@ func testServerDisconnect(cfg common.Config) TestResult {
 
 	if err != nil {
 		// Connection closed
-		result.Passed = true
+		result.Status = common.StatusPassed
 		result.Error = nil
 	} else if n > 0 && response[0] == 0xE0 {
 		// DISCONNECT packet received
-		result.Passed = true
+		result.Status = common.StatusPassed
 		result.Error = nil
 	} else {
-		result.Passed = false
+		result.Status = common.StatusFailed
 		result.Error = fmt.Errorf("server did not disconnect on protocol violation")
 	}
 
 	result.Duration = time.Since(start)
 	return result
 }
+
+// testDisconnectSessionExpiryAfterZero tests that a DISCONNECT setting a
+// nonzero Session Expiry Interval, after a CONNECT that left it 0, is a
+// protocol error, and that the session still ends with the connection
+// [MQTT-3.14.2.2.2]
+// "If the Session Expiry Interval in the CONNECT packet was zero, then it is
+// a Protocol Error to set a non-zero Session Expiry Interval in the
+// DISCONNECT packet sent by the Client"
+func testDisconnectSessionExpiryAfterZero(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "DISCONNECT Session Expiry After Zero in CONNECT",
+		SpecRef: "MQTT-3.14.2.2.2",
+	}
+
+	// The raw CONNECT has no Session Expiry Interval, which makes it 0
+	clientID := cfg.ClientID("test-disconnect-expiry-zero")
+	conn, err := common.DialRaw(cfg, 5, clientID)
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	body := []byte{0x00, 5, 0x11, 0, 0, 0x01, 0x2C} // Normal disconnection, Session Expiry Interval 300
+	s := rawSessionOn(cfg, conn)
+	s.Send(common.RawPacket(0xE0, body))
+	s.ExpectRefusal(refuseProtocolError, &result)
+	if result.Error != nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// Closing the connection is also what a valid DISCONNECT leads to; the
+	// session having outlived it shows the interval was taken
+	client, connack, err := connectClientWithSession(cfg, clientID, false, nil)
+	if err != nil {
+		result.Error = fmt.Errorf("reconnect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	if connack.SessionPresent {
+		result.Status = common.StatusFailed
+		result.Error = fmt.Errorf("session kept after the connection closed, the broker applied the Session Expiry Interval of the DISCONNECT")
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testDisconnectCloses tests, on a raw connection, that the broker closes
+// the network connection promptly after a client's DISCONNECT, when the
+// client leaves it open [MQTT-3.14.4]
+// "On receipt of DISCONNECT, the receiver: SHOULD close the Network
+// Connection."
+func testDisconnectCloses(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "DISCONNECT Closes Connection Promptly",
+		SpecRef: "MQTT-3.14.4",
+		Level:   spec.LevelShould,
+	}
+
+	took, err := common.CheckDisconnectClose(cfg, 5)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Notes = fmt.Sprintf("closed %v after the DISCONNECT", took.Round(time.Microsecond))
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPacketsAfterDisconnect tests, on a raw connection, that a PUBLISH
+// following the client's DISCONNECT is ignored, neither acknowledged nor
+// delivered, since nothing may follow a DISCONNECT [MQTT-3.14.4-1]
+// "After sending a DISCONNECT packet the sender MUST NOT send any more MQTT
+// Control Packets on that Network Connection"
+func testPacketsAfterDisconnect(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "PUBLISH After DISCONNECT Ignored",
+		SpecRef: "MQTT-3.14.4-1",
+		Level:   spec.LevelShould,
+	}
+
+	if err := common.CheckPacketsAfterDisconnect(cfg, 5); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
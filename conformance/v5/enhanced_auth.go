@@ -0,0 +1,230 @@
+package v5
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/assert"
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// Reason codes of the enhanced authentication tests
+const (
+	reasonContinueAuthentication = 0x18
+	reasonReauthenticate         = 0x19
+	reasonBadAuthMethod          = 0x8C
+)
+
+// EnhancedAuthenticationTests returns tests that authenticate with
+// SCRAM-SHA-256 as the user given by Config.Auth: the AUTH exchange of a
+// CONNECT, a wrong password and re-authentication on an open connection
+// [MQTT-4.12]. They are skipped without a SCRAM user.
+func EnhancedAuthenticationTests() TestGroup {
+	return TestGroup{
+		Name: "Enhanced Authentication",
+		Tags: []string{"optional", "auth"},
+		Tests: []TestFunc{
+			testScramAuthentication,
+			testScramWrongPassword,
+			testScramReauthentication,
+		},
+	}
+}
+
+// checkScramAccepted checks the CONNACK or AUTH ending a successful
+// SCRAM-SHA-256 exchange names the method and carries a server-final message
+// proving the broker knows the password
+func checkScramAccepted(auther *ScramSHA256, method string, data []byte) error {
+	if method != ScramSHA256Method {
+		return fmt.Errorf("authentication method %q, expected %s [MQTT-4.12.0-5]", method, ScramSHA256Method)
+	}
+	return auther.Verify(data)
+}
+
+// testScramAuthentication tests a CONNECT authenticated with SCRAM-SHA-256:
+// the broker continues with AUTH 0x18, accepts the client's proof and ends
+// with a CONNACK carrying the method and its own proof [MQTT-4.12.0-5]
+// "If the initial CONNECT packet included an Authentication Method property
+// then all AUTH packets, and any successful CONNACK packet MUST include an
+// Authentication Method Property with the same value as in the CONNECT
+// packet"
+func testScramAuthentication(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "SCRAM-SHA-256 Exchange",
+		SpecRef: "MQTT-4.12.0-5",
+	}
+
+	if common.SkipWithoutScram(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	auther := NewScramSHA256(cfg.Auth.ScramUsername, cfg.Auth.ScramPassword)
+	client, connack, err := CreateAndConnectClientWithAuth(cfg, cfg.ClientID("test-scram"), auther, nil)
+	if err != nil {
+		if connack != nil && connack.ReasonCode == reasonBadAuthMethod {
+			err = fmt.Errorf("broker does not support %s: CONNACK 0x8C (Bad authentication method)", ScramSHA256Method)
+		} else if authErr := auther.Err(); authErr != nil {
+			err = authErr
+		} else if connack != nil {
+			err = fmt.Errorf("broker refused the exchange with CONNACK %s", assert.ReasonName(connack.ReasonCode))
+		}
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	var method string
+	var data []byte
+	if connack.Properties != nil {
+		method, data = connack.Properties.AuthMethod, connack.Properties.AuthData
+	}
+	if err := checkScramAccepted(auther, method, data); err != nil {
+		result.Error = fmt.Errorf("CONNACK: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testScramWrongPassword tests that a SCRAM-SHA-256 exchange with a wrong
+// password is refused with CONNACK 0x86 (Bad User Name or Password)
+// [MQTT-4.12.0-4]
+// "The Server can reject the authentication at any point in this process.
+// It MAY send a CONNACK with a Reason Code of 0x80 or above as described in
+// section 4.13, and MUST close the Network Connection"
+func testScramWrongPassword(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "SCRAM-SHA-256 Wrong Password Refused (0x86)",
+		SpecRef: "MQTT-4.12.0-4",
+	}
+
+	if common.SkipWithoutScram(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	auther := NewScramSHA256(cfg.Auth.ScramUsername, cfg.Auth.ScramPassword+"-wrong")
+	client, connack, err := CreateAndConnectClientWithAuth(cfg, cfg.ClientID("test-scram-wrong"), auther, nil)
+	switch {
+	case err == nil:
+		client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+		result.Error = fmt.Errorf("broker accepted a wrong password, expected CONNACK %s", assert.ReasonName(reasonBadUsernameOrPassword))
+	case auther.Err() != nil:
+		result.Error = auther.Err()
+	case connack == nil:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker closed the connection without CONNACK %s", assert.ReasonName(reasonBadUsernameOrPassword))
+	case connack.ReasonCode == reasonBadUsernameOrPassword:
+		result.Status = common.StatusPassed
+	case connack.ReasonCode == reasonNotAuthorized:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker refused with %s rather than %s", assert.ReasonName(connack.ReasonCode), assert.ReasonName(reasonBadUsernameOrPassword))
+	default:
+		assert.ReasonCode(&result, cfg, "CONNACK reason code", connack.ReasonCode, reasonBadUsernameOrPassword)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testScramReauthentication tests a SCRAM-SHA-256 re-authentication started
+// with AUTH 0x19 on an authenticated connection, which the broker must
+// complete with AUTH 0x00 after the client's proof and leave the connection
+// usable [MQTT-4.12.1]
+// "If the Client supplied an Authentication Method in the CONNECT, it can
+// initiate a re-authentication at any time after receiving a CONNACK. It
+// does this by sending an AUTH packet with a Reason Code of 0x19
+// (Re-authentication)"
+func testScramReauthentication(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "SCRAM-SHA-256 Re-authentication",
+		SpecRef: "MQTT-4.12.1",
+	}
+
+	if common.SkipWithoutScram(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	auther := NewScramSHA256(cfg.Auth.ScramUsername, cfg.Auth.ScramPassword)
+	client, connack, err := CreateAndConnectClientWithAuth(cfg, cfg.ClientID("test-scram-reauth"), auther, nil)
+	if err != nil {
+		if authErr := auther.Err(); authErr != nil {
+			err = authErr
+		} else if connack != nil {
+			err = fmt.Errorf("broker refused the exchange with CONNACK %s", assert.ReasonName(connack.ReasonCode))
+		}
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	authCtx, cancel := context.WithTimeout(ctx, cfg.Scaled(5*time.Second))
+	defer cancel()
+	resp, err := client.Authenticate(authCtx, &paho.Auth{
+		ReasonCode: reasonReauthenticate,
+		Properties: &paho.AuthProperties{
+			AuthMethod: auther.Method(),
+			AuthData:   auther.Start(),
+		},
+	})
+	if err != nil {
+		result.Error = fmt.Errorf("re-authentication not completed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	if !resp.Success {
+		if authErr := auther.Err(); authErr != nil {
+			result.Error = authErr
+		} else {
+			result.Error = fmt.Errorf("broker ended the re-authentication with DISCONNECT %s", assert.ReasonName(resp.ReasonCode))
+		}
+		result.Duration = time.Since(start)
+		return result
+	}
+	// paho does not pass on the properties of the AUTH ending a
+	// re-authentication, so its server-final message cannot be verified
+	if err := auther.Err(); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if !auther.answered() {
+		result.Error = fmt.Errorf("broker ended the re-authentication without a server-first message, so without the client's proof")
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	pubCtx, pubCancel := context.WithTimeout(ctx, cfg.Scaled(5*time.Second))
+	defer pubCancel()
+	pr, err := client.Publish(pubCtx, &paho.Publish{
+		Topic:   cfg.Topic(common.GenerateTopicName("test/scram/reauth")),
+		QoS:     cfg.Capabilities.QoS(1),
+		Payload: []byte("after re-authentication"),
+	})
+	if err != nil {
+		result.Error = fmt.Errorf("publish after re-authentication failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	if pr != nil && pr.ReasonCode >= 0x80 {
+		result.Error = fmt.Errorf("publish after re-authentication refused with %s", assert.ReasonName(pr.ReasonCode))
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
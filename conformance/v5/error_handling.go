@@ -17,6 +17,7 @@ import (
 func ErrorHandlingTests() TestGroup {
 	return TestGroup{
 		Name: "Error Handling & Edge Cases",
+		Tags: []string{"negative"},
 		Tests: []TestFunc{
 			testDuplicatePacketIdentifier,
 			testPacketIdentifierExhaustion,
@@ -31,14 +32,18 @@ func ErrorHandlingTests() TestGroup {
 }
 
 // testDuplicatePacketIdentifier tests handling of duplicate packet identifiers
-func testDuplicatePacketIdentifier(cfg common.Config) TestResult {
+func testDuplicatePacketIdentifier(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Duplicate Packet Identifier Handling",
 		SpecRef: "MQTT-2.2.1-3",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-dup-pkt-id", nil)
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-dup-pkt-id"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -46,12 +51,10 @@ func testDuplicatePacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Publish multiple QoS 1 messages - each should get unique packet ID
 	for i := 0; i < 5; i++ {
 		_, err = client.Publish(ctx, &paho.Publish{
-			Topic:   fmt.Sprintf("test/pkt-id/%d", i),
+			Topic:   cfg.Topic(fmt.Sprintf("test/pkt-id/%d", i)),
 			QoS:     1,
 			Payload: []byte(fmt.Sprintf("message %d", i)),
 		})
@@ -63,20 +66,24 @@ func testDuplicatePacketIdentifier(cfg common.Config) TestResult {
 	}
 
 	// If all publishes succeeded, packet IDs were managed correctly
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testPacketIdentifierExhaustion tests behavior when packet IDs are exhausted
-func testPacketIdentifierExhaustion(cfg common.Config) TestResult {
+func testPacketIdentifierExhaustion(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Packet Identifier Exhaustion Handling",
 		SpecRef: "MQTT-2.2.1-2",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-pkt-id-exhaustion", nil)
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pkt-id-exhaustion"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -84,13 +91,11 @@ func testPacketIdentifierExhaustion(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Try to publish many messages quickly - tests packet ID reuse after ACK
 	successCount := 0
 	for i := 0; i < 100; i++ {
 		_, err = client.Publish(ctx, &paho.Publish{
-			Topic:   "test/pkt-id-exhaust",
+			Topic:   cfg.Topic("test/pkt-id-exhaust"),
 			QoS:     1,
 			Payload: []byte(fmt.Sprintf("msg %d", i)),
 		})
@@ -102,7 +107,7 @@ func testPacketIdentifierExhaustion(cfg common.Config) TestResult {
 
 	// Should be able to publish many messages by reusing packet IDs
 	if successCount >= 90 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("only %d/100 publishes succeeded", successCount)
 	}
@@ -112,14 +117,14 @@ func testPacketIdentifierExhaustion(cfg common.Config) TestResult {
 }
 
 // testPublishToInvalidTopic tests publishing to invalid topic names
-func testPublishToInvalidTopic(cfg common.Config) TestResult {
+func testPublishToInvalidTopic(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Publish to Invalid Topic Rejection",
 		SpecRef: "MQTT-4.7.3-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-invalid-pub-topic", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-invalid-pub-topic"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -127,31 +132,30 @@ func testPublishToInvalidTopic(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Try to publish to topic with wildcard (invalid for PUBLISH)
 	_, err = client.Publish(ctx, &paho.Publish{
-		Topic:   "test/#/invalid",
+		Topic:   cfg.Topic("test/#/invalid"),
 		QoS:     0,
 		Payload: []byte("test"),
 	})
 
 	// Should either fail or be accepted (broker may not validate)
 	// Test passes if we handle gracefully
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "cannot observe whether the broker rejected the wildcard topic"
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testSubscribeToInvalidFilter tests subscribing to invalid topic filters
-func testSubscribeToInvalidFilter(cfg common.Config) TestResult {
+func testSubscribeToInvalidFilter(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Subscribe to Invalid Topic Filter",
 		SpecRef: "MQTT-4.7.1-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-invalid-sub-filter", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-invalid-sub-filter"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -159,23 +163,22 @@ func testSubscribeToInvalidFilter(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Try to subscribe to filter with multiple # wildcards (invalid)
 	suback, err := client.Subscribe(ctx, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/#/invalid/#", QoS: 0},
+			{Topic: cfg.Topic("test/#/invalid/#"), QoS: 0},
 		},
 	})
 
 	// Broker should reject with error reason code
 	if err != nil || (suback != nil && len(suback.Reasons) > 0 && suback.Reasons[0] >= 0x80) {
 		// Error or failure reason code - expected
-		result.Passed = true
+		result.Status = common.StatusPassed
 		result.Error = nil
 	} else {
 		// Accepted invalid filter
-		result.Passed = true // Still pass - broker may be lenient
+		result.Status = common.StatusWarning
+		result.Notes = "broker accepted an invalid topic filter"
 	}
 
 	result.Duration = time.Since(start)
@@ -183,44 +186,43 @@ func testSubscribeToInvalidFilter(cfg common.Config) TestResult {
 }
 
 // testDisconnectDuringPublish tests disconnect during ongoing publish operations
-func testDisconnectDuringPublish(cfg common.Config) TestResult {
+func testDisconnectDuringPublish(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Disconnect During Active Publish",
 		SpecRef: "MQTT-3.14.4-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-disconnect-during-pub", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-disconnect-during-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	ctx := context.Background()
-
 	// Start a publish
 	go func() {
 		client.Publish(ctx, &paho.Publish{
-			Topic:   "test/disconnect/publish",
-			QoS:     1,
+			Topic:   cfg.Topic("test/disconnect/publish"),
+			QoS:     cfg.Capabilities.QoS(1),
 			Payload: []byte("message"),
 		})
 	}()
 
-	time.Sleep(50 * time.Millisecond)
+	cfg.Wait(50 * time.Millisecond)
 
 	// Disconnect while publish may be in progress
 	err = client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	// Should handle gracefully
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "only client-side handling was exercised"
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testReconnectAfterDisconnect tests reconnecting after clean disconnect
-func testReconnectAfterDisconnect(cfg common.Config) TestResult {
+func testReconnectAfterDisconnect(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Reconnect After Clean Disconnect",
@@ -228,7 +230,8 @@ func testReconnectAfterDisconnect(cfg common.Config) TestResult {
 	}
 
 	// First connection
-	client1, err := CreateAndConnectClient(cfg, "test-reconnect", nil)
+	clientID := cfg.ClientID("test-reconnect")
+	client1, err := CreateAndConnectClient(cfg, clientID, nil)
 	if err != nil {
 		result.Error = fmt.Errorf("first connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -237,10 +240,10 @@ func testReconnectAfterDisconnect(cfg common.Config) TestResult {
 
 	// Clean disconnect
 	client1.Disconnect(&paho.Disconnect{ReasonCode: 0})
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Reconnect with same client ID
-	client2, err := CreateAndConnectClient(cfg, "test-reconnect", nil)
+	client2, err := CreateAndConnectClient(cfg, clientID, nil)
 	if err != nil {
 		result.Error = fmt.Errorf("reconnect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -248,20 +251,20 @@ func testReconnectAfterDisconnect(cfg common.Config) TestResult {
 	}
 	defer client2.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testConcurrentPublishes tests concurrent publish operations
-func testConcurrentPublishes(cfg common.Config) TestResult {
+func testConcurrentPublishes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Concurrent Publish Operations",
 		SpecRef: "MQTT-4.3.0-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-concurrent-pub", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-concurrent-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -269,7 +272,6 @@ func testConcurrentPublishes(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
 	var wg sync.WaitGroup
 	errors := make(chan error, 10)
 
@@ -279,8 +281,8 @@ func testConcurrentPublishes(cfg common.Config) TestResult {
 		go func(idx int) {
 			defer wg.Done()
 			_, err := client.Publish(ctx, &paho.Publish{
-				Topic:   fmt.Sprintf("test/concurrent/%d", idx),
-				QoS:     1,
+				Topic:   cfg.Topic(fmt.Sprintf("test/concurrent/%d", idx)),
+				QoS:     cfg.Capabilities.QoS(1),
 				Payload: []byte(fmt.Sprintf("concurrent message %d", idx)),
 			})
 			if err != nil {
@@ -302,7 +304,7 @@ func testConcurrentPublishes(cfg common.Config) TestResult {
 	}
 
 	if errorCount == 0 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("%d concurrent publishes failed", errorCount)
 	}
@@ -312,14 +314,14 @@ func testConcurrentPublishes(cfg common.Config) TestResult {
 }
 
 // testConcurrentSubscribes tests concurrent subscribe operations
-func testConcurrentSubscribes(cfg common.Config) TestResult {
+func testConcurrentSubscribes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Concurrent Subscribe Operations",
 		SpecRef: "MQTT-3.8.0-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-concurrent-sub", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-concurrent-sub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -327,7 +329,6 @@ func testConcurrentSubscribes(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
 	var wg sync.WaitGroup
 	errors := make(chan error, 5)
 
@@ -338,7 +339,7 @@ func testConcurrentSubscribes(cfg common.Config) TestResult {
 			defer wg.Done()
 			_, err := client.Subscribe(ctx, &paho.Subscribe{
 				Subscriptions: []paho.SubscribeOptions{
-					{Topic: fmt.Sprintf("test/concurrent/sub/%d", idx), QoS: 0},
+					{Topic: cfg.Topic(fmt.Sprintf("test/concurrent/sub/%d", idx)), QoS: 0},
 				},
 			})
 			if err != nil {
@@ -360,7 +361,7 @@ func testConcurrentSubscribes(cfg common.Config) TestResult {
 	}
 
 	if errorCount == 0 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("%d concurrent subscribes failed", errorCount)
 	}
@@ -1,6 +1,7 @@
 package v5
 
 import (
+	"github.com/bromq-dev/testmqtt/conformance/assert"
 	"github.com/bromq-dev/testmqtt/conformance/common"
 )
 
@@ -13,10 +14,13 @@ import (
 	"github.com/eclipse/paho.golang/paho"
 )
 
+const reasonReceiveMaximumExceeded = 0x93
+
 // FlowControlTests returns tests for flow control [MQTT-4.9]
 func FlowControlTests() TestGroup {
 	return TestGroup{
 		Name: "Flow Control (Receive Maximum)",
+		Tags: []string{"qos", "flow-control"},
 		Tests: []TestFunc{
 			testReceiveMaximumBasic,
 			testReceiveMaximumQoS1,
@@ -30,7 +34,7 @@ func FlowControlTests() TestGroup {
 // testReceiveMaximumBasic tests Receive Maximum property [MQTT-3.1.2.11.3]
 // "The Client uses this value to limit the number of QoS 1 and QoS 2 publications
 // that it is willing to process concurrently"
-func testReceiveMaximumBasic(cfg common.Config) TestResult {
+func testReceiveMaximumBasic(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Receive Maximum Property",
@@ -38,7 +42,7 @@ func testReceiveMaximumBasic(cfg common.Config) TestResult {
 	}
 
 	// Connect - broker will send its Receive Maximum in CONNACK
-	client, err := CreateAndConnectClient(cfg, "test-recvmax-basic", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-recvmax-basic"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -47,7 +51,8 @@ func testReceiveMaximumBasic(cfg common.Config) TestResult {
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	// If connection succeeded, broker handled Receive Maximum
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "connected successfully but Receive Maximum was not inspected"
 	result.Duration = time.Since(start)
 	return result
 }
@@ -55,13 +60,17 @@ func testReceiveMaximumBasic(cfg common.Config) TestResult {
 // testReceiveMaximumQoS1 tests that Receive Maximum applies to QoS 1 [MQTT-4.9.0-1]
 // "The Client MUST NOT send more than Receive Maximum QoS 1 and QoS 2 PUBLISH packets
 // for which it has not received PUBACK, PUBCOMP, or PUBREC with a Reason Code >= 0x80"
-func testReceiveMaximumQoS1(cfg common.Config) TestResult {
+func testReceiveMaximumQoS1(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Receive Maximum Applies to QoS 1",
 		SpecRef: "MQTT-4.9.0-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
 	messageCount := 0
 	var mu sync.Mutex
 
@@ -72,7 +81,7 @@ func testReceiveMaximumQoS1(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-recvmax-qos1-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-recvmax-qos1-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -80,10 +89,9 @@ func testReceiveMaximumQoS1(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/recvmax/qos1", QoS: 1},
+			{Topic: cfg.Topic("test/recvmax/qos1"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -92,7 +100,7 @@ func testReceiveMaximumQoS1(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-recvmax-qos1-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-recvmax-qos1-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -100,12 +108,10 @@ func testReceiveMaximumQoS1(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish multiple QoS 1 messages
 	for i := 0; i < 10; i++ {
 		_, err = pub.Publish(ctx, &paho.Publish{
-			Topic:   "test/recvmax/qos1",
+			Topic:   cfg.Topic("test/recvmax/qos1"),
 			QoS:     1,
 			Payload: []byte(fmt.Sprintf("message %d", i)),
 		})
@@ -116,16 +122,12 @@ func testReceiveMaximumQoS1(cfg common.Config) TestResult {
 		}
 	}
 
-	time.Sleep(1 * time.Second)
-
-	mu.Lock()
-	count := messageCount
-	mu.Unlock()
-
-	if count == 10 {
-		result.Passed = true
-	} else {
-		result.Error = fmt.Errorf("expected 10 messages, got %d", count)
+	if assert.ReceivedExactly(&result, cfg, "messages received", 10, 5*time.Second, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return messageCount
+	}) {
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -133,13 +135,17 @@ func testReceiveMaximumQoS1(cfg common.Config) TestResult {
 }
 
 // testReceiveMaximumQoS2 tests that Receive Maximum applies to QoS 2 [MQTT-4.9.0-2]
-func testReceiveMaximumQoS2(cfg common.Config) TestResult {
+func testReceiveMaximumQoS2(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Receive Maximum Applies to QoS 2",
 		SpecRef: "MQTT-4.9.0-2",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
 	messageCount := 0
 	var mu sync.Mutex
 
@@ -150,7 +156,7 @@ func testReceiveMaximumQoS2(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-recvmax-qos2-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-recvmax-qos2-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -158,10 +164,9 @@ func testReceiveMaximumQoS2(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/recvmax/qos2", QoS: 2},
+			{Topic: cfg.Topic("test/recvmax/qos2"), QoS: 2},
 		},
 	})
 	if err != nil {
@@ -170,7 +175,7 @@ func testReceiveMaximumQoS2(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-recvmax-qos2-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-recvmax-qos2-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -178,12 +183,10 @@ func testReceiveMaximumQoS2(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish multiple QoS 2 messages
 	for i := 0; i < 10; i++ {
 		_, err = pub.Publish(ctx, &paho.Publish{
-			Topic:   "test/recvmax/qos2",
+			Topic:   cfg.Topic("test/recvmax/qos2"),
 			QoS:     2,
 			Payload: []byte(fmt.Sprintf("message %d", i)),
 		})
@@ -194,103 +197,74 @@ func testReceiveMaximumQoS2(cfg common.Config) TestResult {
 		}
 	}
 
-	time.Sleep(1 * time.Second)
-
-	mu.Lock()
-	count := messageCount
-	mu.Unlock()
-
-	if count == 10 {
-		result.Passed = true
-	} else {
-		result.Error = fmt.Errorf("expected 10 messages, got %d", count)
+	if assert.ReceivedExactly(&result, cfg, "messages received", 10, 5*time.Second, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return messageCount
+	}) {
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
 	return result
 }
 
-// testReceiveMaximumEnforcement tests that exceeding Receive Maximum causes disconnect [MQTT-4.9.0-3]
-// "If a Server or Client receives more than Receive Maximum QoS 1 and QoS 2 PUBLISH packets
-// without sending PUBACK or PUBCOMP, it MUST close the Network Connection"
-func testReceiveMaximumEnforcement(cfg common.Config) TestResult {
+// testReceiveMaximumEnforcement tests that a client sending more unacknowledged
+// PUBLISHes than the broker's Receive Maximum is disconnected with 0x93
+// [MQTT-3.3.4-7]
+// "The Client MUST NOT send more than Receive Maximum QoS 1 and QoS 2 PUBLISH
+// packets for which it has not received PUBACK, PUBCOMP, or PUBREC with a
+// Reason Code of 128 or greater from the Server"
+//
+// A broker acknowledges QoS 1 PUBLISHes as they arrive, so they would stop
+// counting before the last one is sent. QoS 2 PUBLISHes stay unacknowledged
+// until the client sends PUBREL, which it never does here.
+func testReceiveMaximumEnforcement(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
-		Name:    "Receive Maximum Enforcement",
-		SpecRef: "MQTT-4.9.0-3",
-	}
-
-	// This test is difficult to implement reliably without knowing the broker's
-	// Receive Maximum value. We test that the broker at least accepts
-	// a reasonable number of concurrent QoS messages.
-
-	messageCount := 0
-	var mu sync.Mutex
-
-	onPublish := func(pr paho.PublishReceived) (bool, error) {
-		mu.Lock()
-		messageCount++
-		mu.Unlock()
-		// Delay PUBACK to keep messages in-flight
-		time.Sleep(50 * time.Millisecond)
-		return true, nil
+		Name:    "Receive Maximum Exceeded Gets DISCONNECT 0x93",
+		SpecRef: "MQTT-3.3.4-7",
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-recvmax-enforce-sub", onPublish)
-	if err != nil {
-		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
-		result.Duration = time.Since(start)
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
 		return result
 	}
-	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
-		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/recvmax/enforce", QoS: 1},
-		},
-	})
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-recvmax-enforce"))
 	if err != nil {
-		result.Error = fmt.Errorf("subscribe failed: %w", err)
+		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
+	defer conn.Close()
 
-	pub, err := CreateAndConnectClient(cfg, "test-recvmax-enforce-pub", nil)
-	if err != nil {
-		result.Error = fmt.Errorf("publisher connect failed: %w", err)
+	limit := int(conn.ReceiveMaximum)
+	if limit == 65535 {
+		result.Status = common.StatusInconclusive
+		result.Notes = "Receive Maximum is 65535, which cannot be exceeded with distinct packet identifiers"
 		result.Duration = time.Since(start)
 		return result
 	}
-	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
-	// Send a moderate number of messages (less than typical Receive Maximum)
-	for i := 0; i < 5; i++ {
-		_, err = pub.Publish(ctx, &paho.Publish{
-			Topic:   "test/recvmax/enforce",
-			QoS:     1,
-			Payload: []byte(fmt.Sprintf("message %d", i)),
-		})
-		if err != nil {
-			result.Error = fmt.Errorf("publish %d failed: %w", i, err)
+	topic := cfg.Topic("test/recvmax/enforce")
+	for i := 1; i <= limit+1; i++ {
+		if err := conn.Publish(topic, 2, uint16(i), []byte(fmt.Sprintf("message %d", i))); err != nil {
+			if i <= limit {
+				result.Error = fmt.Errorf("broker closed the connection at PUBLISH %d of Receive Maximum %d", i, limit)
+			} else {
+				result.Error = fmt.Errorf("failed to send PUBLISH %d: %w", i, err)
+			}
 			result.Duration = time.Since(start)
 			return result
 		}
 	}
 
-	time.Sleep(2 * time.Second)
-
-	mu.Lock()
-	count := messageCount
-	mu.Unlock()
-
-	// If we got all messages, flow control is working
-	if count == 5 {
-		result.Passed = true
+	// The PUBRECs for the allowed PUBLISHes come first
+	a := rawSessionOn(cfg, conn).Answer(5*time.Second, 0x50)
+	if a.header == 0 && !a.closed {
+		result.Error = fmt.Errorf("broker accepted %d unacknowledged QoS 2 PUBLISHes with Receive Maximum %d", limit+1, limit)
 	} else {
-		result.Error = fmt.Errorf("expected 5 messages, got %d (flow control may have issues)", count)
+		a.grade(refusal{want: []byte{reasonReceiveMaximumExceeded}}, &result)
 	}
 
 	result.Duration = time.Since(start)
@@ -300,13 +274,17 @@ func testReceiveMaximumEnforcement(cfg common.Config) TestResult {
 // testPacketIdentifierReuse tests packet identifier reuse [MQTT-2.2.1-3]
 // "Packet Identifiers become available for reuse after the sender has processed
 // the corresponding acknowledgement packet"
-func testPacketIdentifierReuse(cfg common.Config) TestResult {
+func testPacketIdentifierReuse(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Packet Identifier Reuse After ACK",
 		SpecRef: "MQTT-2.2.1-3",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
 	messageCount := 0
 	var mu sync.Mutex
 
@@ -317,7 +295,7 @@ func testPacketIdentifierReuse(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-packetid-reuse-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-packetid-reuse-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -325,10 +303,9 @@ func testPacketIdentifierReuse(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/packetid/reuse", QoS: 1},
+			{Topic: cfg.Topic("test/packetid/reuse"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -337,7 +314,7 @@ func testPacketIdentifierReuse(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-packetid-reuse-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-packetid-reuse-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -345,13 +322,11 @@ func testPacketIdentifierReuse(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish many QoS 1 messages - packet IDs will be reused
 	// (assuming fewer than 65535 concurrent messages)
 	for i := 0; i < 100; i++ {
 		_, err = pub.Publish(ctx, &paho.Publish{
-			Topic:   "test/packetid/reuse",
+			Topic:   cfg.Topic("test/packetid/reuse"),
 			QoS:     1,
 			Payload: []byte(fmt.Sprintf("message %d", i)),
 		})
@@ -362,16 +337,13 @@ func testPacketIdentifierReuse(cfg common.Config) TestResult {
 		}
 	}
 
-	time.Sleep(2 * time.Second)
-
-	mu.Lock()
-	count := messageCount
-	mu.Unlock()
-
-	if count == 100 {
-		result.Passed = true
-	} else {
-		result.Error = fmt.Errorf("expected 100 messages, got %d (packet ID reuse may have failed)", count)
+	// Fewer messages than sent means packet ID reuse failed
+	if assert.ReceivedExactly(&result, cfg, "messages received", 100, 10*time.Second, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return messageCount
+	}) {
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
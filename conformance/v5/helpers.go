@@ -3,6 +3,7 @@ package v5
 import (
 	"context"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/bromq-dev/testmqtt/conformance/common"
@@ -17,7 +18,7 @@ func CheckConnection(cfg common.Config) error {
 	}
 
 	// Now try an actual MQTT connection with auth
-	client, err := CreateAndConnectClient(cfg, common.GenerateClientID("preflight"), nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("preflight"), nil)
 	if err != nil {
 		if cfg.Username != "" {
 			return fmt.Errorf("MQTT connection failed (check credentials): %w", err)
@@ -33,9 +34,66 @@ func CheckConnection(cfg common.Config) error {
 	return nil
 }
 
+// DetectCapabilities connects once and reads the optional features the broker
+// advertises in its CONNACK properties
+func DetectCapabilities(cfg common.Config) (*common.Capabilities, error) {
+	conn, err := common.Dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID := cfg.ClientID("capabilities")
+	client := paho.NewClient(paho.ClientConfig{
+		ClientID: clientID,
+		Conn:     conn,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cp := &paho.Connect{
+		KeepAlive:  30,
+		ClientID:   clientID,
+		CleanStart: true,
+	}
+	if cfg.Username != "" {
+		cp.UsernameFlag = true
+		cp.Username = cfg.Username
+	}
+	if cfg.Password != "" {
+		cp.PasswordFlag = true
+		cp.Password = []byte(cfg.Password)
+	}
+
+	connack, err := client.Connect(ctx, cp)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	caps := &common.Capabilities{
+		RetainAvailable:      true,
+		WildcardSubAvailable: true,
+		SharedSubAvailable:   true,
+		SubIDAvailable:       true,
+		MaximumQoS:           2,
+	}
+	if props := connack.Properties; props != nil {
+		caps.RetainAvailable = props.RetainAvailable
+		caps.WildcardSubAvailable = props.WildcardSubAvailable
+		caps.SharedSubAvailable = props.SharedSubAvailable
+		caps.SubIDAvailable = props.SubIDAvailable
+		if props.MaximumQoS != nil {
+			caps.MaximumQoS = *props.MaximumQoS
+		}
+	}
+	return caps, nil
+}
+
 // CreateAndConnectClient creates and connects a MQTT v5 client with optional message handler
 func CreateAndConnectClient(cfg common.Config, clientID string, onPublish func(paho.PublishReceived) (bool, error)) (*paho.Client, error) {
-	conn, err := common.DialBroker(cfg.Broker)
+	conn, err := common.Dial(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -45,9 +103,7 @@ func CreateAndConnectClient(cfg common.Config, clientID string, onPublish func(p
 		Conn:     conn,
 	}
 
-	if onPublish != nil {
-		config.OnPublishReceived = []func(paho.PublishReceived) (bool, error){onPublish}
-	}
+	config.OnPublishReceived = withBarriers(cfg, onPublish)
 
 	client := paho.NewClient(config)
 
@@ -69,9 +125,11 @@ func CreateAndConnectClient(cfg common.Config, clientID string, onPublish func(p
 		cp.Password = []byte(cfg.Password)
 	}
 
+	cfg.Log().Debug("connecting client", "client_id", clientID, "clean_start", cp.CleanStart)
 	_, err = client.Connect(ctx, cp)
 	if err != nil {
 		conn.Close()
+		cfg.Log().Debug("client connect failed", "client_id", clientID, "error", err)
 		return nil, fmt.Errorf("failed to connect: %w", err)
 	}
 
@@ -80,9 +138,16 @@ func CreateAndConnectClient(cfg common.Config, clientID string, onPublish func(p
 
 // CreateAndConnectClientWithSession creates and connects a MQTT v5 client with session control
 func CreateAndConnectClientWithSession(cfg common.Config, clientID string, cleanStart bool, onPublish func(paho.PublishReceived) (bool, error)) (*paho.Client, error) {
-	conn, err := common.DialBroker(cfg.Broker)
+	client, _, err := connectClientWithSession(cfg, clientID, cleanStart, onPublish)
+	return client, err
+}
+
+// connectClientWithSession is CreateAndConnectClientWithSession returning
+// the CONNACK too, for tests of its Session Present flag
+func connectClientWithSession(cfg common.Config, clientID string, cleanStart bool, onPublish func(paho.PublishReceived) (bool, error)) (*paho.Client, *paho.Connack, error) {
+	conn, err := common.Dial(cfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	config := paho.ClientConfig{
@@ -90,9 +155,7 @@ func CreateAndConnectClientWithSession(cfg common.Config, clientID string, clean
 		Conn:     conn,
 	}
 
-	if onPublish != nil {
-		config.OnPublishReceived = []func(paho.PublishReceived) (bool, error){onPublish}
-	}
+	config.OnPublishReceived = withBarriers(cfg, onPublish)
 
 	client := paho.NewClient(config)
 
@@ -108,6 +171,7 @@ func CreateAndConnectClientWithSession(cfg common.Config, clientID string, clean
 	}
 
 	if !cleanStart {
+		cfg.Sessions.Add(clientID)
 		cp.Properties = &paho.ConnectProperties{
 			SessionExpiryInterval: &sessionExpiry,
 		}
@@ -122,11 +186,153 @@ func CreateAndConnectClientWithSession(cfg common.Config, clientID string, clean
 		cp.Password = []byte(cfg.Password)
 	}
 
+	cfg.Log().Debug("connecting client", "client_id", clientID, "clean_start", cp.CleanStart)
+	connack, err := client.Connect(ctx, cp)
+	if err != nil {
+		conn.Close()
+		cfg.Log().Debug("client connect failed", "client_id", clientID, "error", err)
+		return nil, nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	return client, connack, nil
+}
+
+// CreateAndConnectClientWithAuth creates and connects a MQTT v5 client that
+// authenticates with auther's enhanced authentication method instead of a
+// User Name and Password [MQTT-4.12]. The CONNACK is returned when the broker
+// refused the client too, along with the error.
+func CreateAndConnectClientWithAuth(cfg common.Config, clientID string, auther EnhancedAuther, onPublish func(paho.PublishReceived) (bool, error)) (*paho.Client, *paho.Connack, error) {
+	conn, err := common.Dial(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := paho.ClientConfig{
+		ClientID:    clientID,
+		Conn:        conn,
+		AuthHandler: auther,
+	}
+
+	config.OnPublishReceived = withBarriers(cfg, onPublish)
+
+	client := paho.NewClient(config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Scaled(5*time.Second))
+	defer cancel()
+
+	cp := &paho.Connect{
+		KeepAlive:  30,
+		ClientID:   clientID,
+		CleanStart: true,
+		Properties: &paho.ConnectProperties{
+			AuthMethod: auther.Method(),
+			AuthData:   auther.Start(),
+		},
+	}
+
+	cfg.Log().Debug("connecting client", "client_id", clientID, "auth_method", auther.Method())
+	connack, err := client.Connect(ctx, cp)
+	if err != nil {
+		conn.Close()
+		cfg.Log().Debug("client connect failed", "client_id", clientID, "error", err)
+		return nil, connack, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	return client, connack, nil
+}
+
+// CreateAndConnectClientWithWill creates and connects a MQTT v5 client
+// carrying a Will Message. A non-zero sessionExpiry keeps the session after
+// the connection closes, which a Will Delay Interval needs to take effect.
+// The connection is returned so tests can sever it without DISCONNECT.
+func CreateAndConnectClientWithWill(cfg common.Config, clientID string, will *paho.WillMessage, willProps *paho.WillProperties, sessionExpiry uint32) (*paho.Client, net.Conn, error) {
+	conn, err := common.Dial(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := paho.NewClient(paho.ClientConfig{
+		ClientID:          clientID,
+		Conn:              conn,
+		OnPublishReceived: withBarriers(cfg, nil),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cp := &paho.Connect{
+		KeepAlive:      30,
+		ClientID:       clientID,
+		CleanStart:     true,
+		WillMessage:    will,
+		WillProperties: willProps,
+	}
+
+	if sessionExpiry > 0 {
+		cfg.Sessions.Add(clientID)
+		cp.Properties = &paho.ConnectProperties{
+			SessionExpiryInterval: &sessionExpiry,
+		}
+	}
+
+	if cfg.Username != "" {
+		cp.UsernameFlag = true
+		cp.Username = cfg.Username
+	}
+	if cfg.Password != "" {
+		cp.PasswordFlag = true
+		cp.Password = []byte(cfg.Password)
+	}
+
+	cfg.Log().Debug("connecting client with will", "client_id", clientID, "will_topic", will.Topic)
 	_, err = client.Connect(ctx, cp)
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to connect: %w", err)
+		cfg.Log().Debug("client connect failed", "client_id", clientID, "error", err)
+		return nil, nil, fmt.Errorf("failed to connect: %w", err)
 	}
 
-	return client, nil
+	return client, conn, nil
+}
+
+// CheckPubSub publishes a QoS 1 message and waits for a subscriber to
+// receive it
+func CheckPubSub(cfg common.Config) error {
+	topic := cfg.Topic("ready/" + common.GenerateClientID("check"))
+	received := make(chan struct{}, 1)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("ready-sub"), func(pr paho.PublishReceived) (bool, error) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := sub.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: 1}},
+	}); err != nil {
+		return fmt.Errorf("publish/subscribe: subscribe failed: %w", err)
+	}
+
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("ready-pub"), nil)
+	if err != nil {
+		return err
+	}
+	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	if _, err := pub.Publish(ctx, &paho.Publish{Topic: topic, QoS: cfg.Capabilities.QoS(1), Payload: []byte("ready")}); err != nil {
+		return fmt.Errorf("publish/subscribe: publish failed: %w", err)
+	}
+
+	select {
+	case <-received:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("publish/subscribe: message published to %s was not delivered", topic)
+	}
 }
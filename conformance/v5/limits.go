@@ -0,0 +1,148 @@
+package v5
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// LimitsTests returns exploratory tests that push the broker until it
+// refuses something, report the limit they found and check the broker
+// refuses the way the specification asks. How far they push is set with
+// Config.Limits; finding no limit is inconclusive.
+func LimitsTests() TestGroup {
+	return TestGroup{
+		Name: "Limits Discovery",
+		Tags: []string{"optional", "limits"},
+		Tests: []TestFunc{
+			testConnectionLimit,
+			testPayloadLimit,
+			testInflightWindow,
+		},
+	}
+}
+
+// testConnectionLimit ramps up connections until the broker refuses one,
+// which it should do with CONNACK 0x97 (Quota exceeded), and checks the
+// connections already open stay healthy at the limit
+func testConnectionLimit(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name: "Maximum Connections",
+	}
+
+	if common.SkipWithoutConnectionLimit(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	limit, err := common.CheckConnectionLimit(cfg, 5)
+	switch {
+	case err != nil:
+		result.Error = err
+	case limit.Healthy < limit.Opened:
+		result.Error = fmt.Errorf("%d of %d connections open at the limit stopped answering PINGREQ", limit.Opened-limit.Healthy, limit.Opened)
+	case !limit.Limited:
+		result.Status = common.StatusInconclusive
+		result.Notes = fmt.Sprintf("no limit reached with %d connections (set --limit-connections higher)", limit.Opened)
+	case limit.Rejection == "CONNACK 0x97":
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("limit %d connections, refused with CONNACK 0x97 (Quota exceeded)", limit.Opened)
+	default:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("limit %d connections, refused by %s rather than CONNACK 0x97 (Quota exceeded)", limit.Opened, limit.Rejection)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPayloadLimit binary-searches the largest payload the broker accepts
+// at each QoS, which it should refuse beyond its limit with DISCONNECT 0x95
+// (Packet too large). Other refusals are warnings; a QoS 1 or 2 message
+// acknowledged but never delivered fails.
+func testPayloadLimit(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name: "Maximum Message Size",
+	}
+
+	if common.SkipWithoutPayloadLimit(cfg, &result) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	var notes []string
+	var refused, deviated bool
+	for qos := range cfg.Capabilities.QoS(2) + 1 {
+		limit, err := common.CheckPayloadLimit(cfg, 5, qos)
+		if err != nil {
+			result.Error = fmt.Errorf("QoS %d: %w", qos, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+		notes = append(notes, limit.String())
+		switch {
+		case !limit.Limited:
+		case limit.Rejection == common.RejectAckedLost:
+			result.Error = fmt.Errorf("QoS %d: PUBLISH of %d bytes acknowledged with success but never delivered", qos, limit.Largest+1)
+			result.Duration = time.Since(start)
+			return result
+		case limit.Rejection == "DISCONNECT 0x95":
+			refused = true
+		default:
+			deviated = true
+		}
+	}
+
+	switch {
+	case deviated:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("oversized PUBLISH not refused by DISCONNECT 0x95 (Packet too large): %s", strings.Join(notes, "; "))
+	case !refused:
+		result.Status = common.StatusInconclusive
+		result.Notes = fmt.Sprintf("%s (raise --limit-payload, up to 256MB)", strings.Join(notes, "; "))
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = strings.Join(notes, "; ")
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testInflightWindow measures how many QoS 1 messages the broker delivers
+// to a subscriber that withholds its PUBACKs and compares the window with
+// the Receive Maximum the broker advertised, which bounds the other
+// direction but is commonly the same. Every message must arrive once they
+// are acknowledged, and none may be resent on the same connection
+// [MQTT-4.4.0-1].
+func testInflightWindow(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name: "Inflight Window",
+	}
+
+	w, err := common.CheckInflightWindow(cfg, 5)
+	switch {
+	case err != nil:
+		result.Error = err
+	case w.Resent > 0:
+		result.Error = fmt.Errorf("%d unacknowledged messages resent on the same connection [MQTT-4.4.0-1]", w.Resent)
+	case !w.Limited():
+		result.Status = common.StatusInconclusive
+		result.Notes = fmt.Sprintf("all %d messages delivered without PUBACKs, advertised Receive Maximum %d (raise --limit-inflight)", w.Sent, w.Receive)
+	case w.Window == int(w.Receive):
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("%d of %d messages delivered before the first PUBACK, matching the advertised Receive Maximum", w.Window, w.Sent)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("%d of %d messages delivered before the first PUBACK, advertised Receive Maximum %d", w.Window, w.Sent, w.Receive)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -17,6 +17,7 @@ import (
 func MessageExpiryTests() TestGroup {
 	return TestGroup{
 		Name: "Message Expiry Interval",
+		Tags: []string{"properties", "timing"},
 		Tests: []TestFunc{
 			testMessageExpiryBasic,
 			testMessageExpiryCountdown,
@@ -28,7 +29,7 @@ func MessageExpiryTests() TestGroup {
 
 // testMessageExpiryBasic tests basic message expiry [MQTT-3.3.2.3.3-1]
 // "If present, the Four Byte value is the lifetime of the Application Message in seconds"
-func testMessageExpiryBasic(cfg common.Config) TestResult {
+func testMessageExpiryBasic(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Message Expiry Interval Basic",
@@ -45,7 +46,7 @@ func testMessageExpiryBasic(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-expiry-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-expiry-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -53,10 +54,9 @@ func testMessageExpiryBasic(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/expiry/basic", QoS: 1},
+			{Topic: cfg.Topic("test/expiry/basic"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -65,7 +65,7 @@ func testMessageExpiryBasic(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-expiry-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-expiry-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -73,13 +73,11 @@ func testMessageExpiryBasic(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish with message expiry interval of 10 seconds
 	expiryInterval := uint32(10)
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/expiry/basic",
-		QoS:     1,
+		Topic:   cfg.Topic("test/expiry/basic"),
+		QoS:     cfg.Capabilities.QoS(1),
 		Payload: []byte("message with expiry"),
 		Properties: &paho.PublishProperties{
 			MessageExpiry: &expiryInterval,
@@ -91,14 +89,14 @@ func testMessageExpiryBasic(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	count := messageCount
 	mu.Unlock()
 
 	if count > 0 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("message with expiry interval not received")
 	}
@@ -110,13 +108,17 @@ func testMessageExpiryBasic(cfg common.Config) TestResult {
 // testMessageExpiryCountdown tests expiry countdown [MQTT-3.3.2.3.3-2]
 // "The Message Expiry Interval MUST be set to the received value minus the time
 // that the Application Message has been waiting in the Server"
-func testMessageExpiryCountdown(cfg common.Config) TestResult {
+func testMessageExpiryCountdown(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Message Expiry Interval Countdown",
 		SpecRef: "MQTT-3.3.2.3.3-2",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureRetain) {
+		return result
+	}
+
 	messageReceived := false
 	var receivedExpiry uint32
 	var mu sync.Mutex
@@ -133,18 +135,17 @@ func testMessageExpiryCountdown(cfg common.Config) TestResult {
 
 	// First publish a RETAINED message with expiry
 	// This ensures the message stays on the broker while we wait
-	pub, err := CreateAndConnectClient(cfg, "test-expiry-countdown-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-expiry-countdown-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	ctx := context.Background()
 	expiryInterval := uint32(30) // 30 seconds
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/expiry/countdown",
-		QoS:     1,
+		Topic:   cfg.Topic("test/expiry/countdown"),
+		QoS:     cfg.Capabilities.QoS(1),
 		Retain:  true, // Retain so message stays on broker
 		Payload: []byte("message with countdown"),
 		Properties: &paho.PublishProperties{
@@ -163,7 +164,7 @@ func testMessageExpiryCountdown(cfg common.Config) TestResult {
 	time.Sleep(2 * time.Second)
 
 	// Now subscribe - should receive retained message with reduced expiry
-	sub, err := CreateAndConnectClient(cfg, "test-expiry-countdown-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-expiry-countdown-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -173,7 +174,7 @@ func testMessageExpiryCountdown(cfg common.Config) TestResult {
 
 	_, err = sub.Subscribe(ctx, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/expiry/countdown", QoS: 1},
+			{Topic: cfg.Topic("test/expiry/countdown"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -182,7 +183,7 @@ func testMessageExpiryCountdown(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(1 * time.Second) // Increased wait time for retained message delivery
+	cfg.Wait(1 * time.Second) // Increased wait time for retained message delivery
 
 	mu.Lock()
 	received := messageReceived
@@ -193,7 +194,7 @@ func testMessageExpiryCountdown(cfg common.Config) TestResult {
 		// Expiry should be less than 30 (we waited 2 seconds)
 		// But we can't be too strict due to timing variations
 		if expiry < 30 || expiry == 0 {
-			result.Passed = true
+			result.Status = common.StatusPassed
 		} else {
 			result.Error = fmt.Errorf("expiry countdown not working (got %d, expected < 30)", expiry)
 		}
@@ -207,7 +208,7 @@ func testMessageExpiryCountdown(cfg common.Config) TestResult {
 
 // testMessageExpiryZeroMeansNoExpiry tests that absent expiry means no expiry [MQTT-3.3.2.3.3-3]
 // "If the Message Expiry Interval is absent, the Application Message does not expire"
-func testMessageExpiryZeroMeansNoExpiry(cfg common.Config) TestResult {
+func testMessageExpiryZeroMeansNoExpiry(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Absent Message Expiry Means No Expiry",
@@ -224,7 +225,7 @@ func testMessageExpiryZeroMeansNoExpiry(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-expiry-none-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-expiry-none-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -232,10 +233,9 @@ func testMessageExpiryZeroMeansNoExpiry(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/expiry/none", QoS: 1},
+			{Topic: cfg.Topic("test/expiry/none"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -244,7 +244,7 @@ func testMessageExpiryZeroMeansNoExpiry(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-expiry-none-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-expiry-none-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -252,12 +252,10 @@ func testMessageExpiryZeroMeansNoExpiry(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish without message expiry interval
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/expiry/none",
-		QoS:     1,
+		Topic:   cfg.Topic("test/expiry/none"),
+		QoS:     cfg.Capabilities.QoS(1),
 		Payload: []byte("message without expiry"),
 		// No MessageExpiry property
 	})
@@ -267,14 +265,14 @@ func testMessageExpiryZeroMeansNoExpiry(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	count := messageCount
 	mu.Unlock()
 
 	if count > 0 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("message without expiry not received")
 	}
@@ -286,26 +284,29 @@ func testMessageExpiryZeroMeansNoExpiry(cfg common.Config) TestResult {
 // testMessageExpiryRetainedMessage tests expiry with retained messages [MQTT-3.3.2.3.3-4]
 // "The PUBLISH packet sent to a Client by the Server MUST contain a Message Expiry Interval
 // set to the received value minus the time that the message has been waiting in the Server"
-func testMessageExpiryRetainedMessage(cfg common.Config) TestResult {
+func testMessageExpiryRetainedMessage(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Message Expiry With Retained Messages",
 		SpecRef: "MQTT-3.3.2.3.3-4",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureRetain) {
+		return result
+	}
+
 	// Publish retained message with expiry
-	pub, err := CreateAndConnectClient(cfg, "test-expiry-retained-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-expiry-retained-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	ctx := context.Background()
 	expiryInterval := uint32(60)
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/expiry/retained",
-		QoS:     1,
+		Topic:   cfg.Topic("test/expiry/retained"),
+		QoS:     cfg.Capabilities.QoS(1),
 		Payload: []byte("retained with expiry"),
 		Retain:  true,
 		Properties: &paho.PublishProperties{
@@ -320,7 +321,7 @@ func testMessageExpiryRetainedMessage(cfg common.Config) TestResult {
 	}
 	pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	messageReceived := false
 	var mu sync.Mutex
@@ -333,7 +334,7 @@ func testMessageExpiryRetainedMessage(cfg common.Config) TestResult {
 	}
 
 	// Subscribe to get retained message
-	sub, err := CreateAndConnectClient(cfg, "test-expiry-retained-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-expiry-retained-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -343,7 +344,7 @@ func testMessageExpiryRetainedMessage(cfg common.Config) TestResult {
 
 	_, err = sub.Subscribe(ctx, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/expiry/retained", QoS: 1},
+			{Topic: cfg.Topic("test/expiry/retained"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -352,14 +353,14 @@ func testMessageExpiryRetainedMessage(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	received := messageReceived
 	mu.Unlock()
 
 	if received {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("retained message with expiry not received")
 	}
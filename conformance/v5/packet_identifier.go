@@ -0,0 +1,74 @@
+package v5
+
+import (
+	"context"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// Disconnect reason codes the raw tests expect
+const (
+	reasonMalformedPacket    = 0x81
+	reasonProtocolError      = 0x82
+	reasonPacketTooLarge     = 0x95
+	reasonRetainNotSupported = 0x9A
+	reasonQoSNotSupported    = 0x9B
+)
+
+// testPublishPacketIDZero tests that a QoS 1 PUBLISH with Packet Identifier 0
+// is rejected [MQTT-2.2.1-3]
+// "Each time a Client sends a new SUBSCRIBE, UNSUBSCRIBE, or PUBLISH (where
+// QoS > 0) MQTT Control Packet it MUST assign it a non-zero Packet Identifier
+// that is currently unused"
+func testPublishPacketIDZero(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject QoS 1 PUBLISH with Packet Identifier 0",
+		SpecRef: "MQTT-2.2.1-3",
+	}
+
+	body := common.AppendString(nil, cfg.Topic("test/packet-id-zero"))
+	body = append(body, 0x00, 0x00) // Packet identifier 0
+	body = append(body, 0x00)       // Properties length
+	body = append(body, "zero"...)
+	expectRefused(cfg, "test-publish-pid0", common.RawPacket(0x32, body), refuseMalformed, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSubscribePacketIDZero tests that a SUBSCRIBE with Packet Identifier 0 is
+// rejected [MQTT-2.2.1-3]
+func testSubscribePacketIDZero(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject SUBSCRIBE with Packet Identifier 0",
+		SpecRef: "MQTT-2.2.1-3",
+	}
+
+	body := []byte{0x00, 0x00, 0x00} // Packet identifier 0, properties length
+	body = common.AppendString(body, cfg.Topic("test/packet-id-zero"))
+	body = append(body, 0x00) // Subscription options
+	expectRefused(cfg, "test-subscribe-pid0", common.RawPacket(0x82, body), refuseMalformed, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUnsubscribePacketIDZero tests that an UNSUBSCRIBE with Packet
+// Identifier 0 is rejected [MQTT-2.2.1-3]
+func testUnsubscribePacketIDZero(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject UNSUBSCRIBE with Packet Identifier 0",
+		SpecRef: "MQTT-2.2.1-3",
+	}
+
+	body := []byte{0x00, 0x00, 0x00} // Packet identifier 0, properties length
+	body = common.AppendString(body, cfg.Topic("test/packet-id-zero"))
+	expectRefused(cfg, "test-unsubscribe-pid0", common.RawPacket(0xA2, body), refuseMalformed, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
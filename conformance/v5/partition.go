@@ -0,0 +1,71 @@
+package v5
+
+import (
+	"context"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// PartitionTests returns tests that black-hole the traffic between client
+// and broker with a fault-injection proxy for the configured windows
+// (Config.PartitionWindows) in the middle of a flow, then restore it and
+// check the flow resumes correctly
+func PartitionTests() TestGroup {
+	return TestGroup{
+		Name: "Network Partition",
+		Tags: []string{"partition", "qos", "timing"},
+		Tests: []TestFunc{
+			testPartitionQoS2,
+			testPartitionSubscribe,
+		},
+	}
+}
+
+// testPartitionQoS2 tests that a QoS 2 flow black-holed between PUBREC and
+// PUBREL, on both the publisher's and the subscriber's side, completes once
+// the partition heals and the message is delivered exactly once
+// [MQTT-4.4.0-1]
+// "Clients and Servers MUST NOT resend messages at any other time"
+func testPartitionQoS2(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "QoS 2 Handshake Across Partition",
+		SpecRef: "MQTT-4.4.0-1",
+	}
+
+	notes, err := common.CheckPartitionQoS2(cfg, 5)
+	if err != nil {
+		result.Error = err
+	} else {
+		result.Status = common.StatusPassed
+		result.Notes = notes
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPartitionSubscribe tests that a SUBSCRIBE sent into a partition is
+// acknowledged once it heals and the subscription then delivers messages
+// [MQTT-3.8.4-1]
+// "When the Server receives a SUBSCRIBE packet from a Client, the Server
+// MUST respond with a SUBACK packet"
+func testPartitionSubscribe(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "SUBSCRIBE Across Partition",
+		SpecRef: "MQTT-3.8.4-1",
+	}
+
+	notes, err := common.CheckPartitionSubscribe(cfg, 5)
+	if err != nil {
+		result.Error = err
+	} else {
+		result.Status = common.StatusPassed
+		result.Notes = notes
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
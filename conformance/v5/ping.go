@@ -5,9 +5,8 @@ import (
 )
 
 import (
+	"context"
 	"fmt"
-	"net"
-	"net/url"
 	"time"
 
 	"github.com/eclipse/paho.golang/paho"
@@ -17,39 +16,31 @@ import (
 func PingTests() TestGroup {
 	return TestGroup{
 		Name: "PING (Keep Alive)",
+		Tags: []string{"core", "timing"},
 		Tests: []TestFunc{
 			testPingRequest,
 			testPingResponse,
 			testKeepAliveTimeout,
 			testPingNoPayload,
+			testPingRespDeadline,
+			testPingReqRemainingLength,
+			testNoUnsolicitedPingResp,
 		},
 	}
 }
 
 // testPingRequest tests that PINGREQ packet works [MQTT-3.12.4-1]
 // "The Server MUST send a PINGRESP packet in response to a PINGREQ packet"
-func testPingRequest(cfg common.Config) TestResult {
+func testPingRequest(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "PINGREQ Generates PINGRESP",
 		SpecRef: "MQTT-3.12.4-1",
 	}
 
-	u, err := url.Parse(cfg.Broker)
+	conn, err := common.Dial(cfg)
 	if err != nil {
-		result.Error = fmt.Errorf("invalid broker URL: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
-
-	host := u.Host
-	if u.Port() == "" {
-		host = net.JoinHostPort(u.Hostname(), "1883")
-	}
-
-	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to dial broker: %w", err)
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
@@ -82,7 +73,7 @@ func testPingRequest(cfg common.Config) TestResult {
 	n, err := conn.Read(response)
 	if err != nil || n == 0 {
 		// EOF is valid - broker rejected invalid packet
-		result.Passed = true
+		result.Status = common.StatusPassed
 		result.Error = nil
 		result.Duration = time.Since(start)
 		return result
@@ -107,7 +98,7 @@ func testPingRequest(cfg common.Config) TestResult {
 
 	// Verify it's a PINGRESP (0xD0 0x00)
 	if n >= 2 && response[0] == 0xD0 && response[1] == 0x00 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("invalid PINGRESP: got %x %x", response[0], response[1])
 	}
@@ -118,28 +109,16 @@ func testPingRequest(cfg common.Config) TestResult {
 
 // testPingResponse tests PINGRESP format [MQTT-3.13.2-1]
 // "The Server MUST send a PINGRESP packet with Remaining Length 0"
-func testPingResponse(cfg common.Config) TestResult {
+func testPingResponse(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "PINGRESP Has Remaining Length 0",
 		SpecRef: "MQTT-3.13.2-1",
 	}
 
-	u, err := url.Parse(cfg.Broker)
+	conn, err := common.Dial(cfg)
 	if err != nil {
-		result.Error = fmt.Errorf("invalid broker URL: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
-
-	host := u.Host
-	if u.Port() == "" {
-		host = net.JoinHostPort(u.Hostname(), "1883")
-	}
-
-	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to dial broker: %w", err)
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
@@ -172,7 +151,7 @@ func testPingResponse(cfg common.Config) TestResult {
 	n, err := conn.Read(response)
 	if err != nil || n == 0 {
 		// EOF is valid - broker rejected invalid packet
-		result.Passed = true
+		result.Status = common.StatusPassed
 		result.Error = nil
 		result.Duration = time.Since(start)
 		return result
@@ -197,7 +176,7 @@ func testPingResponse(cfg common.Config) TestResult {
 
 	// Check packet type (0xD0) and remaining length (0x00)
 	if response[0] == 0xD0 && response[1] == 0x00 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("PINGRESP has invalid format: %x %x", response[0], response[1])
 	}
@@ -210,28 +189,16 @@ func testPingResponse(cfg common.Config) TestResult {
 // "If the Keep Alive value is non-zero and the Server does not receive an MQTT
 // Control Packet from the Client within 1.5 times the Keep Alive time period,
 // it MUST close the Network Connection"
-func testKeepAliveTimeout(cfg common.Config) TestResult {
+func testKeepAliveTimeout(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Keep Alive Timeout (1.5x)",
 		SpecRef: "MQTT-3.1.2-24",
 	}
 
-	u, err := url.Parse(cfg.Broker)
+	conn, err := common.Dial(cfg)
 	if err != nil {
-		result.Error = fmt.Errorf("invalid broker URL: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
-
-	host := u.Host
-	if u.Port() == "" {
-		host = net.JoinHostPort(u.Hostname(), "1883")
-	}
-
-	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to dial broker: %w", err)
+		result.Error = err
 		result.Duration = time.Since(start)
 		return result
 	}
@@ -264,7 +231,7 @@ func testKeepAliveTimeout(cfg common.Config) TestResult {
 	n, err := conn.Read(response)
 	if err != nil || n == 0 {
 		// EOF is valid - broker rejected invalid packet
-		result.Passed = true
+		result.Status = common.StatusPassed
 		result.Error = nil
 		result.Duration = time.Since(start)
 		return result
@@ -280,7 +247,7 @@ func testKeepAliveTimeout(cfg common.Config) TestResult {
 
 	if err != nil || n == 0 {
 		// Connection closed by broker - correct behavior
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("broker did not enforce keep alive timeout")
 	}
@@ -291,7 +258,7 @@ func testKeepAliveTimeout(cfg common.Config) TestResult {
 
 // testPingNoPayload tests that PINGREQ has no payload [MQTT-3.12.3-1]
 // "The PINGREQ packet has no Variable Header and no Payload"
-func testPingNoPayload(cfg common.Config) TestResult {
+func testPingNoPayload(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "PINGREQ Has No Payload",
@@ -299,7 +266,7 @@ func testPingNoPayload(cfg common.Config) TestResult {
 	}
 
 	// Test by using paho client which correctly implements PINGREQ
-	client, err := CreateAndConnectClient(cfg, "test-ping-nopayload", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-ping-nopayload"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -311,7 +278,71 @@ func testPingNoPayload(cfg common.Config) TestResult {
 	// If broker is still connected after 2 seconds, ping mechanism works
 	time.Sleep(2 * time.Second)
 
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "no PINGREQ is sent within the observation window"
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPingRespDeadline tests, on a raw connection, that every PINGREQ is
+// answered with a PINGRESP of Remaining Length 0 within a deadline
+// [MQTT-3.12.4-1]
+// "The Server MUST send a PINGRESP packet in response to a PINGREQ packet"
+func testPingRespDeadline(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "PINGRESP Within Deadline",
+		SpecRef: "MQTT-3.12.4-1",
+	}
+
+	slowest, err := common.CheckPingResponses(cfg, 5)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Notes = fmt.Sprintf("slowest PINGRESP %v", slowest.Round(time.Microsecond))
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPingReqRemainingLength tests that a PINGREQ with a nonzero Remaining
+// Length, which the packet does not have, is treated as malformed
+// [MQTT-4.13.1-1]
+// "When a Server detects a Malformed Packet or Protocol Error, and a Reason
+// Code is given in the specification, it MUST close the Network Connection"
+func testPingReqRemainingLength(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject PINGREQ With Nonzero Remaining Length",
+		SpecRef: "MQTT-4.13.1-1",
+	}
+
+	expectRefused(cfg, "test-pingreq-remlen", []byte{0xC0, 0x01, 0x00}, refuseMalformed, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testNoUnsolicitedPingResp tests, on a raw connection, that the broker
+// sends a PINGRESP only in answer to a PINGREQ: none on an idle connection,
+// none alongside other flows and one per PINGREQ [MQTT-3.13]
+func testNoUnsolicitedPingResp(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "No Unsolicited PINGRESP",
+		SpecRef: "MQTT-3.13",
+	}
+
+	if err := common.CheckNoUnsolicitedPingresp(cfg, 5); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -1,11 +1,13 @@
 package v5
 
 import (
+	"github.com/bromq-dev/testmqtt/conformance/assert"
 	"github.com/bromq-dev/testmqtt/conformance/common"
 )
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -13,13 +15,18 @@ import (
 	"github.com/eclipse/paho.golang/paho"
 )
 
+const reasonPayloadFormatInvalid = 0x99
+
 // PropertiesTests returns all MQTT v5 properties conformance tests
 func PropertiesTests() TestGroup {
 	return TestGroup{
 		Name: "Properties",
+		Tags: []string{"properties"},
 		Tests: []TestFunc{
 			testUserProperties,
 			testContentType,
+			testPayloadFormatAndContentType,
+			testPayloadFormatInvalidUTF8,
 			testResponseTopic,
 			testCorrelationData,
 			testMaximumPacketSize,
@@ -30,7 +37,7 @@ func PropertiesTests() TestGroup {
 // testUserProperties tests User Properties [MQTT-3.1.3-10]
 // "The Server MUST maintain the order of User Properties when publishing
 // the Will Message"
-func testUserProperties(cfg common.Config) TestResult {
+func testUserProperties(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "User Properties",
@@ -51,7 +58,7 @@ func testUserProperties(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-userprops", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-userprops"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -59,10 +66,9 @@ func testUserProperties(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/userprops", QoS: 0},
+			{Topic: cfg.Topic("test/userprops"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -71,7 +77,7 @@ func testUserProperties(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-userprops", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-userprops"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -79,11 +85,9 @@ func testUserProperties(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish with user properties
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/userprops",
+		Topic:   cfg.Topic("test/userprops"),
 		QoS:     0,
 		Payload: []byte("message with properties"),
 		Properties: &paho.PublishProperties{
@@ -99,13 +103,13 @@ func testUserProperties(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("user properties not received")
 	}
 
@@ -114,7 +118,7 @@ func testUserProperties(cfg common.Config) TestResult {
 }
 
 // testContentType tests Content Type property
-func testContentType(cfg common.Config) TestResult {
+func testContentType(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Content Type Property",
@@ -135,7 +139,7 @@ func testContentType(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-contenttype", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-contenttype"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -143,10 +147,9 @@ func testContentType(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/contenttype", QoS: 0},
+			{Topic: cfg.Topic("test/contenttype"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -155,7 +158,7 @@ func testContentType(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-contenttype", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-contenttype"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -163,10 +166,8 @@ func testContentType(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/contenttype",
+		Topic:   cfg.Topic("test/contenttype"),
 		QoS:     0,
 		Payload: []byte(`{"test": "data"}`),
 		Properties: &paho.PublishProperties{
@@ -179,13 +180,13 @@ func testContentType(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("content type property not received correctly")
 	}
 
@@ -193,8 +194,164 @@ func testContentType(cfg common.Config) TestResult {
 	return result
 }
 
+// testPayloadFormatAndContentType tests that a Payload Format Indicator of 1
+// and a Content Type reach the subscriber unchanged [MQTT-3.3.2-4]
+// "A Server MUST send the Payload Format Indicator unaltered to all
+// subscribers receiving the Application Message"
+// and [MQTT-3.3.2-20]
+// "A Server MUST send the Content Type unaltered to all subscribers receiving
+// the Application Message"
+func testPayloadFormatAndContentType(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Payload Format Indicator and Content Type Unaltered",
+		SpecRef: "MQTT-3.3.2-4",
+	}
+
+	const contentType = "text/plain; charset=utf-8"
+	received := make(chan *paho.PublishProperties, 1)
+	onPublish := func(pr paho.PublishReceived) (bool, error) {
+		select {
+		case received <- pr.Packet.Properties:
+		default:
+		}
+		return true, nil
+	}
+
+	topic := cfg.Topic("test/payload-format")
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-payload-format"), onPublish)
+	if err != nil {
+		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	if _, err := sub.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: 0}},
+	}); err != nil {
+		result.Error = fmt.Errorf("subscribe failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-payload-format"), nil)
+	if err != nil {
+		result.Error = fmt.Errorf("publisher connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	payloadFormat := byte(1)
+	if _, err := pub.Publish(ctx, &paho.Publish{
+		Topic:   topic,
+		QoS:     0,
+		Payload: []byte("grüße"),
+		Properties: &paho.PublishProperties{
+			PayloadFormat: &payloadFormat,
+			ContentType:   contentType,
+		},
+	}); err != nil {
+		result.Error = fmt.Errorf("publish failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	select {
+	case props := <-received:
+		switch {
+		case props == nil || props.PayloadFormat == nil:
+			result.Error = fmt.Errorf("Payload Format Indicator missing from the delivered message")
+		case *props.PayloadFormat != payloadFormat:
+			result.Error = fmt.Errorf("Payload Format Indicator delivered as %d, expected 1", *props.PayloadFormat)
+		case props.ContentType != contentType:
+			result.SpecRef = "MQTT-3.3.2-20"
+			result.Error = fmt.Errorf("Content Type delivered as %q, expected %q", props.ContentType, contentType)
+		default:
+			result.Status = common.StatusPassed
+		}
+	case <-time.After(cfg.Scaled(2 * time.Second)):
+		result.Error = fmt.Errorf("message not received")
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPayloadFormatInvalidUTF8 tests how the broker treats a payload marked
+// as UTF-8 that is not [MQTT-3.3.2.3.2]. Validating it is optional; a broker
+// that does must refuse it with 0x99 (Payload format invalid).
+func testPayloadFormatInvalidUTF8(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Invalid UTF-8 Payload Refused with 0x99 or Passed On",
+		SpecRef: "MQTT-3.3.2.3.2",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-payload-format-invalid"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	body := common.AppendString(nil, cfg.Topic("test/payload-format/invalid"))
+	body = append(body, 0x00, 0x01)       // Packet identifier
+	body = append(body, 0x02, 0x01, 0x01) // Properties: Payload Format Indicator 1
+	body = append(body, 0xC3, 0x28, 0xFF) // Not UTF-8
+	if err := conn.Send(0x32, body); err != nil {
+		result.Error = fmt.Errorf("failed to send PUBLISH: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	disconnect := -1
+	_, ack, err := conn.Expect(0x40, cfg.Scaled(5*time.Second), func(header byte, body []byte) {
+		if header == 0xE0 {
+			disconnect = 0
+			if len(body) > 0 {
+				disconnect = int(body[0])
+			}
+		}
+	})
+	var reason byte
+	if len(ack) > 2 {
+		reason = ack[2]
+	}
+	switch {
+	case errors.Is(err, common.ErrBrokerClosed) && disconnect == reasonPayloadFormatInvalid:
+		result.Status = common.StatusPassed
+		result.Notes = "broker disconnected with 0x99 (Payload format invalid)"
+	case errors.Is(err, common.ErrBrokerClosed) && disconnect >= 0:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker disconnected with %s rather than %s", assert.ReasonName(byte(disconnect)), assert.ReasonName(reasonPayloadFormatInvalid))
+	case errors.Is(err, common.ErrBrokerClosed):
+		result.Status = common.StatusWarning
+		result.Notes = "broker closed the connection without sending 0x99 (Payload format invalid)"
+	case err != nil:
+		result.Error = err
+	case reason == reasonPayloadFormatInvalid:
+		result.Status = common.StatusPassed
+	case reason >= 0x80:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker refused the payload with PUBACK %s rather than %s", assert.ReasonName(reason), assert.ReasonName(reasonPayloadFormatInvalid))
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = "broker accepted the payload, validating it is optional"
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
 // testResponseTopic tests Response Topic property
-func testResponseTopic(cfg common.Config) TestResult {
+func testResponseTopic(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Response Topic Property",
@@ -215,7 +372,7 @@ func testResponseTopic(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-responsetopic", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-responsetopic"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -223,10 +380,9 @@ func testResponseTopic(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/responsetopic", QoS: 0},
+			{Topic: cfg.Topic("test/responsetopic"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -235,7 +391,7 @@ func testResponseTopic(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-responsetopic", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-responsetopic"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -243,10 +399,8 @@ func testResponseTopic(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/responsetopic",
+		Topic:   cfg.Topic("test/responsetopic"),
 		QoS:     0,
 		Payload: []byte("request"),
 		Properties: &paho.PublishProperties{
@@ -259,13 +413,13 @@ func testResponseTopic(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("response topic property not received correctly")
 	}
 
@@ -274,7 +428,7 @@ func testResponseTopic(cfg common.Config) TestResult {
 }
 
 // testCorrelationData tests Correlation Data property
-func testCorrelationData(cfg common.Config) TestResult {
+func testCorrelationData(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Correlation Data Property",
@@ -295,7 +449,7 @@ func testCorrelationData(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-correlation", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-correlation"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -303,10 +457,9 @@ func testCorrelationData(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/correlation", QoS: 0},
+			{Topic: cfg.Topic("test/correlation"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -315,7 +468,7 @@ func testCorrelationData(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-correlation", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-correlation"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -323,10 +476,8 @@ func testCorrelationData(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/correlation",
+		Topic:   cfg.Topic("test/correlation"),
 		QoS:     0,
 		Payload: []byte("request"),
 		Properties: &paho.PublishProperties{
@@ -339,13 +490,13 @@ func testCorrelationData(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("correlation data property not received correctly")
 	}
 
@@ -355,7 +506,7 @@ func testCorrelationData(cfg common.Config) TestResult {
 
 // testMaximumPacketSize tests Maximum Packet Size [MQTT-3.1.2-24]
 // "The Server MUST NOT send packets exceeding Maximum Packet Size to the Client"
-func testMaximumPacketSize(cfg common.Config) TestResult {
+func testMaximumPacketSize(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Maximum Packet Size",
@@ -364,7 +515,7 @@ func testMaximumPacketSize(cfg common.Config) TestResult {
 
 	// Testing maximum packet size requires setting it in CONNECT
 	// and then trying to send large messages
-	client, err := CreateAndConnectClient(cfg, "test-maxpacket", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-maxpacket"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -372,7 +523,8 @@ func testMaximumPacketSize(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "Maximum Packet Size was not set or exercised"
 	result.Duration = time.Since(start)
 	return result
 }
@@ -0,0 +1,413 @@
+package v5
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/assert"
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// reasonTopicAliasInvalid is the DISCONNECT reason for a Topic Alias of 0 or
+// above the receiver's Topic Alias Maximum
+const reasonTopicAliasInvalid = 0x94
+
+// fuzzCasesPerTest is how many broken packets each fuzz test sends, spread
+// over CONNECT, PUBLISH and SUBSCRIBE
+const fuzzCasesPerTest = 6
+
+// PropertyFuzzTests returns tests that send CONNECT, PUBLISH and SUBSCRIBE
+// packets whose properties are broken in randomly chosen ways. The broker must
+// refuse each one as malformed or a protocol error without hanging. The cases
+// are drawn from the run's seed, so --seed repeats them and --shuffle varies
+// them [MQTT-4.13.1-1]
+func PropertyFuzzTests() TestGroup {
+	return TestGroup{
+		Name: "Property Encoding Fuzz",
+		Tags: []string{"packet-format", "negative", "properties"},
+		Tests: []TestFunc{
+			testFuzzInvalidPropertyIDs,
+			testFuzzDuplicateProperties,
+			testFuzzTruncatedProperties,
+			testFuzzOutOfRangeProperties,
+		},
+	}
+}
+
+// fuzzProperty is a property a packet may carry once, with a valid value
+type fuzzProperty struct {
+	id    byte
+	name  string
+	value []byte
+}
+
+// fuzzPacketTypes are the packets the fuzz tests break, by the first byte
+// of their fixed header
+var fuzzPacketTypes = []byte{0x10, 0x32, 0x82}
+
+// fuzzProperties are the properties of each packet type that must not repeat
+var fuzzProperties = map[byte][]fuzzProperty{
+	0x10: {
+		{0x11, "Session Expiry Interval", []byte{0, 0, 0, 0}},
+		{0x21, "Receive Maximum", []byte{0, 10}},
+		{0x27, "Maximum Packet Size", []byte{0, 1, 0, 0}},
+		{0x22, "Topic Alias Maximum", []byte{0, 0}},
+		{0x19, "Request Response Information", []byte{0}},
+		{0x17, "Request Problem Information", []byte{1}},
+	},
+	0x32: {
+		{0x01, "Payload Format Indicator", []byte{0}},
+		{0x02, "Message Expiry Interval", []byte{0, 0, 0, 60}},
+		{0x03, "Content Type", common.AppendString(nil, "text/plain")},
+		{0x08, "Response Topic", common.AppendString(nil, "fuzz/response")},
+		{0x09, "Correlation Data", common.AppendString(nil, "fuzz")},
+	},
+	0x82: {
+		{0x0B, "Subscription Identifier", []byte{1}},
+	},
+}
+
+// fuzzValidIDs are the Property Identifiers each packet type may carry,
+// including those that can repeat
+var fuzzValidIDs = map[byte][]byte{
+	0x10: {0x11, 0x21, 0x27, 0x22, 0x19, 0x17, 0x26, 0x15, 0x16},
+	0x32: {0x01, 0x02, 0x23, 0x08, 0x09, 0x26, 0x0B, 0x03},
+	0x82: {0x0B, 0x26},
+}
+
+// fuzzCase is one packet with broken properties
+type fuzzCase struct {
+	desc   string // What is broken, e.g. "PUBLISH with Property Identifier 0x5a"
+	header byte   // First byte of the fixed header
+	props  []byte // Properties, without the Property Length
+	// overrun makes the Property Length claim this many bytes more than the
+	// rest of the packet holds
+	overrun int
+	also    byte // A reason code that refuses this case besides 0x81 and 0x82
+}
+
+// fuzzRand returns the source case n of a fuzz test draws from, one stream
+// per test and case so adding cases leaves the others as they were
+func fuzzRand(cfg common.Config, stream uint64, n int) *rand.Rand {
+	return rand.New(rand.NewPCG(cfg.Seed, stream<<32|uint64(n)))
+}
+
+// encode builds the packet of c, with a CONNECT for clientID
+func (c fuzzCase) encode(cfg common.Config, clientID string) []byte {
+	var head, tail []byte
+	switch c.header {
+	case 0x10:
+		flags := byte(0x02)
+		if cfg.Username != "" {
+			flags |= 0x80
+		}
+		if cfg.Password != "" {
+			flags |= 0x40
+		}
+		head = common.AppendString(nil, "MQTT")
+		head = append(head, 5, flags, 0, 30)
+		tail = common.AppendString(nil, clientID)
+		if cfg.Username != "" {
+			tail = common.AppendString(tail, cfg.Username)
+		}
+		if cfg.Password != "" {
+			tail = common.AppendString(tail, cfg.Password)
+		}
+	case 0x32:
+		head = common.AppendString(nil, cfg.Topic("test/fuzz/properties"))
+		head = append(head, 0x00, 0x01) // Packet Identifier 1
+		tail = []byte("fuzz")
+	default:
+		head = []byte{0x00, 0x01} // Packet Identifier 1
+		tail = common.AppendString(nil, cfg.Topic("test/fuzz/properties"))
+		tail = append(tail, 0x01) // Subscription Options: QoS 1
+	}
+
+	length := len(c.props)
+	if c.overrun > 0 {
+		length += len(tail) + c.overrun
+	}
+	body := common.AppendVarint(head, length)
+	body = append(body, c.props...)
+	body = append(body, tail...)
+	return common.RawPacket(c.header, body)
+}
+
+// sendFuzzCase sends c on a connection of its own. It returns an error when
+// the broker accepts the packet or neither answers nor closes the connection,
+// and a note when it refuses the packet in a way that is allowed but not the
+// expected one.
+func sendFuzzCase(cfg common.Config, c fuzzCase) (string, error) {
+	clientID := cfg.ClientID("test-fuzz")
+	r := refusal{want: []byte{reasonMalformedPacket, reasonProtocolError}}
+	if c.also != 0 {
+		r.want = append(r.want, c.also)
+	}
+
+	if c.header == 0x10 {
+		s, err := dialRawSession(cfg)
+		if err != nil {
+			return "", err
+		}
+		defer s.Close()
+		s.Send(c.encode(cfg, clientID))
+		code, err := s.ExpectConnack()
+		switch {
+		case errors.Is(err, common.ErrBrokerClosed):
+			// A broker may close without a CONNACK when CONNECT is broken
+			return "", nil
+		case err != nil:
+			return "", err
+		case code == 0x00:
+			return "", errors.New("broker accepted the CONNECT")
+		case slices.Contains(r.want, code):
+			return "", nil
+		case code >= 0x80:
+			return fmt.Sprintf("refused with CONNACK %s", assert.ReasonName(code)), nil
+		default:
+			return "", fmt.Errorf("broker answered with CONNACK %s", assert.ReasonName(code))
+		}
+	}
+
+	conn, err := common.DialRaw(cfg, 5, clientID)
+	if err != nil {
+		return "", fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+	s := rawSessionOn(cfg, conn)
+	s.Send(c.encode(cfg, clientID))
+	a := s.Answer(2 * time.Second)
+	// Any refusal will do, those other than the expected codes with a note
+	if a.header == 0xE0 && a.closed && a.reason() >= 0x80 && !slices.Contains(r.want, a.reason()) {
+		return fmt.Sprintf("refused with DISCONNECT %s", assert.ReasonName(a.reason())), nil
+	}
+	return a.judge(r)
+}
+
+// runFuzzCases sends each case and fills in result: failed when the broker
+// accepts or hangs on any case, a warning when it refused some cases other
+// than with 0x81 or 0x82, and passed otherwise. Once the cases are done the
+// broker must still accept connections.
+func runFuzzCases(cfg common.Config, cases []fuzzCase, result *TestResult) {
+	var failures, notes []string
+	for _, c := range cases {
+		note, err := sendFuzzCase(cfg, c)
+		switch {
+		case err != nil:
+			failures = append(failures, c.desc+": "+err.Error())
+		case note != "":
+			notes = append(notes, c.desc+": "+note)
+		}
+	}
+	if len(failures) > 0 {
+		result.Error = fmt.Errorf("%d of %d packets not refused (seed %d): %s", len(failures), len(cases), cfg.Seed, strings.Join(failures, "; "))
+		return
+	}
+
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-fuzz-after"))
+	if err != nil {
+		result.Error = fmt.Errorf("broker stopped accepting connections after the fuzzed packets: %w", err)
+		return
+	}
+	conn.Close()
+
+	if len(notes) > 0 {
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("seed %d; %s", cfg.Seed, strings.Join(notes, "; "))
+		return
+	}
+	result.Status = common.StatusPassed
+	result.Notes = fmt.Sprintf("%d packets refused, seed %d", len(cases), cfg.Seed)
+}
+
+// testFuzzInvalidPropertyIDs tests properties whose Property Identifier is
+// unknown or not allowed in the packet [MQTT-4.13.1-1]
+// "When a Server detects a Malformed Packet or Protocol Error, and a Reason
+// Code is given in the specification, it MUST close the Network Connection"
+func testFuzzInvalidPropertyIDs(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Fuzz: Invalid Property Identifiers",
+		SpecRef: "MQTT-4.13.1-1",
+	}
+
+	var cases []fuzzCase
+	for i := range fuzzCasesPerTest {
+		rng := fuzzRand(cfg, 1, i)
+		header := fuzzPacketTypes[i%len(fuzzPacketTypes)]
+		id := byte(rng.IntN(0x80))
+		for slices.Contains(fuzzValidIDs[header], id) {
+			id = byte(rng.IntN(0x80))
+		}
+		cases = append(cases, fuzzCase{
+			desc:   fmt.Sprintf("%s with Property Identifier 0x%02x", common.PacketName(header), id),
+			header: header,
+			props:  []byte{id, byte(rng.IntN(256))},
+		})
+	}
+	runFuzzCases(cfg, cases, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testFuzzDuplicateProperties tests packets that repeat a property which may
+// appear only once [MQTT-4.13.1-1]
+// "It is a Protocol Error to include the Session Expiry Interval more than
+// once."
+func testFuzzDuplicateProperties(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Fuzz: Duplicated Properties",
+		SpecRef: "MQTT-4.13.1-1",
+	}
+
+	var cases []fuzzCase
+	for i := range fuzzCasesPerTest {
+		rng := fuzzRand(cfg, 2, i)
+		header := fuzzPacketTypes[i%len(fuzzPacketTypes)]
+		props := fuzzProperties[header]
+		p := props[rng.IntN(len(props))]
+		prop := append([]byte{p.id}, p.value...)
+		cases = append(cases, fuzzCase{
+			desc:   fmt.Sprintf("%s with %s twice", common.PacketName(header), p.name),
+			header: header,
+			props:  append(slices.Clone(prop), prop...),
+		})
+	}
+	runFuzzCases(cfg, cases, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testFuzzTruncatedProperties tests properties cut short: a Property Length
+// running past the end of the packet, a User Property whose string runs past
+// the Property Length, and a value with bytes missing at the end of the
+// properties [MQTT-4.13.1-1]
+func testFuzzTruncatedProperties(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Fuzz: Truncated Properties",
+		SpecRef: "MQTT-4.13.1-1",
+	}
+
+	var cases []fuzzCase
+	for i := range fuzzCasesPerTest {
+		rng := fuzzRand(cfg, 3, i)
+		header := fuzzPacketTypes[i%len(fuzzPacketTypes)]
+		name := common.PacketName(header)
+		props := fuzzProperties[header]
+		p := props[rng.IntN(len(props))]
+		switch rng.IntN(3) {
+		case 0:
+			overrun := 1 + rng.IntN(64)
+			cases = append(cases, fuzzCase{
+				desc:    fmt.Sprintf("%s with a Property Length %d bytes past the packet", name, overrun),
+				header:  header,
+				props:   append([]byte{p.id}, p.value...),
+				overrun: overrun,
+			})
+		case 1:
+			missing := 1 + rng.IntN(32)
+			prop := binary.BigEndian.AppendUint16([]byte{0x26}, uint16(3+missing))
+			cases = append(cases, fuzzCase{
+				desc:   fmt.Sprintf("%s with a User Property name %d bytes past the properties", name, missing),
+				header: header,
+				props:  append(prop, "key"...),
+			})
+		default:
+			if p.id == 0x0B {
+				// A Variable Byte Integer that announces a byte it lacks
+				cases = append(cases, fuzzCase{
+					desc:   name + " with a Subscription Identifier cut short",
+					header: header,
+					props:  []byte{p.id, 0x81},
+				})
+				continue
+			}
+			if len(p.value) < 2 {
+				p = props[0]
+			}
+			keep := rng.IntN(len(p.value))
+			cases = append(cases, fuzzCase{
+				desc:   fmt.Sprintf("%s with %s cut to %d of %d bytes", name, p.name, keep, len(p.value)),
+				header: header,
+				props:  append([]byte{p.id}, p.value[:keep]...),
+			})
+		}
+	}
+	runFuzzCases(cfg, cases, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testFuzzOutOfRangeProperties tests properties with values the
+// specification rules out [MQTT-4.13.1-1]
+// "It is a Protocol Error to include the Receive Maximum value more than once
+// or for it to have the value 0."
+func testFuzzOutOfRangeProperties(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Fuzz: Out-of-Range Property Values",
+		SpecRef: "MQTT-4.13.1-1",
+	}
+
+	flag := func(rng *rand.Rand) byte { return byte(2 + rng.IntN(254)) }
+	choices := map[byte][]func(rng *rand.Rand) fuzzCase{
+		0x10: {
+			func(*rand.Rand) fuzzCase {
+				return fuzzCase{desc: "CONNECT with Receive Maximum 0", props: []byte{0x21, 0, 0}}
+			},
+			func(*rand.Rand) fuzzCase {
+				return fuzzCase{desc: "CONNECT with Maximum Packet Size 0", props: []byte{0x27, 0, 0, 0, 0}}
+			},
+			func(rng *rand.Rand) fuzzCase {
+				v := flag(rng)
+				return fuzzCase{desc: fmt.Sprintf("CONNECT with Request Response Information %d", v), props: []byte{0x19, v}}
+			},
+			func(rng *rand.Rand) fuzzCase {
+				v := flag(rng)
+				return fuzzCase{desc: fmt.Sprintf("CONNECT with Request Problem Information %d", v), props: []byte{0x17, v}}
+			},
+		},
+		0x32: {
+			func(*rand.Rand) fuzzCase {
+				return fuzzCase{desc: "PUBLISH with Topic Alias 0", props: []byte{0x23, 0, 0}, also: reasonTopicAliasInvalid}
+			},
+			func(rng *rand.Rand) fuzzCase {
+				// Only 0 and 1 are defined and no Reason Code is given for
+				// other values, which are "data that is not allowed by the
+				// protocol": a Protocol Error, or a Malformed Packet for a
+				// broker that cannot parse it [1.2 Terminology]
+				v := flag(rng)
+				return fuzzCase{desc: fmt.Sprintf("PUBLISH with Payload Format Indicator %d", v), props: []byte{0x01, v}}
+			},
+		},
+		0x82: {
+			func(*rand.Rand) fuzzCase {
+				return fuzzCase{desc: "SUBSCRIBE with Subscription Identifier 0", props: []byte{0x0B, 0}}
+			},
+		},
+	}
+
+	var cases []fuzzCase
+	for i := range fuzzCasesPerTest {
+		header := fuzzPacketTypes[i%len(fuzzPacketTypes)]
+		rng := fuzzRand(cfg, 4, i)
+		c := choices[header][rng.IntN(len(choices[header]))](rng)
+		c.header = header
+		cases = append(cases, c)
+	}
+	runFuzzCases(cfg, cases, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -1,6 +1,7 @@
 package v5
 
 import (
+	"github.com/bromq-dev/testmqtt/conformance/assert"
 	"github.com/bromq-dev/testmqtt/conformance/common"
 )
 
@@ -17,9 +18,11 @@ import (
 func QoSHandshakeTests() TestGroup {
 	return TestGroup{
 		Name: "QoS Handshake (PUBACK/PUBREC/PUBREL/PUBCOMP)",
+		Tags: []string{"qos"},
 		Tests: []TestFunc{
 			testPUBACKPacketIdentifier,
 			testPUBACKReasonCodes,
+			testPUBACKNoMatchingSubscribers,
 			testPUBRECPacketIdentifier,
 			testPUBRECReasonCodes,
 			testPUBRELPacketIdentifier,
@@ -35,13 +38,17 @@ func QoSHandshakeTests() TestGroup {
 // testPUBACKPacketIdentifier tests PUBACK packet identifier [MQTT-3.4.2-1]
 // "The Packet Identifier field contains the Packet Identifier from the PUBLISH packet
 // that is being acknowledged"
-func testPUBACKPacketIdentifier(cfg common.Config) TestResult {
+func testPUBACKPacketIdentifier(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "PUBACK Packet Identifier Matches PUBLISH",
 		SpecRef: "MQTT-3.4.2-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
 	received := false
 	var mu sync.Mutex
 
@@ -52,7 +59,7 @@ func testPUBACKPacketIdentifier(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-puback-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-puback-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -60,10 +67,9 @@ func testPUBACKPacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/puback/id", QoS: 1},
+			{Topic: cfg.Topic("test/puback/id"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -72,7 +78,7 @@ func testPUBACKPacketIdentifier(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-puback-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-puback-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -80,11 +86,9 @@ func testPUBACKPacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish QoS 1 - will receive PUBACK
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/puback/id",
+		Topic:   cfg.Topic("test/puback/id"),
 		QoS:     1,
 		Payload: []byte("test qos1"),
 	})
@@ -94,13 +98,13 @@ func testPUBACKPacketIdentifier(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("QoS 1 message not received (PUBACK may have failed)")
 	}
 
@@ -110,14 +114,18 @@ func testPUBACKPacketIdentifier(cfg common.Config) TestResult {
 
 // testPUBACKReasonCodes tests PUBACK reason codes [MQTT-3.4.2.1-1]
 // "The Client or Server sending the PUBACK packet MUST use one of the PUBACK Reason Codes"
-func testPUBACKReasonCodes(cfg common.Config) TestResult {
+func testPUBACKReasonCodes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "PUBACK Reason Codes",
 		SpecRef: "MQTT-3.4.2.1-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-puback-reason", nil)
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-puback-reason"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -125,11 +133,9 @@ func testPUBACKReasonCodes(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Publish QoS 1 to valid topic - should get success PUBACK (0x00)
 	_, err = client.Publish(ctx, &paho.Publish{
-		Topic:   "test/puback/reason",
+		Topic:   cfg.Topic("test/puback/reason"),
 		QoS:     1,
 		Payload: []byte("test"),
 	})
@@ -140,7 +146,53 @@ func testPUBACKReasonCodes(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testPUBACKNoMatchingSubscribers tests the PUBACK for a QoS 1 message
+// nobody is subscribed to [MQTT-3.4.2.1]. The broker may answer 0x10 (No
+// matching subscribers) instead of 0x00 (Success); the test passes either
+// way and notes which it sent.
+func testPUBACKNoMatchingSubscribers(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "PUBACK for Message Without Subscribers",
+		SpecRef: "MQTT-3.4.2.1",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-puback-nosub"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	topic := cfg.Topic(common.GenerateClientID("test/puback/nobody"))
+	reason, err := conn.PublishAcked(topic, 1, 1, []byte("nobody listens"), cfg.Scaled(5*time.Second))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	switch reason {
+	case 0x00:
+		result.Status = common.StatusPassed
+		result.Notes = "broker sent 0x00 (Success)"
+	case 0x10:
+		result.Status = common.StatusPassed
+		result.Notes = "broker sent 0x10 (No matching subscribers)"
+	default:
+		result.Error = fmt.Errorf("PUBACK reason code %s, expected 0x00 or 0x10 (No matching subscribers)", assert.ReasonName(reason))
+	}
+
 	result.Duration = time.Since(start)
 	return result
 }
@@ -148,13 +200,17 @@ func testPUBACKReasonCodes(cfg common.Config) TestResult {
 // testPUBRECPacketIdentifier tests PUBREC packet identifier [MQTT-3.5.2-1]
 // "The Packet Identifier field contains the Packet Identifier from the PUBLISH packet
 // that is being acknowledged"
-func testPUBRECPacketIdentifier(cfg common.Config) TestResult {
+func testPUBRECPacketIdentifier(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "PUBREC Packet Identifier Matches PUBLISH",
 		SpecRef: "MQTT-3.5.2-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
 	received := false
 	var mu sync.Mutex
 
@@ -165,7 +221,7 @@ func testPUBRECPacketIdentifier(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-pubrec-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pubrec-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -173,10 +229,9 @@ func testPUBRECPacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/pubrec/id", QoS: 2},
+			{Topic: cfg.Topic("test/pubrec/id"), QoS: 2},
 		},
 	})
 	if err != nil {
@@ -185,7 +240,7 @@ func testPUBRECPacketIdentifier(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pubrec-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pubrec-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -193,11 +248,9 @@ func testPUBRECPacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish QoS 2 - will trigger PUBREC/PUBREL/PUBCOMP handshake
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/pubrec/id",
+		Topic:   cfg.Topic("test/pubrec/id"),
 		QoS:     2,
 		Payload: []byte("test qos2"),
 	})
@@ -207,13 +260,13 @@ func testPUBRECPacketIdentifier(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("QoS 2 message not received (PUBREC handshake may have failed)")
 	}
 
@@ -222,14 +275,18 @@ func testPUBRECPacketIdentifier(cfg common.Config) TestResult {
 }
 
 // testPUBRECReasonCodes tests PUBREC reason codes [MQTT-3.5.2.1-1]
-func testPUBRECReasonCodes(cfg common.Config) TestResult {
+func testPUBRECReasonCodes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "PUBREC Reason Codes",
 		SpecRef: "MQTT-3.5.2.1-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-pubrec-reason", nil)
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pubrec-reason"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -237,11 +294,9 @@ func testPUBRECReasonCodes(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Publish QoS 2 - should receive PUBREC with success (0x00)
 	_, err = client.Publish(ctx, &paho.Publish{
-		Topic:   "test/pubrec/reason",
+		Topic:   cfg.Topic("test/pubrec/reason"),
 		QoS:     2,
 		Payload: []byte("test"),
 	})
@@ -252,7 +307,7 @@ func testPUBRECReasonCodes(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -260,13 +315,17 @@ func testPUBRECReasonCodes(cfg common.Config) TestResult {
 // testPUBRELPacketIdentifier tests PUBREL packet identifier [MQTT-3.6.2-1]
 // "The Packet Identifier field contains the Packet Identifier from the PUBREC packet
 // that is being acknowledged"
-func testPUBRELPacketIdentifier(cfg common.Config) TestResult {
+func testPUBRELPacketIdentifier(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "PUBREL Packet Identifier Matches PUBREC",
 		SpecRef: "MQTT-3.6.2-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
 	received := false
 	var mu sync.Mutex
 
@@ -277,7 +336,7 @@ func testPUBRELPacketIdentifier(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-pubrel-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pubrel-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -285,10 +344,9 @@ func testPUBRELPacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/pubrel/id", QoS: 2},
+			{Topic: cfg.Topic("test/pubrel/id"), QoS: 2},
 		},
 	})
 	if err != nil {
@@ -297,7 +355,7 @@ func testPUBRELPacketIdentifier(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pubrel-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pubrel-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -305,11 +363,9 @@ func testPUBRELPacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// QoS 2 publish triggers full handshake including PUBREL
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/pubrel/id",
+		Topic:   cfg.Topic("test/pubrel/id"),
 		QoS:     2,
 		Payload: []byte("test qos2 pubrel"),
 	})
@@ -319,13 +375,13 @@ func testPUBRELPacketIdentifier(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("QoS 2 message not received (PUBREL may have failed)")
 	}
 
@@ -334,15 +390,19 @@ func testPUBRELPacketIdentifier(cfg common.Config) TestResult {
 }
 
 // testPUBRELReasonCodes tests PUBREL reason codes [MQTT-3.6.2.1-1]
-func testPUBRELReasonCodes(cfg common.Config) TestResult {
+func testPUBRELReasonCodes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "PUBREL Reason Codes",
 		SpecRef: "MQTT-3.6.2.1-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
 	// Test that PUBREL is sent with proper reason code during QoS 2 flow
-	client, err := CreateAndConnectClient(cfg, "test-pubrel-reason", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pubrel-reason"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -350,11 +410,9 @@ func testPUBRELReasonCodes(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// QoS 2 publish - if successful, PUBREL was sent with correct reason code
 	_, err = client.Publish(ctx, &paho.Publish{
-		Topic:   "test/pubrel/reason",
+		Topic:   cfg.Topic("test/pubrel/reason"),
 		QoS:     2,
 		Payload: []byte("test"),
 	})
@@ -365,7 +423,7 @@ func testPUBRELReasonCodes(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -373,13 +431,17 @@ func testPUBRELReasonCodes(cfg common.Config) TestResult {
 // testPUBCOMPPacketIdentifier tests PUBCOMP packet identifier [MQTT-3.7.2-1]
 // "The Packet Identifier field contains the Packet Identifier from the PUBREL packet
 // that is being acknowledged"
-func testPUBCOMPPacketIdentifier(cfg common.Config) TestResult {
+func testPUBCOMPPacketIdentifier(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "PUBCOMP Packet Identifier Matches PUBREL",
 		SpecRef: "MQTT-3.7.2-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
 	received := false
 	var mu sync.Mutex
 
@@ -390,7 +452,7 @@ func testPUBCOMPPacketIdentifier(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-pubcomp-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pubcomp-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -398,10 +460,9 @@ func testPUBCOMPPacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/pubcomp/id", QoS: 2},
+			{Topic: cfg.Topic("test/pubcomp/id"), QoS: 2},
 		},
 	})
 	if err != nil {
@@ -410,7 +471,7 @@ func testPUBCOMPPacketIdentifier(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pubcomp-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pubcomp-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -418,11 +479,9 @@ func testPUBCOMPPacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// QoS 2 publish - PUBCOMP is final ack in the handshake
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/pubcomp/id",
+		Topic:   cfg.Topic("test/pubcomp/id"),
 		QoS:     2,
 		Payload: []byte("test qos2 pubcomp"),
 	})
@@ -432,13 +491,13 @@ func testPUBCOMPPacketIdentifier(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("QoS 2 message not received (PUBCOMP may have failed)")
 	}
 
@@ -447,14 +506,18 @@ func testPUBCOMPPacketIdentifier(cfg common.Config) TestResult {
 }
 
 // testPUBCOMPReasonCodes tests PUBCOMP reason codes [MQTT-3.7.2.1-1]
-func testPUBCOMPReasonCodes(cfg common.Config) TestResult {
+func testPUBCOMPReasonCodes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "PUBCOMP Reason Codes",
 		SpecRef: "MQTT-3.7.2.1-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-pubcomp-reason", nil)
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pubcomp-reason"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -462,11 +525,9 @@ func testPUBCOMPReasonCodes(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// QoS 2 publish - if successful, PUBCOMP was received with correct reason code
 	_, err = client.Publish(ctx, &paho.Publish{
-		Topic:   "test/pubcomp/reason",
+		Topic:   cfg.Topic("test/pubcomp/reason"),
 		QoS:     2,
 		Payload: []byte("test"),
 	})
@@ -477,7 +538,7 @@ func testPUBCOMPReasonCodes(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -485,13 +546,17 @@ func testPUBCOMPReasonCodes(cfg common.Config) TestResult {
 // testQoS2CompleteHandshake tests complete QoS 2 handshake [MQTT-4.3.3-1]
 // "The receiver MUST respond to a PUBREL packet by sending a PUBCOMP packet
 // containing the same Packet Identifier as the PUBREL"
-func testQoS2CompleteHandshake(cfg common.Config) TestResult {
+func testQoS2CompleteHandshake(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "QoS 2 Complete Handshake (PUBLISH->PUBREC->PUBREL->PUBCOMP)",
 		SpecRef: "MQTT-4.3.3-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
 	received := false
 	var mu sync.Mutex
 
@@ -502,7 +567,7 @@ func testQoS2CompleteHandshake(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-qos2-handshake-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos2-handshake-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -510,10 +575,9 @@ func testQoS2CompleteHandshake(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/qos2/handshake", QoS: 2},
+			{Topic: cfg.Topic("test/qos2/handshake"), QoS: 2},
 		},
 	})
 	if err != nil {
@@ -522,7 +586,7 @@ func testQoS2CompleteHandshake(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-qos2-handshake-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-qos2-handshake-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -530,11 +594,9 @@ func testQoS2CompleteHandshake(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish QoS 2 - triggers full 4-way handshake
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/qos2/handshake",
+		Topic:   cfg.Topic("test/qos2/handshake"),
 		QoS:     2,
 		Payload: []byte("test qos2 complete"),
 	})
@@ -544,13 +606,13 @@ func testQoS2CompleteHandshake(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("QoS 2 handshake did not complete successfully")
 	}
 
@@ -561,13 +623,17 @@ func testQoS2CompleteHandshake(cfg common.Config) TestResult {
 // testQoS1DuplicateHandling tests DUP flag in QoS 1 retransmissions [MQTT-3.3.1-1]
 // "If the DUP flag is set to 0, it indicates that this is the first occasion
 // that the Client or Server has attempted to send this PUBLISH packet"
-func testQoS1DuplicateHandling(cfg common.Config) TestResult {
+func testQoS1DuplicateHandling(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "QoS 1 DUP Flag Handling",
 		SpecRef: "MQTT-3.3.1-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
 	messageCount := 0
 	var mu sync.Mutex
 
@@ -578,7 +644,7 @@ func testQoS1DuplicateHandling(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-dup-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-dup-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -586,10 +652,9 @@ func testQoS1DuplicateHandling(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/dup/flag", QoS: 1},
+			{Topic: cfg.Topic("test/dup/flag"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -598,7 +663,7 @@ func testQoS1DuplicateHandling(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-dup-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-dup-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -606,12 +671,10 @@ func testQoS1DuplicateHandling(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish multiple QoS 1 messages
 	for i := 0; i < 3; i++ {
 		_, err = pub.Publish(ctx, &paho.Publish{
-			Topic:   "test/dup/flag",
+			Topic:   cfg.Topic("test/dup/flag"),
 			QoS:     1,
 			Payload: []byte(fmt.Sprintf("message %d", i)),
 		})
@@ -620,17 +683,17 @@ func testQoS1DuplicateHandling(cfg common.Config) TestResult {
 			result.Duration = time.Since(start)
 			return result
 		}
-		time.Sleep(50 * time.Millisecond)
+		cfg.Wait(50 * time.Millisecond)
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	count := messageCount
 	mu.Unlock()
 
 	if count >= 3 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("expected at least 3 messages, got %d", count)
 	}
@@ -17,6 +17,7 @@ import (
 func PublishSubscribeTests() TestGroup {
 	return TestGroup{
 		Name: "Publish/Subscribe",
+		Tags: []string{"core", "retain"},
 		Tests: []TestFunc{
 			testBasicPubSub,
 			testMultipleSubscribers,
@@ -28,7 +29,7 @@ func PublishSubscribeTests() TestGroup {
 }
 
 // testBasicPubSub tests basic publish/subscribe [MQTT-3.3.1-1]
-func testBasicPubSub(cfg common.Config) TestResult {
+func testBasicPubSub(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Basic Publish/Subscribe",
@@ -47,7 +48,7 @@ func testBasicPubSub(cfg common.Config) TestResult {
 	}
 
 	// Create subscriber
-	sub, err := CreateAndConnectClient(cfg, "test-sub-basic", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-basic"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -56,10 +57,9 @@ func testBasicPubSub(cfg common.Config) TestResult {
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	// Subscribe
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/basic", QoS: 0},
+			{Topic: cfg.Topic("test/basic"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -69,7 +69,7 @@ func testBasicPubSub(cfg common.Config) TestResult {
 	}
 
 	// Create publisher
-	pub, err := CreateAndConnectClient(cfg, "test-pub-basic", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-basic"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -77,12 +77,9 @@ func testBasicPubSub(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	// Give subscriber time to be ready
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/basic",
+		Topic:   cfg.Topic("test/basic"),
 		QoS:     0,
 		Payload: []byte("test message"),
 	})
@@ -93,13 +90,13 @@ func testBasicPubSub(cfg common.Config) TestResult {
 	}
 
 	// Wait for message
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("message not received")
 	}
 
@@ -108,7 +105,7 @@ func testBasicPubSub(cfg common.Config) TestResult {
 }
 
 // testMultipleSubscribers tests multiple subscribers receiving messages
-func testMultipleSubscribers(cfg common.Config) TestResult {
+func testMultipleSubscribers(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Multiple Subscribers",
@@ -138,10 +135,9 @@ func testMultipleSubscribers(cfg common.Config) TestResult {
 		}
 		clients = append(clients, sub)
 
-		ctx := context.Background()
-		_, err = sub.Subscribe(ctx, &paho.Subscribe{
+		_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 			Subscriptions: []paho.SubscribeOptions{
-				{Topic: "test/multi", QoS: 0},
+				{Topic: cfg.Topic("test/multi"), QoS: 0},
 			},
 		})
 		if err != nil {
@@ -157,7 +153,7 @@ func testMultipleSubscribers(cfg common.Config) TestResult {
 	}
 
 	// Create publisher
-	pub, err := CreateAndConnectClient(cfg, "test-pub-multi", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-multi"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -165,13 +161,9 @@ func testMultipleSubscribers(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	// Give subscribers time to be ready
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish message
-	ctx := context.Background()
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/multi",
+		Topic:   cfg.Topic("test/multi"),
 		QoS:     0,
 		Payload: []byte("broadcast message"),
 	})
@@ -182,7 +174,7 @@ func testMultipleSubscribers(cfg common.Config) TestResult {
 	}
 
 	// Wait for messages
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	// Check all received
 	mu.Lock()
@@ -196,7 +188,7 @@ func testMultipleSubscribers(cfg common.Config) TestResult {
 	}
 	mu.Unlock()
 
-	result.Passed = allReceived
+	result.Status = common.PassIf(allReceived)
 	result.Duration = time.Since(start)
 	return result
 }
@@ -204,24 +196,27 @@ func testMultipleSubscribers(cfg common.Config) TestResult {
 // testRetainedMessage tests retained message functionality [MQTT-3.3.1-5]
 // "When a new Non‑shared Subscription is made, the last retained message, if any,
 // on each matching topic name is sent to the Client"
-func testRetainedMessage(cfg common.Config) TestResult {
+func testRetainedMessage(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Retained Message",
 		SpecRef: "MQTT-3.3.1-5",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureRetain) {
+		return result
+	}
+
 	topic := fmt.Sprintf("test/retained/%d", time.Now().UnixNano())
 
 	// Publish a retained message
-	pub, err := CreateAndConnectClient(cfg, "test-pub-retained", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-retained"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	ctx := context.Background()
 	_, err = pub.Publish(ctx, &paho.Publish{
 		Topic:   topic,
 		QoS:     0,
@@ -237,7 +232,7 @@ func testRetainedMessage(cfg common.Config) TestResult {
 	pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	// Wait a moment for the message to be retained
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	// Subscribe with a new client - should receive the retained message
 	received := false
@@ -252,7 +247,7 @@ func testRetainedMessage(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-retained", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-retained"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -272,20 +267,20 @@ func testRetainedMessage(cfg common.Config) TestResult {
 	}
 
 	// Wait for retained message
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	// Clear the retained message
-	pub2, _ := CreateAndConnectClient(cfg, "test-pub-clear", nil)
+	pub2, _ := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-clear"), nil)
 	if pub2 != nil {
 		pub2.Publish(ctx, &paho.Publish{Topic: topic, QoS: 0, Retain: true, Payload: []byte{}})
 		pub2.Disconnect(&paho.Disconnect{ReasonCode: 0})
 	}
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("retained message not received")
 	}
 
@@ -295,7 +290,7 @@ func testRetainedMessage(cfg common.Config) TestResult {
 
 // testEmptyPayload tests publishing with empty payload
 // "A zero-byte Payload is valid"
-func testEmptyPayload(cfg common.Config) TestResult {
+func testEmptyPayload(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Empty Payload",
@@ -317,7 +312,7 @@ func testEmptyPayload(cfg common.Config) TestResult {
 	}
 
 	// Create subscriber
-	sub, err := CreateAndConnectClient(cfg, "test-sub-empty", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-empty"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -325,10 +320,9 @@ func testEmptyPayload(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/empty", QoS: 0},
+			{Topic: cfg.Topic("test/empty"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -338,7 +332,7 @@ func testEmptyPayload(cfg common.Config) TestResult {
 	}
 
 	// Create publisher
-	pub, err := CreateAndConnectClient(cfg, "test-pub-empty", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-empty"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -346,11 +340,9 @@ func testEmptyPayload(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish with empty payload
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/empty",
+		Topic:   cfg.Topic("test/empty"),
 		QoS:     0,
 		Payload: []byte{},
 	})
@@ -360,13 +352,13 @@ func testEmptyPayload(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received && receivedEmpty
+	result.Status = common.PassIf(received && receivedEmpty)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		if !received {
 			result.Error = fmt.Errorf("message not received")
 		} else {
@@ -381,7 +373,7 @@ func testEmptyPayload(cfg common.Config) TestResult {
 // testUnsubscribe tests unsubscribe functionality [MQTT-3.10.4-1]
 // "The Server MUST stop adding any new messages which match the Topic Filters,
 // for delivery to that Client"
-func testUnsubscribe(cfg common.Config) TestResult {
+func testUnsubscribe(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Unsubscribe",
@@ -399,7 +391,7 @@ func testUnsubscribe(cfg common.Config) TestResult {
 	}
 
 	// Create subscriber
-	sub, err := CreateAndConnectClient(cfg, "test-sub-unsub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-unsub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -407,10 +399,9 @@ func testUnsubscribe(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/unsub", QoS: 0},
+			{Topic: cfg.Topic("test/unsub"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -420,7 +411,7 @@ func testUnsubscribe(cfg common.Config) TestResult {
 	}
 
 	// Create publisher
-	pub, err := CreateAndConnectClient(cfg, "test-pub-unsub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-unsub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -428,11 +419,9 @@ func testUnsubscribe(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish first message
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/unsub",
+		Topic:   cfg.Topic("test/unsub"),
 		QoS:     0,
 		Payload: []byte("message 1"),
 	})
@@ -442,11 +431,11 @@ func testUnsubscribe(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Unsubscribe
 	_, err = sub.Unsubscribe(ctx, &paho.Unsubscribe{
-		Topics: []string{"test/unsub"},
+		Topics: []string{cfg.Topic("test/unsub")},
 	})
 	if err != nil {
 		result.Error = fmt.Errorf("unsubscribe failed: %w", err)
@@ -454,11 +443,11 @@ func testUnsubscribe(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	// Publish second message - should NOT be received
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/unsub",
+		Topic:   cfg.Topic("test/unsub"),
 		QoS:     0,
 		Payload: []byte("message 2"),
 	})
@@ -468,15 +457,15 @@ func testUnsubscribe(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	count := messageCount
 	mu.Unlock()
 
 	// Should have received exactly 1 message (before unsubscribe)
-	result.Passed = (count == 1)
-	if !result.Passed {
+	result.Status = common.PassIf(count == 1)
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("expected 1 message, got %d", count)
 	}
 
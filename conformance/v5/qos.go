@@ -1,12 +1,14 @@
 package v5
 
 import (
+	"github.com/bromq-dev/testmqtt/conformance/assert"
 	"github.com/bromq-dev/testmqtt/conformance/common"
 )
 
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -17,6 +19,7 @@ import (
 func QoSTests() TestGroup {
 	return TestGroup{
 		Name: "QoS",
+		Tags: []string{"qos"},
 		Tests: []TestFunc{
 			testQoS0,
 			testQoS1,
@@ -24,6 +27,8 @@ func QoSTests() TestGroup {
 			testQoS1Duplicate,
 			testQoS2ExactlyOnce,
 			testPacketIdentifier,
+			testConcurrentPublishers,
+			testMessageOrderingMixedQoS,
 		},
 	}
 }
@@ -31,7 +36,7 @@ func QoSTests() TestGroup {
 // testQoS0 tests QoS 0 message delivery [MQTT-4.3.1-1]
 // "The receiver does not respond to the message and does not make any attempt
 // at re-delivery"
-func testQoS0(cfg common.Config) TestResult {
+func testQoS0(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "QoS 0 Delivery",
@@ -50,7 +55,7 @@ func testQoS0(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-qos0", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-qos0"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -58,10 +63,9 @@ func testQoS0(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/qos0", QoS: 0},
+			{Topic: cfg.Topic("test/qos0"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -70,7 +74,7 @@ func testQoS0(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-qos0", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-qos0"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -78,10 +82,8 @@ func testQoS0(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/qos0",
+		Topic:   cfg.Topic("test/qos0"),
 		QoS:     0,
 		Payload: []byte("qos 0 message"),
 	})
@@ -91,14 +93,12 @@ func testQoS0(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
-
-	mu.Lock()
-	result.Passed = received
-	mu.Unlock()
-
-	if !result.Passed {
-		result.Error = fmt.Errorf("QoS 0 message not received")
+	if assert.Eventually(&result, cfg, "QoS 0 message received", 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}) {
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -107,13 +107,17 @@ func testQoS0(cfg common.Config) TestResult {
 
 // testQoS1 tests QoS 1 message delivery [MQTT-4.3.2-1]
 // "The receiver sends a PUBACK packet in response to a PUBLISH packet"
-func testQoS1(cfg common.Config) TestResult {
+func testQoS1(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "QoS 1 Delivery",
 		SpecRef: "MQTT-4.3.2-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
 	received := false
 	var mu sync.Mutex
 
@@ -126,7 +130,7 @@ func testQoS1(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-qos1", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-qos1"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -134,10 +138,9 @@ func testQoS1(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/qos1", QoS: 1},
+			{Topic: cfg.Topic("test/qos1"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -146,7 +149,7 @@ func testQoS1(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-qos1", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-qos1"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -154,10 +157,8 @@ func testQoS1(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/qos1",
+		Topic:   cfg.Topic("test/qos1"),
 		QoS:     1,
 		Payload: []byte("qos 1 message"),
 	})
@@ -167,14 +168,12 @@ func testQoS1(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
-
-	mu.Lock()
-	result.Passed = received
-	mu.Unlock()
-
-	if !result.Passed {
-		result.Error = fmt.Errorf("QoS 1 message not received")
+	if assert.Eventually(&result, cfg, "QoS 1 message received", 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}) {
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -184,13 +183,17 @@ func testQoS1(cfg common.Config) TestResult {
 // testQoS2 tests QoS 2 message delivery [MQTT-4.3.3-1]
 // "This is the highest QoS level, for use when neither loss nor duplication
 // of messages are acceptable"
-func testQoS2(cfg common.Config) TestResult {
+func testQoS2(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "QoS 2 Delivery",
 		SpecRef: "MQTT-4.3.3-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
 	received := false
 	var mu sync.Mutex
 
@@ -203,7 +206,7 @@ func testQoS2(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-qos2", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-qos2"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -211,10 +214,9 @@ func testQoS2(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/qos2", QoS: 2},
+			{Topic: cfg.Topic("test/qos2"), QoS: 2},
 		},
 	})
 	if err != nil {
@@ -223,7 +225,7 @@ func testQoS2(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-qos2", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-qos2"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -231,10 +233,8 @@ func testQoS2(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/qos2",
+		Topic:   cfg.Topic("test/qos2"),
 		QoS:     2,
 		Payload: []byte("qos 2 message"),
 	})
@@ -244,14 +244,12 @@ func testQoS2(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
-
-	mu.Lock()
-	result.Passed = received
-	mu.Unlock()
-
-	if !result.Passed {
-		result.Error = fmt.Errorf("QoS 2 message not received")
+	if assert.Eventually(&result, cfg, "QoS 2 message received", 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}) {
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -260,13 +258,17 @@ func testQoS2(cfg common.Config) TestResult {
 
 // testQoS1Duplicate tests QoS 1 duplicate handling
 // Tests that messages can be delivered with QoS 1
-func testQoS1Duplicate(cfg common.Config) TestResult {
+func testQoS1Duplicate(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "QoS 1 At Least Once",
 		SpecRef: "MQTT-4.3.2-2",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
 	receivedCount := 0
 	var mu sync.Mutex
 
@@ -277,7 +279,7 @@ func testQoS1Duplicate(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-qos1-dup", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-qos1-dup"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -285,10 +287,9 @@ func testQoS1Duplicate(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/qos1/dup", QoS: 1},
+			{Topic: cfg.Topic("test/qos1/dup"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -297,7 +298,7 @@ func testQoS1Duplicate(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-qos1-dup", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-qos1-dup"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -305,10 +306,8 @@ func testQoS1Duplicate(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/qos1/dup",
+		Topic:   cfg.Topic("test/qos1/dup"),
 		QoS:     1,
 		Payload: []byte("qos 1 at-least-once"),
 	})
@@ -318,16 +317,13 @@ func testQoS1Duplicate(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
-
-	mu.Lock()
-	count := receivedCount
-	mu.Unlock()
-
 	// Should receive at least one message
-	result.Passed = (count >= 1)
-	if !result.Passed {
-		result.Error = fmt.Errorf("expected at least 1 message, got %d", count)
+	if assert.Eventually(&result, cfg, "QoS 1 message received", 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return receivedCount >= 1
+	}) {
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -336,13 +332,17 @@ func testQoS1Duplicate(cfg common.Config) TestResult {
 
 // testQoS2ExactlyOnce tests QoS 2 exactly-once delivery
 // Verifies that QoS 2 messages are delivered exactly once
-func testQoS2ExactlyOnce(cfg common.Config) TestResult {
+func testQoS2ExactlyOnce(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "QoS 2 Exactly-Once",
 		SpecRef: "MQTT-4.3.3-2",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
 	receivedCount := 0
 	var mu sync.Mutex
 
@@ -353,7 +353,7 @@ func testQoS2ExactlyOnce(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-qos2-once", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-qos2-once"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -361,10 +361,9 @@ func testQoS2ExactlyOnce(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/qos2/once", QoS: 2},
+			{Topic: cfg.Topic("test/qos2/once"), QoS: 2},
 		},
 	})
 	if err != nil {
@@ -373,7 +372,7 @@ func testQoS2ExactlyOnce(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-qos2-once", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-qos2-once"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -381,10 +380,8 @@ func testQoS2ExactlyOnce(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/qos2/once",
+		Topic:   cfg.Topic("test/qos2/once"),
 		QoS:     2,
 		Payload: []byte("qos 2 exactly-once"),
 	})
@@ -394,16 +391,13 @@ func testQoS2ExactlyOnce(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(1 * time.Second)
-
-	mu.Lock()
-	count := receivedCount
-	mu.Unlock()
-
 	// Should receive exactly one message
-	result.Passed = (count == 1)
-	if !result.Passed {
-		result.Error = fmt.Errorf("expected exactly 1 message, got %d", count)
+	if assert.ReceivedExactly(&result, cfg, "QoS 2 messages received", 1, 2*time.Second, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return receivedCount
+	}) {
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -414,16 +408,20 @@ func testQoS2ExactlyOnce(cfg common.Config) TestResult {
 // "Each time a Client sends a new SUBSCRIBE, UNSUBSCRIBE, or PUBLISH (where QoS > 0)
 // MQTT Control Packet it MUST assign it a non-zero Packet Identifier that is
 // currently unused"
-func testPacketIdentifier(cfg common.Config) TestResult {
+func testPacketIdentifier(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Packet Identifier Assignment",
 		SpecRef: "MQTT-2.2.1-3",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
 	// The paho client library handles packet identifiers automatically
 	// We test that multiple QoS > 0 publishes work correctly
-	pub, err := CreateAndConnectClient(cfg, "test-pub-pktid", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-pktid"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -431,12 +429,10 @@ func testPacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Publish multiple QoS 1 messages
 	for i := 0; i < 5; i++ {
 		_, err = pub.Publish(ctx, &paho.Publish{
-			Topic:   fmt.Sprintf("test/pktid/%d", i),
+			Topic:   cfg.Topic(fmt.Sprintf("test/pktid/%d", i)),
 			QoS:     1,
 			Payload: []byte(fmt.Sprintf("message %d", i)),
 		})
@@ -447,7 +443,163 @@ func testPacketIdentifier(cfg common.Config) TestResult {
 		}
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testConcurrentPublishers tests that messages from several clients
+// publishing to one topic at once each reach a subscriber complete and in
+// the order their publisher sent them [MQTT-4.6.0-5]
+// "it MUST send PUBLISH packets to consumers (for the same Topic and QoS) in
+// the order that they were received from any given Client"
+func testConcurrentPublishers(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Concurrent Publishers Message Integrity",
+		SpecRef: "MQTT-4.6.0-5",
+	}
+
+	delivery, err := common.CheckConcurrentPublishers(cfg, 5)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Notes = delivery.String()
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testMessageOrderingMixedQoS tests that interleaved QoS 0, 1 and 2 messages
+// on one topic keep their order within each QoS level [MQTT-4.6.0-5]
+// "it MUST send PUBLISH packets to consumers (for the same Topic and QoS) in
+// the order that they were received from any given Client"
+func testMessageOrderingMixedQoS(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Message Ordering Mixed QoS",
+		SpecRef: "MQTT-4.6.0-5",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
+	type delivery struct {
+		qos byte
+		seq int
+	}
+
+	var mu sync.Mutex
+	var received []delivery
+	onPublish := func(pr paho.PublishReceived) (bool, error) {
+		var d delivery
+		if _, err := fmt.Sscanf(string(pr.Packet.Payload), "qos%d-msg%d", &d.qos, &d.seq); err != nil {
+			return true, nil
+		}
+		mu.Lock()
+		received = append(received, d)
+		mu.Unlock()
+		return true, nil
+	}
+
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-order-mixed"), onPublish)
+	if err != nil {
+		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	topic := cfg.Topic("test/order/mixed")
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: 2}},
+	})
+	if err != nil {
+		result.Error = fmt.Errorf("subscribe failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-order-mixed-pub"), nil)
+	if err != nil {
+		result.Error = fmt.Errorf("publisher connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	// Publish QoS 0, 1, 2, 0, 1, 2, ... without waiting for acknowledgements
+	const total = 15
+	for i := 1; i <= total; i++ {
+		qos := byte(i % 3)
+		_, err := pub.PublishWithOptions(ctx, &paho.Publish{
+			Topic:   topic,
+			QoS:     qos,
+			Payload: []byte(fmt.Sprintf("qos%d-msg%d", qos, i)),
+		}, paho.PublishOptions{Method: paho.PublishMethod_AsyncSend})
+		if err != nil {
+			result.Error = fmt.Errorf("publish %d failed: %w", i, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	// QoS 0 messages may be lost, so the wait is for the last QoS 1 and
+	// QoS 2 ones, 13 and 14
+	if !assert.Eventually(&result, cfg, "last QoS 1 and QoS 2 messages", 5*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Contains(received, delivery{1, total - 2}) && slices.Contains(received, delivery{2, total - 1})
+	}) {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Within each QoS level the sequence numbers must only go up. QoS 1 may
+	// repeat the last message, QoS 0 may lose messages.
+	last := map[byte]int{}
+	count := map[byte]int{}
+	interleaved := true
+	prev := 0
+	for _, d := range received {
+		switch {
+		case d.seq < last[d.qos]:
+			result.Error = fmt.Errorf("QoS %d message %d received after message %d: %v", d.qos, d.seq, last[d.qos], received)
+			result.Duration = time.Since(start)
+			return result
+		case d.seq == last[d.qos] && d.qos != 1:
+			result.Error = fmt.Errorf("QoS %d message %d received twice: %v", d.qos, d.seq, received)
+			result.Duration = time.Since(start)
+			return result
+		case d.seq > last[d.qos]:
+			count[d.qos]++
+		}
+		last[d.qos] = d.seq
+		if d.seq < prev {
+			interleaved = false
+		}
+		prev = d.seq
+	}
+
+	for _, qos := range []byte{1, 2} {
+		if count[qos] != total/3 {
+			result.Error = fmt.Errorf("received %d of %d QoS %d messages", count[qos], total/3, qos)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	result.Status = common.StatusPassed
+	if !interleaved {
+		result.Notes = "messages of different QoS were reordered relative to each other, which the spec allows"
+	}
 	result.Duration = time.Since(start)
 	return result
 }
@@ -0,0 +1,268 @@
+package v5
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/assert"
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+const reasonQuotaExceeded = 0x97
+
+// QuotaTests returns tests that push the broker towards its quotas and check
+// it reports reaching them with 0x97 (Quota exceeded) rather than dropping
+// messages silently. How hard they push is set with Config.Quota.
+func QuotaTests() TestGroup {
+	return TestGroup{
+		Name: "Quota Exceeded",
+		Tags: []string{"optional", "quota", "flow-control"},
+		Tests: []TestFunc{
+			testQuotaPublishFlood,
+			testQuotaInflight,
+		},
+	}
+}
+
+// quotaOutcome is how the broker reacted to a run of PUBLISHes
+type quotaOutcome struct {
+	sent         int  // PUBLISHes sent
+	refusal      byte // Reason code of the first acknowledgement >= 0x80, 0 if none
+	refusedAt    int  // Which PUBLISH was refused, counting from 1
+	disconnect   byte // DISCONNECT reason code
+	disconnected bool // A DISCONNECT arrived
+	closed       bool // The connection closed, with or without a DISCONNECT
+}
+
+// hitLimit reports whether the broker refused anything or ended the
+// connection
+func (o quotaOutcome) hitLimit() bool {
+	return o.refusal >= 0x80 || o.disconnected || o.closed
+}
+
+// checkQuota fills in result for an outcome that hit a limit, with ack the
+// packet that reports the quota. 0x97 passes; other refusals and closing
+// the connection are warnings.
+func checkQuota(o quotaOutcome, ack string, result *TestResult) {
+	switch {
+	case o.refusal == reasonQuotaExceeded:
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("%s 0x97 (Quota exceeded) for PUBLISH %d of %d", ack, o.refusedAt, o.sent)
+	case o.disconnected && o.disconnect == reasonQuotaExceeded:
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("DISCONNECT 0x97 (Quota exceeded) after %d PUBLISHes", o.sent)
+	case o.refusal >= 0x80:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker refused PUBLISH %d with %s %s rather than %s", o.refusedAt, ack, assert.ReasonName(o.refusal), assert.ReasonName(reasonQuotaExceeded))
+	case o.disconnected:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker disconnected with %s rather than %s after %d PUBLISHes", assert.ReasonName(o.disconnect), assert.ReasonName(reasonQuotaExceeded), o.sent)
+	default:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker closed the connection after %d PUBLISHes without reporting 0x97 (Quota exceeded)", o.sent)
+	}
+}
+
+// awaitAck reads the next acknowledgement of type ackType for o, recording a
+// refusal or the connection ending. It returns false once the connection
+// has ended.
+func awaitAck(conn *common.RawConn, ackType byte, timeout time.Duration, o *quotaOutcome, acked *int) (bool, error) {
+	_, ack, err := conn.Expect(ackType, timeout, func(header byte, body []byte) {
+		if header == 0xE0 {
+			o.disconnected = true
+			if len(body) > 0 {
+				o.disconnect = body[0]
+			}
+		}
+	})
+	switch {
+	case errors.Is(err, common.ErrBrokerClosed):
+		o.closed = true
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	*acked++
+	if len(ack) > 2 && ack[2] >= 0x80 && o.refusal == 0 {
+		o.refusal, o.refusedAt = ack[2], *acked
+	}
+	return true, nil
+}
+
+// testQuotaPublishFlood tests that a broker whose quota a flood of QoS 1
+// PUBLISHes exhausts refuses them with PUBACK 0x97 (Quota exceeded), and
+// that a broker which acknowledges them all delivers them all [MQTT-3.4.2.1]
+func testQuotaPublishFlood(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Publish Flood Reports Quota Exceeded",
+		SpecRef: "MQTT-3.4.2.1",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
+	topic := cfg.Topic("test/quota/flood")
+	timeout := cfg.Scaled(5 * time.Second)
+	count, configured := cfg.Quota.FloodMessages()
+
+	sub, err := common.DialRaw(cfg, 5, cfg.ClientID("test-quota-flood-sub"))
+	if err != nil {
+		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Close()
+	if codes, err := sub.Subscribe(1, 1, timeout, topic); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		result.Error = fmt.Errorf("subscribe failed: % x %v", codes, err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// Count and acknowledge deliveries until the subscriber is closed
+	var delivered atomic.Int64
+	go func() {
+		for {
+			header, body, err := common.ReadRawPacket(sub)
+			if err != nil {
+				return
+			}
+			if header&0xF0 != 0x30 {
+				continue
+			}
+			p, err := sub.ParsePublish(header, body)
+			if err != nil || p.Topic != topic {
+				continue
+			}
+			delivered.Add(1)
+			if p.QoS == 1 {
+				sub.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+			}
+		}
+	}()
+
+	pub, err := common.DialRaw(cfg, 5, cfg.ClientID("test-quota-flood-pub"))
+	if err != nil {
+		result.Error = fmt.Errorf("publisher connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer pub.Close()
+
+	// Keep as many PUBLISHes in flight as Receive Maximum allows
+	var o quotaOutcome
+	outstanding, acked, open := 0, 0, true
+	for o.sent < count && open && o.refusal == 0 {
+		if outstanding == int(pub.ReceiveMaximum) {
+			if open, err = awaitAck(pub, 0x40, timeout, &o, &acked); err != nil {
+				result.Error = err
+				result.Duration = time.Since(start)
+				return result
+			}
+			outstanding--
+			continue
+		}
+		if err := pub.Publish(topic, 1, uint16(o.sent%65535+1), []byte(fmt.Sprintf("flood %d", o.sent))); err != nil {
+			o.closed, open = true, false
+			break
+		}
+		o.sent++
+		outstanding++
+	}
+	for ; outstanding > 0 && open; outstanding-- {
+		if open, err = awaitAck(pub, 0x40, timeout, &o, &acked); err != nil {
+			result.Error = err
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	if o.hitLimit() {
+		checkQuota(o, "PUBACK", &result)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// Every PUBLISH was accepted, so every one must arrive
+	for deadline := time.Now().Add(timeout); delivered.Load() < int64(o.sent) && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	switch got := delivered.Load(); {
+	case got < int64(o.sent):
+		result.Error = fmt.Errorf("broker acknowledged all %d PUBLISHes with success but delivered %d", o.sent, got)
+	case configured:
+		result.Error = fmt.Errorf("broker accepted and delivered all %d PUBLISHes without reporting 0x97 (Quota exceeded)", o.sent)
+	default:
+		result.Status = common.StatusInconclusive
+		result.Notes = fmt.Sprintf("no quota reached with %d PUBLISHes (set --quota-messages to the broker's limit)", o.sent)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testQuotaInflight tests that a broker whose quota unreleased QoS 2
+// PUBLISHes exhaust refuses them with PUBREC 0x97 (Quota exceeded)
+// [MQTT-3.5.2.1]. No more are sent than the broker's Receive Maximum.
+func testQuotaInflight(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Unreleased QoS 2 Inflight Reports Quota Exceeded",
+		SpecRef: "MQTT-3.5.2.1",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS2) {
+		return result
+	}
+
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-quota-inflight"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	count, configured := cfg.Quota.InflightMessages()
+	count = min(count, int(conn.ReceiveMaximum))
+
+	// Send them all before reading, the PUBRECs do not end the flows
+	topic := cfg.Topic("test/quota/inflight")
+	var o quotaOutcome
+	for o.sent < count {
+		if err := conn.Publish(topic, 2, uint16(o.sent+1), []byte(fmt.Sprintf("inflight %d", o.sent))); err != nil {
+			o.closed = true
+			break
+		}
+		o.sent++
+	}
+	acked := 0
+	for open := !o.closed; open && acked < o.sent; {
+		if open, err = awaitAck(conn, 0x50, cfg.Scaled(5*time.Second), &o, &acked); err != nil {
+			result.Error = err
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	switch {
+	case o.hitLimit():
+		checkQuota(o, "PUBREC", &result)
+	case configured && count < cfg.Quota.Inflight:
+		result.Status = common.StatusInconclusive
+		result.Notes = fmt.Sprintf("Receive Maximum %d is below the configured %d, no quota reached", count, cfg.Quota.Inflight)
+	case configured:
+		result.Error = fmt.Errorf("broker accepted %d unreleased QoS 2 PUBLISHes without reporting 0x97 (Quota exceeded)", o.sent)
+	default:
+		result.Status = common.StatusInconclusive
+		result.Notes = fmt.Sprintf("no quota reached with %d unreleased QoS 2 PUBLISHes, the broker's Receive Maximum (set --quota-inflight to the broker's limit)", o.sent)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,249 @@
+package v5
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/assert"
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// rawSession is a raw connection for tests that break the protocol on
+// purpose, e.g. with a malformed CONNECT or a packet with reserved flags.
+// Its Expect methods hold the pass criteria those tests share, so each of
+// them judges the broker's answer the same way.
+type rawSession struct {
+	conn net.Conn
+	cfg  common.Config
+
+	// closed is set when a write failed, the broker having closed the
+	// connection already
+	closed bool
+}
+
+// dialRawSession connects to the broker without sending anything
+func dialRawSession(cfg common.Config) (*rawSession, error) {
+	conn, err := common.Dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &rawSession{conn: conn, cfg: cfg}, nil
+}
+
+// rawSessionOn is a rawSession over a connection DialRaw made, for tests
+// that need what the broker's CONNACK said or look at the session afterwards
+func rawSessionOn(cfg common.Config, conn *common.RawConn) *rawSession {
+	return &rawSession{conn: conn, cfg: cfg}
+}
+
+// Close closes the connection
+func (s *rawSession) Close() error {
+	return s.conn.Close()
+}
+
+// Send writes a packet given in full, fixed header included. A write that
+// fails because the broker closed the connection is what the Expect methods
+// then report, so it is not returned.
+func (s *rawSession) Send(packet []byte) {
+	s.conn.SetWriteDeadline(time.Now().Add(s.cfg.Scaled(5 * time.Second)))
+	if _, err := s.conn.Write(packet); err != nil {
+		s.closed = true
+	}
+}
+
+// Connect sends a valid CONNECT with the configured credentials and fails
+// unless the broker accepts it
+func (s *rawSession) Connect(clientID string) error {
+	s.Send(common.RawConnect(5, clientID, s.cfg.Username, s.cfg.Password))
+	code, err := s.ExpectConnack()
+	if err != nil {
+		return fmt.Errorf("valid CONNECT: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("valid CONNECT refused with reason code %s", assert.ReasonName(code))
+	}
+	return nil
+}
+
+// ExpectConnack reads the broker's answer to a CONNECT and returns the
+// CONNACK reason code. It returns common.ErrBrokerClosed when the broker
+// closed the connection instead.
+func (s *rawSession) ExpectConnack() (byte, error) {
+	if s.closed {
+		return 0, common.ErrBrokerClosed
+	}
+	timeout := s.cfg.Scaled(5 * time.Second)
+	s.conn.SetReadDeadline(time.Now().Add(timeout))
+	header, body, err := common.ReadRawPacket(s.conn)
+	switch {
+	case isTimeout(err):
+		return 0, fmt.Errorf("no CONNACK within %v", timeout)
+	case err != nil:
+		return 0, common.ErrBrokerClosed
+	case header != 0x20 || len(body) < 2:
+		return 0, fmt.Errorf("expected CONNACK, got %s", common.PacketName(header))
+	}
+	return body[1], nil
+}
+
+// ExpectConnectRefused checks the broker refused the CONNECT just sent,
+// either with a CONNACK reason code of 0x80 or above or by closing the
+// connection without one
+func (s *rawSession) ExpectConnectRefused() error {
+	code, err := s.ExpectConnack()
+	switch {
+	case errors.Is(err, common.ErrBrokerClosed):
+		return nil
+	case err != nil:
+		return err
+	case code < 0x80:
+		return fmt.Errorf("CONNACK reason code %s", assert.ReasonName(code))
+	}
+	return nil
+}
+
+// refusal is how a raw test expects the broker to refuse a packet: a
+// DISCONNECT with a reason code in want passes and one in also is a warning,
+// since brokers draw the line between Malformed Packet, Protocol Error and the
+// more specific codes differently. Any other reason code fails. Closing the
+// connection without a DISCONNECT is a warning, the broker being only
+// advised to send one [MQTT-4.13.1-1], except when want is empty: before its
+// CONNACK the broker may not send DISCONNECT [MQTT-3.14.0-1], so closing is
+// the refusal then.
+type refusal struct {
+	want []byte
+	also []byte
+}
+
+// Refusals of packets that are malformed, or well formed but break a
+// protocol rule, which take either reason code with a warning
+var (
+	refuseMalformed     = refusal{want: []byte{reasonMalformedPacket}, also: []byte{reasonProtocolError}}
+	refuseProtocolError = refusal{want: []byte{reasonProtocolError}, also: []byte{reasonMalformedPacket}}
+)
+
+// expected names the reason codes r passes, e.g. "0x81 (Malformed Packet)"
+func (r refusal) expected() string {
+	names := make([]string, len(r.want))
+	for i, code := range r.want {
+		names[i] = assert.ReasonName(code)
+	}
+	return strings.Join(names, " or ")
+}
+
+// errStillOpen is what judge returns when the broker neither answered nor
+// closed the connection
+var errStillOpen = errors.New("broker kept the connection open")
+
+// rawAnswer is what the broker sent after a packet, up to closing the
+// connection or a timeout
+type rawAnswer struct {
+	header byte // First packet the broker sent, 0 when none
+	body   []byte
+	closed bool // Whether the broker closed the connection
+}
+
+// reason returns the reason code of a DISCONNECT, 0x00 (Normal
+// disconnection) when it has none
+func (a rawAnswer) reason() byte {
+	if len(a.body) == 0 {
+		return 0
+	}
+	return a.body[0]
+}
+
+// judge says whether a is the refusal r describes. It returns a note when
+// the broker refused in a way that is allowed but not the expected one, and
+// an error when it did not refuse.
+func (a rawAnswer) judge(r refusal) (string, error) {
+	switch {
+	case a.header == 0xE0 && !a.closed:
+		return "", fmt.Errorf("broker sent DISCONNECT %s but kept the connection open", assert.ReasonName(a.reason()))
+	case a.header == 0xE0 && len(r.want) == 0:
+		return "", fmt.Errorf("broker sent DISCONNECT %s before a CONNACK", assert.ReasonName(a.reason()))
+	case a.header == 0xE0 && slices.Contains(r.want, a.reason()):
+		return "", nil
+	case a.header == 0xE0 && slices.Contains(r.also, a.reason()):
+		return fmt.Sprintf("broker disconnected with %s rather than %s", assert.ReasonName(a.reason()), r.expected()), nil
+	case a.header == 0xE0:
+		return "", fmt.Errorf("broker sent DISCONNECT %s, expected %s", assert.ReasonName(a.reason()), r.expected())
+	case a.header != 0:
+		return "", fmt.Errorf("broker answered with %s instead of disconnecting", common.PacketName(a.header))
+	case a.closed && len(r.want) == 0:
+		return "", nil
+	case a.closed:
+		return fmt.Sprintf("broker closed the connection without sending DISCONNECT %s", r.expected()), nil
+	default:
+		return "", errStillOpen
+	}
+}
+
+// Answer reads what the broker sends after the packet just sent until it
+// closes the connection or timeout passes, passing over packets whose
+// fixed header is in skip, e.g. the PUBRECs for PUBLISHes sent before
+func (s *rawSession) Answer(timeout time.Duration, skip ...byte) rawAnswer {
+	if s.closed {
+		return rawAnswer{closed: true}
+	}
+	data, closed := common.AwaitClose(s.conn, s.cfg.Scaled(timeout))
+	r := bytes.NewReader(data)
+	for {
+		header, body, err := common.ReadRawPacket(r)
+		if err != nil {
+			return rawAnswer{closed: closed}
+		}
+		if !slices.Contains(skip, header) {
+			return rawAnswer{header: header, body: body, closed: closed}
+		}
+	}
+}
+
+// grade fills in result by whether a is the refusal r describes: passed, a
+// warning with a note, or an error
+func (a rawAnswer) grade(r refusal, result *TestResult) {
+	note, err := a.judge(r)
+	switch {
+	case err != nil:
+		result.Error = err
+	case note != "":
+		result.Status = common.StatusWarning
+		result.Notes = note
+	default:
+		result.Status = common.StatusPassed
+	}
+}
+
+// ExpectRefusal fills in result by how the broker refuses the packet just
+// sent, as r describes
+func (s *rawSession) ExpectRefusal(r refusal, result *TestResult) {
+	s.Answer(2*time.Second).grade(r, result)
+}
+
+// expectRefused connects over a rawSession, sends packet and fills in result
+// by how the broker refuses it, as r describes
+func expectRefused(cfg common.Config, clientPrefix string, packet []byte, r refusal, result *TestResult) {
+	s, err := dialRawSession(cfg)
+	if err != nil {
+		result.Error = err
+		return
+	}
+	defer s.Close()
+
+	if err := s.Connect(cfg.ClientID(clientPrefix)); err != nil {
+		result.Error = err
+		return
+	}
+	s.Send(packet)
+	s.ExpectRefusal(r, result)
+}
+
+// isTimeout reports whether err is a read deadline passing
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
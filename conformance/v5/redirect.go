@@ -0,0 +1,121 @@
+package v5
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/assert"
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// ServerRedirectionTests returns tests of a broker sending a client to
+// another server, which needs to be set up for them and described with
+// Config.Redirect. Without a redirected client they are skipped.
+func ServerRedirectionTests() TestGroup {
+	return TestGroup{
+		Name: "Server Redirection",
+		Tags: []string{"optional", "redirect"},
+		Tests: []TestFunc{
+			testServerRedirect,
+			testServerRedirectFollowed,
+		},
+	}
+}
+
+// testServerRedirect tests that the redirected client is sent away with
+// 0x9C Use another server or 0x9D Server moved, in its CONNACK or in a
+// DISCONNECT right after it, and a Server Reference naming where to go
+// [MQTT-4.11] "When sending one of these Reason Codes, the Server MAY also
+// include a Server Reference property to indicate the location of the Server
+// or Servers the Client SHOULD use". A redirection without a Server
+// Reference is a warning.
+func testServerRedirect(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Server Reference Redirect",
+		SpecRef: "MQTT-4.11",
+	}
+
+	if common.SkipWithoutRedirect(cfg, &result) {
+		return result
+	}
+
+	r, err := common.TryRedirect(cfg)
+	switch {
+	case err != nil:
+		result.Error = err
+	case !r.Redirected():
+		assert.Fail(&result, cfg, r.Packet+" reason code", "0x9c (Use another server) or 0x9d (Server moved)", assert.ReasonName(r.Reason))
+	case r.Reference == "":
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("%s %s without a Server Reference", r.Packet, assert.ReasonName(r.Reason))
+	default:
+		refs, err := common.ServerReferences(r.Reference, cfg.Broker)
+		if err != nil {
+			result.Error = fmt.Errorf("%s %s: %w", r.Packet, assert.ReasonName(r.Reason), err)
+			break
+		}
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("%s %s to %v", r.Packet, assert.ReasonName(r.Reason), refs)
+		if !r.Closed {
+			result.Status = common.StatusWarning
+			result.Notes += ", connection left open"
+		}
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testServerRedirectFollowed tests that the server the redirected client is
+// referred to accepts it and carries a QoS 1 message round trip, trying
+// each server the Server Reference lists in turn. It needs
+// Config.Redirect.Follow.
+func testServerRedirectFollowed(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Server Reference Followed",
+		SpecRef: "MQTT-4.11",
+	}
+
+	if common.SkipWithoutRedirect(cfg, &result) {
+		return result
+	}
+	if !cfg.Redirect.Follow {
+		result.Status = common.StatusSkipped
+		result.Notes = "following the redirect not enabled (--follow-redirect)"
+		return result
+	}
+
+	r, err := common.TryRedirect(cfg)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if !r.Redirected() || r.Reference == "" {
+		result.Status = common.StatusSkipped
+		result.Notes = fmt.Sprintf("no Server Reference to follow (%s %s)", r.Packet, assert.ReasonName(r.Reason))
+		return result
+	}
+	refs, err := common.ServerReferences(r.Reference, cfg.Broker)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	for _, ref := range refs {
+		if err = common.FollowRedirect(cfg, ref); err == nil {
+			result.Status = common.StatusPassed
+			result.Notes = fmt.Sprintf("round trip through %s", ref)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	result.Error = err
+	result.Duration = time.Since(start)
+	return result
+}
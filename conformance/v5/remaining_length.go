@@ -1,14 +1,13 @@
 package v5
 
 import (
+	"github.com/bromq-dev/testmqtt/conformance/assert"
 	"github.com/bromq-dev/testmqtt/conformance/common"
 )
 
 import (
 	"context"
 	"fmt"
-	"net"
-	"net/url"
 	"time"
 
 	"github.com/eclipse/paho.golang/paho"
@@ -18,12 +17,15 @@ import (
 func RemainingLengthTests() TestGroup {
 	return TestGroup{
 		Name: "Remaining Length Encoding",
+		Tags: []string{"packet-format"},
 		Tests: []TestFunc{
 			testRemainingLengthOneByte,
 			testRemainingLengthTwoBytes,
 			testRemainingLengthThreeBytes,
 			testRemainingLengthFourBytes,
 			testRemainingLengthMaximum,
+			testRemainingLengthFiveBytes,
+			testRemainingLengthMismatch,
 		},
 	}
 }
@@ -31,14 +33,14 @@ func RemainingLengthTests() TestGroup {
 // testRemainingLengthOneByte tests 1-byte remaining length (0-127) [MQTT-2.1.4-1]
 // "Remaining Length is encoded using a variable length encoding scheme which uses
 // a single byte for values up to 127"
-func testRemainingLengthOneByte(cfg common.Config) TestResult {
+func testRemainingLengthOneByte(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Remaining Length: 1 Byte (0-127)",
 		SpecRef: "MQTT-2.1.4-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-remlen-1byte", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-remlen-1byte"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -46,8 +48,6 @@ func testRemainingLengthOneByte(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Publish a small message that results in 1-byte remaining length
 	// PUBLISH packet with QoS 0, small topic and payload
 	_, err = client.Publish(ctx, &paho.Publish{
@@ -64,20 +64,20 @@ func testRemainingLengthOneByte(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testRemainingLengthTwoBytes tests 2-byte remaining length (128-16,383) [MQTT-2.1.4-2]
-func testRemainingLengthTwoBytes(cfg common.Config) TestResult {
+func testRemainingLengthTwoBytes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Remaining Length: 2 Bytes (128-16,383)",
 		SpecRef: "MQTT-2.1.4-2",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-remlen-2byte", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-remlen-2byte"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -85,8 +85,6 @@ func testRemainingLengthTwoBytes(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Publish a message with ~200 byte payload to trigger 2-byte encoding
 	payload := make([]byte, 200)
 	for i := range payload {
@@ -94,7 +92,7 @@ func testRemainingLengthTwoBytes(cfg common.Config) TestResult {
 	}
 
 	_, err = client.Publish(ctx, &paho.Publish{
-		Topic:   "test/topic",
+		Topic:   cfg.Topic("test/topic"),
 		QoS:     0,
 		Payload: payload,
 	})
@@ -105,20 +103,20 @@ func testRemainingLengthTwoBytes(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testRemainingLengthThreeBytes tests 3-byte remaining length (16,384-2,097,151) [MQTT-2.1.4-3]
-func testRemainingLengthThreeBytes(cfg common.Config) TestResult {
+func testRemainingLengthThreeBytes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Remaining Length: 3 Bytes (16,384-2,097,151)",
 		SpecRef: "MQTT-2.1.4-3",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-remlen-3byte", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-remlen-3byte"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -126,8 +124,6 @@ func testRemainingLengthThreeBytes(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Publish a message with ~20KB payload to trigger 3-byte encoding
 	payload := make([]byte, 20000)
 	for i := range payload {
@@ -135,7 +131,7 @@ func testRemainingLengthThreeBytes(cfg common.Config) TestResult {
 	}
 
 	_, err = client.Publish(ctx, &paho.Publish{
-		Topic:   "test/topic/three",
+		Topic:   cfg.Topic("test/topic/three"),
 		QoS:     0,
 		Payload: payload,
 	})
@@ -146,20 +142,20 @@ func testRemainingLengthThreeBytes(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testRemainingLengthFourBytes tests 4-byte remaining length (2,097,152-268,435,455) [MQTT-2.1.4-4]
-func testRemainingLengthFourBytes(cfg common.Config) TestResult {
+func testRemainingLengthFourBytes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Remaining Length: 4 Bytes (2,097,152-268,435,455)",
 		SpecRef: "MQTT-2.1.4-4",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-remlen-4byte", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-remlen-4byte"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -167,8 +163,6 @@ func testRemainingLengthFourBytes(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Publish a message with ~3MB payload to trigger 4-byte encoding
 	payload := make([]byte, 3*1024*1024)
 	for i := range payload {
@@ -176,7 +170,7 @@ func testRemainingLengthFourBytes(cfg common.Config) TestResult {
 	}
 
 	_, err = client.Publish(ctx, &paho.Publish{
-		Topic:   "test/topic/four",
+		Topic:   cfg.Topic("test/topic/four"),
 		QoS:     0,
 		Payload: payload,
 	})
@@ -184,106 +178,109 @@ func testRemainingLengthFourBytes(cfg common.Config) TestResult {
 	// This may fail if broker has packet size limits, which is acceptable
 	if err != nil {
 		// Check if it's a size-related error (acceptable)
-		result.Passed = true // Broker enforcing limits is OK
+		result.Status = common.StatusPassed // Broker enforcing limits is OK
 		result.Error = nil
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
 	return result
 }
 
-// testRemainingLengthMaximum tests maximum remaining length value [MQTT-2.1.4-5]
-// "The maximum number of bytes in the Remaining Length field is four"
-func testRemainingLengthMaximum(cfg common.Config) TestResult {
+// testRemainingLengthMaximum tests a PUBLISH declaring the largest Remaining
+// Length, 268,435,455, of which only the start is sent. The encoding is valid,
+// so the broker must not call it malformed: without a Maximum Packet Size it
+// waits for the rest, with one it should refuse the packet as too large
+// [MQTT-3.2.2-15]
+// "The Client MUST NOT send packets exceeding Maximum Packet Size to the
+// Server. If a Server receives a packet whose size exceeds this limit, this is
+// a Protocol Error, the Server uses DISCONNECT with Reason Code 0x95"
+func testRemainingLengthMaximum(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Remaining Length: Maximum Value (268,435,455)",
-		SpecRef: "MQTT-2.1.4-5",
+		SpecRef: "MQTT-3.2.2-15",
 	}
 
-	// Connect and try to send a packet that would exceed max remaining length
-	u, err := url.Parse(cfg.Broker)
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-remlen-max"))
 	if err != nil {
-		result.Error = fmt.Errorf("invalid broker URL: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
-
-	host := u.Host
-	if u.Port() == "" {
-		host = net.JoinHostPort(u.Hostname(), "1883")
-	}
-
-	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to dial broker: %w", err)
+		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
 	defer conn.Close()
 
-	// First send a valid CONNECT
-	connectPacket := []byte{
-		0x10,       // CONNECT
-		0x10,       // Remaining length 16
-		0x00, 0x04, // Protocol name length
-		'M', 'Q', 'T', 'T',
-		0x05,       // Protocol level 5
-		0x02,       // Clean start
-		0x00, 0x3C, // Keep alive 60
-		0x00,       // Properties length
-		0x00, 0x04, // Client ID length
-		't', 'e', 's', 't', // Client ID
+	packet := []byte{0x30, 0xFF, 0xFF, 0xFF, 0x7F}
+	packet = common.AppendString(packet, cfg.Topic("test/remlen/max"))
+	packet = append(packet, 0) // No properties
+	packet = append(packet, make([]byte, 1024)...)
+	s := rawSessionOn(cfg, conn)
+	s.Send(packet)
+	a := s.Answer(2 * time.Second)
+	limited := conn.MaximumPacketSize > 0
+	switch {
+	case a.header == 0xE0 && a.reason() == reasonMalformedPacket:
+		result.SpecRef = "MQTT-1.5.5"
+		result.Error = fmt.Errorf("broker treated the largest valid Remaining Length as malformed")
+	case a.header == 0xE0 && a.reason() == reasonPacketTooLarge && !limited:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker refused with %s without advertising a Maximum Packet Size", assert.ReasonName(reasonPacketTooLarge))
+	case a.header == 0 && !a.closed && limited:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker waited for a packet larger than its Maximum Packet Size %d", conn.MaximumPacketSize)
+	case a.header == 0 && !a.closed:
+		result.Status = common.StatusPassed
+		result.Notes = "broker accepted the encoding and waited for the rest of the packet"
+	default:
+		a.grade(refusal{want: []byte{reasonPacketTooLarge}}, &result)
+		if result.Status == common.StatusPassed {
+			result.Notes = fmt.Sprintf("refused with %s, Maximum Packet Size %d", assert.ReasonName(reasonPacketTooLarge), conn.MaximumPacketSize)
+		}
 	}
 
-	conn.SetDeadline(time.Now().Add(5 * time.Second))
-	_, err = conn.Write(connectPacket)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to write CONNECT: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
+	result.Duration = time.Since(start)
+	return result
+}
 
-	// Read CONNACK
-	response := make([]byte, 256)
-	n, err := conn.Read(response)
-	if err != nil || n == 0 {
-		// EOF here means broker rejected the CONNECT - that's also valid
-		result.Passed = true
-		result.Error = nil
-		result.Duration = time.Since(start)
-		return result
+// testRemainingLengthFiveBytes tests that a Remaining Length spread over five
+// bytes, zero padded with continuation bits, is malformed [MQTT-1.5.5-1]
+// "The encoded value MUST use the minimum number of bytes necessary to
+// represent the value"
+func testRemainingLengthFiveBytes(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Remaining Length: Over-long 5-Byte Encoding",
+		SpecRef: "MQTT-1.5.5-1",
 	}
 
-	// Try to craft a PUBLISH packet with invalid 5-byte remaining length encoding
-	// The spec says max is 4 bytes, so 5 bytes MUST be rejected
-	invalidPacket := []byte{
-		0x30,                         // PUBLISH QoS 0
-		0x80, 0x80, 0x80, 0x80, 0x01, // Invalid: 5-byte remaining length
-	}
+	// PINGREQ with a Remaining Length of 0 in five bytes
+	expectRefused(cfg, "test-remlen-5byte", []byte{0xC0, 0x80, 0x80, 0x80, 0x80, 0x00}, refuseMalformed, &result)
 
-	_, err = conn.Write(invalidPacket)
-	if err != nil {
-		result.Passed = true
-		result.Error = nil
-		result.Duration = time.Since(start)
-		return result
-	}
+	result.Duration = time.Since(start)
+	return result
+}
 
-	// Read response - should disconnect (EOF or DISCONNECT packet)
-	n, err = conn.Read(response)
-	if err != nil || n == 0 {
-		// Connection closed - broker correctly rejected (EOF is valid)
-		result.Passed = true
-		result.Error = nil
-	} else {
-		// Broker should have disconnected
-		result.Passed = false
-		result.Error = fmt.Errorf("broker accepted invalid 5-byte remaining length")
+// testRemainingLengthMismatch tests a SUBSCRIBE whose Remaining Length ends
+// partway through its Topic Filter, with the rest of the filter sent after
+// it. The string overruns the packet, which makes it malformed
+// [MQTT-4.13.1-1]
+// "When a Server detects a Malformed Packet or Protocol Error, and a Reason
+// Code is given in the specification, it MUST close the Network Connection"
+func testRemainingLengthMismatch(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Remaining Length Shorter Than Contents",
+		SpecRef: "MQTT-4.13.1-1",
 	}
 
+	body := []byte{0x00, 0x01, 0x00} // Packet Identifier 1, no properties
+	body = common.AppendString(body, cfg.Topic("test/remlen/mismatch"))
+	body = append(body, 0x01) // Subscription Options: QoS 1
+	packet := common.RawPacket(0x82, body[:7])
+	packet = append(packet, body[7:]...)
+	expectRefused(cfg, "test-remlen-mismatch", packet, refuseMalformed, &result)
+
 	result.Duration = time.Since(start)
 	return result
 }
@@ -0,0 +1,274 @@
+package v5
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// RequestResponseTests returns tests that run request/response flows
+// through the broker with a Requester and a Responder [MQTT-4.10]
+func RequestResponseTests() TestGroup {
+	return TestGroup{
+		Name: "Request/Response",
+		Tags: []string{"properties", "request-response"},
+		Tests: []TestFunc{
+			testRequestResponseRoundTrip,
+			testRequestResponseCorrelationSizes,
+			testRequestResponseBinaryCorrelation,
+			testRequestResponseConcurrent,
+		},
+	}
+}
+
+// startRequestResponse starts a responder echoing requests and a requester
+// waiting for its replies, both at qos, and returns the topic to send
+// requests to. Stop both when done.
+func startRequestResponse(cfg common.Config, clientPrefix string, qos byte) (*Requester, *Responder, string, error) {
+	requestTopic := cfg.Topic(common.GenerateTopicName("test/rpc/request"))
+
+	responder, err := StartResponder(cfg, ResponderConfig{
+		RequestTopic: requestTopic,
+		QoS:          qos,
+		ClientID:     cfg.ClientID(clientPrefix + "-responder"),
+	})
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	requester, err := StartRequester(cfg, RequesterConfig{
+		ResponseTopic: cfg.Topic(common.GenerateTopicName("test/rpc/response")),
+		QoS:           qos,
+		ClientID:      cfg.ClientID(clientPrefix + "-requester"),
+	})
+	if err != nil {
+		responder.Stop()
+		return nil, nil, "", err
+	}
+
+	return requester, responder, requestTopic, nil
+}
+
+// checkReply compares a reply with the request it answers
+func checkReply(requester *Requester, reply []byte, topic string, payload []byte) error {
+	if topic != requester.cfg.ResponseTopic {
+		return fmt.Errorf("reply arrived on %q, expected the Response Topic %q", topic, requester.cfg.ResponseTopic)
+	}
+	if !bytes.Equal(reply, payload) {
+		return fmt.Errorf("reply payload %d bytes, expected the %d bytes sent", len(reply), len(payload))
+	}
+	return nil
+}
+
+// testRequestResponseRoundTrip tests a request and its reply at each QoS the
+// broker supports [MQTT-3.3.2-15]
+// "The Server MUST send the Response Topic unaltered to all subscribers
+// receiving the Application Message"
+func testRequestResponseRoundTrip(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Request/Response Round Trip",
+		SpecRef: "MQTT-3.3.2-15",
+	}
+
+	var notes []string
+	for qos := range byte(3) {
+		if cfg.Capabilities.QoS(qos) != qos {
+			continue
+		}
+		requester, responder, requestTopic, err := startRequestResponse(cfg, fmt.Sprintf("test-rpc-qos%d", qos), qos)
+		if err != nil {
+			result.Error = err
+			result.Duration = time.Since(start)
+			return result
+		}
+
+		payload := []byte(fmt.Sprintf("request at QoS %d", qos))
+		sent := time.Now()
+		reply, err := requester.Request(ctx, requestTopic, payload, []byte{qos}, cfg.Scaled(5*time.Second))
+		if err == nil {
+			err = checkReply(requester, reply.Payload, reply.Topic, payload)
+		}
+		requester.Stop()
+		responder.Stop()
+		if err != nil {
+			result.Error = fmt.Errorf("QoS %d: %w", qos, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+		notes = append(notes, fmt.Sprintf("QoS %d in %v", qos, time.Since(sent).Round(time.Millisecond)))
+	}
+
+	result.Status = common.StatusPassed
+	result.Notes = strings.Join(notes, ", ")
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRequestResponseCorrelationSizes tests Correlation Data from one byte
+// up to the 65535 byte maximum of Binary Data [MQTT-3.3.2-16]
+// "The Server MUST send the Correlation Data unaltered to all subscribers
+// receiving the Application Message"
+func testRequestResponseCorrelationSizes(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Request/Response Correlation Data Sizes",
+		SpecRef: "MQTT-3.3.2-16",
+	}
+
+	requester, responder, requestTopic, err := startRequestResponse(cfg, "test-rpc-sizes", cfg.Capabilities.QoS(1))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer responder.Stop()
+	defer requester.Stop()
+
+	for _, size := range []int{1, 16, 256, 4096, 65535} {
+		correlation := make([]byte, size)
+		for i := range correlation {
+			correlation[i] = byte(i * 7)
+		}
+		payload := []byte(fmt.Sprintf("correlation data of %d bytes", size))
+		reply, err := requester.Request(ctx, requestTopic, payload, correlation, cfg.Scaled(5*time.Second))
+		if err == nil {
+			err = checkReply(requester, reply.Payload, reply.Topic, payload)
+		}
+		if err != nil {
+			result.Error = fmt.Errorf("correlation data of %d bytes: %w", size, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	if n := requester.Unmatched(); n > 0 {
+		result.Error = fmt.Errorf("%d replies arrived with altered correlation data", n)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRequestResponseBinaryCorrelation tests Correlation Data and payloads
+// that are not UTF-8: zero bytes, invalid sequences and every byte value
+// [MQTT-3.3.2-16]
+// "The Server MUST send the Correlation Data unaltered to all subscribers
+// receiving the Application Message"
+func testRequestResponseBinaryCorrelation(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Request/Response Binary Correlation Data",
+		SpecRef: "MQTT-3.3.2-16",
+	}
+
+	requester, responder, requestTopic, err := startRequestResponse(cfg, "test-rpc-binary", cfg.Capabilities.QoS(1))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer responder.Stop()
+	defer requester.Stop()
+
+	every := make([]byte, 256)
+	for i := range every {
+		every[i] = byte(i)
+	}
+	for _, c := range []struct {
+		name    string
+		data    []byte
+		payload []byte
+	}{
+		{"a zero byte", []byte{0x00}, []byte{0x00}},
+		{"zero bytes around text", []byte("\x00id\x00"), []byte("\x00\x00")},
+		{"an invalid UTF-8 sequence", []byte{0xC3, 0x28}, []byte{0xFF, 0xFE}},
+		{"an encoded surrogate", []byte{0xED, 0xA0, 0x80}, []byte{0xED, 0xA0, 0x80}},
+		{"every byte value", every, every},
+	} {
+		reply, err := requester.Request(ctx, requestTopic, c.payload, c.data, cfg.Scaled(5*time.Second))
+		if err == nil {
+			err = checkReply(requester, reply.Payload, reply.Topic, c.payload)
+		}
+		if err != nil {
+			result.Error = fmt.Errorf("correlation data with %s: %w", c.name, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	if n := requester.Unmatched(); n > 0 {
+		result.Error = fmt.Errorf("%d replies arrived with altered correlation data", n)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRequestResponseConcurrent tests many requests in flight at once, each
+// reply reaching the request its Correlation Data names [MQTT-3.3.2-16]
+// "The Server MUST send the Correlation Data unaltered to all subscribers
+// receiving the Application Message"
+func testRequestResponseConcurrent(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Request/Response Concurrent Requests",
+		SpecRef: "MQTT-3.3.2-16",
+	}
+
+	requester, responder, requestTopic, err := startRequestResponse(cfg, "test-rpc-concurrent", cfg.Capabilities.QoS(1))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer responder.Stop()
+	defer requester.Stop()
+
+	const requests = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payload := []byte(fmt.Sprintf("request %d", i))
+			reply, err := requester.Request(ctx, requestTopic, payload, []byte(fmt.Sprintf("id-%d", i)), cfg.Scaled(5*time.Second))
+			if err == nil {
+				err = checkReply(requester, reply.Payload, reply.Topic, payload)
+			}
+			if err != nil {
+				errs <- fmt.Errorf("request %d: %w", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if n := requester.Unmatched(); n > 0 {
+		result.Error = fmt.Errorf("%d replies correlated with no request", n)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Notes = fmt.Sprintf("%d requests in flight, %d answered", requests, responder.Handled())
+	result.Duration = time.Since(start)
+	return result
+}
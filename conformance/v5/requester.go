@@ -0,0 +1,150 @@
+package v5
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// RequesterConfig configures the request side of a request/response flow
+type RequesterConfig struct {
+	ResponseTopic string // Topic the requester subscribes to and names as Response Topic
+	QoS           byte   // QoS used for both the requests and the response subscription
+	ClientID      string // Client ID to use (generated if empty)
+}
+
+// Requester publishes requests carrying a Response Topic and Correlation
+// Data and hands each reply to the request it correlates with [MQTT-4.10]
+type Requester struct {
+	client    *paho.Client
+	cfg       RequesterConfig
+	mu        sync.Mutex
+	pending   map[string]chan *paho.Publish
+	unmatched atomic.Uint64
+}
+
+// StartRequester connects a requester client and subscribes to the response topic
+func StartRequester(cfg common.Config, rc RequesterConfig) (*Requester, error) {
+	if rc.ResponseTopic == "" {
+		return nil, fmt.Errorf("requester response topic is required")
+	}
+	if rc.QoS > 2 {
+		return nil, fmt.Errorf("invalid requester QoS: %d", rc.QoS)
+	}
+	if rc.ClientID == "" {
+		rc.ClientID = cfg.ClientID("requester")
+	}
+
+	r := &Requester{
+		cfg:     rc,
+		pending: make(map[string]chan *paho.Publish),
+	}
+
+	client, err := CreateAndConnectClient(cfg, rc.ClientID, r.onPublish)
+	if err != nil {
+		return nil, fmt.Errorf("requester connect failed: %w", err)
+	}
+	r.client = client
+
+	subCtx, subCancel := context.WithTimeout(context.Background(), cfg.Scaled(5*time.Second))
+	defer subCancel()
+
+	_, err = client.Subscribe(subCtx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{
+			{Topic: rc.ResponseTopic, QoS: rc.QoS},
+		},
+	})
+	if err != nil {
+		r.Stop()
+		return nil, fmt.Errorf("requester subscribe failed: %w", err)
+	}
+
+	return r, nil
+}
+
+// Request publishes payload to topic with correlation as its Correlation
+// Data and waits up to timeout for the reply carrying the same Correlation
+// Data. Requests in flight at the same time need distinct correlation data.
+func (r *Requester) Request(ctx context.Context, topic string, payload, correlation []byte, timeout time.Duration) (*paho.Publish, error) {
+	key := string(correlation)
+	reply := make(chan *paho.Publish, 1)
+	r.mu.Lock()
+	if _, ok := r.pending[key]; ok {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("a request with correlation data %x is already in flight", correlation)
+	}
+	r.pending[key] = reply
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, key)
+		r.mu.Unlock()
+	}()
+
+	pubCtx, pubCancel := context.WithTimeout(ctx, timeout)
+	defer pubCancel()
+
+	_, err := r.client.Publish(pubCtx, &paho.Publish{
+		Topic:   topic,
+		QoS:     r.cfg.QoS,
+		Payload: payload,
+		Properties: &paho.PublishProperties{
+			ResponseTopic:   r.cfg.ResponseTopic,
+			CorrelationData: correlation,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("request publish failed: %w", err)
+	}
+
+	select {
+	case p := <-reply:
+		return p, nil
+	case <-pubCtx.Done():
+		if n := r.unmatched.Load(); n > 0 {
+			return nil, fmt.Errorf("no reply within %v, %d replies with other correlation data", timeout, n)
+		}
+		return nil, fmt.Errorf("no reply within %v", timeout)
+	}
+}
+
+// onPublish hands a reply to its pending request; replies that correlate
+// with none are counted and dropped
+func (r *Requester) onPublish(pr paho.PublishReceived) (bool, error) {
+	var correlation []byte
+	if pr.Packet.Properties != nil {
+		correlation = pr.Packet.Properties.CorrelationData
+	}
+
+	r.mu.Lock()
+	reply, ok := r.pending[string(correlation)]
+	r.mu.Unlock()
+	if !ok {
+		r.unmatched.Add(1)
+		return true, nil
+	}
+
+	select {
+	case reply <- pr.Packet:
+	default:
+		// A duplicate of a reply already handed over
+	}
+	return true, nil
+}
+
+// Unmatched returns the number of replies that correlated with no request in flight
+func (r *Requester) Unmatched() uint64 {
+	return r.unmatched.Load()
+}
+
+// Stop disconnects the requester client
+func (r *Requester) Stop() {
+	if r.client != nil {
+		r.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	}
+}
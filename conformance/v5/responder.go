@@ -0,0 +1,145 @@
+package v5
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// ResponderConfig configures the built-in request/response echo service
+type ResponderConfig struct {
+	RequestTopic string        // Topic filter the responder subscribes to for requests
+	QoS          byte          // QoS used for both the request subscription and the replies
+	Delay        time.Duration // Artificial processing delay before each reply
+	ClientID     string        // Client ID to use (generated if empty)
+	OnRequest    func(req *paho.Publish)
+}
+
+// Responder subscribes to a request topic and echoes each payload back to the
+// request's Response Topic with the Correlation Data preserved [MQTT-4.10]
+type Responder struct {
+	client  *paho.Client
+	cfg     ResponderConfig
+	ctx     context.Context
+	cancel  context.CancelFunc
+	handled atomic.Uint64
+	ignored atomic.Uint64
+	errors  atomic.Uint64
+}
+
+// StartResponder connects a responder client and subscribes to the request topic
+func StartResponder(cfg common.Config, rc ResponderConfig) (*Responder, error) {
+	if rc.RequestTopic == "" {
+		return nil, fmt.Errorf("responder request topic is required")
+	}
+	if rc.QoS > 2 {
+		return nil, fmt.Errorf("invalid responder QoS: %d", rc.QoS)
+	}
+	if rc.ClientID == "" {
+		rc.ClientID = cfg.ClientID("responder")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Responder{
+		cfg:    rc,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	client, err := CreateAndConnectClient(cfg, rc.ClientID, r.onPublish)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("responder connect failed: %w", err)
+	}
+	r.client = client
+
+	subCtx, subCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer subCancel()
+
+	_, err = client.Subscribe(subCtx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{
+			{Topic: rc.RequestTopic, QoS: rc.QoS, NoLocal: true},
+		},
+	})
+	if err != nil {
+		r.Stop()
+		return nil, fmt.Errorf("responder subscribe failed: %w", err)
+	}
+
+	return r, nil
+}
+
+// onPublish replies to a request; requests without a Response Topic are counted and dropped
+func (r *Responder) onPublish(pr paho.PublishReceived) (bool, error) {
+	req := pr.Packet
+	if req.Properties == nil || req.Properties.ResponseTopic == "" {
+		r.ignored.Add(1)
+		return true, nil
+	}
+
+	if r.cfg.OnRequest != nil {
+		r.cfg.OnRequest(req)
+	}
+
+	reply := &paho.Publish{
+		Topic:   req.Properties.ResponseTopic,
+		QoS:     r.cfg.QoS,
+		Payload: req.Payload,
+		Properties: &paho.PublishProperties{
+			CorrelationData: req.Properties.CorrelationData,
+			ContentType:     req.Properties.ContentType,
+			PayloadFormat:   req.Properties.PayloadFormat,
+			User:            req.Properties.User,
+		},
+	}
+
+	// Publish from a separate goroutine so QoS 1/2 replies never block the
+	// client's inbound packet processing
+	go func() {
+		if r.cfg.Delay > 0 {
+			select {
+			case <-time.After(r.cfg.Delay):
+			case <-r.ctx.Done():
+				return
+			}
+		}
+
+		pubCtx, pubCancel := context.WithTimeout(r.ctx, 5*time.Second)
+		defer pubCancel()
+
+		if _, err := r.client.Publish(pubCtx, reply); err != nil {
+			r.errors.Add(1)
+			return
+		}
+		r.handled.Add(1)
+	}()
+
+	return true, nil
+}
+
+// Handled returns the number of requests answered
+func (r *Responder) Handled() uint64 {
+	return r.handled.Load()
+}
+
+// Ignored returns the number of received messages without a Response Topic
+func (r *Responder) Ignored() uint64 {
+	return r.ignored.Load()
+}
+
+// Errors returns the number of replies that failed to publish
+func (r *Responder) Errors() uint64 {
+	return r.errors.Load()
+}
+
+// Stop disconnects the responder client
+func (r *Responder) Stop() {
+	r.cancel()
+	if r.client != nil {
+		r.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	}
+}
@@ -0,0 +1,97 @@
+package v5
+
+import (
+	"context"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// RestartTests returns tests that restart the broker and check its durable
+// state survives, which needs a broker the suite controls, e.g. with
+// --docker-broker. Otherwise they are skipped. MQTT does not say whether
+// state outlives a Server restart, so the tests are held to SHOULD.
+func RestartTests() TestGroup {
+	return TestGroup{
+		Name: "Restart Persistence",
+		Tags: []string{"optional", "restart", "session", "retain"},
+		Tests: []TestFunc{
+			testRestartSession,
+			testRestartRetained,
+			testRestartQoS2Inflight,
+		},
+	}
+}
+
+// checkRestart fills in result with the outcome of a restart check
+func checkRestart(cfg common.Config, result *TestResult, check func(common.Config, byte) (string, error)) {
+	if common.SkipWithoutRestart(cfg, result) {
+		return
+	}
+	notes, err := check(cfg, 5)
+	if err != nil {
+		result.Error = err
+		return
+	}
+	result.Status = common.StatusPassed
+	result.Notes = notes
+}
+
+// testRestartSession tests that a persistent session, with its
+// subscription and a QoS 1 message queued for it, survives a broker restart
+// [MQTT-3.1.2-5]
+// "If a CONNECT packet is received with Clean Start set to 0 and there is a
+// Session associated with the Client Identifier, the Server MUST resume
+// communications with the Client based on state from the existing Session"
+func testRestartSession(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Session Survives Restart",
+		SpecRef: "MQTT-3.1.2-5",
+		Level:   spec.LevelShould,
+	}
+
+	checkRestart(cfg, &result, common.CheckRestartSession)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRestartRetained tests that a retained message survives a broker
+// restart [MQTT-3.3.1-5]
+// "the Server MUST replace any existing retained message for this topic and
+// store the Application Message"
+func testRestartRetained(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Retained Message Survives Restart",
+		SpecRef: "MQTT-3.3.1-5",
+		Level:   spec.LevelShould,
+	}
+
+	checkRestart(cfg, &result, common.CheckRestartRetained)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRestartQoS2Inflight tests that a QoS 2 message received but not yet
+// released when the broker restarts is completed by the publisher's PUBREL
+// afterwards and delivered to a persistent subscriber exactly once
+// [MQTT-3.1.2-5]
+// "the Server MUST resume communications with the Client based on state from
+// the existing Session"
+func testRestartQoS2Inflight(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "QoS 2 In Flight Survives Restart",
+		SpecRef: "MQTT-3.1.2-5",
+		Level:   spec.LevelShould,
+	}
+
+	checkRestart(cfg, &result, common.CheckRestartQoS2)
+
+	result.Duration = time.Since(start)
+	return result
+}
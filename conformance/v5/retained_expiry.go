@@ -0,0 +1,297 @@
+package v5
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// RetainedExpiryTests returns tests of how Message Expiry Interval applies to
+// retained messages: replacing them, removing them once expired, and
+// counting down apart from the copies queued for sessions [MQTT-3.3.2.3.3]
+func RetainedExpiryTests() TestGroup {
+	return TestGroup{
+		Name: "Retained Message Expiry",
+		Tags: []string{"retain", "timing"},
+		Tests: []TestFunc{
+			testRetainedOverwriteResetsExpiry,
+			testRetainedExpiredRemoved,
+			testRetainedExpiryIndependentOfQueue,
+		},
+	}
+}
+
+// deliveredMessage is a message a subscriber received
+type deliveredMessage struct {
+	payload string
+	expiry  *uint32 // Message Expiry Interval, nil when absent
+}
+
+// publishRetained publishes a retained message to topic with the given
+// Message Expiry Interval from a client of its own
+func publishRetained(ctx context.Context, cfg common.Config, clientPrefix, topic, payload string, expiry uint32) error {
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID(clientPrefix), nil)
+	if err != nil {
+		return fmt.Errorf("publisher connect failed: %w", err)
+	}
+	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	_, err = pub.Publish(ctx, &paho.Publish{
+		Topic:      topic,
+		QoS:        cfg.Capabilities.QoS(1),
+		Retain:     true,
+		Payload:    []byte(payload),
+		Properties: &paho.PublishProperties{MessageExpiry: &expiry},
+	})
+	if err != nil {
+		return fmt.Errorf("publish retained failed: %w", err)
+	}
+	return nil
+}
+
+// fetchRetained subscribes to topic with a new client and returns the
+// retained message it is sent, nil if none arrives
+func fetchRetained(ctx context.Context, cfg common.Config, clientPrefix, topic string) (*deliveredMessage, error) {
+	received := make(chan deliveredMessage, 1)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID(clientPrefix), func(pr paho.PublishReceived) (bool, error) {
+		msg := deliveredMessage{payload: string(pr.Packet.Payload)}
+		if pr.Packet.Properties != nil {
+			msg.expiry = pr.Packet.Properties.MessageExpiry
+		}
+		select {
+		case received <- msg:
+		default:
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("subscriber connect failed: %w", err)
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	if _, err := sub.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: 1}},
+	}); err != nil {
+		return nil, fmt.Errorf("subscribe failed: %w", err)
+	}
+
+	select {
+	case msg := <-received:
+		return &msg, nil
+	case <-time.After(cfg.Scaled(time.Second)):
+		return nil, nil
+	}
+}
+
+// testRetainedOverwriteResetsExpiry tests that a retained message replacing
+// another carries its own Message Expiry Interval, so it outlives the one it
+// replaced [MQTT-3.3.1-5]
+// "If the RETAIN flag is set to 1 in a PUBLISH packet sent by a Client to a
+// Server, the Server MUST replace any existing retained message for this
+// topic and store the Application Message"
+func testRetainedOverwriteResetsExpiry(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Retained Overwrite Resets Expiry",
+		SpecRef: "MQTT-3.3.1-5",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureRetain) {
+		return result
+	}
+
+	topic := cfg.Topic("test/retained-expiry/overwrite")
+	if err := publishRetained(ctx, cfg, "test-retexp-overwrite-a", topic, "first", 2); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if err := publishRetained(ctx, cfg, "test-retexp-overwrite-b", topic, "second", 4); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// The first message would have expired by now, the second has 2.5s left
+	time.Sleep(1500 * time.Millisecond)
+	msg, err := fetchRetained(ctx, cfg, "test-retexp-overwrite-sub", topic)
+	switch {
+	case err != nil:
+		result.Error = err
+	case msg == nil:
+		result.Error = fmt.Errorf("no retained message, the replacement expired with the message it replaced")
+	case msg.payload != "second":
+		result.Error = fmt.Errorf("retained message %q, expected the replacement", msg.payload)
+	case msg.expiry == nil:
+		result.SpecRef = "MQTT-3.3.2-6"
+		result.Error = fmt.Errorf("retained message delivered without its Message Expiry Interval")
+	case *msg.expiry == 0 || *msg.expiry > 4:
+		result.SpecRef = "MQTT-3.3.2-6"
+		result.Error = fmt.Errorf("Message Expiry Interval %d, expected 1 to 4 seconds left of 4", *msg.expiry)
+	default:
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRetainedExpiredRemoved tests that a retained message is no longer sent
+// to new subscribers once its Message Expiry Interval has passed
+// [MQTT-3.3.2-5]
+// "If the Message Expiry Interval has passed and the Server has not managed to
+// start onward delivery to a matching subscriber, then it MUST delete the copy
+// of the message for that subscriber"
+func testRetainedExpiredRemoved(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Expired Retained Message Removed",
+		SpecRef: "MQTT-3.3.2-5",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureRetain) {
+		return result
+	}
+
+	topic := cfg.Topic("test/retained-expiry/removed")
+	if err := publishRetained(ctx, cfg, "test-retexp-removed-pub", topic, "short lived", 1); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+	msg, err := fetchRetained(ctx, cfg, "test-retexp-removed-sub", topic)
+	switch {
+	case err != nil:
+		result.Error = err
+	case msg != nil:
+		result.Error = fmt.Errorf("retained message sent 2.5s after its 1s Message Expiry Interval")
+	default:
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testRetainedExpiryIndependentOfQueue tests that the retained copy of a
+// message and the copy queued for an offline session both count down from
+// when the message was published, however often the retained copy is sent
+// [MQTT-3.3.2-6]
+// "The PUBLISH packet sent to a Client by the Server MUST contain a Message
+// Expiry Interval set to the received value minus the time that the
+// Application Message has been waiting in the Server"
+func testRetainedExpiryIndependentOfQueue(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Retained and Queued Expiry Count Down Independently",
+		SpecRef: "MQTT-3.3.2-6",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureRetain, common.FeatureQoS1) {
+		return result
+	}
+
+	topic := cfg.Topic("test/retained-expiry/queued")
+	sessionID := cfg.ClientID("test-retexp-queued-session")
+	session, err := CreateAndConnectClientWithSession(cfg, sessionID, false, nil)
+	if err != nil {
+		result.Error = fmt.Errorf("session connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	if _, err := session.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: 1}},
+	}); err != nil {
+		session.Disconnect(&paho.Disconnect{ReasonCode: 0})
+		result.Error = fmt.Errorf("session subscribe failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	session.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	if err := publishRetained(ctx, cfg, "test-retexp-queued-pub", topic, "queued", 10); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	published := time.Now()
+
+	// Each copy should show no more than what is left of the 10s, allowing a
+	// second for the broker rounding
+	remaining := func(msg *deliveredMessage, which string) error {
+		if msg == nil {
+			return fmt.Errorf("%s copy not delivered", which)
+		}
+		if msg.expiry == nil {
+			return fmt.Errorf("%s copy delivered without Message Expiry Interval", which)
+		}
+		limit := 10 - uint32(time.Since(published)/time.Second) + 1
+		if *msg.expiry == 0 || *msg.expiry > limit {
+			return fmt.Errorf("%s copy has Message Expiry Interval %d after %.1fs, expected at most %d", which, *msg.expiry, time.Since(published).Seconds(), limit)
+		}
+		return nil
+	}
+
+	time.Sleep(2 * time.Second)
+	first, err := fetchRetained(ctx, cfg, "test-retexp-queued-sub1", topic)
+	if err == nil {
+		err = remaining(first, "first retained")
+	}
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	time.Sleep(2 * time.Second)
+	queued := make(chan deliveredMessage, 1)
+	session, err = CreateAndConnectClientWithSession(cfg, sessionID, false, func(pr paho.PublishReceived) (bool, error) {
+		msg := deliveredMessage{payload: string(pr.Packet.Payload)}
+		if pr.Packet.Properties != nil {
+			msg.expiry = pr.Packet.Properties.MessageExpiry
+		}
+		select {
+		case queued <- msg:
+		default:
+		}
+		return true, nil
+	})
+	if err != nil {
+		result.Error = fmt.Errorf("session reconnect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer session.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	var queuedMsg *deliveredMessage
+	select {
+	case msg := <-queued:
+		queuedMsg = &msg
+	case <-time.After(cfg.Scaled(2 * time.Second)):
+	}
+	if err := remaining(queuedMsg, "queued"); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	second, err := fetchRetained(ctx, cfg, "test-retexp-queued-sub2", topic)
+	if err == nil {
+		err = remaining(second, "second retained")
+	}
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
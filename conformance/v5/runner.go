@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/spec"
 )
 
 // AllTestGroups returns all available test groups
@@ -19,6 +20,7 @@ func AllTestGroups() []TestGroup {
 		PublishSubscribeTests(),
 		SubscribeExtendedTests(),
 		UnsubscribeTests(),
+		UnsubackTests(),
 		PingTests(),
 		DisconnectTests(),
 
@@ -27,18 +29,33 @@ func AllTestGroups() []TestGroup {
 
 		// QoS and Flow Control
 		QoSTests(),
+		UnknownAckTests(),
 		FlowControlTests(),
+		QuotaTests(),
 
 		// Advanced Features
 		TopicTests(),
+		SysTopicTests(),
 		TopicAliasTests(),
 		MessageExpiryTests(),
+		RetainedExpiryTests(),
 		SubscriptionIdentifierTests(),
 		SharedSubscriptionTests(),
 		SessionTests(),
 		WillTests(),
 		PropertiesTests(),
+		RequestResponseTests(),
 		CONNACKPropertiesTests(),
+		AuthenticationTests(),
+		EnhancedAuthenticationTests(),
+		AuthorizationTests(),
+		ServerRedirectionTests(),
+		BridgeTests(),
+		ClusterTests(),
+		RestartTests(),
+		PartitionTests(),
+		SlowConsumerTests(),
+		LimitsTests(),
 
 		// Error Handling
 		ErrorHandlingTests(),
@@ -46,84 +63,38 @@ func AllTestGroups() []TestGroup {
 		// Negative Tests
 		NegativeTests(),
 		AdditionalNegativeTests(),
+		PropertyFuzzTests(),
 	}
 }
 
-// RunTests executes MQTT v5 conformance tests
-func RunTests(cfg common.Config, filter string, verbose bool) error {
-	fmt.Printf("\n%s\n", common.TitleStyle.Render("MQTT v5.0 Conformance Tests"))
-	fmt.Printf("%s\n", common.SubtitleStyle.Render(fmt.Sprintf("Broker: %s", cfg.Broker)))
-	if verbose {
-		fmt.Printf("%s\n", common.SubtitleStyle.Render("Verbose mode: ON"))
-	}
-	fmt.Println()
-
-	// Preflight connection check
-	fmt.Printf("%s", common.SubtitleStyle.Render("Checking broker connection... "))
-	if err := CheckConnection(cfg); err != nil {
-		fmt.Printf("%s\n", common.FailStyle.Render("FAILED"))
-		return fmt.Errorf("preflight check failed: %w", err)
-	}
-	fmt.Printf("%s\n", common.PassStyle.Render("OK"))
-
-	groups := AllTestGroups()
-
-	totalTests := 0
-	passedTests := 0
-	failedTests := 0
-	var failedResults []TestResult
-
-	for _, group := range groups {
-		if !common.ShouldRunGroup(group.Name, filter) {
-			continue
-		}
-
-		fmt.Printf("\n%s\n", common.GroupStyle.Render(group.Name))
-
-		for _, testFunc := range group.Tests {
-			result := testFunc(cfg)
-			totalTests++
-
-			status := common.PassStyle.Render("✓ PASS")
-			if !result.Passed {
-				status = common.FailStyle.Render("✗ FAIL")
-				failedTests++
-				failedResults = append(failedResults, result)
-			} else {
-				passedTests++
-			}
-
-			specRef := ""
-			if result.SpecRef != "" {
-				specRef = fmt.Sprintf(" [%s]", result.SpecRef)
-			}
-
-			fmt.Printf("  %s %s%s (%v)\n", status, result.Name, specRef, result.Duration)
-		}
+// Suite returns the MQTT v5 conformance suite: the built-in groups followed
+// by any registered with common.RegisterGroup
+func Suite() common.Suite {
+	return common.Suite{
+		Title:       "MQTT v5.0 Conformance Tests",
+		Spec:        spec.V5,
+		Groups:      append(AllTestGroups(), common.RegisteredGroups(spec.V5)...),
+		Cleanup:     Cleanup,
+		Preflight:   preflight,
+		PubSubCheck: CheckPubSub,
 	}
+}
 
-	// Detailed failure report first (if verbose and failures exist)
-	if verbose && failedTests > 0 {
-		fmt.Printf("\n%s\n", common.FailStyle.Render("═══ Detailed Failure Report ═══"))
-		for i, result := range failedResults {
-			fmt.Printf("\n%s\n", common.FailStyle.Render(fmt.Sprintf("Failure #%d: %s", i+1, result.Name)))
-			fmt.Printf("  Spec Reference: %s\n", result.SpecRef)
-			fmt.Printf("  Duration: %v\n", result.Duration)
-			fmt.Printf("  Error: %v\n", result.Error)
-		}
-	}
+// RunTests executes MQTT v5 conformance tests
+func RunTests(cfg common.Config, filter string, verbose bool) (*common.Report, error) {
+	return common.RunSuite(Suite(), cfg, filter, verbose)
+}
 
-	// Summary
-	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Summary"))
-	fmt.Printf("  Total:  %d\n", totalTests)
-	fmt.Printf("  Passed: %s\n", common.PassStyle.Render(fmt.Sprintf("%d", passedTests)))
-	if failedTests > 0 {
-		fmt.Printf("  Failed: %s\n", common.FailStyle.Render(fmt.Sprintf("%d", failedTests)))
+// preflight checks the connection and reads the broker's optional features
+// from CONNACK so tests that need them can be skipped
+func preflight(cfg *common.Config) error {
+	if err := CheckConnection(*cfg); err != nil {
+		return err
 	}
-
-	if failedTests > 0 {
-		return fmt.Errorf("%d test(s) failed", failedTests)
+	caps, err := DetectCapabilities(*cfg)
+	if err != nil {
+		return fmt.Errorf("capability detection failed: %w", err)
 	}
-
+	cfg.Capabilities = caps
 	return nil
 }
@@ -0,0 +1,204 @@
+package v5
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bromq-dev/testmqtt/conformance/assert"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// ScramSHA256Method is the Authentication Method of SCRAM-SHA-256
+const ScramSHA256Method = "SCRAM-SHA-256"
+
+// EnhancedAuther is a paho Auther for an enhanced authentication method
+// [MQTT-4.12], which also supplies the Authentication Method and the
+// Authentication Data that start an exchange
+type EnhancedAuther interface {
+	paho.Auther
+	Method() string
+	Start() []byte // Authentication Data of the CONNECT or re-authentication AUTH
+}
+
+// ScramSHA256 is the client side of SCRAM-SHA-256 (RFC 7677) as an
+// enhanced authentication method: the CONNECT carries the client-first
+// message, the broker's AUTH the server-first, the client's AUTH the
+// client-final and the CONNACK, or the AUTH ending a re-authentication, the
+// server-final. The same value serves the CONNECT and any re-authentication
+// after it; each Start begins a new exchange.
+type ScramSHA256 struct {
+	username string
+	password string
+
+	mu              sync.Mutex
+	nonce           string
+	clientFirstBare string
+	serverSignature []byte
+	err             error
+}
+
+// NewScramSHA256 returns a SCRAM-SHA-256 authenticator for username and password
+func NewScramSHA256(username, password string) *ScramSHA256 {
+	return &ScramSHA256{username: username, password: password}
+}
+
+// Method returns the Authentication Method, SCRAM-SHA-256
+func (s *ScramSHA256) Method() string {
+	return ScramSHA256Method
+}
+
+// Start begins a new exchange and returns the client-first message
+func (s *ScramSHA256) Start() []byte {
+	nonce := make([]byte, 18)
+	rand.Read(nonce)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nonce = base64.StdEncoding.EncodeToString(nonce)
+	s.clientFirstBare = "n=" + scramName(s.username) + ",r=" + s.nonce
+	s.serverSignature = nil
+	s.err = nil
+	return []byte("n,," + s.clientFirstBare)
+}
+
+// Authenticate answers the broker's server-first message with the
+// client-final one. A server-first message that cannot be answered is
+// recorded for Err and answered with no Authentication Data, which the
+// broker then refuses.
+func (s *ScramSHA256) Authenticate(a *paho.Auth) *paho.Auth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var data []byte
+	switch {
+	case a.ReasonCode != reasonContinueAuthentication:
+		s.err = fmt.Errorf("broker sent AUTH with reason code %s, expected %s", assert.ReasonName(a.ReasonCode), assert.ReasonName(reasonContinueAuthentication))
+	case a.Properties == nil || a.Properties.AuthMethod != ScramSHA256Method:
+		s.err = fmt.Errorf("broker's AUTH does not carry Authentication Method %s [MQTT-4.12.0-5]", ScramSHA256Method)
+	default:
+		data, s.err = s.clientFinal(a.Properties.AuthData)
+	}
+
+	return &paho.Auth{
+		ReasonCode: reasonContinueAuthentication,
+		Properties: &paho.AuthProperties{
+			AuthMethod: ScramSHA256Method,
+			AuthData:   data,
+		},
+	}
+}
+
+// Authenticated is called by paho once the broker accepted the exchange.
+// The server-final message it came with is for Verify.
+func (s *ScramSHA256) Authenticated() {}
+
+// clientFinal computes the client-final message for serverFirst and keeps
+// the ServerSignature the server-final message must carry
+func (s *ScramSHA256) clientFinal(serverFirst []byte) ([]byte, error) {
+	attrs := scramAttributes(string(serverFirst))
+	nonce, salt64, iter := attrs["r"], attrs["s"], attrs["i"]
+	if e, ok := attrs["e"]; ok {
+		return nil, fmt.Errorf("broker ended the exchange with server-error %q", e)
+	}
+	if !strings.HasPrefix(nonce, s.nonce) || len(nonce) == len(s.nonce) {
+		return nil, fmt.Errorf("server-first nonce %q does not extend the client nonce %q", nonce, s.nonce)
+	}
+	salt, err := base64.StdEncoding.DecodeString(salt64)
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("server-first salt %q is not base64", salt64)
+	}
+	iterations, err := strconv.Atoi(iter)
+	if err != nil || iterations < 1 {
+		return nil, fmt.Errorf("server-first iteration count %q is invalid", iter)
+	}
+
+	salted, err := pbkdf2.Key(sha256.New, s.password, salt, iterations, sha256.Size)
+	if err != nil {
+		return nil, fmt.Errorf("salting the password: %w", err)
+	}
+	clientKey := scramHMAC(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte("n,,")) + ",r=" + nonce
+	authMessage := s.clientFirstBare + "," + string(serverFirst) + "," + withoutProof
+
+	proof := scramHMAC(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	s.serverSignature = scramHMAC(scramHMAC(salted, "Server Key"), authMessage)
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// Verify checks the server-final message the broker ended the exchange
+// with, proving it knows the password too, and reports any error met while
+// answering the broker
+func (s *ScramSHA256) Verify(serverFinal []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	if s.serverSignature == nil {
+		return errors.New("exchange ended before the broker sent a server-first message")
+	}
+	attrs := scramAttributes(string(serverFinal))
+	if e, ok := attrs["e"]; ok {
+		return fmt.Errorf("server-final message is server-error %q", e)
+	}
+	v, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || len(v) == 0 {
+		return fmt.Errorf("server-final message %q carries no ServerSignature", serverFinal)
+	}
+	if !hmac.Equal(v, s.serverSignature) {
+		return errors.New("ServerSignature of the server-final message does not match")
+	}
+	return nil
+}
+
+// answered reports whether the client-final message was sent in the current
+// exchange
+func (s *ScramSHA256) answered() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.serverSignature != nil
+}
+
+// Err returns the error met answering the broker in the current exchange
+func (s *ScramSHA256) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// scramHMAC returns HMAC-SHA-256 of message with key
+func scramHMAC(key []byte, message string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(message))
+	return h.Sum(nil)
+}
+
+// scramName escapes '=' and ',' in a SCRAM user name
+func scramName(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
+
+// scramAttributes splits a SCRAM message into its attributes by name
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, field := range strings.Split(msg, ",") {
+		name, value, ok := strings.Cut(field, "=")
+		if ok && len(name) == 1 {
+			attrs[name] = value
+		}
+	}
+	return attrs
+}
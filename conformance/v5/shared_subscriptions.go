@@ -1,11 +1,13 @@
 package v5
 
 import (
+	"github.com/bromq-dev/testmqtt/conformance/assert"
 	"github.com/bromq-dev/testmqtt/conformance/common"
 )
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -17,25 +19,36 @@ import (
 func SharedSubscriptionTests() TestGroup {
 	return TestGroup{
 		Name: "Shared Subscriptions",
+		Tags: []string{"optional", "shared-subscriptions"},
 		Tests: []TestFunc{
 			testSharedSubscriptionBasic,
 			testSharedSubscriptionLoadBalancing,
 			testSharedSubscriptionQoS,
 			testSharedSubscriptionAndNormalSubscription,
 			testSharedSubscriptionMultipleGroups,
+			testSharedRedeliveryOnConsumerFailure,
+			testSharedEmptyShareName,
+			testSharedNoTopicFilter,
+			testSharedShareNamePlus,
+			testSharedShareNameHash,
+			testSharedNoLocal,
 		},
 	}
 }
 
 // testSharedSubscriptionBasic tests basic shared subscription [MQTT-4.8.2-1]
 // "Shared Subscriptions are defined using the $share prefix"
-func testSharedSubscriptionBasic(cfg common.Config) TestResult {
+func testSharedSubscriptionBasic(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Shared Subscription Basic",
 		SpecRef: "MQTT-4.8.2-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureSharedSub) {
+		return result
+	}
+
 	messageCount := 0
 	var mu sync.Mutex
 
@@ -47,7 +60,7 @@ func testSharedSubscriptionBasic(cfg common.Config) TestResult {
 	}
 
 	// Create two subscribers in the same share group
-	sub1, err := CreateAndConnectClient(cfg, "test-share-basic-1", onPublish)
+	sub1, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-basic-1"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber 1 connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -55,7 +68,7 @@ func testSharedSubscriptionBasic(cfg common.Config) TestResult {
 	}
 	defer sub1.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	sub2, err := CreateAndConnectClient(cfg, "test-share-basic-2", onPublish)
+	sub2, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-basic-2"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber 2 connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -63,11 +76,9 @@ func testSharedSubscriptionBasic(cfg common.Config) TestResult {
 	}
 	defer sub2.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Both subscribe to the same shared subscription
-	shareName := "$share/group1/test/share/basic"
-	_, err = sub1.Subscribe(ctx, &paho.Subscribe{
+	shareName := "$share/group1/" + cfg.Topic("test/share/basic")
+	_, err = SubscribeSync(ctx, cfg, sub1, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{Topic: shareName, QoS: 0},
 		},
@@ -78,7 +89,7 @@ func testSharedSubscriptionBasic(cfg common.Config) TestResult {
 		return result
 	}
 
-	_, err = sub2.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub2, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{Topic: shareName, QoS: 0},
 		},
@@ -89,10 +100,8 @@ func testSharedSubscriptionBasic(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish a message
-	pub, err := CreateAndConnectClient(cfg, "test-share-basic-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-basic-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -101,7 +110,7 @@ func testSharedSubscriptionBasic(cfg common.Config) TestResult {
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/share/basic",
+		Topic:   cfg.Topic("test/share/basic"),
 		QoS:     0,
 		Payload: []byte("shared message"),
 	})
@@ -111,7 +120,7 @@ func testSharedSubscriptionBasic(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	count := messageCount
@@ -119,7 +128,7 @@ func testSharedSubscriptionBasic(cfg common.Config) TestResult {
 
 	// Message should be received by only ONE subscriber (not both)
 	if count == 1 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("expected 1 message delivery, got %d", count)
 	}
@@ -130,13 +139,17 @@ func testSharedSubscriptionBasic(cfg common.Config) TestResult {
 
 // testSharedSubscriptionLoadBalancing tests load balancing [MQTT-4.8.2-2]
 // "The Server MUST distribute the messages to the subscribers in the group"
-func testSharedSubscriptionLoadBalancing(cfg common.Config) TestResult {
+func testSharedSubscriptionLoadBalancing(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Shared Subscription Load Balancing",
 		SpecRef: "MQTT-4.8.2-2",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureSharedSub) {
+		return result
+	}
+
 	count1 := 0
 	count2 := 0
 	var mu sync.Mutex
@@ -156,7 +169,7 @@ func testSharedSubscriptionLoadBalancing(cfg common.Config) TestResult {
 	}
 
 	// Create two subscribers in the same share group
-	sub1, err := CreateAndConnectClient(cfg, "test-share-lb-1", onPublish1)
+	sub1, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-lb-1"), onPublish1)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber 1 connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -164,7 +177,7 @@ func testSharedSubscriptionLoadBalancing(cfg common.Config) TestResult {
 	}
 	defer sub1.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	sub2, err := CreateAndConnectClient(cfg, "test-share-lb-2", onPublish2)
+	sub2, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-lb-2"), onPublish2)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber 2 connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -172,11 +185,9 @@ func testSharedSubscriptionLoadBalancing(cfg common.Config) TestResult {
 	}
 	defer sub2.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Both subscribe to the same shared subscription
-	shareName := "$share/group2/test/share/loadbalance"
-	_, err = sub1.Subscribe(ctx, &paho.Subscribe{
+	shareName := "$share/group2/" + cfg.Topic("test/share/loadbalance")
+	_, err = SubscribeSync(ctx, cfg, sub1, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{Topic: shareName, QoS: 1},
 		},
@@ -187,7 +198,7 @@ func testSharedSubscriptionLoadBalancing(cfg common.Config) TestResult {
 		return result
 	}
 
-	_, err = sub2.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub2, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{Topic: shareName, QoS: 1},
 		},
@@ -198,10 +209,8 @@ func testSharedSubscriptionLoadBalancing(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish multiple messages
-	pub, err := CreateAndConnectClient(cfg, "test-share-lb-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-lb-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -212,8 +221,8 @@ func testSharedSubscriptionLoadBalancing(cfg common.Config) TestResult {
 	messageCount := 10
 	for i := 0; i < messageCount; i++ {
 		_, err = pub.Publish(ctx, &paho.Publish{
-			Topic:   "test/share/loadbalance",
-			QoS:     1,
+			Topic:   cfg.Topic("test/share/loadbalance"),
+			QoS:     cfg.Capabilities.QoS(1),
 			Payload: []byte(fmt.Sprintf("message %d", i)),
 		})
 		if err != nil {
@@ -221,10 +230,10 @@ func testSharedSubscriptionLoadBalancing(cfg common.Config) TestResult {
 			result.Duration = time.Since(start)
 			return result
 		}
-		time.Sleep(50 * time.Millisecond)
+		cfg.Wait(50 * time.Millisecond)
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	c1 := count1
@@ -235,7 +244,7 @@ func testSharedSubscriptionLoadBalancing(cfg common.Config) TestResult {
 
 	// All messages should be received, distributed between both subscribers
 	if total == messageCount && c1 > 0 && c2 > 0 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("load balancing failed: sub1=%d, sub2=%d, total=%d (expected %d)", c1, c2, total, messageCount)
 	}
@@ -245,13 +254,21 @@ func testSharedSubscriptionLoadBalancing(cfg common.Config) TestResult {
 }
 
 // testSharedSubscriptionQoS tests QoS with shared subscriptions [MQTT-4.8.2]
-func testSharedSubscriptionQoS(cfg common.Config) TestResult {
+func testSharedSubscriptionQoS(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Shared Subscription with QoS",
 		SpecRef: "MQTT-4.8.2",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureQoS1) {
+		return result
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureSharedSub) {
+		return result
+	}
+
 	messageCount := 0
 	var mu sync.Mutex
 
@@ -263,7 +280,7 @@ func testSharedSubscriptionQoS(cfg common.Config) TestResult {
 	}
 
 	// Create subscriber with QoS 1
-	sub, err := CreateAndConnectClient(cfg, "test-share-qos-1", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-qos-1"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -271,10 +288,8 @@ func testSharedSubscriptionQoS(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
-	shareName := "$share/group3/test/share/qos"
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	shareName := "$share/group3/" + cfg.Topic("test/share/qos")
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{Topic: shareName, QoS: 1},
 		},
@@ -285,10 +300,8 @@ func testSharedSubscriptionQoS(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish with QoS 1
-	pub, err := CreateAndConnectClient(cfg, "test-share-qos-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-qos-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -297,7 +310,7 @@ func testSharedSubscriptionQoS(cfg common.Config) TestResult {
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/share/qos",
+		Topic:   cfg.Topic("test/share/qos"),
 		QoS:     1,
 		Payload: []byte("qos message"),
 	})
@@ -307,14 +320,14 @@ func testSharedSubscriptionQoS(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	count := messageCount
 	mu.Unlock()
 
 	if count == 1 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("expected 1 message, got %d", count)
 	}
@@ -324,13 +337,17 @@ func testSharedSubscriptionQoS(cfg common.Config) TestResult {
 }
 
 // testSharedSubscriptionAndNormalSubscription tests mixing shared and normal subscriptions
-func testSharedSubscriptionAndNormalSubscription(cfg common.Config) TestResult {
+func testSharedSubscriptionAndNormalSubscription(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Shared and Normal Subscriptions Coexist",
 		SpecRef: "MQTT-4.8.2",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureSharedSub) {
+		return result
+	}
+
 	sharedCount := 0
 	normalCount := 0
 	var mu sync.Mutex
@@ -350,7 +367,7 @@ func testSharedSubscriptionAndNormalSubscription(cfg common.Config) TestResult {
 	}
 
 	// Create shared subscriber
-	subShared, err := CreateAndConnectClient(cfg, "test-share-mixed-shared", onPublishShared)
+	subShared, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-mixed-shared"), onPublishShared)
 	if err != nil {
 		result.Error = fmt.Errorf("shared subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -359,7 +376,7 @@ func testSharedSubscriptionAndNormalSubscription(cfg common.Config) TestResult {
 	defer subShared.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	// Create normal subscriber
-	subNormal, err := CreateAndConnectClient(cfg, "test-share-mixed-normal", onPublishNormal)
+	subNormal, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-mixed-normal"), onPublishNormal)
 	if err != nil {
 		result.Error = fmt.Errorf("normal subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -367,11 +384,9 @@ func testSharedSubscriptionAndNormalSubscription(cfg common.Config) TestResult {
 	}
 	defer subNormal.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe with shared subscription
-	shareName := "$share/group4/test/share/mixed"
-	_, err = subShared.Subscribe(ctx, &paho.Subscribe{
+	shareName := "$share/group4/" + cfg.Topic("test/share/mixed")
+	_, err = SubscribeSync(ctx, cfg, subShared, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{Topic: shareName, QoS: 0},
 		},
@@ -383,9 +398,9 @@ func testSharedSubscriptionAndNormalSubscription(cfg common.Config) TestResult {
 	}
 
 	// Subscribe with normal subscription to the same topic
-	_, err = subNormal.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, subNormal, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/share/mixed", QoS: 0},
+			{Topic: cfg.Topic("test/share/mixed"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -394,10 +409,8 @@ func testSharedSubscriptionAndNormalSubscription(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish message
-	pub, err := CreateAndConnectClient(cfg, "test-share-mixed-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-mixed-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -406,7 +419,7 @@ func testSharedSubscriptionAndNormalSubscription(cfg common.Config) TestResult {
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/share/mixed",
+		Topic:   cfg.Topic("test/share/mixed"),
 		QoS:     0,
 		Payload: []byte("mixed message"),
 	})
@@ -416,7 +429,7 @@ func testSharedSubscriptionAndNormalSubscription(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	shared := sharedCount
@@ -425,7 +438,7 @@ func testSharedSubscriptionAndNormalSubscription(cfg common.Config) TestResult {
 
 	// Both should receive the message (shared and normal subscriptions are independent)
 	if shared == 1 && normal == 1 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("expected shared=1, normal=1, got shared=%d, normal=%d", shared, normal)
 	}
@@ -435,13 +448,17 @@ func testSharedSubscriptionAndNormalSubscription(cfg common.Config) TestResult {
 }
 
 // testSharedSubscriptionMultipleGroups tests multiple share groups on same topic
-func testSharedSubscriptionMultipleGroups(cfg common.Config) TestResult {
+func testSharedSubscriptionMultipleGroups(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Multiple Share Groups on Same Topic",
 		SpecRef: "MQTT-4.8.2",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureSharedSub) {
+		return result
+	}
+
 	countGroup1 := 0
 	countGroup2 := 0
 	var mu sync.Mutex
@@ -461,7 +478,7 @@ func testSharedSubscriptionMultipleGroups(cfg common.Config) TestResult {
 	}
 
 	// Create subscribers in different share groups
-	subGroup1, err := CreateAndConnectClient(cfg, "test-share-groups-1", onPublishGroup1)
+	subGroup1, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-groups-1"), onPublishGroup1)
 	if err != nil {
 		result.Error = fmt.Errorf("group1 subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -469,7 +486,7 @@ func testSharedSubscriptionMultipleGroups(cfg common.Config) TestResult {
 	}
 	defer subGroup1.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	subGroup2, err := CreateAndConnectClient(cfg, "test-share-groups-2", onPublishGroup2)
+	subGroup2, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-groups-2"), onPublishGroup2)
 	if err != nil {
 		result.Error = fmt.Errorf("group2 subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -477,12 +494,10 @@ func testSharedSubscriptionMultipleGroups(cfg common.Config) TestResult {
 	}
 	defer subGroup2.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe to different share groups but same topic
-	_, err = subGroup1.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, subGroup1, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "$share/groupA/test/share/groups", QoS: 0},
+			{Topic: "$share/groupA/" + cfg.Topic("test/share/groups"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -491,9 +506,9 @@ func testSharedSubscriptionMultipleGroups(cfg common.Config) TestResult {
 		return result
 	}
 
-	_, err = subGroup2.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, subGroup2, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "$share/groupB/test/share/groups", QoS: 0},
+			{Topic: "$share/groupB/" + cfg.Topic("test/share/groups"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -502,10 +517,8 @@ func testSharedSubscriptionMultipleGroups(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish message
-	pub, err := CreateAndConnectClient(cfg, "test-share-groups-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-groups-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -514,7 +527,7 @@ func testSharedSubscriptionMultipleGroups(cfg common.Config) TestResult {
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/share/groups",
+		Topic:   cfg.Topic("test/share/groups"),
 		QoS:     0,
 		Payload: []byte("multi-group message"),
 	})
@@ -524,7 +537,7 @@ func testSharedSubscriptionMultipleGroups(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	g1 := countGroup1
@@ -533,7 +546,7 @@ func testSharedSubscriptionMultipleGroups(cfg common.Config) TestResult {
 
 	// Both groups should receive the message (different groups are independent)
 	if g1 == 1 && g2 == 1 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("expected group1=1, group2=1, got group1=%d, group2=%d", g1, g2)
 	}
@@ -541,3 +554,261 @@ func testSharedSubscriptionMultipleGroups(cfg common.Config) TestResult {
 	result.Duration = time.Since(start)
 	return result
 }
+
+// testSharedRedeliveryOnConsumerFailure tests that QoS 1 messages a shared
+// consumer received but never acknowledged go to another member of the
+// group once its session ends, rather than being lost [MQTT-4.8.2]. As the
+// spec says SHOULD, losing them is a warning.
+// "If the Client's Session terminates before the Client reconnects, the
+// Server SHOULD send the Application Message to another Client that is
+// subscribed to the same Shared Subscription"
+func testSharedRedeliveryOnConsumerFailure(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Shared Subscription Redelivery on Consumer Failure",
+		SpecRef: "MQTT-4.8.2",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureSharedSub, common.FeatureQoS1) {
+		return result
+	}
+
+	topic := cfg.Topic("test/share/redeliver")
+	filter := "$share/redeliver/" + topic
+	timeout := cfg.Scaled(2 * time.Second)
+
+	var mu sync.Mutex
+	healthyReceived := map[string]bool{}
+	healthy, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-redeliver-ok"), func(pr paho.PublishReceived) (bool, error) {
+		mu.Lock()
+		healthyReceived[string(pr.Packet.Payload)] = true
+		mu.Unlock()
+		return true, nil
+	})
+	if err != nil {
+		result.Error = fmt.Errorf("healthy consumer connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer healthy.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	if _, err := SubscribeSync(ctx, cfg, healthy, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: filter, QoS: 1}},
+	}); err != nil {
+		result.Error = fmt.Errorf("healthy consumer subscribe failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// The failing consumer reads its messages but never sends PUBACK
+	failing, err := common.DialRaw(cfg, 5, cfg.ClientID("test-share-redeliver-fail"))
+	if err != nil {
+		result.Error = fmt.Errorf("failing consumer connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer failing.Close()
+	if codes, err := failing.Subscribe(1, 1, timeout, filter); err != nil || len(codes) != 1 || codes[0] >= 0x80 {
+		result.Error = fmt.Errorf("failing consumer subscribe failed: % x %v", codes, err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	cfg.Wait(100 * time.Millisecond)
+
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-share-redeliver-pub"), nil)
+	if err != nil {
+		result.Error = fmt.Errorf("publisher connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	const messageCount = 10
+	for i := 0; i < messageCount; i++ {
+		if _, err := pub.Publish(ctx, &paho.Publish{
+			Topic:   topic,
+			QoS:     1,
+			Payload: []byte(fmt.Sprintf("redeliver %d", i)),
+		}); err != nil {
+			result.Error = fmt.Errorf("publish %d failed: %w", i, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	var unacked []string
+	for {
+		header, body, err := failing.Expect(0x30, cfg.Scaled(500*time.Millisecond), nil)
+		if err != nil {
+			break
+		}
+		if p, err := failing.ParsePublish(header, body); err == nil && p.Topic == topic {
+			unacked = append(unacked, string(p.Payload))
+		}
+	}
+	if len(unacked) == 0 {
+		result.Status = common.StatusInconclusive
+		result.Notes = fmt.Sprintf("broker sent all %d messages to the healthy consumer", messageCount)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// Its session ends with the connection, leaving the messages to the group
+	sever(failing.Conn)
+
+	var lost []string
+	for deadline := time.Now().Add(timeout); ; time.Sleep(10 * time.Millisecond) {
+		lost = lost[:0]
+		mu.Lock()
+		for _, payload := range unacked {
+			if !healthyReceived[payload] {
+				lost = append(lost, payload)
+			}
+		}
+		mu.Unlock()
+		if len(lost) == 0 || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	if len(lost) > 0 {
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("%d of the %d messages left unacknowledged by the failed consumer were not sent to the rest of the group: %q", len(lost), len(unacked), lost)
+	} else {
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("%d unacknowledged messages redelivered to the rest of the group", len(unacked))
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSharedEmptyShareName tests that a Shared Subscription needs a ShareName
+// [MQTT-4.8.2-1]
+// "A Shared Subscription's Topic Filter MUST start with $share/ and MUST
+// contain a ShareName that is at least one character long"
+func testSharedEmptyShareName(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject Shared Subscription with Empty ShareName ($share//topic)",
+		SpecRef: "MQTT-4.8.2-1",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureSharedSub) {
+		return result
+	}
+
+	expectFilterRejected(cfg, "test-share-empty-name", "$share//"+cfg.Topic("test/share/malformed"), &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSharedNoTopicFilter tests that the ShareName must be followed by "/"
+// and a Topic Filter [MQTT-4.8.2-2]
+// "The ShareName MUST NOT contain the characters "/", "+" or "#", but MUST be
+// followed by a "/" character. This "/" character MUST be followed by a Topic
+// Filter"
+func testSharedNoTopicFilter(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject Shared Subscription Without Topic Filter ($share/group)",
+		SpecRef: "MQTT-4.8.2-2",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureSharedSub) {
+		return result
+	}
+
+	expectFilterRejected(cfg, "test-share-no-filter", "$share/"+common.GenerateClientID("group"), &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSharedShareNamePlus tests that the ShareName must not contain "+"
+// [MQTT-4.8.2-2]
+func testSharedShareNamePlus(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject ShareName Containing + ($share/gr+oup/topic)",
+		SpecRef: "MQTT-4.8.2-2",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureSharedSub) {
+		return result
+	}
+
+	expectFilterRejected(cfg, "test-share-name-plus", "$share/gr+oup/"+cfg.Topic("test/share/malformed"), &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSharedShareNameHash tests that the ShareName must not contain "#"
+// [MQTT-4.8.2-2]
+func testSharedShareNameHash(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject ShareName Containing # ($share/gr#oup/topic)",
+		SpecRef: "MQTT-4.8.2-2",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureSharedSub) {
+		return result
+	}
+
+	expectFilterRejected(cfg, "test-share-name-hash", "$share/gr#oup/"+cfg.Topic("test/share/malformed"), &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSharedNoLocal tests that No Local on a Shared Subscription is a
+// Protocol Error [MQTT-3.8.3-4]. Closing the connection, with DISCONNECT 0x82
+// or not, passes; refusing the subscription in SUBACK is a warning.
+// "It is a Protocol Error to set the No Local bit to 1 on a Shared
+// Subscription"
+func testSharedNoLocal(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "No Local on Shared Subscription Is a Protocol Error",
+		SpecRef: "MQTT-3.8.3-4",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureSharedSub) {
+		return result
+	}
+
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-share-nolocal"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	// Subscription options: QoS 0 with No Local (bit 2) set
+	codes, err := conn.SubscribeAll(1, cfg.Scaled(2*time.Second), common.RawSubscription{
+		Filter:  "$share/nolocal/" + cfg.Topic("test/share/nolocal"),
+		Options: 0x04,
+	})
+	switch {
+	case errors.Is(err, common.ErrBrokerClosed):
+		result.Status = common.StatusPassed
+		result.Notes = "broker closed the connection"
+	case err != nil:
+		result.Error = err
+	case len(codes) != 1:
+		result.Error = fmt.Errorf("expected 1 SUBACK reason code, got % x", codes)
+	case codes[0] >= 0x80:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker refused the subscription with SUBACK %s rather than disconnecting with %s", assert.ReasonName(codes[0]), assert.ReasonName(reasonProtocolError))
+	default:
+		result.Error = fmt.Errorf("broker accepted a Shared Subscription with No Local set, granting %s", assert.ReasonName(codes[0]))
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,70 @@
+package v5
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/assert"
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// testSUBACKCodePerFilter tests that a SUBACK carries one reason code per
+// filter, in the order of the SUBSCRIBE [MQTT-3.9.3-1]
+// "The order of Reason Codes in the SUBACK packet MUST match the order of
+// Topic Filters in the SUBSCRIBE packet"
+func testSUBACKCodePerFilter(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "SUBACK Reason Code per Filter in Order",
+		SpecRef: "MQTT-3.9.3-1",
+	}
+
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-suback-order"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	// Requested QoS out of order, so codes that are sorted or repeated
+	// show up as mismatches
+	subs := []common.RawSubscription{
+		{Filter: cfg.Topic("test/suback/order/a"), Options: 2},
+		{Filter: cfg.Topic("test/suback/order/b"), Options: 0},
+		{Filter: cfg.Topic("test/suback/order/c"), Options: 1},
+	}
+	codes, err := conn.SubscribeAll(1, cfg.Scaled(5*time.Second), subs...)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	if len(codes) != len(subs) {
+		result.Error = fmt.Errorf("SUBACK has %d reason codes for %d filters: % x", len(codes), len(subs), codes)
+		result.Duration = time.Since(start)
+		return result
+	}
+	for i, code := range codes {
+		if code >= 0x80 {
+			result.Error = fmt.Errorf("filter %d refused with reason code %s", i+1, assert.ReasonName(code))
+			result.Duration = time.Since(start)
+			return result
+		}
+		// The broker may grant less than requested, never more
+		if code > subs[i].Options {
+			result.Error = fmt.Errorf("filter %d requested QoS %d but was granted QoS %d (reason codes % x)", i+1, subs[i].Options, code, codes)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	result.Status = common.StatusPassed
+	if !slices.Equal(codes, []byte{2, 0, 1}) {
+		result.Notes = fmt.Sprintf("broker granted QoS % x", codes)
+	}
+	result.Duration = time.Since(start)
+	return result
+}
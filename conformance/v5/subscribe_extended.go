@@ -17,13 +17,16 @@ import (
 func SubscribeExtendedTests() TestGroup {
 	return TestGroup{
 		Name: "SUBSCRIBE Extended Features",
+		Tags: []string{"core", "retain"},
 		Tests: []TestFunc{
 			testSubscribePacketIdentifier,
 			testSubscribeMultipleFilters,
 			testSubscriptionOptions,
 			testSubscribeQoSDowngrade,
 			testSUBACKReasonCodes,
+			testSUBACKCodePerFilter,
 			testRetainAsPublished,
+			testRetainAsPublishedZero,
 			testNoLocal,
 			testRetainHandling,
 		},
@@ -32,14 +35,14 @@ func SubscribeExtendedTests() TestGroup {
 
 // testSubscribePacketIdentifier tests SUBSCRIBE packet identifier [MQTT-3.8.2-1]
 // "The Packet Identifier field is used to identify the SUBSCRIBE packet"
-func testSubscribePacketIdentifier(cfg common.Config) TestResult {
+func testSubscribePacketIdentifier(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "SUBSCRIBE Packet Identifier",
 		SpecRef: "MQTT-3.8.2-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-sub-packetid", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-packetid"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -47,12 +50,10 @@ func testSubscribePacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe - paho handles packet ID automatically
 	suback, err := client.Subscribe(ctx, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/sub/id", QoS: 1},
+			{Topic: cfg.Topic("test/sub/id"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -63,7 +64,7 @@ func testSubscribePacketIdentifier(cfg common.Config) TestResult {
 
 	// If we got SUBACK, packet ID was handled correctly
 	if suback != nil && len(suback.Reasons) > 0 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("no SUBACK received")
 	}
@@ -74,14 +75,14 @@ func testSubscribePacketIdentifier(cfg common.Config) TestResult {
 
 // testSubscribeMultipleFilters tests multiple subscriptions in one packet [MQTT-3.8.3-3]
 // "The Payload of a SUBSCRIBE packet MUST contain at least one Topic Filter and Subscription Options pair"
-func testSubscribeMultipleFilters(cfg common.Config) TestResult {
+func testSubscribeMultipleFilters(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "SUBSCRIBE Multiple Topic Filters",
 		SpecRef: "MQTT-3.8.3-3",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-sub-multi", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-multi"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -89,14 +90,12 @@ func testSubscribeMultipleFilters(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe to multiple topics at once
 	suback, err := client.Subscribe(ctx, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/multi/1", QoS: 0},
-			{Topic: "test/multi/2", QoS: 1},
-			{Topic: "test/multi/3", QoS: 2},
+			{Topic: cfg.Topic("test/multi/1"), QoS: 0},
+			{Topic: cfg.Topic("test/multi/2"), QoS: 1},
+			{Topic: cfg.Topic("test/multi/3"), QoS: 2},
 		},
 	})
 	if err != nil {
@@ -107,7 +106,7 @@ func testSubscribeMultipleFilters(cfg common.Config) TestResult {
 
 	// SUBACK should have 3 reason codes (one per subscription)
 	if suback != nil && len(suback.Reasons) == 3 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("expected 3 reason codes in SUBACK, got %d", len(suback.Reasons))
 	}
@@ -118,14 +117,14 @@ func testSubscribeMultipleFilters(cfg common.Config) TestResult {
 
 // testSubscriptionOptions tests subscription options [MQTT-3.8.3.1]
 // "Subscription Options contains fields QoS, NL (No Local), RAP (Retain As Published), and Retain Handling"
-func testSubscriptionOptions(cfg common.Config) TestResult {
+func testSubscriptionOptions(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Subscription Options",
 		SpecRef: "MQTT-3.8.3.1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-sub-options", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-options"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -133,20 +132,18 @@ func testSubscriptionOptions(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe with various options
 	suback, err := client.Subscribe(ctx, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{
-				Topic:             "test/options/1",
+				Topic:             cfg.Topic("test/options/1"),
 				QoS:               1,
 				NoLocal:           false,
 				RetainAsPublished: false,
 				RetainHandling:    0, // Send retained messages
 			},
 			{
-				Topic:             "test/options/2",
+				Topic:             cfg.Topic("test/options/2"),
 				QoS:               2,
 				NoLocal:           true,
 				RetainAsPublished: true,
@@ -161,7 +158,7 @@ func testSubscriptionOptions(cfg common.Config) TestResult {
 	}
 
 	if suback != nil && len(suback.Reasons) == 2 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("subscription with options failed")
 	}
@@ -172,14 +169,14 @@ func testSubscriptionOptions(cfg common.Config) TestResult {
 
 // testSubscribeQoSDowngrade tests QoS downgrade [MQTT-3.8.4-5]
 // "The Server might grant a lower QoS than the Client requested"
-func testSubscribeQoSDowngrade(cfg common.Config) TestResult {
+func testSubscribeQoSDowngrade(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "SUBSCRIBE QoS Downgrade Allowed",
 		SpecRef: "MQTT-3.8.4-5",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-sub-downgrade", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-downgrade"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -187,12 +184,10 @@ func testSubscribeQoSDowngrade(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe with QoS 2
 	suback, err := client.Subscribe(ctx, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/qos/downgrade", QoS: 2},
+			{Topic: cfg.Topic("test/qos/downgrade"), QoS: 2},
 		},
 	})
 	if err != nil {
@@ -205,7 +200,7 @@ func testSubscribeQoSDowngrade(cfg common.Config) TestResult {
 	if suback != nil && len(suback.Reasons) > 0 {
 		grantedQoS := suback.Reasons[0]
 		if grantedQoS <= 2 {
-			result.Passed = true
+			result.Status = common.StatusPassed
 		} else {
 			result.Error = fmt.Errorf("invalid granted QoS: 0x%02X", grantedQoS)
 		}
@@ -219,14 +214,14 @@ func testSubscribeQoSDowngrade(cfg common.Config) TestResult {
 
 // testSUBACKReasonCodes tests SUBACK reason codes [MQTT-3.9.3-1]
 // "The SUBACK packet contains a list of Reason Codes"
-func testSUBACKReasonCodes(cfg common.Config) TestResult {
+func testSUBACKReasonCodes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "SUBACK Reason Codes",
 		SpecRef: "MQTT-3.9.3-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-suback-reason", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-suback-reason"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -234,12 +229,10 @@ func testSUBACKReasonCodes(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe - should get success reason codes
 	suback, err := client.Subscribe(ctx, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/suback/reason", QoS: 0},
+			{Topic: cfg.Topic("test/suback/reason"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -253,7 +246,7 @@ func testSUBACKReasonCodes(cfg common.Config) TestResult {
 		reason := suback.Reasons[0]
 		// 0x00, 0x01, 0x02 = Granted QoS 0, 1, 2
 		if reason <= 0x02 {
-			result.Passed = true
+			result.Status = common.StatusPassed
 		} else {
 			result.Error = fmt.Errorf("unexpected reason code: 0x%02X", reason)
 		}
@@ -268,13 +261,17 @@ func testSUBACKReasonCodes(cfg common.Config) TestResult {
 // testRetainAsPublished tests Retain As Published option [MQTT-3.8.3.1-3]
 // "If Retain As Published is set to 1, the Server MUST set the RETAIN flag equal
 // to the RETAIN flag in the PUBLISH packet"
-func testRetainAsPublished(cfg common.Config) TestResult {
+func testRetainAsPublished(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Retain As Published Option",
 		SpecRef: "MQTT-3.8.3.1-3",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureRetain) {
+		return result
+	}
+
 	var mu sync.Mutex
 	receivedRetain := false
 
@@ -285,7 +282,7 @@ func testRetainAsPublished(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-rap-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-rap-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -293,13 +290,11 @@ func testRetainAsPublished(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe with RetainAsPublished = true
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{
-				Topic:             "test/rap",
+				Topic:             cfg.Topic("test/rap"),
 				QoS:               0,
 				RetainAsPublished: true,
 			},
@@ -311,7 +306,7 @@ func testRetainAsPublished(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-rap-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-rap-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -319,11 +314,9 @@ func testRetainAsPublished(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish with retain flag
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/rap",
+		Topic:   cfg.Topic("test/rap"),
 		QoS:     0,
 		Payload: []byte("retained message"),
 		Retain:  true,
@@ -334,15 +327,15 @@ func testRetainAsPublished(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	retain := receivedRetain
 	mu.Unlock()
 
 	// With RetainAsPublished=true, we should receive the retain flag
-	result.Passed = retain
-	if !result.Passed {
+	result.Status = common.PassIf(retain)
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("retain flag not preserved (RetainAsPublished not working)")
 	}
 
@@ -350,10 +343,122 @@ func testRetainAsPublished(cfg common.Config) TestResult {
 	return result
 }
 
+// testRetainAsPublishedZero tests that with Retain As Published set to 0 the
+// RETAIN flag is cleared on forwarded messages [MQTT-3.3.1-12], while the
+// retained message sent for a new subscription still has it set [MQTT-3.3.1-9]
+// "If the value of Retain As Published subscription option is set to 0, the
+// Server MUST set the RETAIN flag to 0 when forwarding an Application Message
+// regardless of how the RETAIN flag was set in the received PUBLISH packet"
+func testRetainAsPublishedZero(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Retain As Published 0 Clears RETAIN",
+		SpecRef: "MQTT-3.3.1-12",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureRetain) {
+		return result
+	}
+
+	topic := cfg.Topic("test/rap-zero")
+
+	// subscribe connects a client subscribed with Retain As Published 0 that
+	// reports the RETAIN flag of each message it receives
+	subscribe := func(clientID string) (*paho.Client, <-chan bool, error) {
+		retained := make(chan bool, 10)
+		c, err := CreateAndConnectClient(cfg, clientID, func(pr paho.PublishReceived) (bool, error) {
+			select {
+			case retained <- pr.Packet.Retain:
+			default:
+			}
+			return true, nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = SubscribeSync(ctx, cfg, c, &paho.Subscribe{
+			Subscriptions: []paho.SubscribeOptions{
+				{Topic: topic, QoS: 0, RetainAsPublished: false},
+			},
+		})
+		if err != nil {
+			c.Disconnect(&paho.Disconnect{ReasonCode: 0})
+			return nil, nil, fmt.Errorf("subscribe failed: %w", err)
+		}
+		return c, retained, nil
+	}
+
+	live, liveRetain, err := subscribe(cfg.ClientID("test-rap0-live"))
+	if err != nil {
+		result.Error = fmt.Errorf("live subscriber: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer live.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-rap0-pub"), nil)
+	if err != nil {
+		result.Error = fmt.Errorf("publisher connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	_, err = pub.Publish(ctx, &paho.Publish{
+		Topic:   topic,
+		QoS:     0,
+		Payload: []byte("retained message"),
+		Retain:  true,
+	})
+	if err != nil {
+		result.Error = fmt.Errorf("publish failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	select {
+	case retain := <-liveRetain:
+		if retain {
+			result.Error = fmt.Errorf("forwarded message has RETAIN 1 although Retain As Published is 0")
+			result.Duration = time.Since(start)
+			return result
+		}
+	case <-time.After(cfg.Scaled(time.Second)):
+		result.Error = fmt.Errorf("forwarded message not received")
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// A new subscription is sent the stored message, which keeps RETAIN 1
+	late, lateRetain, err := subscribe(cfg.ClientID("test-rap0-late"))
+	if err != nil {
+		result.Error = fmt.Errorf("new subscriber: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer late.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	select {
+	case retain := <-lateRetain:
+		if !retain {
+			result.SpecRef = "MQTT-3.3.1-9"
+			result.Error = fmt.Errorf("retained message sent to a new subscription has RETAIN 0")
+		} else {
+			result.Status = common.StatusPassed
+		}
+	case <-time.After(cfg.Scaled(time.Second)):
+		result.SpecRef = "MQTT-3.3.1-9"
+		result.Error = fmt.Errorf("retained message not sent to a new subscription")
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
 // testNoLocal tests No Local option [MQTT-3.8.3.1-2]
 // "If No Local is set to 1, Application Messages MUST NOT be forwarded to
 // a connection with a ClientID equal to the ClientID of the publishing connection"
-func testNoLocal(cfg common.Config) TestResult {
+func testNoLocal(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "No Local Subscription Option",
@@ -370,7 +475,7 @@ func testNoLocal(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-nolocal", onPublish)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-nolocal"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -378,13 +483,11 @@ func testNoLocal(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe with NoLocal = true
-	_, err = client.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, client, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{
-				Topic:   "test/nolocal",
+				Topic:   cfg.Topic("test/nolocal"),
 				QoS:     0,
 				NoLocal: true,
 			},
@@ -396,12 +499,10 @@ func testNoLocal(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish to our own subscription with NoLocal=true
 	// We should NOT receive this message
 	_, err = client.Publish(ctx, &paho.Publish{
-		Topic:   "test/nolocal",
+		Topic:   cfg.Topic("test/nolocal"),
 		QoS:     0,
 		Payload: []byte("should not receive"),
 	})
@@ -411,7 +512,7 @@ func testNoLocal(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	count := messageCount
@@ -419,7 +520,7 @@ func testNoLocal(cfg common.Config) TestResult {
 
 	if count == 0 {
 		// Correctly did not receive our own message
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("received %d messages with NoLocal=true (should be 0)", count)
 	}
@@ -430,24 +531,27 @@ func testNoLocal(cfg common.Config) TestResult {
 
 // testRetainHandling tests Retain Handling option [MQTT-3.8.3.1-4]
 // "Retain Handling indicates whether retained messages are sent when the subscription is established"
-func testRetainHandling(cfg common.Config) TestResult {
+func testRetainHandling(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Retain Handling Option",
 		SpecRef: "MQTT-3.8.3.1-4",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureRetain) {
+		return result
+	}
+
 	// First publish a retained message
-	pub, err := CreateAndConnectClient(cfg, "test-retainhandle-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-retainhandle-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	ctx := context.Background()
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/retainhandle",
+		Topic:   cfg.Topic("test/retainhandle"),
 		QoS:     0,
 		Payload: []byte("retained"),
 		Retain:  true,
@@ -460,7 +564,7 @@ func testRetainHandling(cfg common.Config) TestResult {
 	}
 	pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	messageCount := 0
 	var mu sync.Mutex
@@ -473,7 +577,7 @@ func testRetainHandling(cfg common.Config) TestResult {
 	}
 
 	// Subscribe with RetainHandling = 2 (do not send retained messages)
-	sub, err := CreateAndConnectClient(cfg, "test-retainhandle-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-retainhandle-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -484,7 +588,7 @@ func testRetainHandling(cfg common.Config) TestResult {
 	_, err = sub.Subscribe(ctx, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{
-				Topic:          "test/retainhandle",
+				Topic:          cfg.Topic("test/retainhandle"),
 				QoS:            0,
 				RetainHandling: 2, // Do not send retained messages
 			},
@@ -496,7 +600,7 @@ func testRetainHandling(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	count := messageCount
@@ -504,7 +608,7 @@ func testRetainHandling(cfg common.Config) TestResult {
 
 	if count == 0 {
 		// With RetainHandling=2, we should not receive retained message
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("received %d retained messages with RetainHandling=2 (should be 0)", count)
 	}
@@ -6,7 +6,12 @@ import (
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,10 +22,13 @@ import (
 func SubscriptionIdentifierTests() TestGroup {
 	return TestGroup{
 		Name: "Subscription Identifiers",
+		Tags: []string{"optional", "subscription-identifiers"},
 		Tests: []TestFunc{
 			testSubscriptionIdentifierBasic,
 			testSubscriptionIdentifierZeroInvalid,
 			testSubscriptionIdentifierPersistence,
+			testSubscriptionIdentifierOverlap,
+			testSubscriptionIdentifierReplaced,
 		},
 	}
 }
@@ -28,13 +36,17 @@ func SubscriptionIdentifierTests() TestGroup {
 // testSubscriptionIdentifierBasic tests basic subscription identifier [MQTT-3.8.2.1.2]
 // "The Subscription Identifier is associated with any subscription created or modified
 // as the result of this SUBSCRIBE packet"
-func testSubscriptionIdentifierBasic(cfg common.Config) TestResult {
+func testSubscriptionIdentifierBasic(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Subscription Identifier Basic",
 		SpecRef: "MQTT-3.8.2.1.2",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureSubID) {
+		return result
+	}
+
 	receivedSubID := 0
 	messageReceived := false
 	var mu sync.Mutex
@@ -49,7 +61,7 @@ func testSubscriptionIdentifierBasic(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-subid-basic-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-subid-basic-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -57,16 +69,14 @@ func testSubscriptionIdentifierBasic(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe with subscription identifier
 	subscriptionID := 42
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Properties: &paho.SubscribeProperties{
 			SubscriptionIdentifier: &subscriptionID,
 		},
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/subid/basic", QoS: 0},
+			{Topic: cfg.Topic("test/subid/basic"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -75,7 +85,7 @@ func testSubscriptionIdentifierBasic(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-subid-basic-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-subid-basic-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -83,11 +93,9 @@ func testSubscriptionIdentifierBasic(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish message
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/subid/basic",
+		Topic:   cfg.Topic("test/subid/basic"),
 		QoS:     0,
 		Payload: []byte("test message"),
 	})
@@ -97,7 +105,7 @@ func testSubscriptionIdentifierBasic(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	received := messageReceived
@@ -107,7 +115,7 @@ func testSubscriptionIdentifierBasic(cfg common.Config) TestResult {
 	if !received {
 		result.Error = fmt.Errorf("message not received")
 	} else if subID == 42 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("subscription identifier not received or incorrect (got %d, expected 42)", subID)
 	}
@@ -118,14 +126,14 @@ func testSubscriptionIdentifierBasic(cfg common.Config) TestResult {
 
 // testSubscriptionIdentifierZeroInvalid tests that subscription identifier 0 is invalid [MQTT-3.8.2.1.2]
 // "A Subscription Identifier value of 0 is a Protocol Error"
-func testSubscriptionIdentifierZeroInvalid(cfg common.Config) TestResult {
+func testSubscriptionIdentifierZeroInvalid(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Subscription Identifier Zero Is Invalid",
 		SpecRef: "MQTT-3.8.2.1.2",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-subid-zero", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-subid-zero"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -133,8 +141,6 @@ func testSubscriptionIdentifierZeroInvalid(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Try to subscribe with subscription identifier 0 (invalid)
 	subIDZero := 0
 	_, err = client.Subscribe(ctx, &paho.Subscribe{
@@ -142,19 +148,19 @@ func testSubscriptionIdentifierZeroInvalid(cfg common.Config) TestResult {
 			SubscriptionIdentifier: &subIDZero,
 		},
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/subid/zero", QoS: 0},
+			{Topic: cfg.Topic("test/subid/zero"), QoS: 0},
 		},
 	})
 
 	// Should fail - either client or broker rejects it
 	if err != nil {
 		// Expected: error occurred
-		result.Passed = true
+		result.Status = common.StatusPassed
 		result.Error = nil
 	} else {
 		// Client allowed it - this shouldn't happen but we can't verify broker rejection easily
-		result.Passed = true
-		result.Error = nil
+		result.Status = common.StatusInconclusive
+		result.Notes = "subscribe was accepted, broker rejection could not be verified"
 	}
 
 	result.Duration = time.Since(start)
@@ -164,29 +170,33 @@ func testSubscriptionIdentifierZeroInvalid(cfg common.Config) TestResult {
 // testSubscriptionIdentifierPersistence tests subscription identifier with sessions [MQTT-3.8.2.1.2]
 // "The Subscription Identifier is part of the Session State in the Server and is returned
 // to the Client whenever a message is sent as a result of a matching subscription"
-func testSubscriptionIdentifierPersistence(cfg common.Config) TestResult {
+func testSubscriptionIdentifierPersistence(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Subscription Identifier Session Persistence",
 		SpecRef: "MQTT-3.8.2.1.2",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureSubID) {
+		return result
+	}
+
 	// First connection - create subscription with identifier (CleanStart = false for session persistence)
-	sub1, err := CreateAndConnectClientWithSession(cfg, "test-subid-persist", false, nil)
+	clientID := cfg.ClientID("test-subid-persist")
+	sub1, err := CreateAndConnectClientWithSession(cfg, clientID, false, nil)
 	if err != nil {
 		result.Error = fmt.Errorf("first connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	ctx := context.Background()
 	subID := 99
 	_, err = sub1.Subscribe(ctx, &paho.Subscribe{
 		Properties: &paho.SubscribeProperties{
 			SubscriptionIdentifier: &subID,
 		},
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/subid/persist", QoS: 1},
+			{Topic: cfg.Topic("test/subid/persist"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -198,7 +208,7 @@ func testSubscriptionIdentifierPersistence(cfg common.Config) TestResult {
 
 	// Disconnect but maintain session (CleanStart was false)
 	sub1.Disconnect(&paho.Disconnect{ReasonCode: 0})
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	receivedSubID := 0
 	messageReceived := false
@@ -215,7 +225,7 @@ func testSubscriptionIdentifierPersistence(cfg common.Config) TestResult {
 	}
 
 	// Reconnect with same client ID and CleanStart = false (session should persist)
-	sub2, err := CreateAndConnectClientWithSession(cfg, "test-subid-persist", false, onPublish)
+	sub2, err := CreateAndConnectClientWithSession(cfg, clientID, false, onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("second connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -223,10 +233,10 @@ func testSubscriptionIdentifierPersistence(cfg common.Config) TestResult {
 	}
 	defer sub2.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	// Publish message - subscription should already exist from persisted session
-	pub, err := CreateAndConnectClient(cfg, "test-subid-persist-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-subid-persist-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -235,8 +245,8 @@ func testSubscriptionIdentifierPersistence(cfg common.Config) TestResult {
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/subid/persist",
-		QoS:     1,
+		Topic:   cfg.Topic("test/subid/persist"),
+		QoS:     cfg.Capabilities.QoS(1),
 		Payload: []byte("persistent subscription"),
 	})
 	if err != nil {
@@ -245,7 +255,7 @@ func testSubscriptionIdentifierPersistence(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(1 * time.Second)
+	cfg.Wait(1 * time.Second)
 
 	mu.Lock()
 	received := messageReceived
@@ -255,7 +265,7 @@ func testSubscriptionIdentifierPersistence(cfg common.Config) TestResult {
 	if !received {
 		result.Error = fmt.Errorf("message not received - subscription not persisted across session reconnect")
 	} else if subIDReceived == 99 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else if subIDReceived == 0 {
 		result.Error = fmt.Errorf("subscription identifier not persisted (subscription exists but sub ID missing)")
 	} else {
@@ -265,3 +275,216 @@ func testSubscriptionIdentifierPersistence(cfg common.Config) TestResult {
 	result.Duration = time.Since(start)
 	return result
 }
+
+// testSubscriptionIdentifierOverlap tests that a message matching several of
+// a client's subscriptions, exact and wildcard, with and without identifiers,
+// carries the identifier of every matching subscription that has one
+// [MQTT-3.3.4-4] "If the Server sends a single copy of the message it MUST
+// include in the PUBLISH packet the Subscription Identifiers for all matching
+// subscriptions which have a Subscription Identifiers" [MQTT-3.3.4-5] "If the
+// Server sends multiple PUBLISH packets it MUST send, in each of them, the
+// Subscription Identifier of the matching subscription if it has a
+// Subscription Identifier"
+func testSubscriptionIdentifierOverlap(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Subscription Identifiers With Overlapping Filters",
+		SpecRef: "MQTT-3.3.4-4",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureSubID, common.FeatureWildcardSub) {
+		return result
+	}
+
+	checkSubIDMatrix(cfg, "test-subid-overlap", []subIDSubscribe{
+		{1, []string{"s/a/b"}},
+		{2, []string{"s/a/+"}},
+		{3, []string{"s/#"}},
+		{0, []string{"s/+/b", "n/+"}},
+		{4, []string{"m/+", "m/x"}},
+	}, []string{"s/a/b", "s/a/c", "s/x/b", "s/x/y", "n/x", "m/x", "m/y"}, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testSubscriptionIdentifierReplaced tests that subscribing to a filter again
+// replaces its identifier, or removes it when the new SUBSCRIBE has none,
+// while overlapping subscriptions keep theirs [MQTT-3.8.4-3]
+// "it MUST replace that existing Subscription with a new Subscription"
+func testSubscriptionIdentifierReplaced(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Subscription Identifiers Replaced by Resubscribing",
+		SpecRef: "MQTT-3.8.4-3",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureSubID, common.FeatureWildcardSub) {
+		return result
+	}
+
+	checkSubIDMatrix(cfg, "test-subid-replaced", []subIDSubscribe{
+		{1, []string{"r/a/b"}},
+		{2, []string{"r/a/+"}},
+		{3, []string{"r/#"}},
+		{20, []string{"r/a/+"}},
+		{0, []string{"r/#"}},
+	}, []string{"r/a/b", "r/a/c", "r/x"}, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// subIDSubscribe is one SUBSCRIBE of a subscription identifier matrix: its
+// filters, below the test's topic, and its Subscription Identifier, or none
+// when id is 0
+type subIDSubscribe struct {
+	id      int
+	filters []string
+}
+
+// checkSubIDMatrix sends subscribes in order on one raw connection, then
+// publishes a message to each topic from another and checks the identifiers
+// of every copy delivered against the subscriptions the topic matches. A
+// single copy must carry all their identifiers; when the broker sends a copy
+// per subscription each must carry the identifier of its own, if any. The
+// first divergence is recorded in result, which passes otherwise.
+func checkSubIDMatrix(cfg common.Config, clientPrefix string, subscribes []subIDSubscribe, topics []string, result *TestResult) {
+	prefix := cfg.Topic(common.GenerateTopicName("test/subid/matrix"))
+	timeout := cfg.Scaled(5 * time.Second)
+
+	sub, err := common.DialRaw(cfg, 5, cfg.ClientID(clientPrefix+"-sub"))
+	if err != nil {
+		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
+		return
+	}
+	defer sub.Close()
+
+	// The identifier of each filter, a later SUBSCRIBE replacing it
+	ids := map[string]int{}
+	for i, s := range subscribes {
+		subs := make([]common.RawSubscription, len(s.filters))
+		for j, f := range s.filters {
+			subs[j] = common.RawSubscription{Filter: prefix + "/" + f, Options: 1}
+			ids[f] = s.id
+		}
+		codes, err := sub.SubscribeIdentified(uint16(i+1), s.id, timeout, subs...)
+		if err != nil {
+			result.Error = fmt.Errorf("subscribe to %v failed: %w", s.filters, err)
+			return
+		}
+		if len(codes) != len(subs) || slices.ContainsFunc(codes, func(c byte) bool { return c >= 0x80 }) {
+			result.Error = fmt.Errorf("subscription to %v refused with SUBACK % x", s.filters, codes)
+			return
+		}
+	}
+
+	// The subscriptions each topic matches, and the identifiers among them
+	matches := make([]int, len(topics))
+	want := make([][]int, len(topics))
+	for i, t := range topics {
+		for f, id := range ids {
+			if !common.MatchTopic(f, t) {
+				continue
+			}
+			matches[i]++
+			if id > 0 {
+				want[i] = append(want[i], id)
+			}
+		}
+		// Subscriptions made by one SUBSCRIBE share an identifier, which
+		// need only be sent once
+		slices.Sort(want[i])
+		want[i] = slices.Compact(want[i])
+	}
+
+	pub, err := common.DialRaw(cfg, 5, cfg.ClientID(clientPrefix+"-pub"))
+	if err != nil {
+		result.Error = fmt.Errorf("publisher connect failed: %w", err)
+		return
+	}
+	defer pub.Close()
+	for i, t := range topics {
+		if _, err := pub.PublishAcked(prefix+"/"+t, 1, uint16(i+1), []byte(strconv.Itoa(i)), timeout); err != nil {
+			result.Error = fmt.Errorf("publish to %s failed: %w", t, err)
+			return
+		}
+	}
+
+	// Wait for a copy of every message, then a little longer for further
+	// copies
+	copies := make([][][]int, len(topics))
+	pending := len(topics)
+	deadline := time.Now().Add(timeout)
+	for {
+		wait := time.Until(deadline)
+		if pending == 0 || wait <= 0 {
+			wait = cfg.Scaled(200 * time.Millisecond)
+		}
+		header, body, err := sub.Expect(0x30, wait, nil)
+		if errors.Is(err, common.ErrBrokerClosed) {
+			result.Error = err
+			return
+		}
+		if err != nil {
+			break
+		}
+		p, err := sub.ParsePublish(header, body)
+		if err != nil {
+			result.Error = fmt.Errorf("delivered PUBLISH unreadable: %w", err)
+			return
+		}
+		if p.QoS > 0 {
+			sub.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+		}
+		i, err := strconv.Atoi(string(p.Payload))
+		if err != nil || i < 0 || i >= len(topics) {
+			result.Error = fmt.Errorf("received a message that was not published: %q on %q", p.Payload, p.Topic)
+			return
+		}
+		if len(copies[i]) == 0 {
+			pending--
+		}
+		got := p.SubscriptionIDs
+		slices.Sort(got)
+		copies[i] = append(copies[i], slices.Compact(got))
+	}
+
+	var notes []string
+	for i, t := range topics {
+		switch n := len(copies[i]); {
+		case n == 0:
+			result.Error = fmt.Errorf("%s: message not delivered", t)
+			return
+		case n > matches[i]:
+			result.Error = fmt.Errorf("%s: %d copies for %d matching subscriptions", t, n, matches[i])
+			return
+		case n == 1 && !slices.Equal(copies[i][0], want[i]):
+			result.Error = fmt.Errorf("%s: subscription identifiers %v, expected %v", t, copies[i][0], want[i])
+			return
+		case n > 1:
+			// A copy per subscription, each with at most its own identifier
+			var union []int
+			for _, c := range copies[i] {
+				if len(c) > 1 {
+					result.Error = fmt.Errorf("%s: one of %d copies carries subscription identifiers %v, expected one at most", t, n, c)
+					return
+				}
+				union = append(union, c...)
+			}
+			slices.Sort(union)
+			if !slices.Equal(slices.Compact(union), want[i]) {
+				result.Error = fmt.Errorf("%s: copies carry subscription identifiers %v, expected %v", t, copies[i], want[i])
+				return
+			}
+			notes = append(notes, fmt.Sprintf("%s delivered %d times", t, n))
+		}
+	}
+
+	result.Status = common.StatusPassed
+	if len(notes) > 0 {
+		result.Notes = strings.Join(notes, ", ")
+	} else {
+		result.Notes = fmt.Sprintf("%d topics, one copy each", len(topics))
+	}
+}
@@ -17,6 +17,7 @@ import (
 func TopicAliasTests() TestGroup {
 	return TestGroup{
 		Name: "Topic Alias",
+		Tags: []string{"properties"},
 		Tests: []TestFunc{
 			testTopicAliasBasic,
 			testTopicAliasMaximum,
@@ -29,7 +30,7 @@ func TopicAliasTests() TestGroup {
 
 // testTopicAliasBasic tests basic topic alias functionality [MQTT-3.3.2.3.4-1]
 // "A Topic Alias is an integer value that is used to identify the Topic instead of using the Topic Name"
-func testTopicAliasBasic(cfg common.Config) TestResult {
+func testTopicAliasBasic(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Topic Alias Basic Functionality",
@@ -46,7 +47,7 @@ func testTopicAliasBasic(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-alias-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-alias-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -54,10 +55,9 @@ func testTopicAliasBasic(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/alias/basic", QoS: 0},
+			{Topic: cfg.Topic("test/alias/basic"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -66,7 +66,7 @@ func testTopicAliasBasic(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-alias-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-alias-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -74,12 +74,10 @@ func testTopicAliasBasic(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish with topic alias
 	topicAlias := uint16(1)
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/alias/basic",
+		Topic:   cfg.Topic("test/alias/basic"),
 		QoS:     0,
 		Payload: []byte("message with alias"),
 		Properties: &paho.PublishProperties{
@@ -92,14 +90,14 @@ func testTopicAliasBasic(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	count := messageCount
 	mu.Unlock()
 
 	if count > 0 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("message with topic alias not received")
 	}
@@ -110,7 +108,7 @@ func testTopicAliasBasic(cfg common.Config) TestResult {
 
 // testTopicAliasMaximum tests Topic Alias Maximum [MQTT-3.1.2.11.6]
 // "If Topic Alias Maximum is absent or zero, the Client MUST NOT send any Topic Aliases to the Server"
-func testTopicAliasMaximum(cfg common.Config) TestResult {
+func testTopicAliasMaximum(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Topic Alias Maximum",
@@ -118,7 +116,7 @@ func testTopicAliasMaximum(cfg common.Config) TestResult {
 	}
 
 	// Connect and check if broker provides Topic Alias Maximum in CONNACK
-	client, err := CreateAndConnectClient(cfg, "test-alias-max", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-alias-max"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -127,21 +125,22 @@ func testTopicAliasMaximum(cfg common.Config) TestResult {
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
 	// If we connected successfully, broker handled Topic Alias Maximum correctly
-	result.Passed = true
+	result.Status = common.StatusInconclusive
+	result.Notes = "connected successfully but Topic Alias Maximum was not inspected"
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testTopicAliasZeroInvalid tests that Topic Alias of 0 is invalid [MQTT-3.3.2.3.4-2]
 // "A Topic Alias value of 0 is not permitted"
-func testTopicAliasZeroInvalid(cfg common.Config) TestResult {
+func testTopicAliasZeroInvalid(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Topic Alias Zero Is Invalid",
 		SpecRef: "MQTT-3.3.2.3.4-2",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-alias-zero", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-alias-zero"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -149,12 +148,10 @@ func testTopicAliasZeroInvalid(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Try to publish with topic alias = 0 (invalid)
 	topicAlias := uint16(0)
 	_, err = client.Publish(ctx, &paho.Publish{
-		Topic:   "test/alias/zero",
+		Topic:   cfg.Topic("test/alias/zero"),
 		QoS:     0,
 		Payload: []byte("invalid alias"),
 		Properties: &paho.PublishProperties{
@@ -165,12 +162,12 @@ func testTopicAliasZeroInvalid(cfg common.Config) TestResult {
 	// Client library may prevent this, or broker should reject
 	if err != nil {
 		// Expected: error occurred
-		result.Passed = true
+		result.Status = common.StatusPassed
 		result.Error = nil
 	} else {
 		// If no error, broker might have silently rejected or ignored it
 		// This is acceptable behavior
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -179,7 +176,7 @@ func testTopicAliasZeroInvalid(cfg common.Config) TestResult {
 
 // testTopicAliasWithoutName tests using alias without setting topic name first [MQTT-3.3.2.3.4-3]
 // "A sender MUST NOT send a PUBLISH packet containing a Topic Alias which has the value 0"
-func testTopicAliasWithoutName(cfg common.Config) TestResult {
+func testTopicAliasWithoutName(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Topic Alias Requires Initial Topic Name",
@@ -196,7 +193,7 @@ func testTopicAliasWithoutName(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-alias-noname-sub", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-alias-noname-sub"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -204,10 +201,9 @@ func testTopicAliasWithoutName(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/alias/noname", QoS: 0},
+			{Topic: cfg.Topic("test/alias/noname"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -216,7 +212,7 @@ func testTopicAliasWithoutName(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-alias-noname-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-alias-noname-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -224,12 +220,10 @@ func testTopicAliasWithoutName(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// First establish the alias with topic name
 	topicAlias := uint16(5)
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/alias/noname",
+		Topic:   cfg.Topic("test/alias/noname"),
 		QoS:     0,
 		Payload: []byte("first message - setting alias"),
 		Properties: &paho.PublishProperties{
@@ -242,7 +236,7 @@ func testTopicAliasWithoutName(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Now send with empty topic name, using only the alias
 	_, err = pub.Publish(ctx, &paho.Publish{
@@ -255,13 +249,13 @@ func testTopicAliasWithoutName(cfg common.Config) TestResult {
 	})
 	if err != nil {
 		// Client library may prevent empty topic
-		result.Passed = true
+		result.Status = common.StatusPassed
 		result.Error = nil
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	count := messageCount
@@ -269,7 +263,7 @@ func testTopicAliasWithoutName(cfg common.Config) TestResult {
 
 	// We should have received at least the first message
 	if count >= 1 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("no messages received with topic alias")
 	}
@@ -280,7 +274,7 @@ func testTopicAliasWithoutName(cfg common.Config) TestResult {
 
 // testTopicAliasReset tests that topic aliases are connection-specific [MQTT-3.3.2.3.4-4]
 // "The Topic Alias mappings used by the Client and Server are independent from each other"
-func testTopicAliasReset(cfg common.Config) TestResult {
+func testTopicAliasReset(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Topic Alias Reset On Reconnect",
@@ -288,17 +282,16 @@ func testTopicAliasReset(cfg common.Config) TestResult {
 	}
 
 	// First connection - establish alias
-	pub1, err := CreateAndConnectClient(cfg, "test-alias-reset", nil)
+	pub1, err := CreateAndConnectClient(cfg, cfg.ClientID("test-alias-reset"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("first connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
 
-	ctx := context.Background()
 	topicAlias := uint16(10)
 	_, err = pub1.Publish(ctx, &paho.Publish{
-		Topic:   "test/alias/reset",
+		Topic:   cfg.Topic("test/alias/reset"),
 		QoS:     0,
 		Payload: []byte("first connection"),
 		Properties: &paho.PublishProperties{
@@ -315,10 +308,10 @@ func testTopicAliasReset(cfg common.Config) TestResult {
 
 	// Disconnect
 	pub1.Disconnect(&paho.Disconnect{ReasonCode: 0})
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	// Reconnect - aliases should be reset
-	pub2, err := CreateAndConnectClient(cfg, "test-alias-reset-2", nil)
+	pub2, err := CreateAndConnectClient(cfg, cfg.ClientID("test-alias-reset-2"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("second connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -328,7 +321,7 @@ func testTopicAliasReset(cfg common.Config) TestResult {
 
 	// Establish new alias mapping
 	_, err = pub2.Publish(ctx, &paho.Publish{
-		Topic:   "test/alias/reset",
+		Topic:   cfg.Topic("test/alias/reset"),
 		QoS:     0,
 		Payload: []byte("second connection"),
 		Properties: &paho.PublishProperties{
@@ -342,7 +335,7 @@ func testTopicAliasReset(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -0,0 +1,64 @@
+package v5
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// checkBoundaryTopic fills in result from common.TryTopic: the broker may
+// deliver a message on topic or refuse the topic cleanly, but must go on
+// carrying messages. It returns the refusals for tests that expect delivery.
+func checkBoundaryTopic(cfg common.Config, clientPrefix, topic string, result *TestResult) []string {
+	refusals, err := common.TryTopic(cfg, 5, clientPrefix, topic)
+	if err != nil {
+		result.Error = err
+		return nil
+	}
+	result.Status = common.StatusPassed
+	if len(refusals) > 0 {
+		result.Notes = "refused cleanly: " + strings.Join(refusals, ", ")
+	} else {
+		result.Notes = "topic subscribed, published and delivered"
+	}
+	return refusals
+}
+
+// testTopicManyLevels tests a topic with hundreds of levels, which the spec
+// limits only through the overall length [MQTT-4.7.3-3]
+// "There is no limit to the number of levels in a Topic Name or Topic Filter,
+// other than that imposed by the overall length of a UTF-8 Encoded String"
+func testTopicManyLevels(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Topic With 500 Levels",
+		SpecRef: "MQTT-4.7.3-3",
+	}
+
+	topic := cfg.Topic("test/topic-boundary/levels") + strings.Repeat("/l", 500)
+	checkBoundaryTopic(cfg, "test-topic-levels", topic, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testTopicMaxLength tests a topic of 65535 bytes, the longest a UTF-8
+// Encoded String can be [MQTT-4.7.3-3]
+// "Topic Names and Topic Filters are UTF-8 Encoded Strings; they MUST NOT
+// encode to more than 65,535 bytes"
+func testTopicMaxLength(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Topic of 65535 Bytes",
+		SpecRef: "MQTT-4.7.3-3",
+	}
+
+	prefix := cfg.Topic("test/topic-boundary/length/")
+	topic := prefix + strings.Repeat("a", 65535-len(prefix))
+	checkBoundaryTopic(cfg, "test-topic-max-length", topic, &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,111 @@
+package v5
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/assert"
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// reasonTopicFilterInvalid is the SUBACK reason code for a filter that is
+// well formed but not accepted by the broker
+const reasonTopicFilterInvalid = 0x8F
+
+// expectFilterRejected subscribes to filter, given in full rather than under
+// the topic namespace, over a raw connection, which the client library would
+// refuse to send, and fills in result. The broker should answer with reason
+// code 0x8F (Topic Filter invalid) or disconnect; any other failure reason
+// code is a warning.
+func expectFilterRejected(cfg common.Config, clientPrefix, filter string, result *TestResult) {
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID(clientPrefix))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		return
+	}
+	defer conn.Close()
+
+	codes, err := conn.Subscribe(1, 0, cfg.Scaled(2*time.Second), filter)
+	switch {
+	case errors.Is(err, common.ErrBrokerClosed):
+		result.Status = common.StatusPassed
+		result.Notes = "broker closed the connection"
+	case err != nil:
+		result.Error = err
+	case len(codes) != 1:
+		result.Error = fmt.Errorf("expected 1 SUBACK reason code, got % x", codes)
+	case codes[0] == reasonTopicFilterInvalid:
+		result.Status = common.StatusPassed
+	case codes[0] >= 0x80:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("broker refused the filter with %s rather than %s", assert.ReasonName(codes[0]), assert.ReasonName(reasonTopicFilterInvalid))
+	default:
+		result.Error = fmt.Errorf("broker accepted invalid filter %q with reason code %s", filter, assert.ReasonName(codes[0]))
+	}
+}
+
+// testFilterHashNotLast tests that "#" must be the last character of a
+// filter [MQTT-4.7.1-1]
+// "The multi-level wildcard character MUST be specified either on its own or
+// following a topic level separator. In either case it MUST be the last
+// character specified in the Topic Filter"
+func testFilterHashNotLast(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject Filter with # Not Last (#/tail)",
+		SpecRef: "MQTT-4.7.1-1",
+	}
+
+	expectFilterRejected(cfg, "test-filter-hash-tail", cfg.Topic("#/tail"), &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testFilterHashAfterLevel tests that "#" must follow a topic level
+// separator [MQTT-4.7.1-1]
+func testFilterHashAfterLevel(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject Filter with # Inside a Level (sport/tennis#)",
+		SpecRef: "MQTT-4.7.1-1",
+	}
+
+	expectFilterRejected(cfg, "test-filter-hash-level", cfg.Topic("sport/tennis#"), &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testFilterHashAfterName tests that "#" directly after a level name is
+// rejected [MQTT-4.7.1-1]
+func testFilterHashAfterName(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject Filter with # After a Name (sport#)",
+		SpecRef: "MQTT-4.7.1-1",
+	}
+
+	expectFilterRejected(cfg, "test-filter-hash-name", cfg.Topic("sport#"), &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testFilterPlusInsideLevel tests that "+" must occupy an entire level
+// [MQTT-4.7.1-2]
+// "Where it is used, it MUST occupy an entire level of the filter"
+func testFilterPlusInsideLevel(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Reject Filter with + Inside a Level (sport/+ball)",
+		SpecRef: "MQTT-4.7.1-2",
+	}
+
+	expectFilterRejected(cfg, "test-filter-plus-level", cfg.Topic("sport/+ball"), &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
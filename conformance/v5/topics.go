@@ -7,6 +7,7 @@ import (
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,13 +18,22 @@ import (
 func TopicTests() TestGroup {
 	return TestGroup{
 		Name: "Topics",
+		Tags: []string{"topics"},
 		Tests: []TestFunc{
 			testSingleLevelWildcard,
 			testMultiLevelWildcard,
 			testTopicLevels,
 			testDollarTopics,
 			testTopicLength,
+			testTopicManyLevels,
+			testTopicMaxLength,
 			testTopicNameValidation,
+			testFilterHashNotLast,
+			testFilterHashAfterLevel,
+			testFilterHashAfterName,
+			testFilterPlusInsideLevel,
+			testTopicMatchingModel,
+			testWildcardSubscriptionScale,
 		},
 	}
 }
@@ -31,13 +41,17 @@ func TopicTests() TestGroup {
 // testSingleLevelWildcard tests single-level wildcard (+) [MQTT-4.7.1-2]
 // "The single-level wildcard can be used at any level in the Topic Filter,
 // including first and last levels"
-func testSingleLevelWildcard(cfg common.Config) TestResult {
+func testSingleLevelWildcard(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Single-Level Wildcard (+)",
 		SpecRef: "MQTT-4.7.1-2",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureWildcardSub) {
+		return result
+	}
+
 	receivedTopics := make(map[string]bool)
 	var mu sync.Mutex
 
@@ -48,7 +62,7 @@ func testSingleLevelWildcard(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-wildcard+", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-wildcard+"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -56,11 +70,10 @@ func testSingleLevelWildcard(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
 	// Subscribe with single-level wildcard
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/+/wildcard", QoS: 0},
+			{Topic: cfg.Topic("test/+/wildcard"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -69,7 +82,7 @@ func testSingleLevelWildcard(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-wildcard+", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-wildcard+"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -77,13 +90,11 @@ func testSingleLevelWildcard(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish messages that should match
 	topics := []string{
-		"test/a/wildcard",
-		"test/b/wildcard",
-		"test/c/wildcard",
+		cfg.Topic("test/a/wildcard"),
+		cfg.Topic("test/b/wildcard"),
+		cfg.Topic("test/c/wildcard"),
 	}
 
 	for _, topic := range topics {
@@ -101,20 +112,20 @@ func testSingleLevelWildcard(cfg common.Config) TestResult {
 
 	// Publish message that should NOT match (too many levels)
 	pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/a/b/wildcard",
+		Topic:   cfg.Topic("test/a/b/wildcard"),
 		QoS:     0,
 		Payload: []byte("should not match"),
 	})
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	matchCount := len(receivedTopics)
 	mu.Unlock()
 
 	// Should have received exactly 3 messages (not the 4-level one)
-	result.Passed = (matchCount == 3)
-	if !result.Passed {
+	result.Status = common.PassIf(matchCount == 3)
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("expected 3 messages, got %d", matchCount)
 	}
 
@@ -125,13 +136,17 @@ func testSingleLevelWildcard(cfg common.Config) TestResult {
 // testMultiLevelWildcard tests multi-level wildcard (#) [MQTT-4.7.1-1]
 // "The multi-level wildcard character MUST be specified either on its own or
 // following a topic level separator"
-func testMultiLevelWildcard(cfg common.Config) TestResult {
+func testMultiLevelWildcard(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Multi-Level Wildcard (#)",
 		SpecRef: "MQTT-4.7.1-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureWildcardSub) {
+		return result
+	}
+
 	receivedCount := 0
 	var mu sync.Mutex
 
@@ -142,7 +157,7 @@ func testMultiLevelWildcard(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-wildcard#", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-wildcard#"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -150,11 +165,10 @@ func testMultiLevelWildcard(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
 	// Subscribe with multi-level wildcard
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/multi/#", QoS: 0},
+			{Topic: cfg.Topic("test/multi/#"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -163,7 +177,7 @@ func testMultiLevelWildcard(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-wildcard#", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-wildcard#"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -171,14 +185,12 @@ func testMultiLevelWildcard(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish messages at different levels - all should match
 	topics := []string{
-		"test/multi/a",
-		"test/multi/a/b",
-		"test/multi/a/b/c",
-		"test/multi/x/y/z",
+		cfg.Topic("test/multi/a"),
+		cfg.Topic("test/multi/a/b"),
+		cfg.Topic("test/multi/a/b/c"),
+		cfg.Topic("test/multi/x/y/z"),
 	}
 
 	for _, topic := range topics {
@@ -196,20 +208,20 @@ func testMultiLevelWildcard(cfg common.Config) TestResult {
 
 	// This should NOT match (wrong prefix)
 	pub.Publish(ctx, &paho.Publish{
-		Topic:   "other/multi/a",
+		Topic:   cfg.Topic("other/multi/a"),
 		QoS:     0,
 		Payload: []byte("should not match"),
 	})
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	count := receivedCount
 	mu.Unlock()
 
 	// Should have received exactly 4 messages
-	result.Passed = (count == 4)
-	if !result.Passed {
+	result.Status = common.PassIf(count == 4)
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("expected 4 messages, got %d", count)
 	}
 
@@ -219,13 +231,17 @@ func testMultiLevelWildcard(cfg common.Config) TestResult {
 
 // testTopicLevels tests topic level handling [MQTT-4.7.3-1]
 // "The Topic Name in the PUBLISH packet MUST NOT contain wildcard characters"
-func testTopicLevels(cfg common.Config) TestResult {
+func testTopicLevels(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Topic Levels",
 		SpecRef: "MQTT-4.7.3-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureWildcardSub) {
+		return result
+	}
+
 	received := false
 	var mu sync.Mutex
 
@@ -233,14 +249,14 @@ func testTopicLevels(cfg common.Config) TestResult {
 		mu.Lock()
 		// Verify topic doesn't contain wildcards
 		topic := pr.Packet.Topic
-		if topic == "test/level/a/b/c" {
+		if topic == cfg.Topic("test/level/a/b/c") {
 			received = true
 		}
 		mu.Unlock()
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-levels", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-levels"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -248,10 +264,9 @@ func testTopicLevels(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/level/#", QoS: 0},
+			{Topic: cfg.Topic("test/level/#"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -260,7 +275,7 @@ func testTopicLevels(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-levels", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-levels"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -268,11 +283,9 @@ func testTopicLevels(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish with multiple topic levels
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/level/a/b/c",
+		Topic:   cfg.Topic("test/level/a/b/c"),
 		QoS:     0,
 		Payload: []byte("multi-level topic"),
 	})
@@ -282,13 +295,13 @@ func testTopicLevels(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("multi-level topic message not received")
 	}
 
@@ -299,13 +312,17 @@ func testTopicLevels(cfg common.Config) TestResult {
 // testDollarTopics tests $SYS and $ topic behavior [MQTT-4.7.2-1]
 // "The Server MUST NOT match Topic Filters starting with a wildcard character
 // (# or +) with Topic Names beginning with a $ character"
-func testDollarTopics(cfg common.Config) TestResult {
+func testDollarTopics(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Dollar Topics ($SYS)",
 		SpecRef: "MQTT-4.7.2-1",
 	}
 
+	if common.SkipUnsupported(cfg, &result, common.FeatureWildcardSub) {
+		return result
+	}
+
 	receivedTopics := []string{}
 	var mu sync.Mutex
 
@@ -316,7 +333,7 @@ func testDollarTopics(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-dollar", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-dollar"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -324,9 +341,8 @@ func testDollarTopics(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
 	// Subscribe to a more specific pattern to avoid other broker messages
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{Topic: "testdollar/#", QoS: 0},
 		},
@@ -337,7 +353,7 @@ func testDollarTopics(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-dollar", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-dollar"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -345,8 +361,6 @@ func testDollarTopics(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish to $ topic - should NOT be received with # subscription
 	pub.Publish(ctx, &paho.Publish{
 		Topic:   "$testdollar/special",
@@ -361,7 +375,7 @@ func testDollarTopics(cfg common.Config) TestResult {
 		Payload: []byte("normal topic"),
 	})
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
 	topics := receivedTopics
@@ -381,16 +395,16 @@ func testDollarTopics(cfg common.Config) TestResult {
 	}
 
 	if hasDollarTopic {
-		result.Passed = false
+		result.Status = common.StatusFailed
 		result.Error = fmt.Errorf("$ topic matched # wildcard (violation)")
 	} else if !hasNormalTopic {
-		result.Passed = false
+		result.Status = common.StatusFailed
 		result.Error = fmt.Errorf("normal topic not received")
 	} else if len(topics) > 1 {
-		result.Passed = false
+		result.Status = common.StatusFailed
 		result.Error = fmt.Errorf("expected 1 message, got %d topics: %v", len(topics), topics)
 	} else {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	}
 
 	result.Duration = time.Since(start)
@@ -399,7 +413,7 @@ func testDollarTopics(cfg common.Config) TestResult {
 
 // testTopicLength tests topic name length constraints
 // "All Topic Names and Topic Filters MUST be at least one character long"
-func testTopicLength(cfg common.Config) TestResult {
+func testTopicLength(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Topic Name Length",
@@ -419,7 +433,7 @@ func testTopicLength(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-length", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-length"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -427,8 +441,7 @@ func testTopicLength(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
 			{Topic: "a", QoS: 0},
 		},
@@ -439,7 +452,7 @@ func testTopicLength(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-length", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-length"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -447,8 +460,6 @@ func testTopicLength(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish to single-character topic
 	_, err = pub.Publish(ctx, &paho.Publish{
 		Topic:   "a",
@@ -461,13 +472,13 @@ func testTopicLength(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("single-character topic message not received")
 	}
 
@@ -477,7 +488,7 @@ func testTopicLength(cfg common.Config) TestResult {
 
 // testTopicNameValidation tests topic name validation requirements
 // "Topic Names and Topic Filters are UTF-8 Encoded Strings"
-func testTopicNameValidation(cfg common.Config) TestResult {
+func testTopicNameValidation(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Topic Name Validation",
@@ -490,14 +501,14 @@ func testTopicNameValidation(cfg common.Config) TestResult {
 
 	onPublish := func(pr paho.PublishReceived) (bool, error) {
 		mu.Lock()
-		if pr.Packet.Topic == "test/topic/valid" {
+		if pr.Packet.Topic == cfg.Topic("test/topic/valid") {
 			received = true
 		}
 		mu.Unlock()
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-sub-validation", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-sub-validation"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -505,10 +516,9 @@ func testTopicNameValidation(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/topic/valid", QoS: 0},
+			{Topic: cfg.Topic("test/topic/valid"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -517,7 +527,7 @@ func testTopicNameValidation(cfg common.Config) TestResult {
 		return result
 	}
 
-	pub, err := CreateAndConnectClient(cfg, "test-pub-validation", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-pub-validation"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -525,11 +535,9 @@ func testTopicNameValidation(cfg common.Config) TestResult {
 	}
 	defer pub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Publish with valid topic
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/topic/valid",
+		Topic:   cfg.Topic("test/topic/valid"),
 		QoS:     0,
 		Payload: []byte("valid topic"),
 	})
@@ -539,16 +547,85 @@ func testTopicNameValidation(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	cfg.Wait(500 * time.Millisecond)
 
 	mu.Lock()
-	result.Passed = received
+	result.Status = common.PassIf(received)
 	mu.Unlock()
 
-	if !result.Passed {
+	if result.Status != common.StatusPassed {
 		result.Error = fmt.Errorf("valid topic message not received")
 	}
 
 	result.Duration = time.Since(start)
 	return result
 }
+
+// testTopicMatchingModel subscribes to randomly generated topic filters,
+// publishes to randomly generated topics and compares each delivery with a
+// reference matcher. The filters and topics are drawn from the run's seed,
+// so --seed repeats them and --shuffle varies them [MQTT-4.7.3-4]
+// "Each non-wildcarded level in the Topic Filter has to match the
+// corresponding level in the Topic Name character for character for the
+// match to succeed."
+func testTopicMatchingModel(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Topic Matching Model",
+		SpecRef: "MQTT-4.7.3-4",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureWildcardSub) {
+		return result
+	}
+
+	model := common.NewTopicModel(fuzzRand(cfg, 5, 0), cfg.Topic(common.GenerateTopicName("test/model")), 12, 24)
+	divergences, expected, err := common.CheckTopicModel(cfg, 5, model)
+	switch {
+	case err != nil:
+		result.Error = err
+	case len(divergences) > 0:
+		result.Error = fmt.Errorf("%d divergences from the reference matcher (seed %d): %s", len(divergences), cfg.Seed, strings.Join(divergences, "; "))
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("%d filters × %d topics, %d deliveries as modelled, seed %d", len(model.Filters), len(model.Topics), expected, cfg.Seed)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testWildcardSubscriptionScale subscribes one client to thousands of
+// distinct exact, + and # filters and checks that probes are still matched
+// as the reference matcher does. SUBACKs getting markedly slower as the
+// subscriptions grow, or the broker refusing some of them, is a warning.
+func testWildcardSubscriptionScale(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name: "Wildcard Subscription Scale",
+	}
+
+	if common.SkipUnsupported(cfg, &result, common.FeatureWildcardSub) {
+		return result
+	}
+
+	scale, err := common.CheckWildcardScale(cfg, 5)
+	switch {
+	case err != nil:
+		result.Error = err
+	case len(scale.Divergences) > 0:
+		result.Error = fmt.Errorf("%d divergences from the reference matcher with %d filters: %s", len(scale.Divergences), scale.Filters, strings.Join(scale.Divergences, "; "))
+	case scale.Refused > 0:
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("%d filters refused with 0x%02x: %v", scale.Refused, scale.RefusedCode, scale)
+	case scale.Degraded(cfg):
+		result.Status = common.StatusWarning
+		result.Notes = fmt.Sprintf("SUBACKs slowed down as subscriptions grew: %v", scale)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = scale.String()
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,229 @@
+package v5
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/assert"
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// Unsubscribe reason codes the raw tests expect
+const (
+	reasonSuccess               = 0x00
+	reasonNoSubscriptionExisted = 0x11
+)
+
+// UnsubackTests returns tests of the UNSUBACK reason codes and packet
+// identifiers, sent over raw connections so the exact bytes are checked
+// [MQTT-3.11]
+func UnsubackTests() TestGroup {
+	return TestGroup{
+		Name: "UNSUBACK Reason Codes",
+		Tags: []string{"core"},
+		Tests: []TestFunc{
+			testUnsubackSuccess,
+			testUnsubackNoSubscription,
+			testUnsubackCodeOrder,
+			testUnsubackPacketIdentifier,
+		},
+	}
+}
+
+// testUnsubackSuccess tests that unsubscribing from an existing
+// subscription is acknowledged with 0x00 (Success) [MQTT-3.11.3-2]
+// "The Server sending an UNSUBACK packet MUST use one of the Unsubscribe
+// Reason Code values for each Topic Filter received"
+func testUnsubackSuccess(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "UNSUBACK 0x00 for Existing Subscription",
+		SpecRef: "MQTT-3.11.3-2",
+	}
+
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-unsuback-ok"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	topic := cfg.Topic("test/unsuback/ok")
+	timeout := cfg.Scaled(5 * time.Second)
+	if _, err := conn.Subscribe(1, 0, timeout, topic); err != nil {
+		result.Error = fmt.Errorf("subscribe failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	codes, err := conn.Unsubscribe(2, timeout, topic)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	if len(codes) != 1 {
+		result.Error = fmt.Errorf("UNSUBACK has %d reason codes for 1 filter: % x", len(codes), codes)
+	} else if assert.ReasonCode(&result, cfg, "UNSUBACK reason code", codes[0], reasonSuccess) {
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUnsubackNoSubscription tests that unsubscribing from a filter the
+// client never subscribed to is acknowledged with 0x11 (No subscription
+// existed) [MQTT-3.11.3-2]. Brokers that report Success instead get a
+// warning.
+func testUnsubackNoSubscription(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "UNSUBACK 0x11 for Missing Subscription",
+		SpecRef: "MQTT-3.11.3-2",
+	}
+
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-unsuback-none"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	codes, err := conn.Unsubscribe(1, cfg.Scaled(5*time.Second), cfg.Topic("test/unsuback/never"))
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	switch {
+	case len(codes) != 1:
+		result.Error = fmt.Errorf("UNSUBACK has %d reason codes for 1 filter: % x", len(codes), codes)
+	case codes[0] == reasonNoSubscriptionExisted:
+		result.Status = common.StatusPassed
+	case codes[0] == reasonSuccess:
+		result.Status = common.StatusWarning
+		result.Notes = "broker reported 0x00 (Success) rather than 0x11 (No subscription existed)"
+	default:
+		assert.ReasonCode(&result, cfg, "UNSUBACK reason code", codes[0], reasonNoSubscriptionExisted)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUnsubackCodeOrder tests that an UNSUBACK carries one reason code per
+// filter, in the order of the UNSUBSCRIBE [MQTT-3.11.3-1]
+// "The order of Reason Codes in the UNSUBACK packet MUST match the order of
+// Topic Filters in the UNSUBSCRIBE packet"
+func testUnsubackCodeOrder(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "UNSUBACK Reason Codes in Filter Order",
+		SpecRef: "MQTT-3.11.3-1",
+	}
+
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-unsuback-order"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	subscribed := []string{cfg.Topic("test/unsuback/order/a"), cfg.Topic("test/unsuback/order/c")}
+	timeout := cfg.Scaled(5 * time.Second)
+	if _, err := conn.Subscribe(1, 0, timeout, subscribed...); err != nil {
+		result.Error = fmt.Errorf("subscribe failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	// The middle filter was never subscribed to
+	codes, err := conn.Unsubscribe(2, timeout, subscribed[0], cfg.Topic("test/unsuback/order/b"), subscribed[1])
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	switch {
+	case len(codes) != 3:
+		result.Error = fmt.Errorf("UNSUBACK has %d reason codes for 3 filters: % x", len(codes), codes)
+	case codes[0] != reasonSuccess || codes[2] != reasonSuccess:
+		result.Error = fmt.Errorf("UNSUBACK reason codes % x, expected 00 11 00", codes)
+	case codes[1] == reasonNoSubscriptionExisted:
+		result.Status = common.StatusPassed
+	case codes[1] == reasonSuccess:
+		result.Status = common.StatusWarning
+		result.Notes = "broker reported 0x00 (Success) for the filter it held no subscription for, so the order cannot be confirmed"
+	default:
+		result.Error = fmt.Errorf("UNSUBACK reason codes % x, expected 00 11 00", codes)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUnsubackPacketIdentifier tests that each UNSUBACK carries the Packet
+// Identifier of its UNSUBSCRIBE when two are in flight at once
+// [MQTT-3.10.4-5]
+// "The UNSUBACK packet MUST have the same Packet Identifier as the
+// UNSUBSCRIBE packet"
+func testUnsubackPacketIdentifier(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "UNSUBACK Packet Identifier Matches UNSUBSCRIBE",
+		SpecRef: "MQTT-3.10.4-5",
+	}
+
+	conn, err := common.DialRaw(cfg, 5, cfg.ClientID("test-unsuback-pid"))
+	if err != nil {
+		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer conn.Close()
+
+	ids := []uint16{0x1001, 0xBEEF}
+	for i, id := range ids {
+		body := binary.BigEndian.AppendUint16(nil, id)
+		body = append(body, 0x00) // Properties length
+		body = common.AppendString(body, cfg.Topic(fmt.Sprintf("test/unsuback/pid/%d", i)))
+		if err := conn.Send(0xA2, body); err != nil {
+			result.Error = fmt.Errorf("failed to send UNSUBSCRIBE: %w", err)
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	pending := map[uint16]bool{ids[0]: true, ids[1]: true}
+	for range ids {
+		_, unsuback, err := conn.Expect(0xB0, cfg.Scaled(5*time.Second), nil)
+		if err != nil {
+			result.Error = err
+			result.Duration = time.Since(start)
+			return result
+		}
+		if len(unsuback) < 2 {
+			result.Error = fmt.Errorf("UNSUBACK too short: % x", unsuback)
+			result.Duration = time.Since(start)
+			return result
+		}
+		id := binary.BigEndian.Uint16(unsuback)
+		if !pending[id] {
+			result.Error = fmt.Errorf("UNSUBACK for packet identifier %d, expected %d or %d once each", id, ids[0], ids[1])
+			result.Duration = time.Since(start)
+			return result
+		}
+		delete(pending, id)
+	}
+
+	result.Status = common.StatusPassed
+	result.Duration = time.Since(start)
+	return result
+}
@@ -17,6 +17,7 @@ import (
 func UnsubscribeTests() TestGroup {
 	return TestGroup{
 		Name: "UNSUBSCRIBE & UNSUBACK",
+		Tags: []string{"core"},
 		Tests: []TestFunc{
 			testUnsubscribeStopsMessages,
 			testUnsubscribeMultipleTopics,
@@ -29,7 +30,7 @@ func UnsubscribeTests() TestGroup {
 
 // testUnsubscribeStopsMessages tests that unsubscribe stops message delivery [MQTT-3.10.4-6]
 // "The Server MUST stop adding any new messages for delivery to the Client"
-func testUnsubscribeStopsMessages(cfg common.Config) TestResult {
+func testUnsubscribeStopsMessages(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "UNSUBSCRIBE Stops Message Delivery",
@@ -46,7 +47,7 @@ func testUnsubscribeStopsMessages(cfg common.Config) TestResult {
 		return true, nil
 	}
 
-	sub, err := CreateAndConnectClient(cfg, "test-unsub-stops", onPublish)
+	sub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-stops"), onPublish)
 	if err != nil {
 		result.Error = fmt.Errorf("subscriber connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -54,12 +55,10 @@ func testUnsubscribeStopsMessages(cfg common.Config) TestResult {
 	}
 	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe
-	_, err = sub.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/unsub/stop", QoS: 0},
+			{Topic: cfg.Topic("test/unsub/stop"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -68,10 +67,8 @@ func testUnsubscribeStopsMessages(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Create publisher
-	pub, err := CreateAndConnectClient(cfg, "test-unsub-pub", nil)
+	pub, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-pub"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("publisher connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -81,7 +78,7 @@ func testUnsubscribeStopsMessages(cfg common.Config) TestResult {
 
 	// Publish first message
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/unsub/stop",
+		Topic:   cfg.Topic("test/unsub/stop"),
 		QoS:     0,
 		Payload: []byte("message1"),
 	})
@@ -91,7 +88,7 @@ func testUnsubscribeStopsMessages(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	mu.Lock()
 	firstCount := messageCount
@@ -105,7 +102,7 @@ func testUnsubscribeStopsMessages(cfg common.Config) TestResult {
 
 	// Unsubscribe
 	_, err = sub.Unsubscribe(ctx, &paho.Unsubscribe{
-		Topics: []string{"test/unsub/stop"},
+		Topics: []string{cfg.Topic("test/unsub/stop")},
 	})
 	if err != nil {
 		result.Error = fmt.Errorf("unsubscribe failed: %w", err)
@@ -113,11 +110,11 @@ func testUnsubscribeStopsMessages(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	cfg.Wait(100 * time.Millisecond)
 
 	// Publish second message - should NOT be received
 	_, err = pub.Publish(ctx, &paho.Publish{
-		Topic:   "test/unsub/stop",
+		Topic:   cfg.Topic("test/unsub/stop"),
 		QoS:     0,
 		Payload: []byte("message2"),
 	})
@@ -127,7 +124,7 @@ func testUnsubscribeStopsMessages(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(200 * time.Millisecond)
+	cfg.Wait(200 * time.Millisecond)
 
 	mu.Lock()
 	finalCount := messageCount
@@ -135,7 +132,7 @@ func testUnsubscribeStopsMessages(cfg common.Config) TestResult {
 
 	if finalCount == firstCount {
 		// No additional messages received after unsubscribe
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("received %d messages after unsubscribe (expected 0)", finalCount-firstCount)
 	}
@@ -146,14 +143,14 @@ func testUnsubscribeStopsMessages(cfg common.Config) TestResult {
 
 // testUnsubscribeMultipleTopics tests unsubscribing from multiple topics [MQTT-3.10.3-2]
 // "The Topic Filters in an UNSUBSCRIBE packet MUST be UTF-8 Encoded Strings"
-func testUnsubscribeMultipleTopics(cfg common.Config) TestResult {
+func testUnsubscribeMultipleTopics(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "UNSUBSCRIBE Multiple Topics",
 		SpecRef: "MQTT-3.10.3-2",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-unsub-multiple", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-multiple"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -161,14 +158,12 @@ func testUnsubscribeMultipleTopics(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe to multiple topics
-	_, err = client.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, client, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/unsub/multi/1", QoS: 0},
-			{Topic: "test/unsub/multi/2", QoS: 0},
-			{Topic: "test/unsub/multi/3", QoS: 0},
+			{Topic: cfg.Topic("test/unsub/multi/1"), QoS: 0},
+			{Topic: cfg.Topic("test/unsub/multi/2"), QoS: 0},
+			{Topic: cfg.Topic("test/unsub/multi/3"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -177,14 +172,12 @@ func testUnsubscribeMultipleTopics(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Unsubscribe from all three at once
 	_, err = client.Unsubscribe(ctx, &paho.Unsubscribe{
 		Topics: []string{
-			"test/unsub/multi/1",
-			"test/unsub/multi/2",
-			"test/unsub/multi/3",
+			cfg.Topic("test/unsub/multi/1"),
+			cfg.Topic("test/unsub/multi/2"),
+			cfg.Topic("test/unsub/multi/3"),
 		},
 	})
 	if err != nil {
@@ -193,21 +186,21 @@ func testUnsubscribeMultipleTopics(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testUnsubackReasonCodes tests UNSUBACK reason codes [MQTT-3.11.2-1]
 // "The Server sends an UNSUBACK packet to the Client to confirm receipt of an UNSUBSCRIBE packet"
-func testUnsubackReasonCodes(cfg common.Config) TestResult {
+func testUnsubackReasonCodes(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "UNSUBACK Reason Codes",
 		SpecRef: "MQTT-3.11.2-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-unsuback-codes", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsuback-codes"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -215,12 +208,10 @@ func testUnsubackReasonCodes(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe first
-	_, err = client.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, client, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/unsuback/reason", QoS: 0},
+			{Topic: cfg.Topic("test/unsuback/reason"), QoS: 0},
 		},
 	})
 	if err != nil {
@@ -229,11 +220,9 @@ func testUnsubackReasonCodes(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Unsubscribe - should get UNSUBACK with success (0x00)
 	unsuback, err := client.Unsubscribe(ctx, &paho.Unsubscribe{
-		Topics: []string{"test/unsuback/reason"},
+		Topics: []string{cfg.Topic("test/unsuback/reason")},
 	})
 	if err != nil {
 		result.Error = fmt.Errorf("unsubscribe failed: %w", err)
@@ -243,7 +232,7 @@ func testUnsubackReasonCodes(cfg common.Config) TestResult {
 
 	// Check that we got an UNSUBACK
 	if unsuback != nil && len(unsuback.Reasons) > 0 {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("did not receive UNSUBACK")
 	}
@@ -256,14 +245,14 @@ func testUnsubackReasonCodes(cfg common.Config) TestResult {
 // "If the Server receives an UNSUBSCRIBE packet that contains a Topic Filter that does
 // not match any of the Client's existing Subscriptions, the Server MUST respond with
 // an UNSUBACK containing a Reason Code of 0x11 (No subscription existed)"
-func testUnsubscribeNonExistent(cfg common.Config) TestResult {
+func testUnsubscribeNonExistent(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "UNSUBSCRIBE Non-Existent Subscription",
 		SpecRef: "MQTT-3.11.3-2",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-unsub-nonexist", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-nonexist"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -271,22 +260,20 @@ func testUnsubscribeNonExistent(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Unsubscribe from topic we never subscribed to
 	unsuback, err := client.Unsubscribe(ctx, &paho.Unsubscribe{
-		Topics: []string{"test/unsub/never/subscribed"},
+		Topics: []string{cfg.Topic("test/unsub/never/subscribed")},
 	})
 
 	// Some brokers may return error, some may return UNSUBACK with reason code
 	// Both are acceptable per spec
 	if err != nil {
 		// Error is acceptable
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else if unsuback != nil && len(unsuback.Reasons) > 0 {
 		// Check for "No subscription existed" reason code (0x11)
 		if unsuback.Reasons[0] == 0x11 || unsuback.Reasons[0] == 0x00 {
-			result.Passed = true
+			result.Status = common.StatusPassed
 		} else {
 			result.Error = fmt.Errorf("unexpected reason code: 0x%02X", unsuback.Reasons[0])
 		}
@@ -301,14 +288,14 @@ func testUnsubscribeNonExistent(cfg common.Config) TestResult {
 // testUnsubscribePacketIdentifier tests packet identifier in UNSUBSCRIBE [MQTT-3.10.2-1]
 // "The Packet Identifier field is used to identify the UNSUBSCRIBE
 // packet and its associated UNSUBACK"
-func testUnsubscribePacketIdentifier(cfg common.Config) TestResult {
+func testUnsubscribePacketIdentifier(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "UNSUBSCRIBE Packet Identifier Matching",
 		SpecRef: "MQTT-3.10.2-1",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-unsub-packetid", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-unsub-packetid"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -316,12 +303,10 @@ func testUnsubscribePacketIdentifier(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Subscribe first
-	_, err = client.Subscribe(ctx, &paho.Subscribe{
+	_, err = SubscribeSync(ctx, cfg, client, &paho.Subscribe{
 		Subscriptions: []paho.SubscribeOptions{
-			{Topic: "test/unsub/packetid", QoS: 1},
+			{Topic: cfg.Topic("test/unsub/packetid"), QoS: 1},
 		},
 	})
 	if err != nil {
@@ -330,11 +315,9 @@ func testUnsubscribePacketIdentifier(cfg common.Config) TestResult {
 		return result
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
 	// Unsubscribe - paho library handles packet ID automatically
 	unsuback, err := client.Unsubscribe(ctx, &paho.Unsubscribe{
-		Topics: []string{"test/unsub/packetid"},
+		Topics: []string{cfg.Topic("test/unsub/packetid")},
 	})
 	if err != nil {
 		result.Error = fmt.Errorf("unsubscribe failed: %w", err)
@@ -344,7 +327,7 @@ func testUnsubscribePacketIdentifier(cfg common.Config) TestResult {
 
 	// If we got UNSUBACK, packet IDs matched
 	if unsuback != nil {
-		result.Passed = true
+		result.Status = common.StatusPassed
 	} else {
 		result.Error = fmt.Errorf("no UNSUBACK received")
 	}
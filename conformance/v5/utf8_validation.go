@@ -7,8 +7,7 @@ import (
 import (
 	"context"
 	"fmt"
-	"net"
-	"net/url"
+	"strings"
 	"time"
 
 	"github.com/eclipse/paho.golang/paho"
@@ -18,6 +17,7 @@ import (
 func UTF8ValidationTests() TestGroup {
 	return TestGroup{
 		Name: "UTF-8 String Validation",
+		Tags: []string{"packet-format"},
 		Tests: []TestFunc{
 			testUTF8WellFormed,
 			testUTF8NoNull,
@@ -25,13 +25,36 @@ func UTF8ValidationTests() TestGroup {
 			testUTF8ValidClientID,
 			testUTF8ValidTopicName,
 			testUTF8InvalidSequence,
+			testUTF8BOMPreserved,
+			testUTF8Noncharacters,
+			testUTF8ControlCharacters,
 		},
 	}
 }
 
+// expectClientIDRefused sends a CONNECT with an invalid clientID and fills
+// in result. The broker must refuse it with a CONNACK reason code of 0x80 or
+// above or by closing the connection; what describes the Client Identifier in
+// the error otherwise.
+func expectClientIDRefused(cfg common.Config, clientID, what string, result *TestResult) {
+	s, err := dialRawSession(cfg)
+	if err != nil {
+		result.Error = err
+		return
+	}
+	defer s.Close()
+
+	s.Send(common.RawConnect(5, clientID, cfg.Username, cfg.Password))
+	if err := s.ExpectConnectRefused(); err != nil {
+		result.Error = fmt.Errorf("broker accepted %s: %w", what, err)
+		return
+	}
+	result.Status = common.StatusPassed
+}
+
 // testUTF8WellFormed tests that UTF-8 strings must be well-formed [MQTT-1.5.4-1]
 // "The character data in a UTF-8 Encoded String MUST be well-formed UTF-8"
-func testUTF8WellFormed(cfg common.Config) TestResult {
+func testUTF8WellFormed(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "UTF-8 Strings Must Be Well-Formed",
@@ -39,7 +62,7 @@ func testUTF8WellFormed(cfg common.Config) TestResult {
 	}
 
 	// Test with valid UTF-8 characters including multi-byte sequences
-	client, err := CreateAndConnectClient(cfg, "test-utf8-valid-\u4E2D\u6587", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-utf8-valid-\u4E2D\u6587"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect with valid UTF-8 failed: %w", err)
 		result.Duration = time.Since(start)
@@ -47,11 +70,9 @@ func testUTF8WellFormed(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Publish with valid UTF-8 in topic (Chinese characters)
 	_, err = client.Publish(ctx, &paho.Publish{
-		Topic:   "test/\u4E2D\u6587/topic",
+		Topic:   cfg.Topic("test/\u4E2D\u6587/topic"),
 		QoS:     0,
 		Payload: []byte("valid UTF-8"),
 	})
@@ -62,84 +83,22 @@ func testUTF8WellFormed(cfg common.Config) TestResult {
 		return result
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testUTF8NoNull tests that null character is not allowed [MQTT-1.5.4-2]
 // "A UTF-8 Encoded String MUST NOT include an encoding of the null character U+0000"
-func testUTF8NoNull(cfg common.Config) TestResult {
+func testUTF8NoNull(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "UTF-8 Strings Must Not Contain Null (U+0000)",
 		SpecRef: "MQTT-1.5.4-2",
 	}
 
-	u, err := url.Parse(cfg.Broker)
-	if err != nil {
-		result.Error = fmt.Errorf("invalid broker URL: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
-
-	host := u.Host
-	if u.Port() == "" {
-		host = net.JoinHostPort(u.Hostname(), "1883")
-	}
-
-	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to dial broker: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
-	defer conn.Close()
-
-	// Send CONNECT with null character in client ID
-	connectWithNull := []byte{
-		0x10,       // CONNECT
-		0x11,       // Remaining length 17
-		0x00, 0x04, // Protocol name length
-		'M', 'Q', 'T', 'T',
-		0x05,       // Protocol level 5
-		0x02,       // Clean start
-		0x00, 0x3C, // Keep alive 60
-		0x00,       // Properties length
-		0x00, 0x05, // Client ID length (5)
-		't', 'e', 0x00, 's', 't', // Client ID with null
-	}
-
-	conn.SetDeadline(time.Now().Add(5 * time.Second))
-	_, err = conn.Write(connectWithNull)
-	if err != nil {
-		result.Passed = true
-		result.Error = nil
-		result.Duration = time.Since(start)
-		return result
-	}
-
-	// Read response - should be error CONNACK or disconnect
-	response := make([]byte, 256)
-	n, err := conn.Read(response)
-
-	if err != nil || n == 0 {
-		// Connection closed - broker rejected
-		result.Passed = true
-		result.Error = nil
-	} else if n > 0 && response[0] == 0x20 {
-		// CONNACK - check reason code
-		if n >= 4 && response[3] != 0x00 {
-			result.Passed = true
-			result.Error = nil
-		} else {
-			result.Passed = false
-			result.Error = fmt.Errorf("broker accepted null character in client ID")
-		}
-	} else {
-		result.Passed = false
-		result.Error = fmt.Errorf("unexpected broker response to null character")
-	}
+	// CONNECT with a null character in the client ID
+	expectClientIDRefused(cfg, cfg.ClientID("te\x00st"), "null character in client ID", &result)
 
 	result.Duration = time.Since(start)
 	return result
@@ -147,83 +106,23 @@ func testUTF8NoNull(cfg common.Config) TestResult {
 
 // testUTF8NoSurrogates tests that UTF-16 surrogates are not allowed [MQTT-1.5.4-3]
 // "A UTF-8 Encoded String MUST NOT include encodings of code points between U+D800 and U+DFFF"
-func testUTF8NoSurrogates(cfg common.Config) TestResult {
+func testUTF8NoSurrogates(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "UTF-8 Must Not Contain Surrogates (U+D800 to U+DFFF)",
 		SpecRef: "MQTT-1.5.4-3",
 	}
 
-	u, err := url.Parse(cfg.Broker)
-	if err != nil {
-		result.Error = fmt.Errorf("invalid broker URL: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
-
-	host := u.Host
-	if u.Port() == "" {
-		host = net.JoinHostPort(u.Hostname(), "1883")
-	}
-
-	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to dial broker: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
-	defer conn.Close()
-
-	// Send CONNECT with UTF-16 surrogate in client ID
-	// UTF-16 surrogate U+D800 encoded as 0xED 0xA0 0x80 (invalid UTF-8)
-	connectWithSurrogate := []byte{
-		0x10,       // CONNECT
-		0x11,       // Remaining length
-		0x00, 0x04, // Protocol name length
-		'M', 'Q', 'T', 'T',
-		0x05,       // Protocol level 5
-		0x02,       // Clean start
-		0x00, 0x3C, // Keep alive 60
-		0x00,       // Properties length
-		0x00, 0x05, // Client ID length
-		't', 0xED, 0xA0, 0x80, 't', // Client ID with surrogate
-	}
-
-	conn.SetDeadline(time.Now().Add(5 * time.Second))
-	_, err = conn.Write(connectWithSurrogate)
-	if err != nil {
-		result.Passed = true
-		result.Error = nil
-		result.Duration = time.Since(start)
-		return result
-	}
-
-	// Read response
-	response := make([]byte, 256)
-	n, err := conn.Read(response)
-
-	if err != nil || n == 0 {
-		result.Passed = true
-		result.Error = nil
-	} else if n > 0 && response[0] == 0x20 {
-		if n >= 4 && response[3] != 0x00 {
-			result.Passed = true
-			result.Error = nil
-		} else {
-			result.Passed = false
-			result.Error = fmt.Errorf("broker accepted UTF-16 surrogate in client ID")
-		}
-	} else {
-		result.Passed = false
-		result.Error = fmt.Errorf("unexpected broker response to surrogate")
-	}
+	// CONNECT with the UTF-16 surrogate U+D800, encoded as 0xED 0xA0 0x80
+	// (invalid UTF-8), in the client ID
+	expectClientIDRefused(cfg, cfg.ClientID("t\xed\xa0\x80t"), "UTF-16 surrogate in client ID", &result)
 
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testUTF8ValidClientID tests that client IDs must be valid UTF-8 [MQTT-3.1.3-4]
-func testUTF8ValidClientID(cfg common.Config) TestResult {
+func testUTF8ValidClientID(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Client ID Must Be Valid UTF-8",
@@ -247,23 +146,23 @@ func testUTF8ValidClientID(cfg common.Config) TestResult {
 			return result
 		}
 		client.Disconnect(&paho.Disconnect{ReasonCode: 0})
-		time.Sleep(100 * time.Millisecond)
+		cfg.Wait(100 * time.Millisecond)
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testUTF8ValidTopicName tests that topic names must be valid UTF-8 [MQTT-4.7.3-3]
-func testUTF8ValidTopicName(cfg common.Config) TestResult {
+func testUTF8ValidTopicName(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Topic Names Must Be Valid UTF-8",
 		SpecRef: "MQTT-4.7.3-3",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-utf8-topics", nil)
+	client, err := CreateAndConnectClient(cfg, cfg.ClientID("test-utf8-topics"), nil)
 	if err != nil {
 		result.Error = fmt.Errorf("connect failed: %w", err)
 		result.Duration = time.Since(start)
@@ -271,15 +170,13 @@ func testUTF8ValidTopicName(cfg common.Config) TestResult {
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	ctx := context.Background()
-
 	// Test various valid UTF-8 topic names
 	testTopics := []string{
-		"test/simple/topic",
-		"test/\u00E9\u00E0\u00FC/topic",       // Latin with accents
-		"test/\U0001F600/topic",               // Emoji
-		"test/\u4E2D\u6587/topic",             // Chinese
-		"test/\u0420\u0443\u0441\u0441/topic", // Russian
+		cfg.Topic("test/simple/topic"),
+		cfg.Topic("test/\u00E9\u00E0\u00FC/topic"),       // Latin with accents
+		cfg.Topic("test/\U0001F600/topic"),               // Emoji
+		cfg.Topic("test/\u4E2D\u6587/topic"),             // Chinese
+		cfg.Topic("test/\u0420\u0443\u0441\u0441/topic"), // Russian
 	}
 
 	for _, topic := range testTopics {
@@ -295,82 +192,78 @@ func testUTF8ValidTopicName(cfg common.Config) TestResult {
 		}
 	}
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
 
 // testUTF8InvalidSequence tests that invalid UTF-8 sequences are rejected
-func testUTF8InvalidSequence(cfg common.Config) TestResult {
+func testUTF8InvalidSequence(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Reject Invalid UTF-8 Sequences",
 		SpecRef: "MQTT-1.5.4-1",
 	}
 
-	u, err := url.Parse(cfg.Broker)
-	if err != nil {
-		result.Error = fmt.Errorf("invalid broker URL: %w", err)
-		result.Duration = time.Since(start)
-		return result
-	}
+	// CONNECT with orphan continuation bytes (invalid UTF-8) in the client ID
+	expectClientIDRefused(cfg, cfg.ClientID("t\x80\x81st"), "invalid UTF-8 sequence", &result)
 
-	host := u.Host
-	if u.Port() == "" {
-		host = net.JoinHostPort(u.Hostname(), "1883")
-	}
+	result.Duration = time.Since(start)
+	return result
+}
 
-	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to dial broker: %w", err)
-		result.Duration = time.Since(start)
-		return result
+// testUTF8BOMPreserved tests that U+FEFF in a topic is delivered as sent
+// [MQTT-1.5.4-3]
+// "A UTF-8 encoded sequence 0xEF 0xBB 0xBF is always interpreted as U+FEFF
+// ("ZERO WIDTH NO-BREAK SPACE") wherever it appears in a string and MUST NOT
+// be skipped over or stripped off by a packet receiver"
+func testUTF8BOMPreserved(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "U+FEFF Preserved in Topic Names",
+		SpecRef: "MQTT-1.5.4-3",
 	}
-	defer conn.Close()
-
-	// Send CONNECT with invalid UTF-8 sequence (continuation byte without start)
-	connectInvalid := []byte{
-		0x10,       // CONNECT
-		0x11,       // Remaining length
-		0x00, 0x04, // Protocol name length
-		'M', 'Q', 'T', 'T',
-		0x05,       // Protocol level 5
-		0x02,       // Clean start
-		0x00, 0x3C, // Keep alive 60
-		0x00,       // Properties length
-		0x00, 0x05, // Client ID length
-		't', 0x80, 0x81, 's', 't', // Invalid UTF-8: orphan continuation bytes
+
+	topic := cfg.Topic("test/utf8/\uFEFFbom\uFEFF")
+	if refusals := checkBoundaryTopic(cfg, "test-utf8-bom", topic, &result); len(refusals) > 0 {
+		result.Status = common.StatusWarning
+		result.Notes = "broker refused a topic containing U+FEFF, a character it must pass on: " + strings.Join(refusals, ", ")
 	}
 
-	conn.SetDeadline(time.Now().Add(5 * time.Second))
-	_, err = conn.Write(connectInvalid)
-	if err != nil {
-		result.Passed = true
-		result.Error = nil
-		result.Duration = time.Since(start)
-		return result
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUTF8Noncharacters tests a topic containing the noncharacters U+FFFE
+// and U+FFFF, which clients SHOULD NOT send and the broker MAY treat as
+// malformed. It must either pass them on intact or refuse them cleanly
+// [MQTT-1.5.4].
+func testUTF8Noncharacters(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Noncharacters U+FFFE/U+FFFF in Topic Names",
+		SpecRef: "MQTT-1.5.4",
 	}
 
-	// Read response
-	response := make([]byte, 256)
-	n, err := conn.Read(response)
-
-	if err != nil || n == 0 {
-		result.Passed = true
-		result.Error = nil
-	} else if n > 0 && response[0] == 0x20 {
-		if n >= 4 && response[3] != 0x00 {
-			result.Passed = true
-			result.Error = nil
-		} else {
-			result.Passed = false
-			result.Error = fmt.Errorf("broker accepted invalid UTF-8 sequence")
-		}
-	} else {
-		result.Passed = false
-		result.Error = fmt.Errorf("unexpected broker response to invalid UTF-8")
+	checkBoundaryTopic(cfg, "test-utf8-nonchar", cfg.Topic("test/utf8/non\uFFFEchar\uFFFF"), &result)
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testUTF8ControlCharacters tests a topic containing the control characters
+// U+0001..U+001F and U+007F, which clients SHOULD NOT send and the broker
+// MAY treat as malformed. It must either pass them on intact or refuse them
+// cleanly [MQTT-1.5.4].
+func testUTF8ControlCharacters(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Control Characters in Topic Names",
+		SpecRef: "MQTT-1.5.4",
 	}
 
+	checkBoundaryTopic(cfg, "test-utf8-control", cfg.Topic("test/utf8/ctl\u0001\u0009\u001F\u007F"), &result)
+
 	result.Duration = time.Since(start)
 	return result
 }
@@ -5,98 +5,393 @@ import (
 )
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/eclipse/paho.golang/paho"
 )
 
-// WillTests returns all Will Message conformance tests
+// WillTests returns all Will Message conformance tests. They run in a topic
+// namespace of their own, whose retained messages, left by wills published
+// with Will Retain, are cleared once the group is done.
 func WillTests() TestGroup {
 	return TestGroup{
-		Name: "Will Message",
+		Name:     "Will Message",
+		Tags:     []string{"session", "will"},
+		Setup:    willSetup,
+		Teardown: willTeardown,
 		Tests: []TestFunc{
 			testWillMessage,
+			testWillNotSentOnNormalDisconnect,
+			testWillSentOnDisconnectWithWill,
 			testWillDelayInterval,
+			testWillDelayCancelledByReconnect,
 			testWillQoS,
 			testWillRetain,
+			testWillNotRetained,
+			testWillProperties,
 		},
 	}
 }
 
-// testWillMessage tests basic Will Message functionality [MQTT-3.1.2-9]
-// "If the Will Flag is set to 1, the Will Properties, Will Topic, and Will
-// Payload fields MUST be present in the Payload"
-func testWillMessage(cfg common.Config) TestResult {
+// willSubscriber connects a client subscribed to topic at QoS 2 and passes
+// on the PUBLISH packets it receives
+func willSubscriber(ctx context.Context, cfg common.Config, clientID, topic string, retainAsPublished bool) (*paho.Client, <-chan *paho.Publish, error) {
+	received := make(chan *paho.Publish, 10)
+	sub, err := CreateAndConnectClient(cfg, clientID, func(pr paho.PublishReceived) (bool, error) {
+		select {
+		case received <- pr.Packet:
+		default:
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("subscriber connect failed: %w", err)
+	}
+
+	_, err = SubscribeSync(ctx, cfg, sub, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{
+			{Topic: topic, QoS: 2, RetainAsPublished: retainAsPublished},
+		},
+	})
+	if err != nil {
+		sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+		return nil, nil, fmt.Errorf("subscribe failed: %w", err)
+	}
+	return sub, received, nil
+}
+
+// sever closes conn without DISCONNECT; a zero linger makes the kernel send
+// RST instead of a graceful FIN
+func sever(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// awaitWill returns the next message on received, nil if none arrives
+// within wait
+func awaitWill(received <-chan *paho.Publish, wait time.Duration) *paho.Publish {
+	select {
+	case p := <-received:
+		return p
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// willSetup moves the group into a topic namespace of its own
+func willSetup(cfg *common.Config) error {
+	cfg.TopicNamespace = cfg.Topic("will")
+	return nil
+}
+
+// willTeardown clears the retained messages the group's wills left in its
+// namespace
+func willTeardown(cfg common.Config) error {
+	res, err := Cleanup(cfg, nil)
+	if err != nil {
+		return err
+	}
+	return errors.Join(res.Errors...)
+}
+
+// testWillMessage tests that the Will Message is published when the
+// connection is closed without DISCONNECT [MQTT-3.1.2-8]
+// "The Will Message MUST be published after the Network Connection is
+// subsequently closed and either the Will Delay Interval has elapsed or the
+// Session ends"
+func testWillMessage(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Will Message Delivery",
-		SpecRef: "MQTT-3.1.2-9",
+		SpecRef: "MQTT-3.1.2-8",
 	}
 
-	// Testing Will Messages requires:
-	// 1. Client A subscribes to will topic
-	// 2. Client B connects with a will message set
-	// 3. Client B disconnects abnormally (network failure)
-	// 4. Client A should receive the will message
+	topic := cfg.Topic("test/will/delivery")
+	sub, received, err := willSubscriber(ctx, cfg, cfg.ClientID("test-will-sub"), topic, false)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	// This is difficult to test reliably without simulating network failures
-	// For now, verify that we can connect (will is set at connect time)
-	client, err := CreateAndConnectClient(cfg, "test-will", nil)
+	_, conn, err := CreateAndConnectClientWithWill(cfg, cfg.ClientID("test-will"), &paho.WillMessage{
+		Topic:   topic,
+		QoS:     0,
+		Payload: []byte("will message"),
+	}, nil, 0)
 	if err != nil {
-		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Error = fmt.Errorf("client with will connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
-	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	result.Passed = true
+	sever(conn)
+
+	switch p := awaitWill(received, cfg.Scaled(2*time.Second)); {
+	case p == nil:
+		result.Error = fmt.Errorf("will message not received after the connection was severed")
+	case string(p.Payload) != "will message":
+		result.Error = fmt.Errorf("will message payload %q, expected %q", p.Payload, "will message")
+	default:
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testWillNotSentOnNormalDisconnect tests that DISCONNECT with 0x00 discards
+// the Will Message [MQTT-3.1.2-10]
+// "The Will Message MUST be removed from the stored Session State in the
+// Server once it has been published or the Server has received a DISCONNECT
+// packet with a Reason Code of 0x00 (Normal disconnection) from the Client"
+func testWillNotSentOnNormalDisconnect(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Will Message Not Sent on DISCONNECT 0x00",
+		SpecRef: "MQTT-3.1.2-10",
+	}
+
+	topic := cfg.Topic("test/will/normal")
+	sub, received, err := willSubscriber(ctx, cfg, cfg.ClientID("test-will-normal-sub"), topic, false)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	client, _, err := CreateAndConnectClientWithWill(cfg, cfg.ClientID("test-will-normal"), &paho.WillMessage{
+		Topic:   topic,
+		QoS:     0,
+		Payload: []byte("will message"),
+	}, nil, 0)
+	if err != nil {
+		result.Error = fmt.Errorf("client with will connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	if p := awaitWill(received, cfg.Scaled(time.Second)); p != nil {
+		result.Error = fmt.Errorf("will message published after DISCONNECT 0x00")
+	} else {
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testWillSentOnDisconnectWithWill tests that DISCONNECT with 0x04
+// (Disconnect with Will Message) publishes the Will Message [MQTT-3.14.2.1]
+// "The Client wishes to disconnect but requires that the Server also
+// publishes its Will Message"
+func testWillSentOnDisconnectWithWill(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Will Message Sent on DISCONNECT 0x04",
+		SpecRef: "MQTT-3.14.2.1",
+	}
+
+	topic := cfg.Topic("test/will/disconnect-with-will")
+	sub, received, err := willSubscriber(ctx, cfg, cfg.ClientID("test-will-0x04-sub"), topic, false)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	client, _, err := CreateAndConnectClientWithWill(cfg, cfg.ClientID("test-will-0x04"), &paho.WillMessage{
+		Topic:   topic,
+		QoS:     0,
+		Payload: []byte("requested will"),
+	}, nil, 0)
+	if err != nil {
+		result.Error = fmt.Errorf("client with will connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	client.Disconnect(&paho.Disconnect{ReasonCode: 0x04})
+
+	switch p := awaitWill(received, cfg.Scaled(2*time.Second)); {
+	case p == nil:
+		result.Error = fmt.Errorf("will message not published after DISCONNECT 0x04 (Disconnect with Will Message)")
+	case string(p.Payload) != "requested will":
+		result.Error = fmt.Errorf("will message payload %q, expected %q", p.Payload, "requested will")
+	default:
+		result.Status = common.StatusPassed
+	}
+
 	result.Duration = time.Since(start)
 	return result
 }
 
-// testWillDelayInterval tests Will Delay Interval [MQTT-3.1.3-9]
+// testWillDelayInterval tests that the Will Message is held back until the
+// Will Delay Interval has passed [MQTT-3.1.2-8]
 // "The Server delays publishing the Client's Will Message until the Will Delay
-// Interval has passed or the Session ends"
-func testWillDelayInterval(cfg common.Config) TestResult {
+// Interval has passed or the Session ends, whichever happens first"
+func testWillDelayInterval(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Will Delay Interval",
+		SpecRef: "MQTT-3.1.2-8",
+	}
+
+	topic := cfg.Topic("test/will/delay")
+	sub, received, err := willSubscriber(ctx, cfg, cfg.ClientID("test-will-delay-sub"), topic, false)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	// The session outlives the delay, so only the delay holds the will back
+	delay := uint32(2)
+	_, conn, err := CreateAndConnectClientWithWill(cfg, cfg.ClientID("test-will-delay"), &paho.WillMessage{
+		Topic:   topic,
+		QoS:     0,
+		Payload: []byte("delayed will"),
+	}, &paho.WillProperties{WillDelayInterval: &delay}, 10)
+	if err != nil {
+		result.Error = fmt.Errorf("client with will connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	sever(conn)
+	severed := time.Now()
+
+	p := awaitWill(received, time.Duration(delay)*time.Second+cfg.Scaled(2*time.Second))
+	switch elapsed := time.Since(severed); {
+	case p == nil:
+		result.Error = fmt.Errorf("will message not received %.1fs after the connection was severed", elapsed.Seconds())
+	case elapsed < time.Duration(delay)*time.Second-500*time.Millisecond:
+		result.Error = fmt.Errorf("will message published %.1fs after the connection was severed, before the %ds Will Delay Interval", elapsed.Seconds(), delay)
+	default:
+		result.Status = common.StatusPassed
+		result.Notes = fmt.Sprintf("will published %.1fs after the connection was severed", elapsed.Seconds())
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testWillDelayCancelledByReconnect tests that reconnecting to the session
+// within the Will Delay Interval stops the Will Message [MQTT-3.1.3-9]
+// "If a new Network Connection to this Session is made before the Will Delay
+// Interval has passed, the Server MUST NOT send the Will Message"
+func testWillDelayCancelledByReconnect(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Will Delay Cancelled by Reconnect",
 		SpecRef: "MQTT-3.1.3-9",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-will-delay", nil)
+	topic := cfg.Topic("test/will/reconnect")
+	sub, received, err := willSubscriber(ctx, cfg, cfg.ClientID("test-will-reconnect-sub"), topic, false)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	clientID := cfg.ClientID("test-will-reconnect")
+	delay := uint32(3)
+	_, conn, err := CreateAndConnectClientWithWill(cfg, clientID, &paho.WillMessage{
+		Topic:   topic,
+		QoS:     0,
+		Payload: []byte("cancelled will"),
+	}, &paho.WillProperties{WillDelayInterval: &delay}, 30)
+	if err != nil {
+		result.Error = fmt.Errorf("client with will connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	sever(conn)
+	cfg.Wait(200 * time.Millisecond)
+
+	client, err := CreateAndConnectClientWithSession(cfg, clientID, false, nil)
 	if err != nil {
-		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Error = fmt.Errorf("reconnect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
 	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	result.Passed = true
+	if p := awaitWill(received, time.Duration(delay)*time.Second+cfg.Scaled(time.Second)); p != nil {
+		result.Error = fmt.Errorf("will message published although the session was resumed within the Will Delay Interval")
+	} else {
+		result.Status = common.StatusPassed
+	}
+
 	result.Duration = time.Since(start)
 	return result
 }
 
-// testWillQoS tests Will Message QoS levels [MQTT-3.1.2-12]
+// testWillQoS tests that the Will Message is published at its Will QoS
+// [MQTT-3.1.2-12]
 // "If the Will Flag is set to 1, the value of Will QoS can be 0 (0x00),
 // 1 (0x01), or 2 (0x02)"
-func testWillQoS(cfg common.Config) TestResult {
+func testWillQoS(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Will Message QoS",
 		SpecRef: "MQTT-3.1.2-12",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-will-qos", nil)
-	if err != nil {
-		result.Error = fmt.Errorf("connect failed: %w", err)
-		result.Duration = time.Since(start)
-		return result
+	// The subscription is at QoS 2, so the will keeps its own QoS
+	for qos := byte(0); qos <= cfg.Capabilities.QoS(2); qos++ {
+		topic := cfg.Topic(fmt.Sprintf("test/will/qos%d", qos))
+		sub, received, err := willSubscriber(ctx, cfg, cfg.ClientID(fmt.Sprintf("test-will-qos%d-sub", qos)), topic, false)
+		if err != nil {
+			result.Error = err
+			result.Duration = time.Since(start)
+			return result
+		}
+		defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+		_, conn, err := CreateAndConnectClientWithWill(cfg, cfg.ClientID(fmt.Sprintf("test-will-qos%d", qos)), &paho.WillMessage{
+			Topic:   topic,
+			QoS:     qos,
+			Payload: []byte(fmt.Sprintf("QoS %d will", qos)),
+		}, nil, 0)
+		if err != nil {
+			result.Error = fmt.Errorf("client with QoS %d will connect failed: %w", qos, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+
+		sever(conn)
+
+		p := awaitWill(received, cfg.Scaled(2*time.Second))
+		switch {
+		case p == nil:
+			result.Error = fmt.Errorf("QoS %d will message not received", qos)
+		case p.QoS != qos:
+			result.Error = fmt.Errorf("QoS %d will message delivered at QoS %d to a QoS 2 subscription", qos, p.QoS)
+		}
+		if result.Error != nil {
+			result.Duration = time.Since(start)
+			return result
+		}
 	}
-	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	result.Passed = true
+	result.Status = common.StatusPassed
 	result.Duration = time.Since(start)
 	return result
 }
@@ -104,22 +399,239 @@ func testWillQoS(cfg common.Config) TestResult {
 // testWillRetain tests Will Message retain flag [MQTT-3.1.2-15]
 // "If the Will Flag is set to 1 and Will Retain is set to 1, the Server MUST
 // publish the Will Message as a retained message"
-func testWillRetain(cfg common.Config) TestResult {
+func testWillRetain(ctx context.Context, cfg common.Config) TestResult {
 	start := time.Now()
 	result := TestResult{
 		Name:    "Will Message Retain",
 		SpecRef: "MQTT-3.1.2-15",
 	}
 
-	client, err := CreateAndConnectClient(cfg, "test-will-retain", nil)
+	if common.SkipUnsupported(cfg, &result, common.FeatureRetain) {
+		return result
+	}
+
+	topic := cfg.Topic("test/will/retain")
+
+	// Retain As Published shows the RETAIN flag of the will as published
+	sub, received, err := willSubscriber(ctx, cfg, cfg.ClientID("test-will-retain-sub"), topic, true)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	_, conn, err := CreateAndConnectClientWithWill(cfg, cfg.ClientID("test-will-retain"), &paho.WillMessage{
+		Topic:   topic,
+		QoS:     0,
+		Retain:  true,
+		Payload: []byte("retained will"),
+	}, nil, 0)
 	if err != nil {
-		result.Error = fmt.Errorf("connect failed: %w", err)
+		result.Error = fmt.Errorf("client with will connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	sever(conn)
+
+	switch p := awaitWill(received, cfg.Scaled(2*time.Second)); {
+	case p == nil:
+		result.Error = fmt.Errorf("will message not received")
+	case !p.Retain:
+		result.Error = fmt.Errorf("will message published with RETAIN 0 to a Retain As Published subscription")
+	}
+	if result.Error != nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// A new subscriber is sent the will from the retained store
+	late, lateReceived, err := willSubscriber(ctx, cfg, cfg.ClientID("test-will-retain-late"), topic, false)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer late.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	switch p := awaitWill(lateReceived, cfg.Scaled(time.Second)); {
+	case p == nil:
+		result.Error = fmt.Errorf("will message not retained for a new subscriber")
+	case string(p.Payload) != "retained will":
+		result.Error = fmt.Errorf("new subscriber received %q, expected the retained will", p.Payload)
+	default:
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// testWillNotRetained tests that a will with Will Retain 0 is not kept for
+// later subscribers [MQTT-3.1.2-14]
+// "If the Will Flag is set to 1 and Will Retain is set to 0, the Server MUST
+// publish the Will Message as a non-retained message"
+func testWillNotRetained(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Will Message Not Retained",
+		SpecRef: "MQTT-3.1.2-14",
+	}
+
+	topic := cfg.Topic("test/will/not-retained")
+
+	sub, received, err := willSubscriber(ctx, cfg, cfg.ClientID("test-will-noretain-sub"), topic, true)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	_, conn, err := CreateAndConnectClientWithWill(cfg, cfg.ClientID("test-will-noretain"), &paho.WillMessage{
+		Topic:   topic,
+		QoS:     0,
+		Payload: []byte("non-retained will"),
+	}, nil, 0)
+	if err != nil {
+		result.Error = fmt.Errorf("client with will connect failed: %w", err)
 		result.Duration = time.Since(start)
 		return result
 	}
-	defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
 
-	result.Passed = true
+	sever(conn)
+
+	switch p := awaitWill(received, cfg.Scaled(2*time.Second)); {
+	case p == nil:
+		result.Error = fmt.Errorf("will message not received")
+	case p.Retain:
+		result.Error = fmt.Errorf("will message published with RETAIN 1 although Will Retain is 0")
+	}
+	if result.Error != nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	late, lateReceived, err := willSubscriber(ctx, cfg, cfg.ClientID("test-will-noretain-late"), topic, false)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer late.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	if p := awaitWill(lateReceived, cfg.Scaled(time.Second)); p != nil {
+		result.Error = fmt.Errorf("will message with Will Retain 0 sent to a new subscriber as retained")
+	} else {
+		result.Status = common.StatusPassed
+	}
+
 	result.Duration = time.Since(start)
 	return result
 }
+
+// testWillProperties tests that the Will Properties are published with the
+// Will Message, keeping the order of User Properties [MQTT-3.1.3-10]
+// "The Server MUST maintain the order of User Properties when publishing the
+// Will Message"
+func testWillProperties(ctx context.Context, cfg common.Config) TestResult {
+	start := time.Now()
+	result := TestResult{
+		Name:    "Will Properties Delivered Intact",
+		SpecRef: "MQTT-3.1.3-10",
+	}
+
+	topic := cfg.Topic("test/will/properties")
+	sub, received, err := willSubscriber(ctx, cfg, cfg.ClientID("test-will-props-sub"), topic, false)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	defer sub.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	payloadFormat := byte(1)
+	expiry := uint32(60)
+	user := paho.UserProperties{
+		{Key: "first", Value: "1"},
+		{Key: "second", Value: "2"},
+		{Key: "first", Value: "3"},
+	}
+	_, conn, err := CreateAndConnectClientWithWill(cfg, cfg.ClientID("test-will-props"), &paho.WillMessage{
+		Topic:   topic,
+		QoS:     0,
+		Payload: []byte(`{"status":"offline"}`),
+	}, &paho.WillProperties{
+		PayloadFormat:   &payloadFormat,
+		MessageExpiry:   &expiry,
+		ContentType:     "application/json",
+		ResponseTopic:   cfg.Topic("test/will/properties/response"),
+		CorrelationData: []byte("will-correlation"),
+		User:            user,
+	}, 0)
+	if err != nil {
+		result.Error = fmt.Errorf("client with will connect failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	sever(conn)
+
+	p := awaitWill(received, cfg.Scaled(2*time.Second))
+	if p == nil {
+		result.Error = fmt.Errorf("will message not received")
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	props := p.Properties
+	if props == nil {
+		props = &paho.PublishProperties{}
+	}
+	var problems []string
+	if props.PayloadFormat == nil || *props.PayloadFormat != payloadFormat {
+		problems = append(problems, "Payload Format Indicator missing or changed")
+	}
+	switch {
+	case props.MessageExpiry == nil:
+		problems = append(problems, "Message Expiry Interval missing")
+	case *props.MessageExpiry == 0 || *props.MessageExpiry > expiry:
+		problems = append(problems, fmt.Sprintf("Message Expiry Interval %d, expected 1 to %d", *props.MessageExpiry, expiry))
+	}
+	if props.ContentType != "application/json" {
+		problems = append(problems, fmt.Sprintf("Content Type %q", props.ContentType))
+	}
+	if props.ResponseTopic != cfg.Topic("test/will/properties/response") {
+		problems = append(problems, fmt.Sprintf("Response Topic %q", props.ResponseTopic))
+	}
+	if !bytes.Equal(props.CorrelationData, []byte("will-correlation")) {
+		problems = append(problems, fmt.Sprintf("Correlation Data %q", props.CorrelationData))
+	}
+	if !userPropertiesEqual(props.User, user) {
+		problems = append(problems, fmt.Sprintf("User Properties %v, expected %v in order", props.User, user))
+	}
+
+	if len(problems) > 0 {
+		result.Error = fmt.Errorf("will message properties not delivered intact: %v", problems)
+	} else {
+		result.Status = common.StatusPassed
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// userPropertiesEqual reports whether got holds the same pairs as want, in
+// the same order
+func userPropertiesEqual(got, want paho.UserProperties) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/internal/conformance"
+	"github.com/spf13/cobra"
+)
+
+var (
+	clVersion   string
+	clBroker    string
+	clUsername  string
+	clPassword  string
+	clNamespace string
+	clReport    string
+	clClientIDs []string
+)
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Remove retained messages and sessions left by a conformance run",
+	Long: `Clear every retained message under a run's topic namespace and end the
+persistent sessions its tests created. Conformance runs clean up after
+themselves; use this after a run was aborted.
+
+The namespace and session client IDs are read from a --json results file, or
+given with --namespace and --client-id. The namespace is printed at the start
+of every conformance run.`,
+	RunE:         runCleanup,
+	SilenceUsage: true,
+}
+
+func init() {
+	cleanupCmd.Flags().StringVarP(&clVersion, "version", "v", "5", "MQTT version (3 or 5), or sparkplug")
+	cleanupCmd.Flags().StringVarP(&clBroker, "broker", "b", "tcp://localhost:1883", "Broker URL")
+	cleanupCmd.Flags().StringVarP(&clUsername, "username", "u", "", "MQTT username")
+	cleanupCmd.Flags().StringVarP(&clPassword, "password", "p", "", "MQTT password")
+	cleanupCmd.Flags().StringVar(&clNamespace, "namespace", "", "Topic namespace of the run, e.g. testmqtt/20250102T150405-1234 (testmqtt for every run)")
+	cleanupCmd.Flags().StringVar(&clReport, "report", "", "JSON results of the run (from conformance --json) to read the namespace and sessions from")
+	cleanupCmd.Flags().StringSliceVar(&clClientIDs, "client-id", nil, "Client ID of a persistent session to end (repeatable)")
+}
+
+func runCleanup(cmd *cobra.Command, args []string) error {
+	namespace := clNamespace
+	clientIDs := clClientIDs
+	if clReport != "" {
+		report, err := common.ReadReport(clReport)
+		if err != nil {
+			return err
+		}
+		if namespace == "" {
+			namespace = report.Namespace
+		}
+		clientIDs = append(clientIDs, report.Sessions...)
+	}
+	namespace = strings.TrimSuffix(namespace, "/")
+	if namespace == "" {
+		return fmt.Errorf("no namespace given (use --namespace or --report)")
+	}
+
+	cfg := common.Config{
+		Broker:         clBroker,
+		Username:       clUsername,
+		Password:       clPassword,
+		TopicNamespace: namespace,
+	}
+
+	fmt.Printf("\n%s\n", common.TitleStyle.Render("Conformance Cleanup"))
+	fmt.Printf("%s\n", common.SubtitleStyle.Render(fmt.Sprintf("Broker: %s, namespace: %s/#", clBroker, namespace)))
+
+	var res *common.CleanupResult
+	var err error
+	switch clVersion {
+	case "5":
+		res, err = conformance.CleanupV5(cfg, clientIDs)
+	case "3":
+		res, err = conformance.CleanupV3(cfg, clientIDs)
+	case "sparkplug":
+		res, err = conformance.CleanupSparkplug(cfg, clientIDs)
+	default:
+		return fmt.Errorf("unsupported MQTT version: %s (supported: 3, 5, sparkplug)", clVersion)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range res.Retained {
+		fmt.Printf("  %s retained %s\n", common.PassStyle.Render("✓ cleared"), topic)
+	}
+	for _, id := range res.Sessions {
+		fmt.Printf("  %s session %s\n", common.PassStyle.Render("✓ ended"), id)
+	}
+	for _, e := range res.Errors {
+		fmt.Printf("  %s\n", common.FailStyle.Render("✗ "+e.Error()))
+	}
+	fmt.Printf("\nCleared %d retained message(s), ended %d session(s)\n", len(res.Retained), len(res.Sessions))
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("%d item(s) could not be cleaned up", len(res.Errors))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmpThreshold float64
+	cmpMinDelta  time.Duration
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare old.json new.json",
+	Short: "Compare two conformance runs",
+	Long: `Compare two conformance result files written with "conformance --json" and
+report newly failing, newly passing and slower tests. Exits non-zero when the
+new run has regressed, so it can gate broker upgrades in CI.`,
+	Args:         cobra.ExactArgs(2),
+	RunE:         runCompare,
+	SilenceUsage: true,
+}
+
+func init() {
+	compareCmd.Flags().Float64Var(&cmpThreshold, "duration-threshold", 0.5, "Relative slowdown that counts as a regression (0.5 = 50% slower)")
+	compareCmd.Flags().DurationVar(&cmpMinDelta, "min-duration-delta", 100*time.Millisecond, "Ignore slowdowns smaller than this")
+}
+
+func runCompare(cmd *cobra.Command, args []string) error {
+	before, err := common.ReadReport(args[0])
+	if err != nil {
+		return err
+	}
+	after, err := common.ReadReport(args[1])
+	if err != nil {
+		return err
+	}
+
+	comparison := common.CompareReports(before, after, common.CompareOptions{
+		DurationThreshold: cmpThreshold,
+		MinDurationDelta:  cmpMinDelta,
+	})
+	common.PrintComparison(before, after, comparison)
+
+	if comparison.Regressed() {
+		return verdictf("%d newly failing, %d slower test(s)", len(comparison.NewlyFailing), len(comparison.Slower))
+	}
+	return nil
+}
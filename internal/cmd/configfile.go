@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is read from the working directory when --config is not
+// given
+const defaultConfigFile = "testmqtt.yaml"
+
+var configFile string
+
+// fileConfig is the layout of testmqtt.yaml. Every setting has a command
+// line flag, which wins over the file.
+type fileConfig struct {
+	Version        string            `yaml:"version"`
+	Broker         string            `yaml:"broker"`
+	Brokers        []string          `yaml:"brokers"`
+	ClusterNodes   []string          `yaml:"cluster_nodes"`
+	Username       string            `yaml:"username"`
+	Password       string            `yaml:"password"`
+	TLS            common.TLSOptions `yaml:"tls"`
+	Auth           common.Auth       `yaml:"auth"`
+	ACL            common.ACL        `yaml:"acl"`
+	Quota          common.Quota      `yaml:"quota"`
+	Limits         common.Limits     `yaml:"limits"`
+	Bridge         common.Bridge     `yaml:"bridge"`
+	Redirect       common.Redirect   `yaml:"redirect"`
+	Tests          []string          `yaml:"tests"`
+	Tags           []string          `yaml:"tags"`
+	TopicNamespace string            `yaml:"topic_namespace"`
+	ClientIDPrefix string            `yaml:"client_id_prefix"`
+	Retries        string            `yaml:"retries"`
+	LogLevel       string            `yaml:"log_level"`
+	Plain          bool              `yaml:"plain"`
+
+	Timeouts struct {
+		Connect      string `yaml:"connect"`
+		RetryBackoff string `yaml:"retry_backoff"`
+		Docker       string `yaml:"docker"`
+		Ready        string `yaml:"ready"`
+
+		// Partitions the network partition tests black-hole traffic for
+		Partitions []string `yaml:"partitions"`
+
+		// Multiplier for the waits in the tests, calibrated when unset
+		Multiplier string `yaml:"multiplier"`
+	} `yaml:"timeouts"`
+
+	Outputs struct {
+		JSON        string `yaml:"json"`
+		Report      string `yaml:"report"`
+		Matrix      string `yaml:"matrix"`
+		Artifacts   string `yaml:"artifacts"`
+		Golden      string `yaml:"golden"`
+		History     string `yaml:"history"`
+		FlakyReport string `yaml:"flaky_report"`
+	} `yaml:"outputs"`
+}
+
+// flags maps the file's settings to the flags they provide defaults for
+func (c *fileConfig) flags() map[string]string {
+	return map[string]string{
+		"version":            c.Version,
+		"broker":             c.Broker,
+		"brokers":            strings.Join(c.Brokers, ","),
+		"cluster-nodes":      strings.Join(c.ClusterNodes, ","),
+		"username":           c.Username,
+		"password":           c.Password,
+		"tls-ca":             c.TLS.CAFile,
+		"tls-cert":           c.TLS.CertFile,
+		"tls-key":            c.TLS.KeyFile,
+		"tls-server-name":    c.TLS.ServerName,
+		"tls-insecure":       fmt.Sprint(c.TLS.InsecureSkipVerify),
+		"invalid-username":   c.Auth.InvalidUsername,
+		"invalid-password":   c.Auth.InvalidPassword,
+		"anonymous-access":   c.Auth.Anonymous,
+		"scram-username":     c.Auth.ScramUsername,
+		"scram-password":     c.Auth.ScramPassword,
+		"acl-username":       c.ACL.Username,
+		"acl-password":       c.ACL.Password,
+		"allowed-topic":      c.ACL.AllowedTopic,
+		"denied-topic":       c.ACL.DeniedTopic,
+		"quota-messages":     fmt.Sprint(c.Quota.Messages),
+		"quota-inflight":     fmt.Sprint(c.Quota.Inflight),
+		"limit-connections":  fmt.Sprint(c.Limits.Connections),
+		"limit-payload":      fmt.Sprint(c.Limits.Payload),
+		"limit-inflight":     fmt.Sprint(c.Limits.Inflight),
+		"bridge-listen":      c.Bridge.Listen,
+		"bridge-local":       c.Bridge.LocalPrefix,
+		"bridge-remote":      c.Bridge.RemotePrefix,
+		"bridge-timeout":     fmt.Sprint(c.Bridge.Timeout),
+		"redirect-username":  c.Redirect.Username,
+		"redirect-password":  c.Redirect.Password,
+		"redirect-client-id": c.Redirect.ClientID,
+		"follow-redirect":    fmt.Sprint(c.Redirect.Follow),
+		"tests":              strings.Join(c.Tests, ","),
+		"tags":               strings.Join(c.Tags, ","),
+		"topic-namespace":    c.TopicNamespace,
+		"namespace":          c.TopicNamespace,
+		"client-id-prefix":   c.ClientIDPrefix,
+		"retries":            c.Retries,
+		"log-level":          c.LogLevel,
+		"plain":              fmt.Sprint(c.Plain),
+		"connect-timeout":    c.Timeouts.Connect,
+		"retry-backoff":      c.Timeouts.RetryBackoff,
+		"docker-timeout":     c.Timeouts.Docker,
+		"ready-timeout":      c.Timeouts.Ready,
+		"partition-windows":  strings.Join(c.Timeouts.Partitions, ","),
+		"timing-multiplier":  c.Timeouts.Multiplier,
+		"json":               c.Outputs.JSON,
+		"report":             c.Outputs.Report,
+		"html":               c.Outputs.Matrix,
+		"artifacts":          c.Outputs.Artifacts,
+		"golden":             c.Outputs.Golden,
+		"history":            c.Outputs.History,
+		"flaky-report":       c.Outputs.FlakyReport,
+	}
+}
+
+// loadConfigFile reads --config, or testmqtt.yaml if it exists, and uses its
+// settings for the flags of cmd that were not given on the command line
+func loadConfigFile(cmd *cobra.Command, args []string) error {
+	path := cmp.Or(configFile, defaultConfigFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if configFile == "" && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fc fileConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for name, value := range fc.flags() {
+		f := cmd.Flags().Lookup(name)
+		if f == nil || f.Changed || value == "" || (value == "false" && f.Value.Type() == "bool") {
+			continue
+		}
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+	}
+	return nil
+}
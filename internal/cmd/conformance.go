@@ -1,19 +1,88 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/bromq-dev/testmqtt/conformance/common"
 	"github.com/bromq-dev/testmqtt/internal/conformance"
+	"github.com/bromq-dev/testmqtt/internal/docker"
+	"github.com/bromq-dev/testmqtt/internal/history"
+	"github.com/bromq-dev/testmqtt/internal/tui"
 	"github.com/spf13/cobra"
 )
 
 var (
-	cfVersion  string
-	cfBroker   string
-	cfTests    string
-	cfVerbose  bool
-	cfUsername string
-	cfPassword string
+	cfVersion   string
+	cfBroker    string
+	cfTests     string
+	cfVerbose   bool
+	cfUsername  string
+	cfPassword  string
+	cfBrokers   string
+	cfNodes     []string
+	cfHTML      string
+	cfJSON      string
+	cfReport    string
+	cfArtifacts string
+	cfGolden    string
+	cfUpdate    bool
+	cfLogLevel  string
+	cfTrace     bool
+	cfNamespace string
+	cfIDPrefix  string
+	cfNoCleanup bool
+	cfLogger    *slog.Logger // Built from --log-level when the command starts
+
+	cfTLS            common.TLSOptions
+	cfAuth           common.Auth
+	cfACL            common.ACL
+	cfBridge         common.Bridge
+	cfRedirect       common.Redirect
+	cfQuota          common.Quota
+	cfLimits         common.Limits
+	cfConnectTimeout time.Duration
+	cfTimingScale    float64
+	cfReadyTimeout   time.Duration
+	cfPartitions     []time.Duration
+
+	cfFormat      string
+	cfMaxFailures int
+	cfFailOnMust  bool
+	cfTags        []string
+
+	cfRepeat       int
+	cfUntilFailure bool
+	cfFlakyReport  string
+	cfRetries      int
+	cfRetryBackoff time.Duration
+	cfRerunFailed  bool
+	cfInteractive  bool
+	cfProgress     bool
+	cfLastRun      string
+	cfShuffle      bool
+	cfSeed         uint64
+	seedSet        bool // --seed was given, so every run uses it
+
+	cfHistory       string
+	cfBrokerVersion string
+	cfGitSHA        string
+
+	cfDockerBroker  string
+	cfDockerPort    int
+	cfDockerTimeout time.Duration
 )
 
 var conformanceCmd = &cobra.Command{
@@ -25,21 +94,559 @@ var conformanceCmd = &cobra.Command{
 }
 
 func init() {
-	conformanceCmd.Flags().StringVarP(&cfVersion, "version", "v", "5", "MQTT version (3 or 5)")
+	conformanceCmd.Flags().StringVarP(&cfVersion, "version", "v", "5", "MQTT version (3 or 5), or sparkplug for the Sparkplug B suite")
 	conformanceCmd.Flags().StringVarP(&cfBroker, "broker", "b", "tcp://localhost:1883", "Broker URL")
 	conformanceCmd.Flags().StringVarP(&cfTests, "tests", "t", "all", "Tests to run (all, or comma-separated list)")
 	conformanceCmd.Flags().BoolVar(&cfVerbose, "verbose", false, "Enable verbose output with detailed failure information")
+	conformanceCmd.Flags().StringVar(&cfLogLevel, "log-level", "warn", "Log level for structured logs on stderr (debug, info, warn); debug logs every packet")
+	conformanceCmd.Flags().BoolVar(&cfTrace, "trace-packets", false, "Print every packet each test sends and receives (type, packet ID, flags, properties) under its result")
+	conformanceCmd.Flags().StringVar(&cfNamespace, "topic-namespace", "", "Prefix for every test topic (default: testmqtt/<unique run id>)")
+	conformanceCmd.Flags().StringVar(&cfIDPrefix, "client-id-prefix", "", "Prefix for every test client ID, e.g. for ACLs keyed on the client ID")
+	conformanceCmd.Flags().BoolVar(&cfNoCleanup, "no-cleanup", false, "Leave retained messages and persistent sessions created by the tests on the broker")
+	conformanceCmd.Flags().IntVar(&cfRepeat, "repeat", 1, "Run the selected tests this many times and report per-test pass rates and flaky tests")
+	conformanceCmd.Flags().BoolVar(&cfUntilFailure, "until-failure", false, "Repeat the run until a test fails (at most --repeat times when it is above 1)")
+	conformanceCmd.Flags().StringVar(&cfFlakyReport, "flaky-report", "testmqtt-flakiness.json", "JSON file for the flakiness report of --repeat and --until-failure (empty to skip)")
+	conformanceCmd.Flags().IntVar(&cfRetries, "retries", 0, "Run a failed test up to this many more times; tests that pass on retry are marked in the reports")
+	conformanceCmd.Flags().DurationVar(&cfRetryBackoff, "retry-backoff", 2*time.Second, "Wait between the attempts of a retried test")
+	conformanceCmd.Flags().BoolVar(&cfRerunFailed, "rerun-failed", false, "Run only the tests that failed in the last run and merge the results with its other results")
+	conformanceCmd.Flags().StringVar(&cfLastRun, "last-run", "", "Where the last run's results are kept for --rerun-failed (default .testmqtt/last-run-v<version>.json)")
+	conformanceCmd.Flags().BoolVarP(&cfInteractive, "interactive", "i", false, "Pick the tests to run from a list and follow their results live")
+	conformanceCmd.Flags().BoolVar(&cfProgress, "progress", false, "Show running totals and the time left, estimated from how long each test took in earlier runs")
+	conformanceCmd.Flags().BoolVar(&cfShuffle, "shuffle", false, "Run groups and the tests within them in random order to expose dependencies between tests")
+	conformanceCmd.Flags().Uint64Var(&cfSeed, "seed", 0, "Seed for --shuffle, to repeat the order of an earlier run (default: random, printed in the header)")
 	conformanceCmd.Flags().StringVarP(&cfUsername, "username", "u", "", "MQTT username")
 	conformanceCmd.Flags().StringVarP(&cfPassword, "password", "p", "", "MQTT password")
+	conformanceCmd.Flags().StringVar(&cfAuth.InvalidUsername, "invalid-username", "", "Username the broker refuses, for the authentication tests")
+	conformanceCmd.Flags().StringVar(&cfAuth.InvalidPassword, "invalid-password", "", "Password sent with --invalid-username")
+	conformanceCmd.Flags().StringVar(&cfAuth.Anonymous, "anonymous-access", "", "Whether the broker accepts clients without credentials: allow or deny")
+	conformanceCmd.Flags().StringVar(&cfAuth.ScramUsername, "scram-username", "", "Username the broker authenticates with SCRAM-SHA-256, for the enhanced authentication tests")
+	conformanceCmd.Flags().StringVar(&cfAuth.ScramPassword, "scram-password", "", "Password of --scram-username")
+	conformanceCmd.Flags().StringVar(&cfACL.Username, "acl-username", "", "Username the broker's access control applies to, for the authorization tests (default: --username)")
+	conformanceCmd.Flags().StringVar(&cfACL.Password, "acl-password", "", "Password of --acl-username")
+	conformanceCmd.Flags().StringVar(&cfACL.AllowedTopic, "allowed-topic", "", "Topic the ACL user may publish and subscribe to (default: a topic in the run's namespace)")
+	conformanceCmd.Flags().IntVar(&cfQuota.Messages, "quota-messages", 0, "QoS 1 PUBLISHes the quota flood test sends; when given, the broker must report 0x97 Quota exceeded within them (default 1000, probing only)")
+	conformanceCmd.Flags().IntVar(&cfQuota.Inflight, "quota-inflight", 0, "Unreleased QoS 2 PUBLISHes after which the broker must report 0x97 Quota exceeded (default: its Receive Maximum, probing only)")
+	conformanceCmd.Flags().IntVar(&cfLimits.Connections, "limit-connections", 0, "Most connections the maximum connections test opens looking for the broker's limit; the test is skipped without it")
+	conformanceCmd.Flags().IntVar(&cfLimits.Payload, "limit-payload", 0, "Largest payload in bytes the maximum message size test tries looking for the broker's limit, up to 256MB; the test is skipped without it")
+	conformanceCmd.Flags().IntVar(&cfLimits.Inflight, "limit-inflight", common.DefaultLimitInflight, "QoS 1 messages the inflight window test publishes to a subscriber withholding its PUBACKs (at most 65535)")
+	conformanceCmd.Flags().StringVar(&cfACL.DeniedTopic, "denied-topic", "", "Topic the ACL user may not publish or subscribe to; the authorization tests are skipped without it")
+	conformanceCmd.Flags().StringVar(&cfBridge.Listen, "bridge-listen", "", "Address to play the remote broker of a bridge configured on the broker on, e.g. 127.0.0.1:1890; the bridge tests are skipped without it")
+	conformanceCmd.Flags().StringVar(&cfBridge.LocalPrefix, "bridge-local", "bridge/local/", "Prefix of the bridged topics on the broker under test")
+	conformanceCmd.Flags().StringVar(&cfBridge.RemotePrefix, "bridge-remote", "bridge/remote/", "Prefix the bridge maps --bridge-local to on the remote")
+	conformanceCmd.Flags().DurationVar(&cfBridge.Timeout, "bridge-timeout", common.DefaultBridgeTimeout, "How long to wait for the bridge to connect or reconnect to the remote")
+	conformanceCmd.Flags().StringVar(&cfRedirect.ClientID, "redirect-client-id", "", "Client ID the broker sends to another server with 0x9C or 0x9D; the server redirection tests are skipped without it or --redirect-username")
+	conformanceCmd.Flags().StringVar(&cfRedirect.Username, "redirect-username", "", "Username the broker sends to another server (default: --username)")
+	conformanceCmd.Flags().StringVar(&cfRedirect.Password, "redirect-password", "", "Password of --redirect-username")
+	conformanceCmd.Flags().BoolVar(&cfRedirect.Follow, "follow-redirect", false, "Connect to the Server Reference the broker redirects to and publish through it")
+	conformanceCmd.Flags().StringVar(&cfTLS.CAFile, "tls-ca", "", "PEM CA bundle to verify a ssl://, tls:// or mqtts:// broker with (default: system roots)")
+	conformanceCmd.Flags().StringVar(&cfTLS.CertFile, "tls-cert", "", "PEM client certificate for mutual TLS")
+	conformanceCmd.Flags().StringVar(&cfTLS.KeyFile, "tls-key", "", "PEM key of --tls-cert")
+	conformanceCmd.Flags().StringVar(&cfTLS.ServerName, "tls-server-name", "", "Server name to verify the broker certificate against (default: the broker host)")
+	conformanceCmd.Flags().BoolVar(&cfTLS.InsecureSkipVerify, "tls-insecure", false, "Do not verify the broker certificate")
+	conformanceCmd.Flags().DurationVar(&cfConnectTimeout, "connect-timeout", 5*time.Second, "Timeout for connecting to the broker")
+	conformanceCmd.Flags().DurationVar(&cfReadyTimeout, "ready-timeout", 10*time.Second, "How long to keep retrying while the broker refuses connections before giving up (0 tries once)")
+	conformanceCmd.Flags().Float64Var(&cfTimingScale, "timing-multiplier", 0, "Scale the waits tests use for the broker to deliver messages (default: calibrated from the broker's round trip time)")
+	conformanceCmd.Flags().StringSliceVar(&cfTags, "tags", nil, "Only run groups with one of these tags (see testmqtt list)")
+	conformanceCmd.Flags().StringVar(&cfFormat, "format", "text", "Output format: text, or github to add GitHub Actions annotations for failures and warnings")
+	conformanceCmd.Flags().IntVar(&cfMaxFailures, "max-failures", 0, "Exit non-zero only when more than this many tests fail (-1: never for the count alone)")
+	conformanceCmd.Flags().BoolVar(&cfFailOnMust, "fail-on-must", false, "Exit non-zero on any failed MUST requirement, even within --max-failures")
+	conformanceCmd.Flags().StringVar(&cfBrokers, "brokers", "", "Comma-separated broker URLs to compare side by side (overrides --broker)")
+	conformanceCmd.Flags().DurationSliceVar(&cfPartitions, "partition-windows", common.DefaultPartitionWindows, "How long the network partition tests black-hole traffic, each window tried in turn")
+	conformanceCmd.Flags().StringSliceVar(&cfNodes, "cluster-nodes", nil, "Other nodes of the cluster --broker belongs to, for the cluster tests (skipped without them)")
+	conformanceCmd.Flags().StringVar(&cfHTML, "html", "testmqtt-matrix.html", "HTML file for the --brokers comparison matrix (empty to skip)")
+	conformanceCmd.Flags().StringVar(&cfJSON, "json", "", "Save the results to this JSON file (for testmqtt compare)")
+	conformanceCmd.Flags().StringVar(&cfReport, "report", "", "Write a standalone HTML report with packet traces of failed tests to this file")
+	conformanceCmd.Flags().StringVar(&cfArtifacts, "artifacts", "", "Write per-test artifacts (raw packet logs, client IDs, CONNACK properties, timings) to this directory")
+	conformanceCmd.Flags().StringVar(&cfGolden, "golden", "", "Compare each test's packet transcript with the golden one in this directory and show what changed (recorded there when missing)")
+	conformanceCmd.Flags().BoolVar(&cfUpdate, "update-golden", false, "Replace the transcripts in --golden with this run's instead of comparing")
+	conformanceCmd.Flags().StringVar(&cfHistory, "history", "", "Append the results to this SQLite history database (see testmqtt history)")
+	conformanceCmd.Flags().StringVar(&cfBrokerVersion, "broker-version", "", "Broker version recorded with --history")
+	conformanceCmd.Flags().StringVar(&cfGitSHA, "git-sha", "", "Git SHA recorded with --history (default: $GITHUB_SHA or git rev-parse HEAD)")
+	conformanceCmd.Flags().StringVar(&cfDockerBroker, "docker-broker", "", "Start this broker image in Docker and test it, e.g. mosquitto:2 (overrides --broker)")
+	conformanceCmd.Flags().IntVar(&cfDockerPort, "docker-port", 0, "MQTT port inside the --docker-broker container (default from the image preset, else 1883)")
+	conformanceCmd.Flags().DurationVar(&cfDockerTimeout, "docker-timeout", 60*time.Second, "How long to wait for the --docker-broker container to accept connections")
 }
 
 func runConformance(cmd *cobra.Command, args []string) error {
+	level, err := common.ParseLogLevel(cfLogLevel)
+	if err != nil {
+		return err
+	}
+	cfLogger = common.NewLogger(os.Stderr, level)
+	if cfRetries < 0 {
+		return fmt.Errorf("--retries cannot be negative")
+	}
+	if cfFormat != "text" && cfFormat != "github" {
+		return fmt.Errorf("unsupported format: %s (supported: text, github)", cfFormat)
+	}
+	if a := cfAuth.Anonymous; a != "" && a != common.AnonymousAllow && a != common.AnonymousDeny {
+		return fmt.Errorf("unsupported --anonymous-access: %s (supported: allow, deny)", a)
+	}
+	if cfUpdate && cfGolden == "" {
+		return fmt.Errorf("--update-golden needs --golden")
+	}
+	if seedSet = cmd.Flags().Changed("seed"); seedSet {
+		cfShuffle = true
+	}
+
+	if cfDockerBroker != "" {
+		if cfBrokers != "" {
+			return fmt.Errorf("--docker-broker and --brokers cannot be combined")
+		}
+		return runDockerBroker()
+	}
+	if cfBrokers != "" {
+		if cfRerunFailed {
+			return fmt.Errorf("--rerun-failed and --brokers cannot be combined")
+		}
+		if cfInteractive {
+			return fmt.Errorf("--interactive and --brokers cannot be combined")
+		}
+		return runComparison()
+	}
+	report, err := runSelected(cfBroker)
+	if saveErr := saveReport(report); saveErr != nil {
+		return saveErr
+	}
+	goldenErr := checkGolden(report)
+	if err = applyThresholds(report, err); err != nil && ExitCode(goldenErr) != ExitError {
+		return err
+	}
+	return goldenErr
+}
+
+// checkGolden compares the run's packet transcripts with those in --golden,
+// or records them there with --update-golden or when there are none yet
+func checkGolden(report *common.Report) error {
+	if cfGolden == "" || report == nil {
+		return nil
+	}
+	entries, err := os.ReadDir(cfGolden)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if cfUpdate || len(entries) == 0 {
+		if err := common.WriteGolden(cfGolden, report); err != nil {
+			return fmt.Errorf("failed to write golden transcripts to %s: %w", cfGolden, err)
+		}
+		fmt.Printf("\nGolden transcripts of %d tests written to %s\n", len(report.Results), cfGolden)
+		return nil
+	}
+
+	changes, err := common.CompareGolden(cfGolden, report)
+	if err != nil {
+		return fmt.Errorf("failed to read golden transcripts from %s: %w", cfGolden, err)
+	}
+	common.PrintGoldenChanges(cfGolden, changes)
+	changed := 0
+	for _, c := range changes {
+		if !c.New() {
+			changed++
+		}
+	}
+	if changed > 0 {
+		return verdictf("%d test(s) changed behavior since the golden transcripts (--update-golden to accept)", changed)
+	}
+	return nil
+}
+
+// runSuite runs the selected conformance suite against one broker
+func runSuite(broker string) (*common.Report, error) {
+	var tlsConfig *tls.Config
+	if !cfTLS.IsZero() {
+		var err error
+		if tlsConfig, err = cfTLS.Config(); err != nil {
+			return nil, err
+		}
+	}
+	cfg := common.Config{
+		Broker:           broker,
+		Nodes:            cfNodes,
+		Username:         cfUsername,
+		Password:         cfPassword,
+		Auth:             cfAuth,
+		ACL:              cfACL,
+		Bridge:           cfBridge,
+		Redirect:         cfRedirect,
+		RestartBroker:    restartBroker,
+		PartitionWindows: cfPartitions,
+		Quota:            cfQuota,
+		Limits:           cfLimits,
+		TLS:              tlsConfig,
+		DialTimeout:      cfConnectTimeout,
+		TimingMultiplier: cfTimingScale,
+		ReadyTimeout:     cfReadyTimeout,
+		Tags:             cfTags,
+		TracePackets:     cfReport != "" || cfArtifacts != "" || cfGolden != "",
+		PrintTrace:       cfTrace,
+		TopicNamespace:   strings.TrimSuffix(cfNamespace, "/"),
+		ClientIDPrefix:   cfIDPrefix,
+		SkipCleanup:      cfNoCleanup,
+		Retries:          cfRetries,
+		RetryBackoff:     cfRetryBackoff,
+		Shuffle:          cfShuffle,
+		Seed:             cfSeed,
+		Logger:           cfLogger,
+	}
+	if cfProgress {
+		durations, err := common.ReadDurations(durationsPath())
+		if err != nil {
+			cfLogger.Warn("no time estimates", "error", err)
+		}
+		cfg.Progress, cfg.Durations = true, durations
+	}
+	if cfShuffle && !seedSet {
+		// A new order for every run, e.g. with --repeat
+		cfg.Seed = rand.Uint64()
+	}
+	if cfRerunFailed {
+		return rerunFailed(cfg)
+	}
+	if cfInteractive {
+		suite, err := conformance.Suite(cfVersion)
+		if err != nil {
+			return nil, err
+		}
+		return tui.Run(suite, cfg, cfTests)
+	}
+	switch cfVersion {
+	case "5":
+		return conformance.RunV5Tests(cfg, cfTests, cfVerbose)
+	case "3":
+		return conformance.RunV3Tests(cfg, cfTests, cfVerbose)
+	case "sparkplug":
+		return conformance.RunSparkplugTests(cfg, cfTests, cfVerbose)
+	default:
+		return nil, fmt.Errorf("unsupported MQTT version: %s (supported: 3, 5, sparkplug)", cfVersion)
+	}
+}
+
+// rerunFailed runs the tests that failed in the last run and merges their
+// results into it
+func rerunFailed(cfg common.Config) (*common.Report, error) {
+	path := lastRunPath()
+	prior, err := common.ReadReport(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("no last run to rerun (%s not found)", path)
+		}
+		return nil, err
+	}
+	if prior.Broker != cfg.Broker {
+		fmt.Println(common.WarnStyle.Render(fmt.Sprintf("The last run was against %s, rerunning its failures against %s", prior.Broker, cfg.Broker)))
+	}
+
+	report, err := conformance.RerunFailed(cfVersion, cfg, cfTests, cfVerbose, prior)
+	if report == nil && err == nil {
+		fmt.Println(common.PassStyle.Render(fmt.Sprintf("No failed tests to rerun in %s", path)))
+	}
+	return report, err
+}
+
+// lastRunPath is where the results of the last run are kept for
+// --rerun-failed
+func lastRunPath() string {
+	if cfLastRun != "" {
+		return cfLastRun
+	}
+	return filepath.Join(".testmqtt", fmt.Sprintf("last-run-v%s.json", cfVersion))
+}
+
+// durationsPath is where how long each test took is kept for --progress
+func durationsPath() string {
+	return filepath.Join(filepath.Dir(lastRunPath()), fmt.Sprintf("durations-v%s.json", cfVersion))
+}
+
+// runSelected runs the suite once, or repeatedly with --repeat and
+// --until-failure, in which case the last run's report is returned
+func runSelected(broker string) (*common.Report, error) {
+	if cfRepeat < 1 {
+		return nil, fmt.Errorf("--repeat must be at least 1")
+	}
+
+	if cfRepeat == 1 && !cfUntilFailure {
+		return runSuite(broker)
+	}
+
+	var reports []*common.Report
+	var report *common.Report
+	var err error
+	for run := 1; cfRepeat == 1 || run <= cfRepeat; run++ {
+		label := fmt.Sprintf("Run %d", run)
+		if cfRepeat > 1 {
+			label += fmt.Sprintf(" of %d", cfRepeat)
+		}
+		fmt.Printf("\n%s\n", common.SubtitleStyle.Render(label))
+
+		r, runErr := runSuite(broker)
+		if r == nil {
+			// The broker could not be tested at all, which says nothing
+			// about flakiness
+			err = runErr
+			break
+		}
+		report, err = r, runErr
+		reports = append(reports, report)
+		if cfUntilFailure && report.Counts()[common.StatusFailed] > 0 {
+			fmt.Printf("\n%s\n", common.FailStyle.Render(fmt.Sprintf("Stopped after run %d: a test failed", run)))
+			break
+		}
+	}
+	if len(reports) == 0 {
+		return nil, err
+	}
+
+	flakiness := common.BuildFlakiness(reports)
+	common.PrintFlakiness(flakiness)
+	if cfFlakyReport != "" {
+		if err := common.WriteFlakiness(cfFlakyReport, flakiness); err != nil {
+			return report, fmt.Errorf("failed to write %s: %w", cfFlakyReport, err)
+		}
+		fmt.Printf("\nFlakiness report written to %s\n", cfFlakyReport)
+	}
+	if err == nil && len(flakiness.FlakyTests()) > 0 {
+		err = verdictf("%d flaky test(s) over %d runs", len(flakiness.FlakyTests()), len(reports))
+	}
+	return report, err
+}
+
+// saveReport keeps the report for --rerun-failed and writes it to --json,
+// --report, --artifacts and --history, if set
+func saveReport(report *common.Report) error {
+	if report == nil {
+		return nil
+	}
+	if cfFormat == "github" {
+		common.WriteGitHubAnnotations(os.Stdout, report)
+	}
+	lastRun := lastRunPath()
+	if err := os.MkdirAll(filepath.Dir(lastRun), 0o755); err != nil {
+		return err
+	}
+	if err := common.WriteReport(lastRun, report); err != nil {
+		return fmt.Errorf("failed to write %s: %w", lastRun, err)
+	}
+	if err := recordDurations(report); err != nil {
+		return err
+	}
+	if cfReport != "" {
+		f, err := os.Create(cfReport)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", cfReport, err)
+		}
+		if err := common.WriteHTMLReport(f, report); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write %s: %w", cfReport, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("\nReport written to %s\n", cfReport)
+	}
+	if cfJSON != "" {
+		if err := common.WriteReport(cfJSON, report); err != nil {
+			return fmt.Errorf("failed to write %s: %w", cfJSON, err)
+		}
+		fmt.Printf("\nResults written to %s\n", cfJSON)
+	}
+	if cfArtifacts != "" {
+		if err := common.WriteArtifacts(cfArtifacts, report); err != nil {
+			return fmt.Errorf("failed to write artifacts to %s: %w", cfArtifacts, err)
+		}
+		fmt.Printf("\nArtifacts written to %s\n", cfArtifacts)
+	}
+	if cfHistory != "" {
+		db, err := history.Open(cfHistory)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		sha := cfGitSHA
+		if sha == "" {
+			sha = gitSHA()
+		}
+		id, err := db.Record(report, history.Meta{BrokerVersion: cfBrokerVersion, GitSHA: sha})
+		if err != nil {
+			return fmt.Errorf("failed to record history: %w", err)
+		}
+		fmt.Printf("\nRecorded as run #%d in %s\n", id, cfHistory)
+	}
+	return nil
+}
+
+// recordDurations adds how long the tests took to the estimates of later
+// --progress runs
+func recordDurations(report *common.Report) error {
+	path := durationsPath()
+	durations, err := common.ReadDurations(path)
+	if err != nil {
+		// A damaged file is only estimates, start over
+		durations = make(common.Durations)
+	}
+	durations.Record(report)
+	if err := common.WriteDurations(path, durations); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// gitSHA identifies the checkout being tested, preferring CI's variable
+func gitSHA() string {
+	if sha := os.Getenv("GITHUB_SHA"); sha != "" {
+		return sha
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// runComparison runs the suite against every broker in --brokers and prints
+// a side-by-side matrix of the results
+func runComparison() error {
+	var title string
 	switch cfVersion {
 	case "5":
-		return conformance.RunV5Tests(cfBroker, cfUsername, cfPassword, cfTests, cfVerbose)
+		title = "MQTT v5.0 Broker Comparison"
 	case "3":
-		return conformance.RunV3Tests(cfBroker, cfUsername, cfPassword, cfTests, cfVerbose)
+		title = "MQTT v3.1.1 Broker Comparison"
+	case "sparkplug":
+		title = "Sparkplug B 3.0 Broker Comparison"
 	default:
-		return fmt.Errorf("unsupported MQTT version: %s (supported: 3, 5)", cfVersion)
+		return fmt.Errorf("unsupported MQTT version: %s (supported: 3, 5, sparkplug)", cfVersion)
+	}
+
+	var columns []common.MatrixColumn
+	failed := false
+	for _, broker := range strings.Split(cfBrokers, ",") {
+		broker = strings.TrimSpace(broker)
+		if broker == "" {
+			continue
+		}
+		report, err := runSuite(broker)
+		if applyThresholds(report, err) != nil {
+			failed = true
+		}
+		if report != nil && cfFormat == "github" {
+			common.WriteGitHubAnnotations(os.Stdout, report)
+		}
+		col := common.MatrixColumn{Broker: broker, Report: report}
+		if report == nil {
+			col.Err = err
+		}
+		columns = append(columns, col)
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("no brokers given")
+	}
+
+	matrix := common.BuildMatrix(title, columns)
+	common.PrintMatrix(matrix)
+
+	if cfHTML != "" {
+		f, err := os.Create(cfHTML)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", cfHTML, err)
+		}
+		if err := common.WriteMatrixHTML(f, matrix); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write %s: %w", cfHTML, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("\nMatrix written to %s\n", cfHTML)
+	}
+
+	if failed {
+		return verdictf("conformance failures on one or more brokers")
+	}
+	return nil
+}
+
+// restartBroker restarts the broker container while runDockerBroker runs
+// the suite against it, for the restart tests
+var restartBroker func() error
+
+// runDockerBroker provisions a broker container, runs the suite against it and
+// removes it again. The broker's logs are saved when the run fails.
+func runDockerBroker() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	broker, err := docker.Start(ctx, cfDockerBroker, docker.Options{
+		Port:         cfDockerPort,
+		ReadyTimeout: cfDockerTimeout,
+		OnStatus: func(status string) {
+			fmt.Println(common.SubtitleStyle.Render(status))
+		},
+	})
+	if broker != nil {
+		remove := func() {
+			fmt.Println(common.SubtitleStyle.Render(fmt.Sprintf("Removing %s container", broker.Image)))
+			if err := broker.Stop(context.Background()); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to remove container %.12s: %v\n", broker.ID, err)
+			}
+		}
+		defer remove()
+
+		// The suite cannot be cancelled, so on interrupt remove the container
+		// and exit rather than leave it running
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				remove()
+				os.Exit(130)
+			case <-done:
+			}
+		}()
+	}
+	if err != nil {
+		if broker != nil {
+			saveBrokerLogs(broker)
+		}
+		return fmt.Errorf("docker broker: %w", err)
+	}
+
+	restartBroker = func() error { return broker.Restart(ctx) }
+	defer func() { restartBroker = nil }()
+	report, err := runSelected(broker.URL)
+	if err != nil {
+		saveBrokerLogs(broker)
+	}
+	if saveErr := saveReport(report); saveErr != nil {
+		return saveErr
+	}
+	goldenErr := checkGolden(report)
+	if err = applyThresholds(report, err); err != nil && ExitCode(goldenErr) != ExitError {
+		return err
+	}
+	return goldenErr
+}
+
+// saveBrokerLogs writes the container logs to a file and shows their tail
+func saveBrokerLogs(broker *docker.Broker) {
+	logs, err := broker.Logs(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to fetch broker logs: %v\n", err)
+		return
+	}
+
+	path := fmt.Sprintf("testmqtt-broker-%s.log", time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(path, []byte(logs), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write broker logs: %v\n", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(logs, "\n"), "\n")
+	if len(lines) > 40 {
+		lines = lines[len(lines)-40:]
+	}
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render(fmt.Sprintf("Broker logs (last %d lines, full log in %s)", len(lines), path)))
+	for _, line := range lines {
+		fmt.Printf("  %s\n", common.DetailStyle.Render(line))
 	}
 }
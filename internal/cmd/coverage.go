@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"github.com/bromq-dev/testmqtt/internal/conformance"
+	"github.com/spf13/cobra"
+)
+
+var (
+	covVersion string
+	covGaps    bool
+)
+
+var coverageCmd = &cobra.Command{
+	Use:   "coverage",
+	Short: "Report spec coverage of the conformance tests",
+	Long: `Cross-reference the spec references of all conformance tests against the
+normative statements of the MQTT specification and report which statements are
+covered, partially covered (only their section is referenced) or not covered.`,
+	RunE:         runCoverage,
+	SilenceUsage: true,
+}
+
+func init() {
+	coverageCmd.Flags().StringVarP(&covVersion, "version", "v", "all", "MQTT version (3, 5 or all)")
+	coverageCmd.Flags().BoolVar(&covGaps, "gaps", false, "List every statement that is not fully covered")
+}
+
+func runCoverage(cmd *cobra.Command, args []string) error {
+	return conformance.PrintCoverage(covVersion, covGaps)
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// Exit codes, so CI can tell a broker that fails the tests from a run that
+// could not be completed
+const (
+	ExitOK     = 0
+	ExitFailed = 1 // Tests failed beyond the thresholds, were flaky, or regressed
+	ExitError  = 2 // Bad flags, unreachable broker, or any other error
+)
+
+// verdict is an error that reports on the broker rather than on the run
+type verdict struct {
+	msg string
+}
+
+func (v *verdict) Error() string {
+	return v.msg
+}
+
+func verdictf(format string, args ...any) error {
+	return &verdict{msg: fmt.Sprintf(format, args...)}
+}
+
+// ExitCode returns the process exit code for an error returned by Execute
+func ExitCode(err error) int {
+	var v *verdict
+	var failed *common.FailedError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &v), errors.As(err, &failed):
+		return ExitFailed
+	}
+	return ExitError
+}
+
+// applyThresholds decides whether the failures of a run fail the command,
+// given --max-failures and --fail-on-must. err is what running the suite
+// returned; errors other than test failures are passed through.
+func applyThresholds(report *common.Report, err error) error {
+	var failed *common.FailedError
+	if report == nil || !errors.As(err, &failed) {
+		return err
+	}
+
+	if must := report.Score().Failed[spec.LevelMust]; cfFailOnMust && must > 0 {
+		return verdictf("%d MUST requirement(s) failed", must)
+	}
+	if cfMaxFailures >= 0 && failed.Failed > cfMaxFailures {
+		if cfMaxFailures == 0 {
+			return err
+		}
+		return verdictf("%d test(s) failed, more than --max-failures %d", failed.Failed, cfMaxFailures)
+	}
+	fmt.Printf("\n%s\n", common.WarnStyle.Render(fmt.Sprintf("%d failed test(s) tolerated by --max-failures", failed.Failed)))
+	return nil
+}
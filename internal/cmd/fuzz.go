@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/internal/fuzz"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fzBroker        string
+	fzUsername      string
+	fzPassword      string
+	fzVersion       string
+	fzSeed          uint64
+	fzDuration      time.Duration
+	fzIterations    int
+	fzSessionLength int
+	fzTimeout       time.Duration
+	fzCorpus        string
+	fzOut           string
+	fzReplay        string
+)
+
+var fuzzCmd = &cobra.Command{
+	Use:   "fuzz",
+	Short: "Fuzz the broker with mutated packets",
+	Long: `Send randomly mutated MQTT packets to the broker over long sessions and
+watch how it handles each one. After every packet the broker must answer
+PINGREQ or close the connection, must not keep serving a connection it sent
+an error DISCONNECT on, and must only send packets that parse. After every
+session a new connection checks the broker is still up.
+
+Mutations start from a corpus of valid packets, kept in --corpus, which
+grows with the mutants that draw responses the broker has not given before.
+Each anomaly is written to --out as a JSON reproducer that --replay sends
+again. The run ends when --duration or --iterations is spent, on Ctrl+C, or
+when the broker stops responding.
+
+Fuzzing publishes below its own topic and may leave retained messages or
+sessions behind, so point it at a test broker.`,
+	Example: `  # Fuzz for ten minutes
+  testmqtt fuzz --broker tcp://localhost:1883 --duration 10m
+
+  # Repeat a run's packets for 50000 iterations on MQTT 3.1.1
+  testmqtt fuzz --version 3 --seed 42 --iterations 50000
+
+  # Check whether a finding still reproduces
+  testmqtt fuzz --replay .testmqtt/fuzz/findings/hung-connection-1f2e3d4c5b6a7980.json`,
+	RunE:         runFuzz,
+	SilenceUsage: true,
+}
+
+func init() {
+	fuzzCmd.Flags().StringVarP(&fzBroker, "broker", "b", "tcp://localhost:1883", "Broker URL")
+	fuzzCmd.Flags().StringVarP(&fzUsername, "username", "u", "", "MQTT username")
+	fuzzCmd.Flags().StringVarP(&fzPassword, "password", "p", "", "MQTT password")
+	fuzzCmd.Flags().StringVarP(&fzVersion, "version", "v", "5", "MQTT version (3 or 5)")
+	fuzzCmd.Flags().Uint64Var(&fzSeed, "seed", 0, "Seed for the mutations, to repeat an earlier run (default: random, printed in the header)")
+	fuzzCmd.Flags().DurationVar(&fzDuration, "duration", 5*time.Minute, "Stop after this long (0 for no limit)")
+	fuzzCmd.Flags().IntVar(&fzIterations, "iterations", 0, "Stop after this many mutated packets (0 for no limit)")
+	fuzzCmd.Flags().IntVar(&fzSessionLength, "session-length", 100, "Mutated packets per connection")
+	fuzzCmd.Flags().DurationVar(&fzTimeout, "timeout", 2*time.Second, "How long the broker has to answer PINGREQ before a connection counts as hung")
+	fuzzCmd.Flags().StringVar(&fzCorpus, "corpus", "", "Seed corpus directory, filled with the built-in seeds when empty (default .testmqtt/fuzz/corpus-v<version>)")
+	fuzzCmd.Flags().StringVar(&fzOut, "out", filepath.Join(".testmqtt", "fuzz", "findings"), "Directory for reproducers of anomalies")
+	fuzzCmd.Flags().StringVar(&fzReplay, "replay", "", "Send the packets of a reproducer again instead of fuzzing")
+}
+
+func runFuzz(cmd *cobra.Command, args []string) error {
+	var level byte
+	switch fzVersion {
+	case "5":
+		level = 5
+	case "3":
+		level = 4
+	default:
+		return fmt.Errorf("unsupported MQTT version: %s (supported: 3, 5)", fzVersion)
+	}
+	if fzIterations < 0 {
+		return fmt.Errorf("--iterations cannot be negative")
+	}
+	if fzCorpus == "" {
+		fzCorpus = filepath.Join(".testmqtt", "fuzz", "corpus-v"+fzVersion)
+	}
+	if !cmd.Flags().Changed("seed") {
+		fzSeed = rand.Uint64()
+	}
+
+	cfg := fuzz.Config{
+		Broker:        fzBroker,
+		Username:      fzUsername,
+		Password:      fzPassword,
+		Version:       level,
+		Seed:          fzSeed,
+		Duration:      fzDuration,
+		Iterations:    fzIterations,
+		SessionLength: fzSessionLength,
+		Timeout:       fzTimeout,
+		CorpusDir:     fzCorpus,
+		OutDir:        fzOut,
+		OnAnomaly: func(a fuzz.Anomaly) {
+			fmt.Printf("%s %s: %s\n", common.FailStyle.Render("✗ "+a.Kind), a.Detail, a.Path)
+		},
+		OnProgress: func(s fuzz.Stats) {
+			fmt.Printf("%s packets: %d (%.0f/s)  sessions: %d  closed: %d  corpus: %d  anomalies: %d\n",
+				common.SubtitleStyle.Render(time.Now().Format("15:04:05")),
+				s.Iterations, float64(s.Iterations)/s.Elapsed.Seconds(), s.Sessions, s.Closed, s.Corpus, s.Anomalies)
+		},
+	}
+
+	if fzReplay != "" {
+		return replayFuzz(cfg)
+	}
+
+	fmt.Printf("\n%s\n", common.TitleStyle.Render(fmt.Sprintf("MQTT v%s Protocol Fuzzer", fzVersion)))
+	fmt.Printf("%s\n", common.SubtitleStyle.Render(fmt.Sprintf("Broker: %s", cfg.Broker)))
+	fmt.Printf("%s\n\n", common.SubtitleStyle.Render(fmt.Sprintf("Seed %d, corpus %s (Ctrl+C to stop)", cfg.Seed, cfg.CorpusDir)))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := fuzz.Run(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Summary"))
+	fmt.Printf("  Stopped:   %s after %v\n", result.Stopped, result.Elapsed.Round(time.Second))
+	fmt.Printf("  Packets:   %d in %d sessions (%d closed by the broker)\n", result.Iterations, result.Sessions, result.Closed)
+	fmt.Printf("  Corpus:    %d packets\n", result.Corpus)
+	if len(result.Anomalies) == 0 {
+		fmt.Printf("  Anomalies: %s\n", common.PassStyle.Render("none"))
+		return nil
+	}
+	fmt.Printf("  Anomalies: %s\n", common.FailStyle.Render(fmt.Sprintf("%d", len(result.Anomalies))))
+	for _, a := range result.Anomalies {
+		fmt.Printf("    %s: %s\n", a.Kind, a.Path)
+	}
+	return verdictf("%d anomalies found, reproducers in %s", len(result.Anomalies), cfg.OutDir)
+}
+
+// replayFuzz sends the packets of the reproducer in --replay again
+func replayFuzz(cfg fuzz.Config) error {
+	rep, err := fuzz.ReadReproducer(fzReplay)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n%s\n", common.TitleStyle.Render("Replaying "+filepath.Base(fzReplay)))
+	fmt.Printf("%s\n\n", common.SubtitleStyle.Render(fmt.Sprintf("Broker: %s, %d packets, found as %s: %s", cfg.Broker, len(rep.Packets), rep.Anomaly, rep.Detail)))
+
+	anomaly, err := fuzz.Replay(cfg, rep)
+	if err != nil {
+		return err
+	}
+	if anomaly == nil {
+		fmt.Println(common.PassStyle.Render("✓ Does not reproduce"))
+		return nil
+	}
+	fmt.Printf("%s %s\n", common.FailStyle.Render("✗ Reproduces as "+anomaly.Kind+":"), anomaly.Detail)
+	return verdictf("reproducer still triggers %s", anomaly.Kind)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/bromq-dev/testmqtt/internal/history"
+	"github.com/spf13/cobra"
+)
+
+var (
+	histDB            string
+	histBroker        string
+	histBrokerVersion string
+	histSpec          string
+	histRuns          int
+	histAll           bool
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show conformance result trends",
+	Long: `Show the runs recorded with "conformance --history" and how each test's pass
+rate and duration developed across them, to spot creeping flakiness.`,
+	RunE:         runHistory,
+	SilenceUsage: true,
+}
+
+func init() {
+	historyCmd.Flags().StringVar(&histDB, "db", "testmqtt-history.db", "SQLite history database")
+	historyCmd.Flags().StringVarP(&histBroker, "broker", "b", "", "Only runs against this broker URL")
+	historyCmd.Flags().StringVar(&histBrokerVersion, "broker-version", "", "Only runs of this broker version")
+	historyCmd.Flags().StringVar(&histSpec, "spec", "", "Only runs of this spec version (3.1.1 or 5.0)")
+	historyCmd.Flags().IntVarP(&histRuns, "runs", "n", 20, "Number of most recent runs to show (0 for all)")
+	historyCmd.Flags().BoolVar(&histAll, "all", false, "List every test, not only failing or slowing ones")
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	db, err := history.Open(histDB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	runs, err := db.Runs(history.Filter{
+		Broker:        histBroker,
+		BrokerVersion: histBrokerVersion,
+		Spec:          histSpec,
+		Limit:         histRuns,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read runs: %w", err)
+	}
+	trends, err := db.Trends(runs)
+	if err != nil {
+		return fmt.Errorf("failed to read results: %w", err)
+	}
+
+	history.PrintHistory(runs, trends, histAll)
+	return nil
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/bromq-dev/testmqtt/internal/conformance"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lsVersion string
+	lsJSON    bool
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the conformance tests",
+	Long: `List every conformance test with its group, spec reference, normative level
+and tags, without connecting to a broker. Group names are what --tests selects.`,
+	RunE:         runList,
+	SilenceUsage: true,
+}
+
+func init() {
+	listCmd.Flags().StringVarP(&lsVersion, "version", "v", "all", "MQTT version (3, 5, sparkplug or all)")
+	listCmd.Flags().BoolVar(&lsJSON, "json", false, "Print the list as JSON")
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	return conformance.ListTests(lsVersion, lsJSON)
+}
@@ -1,11 +1,57 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/performance/bench"
+	"github.com/bromq-dev/testmqtt/performance/stress"
 	"github.com/spf13/cobra"
 )
 
+var (
+	benchBroker      string
+	benchUsername    string
+	benchPassword    string
+	benchScenario    string
+	benchTopic       string
+	benchMessages    int
+	benchPayloadSize int
+	benchQoS         int
+	benchPublishers  int
+	benchSubscribers int
+	benchRate        int
+	benchTimeout     time.Duration
+	benchTopicAlias  bool
+	benchShareGroup  string
+	benchDrop        bool
+	benchSysMetrics  bool
+	benchPrometheus  string
+	benchPromMetrics map[string]string
+
+	stressBroker      string
+	stressUsername    string
+	stressPassword    string
+	stressTopic       string
+	stressDuration    time.Duration
+	stressSoak        time.Duration
+	stressPublishers  int
+	stressSubscribers int
+	stressTopics      int
+	stressQoS         int
+	stressRate        int
+	stressPayloadSize int
+	stressInterval    time.Duration
+	stressCheckpoint  string
+)
+
 var performanceCmd = &cobra.Command{
 	Use:   "performance",
 	Short: "Run MQTT performance tests",
@@ -15,17 +61,67 @@ var performanceCmd = &cobra.Command{
 var perfStressCmd = &cobra.Command{
 	Use:   "stress",
 	Short: "Run stress test",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		return fmt.Errorf("performance stress tests not yet implemented")
-	},
+	Long: `Run a steady pub/sub workload against an MQTT v5 broker for a fixed time.
+
+Every subscriber receives every topic. Messages carry per-publisher sequence
+numbers, so loss and duplicates are detected exactly, and clients reconnect
+on their own when the broker drops them.
+
+Soak mode (--soak 8h) runs the same workload for hours, samples once a minute
+by default and tracks reconnects, loss, latency drift and the memory of the
+test process itself. Every sample is checkpointed to a JSON file so a crash
+of either side does not lose the results collected so far.`,
+	Example: `  # One minute of load from 100 publishers at 10 msg/s each
+  testmqtt performance stress --duration 60s --publishers 100 --subscribers 10 --topics 10 --qos 1
+
+  # Overnight soak test with checkpoints written to soak.json
+  testmqtt performance stress --soak 8h --publishers 20 --subscribers 5 --qos 1 --checkpoint soak.json`,
+	RunE:         runStress,
+	SilenceUsage: true,
 }
 
 var perfBenchCmd = &cobra.Command{
 	Use:   "bench",
 	Short: "Run benchmark test",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		return fmt.Errorf("performance benchmark tests not yet implemented")
-	},
+	Long: `Run a one-off benchmark against an MQTT v5 broker.
+
+Scenarios:
+  pubsub   1 publisher → 1 subscriber
+  fanout   1 publisher → N subscribers on the same topic (--subscribers)
+  fanin    N publishers → 1 subscriber (--publishers)
+  shared   1 publisher → K consumers in one $share group (--subscribers)
+
+Fan-out and fan-in report per-client delivery completeness and skew, which
+characterizes how evenly the broker routes under load. The shared scenario
+reports each consumer's share of the stream and, with --drop-consumer,
+whether messages in flight to a consumer that disconnects mid-stream are
+redelivered to the rest of the group.
+
+With --sys-metrics or --prometheus the report also shows broker-side
+connection counts, dropped messages and memory, sampled before the clients
+connect and again after the last delivery.`,
+	Example: `  # One-off benchmark
+  testmqtt performance bench --messages 10000 --payload-size 256 --qos 0
+
+  # 1 publisher → 50 subscribers
+  testmqtt performance bench --scenario fanout --subscribers 50 --messages 1000 --qos 1
+
+  # 100 publishers → 1 subscriber, 50 msg/s each
+  testmqtt performance bench --scenario fanin --publishers 100 --messages 500 --rate 50
+
+  # Shared subscription fairness with 4 consumers, one dropping out halfway
+  testmqtt performance bench --scenario shared --subscribers 4 --messages 20000 --qos 1 --drop-consumer
+
+  # Measure topic alias bandwidth savings on a long topic name
+  testmqtt performance bench --topic-alias --topic factory/line-4/cell-12/robot-7/telemetry
+
+  # Correlate with the broker's $SYS metrics
+  testmqtt performance bench --scenario fanout --subscribers 100 --qos 1 --sys-metrics
+
+  # Read broker metrics from a Prometheus endpoint, naming the memory metric
+  testmqtt performance bench --prometheus http://localhost:9090/metrics --prometheus-metric memory=go_memstats_heap_inuse_bytes`,
+	RunE:         runBench,
+	SilenceUsage: true,
 }
 
 var perfRoundCmd = &cobra.Command{
@@ -37,7 +133,141 @@ var perfRoundCmd = &cobra.Command{
 }
 
 func init() {
+	perfBenchCmd.Flags().StringVarP(&benchBroker, "broker", "b", "tcp://localhost:1883", "Broker URL")
+	perfBenchCmd.Flags().StringVarP(&benchUsername, "username", "u", "", "MQTT username")
+	perfBenchCmd.Flags().StringVarP(&benchPassword, "password", "p", "", "MQTT password")
+	perfBenchCmd.Flags().StringVarP(&benchScenario, "scenario", "s", bench.ScenarioPubSub, "Scenario (pubsub, fanout, fanin, shared)")
+	perfBenchCmd.Flags().StringVarP(&benchTopic, "topic", "t", "", "Topic to publish on (generated if empty)")
+	perfBenchCmd.Flags().IntVarP(&benchMessages, "messages", "m", 10000, "Messages sent by each publisher")
+	perfBenchCmd.Flags().IntVar(&benchPayloadSize, "payload-size", 256, "Payload size in bytes (minimum 16)")
+	perfBenchCmd.Flags().IntVarP(&benchQoS, "qos", "q", 0, "QoS level (0, 1, 2)")
+	perfBenchCmd.Flags().IntVar(&benchPublishers, "publishers", 10, "Number of publishers (fanin)")
+	perfBenchCmd.Flags().IntVar(&benchSubscribers, "subscribers", 10, "Number of subscribers (fanout, shared)")
+	perfBenchCmd.Flags().StringVar(&benchShareGroup, "share-group", "testmqtt-bench", "Share name for the shared scenario")
+	perfBenchCmd.Flags().BoolVar(&benchDrop, "drop-consumer", false, "Abruptly disconnect one shared consumer halfway through the stream (shared only)")
+	perfBenchCmd.Flags().IntVar(&benchRate, "rate", 0, "Messages per second per publisher (0 = unlimited)")
+	perfBenchCmd.Flags().BoolVar(&benchTopicAlias, "topic-alias", false, "Publish with topic aliases when the broker supports them")
+	perfBenchCmd.Flags().DurationVar(&benchTimeout, "timeout", 10*time.Second, "Stop waiting for deliveries after this long without progress")
+	perfBenchCmd.Flags().BoolVar(&benchSysMetrics, "sys-metrics", false, "Report broker connections, dropped messages and memory from $SYS topics")
+	perfBenchCmd.Flags().StringVar(&benchPrometheus, "prometheus", "", "Report broker metrics scraped from this Prometheus endpoint instead of $SYS")
+	perfBenchCmd.Flags().StringToStringVar(&benchPromMetrics, "prometheus-metric", nil, "Prometheus metric to read for connections, dropped or memory (e.g. memory=process_resident_memory_bytes)")
+
+	perfStressCmd.Flags().StringVarP(&stressBroker, "broker", "b", "tcp://localhost:1883", "Broker URL")
+	perfStressCmd.Flags().StringVarP(&stressUsername, "username", "u", "", "MQTT username")
+	perfStressCmd.Flags().StringVarP(&stressPassword, "password", "p", "", "MQTT password")
+	perfStressCmd.Flags().StringVarP(&stressTopic, "topic", "t", "", "Topic prefix (generated if empty)")
+	perfStressCmd.Flags().DurationVarP(&stressDuration, "duration", "d", 60*time.Second, "How long to run the workload")
+	perfStressCmd.Flags().DurationVar(&stressSoak, "soak", 0, "Run a soak test for this long (e.g. 8h), overrides --duration")
+	perfStressCmd.Flags().IntVar(&stressPublishers, "publishers", 10, "Number of publishers")
+	perfStressCmd.Flags().IntVar(&stressSubscribers, "subscribers", 10, "Number of subscribers")
+	perfStressCmd.Flags().IntVar(&stressTopics, "topics", 10, "Number of topics publishers are spread across")
+	perfStressCmd.Flags().IntVarP(&stressQoS, "qos", "q", 0, "QoS level (0, 1, 2)")
+	perfStressCmd.Flags().IntVar(&stressRate, "rate", 10, "Messages per second per publisher")
+	perfStressCmd.Flags().IntVar(&stressPayloadSize, "payload-size", 256, "Payload size in bytes (minimum 16)")
+	perfStressCmd.Flags().DurationVar(&stressInterval, "interval", 0, "Sample interval (default 5s, 1m in soak mode)")
+	perfStressCmd.Flags().StringVar(&stressCheckpoint, "checkpoint", "", "Checkpoint file rewritten after every sample (soak default: testmqtt-soak-<time>.json)")
+
 	performanceCmd.AddCommand(perfStressCmd)
 	performanceCmd.AddCommand(perfBenchCmd)
 	performanceCmd.AddCommand(perfRoundCmd)
 }
+
+func runBench(cmd *cobra.Command, args []string) error {
+	if benchQoS < 0 || benchQoS > 2 {
+		return fmt.Errorf("invalid QoS: %d (supported: 0, 1, 2)", benchQoS)
+	}
+	for q := range benchPromMetrics {
+		if !slices.Contains(bench.Metrics, q) {
+			return fmt.Errorf("unknown broker metric: %s (supported: %s)", q, strings.Join(bench.Metrics, ", "))
+		}
+	}
+
+	cfg := bench.Config{
+		Broker:      benchBroker,
+		Username:    benchUsername,
+		Password:    benchPassword,
+		Scenario:    benchScenario,
+		Topic:       benchTopic,
+		Messages:    benchMessages,
+		PayloadSize: benchPayloadSize,
+		QoS:         byte(benchQoS),
+		Publishers:  benchPublishers,
+		Subscribers: benchSubscribers,
+		Rate:        benchRate,
+		Timeout:     benchTimeout,
+		TopicAlias:  benchTopicAlias,
+
+		ShareGroup:   benchShareGroup,
+		DropConsumer: benchDrop,
+
+		SysMetrics:        benchSysMetrics,
+		PrometheusURL:     benchPrometheus,
+		PrometheusMetrics: benchPromMetrics,
+	}
+
+	fmt.Printf("\n%s\n", common.TitleStyle.Render("MQTT v5 Benchmark"))
+	fmt.Printf("%s\n", common.SubtitleStyle.Render(fmt.Sprintf("Broker: %s", cfg.Broker)))
+	fmt.Printf("%s\n", common.SubtitleStyle.Render(fmt.Sprintf("Scenario: %s  QoS: %d  Payload: %d bytes", cfg.Scenario, cfg.QoS, cfg.PayloadSize)))
+
+	result, err := bench.Run(cfg)
+	if err != nil {
+		return err
+	}
+
+	bench.PrintReport(cfg, result)
+	return nil
+}
+
+func runStress(cmd *cobra.Command, args []string) error {
+	if stressQoS < 0 || stressQoS > 2 {
+		return fmt.Errorf("invalid QoS: %d (supported: 0, 1, 2)", stressQoS)
+	}
+
+	cfg := stress.Config{
+		Broker:      stressBroker,
+		Username:    stressUsername,
+		Password:    stressPassword,
+		Topic:       stressTopic,
+		Duration:    stressDuration,
+		Publishers:  stressPublishers,
+		Subscribers: stressSubscribers,
+		Topics:      stressTopics,
+		QoS:         byte(stressQoS),
+		Rate:        stressRate,
+		PayloadSize: stressPayloadSize,
+		Interval:    stressInterval,
+		Checkpoint:  stressCheckpoint,
+		OnSample:    stress.PrintSample,
+	}
+
+	title := "MQTT v5 Stress Test"
+	if stressSoak > 0 {
+		title = "MQTT v5 Soak Test"
+		cfg.Duration = stressSoak
+		if cfg.Interval <= 0 {
+			cfg.Interval = time.Minute
+		}
+		if cfg.Checkpoint == "" {
+			cfg.Checkpoint = fmt.Sprintf("testmqtt-soak-%s.json", time.Now().Format("20060102-150405"))
+		}
+	}
+
+	fmt.Printf("\n%s\n", common.TitleStyle.Render(title))
+	fmt.Printf("%s\n", common.SubtitleStyle.Render(fmt.Sprintf("Broker: %s", cfg.Broker)))
+	fmt.Printf("%s\n", common.SubtitleStyle.Render(fmt.Sprintf("Duration: %v  Publishers: %d  Subscribers: %d  Topics: %d  QoS: %d  Rate: %d msg/s",
+		cfg.Duration, cfg.Publishers, cfg.Subscribers, cfg.Topics, cfg.QoS, cfg.Rate)))
+	if cfg.Checkpoint != "" {
+		fmt.Printf("%s\n", common.SubtitleStyle.Render(fmt.Sprintf("Checkpoint: %s", cfg.Checkpoint)))
+	}
+	fmt.Println()
+
+	// Ctrl+C stops the run early but still reports what was collected
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := stress.Run(ctx, cfg)
+	if result != nil {
+		stress.PrintReport(result)
+	}
+	return err
+}
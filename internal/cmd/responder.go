@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	v5 "github.com/bromq-dev/testmqtt/conformance/v5"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/spf13/cobra"
+)
+
+var (
+	respBroker   string
+	respUsername string
+	respPassword string
+	respTopic    string
+	respQoS      int
+	respDelay    time.Duration
+	respClientID string
+	respVerbose  bool
+)
+
+var responderCmd = &cobra.Command{
+	Use:   "responder",
+	Short: "Run an MQTT v5 request/response echo service",
+	Long: `Run a responder that subscribes to a request topic and echoes every
+payload to the request's Response Topic, preserving the Correlation Data.
+This is useful when testing client applications that implement the MQTT v5
+request/response pattern. Requests without a Response Topic are ignored.`,
+	Example: `  # Echo requests on service/echo
+  testmqtt responder --broker tcp://localhost:1883 --topic service/echo
+
+  # Echo all requests below rpc/ with QoS 1 and a 50ms processing delay
+  testmqtt responder --topic "rpc/#" --qos 1 --delay 50ms --verbose`,
+	RunE:         runResponder,
+	SilenceUsage: true,
+}
+
+func init() {
+	responderCmd.Flags().StringVarP(&respBroker, "broker", "b", "tcp://localhost:1883", "Broker URL")
+	responderCmd.Flags().StringVarP(&respUsername, "username", "u", "", "MQTT username")
+	responderCmd.Flags().StringVarP(&respPassword, "password", "p", "", "MQTT password")
+	responderCmd.Flags().StringVarP(&respTopic, "topic", "t", "testmqtt/request/#", "Request topic filter to subscribe to")
+	responderCmd.Flags().IntVarP(&respQoS, "qos", "q", 1, "QoS for request subscription and replies (0, 1, 2)")
+	responderCmd.Flags().DurationVar(&respDelay, "delay", 0, "Artificial processing delay before each reply")
+	responderCmd.Flags().StringVar(&respClientID, "client-id", "", "Client ID (generated if empty)")
+	responderCmd.Flags().BoolVar(&respVerbose, "verbose", false, "Log each request being answered")
+}
+
+func runResponder(cmd *cobra.Command, args []string) error {
+	if respQoS < 0 || respQoS > 2 {
+		return fmt.Errorf("invalid QoS: %d (supported: 0, 1, 2)", respQoS)
+	}
+
+	cfg := common.Config{
+		Broker:   respBroker,
+		Username: respUsername,
+		Password: respPassword,
+	}
+
+	rc := v5.ResponderConfig{
+		RequestTopic: respTopic,
+		QoS:          byte(respQoS),
+		Delay:        respDelay,
+		ClientID:     respClientID,
+	}
+	if respVerbose {
+		rc.OnRequest = func(req *paho.Publish) {
+			fmt.Printf("%s [%s] → [%s] %d bytes, correlation: %x\n",
+				common.SubtitleStyle.Render(time.Now().Format("15:04:05.000")),
+				req.Topic,
+				req.Properties.ResponseTopic,
+				len(req.Payload),
+				req.Properties.CorrelationData)
+		}
+	}
+
+	fmt.Printf("\n%s\n", common.TitleStyle.Render("MQTT v5 Request/Response Echo Service"))
+	fmt.Printf("%s\n", common.SubtitleStyle.Render(fmt.Sprintf("Broker: %s", cfg.Broker)))
+
+	responder, err := v5.StartResponder(cfg, rc)
+	if err != nil {
+		return err
+	}
+	defer responder.Stop()
+
+	fmt.Printf("%s\n\n", common.PassStyle.Render(fmt.Sprintf("✓ Listening for requests on: %s (Ctrl+C to stop)", respTopic)))
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var lastHandled uint64
+	for {
+		select {
+		case <-sigChan:
+			fmt.Printf("\n%s Total: %d answered, %d ignored, %d errors\n",
+				common.PassStyle.Render("✓"), responder.Handled(), responder.Ignored(), responder.Errors())
+			return nil
+
+		case <-ticker.C:
+			handled := responder.Handled()
+			if handled != lastHandled || respVerbose {
+				fmt.Printf("%s answered: %d (+%d)  ignored: %d  errors: %d\n",
+					common.SubtitleStyle.Render(time.Now().Format("2006-01-02 15:04:05")),
+					handled, handled-lastHandled, responder.Ignored(), responder.Errors())
+			}
+			lastHandled = handled
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"github.com/bromq-dev/testmqtt/conformance/common"
 	"github.com/spf13/cobra"
 )
 
@@ -11,16 +12,39 @@ var rootCmd = &cobra.Command{
 - Conformance testing for MQTT 3.1.1 and MQTT 5.0
 - Performance benchmarking
 - Stress testing
-- Traffic simulation (bridge messages between brokers)`,
+- Traffic simulation (bridge messages between brokers)
+- Request/response echo service for testing client applications
+- Protocol fuzzing with mutated packets`,
 	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfigFile(cmd, args); err != nil {
+			return err
+		}
+		if plainOutput || common.PlainOutputRequested() {
+			common.UsePlainOutput()
+		}
+		return nil
+	},
 }
 
+var plainOutput bool
+
 func Execute() error {
 	return rootCmd.Execute()
 }
 
 func init() {
+	rootCmd.PersistentFlags().BoolVar(&plainOutput, "plain", false, "Plain output without colors or styling, for CI logs (also set by NO_COLOR or TERM=dumb)")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file with defaults for the flags (default ./testmqtt.yaml if present)")
+
 	rootCmd.AddCommand(conformanceCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(coverageCmd)
+	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(cleanupCmd)
 	rootCmd.AddCommand(performanceCmd)
 	rootCmd.AddCommand(simCmd)
+	rootCmd.AddCommand(responderCmd)
+	rootCmd.AddCommand(fuzzCmd)
 }
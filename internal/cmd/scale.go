@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/performance/scale"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scaleBroker      string
+	scaleUsername    string
+	scalePassword    string
+	scaleTopic       string
+	scaleClients     int
+	scaleMessages    int
+	scaleTopics      int
+	scalePayloadSize int
+	scaleConcurrency int
+	scaleTimeout     time.Duration
+)
+
+var perfScaleCmd = &cobra.Command{
+	Use:   "scale",
+	Short: "Run broker state scale tests",
+	Long: `Run scale tests that exercise how the broker stores and replays state
+for large numbers of clients, rather than raw message throughput.`,
+}
+
+var scaleSessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Offline sessions with queued QoS 1 backlog",
+	Long: `Create many persistent sessions, disconnect them, publish a QoS 1 backlog
+to each one while offline, then reconnect every session and measure how
+completely and how quickly the broker delivers the queued messages.
+
+Sessions are removed from the broker at the end of the run.`,
+	Example: `  # 5000 sessions with 20 queued messages each
+  testmqtt performance scale sessions --clients 5000 --messages 20`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runScale("Offline Session Scale Test", scale.RunSessions)
+	},
+	SilenceUsage: true,
+}
+
+var scaleWillsCmd = &cobra.Command{
+	Use:   "wills",
+	Short: "Will storm from abruptly severed clients",
+	Long: `Connect many clients that each carry a Will Message, then sever all of
+their connections at once with a TCP RST. An observer subscribed to every
+will topic verifies that the broker publishes the complete will storm and
+measures how long delivery takes.`,
+	Example: `  # 10000 clients severed at once
+  testmqtt performance scale wills --clients 10000`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runScale("Will Storm Scale Test", scale.RunWills)
+	},
+	SilenceUsage: true,
+}
+
+var scaleRetainedCmd = &cobra.Command{
+	Use:   "retained",
+	Short: "Retained message store flushed to wildcard subscriptions",
+	Long: `Store retained messages on many distinct topics, then subscribe with broad
+wildcard filters (#, +/+, +/#) and verify that every retained message is
+delivered exactly once per matching subscription, with timing for the flush.
+
+The retained messages are cleared at the end of the run.`,
+	Example: `  # 50000 retained topics
+  testmqtt performance scale retained --topics 50000`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runScale("Retained Store Scale Test", scale.RunRetained)
+	},
+	SilenceUsage: true,
+}
+
+func init() {
+	perfScaleCmd.PersistentFlags().StringVarP(&scaleBroker, "broker", "b", "tcp://localhost:1883", "Broker URL")
+	perfScaleCmd.PersistentFlags().StringVarP(&scaleUsername, "username", "u", "", "MQTT username")
+	perfScaleCmd.PersistentFlags().StringVarP(&scalePassword, "password", "p", "", "MQTT password")
+	perfScaleCmd.PersistentFlags().StringVarP(&scaleTopic, "topic", "t", "", "Topic prefix (generated if empty)")
+	perfScaleCmd.PersistentFlags().IntVar(&scalePayloadSize, "payload-size", 64, "Payload size in bytes (minimum 8)")
+	perfScaleCmd.PersistentFlags().IntVar(&scaleConcurrency, "concurrency", 100, "Clients connected in parallel")
+	perfScaleCmd.PersistentFlags().DurationVar(&scaleTimeout, "timeout", 30*time.Second, "Stop waiting for deliveries after this long without progress")
+
+	scaleSessionsCmd.Flags().IntVarP(&scaleClients, "clients", "c", 1000, "Number of sessions")
+	scaleWillsCmd.Flags().IntVarP(&scaleClients, "clients", "c", 1000, "Number of clients with Will Messages")
+	scaleRetainedCmd.Flags().IntVar(&scaleTopics, "topics", 10000, "Number of distinct retained topics")
+	scaleSessionsCmd.Flags().IntVarP(&scaleMessages, "messages", "m", 10, "Queued messages per session")
+
+	perfScaleCmd.AddCommand(scaleSessionsCmd)
+	perfScaleCmd.AddCommand(scaleWillsCmd)
+	perfScaleCmd.AddCommand(scaleRetainedCmd)
+	performanceCmd.AddCommand(perfScaleCmd)
+}
+
+func runScale(title string, run func(scale.Config) (*scale.Result, error)) error {
+	cfg := scale.Config{
+		Broker:      scaleBroker,
+		Username:    scaleUsername,
+		Password:    scalePassword,
+		Topic:       scaleTopic,
+		Clients:     scaleClients,
+		Messages:    scaleMessages,
+		Topics:      scaleTopics,
+		PayloadSize: scalePayloadSize,
+		Concurrency: scaleConcurrency,
+		Timeout:     scaleTimeout,
+		OnPhase: func(phase string) {
+			fmt.Printf("%s %s\n", common.SubtitleStyle.Render(time.Now().Format("15:04:05")), phase)
+		},
+	}
+
+	fmt.Printf("\n%s\n", common.TitleStyle.Render("MQTT v5 "+title))
+	fmt.Printf("%s\n\n", common.SubtitleStyle.Render(fmt.Sprintf("Broker: %s", cfg.Broker)))
+
+	result, err := run(cfg)
+	if err != nil {
+		return err
+	}
+
+	scale.PrintReport(result)
+	return nil
+}
@@ -23,6 +23,7 @@ var (
 	simQueueSize      int
 	simTimeout        time.Duration
 	simUnixTimestamp  bool
+	simTopicAlias     bool
 )
 
 var simCmd = &cobra.Command{
@@ -64,6 +65,7 @@ func init() {
 	simCmd.Flags().IntVar(&simQueueSize, "queue-size", 1000, "Max concurrent publishes in flight")
 	simCmd.Flags().DurationVar(&simTimeout, "timeout", 100*time.Millisecond, "Publish timeout (drops if exceeded)")
 	simCmd.Flags().BoolVar(&simUnixTimestamp, "unix-ts", false, "Use unix timestamp instead of datetime")
+	simCmd.Flags().BoolVar(&simTopicAlias, "topic-alias", false, "Republish with topic aliases when the target broker supports them (v5 only)")
 }
 
 func runSim(cmd *cobra.Command, args []string) error {
@@ -81,6 +83,7 @@ func runSim(cmd *cobra.Command, args []string) error {
 		QueueSize:      simQueueSize,
 		Timeout:        simTimeout,
 		UnixTimestamp:  simUnixTimestamp,
+		TopicAlias:     simTopicAlias,
 	}
 
 	switch simVersion {
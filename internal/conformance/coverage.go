@@ -0,0 +1,39 @@
+package conformance
+
+import (
+	"fmt"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	v3 "github.com/bromq-dev/testmqtt/conformance/v3"
+	v5 "github.com/bromq-dev/testmqtt/conformance/v5"
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// PrintCoverage reports which normative statements of the MQTT specification
+// are exercised by the registered conformance tests
+func PrintCoverage(version string, gaps bool) error {
+	type suite struct {
+		title  string
+		spec   string
+		groups []common.TestGroup
+	}
+	var suites []suite
+	if version == "3" || version == "all" {
+		suites = append(suites, suite{"MQTT v3.1.1 Spec Coverage", spec.V311, v3.AllTestGroups()})
+	}
+	if version == "5" || version == "all" {
+		suites = append(suites, suite{"MQTT v5.0 Spec Coverage", spec.V5, v5.AllTestGroups()})
+	}
+	if len(suites) == 0 {
+		return fmt.Errorf("unsupported MQTT version: %s (supported: 3, 5, all)", version)
+	}
+
+	for _, s := range suites {
+		refs, err := common.CollectTestRefs(s.groups)
+		if err != nil {
+			return err
+		}
+		common.PrintCoverage(s.title, common.BuildCoverage(s.spec, refs), gaps)
+	}
+	return nil
+}
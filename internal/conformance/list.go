@@ -0,0 +1,104 @@
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/conformance/sparkplug"
+	v3 "github.com/bromq-dev/testmqtt/conformance/v3"
+	v5 "github.com/bromq-dev/testmqtt/conformance/v5"
+	"github.com/bromq-dev/testmqtt/spec"
+)
+
+// ListedTest is one entry of the test list
+type ListedTest struct {
+	Version string   `json:"version"`
+	Group   string   `json:"group"`
+	Name    string   `json:"name"`
+	SpecRef string   `json:"spec_ref,omitempty"`
+	Level   string   `json:"level"`
+	Tags    []string `json:"tags"`
+}
+
+// ListTests prints every registered test with its group, spec reference,
+// normative level and tags, without connecting to a broker
+func ListTests(version string, asJSON bool) error {
+	type suite struct {
+		title string
+		spec  string
+		s     common.Suite
+	}
+	var suites []suite
+	if version == "3" || version == "all" {
+		suites = append(suites, suite{"MQTT v3.1.1 Tests", spec.V311, v3.Suite()})
+	}
+	if version == "5" || version == "all" {
+		suites = append(suites, suite{"MQTT v5.0 Tests", spec.V5, v5.Suite()})
+	}
+	if version == "sparkplug" || version == "all" {
+		suites = append(suites, suite{"Sparkplug B 3.0 Tests", sparkplug.Spec, sparkplug.Suite()})
+	}
+	if len(suites) == 0 {
+		return fmt.Errorf("unsupported MQTT version: %s (supported: 3, 5, sparkplug, all)", version)
+	}
+
+	var all []ListedTest
+	for _, s := range suites {
+		refs, err := common.CollectTestRefs(s.s.Groups)
+		if err != nil {
+			return err
+		}
+
+		var tests []ListedTest
+		for _, ref := range refs {
+			level := ref.Level
+			if level == spec.LevelUnknown {
+				level = spec.LevelOf(s.spec, ref.SpecRef)
+			}
+			tags := append([]string{}, ref.Tags...)
+			if level != spec.LevelUnknown {
+				tags = append(tags, strings.ToLower(level.String()))
+			}
+			tests = append(tests, ListedTest{
+				Version: s.spec,
+				Group:   ref.Group,
+				Name:    ref.Name,
+				SpecRef: ref.SpecRef,
+				Level:   level.String(),
+				Tags:    tags,
+			})
+		}
+		all = append(all, tests...)
+
+		if !asJSON {
+			printTestList(s.title, tests)
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(all)
+	}
+	return nil
+}
+
+func printTestList(title string, tests []ListedTest) {
+	fmt.Printf("\n%s\n", common.TitleStyle.Render(title))
+	group := ""
+	for _, t := range tests {
+		if t.Group != group {
+			group = t.Group
+			fmt.Printf("\n%s\n", common.GroupStyle.Render(group))
+		}
+		ref := t.SpecRef
+		if ref == "" {
+			ref = "-"
+		}
+		fmt.Printf("  %-52s %-18s %s\n", t.Name, ref, common.DetailStyle.Render(strings.Join(t.Tags, ", ")))
+	}
+	fmt.Printf("\n%d tests\n", len(tests))
+}
@@ -0,0 +1,62 @@
+package conformance
+
+import (
+	"fmt"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/conformance/sparkplug"
+	v3 "github.com/bromq-dev/testmqtt/conformance/v3"
+	v5 "github.com/bromq-dev/testmqtt/conformance/v5"
+)
+
+// RerunFailed runs only the tests that failed in prior, of the groups
+// selected by tests, and returns their results merged into prior. The
+// report is nil if no test is left to run.
+func RerunFailed(version string, cfg common.Config, tests string, verbose bool, prior *common.Report) (*common.Report, error) {
+	suite, err := Suite(version)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := prior.FailedTests()
+	groups, err := common.SelectTests(suite.Groups, func(ref common.TestRef) bool {
+		return failed[common.TestID{Group: ref.Group, Name: ref.Name}] && common.ShouldRunGroup(ref.Group, tests)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	suite.Groups = groups
+
+	rerun, err := common.RunSuite(suite, cfg, tests, verbose)
+	if rerun == nil {
+		return nil, err
+	}
+	merged := common.MergeReports(prior, rerun)
+
+	counts := merged.Counts()
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Merged with the last run"))
+	fmt.Printf("  Total:  %d (%d rerun)\n", len(merged.Results), len(rerun.Results))
+	fmt.Printf("  Passed: %s\n", common.PassStyle.Render(fmt.Sprintf("%d", counts[common.StatusPassed])))
+	if n := counts[common.StatusFailed]; n > 0 {
+		fmt.Printf("  Failed: %s\n", common.FailStyle.Render(fmt.Sprintf("%d", n)))
+		return merged, &common.FailedError{Failed: n}
+	}
+	return merged, nil
+}
+
+// Suite returns the conformance suite for an MQTT version
+func Suite(version string) (common.Suite, error) {
+	switch version {
+	case "5":
+		return v5.Suite(), nil
+	case "3":
+		return v3.Suite(), nil
+	case "sparkplug":
+		return sparkplug.Suite(), nil
+	default:
+		return common.Suite{}, fmt.Errorf("unsupported MQTT version: %s (supported: 3, 5, sparkplug)", version)
+	}
+}
@@ -0,0 +1,16 @@
+package conformance
+
+import (
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/conformance/sparkplug"
+)
+
+// RunSparkplugTests executes Sparkplug B conformance tests
+func RunSparkplugTests(cfg common.Config, tests string, verbose bool) (*common.Report, error) {
+	return sparkplug.RunTests(cfg, tests, verbose)
+}
+
+// CleanupSparkplug removes retained messages left by a Sparkplug B run
+func CleanupSparkplug(cfg common.Config, clientIDs []string) (*common.CleanupResult, error) {
+	return sparkplug.Cleanup(cfg, clientIDs)
+}
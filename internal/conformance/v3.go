@@ -6,11 +6,11 @@ import (
 )
 
 // RunV3Tests executes MQTT v3.1.1 conformance tests
-func RunV3Tests(broker, username, password, tests string, verbose bool) error {
-	cfg := common.Config{
-		Broker:   broker,
-		Username: username,
-		Password: password,
-	}
+func RunV3Tests(cfg common.Config, tests string, verbose bool) (*common.Report, error) {
 	return v3.RunTests(cfg, tests, verbose)
 }
+
+// CleanupV3 removes retained messages and sessions left by an MQTT v3.1.1 run
+func CleanupV3(cfg common.Config, clientIDs []string) (*common.CleanupResult, error) {
+	return v3.Cleanup(cfg, clientIDs)
+}
@@ -6,11 +6,11 @@ import (
 )
 
 // RunV5Tests executes MQTT v5 conformance tests
-func RunV5Tests(broker, username, password, tests string, verbose bool) error {
-	cfg := common.Config{
-		Broker:   broker,
-		Username: username,
-		Password: password,
-	}
+func RunV5Tests(cfg common.Config, tests string, verbose bool) (*common.Report, error) {
 	return v5.RunTests(cfg, tests, verbose)
 }
+
+// CleanupV5 removes retained messages and sessions left by an MQTT v5 run
+func CleanupV5(cfg common.Config, clientIDs []string) (*common.CleanupResult, error) {
+	return v5.Cleanup(cfg, clientIDs)
+}
@@ -0,0 +1,417 @@
+// Package docker provisions throwaway MQTT brokers in containers through the
+// Docker Engine API, so the test suites can run without a broker set up by hand
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Preset holds the settings a well known broker image needs to accept
+// anonymous connections from the host
+type Preset struct {
+	Image string   // Repository to pull, e.g. "eclipse-mosquitto"
+	Port  int      // MQTT port inside the container
+	Cmd   []string // Command override, nil for the image default
+	Env   []string
+}
+
+// presets are keyed by the repository name given on the command line
+var presets = map[string]Preset{
+	"mosquitto": {
+		Image: "eclipse-mosquitto",
+		Port:  1883,
+		// Mosquitto 2 only listens on loopback unless configured otherwise
+		Cmd: []string{"mosquitto", "-c", "/mosquitto-no-auth.conf"},
+	},
+	"emqx": {
+		Image: "emqx/emqx",
+		Port:  1883,
+		Env: []string{
+			"EMQX_LISTENERS__TCP__DEFAULT__AUTHN=none",
+			"EMQX_LISTENERS__TCP__DEFAULT__AUTHZ=none",
+		},
+	},
+	"hivemq": {Image: "hivemq/hivemq-ce", Port: 1883},
+	"nanomq": {Image: "emqx/nanomq", Port: 1883},
+	"vernemq": {
+		Image: "vernemq/vernemq",
+		Port:  1883,
+		Env: []string{
+			"DOCKER_VERNEMQ_ACCEPT_EULA=yes",
+			"DOCKER_VERNEMQ_ALLOW_ANONYMOUS=on",
+		},
+	},
+}
+
+func init() {
+	// Allow the full repository names as well
+	for _, name := range []string{"mosquitto", "emqx", "hivemq", "nanomq", "vernemq"} {
+		presets[presets[name].Image] = presets[name]
+	}
+}
+
+// Options configures a broker container
+type Options struct {
+	Port         int           // MQTT port inside the container, 0 for the preset or 1883
+	ReadyTimeout time.Duration // How long to wait for the broker to answer a CONNECT
+
+	// OnStatus is called as the broker moves through pull, start and readiness
+	OnStatus func(status string)
+}
+
+// Broker is a running broker container
+type Broker struct {
+	ID    string
+	Image string
+	URL   string // Broker URL on the host, e.g. tcp://127.0.0.1:49153
+
+	addr         string
+	readyTimeout time.Duration
+	client       *client
+}
+
+// Start pulls image if needed, starts it with its MQTT port published on a
+// free loopback port and waits until the broker answers an MQTT CONNECT
+func Start(ctx context.Context, image string, opts Options) (*Broker, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	if opts.ReadyTimeout <= 0 {
+		opts.ReadyTimeout = 60 * time.Second
+	}
+	status := func(format string, args ...any) {
+		if opts.OnStatus != nil {
+			opts.OnStatus(fmt.Sprintf(format, args...))
+		}
+	}
+
+	repo, tag := splitImage(image)
+	preset, ok := presets[repo]
+	if ok {
+		repo = preset.Image
+	}
+	image = repo + ":" + tag
+	port := opts.Port
+	if port == 0 {
+		port = preset.Port
+	}
+	if port == 0 {
+		port = 1883
+	}
+
+	if err := c.do(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil); err != nil {
+		if !isNotFound(err) {
+			return nil, fmt.Errorf("failed to inspect image: %w", err)
+		}
+		status("Pulling %s", image)
+		if err := c.pull(ctx, repo, tag); err != nil {
+			return nil, fmt.Errorf("failed to pull %s: %w", image, err)
+		}
+	}
+
+	// Docker picks a new port for an empty HostPort on every start, so pick
+	// one here to keep the URL across restarts
+	hostPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	containerPort := fmt.Sprintf("%d/tcp", port)
+	create := map[string]any{
+		"Image":        image,
+		"Env":          preset.Env,
+		"ExposedPorts": map[string]any{containerPort: struct{}{}},
+		"Labels":       map[string]string{"testmqtt": "broker"},
+		"HostConfig": map[string]any{
+			"PortBindings": map[string]any{
+				containerPort: []map[string]string{{"HostIp": "127.0.0.1", "HostPort": hostPort}},
+			},
+		},
+	}
+	if preset.Cmd != nil {
+		create["Cmd"] = preset.Cmd
+	}
+	var created struct{ Id string }
+	if err := c.do(ctx, http.MethodPost, "/containers/create", create, &created); err != nil {
+		return nil, fmt.Errorf("failed to create container: %w", err)
+	}
+	b := &Broker{ID: created.Id, Image: image, readyTimeout: opts.ReadyTimeout, client: c}
+
+	status("Starting %s (%.12s)", image, b.ID)
+	if err := c.do(ctx, http.MethodPost, "/containers/"+b.ID+"/start", nil, nil); err != nil {
+		b.Stop(context.Background())
+		return nil, fmt.Errorf("failed to start container: %w", err)
+	}
+
+	var inspect struct {
+		State struct {
+			Running  bool
+			ExitCode int
+		}
+		NetworkSettings struct {
+			Ports map[string][]struct{ HostIp, HostPort string }
+		}
+	}
+	if err := c.do(ctx, http.MethodGet, "/containers/"+b.ID+"/json", nil, &inspect); err != nil {
+		b.Stop(context.Background())
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	bindings := inspect.NetworkSettings.Ports[containerPort]
+	if len(bindings) == 0 {
+		b.Stop(context.Background())
+		return nil, fmt.Errorf("container port %s was not published", containerPort)
+	}
+	b.addr = net.JoinHostPort("127.0.0.1", bindings[0].HostPort)
+	b.URL = "tcp://" + b.addr
+
+	status("Waiting for broker on %s", b.URL)
+	if err := b.waitReady(ctx, b.addr, opts.ReadyTimeout); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+// freePort returns a loopback port nothing listens on
+func freePort() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer ln.Close()
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	return port, err
+}
+
+// Restart stops the broker, giving it 10 seconds to shut down cleanly and
+// save its state, starts it again and waits until it answers a CONNECT on
+// the same URL
+func (b *Broker) Restart(ctx context.Context) error {
+	if err := b.client.do(ctx, http.MethodPost, "/containers/"+b.ID+"/restart?t=10", nil, nil); err != nil {
+		return fmt.Errorf("failed to restart container: %w", err)
+	}
+	return b.waitReady(ctx, b.addr, b.readyTimeout)
+}
+
+// waitReady polls until the broker answers a CONNECT with a CONNACK. The port
+// accepts TCP connections as soon as Docker publishes it, long before the
+// broker inside is listening, so a TCP dial alone is not enough.
+func (b *Broker) waitReady(ctx context.Context, addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := probe(addr); err == nil {
+			return nil
+		} else if time.Now().After(deadline) {
+			return fmt.Errorf("broker not ready after %v: %w", timeout, err)
+		}
+
+		var state struct{ State struct{ Running bool } }
+		if err := b.client.do(ctx, http.MethodGet, "/containers/"+b.ID+"/json", nil, &state); err == nil && !state.State.Running {
+			return fmt.Errorf("broker container exited during startup")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// probe sends a minimal MQTT 3.1.1 CONNECT and expects a CONNACK back
+func probe(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	clientID := "testmqtt-probe"
+	connect := []byte{0x10, byte(12 + len(clientID)), 0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x0a, 0x00, byte(len(clientID))}
+	connect = append(connect, clientID...)
+	if _, err := conn.Write(connect); err != nil {
+		return err
+	}
+
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connack); err != nil {
+		return err
+	}
+	if connack[0] != 0x20 {
+		return fmt.Errorf("unexpected packet 0x%02x instead of CONNACK", connack[0])
+	}
+	return nil
+}
+
+// Logs returns the combined stdout and stderr of the container
+func (b *Broker) Logs(ctx context.Context) (string, error) {
+	resp, err := b.client.request(ctx, http.MethodGet, "/containers/"+b.ID+"/logs?stdout=1&stderr=1&timestamps=1", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return demux(raw), nil
+}
+
+// Stop removes the container along with its anonymous volumes
+func (b *Broker) Stop(ctx context.Context) error {
+	return b.client.do(ctx, http.MethodDelete, "/containers/"+b.ID+"?force=1&v=1", nil, nil)
+}
+
+// demux strips the 8 byte stream headers Docker puts in front of each log
+// frame when the container has no TTY
+func demux(raw []byte) string {
+	var out bytes.Buffer
+	for len(raw) >= 8 && raw[0] <= 2 && raw[1] == 0 && raw[2] == 0 && raw[3] == 0 {
+		size := int(binary.BigEndian.Uint32(raw[4:8]))
+		raw = raw[8:]
+		if size > len(raw) {
+			size = len(raw)
+		}
+		out.Write(raw[:size])
+		raw = raw[size:]
+	}
+	out.Write(raw)
+	return out.String()
+}
+
+// splitImage splits "repo:tag" into its parts, defaulting the tag to latest.
+// A colon before the last slash belongs to a registry host.
+func splitImage(image string) (repo, tag string) {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+// client talks to the Docker Engine API
+type client struct {
+	http *http.Client
+	base string
+}
+
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("docker: %s (HTTP %d)", e.message, e.status)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.status == http.StatusNotFound
+}
+
+// newClient connects to DOCKER_HOST, or the default local socket
+func newClient() (*client, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_HOST %q: %w", host, err)
+	}
+
+	transport := &http.Transport{}
+	base := "http://docker"
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+	case "tcp", "http":
+		base = "http://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported DOCKER_HOST scheme %q", u.Scheme)
+	}
+	return &client{http: &http.Client{Transport: transport}, base: base}, nil
+}
+
+func (c *client) request(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker API unavailable: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var msg struct{ Message string }
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(data))
+		}
+		return nil, &apiError{status: resp.StatusCode, message: msg.Message}
+	}
+	return resp, nil
+}
+
+// do sends a request and decodes the JSON response into out, if given
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	resp, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// pull downloads an image. Errors are reported inside the progress stream
+// rather than through the HTTP status.
+func (c *client) pull(ctx context.Context, repo, tag string) error {
+	query := url.Values{"fromImage": {repo}, "tag": {tag}}
+	resp, err := c.request(ctx, http.MethodPost, "/images/create?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var msg struct{ Error string }
+		if json.Unmarshal(scanner.Bytes(), &msg) == nil && msg.Error != "" {
+			return fmt.Errorf("%s", msg.Error)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,166 @@
+package fuzz
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// maxCorpus bounds how many packets the corpus grows to with packets that
+// drew new responses from the broker
+const maxCorpus = 4096
+
+// corpusExt is the extension of the corpus files, each holding one packet
+const corpusExt = ".bin"
+
+// Seeds returns the built-in seed packets for protocol level 4 (3.1.1) or 5:
+// one valid packet of each type a client sends, publishing and subscribing
+// below topic
+func Seeds(level byte, topic, username, password string) [][]byte {
+	v5 := level >= 5
+	// props encodes a property section, empty on 3.1.1
+	props := func(p ...byte) []byte {
+		if !v5 {
+			return nil
+		}
+		return append([]byte{byte(len(p))}, p...)
+	}
+	id := func(n uint16) []byte { return binary.BigEndian.AppendUint16(nil, n) }
+	userProperty := append(common.AppendString([]byte{0x26}, "fuzz"), common.AppendString(nil, "seed")...)
+
+	seeds := [][]byte{
+		common.RawConnect(level, "fuzz-seed", username, password),
+		{0xC0, 0x00}, // PINGREQ
+	}
+
+	for qos := byte(0); qos <= 2; qos++ {
+		body := common.AppendString(nil, topic+"/publish")
+		if qos > 0 {
+			body = append(body, id(uint16(qos))...)
+		}
+		body = append(body, props(append([]byte{0x02, 0, 0, 0, 60, 0x01, 1}, userProperty...)...)...)
+		body = append(body, "seed payload"...)
+		seeds = append(seeds, common.RawPacket(0x30|qos<<1, body))
+	}
+
+	// SUBSCRIBE with a Subscription Identifier on MQTT 5 and options that
+	// set No Local and Retain As Published
+	body := append(id(1), props(0x0B, 7)...)
+	body = common.AppendString(body, topic+"/#")
+	body = append(body, 0x02)
+	if v5 {
+		body = common.AppendString(body, topic+"/+/opts")
+		body = append(body, 0x0D)
+	}
+	seeds = append(seeds, common.RawPacket(0x82, body))
+
+	body = append(id(2), props(userProperty...)...)
+	seeds = append(seeds, common.RawPacket(0xA2, common.AppendString(body, topic+"/#")))
+
+	// Acknowledgements, with a reason code and property on MQTT 5
+	for _, header := range []byte{0x40, 0x50, 0x62, 0x70} {
+		body := id(1)
+		if v5 {
+			body = append(body, 0x00)
+			body = append(body, props(userProperty...)...)
+		}
+		seeds = append(seeds, common.RawPacket(header, body))
+	}
+
+	if v5 {
+		// AUTH continuing an authentication exchange that never started
+		auth := common.AppendString([]byte{0x15}, "fuzz")
+		seeds = append(seeds, common.RawPacket(0xF0, append([]byte{0x18}, props(auth...)...)))
+		seeds = append(seeds, common.RawPacket(0xE0, []byte{0x00, 0x00}))
+	} else {
+		seeds = append(seeds, []byte{0xE0, 0x00})
+	}
+	return seeds
+}
+
+// corpus is the set of packets mutations start from
+type corpus struct {
+	dir     string
+	packets [][]byte
+	seen    map[string]bool // Hashes of the packets, to keep them unique
+}
+
+// loadCorpus reads the packets in dir, writing seeds there first when it
+// holds none. An empty dir keeps the corpus in memory only.
+func loadCorpus(dir string, seeds [][]byte) (*corpus, error) {
+	c := &corpus{dir: dir, seen: map[string]bool{}}
+	if dir == "" {
+		for _, p := range seeds {
+			c.add(p)
+		}
+		return c, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), corpusExt) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > 0 {
+			c.add(data)
+		}
+	}
+	if len(c.packets) == 0 {
+		for _, p := range seeds {
+			if _, err := c.save(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// hash names a packet in the corpus
+func hash(packet []byte) string {
+	sum := sha256.Sum256(packet)
+	return hex.EncodeToString(sum[:8])
+}
+
+// add puts packet in the corpus in memory, reporting whether it was new
+func (c *corpus) add(packet []byte) bool {
+	h := hash(packet)
+	if c.seen[h] {
+		return false
+	}
+	c.seen[h] = true
+	c.packets = append(c.packets, slices.Clone(packet))
+	return true
+}
+
+// save adds packet to the corpus and writes it to the corpus directory,
+// reporting whether it was new. It is dropped once the corpus is full.
+func (c *corpus) save(packet []byte) (bool, error) {
+	if len(c.packets) >= maxCorpus || !c.add(packet) {
+		return false, nil
+	}
+	if c.dir == "" {
+		return true, nil
+	}
+	path := filepath.Join(c.dir, hash(packet)+corpusExt)
+	if err := os.WriteFile(path, packet, 0o644); err != nil {
+		return true, fmt.Errorf("failed to save corpus packet: %w", err)
+	}
+	return true, nil
+}
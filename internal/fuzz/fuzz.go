@@ -0,0 +1,450 @@
+// Package fuzz sends mutated MQTT packets to a broker over long sessions and
+// records every connection-state anomaly with a file that reproduces it.
+//
+// Mutations start from a corpus of valid packets, which grows with mutants
+// that draw responses the broker has not given before. After each packet the
+// fuzzer sends PINGREQ on the same connection: the broker must answer it or
+// close the connection, and must not go on after refusing the packet with a
+// DISCONNECT. After each session a new connection checks that the broker is
+// still up.
+package fuzz
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// Anomaly kinds
+const (
+	// AnomalyUnresponsive is a broker that stopped accepting connections or
+	// answering PINGREQ after a session, which ends the run
+	AnomalyUnresponsive = "unresponsive"
+	// AnomalyHung is a connection that neither answered PINGREQ nor closed
+	AnomalyHung = "hung-connection"
+	// AnomalyOpenAfterDisconnect is a connection the broker kept serving
+	// after sending DISCONNECT with an error Reason Code
+	AnomalyOpenAfterDisconnect = "open-after-disconnect"
+	// AnomalyMalformedResponse is a packet from the broker that does not
+	// parse
+	AnomalyMalformedResponse = "malformed-response"
+)
+
+// settle is how long the fuzzer watches a connection after a packet whose
+// Remaining Length is broken, when it cannot tell a broker waiting for more
+// bytes from a hung one
+const settle = 200 * time.Millisecond
+
+// Config holds the configuration for a fuzzing run
+type Config struct {
+	Broker   string
+	Username string
+	Password string
+	Version  byte   // Protocol level, 4 (3.1.1) or 5
+	Topic    string // Topic prefix of the seed packets (generated if empty)
+
+	// Seed drives every random choice, so a run against a broker that
+	// answers the same way repeats its packets
+	Seed uint64
+
+	// Duration and Iterations end the run after this long or this many
+	// mutated packets, whichever comes first; zero is no limit
+	Duration   time.Duration
+	Iterations int
+
+	SessionLength int           // Mutated packets per connection, 100 when zero
+	Timeout       time.Duration // How long the broker has to answer PINGREQ, 2s when zero
+
+	CorpusDir string // Seed corpus, filled with the built-in seeds when empty; "" keeps it in memory
+	OutDir    string // Where reproducers are written
+
+	// OnAnomaly is called for every anomaly once its reproducer is written
+	OnAnomaly func(Anomaly)
+	// OnProgress is called every ProgressInterval with the totals so far
+	OnProgress       func(Stats)
+	ProgressInterval time.Duration
+}
+
+// Stats are the running totals of a fuzzing run
+type Stats struct {
+	Iterations uint64        // Mutated packets sent
+	Sessions   uint64        // Connections opened to send them
+	Closed     uint64        // Packets after which the broker closed the connection
+	Anomalies  uint64        // Anomalies found
+	Corpus     int           // Packets in the corpus
+	Elapsed    time.Duration // Time since the run started
+}
+
+// Anomaly is a connection-state anomaly and the file that reproduces it
+type Anomaly struct {
+	Kind   string
+	Detail string
+	Path   string // Reproducer file, empty if it could not be written
+}
+
+// Result is the outcome of a fuzzing run
+type Result struct {
+	Stats
+	Anomalies []Anomaly
+	Stopped   string // Why the run ended
+}
+
+// fuzzer is the state of a fuzzing run
+type fuzzer struct {
+	cfg     Config
+	mqtt    common.Config
+	mutator *mutator
+	corpus  *corpus
+	seen    map[string]bool // Response signatures drawn so far
+	written map[string]bool // Reproducers written, by name
+	result  Result
+	start   time.Time
+}
+
+func (cfg *Config) defaults() {
+	if cfg.Version == 0 {
+		cfg.Version = 5
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = common.GenerateTopicName("testmqtt/fuzz")
+	}
+	if cfg.SessionLength <= 0 {
+		cfg.SessionLength = 100
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.ProgressInterval <= 0 {
+		cfg.ProgressInterval = 5 * time.Second
+	}
+}
+
+// Run fuzzes the broker until a budget in cfg runs out, ctx is done or the
+// broker stops responding. It fails only when the run cannot start.
+func Run(ctx context.Context, cfg Config) (*Result, error) {
+	cfg.defaults()
+	f := &fuzzer{
+		cfg:     cfg,
+		mqtt:    common.Config{Broker: cfg.Broker, Username: cfg.Username, Password: cfg.Password},
+		seen:    map[string]bool{},
+		written: map[string]bool{},
+		start:   time.Now(),
+	}
+
+	if err := f.probe(); err != nil {
+		return nil, fmt.Errorf("broker not reachable: %w", err)
+	}
+	c, err := loadCorpus(cfg.CorpusDir, Seeds(cfg.Version, cfg.Topic, cfg.Username, cfg.Password))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load corpus: %w", err)
+	}
+	f.corpus = c
+	f.mutator = &mutator{rng: rand.New(rand.NewPCG(cfg.Seed, cfg.Seed)), corpus: c}
+
+	lastProgress := f.start
+	for f.result.Stopped == "" {
+		f.result.Stopped = f.budgetSpent(ctx)
+		if f.result.Stopped != "" {
+			break
+		}
+		f.session(ctx)
+		if cfg.OnProgress != nil && time.Since(lastProgress) >= cfg.ProgressInterval {
+			cfg.OnProgress(f.stats())
+			lastProgress = time.Now()
+		}
+	}
+
+	f.result.Stats = f.stats()
+	return &f.result, nil
+}
+
+// budgetSpent returns why the run should end, or "" to go on
+func (f *fuzzer) budgetSpent(ctx context.Context) string {
+	switch {
+	case ctx.Err() != nil:
+		return "interrupted"
+	case f.cfg.Duration > 0 && time.Since(f.start) >= f.cfg.Duration:
+		return "time budget spent"
+	case f.cfg.Iterations > 0 && f.result.Iterations >= uint64(f.cfg.Iterations):
+		return "iteration budget spent"
+	}
+	return ""
+}
+
+func (f *fuzzer) stats() Stats {
+	s := f.result.Stats
+	s.Corpus = len(f.corpus.packets)
+	s.Elapsed = time.Since(f.start)
+	return s
+}
+
+// session sends mutated packets on one connection until the broker closes
+// it, a packet breaks the framing or SessionLength is reached. A mutated
+// CONNECT gets a connection of its own.
+func (f *fuzzer) session(ctx context.Context) {
+	rng := f.mutator.rng
+	f.result.Sessions++
+
+	seed := f.corpus.packets[rng.IntN(len(f.corpus.packets))]
+	if seed[0]>>4 == 1 {
+		packet, _ := f.mutator.mutate(seed)
+		f.result.Iterations++
+		sent := [][]byte{packet}
+		conn, err := common.Dial(f.mqtt)
+		if err != nil {
+			f.unresponsive(false, sent, err)
+			return
+		}
+		out := observeConnect(conn, packet, f.cfg.Timeout)
+		conn.Close()
+		f.record(packet, out, false, sent)
+		if err := f.probe(); err != nil {
+			f.unresponsive(false, sent, err)
+		}
+		return
+	}
+
+	conn, err := common.DialRaw(f.mqtt, f.cfg.Version, common.GenerateClientID("fuzz"))
+	if err != nil {
+		f.unresponsive(true, nil, err)
+		return
+	}
+	var sent [][]byte
+	for range f.cfg.SessionLength {
+		if f.budgetSpent(ctx) != "" {
+			break
+		}
+		if len(sent) > 0 {
+			seed = f.corpus.packets[rng.IntN(len(f.corpus.packets))]
+		}
+		packet, framed := f.mutator.mutate(seed)
+		sent = append(sent, packet)
+		f.result.Iterations++
+
+		out := observe(conn, packet, framed, f.cfg.Timeout)
+		f.record(packet, out, true, sent)
+		if out.closed || !framed || out.anomaly != "" {
+			break
+		}
+	}
+	conn.Close()
+
+	if err := f.probe(); err != nil {
+		f.unresponsive(true, sent, err)
+	}
+}
+
+// record counts what packet, the last of sent, did and keeps it in the
+// corpus when it drew a response not seen before
+func (f *fuzzer) record(packet []byte, out outcome, handshake bool, sent [][]byte) {
+	if out.closed {
+		f.result.Closed++
+	}
+	if out.anomaly != "" {
+		f.report(out.anomaly, out.detail, handshake, sent)
+		return
+	}
+	if sig := out.signature(); !f.seen[sig] {
+		f.seen[sig] = true
+		if _, err := f.corpus.save(packet); err != nil {
+			f.result.Stopped = err.Error()
+		}
+	}
+}
+
+// unresponsive reports a broker that can no longer be reached after sent
+// and ends the run
+func (f *fuzzer) unresponsive(handshake bool, sent [][]byte, err error) {
+	f.report(AnomalyUnresponsive, err.Error(), handshake, sent)
+	f.result.Stopped = "broker unresponsive"
+}
+
+// report writes the reproducer for an anomaly after sent, once per anomaly
+// kind and last packet
+func (f *fuzzer) report(kind, detail string, handshake bool, sent [][]byte) {
+	rep := f.reproducer(handshake, sent)
+	rep.Anomaly, rep.Detail = kind, detail
+	name := rep.name()
+	if f.written[name] {
+		return
+	}
+	f.written[name] = true
+	f.result.Stats.Anomalies++
+
+	a := Anomaly{Kind: kind, Detail: detail}
+	if path, err := rep.write(f.cfg.OutDir, name); err != nil {
+		a.Detail += fmt.Sprintf(" (reproducer not written: %v)", err)
+	} else {
+		a.Path = path
+	}
+	f.result.Anomalies = append(f.result.Anomalies, a)
+	if f.cfg.OnAnomaly != nil {
+		f.cfg.OnAnomaly(a)
+	}
+}
+
+// reproducer starts a reproducer for packets, sent after a CONNECT of the
+// fuzzer's own when handshake is set
+func (f *fuzzer) reproducer(handshake bool, packets [][]byte) Reproducer {
+	rep := Reproducer{
+		Broker:    f.cfg.Broker,
+		Version:   f.cfg.Version,
+		Seed:      f.cfg.Seed,
+		Time:      time.Now().UTC(),
+		Handshake: handshake,
+	}
+	for _, p := range packets {
+		rep.Packets = append(rep.Packets, fmt.Sprintf("%x", p))
+	}
+	return rep
+}
+
+// probe checks that the broker accepts a new connection and answers PINGREQ
+func (f *fuzzer) probe() error {
+	return probe(f.mqtt, f.cfg.Version, f.cfg.Timeout)
+}
+
+func probe(cfg common.Config, level byte, timeout time.Duration) error {
+	conn, err := common.DialRaw(cfg, level, common.GenerateClientID("fuzz-probe"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.Send(0xC0, nil); err != nil {
+		return fmt.Errorf("failed to send PINGREQ: %w", err)
+	}
+	_, _, err = conn.Expect(0xD0, timeout, nil)
+	return err
+}
+
+// outcome is how the broker handled one mutated packet
+type outcome struct {
+	responses []string // The packets the broker sent, with their Reason Codes
+	closed    bool
+	anomaly   string
+	detail    string
+}
+
+// signature sums up the outcome for telling new broker behaviour from old
+func (o outcome) signature() string {
+	s := strings.Join(o.responses, ",")
+	if o.closed {
+		s += "|closed"
+	}
+	return s
+}
+
+// observe sends packet, followed by PINGREQ when it is framed, and reads
+// what the broker sends back until it answers the PINGREQ or closes the
+// connection. Deliveries are acknowledged so long sessions keep flowing.
+func observe(conn *common.RawConn, packet []byte, framed bool, timeout time.Duration) outcome {
+	var out outcome
+	if framed {
+		packet = append(slices.Clip(packet), 0xC0, 0x00)
+	} else {
+		timeout = min(timeout, settle)
+	}
+	if _, err := conn.Write(packet); err != nil {
+		out.closed = true
+		return out
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+	var refused byte // Reason Code of a DISCONNECT refusing the packet
+	for {
+		header, body, err := common.ReadRawPacket(conn)
+		if err != nil {
+			return readFailed(out, err, framed, timeout)
+		}
+		name := common.PacketName(header)
+		switch header >> 4 {
+		case 13: // PINGRESP
+			if framed && refused != 0 {
+				out.anomaly = AnomalyOpenAfterDisconnect
+				out.detail = fmt.Sprintf("broker sent DISCONNECT 0x%02x, then answered PINGREQ", refused)
+			}
+			return out
+		case 14: // DISCONNECT
+			if len(body) > 0 {
+				name += fmt.Sprintf(":0x%02x", body[0])
+				if body[0] >= 0x80 {
+					refused = body[0]
+				}
+			}
+		case 3: // PUBLISH
+			p, err := conn.ParsePublish(header, body)
+			if err != nil {
+				out.anomaly, out.detail = AnomalyMalformedResponse, err.Error()
+				return out
+			}
+			switch p.QoS {
+			case 1:
+				conn.Send(0x40, binary.BigEndian.AppendUint16(nil, p.PacketID))
+			case 2:
+				conn.Send(0x50, binary.BigEndian.AppendUint16(nil, p.PacketID))
+			}
+			name += fmt.Sprintf(":%d", p.QoS)
+		case 6: // PUBREL
+			if len(body) >= 2 {
+				conn.Send(0x70, body[:2])
+			}
+		case 4, 5, 7, 9, 11: // Acknowledgements with a Reason Code
+			if len(body) > 2 {
+				name += fmt.Sprintf(":0x%02x", body[2])
+			}
+		}
+		out.responses = append(out.responses, name)
+	}
+}
+
+// observeConnect sends a mutated CONNECT on a new connection and reads the
+// broker's answer. A broker may wait for a CONNECT it cannot recognise, so
+// silence is not an anomaly here.
+func observeConnect(conn net.Conn, packet []byte, timeout time.Duration) outcome {
+	var out outcome
+	if _, err := conn.Write(packet); err != nil {
+		out.closed = true
+		return out
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	header, body, err := common.ReadRawPacket(conn)
+	if err != nil {
+		return readFailed(out, err, false, timeout)
+	}
+	name := common.PacketName(header)
+	if header == 0x20 && len(body) >= 2 {
+		name += fmt.Sprintf(":0x%02x", body[1])
+	}
+	out.responses = append(out.responses, name)
+	return out
+}
+
+// readFailed completes out after reading from the broker failed: a closed
+// connection, a timeout, which is a hung connection when the broker owed an
+// answer, or a packet cut short
+func readFailed(out outcome, err error, framed bool, timeout time.Duration) outcome {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		if framed {
+			out.anomaly = AnomalyHung
+			out.detail = fmt.Sprintf("no PINGRESP and connection still open after %v", timeout)
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, common.ErrMalformedLength):
+		out.anomaly = AnomalyMalformedResponse
+		out.detail = fmt.Sprintf("packet from the broker cut short or unreadable: %v", err)
+	default:
+		out.closed = true
+	}
+	return out
+}
@@ -0,0 +1,166 @@
+package fuzz
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// maxBody bounds the body of a mutated packet, so repeated insertions cannot
+// grow packets without limit
+const maxBody = 64 * 1024
+
+// interestingBytes and interestingLengths are values that tend to sit on the
+// edges of what parsers check: flags, Variable Byte Integer continuation bits
+// and string lengths
+var (
+	interestingBytes   = []byte{0x00, 0x01, 0x02, 0x03, 0x7F, 0x80, 0x81, 0xC0, 0xFE, 0xFF}
+	interestingLengths = []uint16{0, 1, 2, 0x7F, 0x80, 0xFF, 0x100, 0x7FFF, 0x8000, 0xFFFE, 0xFFFF}
+)
+
+// mutator derives broken packets from the corpus
+type mutator struct {
+	rng    *rand.Rand
+	corpus *corpus
+}
+
+// split returns the first byte of packet's fixed header and its body. A
+// packet whose Remaining Length cannot be read is all body.
+func split(packet []byte) (byte, []byte) {
+	if len(packet) == 0 {
+		return 0, nil
+	}
+	length, n := 0, 0
+	for shift := 0; ; shift += 7 {
+		if 1+n >= len(packet) || n == 4 {
+			return packet[0], packet[1:]
+		}
+		b := packet[1+n]
+		length |= int(b&0x7F) << shift
+		n++
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := packet[1+n:]
+	if length < len(body) {
+		body = body[:length]
+	}
+	return packet[0], body
+}
+
+// mutate returns a mutated copy of packet and whether its Remaining Length
+// matches its body, so the broker can find where the next packet starts
+func (m *mutator) mutate(packet []byte) ([]byte, bool) {
+	header, body := split(packet)
+	body = slices.Clone(body)
+
+	for range 1 + m.rng.IntN(4) {
+		body = m.mutateBody(body)
+	}
+	if m.rng.IntN(8) == 0 {
+		// Flags, or more rarely the packet type
+		if m.rng.IntN(4) == 0 {
+			header ^= byte(1+m.rng.IntN(15)) << 4
+		} else {
+			header ^= byte(1 + m.rng.IntN(15))
+		}
+	}
+	if len(body) > maxBody {
+		body = body[:maxBody]
+	}
+
+	if m.rng.IntN(10) > 0 {
+		return common.RawPacket(header, body), true
+	}
+	return m.misframe(header, body), false
+}
+
+// mutateBody applies one random change to body
+func (m *mutator) mutateBody(body []byte) []byte {
+	pos := func() int { return m.rng.IntN(len(body) + 1) }
+	switch m.rng.IntN(8) {
+	case 0: // Flip a bit
+		if len(body) > 0 {
+			body[m.rng.IntN(len(body))] ^= 1 << m.rng.IntN(8)
+		}
+	case 1: // Set a byte to an edge value
+		if len(body) > 0 {
+			body[m.rng.IntN(len(body))] = interestingBytes[m.rng.IntN(len(interestingBytes))]
+		}
+	case 2: // Set a byte at random
+		if len(body) > 0 {
+			body[m.rng.IntN(len(body))] = byte(m.rng.IntN(256))
+		}
+	case 3: // Overwrite what may be a string or integer length
+		if len(body) > 1 {
+			i := m.rng.IntN(len(body) - 1)
+			binary.BigEndian.PutUint16(body[i:], interestingLengths[m.rng.IntN(len(interestingLengths))])
+		}
+	case 4: // Insert random bytes
+		insert := make([]byte, 1+m.rng.IntN(16))
+		for i := range insert {
+			insert[i] = byte(m.rng.IntN(256))
+		}
+		body = slices.Insert(body, pos(), insert...)
+	case 5: // Delete a span
+		if len(body) > 0 {
+			i := m.rng.IntN(len(body))
+			body = slices.Delete(body, i, min(len(body), i+1+m.rng.IntN(8)))
+		}
+	case 6: // Repeat a span, such as a property or a topic filter
+		if len(body) > 0 {
+			i := m.rng.IntN(len(body))
+			span := slices.Clone(body[i:min(len(body), i+1+m.rng.IntN(16))])
+			body = slices.Insert(body, pos(), span...)
+		}
+	default: // Splice in the tail of another packet
+		_, other := split(m.corpus.packets[m.rng.IntN(len(m.corpus.packets))])
+		if len(other) > 0 {
+			body = append(body[:pos()], other[m.rng.IntN(len(other)):]...)
+		}
+	}
+	return body
+}
+
+// misframe encodes a packet whose Remaining Length does not match its body:
+// too short, too long, padded to more bytes than needed, or five bytes long
+func (m *mutator) misframe(header byte, body []byte) []byte {
+	switch m.rng.IntN(4) {
+	case 0:
+		if len(body) > 0 {
+			packet := appendLength([]byte{header}, m.rng.IntN(len(body)))
+			return append(packet, body...)
+		}
+		fallthrough
+	case 1:
+		packet := appendLength([]byte{header}, len(body)+1+m.rng.IntN(64))
+		return append(packet, body...)
+	case 2:
+		// Padded with a continuation byte, within the four byte limit when
+		// the length allows
+		packet := []byte{header, byte(len(body)%128) | 0x80}
+		packet = appendLength(packet, len(body)/128)
+		return append(packet, body...)
+	default:
+		packet := []byte{header, 0x80, 0x80, 0x80, 0x80, 0x00}
+		return append(packet, body...)
+	}
+}
+
+// appendLength appends n as a Variable Byte Integer
+func appendLength(b []byte, n int) []byte {
+	for {
+		c := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if n == 0 {
+			return b
+		}
+	}
+}
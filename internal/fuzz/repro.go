@@ -0,0 +1,129 @@
+package fuzz
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// Reproducer is the record of an anomaly: the packets of the session that
+// led to it, in the order they were sent
+type Reproducer struct {
+	Anomaly string    `json:"anomaly"`
+	Detail  string    `json:"detail"`
+	Broker  string    `json:"broker"`
+	Version byte      `json:"version"`
+	Seed    uint64    `json:"seed"`
+	Time    time.Time `json:"time"`
+
+	// Handshake means the packets follow a valid CONNECT and CONNACK;
+	// otherwise the first packet is sent on a new connection in its place
+	Handshake bool     `json:"handshake"`
+	Packets   []string `json:"packets"` // Hex encoded
+}
+
+// name is the reproducer's file name: the anomaly and a hash of the packet
+// that caused it, so the same finding is written once
+func (r Reproducer) name() string {
+	last := ""
+	if len(r.Packets) > 0 {
+		last = r.Packets[len(r.Packets)-1]
+	}
+	return fmt.Sprintf("%s-%s.json", r.Anomaly, hash([]byte(last)))
+}
+
+// write saves the reproducer in dir and returns its path
+func (r Reproducer) write(dir, name string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	return path, os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// ReadReproducer reads a reproducer written by a fuzzing run
+func ReadReproducer(path string) (*Reproducer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Reproducer
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid reproducer %s: %w", path, err)
+	}
+	if len(r.Packets) == 0 && r.Anomaly != AnomalyUnresponsive {
+		return nil, fmt.Errorf("reproducer %s has no packets", path)
+	}
+	return &r, nil
+}
+
+// Replay sends the packets of rep to the broker in cfg the way the fuzzer
+// sent them and returns the anomaly they lead to now, nil if there is none.
+// cfg supplies the broker and credentials, which may differ from the run
+// that wrote rep.
+func Replay(cfg Config, rep *Reproducer) (*Anomaly, error) {
+	cfg.Version = rep.Version
+	cfg.defaults()
+	mqtt := common.Config{Broker: cfg.Broker, Username: cfg.Username, Password: cfg.Password}
+
+	packets := make([][]byte, len(rep.Packets))
+	for i, p := range rep.Packets {
+		b, err := hex.DecodeString(p)
+		if err != nil {
+			return nil, fmt.Errorf("packet %d: %w", i+1, err)
+		}
+		packets[i] = b
+	}
+
+	unresponsive := func(err error) *Anomaly {
+		return &Anomaly{Kind: AnomalyUnresponsive, Detail: err.Error()}
+	}
+	if !rep.Handshake {
+		conn, err := common.Dial(mqtt)
+		if err != nil {
+			return nil, err
+		}
+		out := observeConnect(conn, packets[0], cfg.Timeout)
+		conn.Close()
+		if out.anomaly != "" {
+			return &Anomaly{Kind: out.anomaly, Detail: out.detail}, nil
+		}
+		if err := probe(mqtt, cfg.Version, cfg.Timeout); err != nil {
+			return unresponsive(err), nil
+		}
+		return nil, nil
+	}
+
+	conn, err := common.DialRaw(mqtt, cfg.Version, common.GenerateClientID("fuzz-replay"))
+	if err != nil {
+		return nil, err
+	}
+	for _, packet := range packets {
+		_, body := split(packet)
+		framed := bytes.Equal(common.RawPacket(packet[0], body), packet)
+		out := observe(conn, packet, framed, cfg.Timeout)
+		if out.anomaly != "" {
+			conn.Close()
+			return &Anomaly{Kind: out.anomaly, Detail: out.detail}, nil
+		}
+		if out.closed || !framed {
+			break
+		}
+	}
+	conn.Close()
+
+	if err := probe(mqtt, cfg.Version, cfg.Timeout); err != nil {
+		return unresponsive(err), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,298 @@
+// Package history keeps conformance results in a local SQLite database so
+// pass rates and durations can be followed across runs
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	started        TIMESTAMP NOT NULL,
+	duration_ns    INTEGER NOT NULL,
+	title          TEXT NOT NULL,
+	spec           TEXT NOT NULL,
+	broker         TEXT NOT NULL,
+	broker_version TEXT NOT NULL DEFAULT '',
+	git_sha        TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS runs_key ON runs (broker, broker_version, git_sha);
+
+CREATE TABLE IF NOT EXISTS results (
+	run_id      INTEGER NOT NULL REFERENCES runs (id) ON DELETE CASCADE,
+	grp         TEXT NOT NULL,
+	name        TEXT NOT NULL,
+	status      TEXT NOT NULL,
+	duration_ns INTEGER NOT NULL,
+	spec_ref    TEXT NOT NULL DEFAULT '',
+	level       TEXT NOT NULL DEFAULT '',
+	error       TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS results_test ON results (grp, name);
+`
+
+// DB is a result history database
+type DB struct {
+	db *sql.DB
+}
+
+// Meta identifies what was tested in a run beyond the broker URL
+type Meta struct {
+	BrokerVersion string
+	GitSHA        string
+}
+
+// Run is one recorded suite run
+type Run struct {
+	ID            int64
+	Started       time.Time
+	Duration      time.Duration
+	Title         string
+	Spec          string
+	Broker        string
+	BrokerVersion string
+	GitSHA        string
+	Total         int
+	Passed        int
+	Failed        int
+}
+
+// Filter selects the runs a query looks at
+type Filter struct {
+	Broker        string
+	BrokerVersion string
+	Spec          string
+	Limit         int // Most recent runs only, 0 for all
+}
+
+// Trend is the history of one test over the selected runs, oldest first
+type Trend struct {
+	Group     string
+	Name      string
+	Statuses  []common.Status
+	Durations []time.Duration
+}
+
+// Open opens or creates the database at path
+func Open(path string) (*DB, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise %s: %w", path, err)
+	}
+	return &DB{db: db}, nil
+}
+
+// Close closes the database
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Record appends a report to the history and returns its run ID
+func (d *DB) Record(report *common.Report, meta Meta) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO runs (started, duration_ns, title, spec, broker, broker_version, git_sha)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		report.Started.UTC(), int64(report.Duration), report.Title, report.Spec, report.Broker, meta.BrokerVersion, meta.GitSHA)
+	if err != nil {
+		return 0, err
+	}
+	runID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO results (run_id, grp, name, status, duration_ns, spec_ref, level, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, r := range report.Results {
+		errText := ""
+		if r.Error != nil {
+			errText = r.Error.Error()
+		}
+		if _, err := stmt.Exec(runID, r.Group, r.Name, r.Status.String(), int64(r.Duration), r.SpecRef, r.Level.String(), errText); err != nil {
+			return 0, err
+		}
+	}
+	return runID, tx.Commit()
+}
+
+// Runs returns the selected runs, oldest first
+func (d *DB) Runs(f Filter) ([]Run, error) {
+	where, args := f.where()
+	query := `SELECT r.id, r.started, r.duration_ns, r.title, r.spec, r.broker, r.broker_version, r.git_sha,
+			COUNT(x.run_id),
+			COALESCE(SUM(x.status = 'PASS'), 0),
+			COALESCE(SUM(x.status = 'FAIL'), 0)
+		FROM runs r LEFT JOIN results x ON x.run_id = r.id` + where + `
+		GROUP BY r.id ORDER BY r.started DESC, r.id DESC`
+	if f.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", f.Limit)
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var r Run
+		var duration int64
+		if err := rows.Scan(&r.ID, &r.Started, &duration, &r.Title, &r.Spec, &r.Broker, &r.BrokerVersion, &r.GitSHA, &r.Total, &r.Passed, &r.Failed); err != nil {
+			return nil, err
+		}
+		r.Duration = time.Duration(duration)
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Oldest first reads naturally as a trend
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+	return runs, nil
+}
+
+// Trends returns the status and duration history of every test over runs
+func (d *DB) Trends(runs []Run) ([]Trend, error) {
+	if len(runs) == 0 {
+		return nil, nil
+	}
+	index := make(map[int64]int, len(runs))
+	for i, r := range runs {
+		index[r.ID] = i
+	}
+
+	rows, err := d.db.Query(`SELECT run_id, grp, name, status, duration_ns FROM results WHERE run_id >= ? AND run_id <= ? ORDER BY rowid`,
+		runs[0].ID, runs[len(runs)-1].ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byTest := make(map[string]*Trend)
+	var trends []*Trend
+	for rows.Next() {
+		var runID, duration int64
+		var group, name, status string
+		if err := rows.Scan(&runID, &group, &name, &status, &duration); err != nil {
+			return nil, err
+		}
+		i, ok := index[runID]
+		if !ok {
+			continue
+		}
+
+		key := group + "\x00" + name
+		t, ok := byTest[key]
+		if !ok {
+			t = &Trend{
+				Group:     group,
+				Name:      name,
+				Statuses:  make([]common.Status, len(runs)),
+				Durations: make([]time.Duration, len(runs)),
+			}
+			// Runs the test was not part of read as skipped
+			for j := range t.Statuses {
+				t.Statuses[j] = common.StatusSkipped
+			}
+			byTest[key] = t
+			trends = append(trends, t)
+		}
+		var s common.Status
+		if err := s.UnmarshalText([]byte(status)); err != nil {
+			return nil, err
+		}
+		t.Statuses[i] = s
+		t.Durations[i] = time.Duration(duration)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]Trend, len(trends))
+	for i, t := range trends {
+		out[i] = *t
+	}
+	return out, nil
+}
+
+func (f Filter) where() (string, []any) {
+	clause := ""
+	var args []any
+	add := func(cond string, arg any) {
+		if clause == "" {
+			clause = " WHERE "
+		} else {
+			clause += " AND "
+		}
+		clause += cond
+		args = append(args, arg)
+	}
+	if f.Broker != "" {
+		add("r.broker = ?", f.Broker)
+	}
+	if f.BrokerVersion != "" {
+		add("r.broker_version = ?", f.BrokerVersion)
+	}
+	if f.Spec != "" {
+		add("r.spec = ?", f.Spec)
+	}
+	return clause, args
+}
+
+// PassRate returns the share of runs the test passed in, ignoring runs where
+// it was skipped or inconclusive
+func (t Trend) PassRate() float64 {
+	passed, counted := 0, 0
+	for _, s := range t.Statuses {
+		switch s {
+		case common.StatusPassed, common.StatusWarning:
+			passed++
+			counted++
+		case common.StatusFailed:
+			counted++
+		}
+	}
+	if counted == 0 {
+		return 1
+	}
+	return float64(passed) / float64(counted)
+}
+
+// Flips counts how often the test changed between passing and failing,
+// which is what flakiness looks like over time
+func (t Trend) Flips() int {
+	flips := 0
+	last := common.Status(-1)
+	for _, s := range t.Statuses {
+		if s != common.StatusPassed && s != common.StatusFailed {
+			continue
+		}
+		if last != -1 && s != last {
+			flips++
+		}
+		last = s
+	}
+	return flips
+}
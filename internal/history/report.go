@@ -0,0 +1,125 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// PrintHistory prints the selected runs and the per-test trends over them.
+// Unless all is set only tests that failed or changed duration noticeably
+// are listed.
+func PrintHistory(runs []Run, trends []Trend, all bool) {
+	fmt.Printf("\n%s\n", common.TitleStyle.Render("Conformance History"))
+	if len(runs) == 0 {
+		fmt.Println("  No runs recorded")
+		return
+	}
+
+	fmt.Printf("  %-4s %-20s %-28s %-12s %-10s %8s %6s\n", "#", "Started", "Broker", "Version", "Git SHA", "Pass", "Fail")
+	for _, r := range runs {
+		rate := 0.0
+		if r.Total > 0 {
+			rate = 100 * float64(r.Passed) / float64(r.Total)
+		}
+		fmt.Printf("  %-4d %-20s %-28s %-12s %-10s %7.1f%% %6d\n",
+			r.ID, r.Started.Local().Format("2006-01-02 15:04:05"), clip(r.Broker, 28), clip(r.BrokerVersion, 12), clip(r.GitSHA, 10), rate, r.Failed)
+	}
+
+	// Least reliable tests first
+	sort.SliceStable(trends, func(i, j int) bool {
+		if trends[i].PassRate() != trends[j].PassRate() {
+			return trends[i].PassRate() < trends[j].PassRate()
+		}
+		return trends[i].Flips() > trends[j].Flips()
+	})
+
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Test Trends (oldest → newest)"))
+	shown := 0
+	for _, t := range trends {
+		drift := durationDrift(t.Durations)
+		if !all && t.PassRate() == 1 && drift < 0.5 {
+			continue
+		}
+		shown++
+		fmt.Printf("  %s %5.1f%% %2d flips  %s  %s / %s\n",
+			sparkline(t.Statuses), 100*t.PassRate(), t.Flips(), formatDrift(t.Durations, drift), t.Group, t.Name)
+	}
+	if shown == 0 {
+		fmt.Printf("  %s\n", common.PassStyle.Render("Every test passed in every run with stable durations"))
+	}
+}
+
+// sparkline renders one character per run
+func sparkline(statuses []common.Status) string {
+	var b strings.Builder
+	for _, s := range statuses {
+		switch s {
+		case common.StatusPassed:
+			b.WriteString(common.PassStyle.Render("✓"))
+		case common.StatusFailed:
+			b.WriteString(common.FailStyle.Render("✗"))
+		case common.StatusWarning:
+			b.WriteString(common.WarnStyle.Render("!"))
+		case common.StatusInconclusive:
+			b.WriteString(common.InconclusiveStyle.Render("?"))
+		default:
+			b.WriteString(common.SkipStyle.Render("·"))
+		}
+	}
+	return b.String()
+}
+
+// durationDrift compares the mean duration of the newer half of the runs to
+// the older half, e.g. 0.5 when the test got 50% slower. Changes under
+// minDrift are noise and reported as none.
+func durationDrift(durations []time.Duration) float64 {
+	const minDrift = 50 * time.Millisecond
+	if len(durations) < 2 {
+		return 0
+	}
+	half := len(durations) / 2
+	older, newer := mean(durations[:half]), mean(durations[half:])
+	if older == 0 || (newer-older).Abs() < minDrift {
+		return 0
+	}
+	return float64(newer)/float64(older) - 1
+}
+
+func formatDrift(durations []time.Duration, drift float64) string {
+	last := time.Duration(0)
+	if len(durations) > 0 {
+		last = durations[len(durations)-1]
+	}
+	s := fmt.Sprintf("%8v %+5.0f%%", last.Round(time.Millisecond), 100*drift)
+	if drift >= 0.5 {
+		return common.WarnStyle.Render(s)
+	}
+	return s
+}
+
+func mean(durations []time.Duration) time.Duration {
+	var sum time.Duration
+	n := 0
+	for _, d := range durations {
+		if d > 0 {
+			sum += d
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / time.Duration(n)
+}
+
+func clip(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -17,4 +17,5 @@ type Config struct {
 	QueueSize      int           // Max concurrent publishes
 	Timeout        time.Duration // Publish timeout
 	UnixTimestamp  bool          // Use unix timestamp instead of datetime
+	TopicAlias     bool          // Use topic aliases when republishing (v5 only)
 }
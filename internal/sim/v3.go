@@ -23,6 +23,10 @@ func RunV3(cfg Config) error {
 	fmt.Println(headerStyle.Render("MQTT v3.1.1 Traffic Simulator"))
 	fmt.Println()
 
+	if cfg.TopicAlias {
+		return fmt.Errorf("topic aliases require MQTT v5 (use --version 5)")
+	}
+
 	// Check source broker connectivity
 	fmt.Printf("Connecting to source: %s\n", cfg.Source)
 	if err := common.CheckBrokerReachable(cfg.Source); err != nil {
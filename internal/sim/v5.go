@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/internal/topicalias"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/eclipse/paho.golang/paho"
 )
@@ -55,6 +56,8 @@ func RunV5(cfg Config) error {
 	var targetMu sync.RWMutex
 	var targetClient *paho.Client
 	var targetConn interface{ Close() error }
+	var targetAliases *topicalias.Aliaser
+	var aliasSavings int64 // Savings from previous target connections
 
 	// Source connection with mutex for reconnection
 	var sourceMu sync.Mutex
@@ -68,6 +71,11 @@ func RunV5(cfg Config) error {
 		if targetConn != nil {
 			targetConn.Close()
 		}
+		// Topic aliases do not survive reconnection [MQTT-3.3.2-7]
+		if targetAliases != nil {
+			aliasSavings += targetAliases.Savings()
+			targetAliases = nil
+		}
 
 		conn, err := common.DialBroker(cfg.Broker)
 		if err != nil {
@@ -96,12 +104,16 @@ func RunV5(cfg Config) error {
 		connectCtx, connectCancel := context.WithTimeout(ctx, 10*time.Second)
 		defer connectCancel()
 
-		_, err = client.Connect(connectCtx, cp)
+		connack, err := client.Connect(connectCtx, cp)
 		if err != nil {
 			conn.Close()
 			return fmt.Errorf("failed to connect to target broker: %w", err)
 		}
 
+		if cfg.TopicAlias && connack.Properties != nil && connack.Properties.TopicAliasMaximum != nil && *connack.Properties.TopicAliasMaximum > 0 {
+			targetAliases = topicalias.New(*connack.Properties.TopicAliasMaximum)
+		}
+
 		targetClient = client
 		targetConn = conn
 		return nil
@@ -173,12 +185,19 @@ func RunV5(cfg Config) error {
 
 			targetMu.RLock()
 			client := targetClient
+			aliases := targetAliases
 			targetMu.RUnlock()
 
 			if client != nil {
+				topic := pub.Topic
+				if aliases != nil {
+					aliases.Apply(pub)
+				}
 				_, err := client.Publish(pubCtx, pub)
 				if err != nil {
 					atomic.AddUint64(&errorCount, 1)
+				} else if aliases != nil {
+					aliases.Confirm(topic)
 				}
 			}
 		}()
@@ -250,6 +269,13 @@ func RunV5(cfg Config) error {
 		return err
 	}
 	fmt.Println(successStyle.Render("  ✓ Connected to target broker"))
+	if cfg.TopicAlias {
+		if targetAliases != nil {
+			fmt.Printf(successStyle.Render("  ✓ Topic aliases enabled (broker maximum %d)\n"), targetAliases.Max())
+		} else {
+			fmt.Println(warnStyle.Render("  ! Topic aliases not supported by target broker, publishing full topic names"))
+		}
+	}
 
 	if err := connectSource(); err != nil {
 		targetMu.Lock()
@@ -301,6 +327,14 @@ func RunV5(cfg Config) error {
 			finalReceived := atomic.LoadUint64(&receivedCount)
 			finalDelivered := atomic.LoadUint64(&deliveredCount)
 			fmt.Printf("\n%s Total: %d received, %d delivered\n", successStyle.Render("✓"), finalReceived, finalDelivered)
+			if cfg.TopicAlias {
+				targetMu.Lock()
+				if targetAliases != nil {
+					aliasSavings += targetAliases.Savings()
+				}
+				targetMu.Unlock()
+				fmt.Printf("%s Topic alias savings: %d bytes\n", successStyle.Render("✓"), aliasSavings)
+			}
 			return nil
 
 		case <-ticker.C:
@@ -0,0 +1,94 @@
+package topicalias
+
+import (
+	"sync"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// aliasPropertySize is the encoded size of a Topic Alias property
+// (1 byte identifier + 2 byte integer)
+const aliasPropertySize = 3
+
+// Aliaser assigns publish-side topic aliases [MQTT-3.3.2.3.4]. Aliases are
+// allocated first-come up to the broker's Topic Alias Maximum; once every
+// alias is in use, further topics are published with their full name.
+//
+// A topic is only sent as alias-only after a publish carrying both the topic
+// and the alias has completed (see Confirm), so concurrent publishers can
+// never reference an alias the broker has not seen yet.
+type Aliaser struct {
+	mu          sync.Mutex
+	max         uint16
+	next        uint16
+	aliases     map[string]uint16
+	established map[string]bool
+	savings     int64
+}
+
+// New creates an Aliaser for a broker advertising the given Topic Alias Maximum
+func New(max uint16) *Aliaser {
+	return &Aliaser{
+		max:         max,
+		next:        1,
+		aliases:     make(map[string]uint16),
+		established: make(map[string]bool),
+	}
+}
+
+// Apply rewrites p to use a topic alias where possible and returns the
+// original topic name, which must be passed to Confirm once the publish succeeds
+func (a *Aliaser) Apply(p *paho.Publish) string {
+	topic := p.Topic
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alias, ok := a.aliases[topic]
+	if !ok {
+		if a.next > a.max {
+			return topic
+		}
+		alias = a.next
+		a.next++
+		a.aliases[topic] = alias
+	}
+
+	if p.Properties == nil {
+		p.Properties = &paho.PublishProperties{}
+	}
+	p.Properties.TopicAlias = paho.Uint16(alias)
+
+	if a.established[topic] {
+		p.Topic = ""
+		a.savings += int64(len(topic) - aliasPropertySize)
+	} else {
+		a.savings -= aliasPropertySize
+	}
+	return topic
+}
+
+// Confirm marks the alias for topic as known to the broker
+func (a *Aliaser) Confirm(topic string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.aliases[topic]; ok {
+		a.established[topic] = true
+	}
+}
+
+// Max returns the Topic Alias Maximum this Aliaser was created with
+func (a *Aliaser) Max() uint16 {
+	return a.max
+}
+
+// Savings returns the estimated number of bytes saved by aliasing so far.
+// Topic names are encoded with a 2 byte length prefix which an alias-only
+// publish still carries (as an empty string), so the saving per publish is
+// the topic length minus the alias property.
+func (a *Aliaser) Savings() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.savings
+}
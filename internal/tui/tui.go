@@ -0,0 +1,442 @@
+// Package tui is the interactive mode of testmqtt conformance: a test
+// selector followed by live progress of the selected tests
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	cursorStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	helpStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	paneStyle   = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("9")).
+			Padding(0, 1)
+)
+
+// ErrInterrupted is returned when the user quits while tests are running
+var ErrInterrupted = errors.New("interrupted")
+
+type phase int
+
+const (
+	selecting phase = iota
+	running
+	finished
+)
+
+// row is a line of the selector, a group heading or one of its tests
+type row struct {
+	group int
+	test  int // Index into refs, -1 for the group heading
+}
+
+type progressMsg common.Progress
+
+type tickMsg struct{}
+
+type doneMsg struct {
+	report *common.Report
+	err    error
+}
+
+type model struct {
+	suite  common.Suite
+	cfg    common.Config
+	refs   []common.TestRef
+	groups [][]int // Indices into refs per group of the suite
+	rows   []row
+
+	phase   phase
+	checked []bool
+	cursor  int
+	offset  int // First row shown
+	height  int
+	width   int
+	started time.Time
+	elapsed time.Duration
+
+	updates  chan tea.Msg
+	progress common.Progress
+	counts   map[common.Status]int
+	recent   []common.TestResult
+	failures []common.TestResult
+
+	report *common.Report
+	err    error
+	quit   bool // Quit before the run finished
+}
+
+// Run lets the user pick tests of suite, runs them against cfg.Broker and
+// shows their results as they come in. Tests of the groups filter selects
+// are picked to begin with. The report is nil when the user quits before
+// running anything.
+func Run(suite common.Suite, cfg common.Config, filter string) (*common.Report, error) {
+	refs, err := common.CollectTestRefs(suite.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &model{
+		suite:   suite,
+		cfg:     cfg,
+		refs:    refs,
+		checked: make([]bool, len(refs)),
+		height:  24,
+		width:   80,
+		updates: make(chan tea.Msg, 16),
+		counts:  make(map[common.Status]int),
+	}
+	i := 0
+	for g, group := range suite.Groups {
+		m.rows = append(m.rows, row{group: g, test: -1})
+		var tests []int
+		pick := common.ShouldRunGroup(group.Name, filter) && group.HasAnyTag(cfg.Tags)
+		for range group.Tests {
+			m.rows = append(m.rows, row{group: g, test: i})
+			m.checked[i] = pick
+			tests = append(tests, i)
+			i++
+		}
+		m.groups = append(m.groups, tests)
+	}
+
+	final, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	if err != nil {
+		return nil, err
+	}
+	m = final.(*model)
+	switch {
+	case m.quit && m.phase == running:
+		return nil, ErrInterrupted
+	case m.phase == selecting:
+		return nil, nil
+	}
+	printSummary(m)
+	return m.report, m.err
+}
+
+func (m *model) Init() tea.Cmd {
+	return nil
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scroll()
+	case tea.KeyMsg:
+		return m.key(msg)
+	case progressMsg:
+		m.progress = common.Progress(msg)
+		if r := msg.Result; r != nil {
+			m.counts[r.Status]++
+			m.recent = append(m.recent, *r)
+			if r.Status == common.StatusFailed {
+				m.failures = append(m.failures, *r)
+			}
+		}
+		return m, wait(m.updates)
+	case tickMsg:
+		if m.phase == running {
+			m.elapsed = time.Since(m.started)
+			return m, tick()
+		}
+	case doneMsg:
+		m.phase = finished
+		m.elapsed = time.Since(m.started)
+		m.report, m.err = msg.report, msg.err
+	}
+	return m, nil
+}
+
+func (m *model) key(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q", "esc":
+		m.quit = true
+		return m, tea.Quit
+	}
+	if m.phase == finished {
+		if msg.String() == "enter" {
+			return m, tea.Quit
+		}
+		return m, nil
+	}
+	if m.phase != selecting {
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "up", "k":
+		m.cursor = max(0, m.cursor-1)
+	case "down", "j":
+		m.cursor = min(len(m.rows)-1, m.cursor+1)
+	case "pgup":
+		m.cursor = max(0, m.cursor-m.listHeight())
+	case "pgdown":
+		m.cursor = min(len(m.rows)-1, m.cursor+m.listHeight())
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.rows) - 1
+	case " ", "x":
+		r := m.rows[m.cursor]
+		if r.test >= 0 {
+			m.checked[r.test] = !m.checked[r.test]
+		} else {
+			m.setAll(m.groups[r.group], !m.allChecked(m.groups[r.group]))
+		}
+	case "a":
+		all := make([]int, len(m.refs))
+		for i := range all {
+			all[i] = i
+		}
+		m.setAll(all, !m.allChecked(all))
+	case "enter":
+		if m.selected() > 0 {
+			return m, m.start()
+		}
+	}
+	m.scroll()
+	return m, nil
+}
+
+// start runs the selected tests in the background, reporting progress
+// through m.updates
+func (m *model) start() tea.Cmd {
+	picked := make(map[common.TestID]bool)
+	for i, ref := range m.refs {
+		if m.checked[i] {
+			picked[common.TestID{Group: ref.Group, Name: ref.Name}] = true
+		}
+	}
+	suite := m.suite
+	suite.Groups = common.FilterTests(suite.Groups, m.refs, func(ref common.TestRef) bool {
+		return picked[common.TestID{Group: ref.Group, Name: ref.Name}]
+	})
+
+	cfg := m.cfg
+	cfg.Output = io.Discard
+	cfg.Tags = nil // The selection already honours them
+	cfg.OnProgress = func(p common.Progress) {
+		m.updates <- progressMsg(p)
+	}
+	m.phase = running
+	m.started = time.Now()
+	m.progress.Total = m.selected()
+
+	go func() {
+		report, err := common.RunSuite(suite, cfg, "all", false)
+		m.updates <- doneMsg{report, err}
+	}()
+	return tea.Batch(wait(m.updates), tick())
+}
+
+// tick keeps the elapsed time current while a slow test runs
+func tick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+func wait(updates chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-updates
+	}
+}
+
+func (m *model) setAll(tests []int, checked bool) {
+	for _, i := range tests {
+		m.checked[i] = checked
+	}
+}
+
+func (m *model) allChecked(tests []int) bool {
+	for _, i := range tests {
+		if !m.checked[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *model) selected() int {
+	n := 0
+	for _, c := range m.checked {
+		if c {
+			n++
+		}
+	}
+	return n
+}
+
+// listHeight is the number of selector rows that fit the window
+func (m *model) listHeight() int {
+	return max(1, m.height-5)
+}
+
+// scroll keeps the cursor in view
+func (m *model) scroll() {
+	h := m.listHeight()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+h {
+		m.offset = m.cursor - h + 1
+	}
+}
+
+func (m *model) View() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %s\n\n", common.GroupStyle.Render(m.suite.Title), common.SubtitleStyle.Render(m.cfg.Broker))
+	switch m.phase {
+	case selecting:
+		m.viewSelector(&b)
+	default:
+		m.viewProgress(&b)
+	}
+	return b.String()
+}
+
+func (m *model) viewSelector(b *strings.Builder) {
+	end := min(len(m.rows), m.offset+m.listHeight())
+	for i := m.offset; i < end; i++ {
+		r := m.rows[i]
+		pointer := "  "
+		if i == m.cursor {
+			pointer = cursorStyle.Render("> ")
+		}
+		if r.test < 0 {
+			tests := m.groups[r.group]
+			n := 0
+			for _, t := range tests {
+				if m.checked[t] {
+					n++
+				}
+			}
+			box := "[ ]"
+			switch {
+			case n == len(tests):
+				box = "[x]"
+			case n > 0:
+				box = "[-]"
+			}
+			fmt.Fprintf(b, "%s%s %s %s\n", pointer, box, m.suite.Groups[r.group].Name, helpStyle.Render(fmt.Sprintf("(%d/%d)", n, len(tests))))
+			continue
+		}
+		box := "[ ]"
+		if m.checked[r.test] {
+			box = "[x]"
+		}
+		fmt.Fprintf(b, "%s    %s %s\n", pointer, box, m.refs[r.test].Name)
+	}
+	fmt.Fprintf(b, "\n%s\n", helpStyle.Render(fmt.Sprintf(
+		"%d of %d tests selected · ↑/↓ move · space toggle · a all · enter run · q quit", m.selected(), len(m.refs))))
+}
+
+func (m *model) viewProgress(b *strings.Builder) {
+	p := m.progress
+	fmt.Fprintf(b, "%s %d/%d  %s %s %s %s  %s\n",
+		bar(p.Done, p.Total, 30), p.Done, p.Total,
+		common.PassStyle.Render(fmt.Sprintf("✓ %d", m.counts[common.StatusPassed])),
+		common.FailStyle.Render(fmt.Sprintf("✗ %d", m.counts[common.StatusFailed])),
+		common.WarnStyle.Render(fmt.Sprintf("! %d", m.counts[common.StatusWarning])),
+		common.InconclusiveStyle.Render(fmt.Sprintf("? %d", m.counts[common.StatusInconclusive]+m.counts[common.StatusSkipped])),
+		helpStyle.Render(m.elapsed.Round(time.Second).String()))
+
+	switch {
+	case m.phase == running && p.Group == "":
+		fmt.Fprintf(b, "\n%s\n", common.SubtitleStyle.Render("Checking broker..."))
+	case m.phase == running:
+		fmt.Fprintf(b, "\n%s\n", common.SubtitleStyle.Render("Running "+p.Group))
+	case m.report == nil:
+		fmt.Fprintf(b, "\n%s\n", common.FailStyle.Render(fmt.Sprintf("Could not test the broker: %v", m.err)))
+	default:
+		fmt.Fprintf(b, "\n%s\n", common.PassStyle.Render(fmt.Sprintf("Finished in %v", m.report.Duration.Round(time.Millisecond))))
+	}
+
+	// Split what is left of the window between recent results and failures
+	room := max(2, m.height-8)
+	failureRoom := 0
+	if len(m.failures) > 0 {
+		failureRoom = min(room/2, 2*len(m.failures)+2)
+	}
+	recentRoom := room - failureRoom
+
+	b.WriteString("\n")
+	for _, r := range m.recent[max(0, len(m.recent)-recentRoom):] {
+		fmt.Fprintf(b, "  %s %s %s\n", common.StatusLabel(r.Status), clip(r.Name, m.width-30), helpStyle.Render(r.Duration.Round(time.Millisecond).String()))
+	}
+
+	if len(m.failures) > 0 {
+		var pane strings.Builder
+		fmt.Fprintf(&pane, "%s\n", common.FailStyle.Render(fmt.Sprintf("Failures (%d)", len(m.failures))))
+		shown := m.failures[max(0, len(m.failures)-(failureRoom-2)/2):]
+		for i, r := range shown {
+			fmt.Fprintf(&pane, "%s\n  %s", clip(r.Name, m.width-8), common.DetailStyle.Render(clip(fmt.Sprint(r.Error), m.width-10)))
+			if i < len(shown)-1 {
+				pane.WriteString("\n")
+			}
+		}
+		fmt.Fprintf(b, "\n%s\n", paneStyle.Width(max(20, m.width-2)).Render(pane.String()))
+	}
+
+	if m.phase == finished {
+		fmt.Fprintf(b, "\n%s\n", helpStyle.Render("enter or q to exit"))
+	} else {
+		fmt.Fprintf(b, "\n%s\n", helpStyle.Render("q to abandon the run"))
+	}
+}
+
+// printSummary leaves the outcome on the terminal once the TUI is gone
+func printSummary(m *model) {
+	if m.report == nil {
+		fmt.Println(common.FailStyle.Render(fmt.Sprintf("Could not test %s: %v", m.cfg.Broker, m.err)))
+		return
+	}
+	counts := m.report.Counts()
+	fmt.Printf("%s\n", common.SummaryStyle.Render(m.suite.Title+" against "+m.cfg.Broker))
+	fmt.Printf("  Total:  %d\n", len(m.report.Results))
+	fmt.Printf("  Passed: %s\n", common.PassStyle.Render(fmt.Sprintf("%d", counts[common.StatusPassed])))
+	if n := counts[common.StatusFailed]; n > 0 {
+		fmt.Printf("  Failed: %s\n", common.FailStyle.Render(fmt.Sprintf("%d", n)))
+	}
+	if n := counts[common.StatusWarning]; n > 0 {
+		fmt.Printf("  Warnings: %s\n", common.WarnStyle.Render(fmt.Sprintf("%d", n)))
+	}
+	if n := counts[common.StatusInconclusive]; n > 0 {
+		fmt.Printf("  Inconclusive: %s\n", common.InconclusiveStyle.Render(fmt.Sprintf("%d", n)))
+	}
+	if n := counts[common.StatusSkipped]; n > 0 {
+		fmt.Printf("  Skipped: %s\n", common.SkipStyle.Render(fmt.Sprintf("%d", n)))
+	}
+	for _, r := range m.report.Results {
+		if r.Status == common.StatusFailed {
+			fmt.Printf("\n  %s %s\n      %s\n", common.StatusLabel(r.Status), r.Name, common.DetailStyle.Render(fmt.Sprint(r.Error)))
+		}
+	}
+}
+
+func bar(done, total, width int) string {
+	filled := 0
+	if total > 0 {
+		filled = width * done / total
+	}
+	return common.PassStyle.Render(strings.Repeat("█", filled)) + helpStyle.Render(strings.Repeat("░", width-filled))
+}
+
+func clip(s string, n int) string {
+	n = max(n, 10)
+	r := []rune(strings.ReplaceAll(s, "\n", " "))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -1,15 +1,11 @@
 package main
 
 import (
-	"fmt"
 	"os"
 
-	"github.com/bromq-dev/testmqtt/internal/cmd"
+	"github.com/bromq-dev/testmqtt/cli"
 )
 
 func main() {
-	if err := cmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
+	os.Exit(cli.ExitCode(cli.Execute()))
 }
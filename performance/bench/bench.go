@@ -0,0 +1,668 @@
+package bench
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/bromq-dev/testmqtt/internal/topicalias"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// Benchmark scenarios
+const (
+	ScenarioPubSub = "pubsub" // 1 publisher → 1 subscriber
+	ScenarioFanOut = "fanout" // 1 publisher → N subscribers on the same topic
+	ScenarioFanIn  = "fanin"  // N publishers → 1 subscriber
+	ScenarioShared = "shared" // 1 publisher → K consumers in one $share group
+)
+
+// headerSize is the number of payload bytes used to tag each message with its
+// publisher index, sequence number and send timestamp
+const headerSize = 16
+
+// Config holds the configuration for a benchmark run
+type Config struct {
+	Broker      string
+	Username    string
+	Password    string
+	Scenario    string
+	Topic       string
+	Messages    int           // Messages sent by each publisher
+	PayloadSize int           // Payload size in bytes (minimum 16)
+	QoS         byte          // QoS for publishing and subscribing
+	Publishers  int           // Publisher count (fanin)
+	Subscribers int           // Subscriber count (fanout)
+	Rate        int           // Messages per second per publisher, 0 = unlimited
+	Timeout     time.Duration // Give up waiting for deliveries after this long without progress
+	TopicAlias  bool          // Publish with topic aliases when the broker supports them
+
+	ShareGroup   string // Share name for the shared scenario
+	DropConsumer bool   // Abruptly disconnect one shared consumer halfway through the stream
+
+	// Broker-side metrics sampled through the run, from $SYS topics or, when
+	// PrometheusURL is set, from a Prometheus endpoint. PrometheusMetrics
+	// names the metric to read for a quantity (MetricConnections,
+	// MetricDropped, MetricMemory) instead of the built-in names.
+	SysMetrics        bool
+	PrometheusURL     string
+	PrometheusMetrics map[string]string
+}
+
+// ClientStats holds per-client delivery statistics
+type ClientStats struct {
+	Name         string
+	Expected     uint64
+	Received     uint64
+	Completeness float64       // Received / Expected in percent
+	LastReceived time.Duration // Time from start of publishing to last delivery
+	Share        float64       // Fraction of all group deliveries in percent (shared)
+	Rate         float64       // Deliveries per second while active (shared)
+	Dropped      bool          // Consumer was disconnected mid-stream (shared)
+}
+
+// Result holds the outcome of a benchmark run
+type Result struct {
+	Scenario    string
+	Published   uint64
+	PublishErrs uint64
+	Expected    uint64
+	Delivered   uint64
+	PublishTime time.Duration // Time to publish all messages
+	TotalTime   time.Duration // Time until the last delivery (or timeout)
+
+	Subscribers []ClientStats // Per-subscriber completeness (pubsub, fanout, shared)
+	Publishers  []ClientStats // Per-publisher completeness at the subscriber (fanin)
+
+	// CountSkew is the spread between the best and worst served client in percent
+	// of expected messages; TimeSkew is the spread of their last delivery times
+	CountSkew float64
+	TimeSkew  time.Duration
+
+	LatencyMin time.Duration
+	LatencyAvg time.Duration
+	LatencyP50 time.Duration
+	LatencyP95 time.Duration
+	LatencyP99 time.Duration
+	LatencyMax time.Duration
+
+	// Shared subscription delivery accounting: Unique messages delivered to
+	// the group, Duplicates delivered more than once (redeliveries) and Lost
+	// messages never delivered to any consumer
+	Unique     uint64
+	Duplicates uint64
+	Lost       uint64
+
+	// Byte accounting on the wire (including MQTT framing and acks)
+	PublisherBytesSent      uint64
+	SubscriberBytesReceived uint64
+
+	// Topic alias usage; AliasMax is the smallest Topic Alias Maximum
+	// advertised to the publishers (0 = broker does not support aliases)
+	AliasRequested bool
+	AliasEnabled   bool
+	AliasMax       uint16
+	AliasSavings   int64
+
+	Broker *BrokerMetrics // nil unless broker metrics were requested
+}
+
+// benchClient is a connected benchmark client with wire byte accounting
+type benchClient struct {
+	*paho.Client
+	conn    *common.CountingConn
+	aliases *topicalias.Aliaser // nil unless topic aliases are in use
+}
+
+// subscriber tracks deliveries for one subscribing client
+type subscriber struct {
+	client    *benchClient
+	received  atomic.Uint64
+	firstNano atomic.Int64
+	lastNano  atomic.Int64
+	tracker   *deliveryTracker // Shared across a $share group, nil otherwise
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	perPub    []uint64 // Deliveries per publisher index
+	perPubAt  []time.Time
+}
+
+// deliveryTracker counts how often each published message reached a group
+type deliveryTracker struct {
+	mu       sync.Mutex
+	messages int
+	counts   []uint32
+	unique   uint64
+}
+
+func newDeliveryTracker(publishers, messages int) *deliveryTracker {
+	return &deliveryTracker{
+		messages: messages,
+		counts:   make([]uint32, publishers*messages),
+	}
+}
+
+func (t *deliveryTracker) record(pubIdx, seq uint32) {
+	idx := int(pubIdx)*t.messages + int(seq)
+	if idx >= len(t.counts) {
+		return
+	}
+	t.mu.Lock()
+	t.counts[idx]++
+	if t.counts[idx] == 1 {
+		t.unique++
+	}
+	t.mu.Unlock()
+}
+
+// summary returns unique, duplicate and lost message counts
+func (t *deliveryTracker) summary() (unique, duplicates, lost uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range t.counts {
+		switch {
+		case c == 0:
+			lost++
+		case c > 1:
+			duplicates += uint64(c - 1)
+		}
+	}
+	return t.unique, duplicates, lost
+}
+
+func (t *deliveryTracker) uniqueCount() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.unique
+}
+
+// Run executes the configured benchmark scenario
+func Run(cfg Config) (*Result, error) {
+	if cfg.Scenario == "" {
+		cfg.Scenario = ScenarioPubSub
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = common.GenerateTopicName("testmqtt/bench")
+	}
+	if cfg.PayloadSize < headerSize {
+		cfg.PayloadSize = headerSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Messages <= 0 {
+		return nil, fmt.Errorf("messages must be positive")
+	}
+	if cfg.QoS > 2 {
+		return nil, fmt.Errorf("invalid QoS: %d", cfg.QoS)
+	}
+
+	publishers, subscribers := 1, 1
+	switch cfg.Scenario {
+	case ScenarioPubSub:
+	case ScenarioFanOut:
+		subscribers = cfg.Subscribers
+	case ScenarioFanIn:
+		publishers = cfg.Publishers
+	case ScenarioShared:
+		subscribers = cfg.Subscribers
+		if cfg.ShareGroup == "" {
+			cfg.ShareGroup = "testmqtt-bench"
+		}
+		if cfg.DropConsumer && subscribers < 2 {
+			return nil, fmt.Errorf("dropping a consumer needs at least two shared consumers")
+		}
+	default:
+		return nil, fmt.Errorf("unknown scenario: %s (supported: %s, %s, %s, %s)", cfg.Scenario, ScenarioPubSub, ScenarioFanOut, ScenarioFanIn, ScenarioShared)
+	}
+	if cfg.DropConsumer && cfg.Scenario != ScenarioShared {
+		return nil, fmt.Errorf("dropping a consumer needs the %s scenario", ScenarioShared)
+	}
+	if publishers < 1 || subscribers < 1 {
+		return nil, fmt.Errorf("scenario %s needs at least one publisher and one subscriber", cfg.Scenario)
+	}
+
+	if err := common.CheckBrokerReachable(cfg.Broker); err != nil {
+		return nil, fmt.Errorf("broker not reachable: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Broker metrics are first sampled before any benchmark client connects
+	var watch *brokerWatch
+	if cfg.SysMetrics || cfg.PrometheusURL != "" {
+		w, err := startBrokerWatch(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		watch = w
+		defer watch.stop()
+	}
+
+	filter := cfg.Topic
+	expected := uint64(publishers*cfg.Messages) * uint64(subscribers)
+	var tracker *deliveryTracker
+	if cfg.Scenario == ScenarioShared {
+		filter = fmt.Sprintf("$share/%s/%s", cfg.ShareGroup, cfg.Topic)
+		expected = uint64(publishers * cfg.Messages)
+		tracker = newDeliveryTracker(publishers, cfg.Messages)
+	}
+
+	// Connect subscribers first so no message is published before every
+	// subscription is in place
+	subs := make([]*subscriber, subscribers)
+	for i := range subs {
+		sub := &subscriber{
+			perPub:   make([]uint64, publishers),
+			perPubAt: make([]time.Time, publishers),
+			tracker:  tracker,
+		}
+		client, err := connect(ctx, cfg, common.GenerateClientID(fmt.Sprintf("bench-sub-%d", i)), false, sub.onPublish)
+		if err != nil {
+			disconnectSubscribers(subs)
+			return nil, fmt.Errorf("subscriber %d: %w", i, err)
+		}
+		sub.client = client
+		subs[i] = sub
+
+		if _, err := client.Subscribe(ctx, &paho.Subscribe{
+			Subscriptions: []paho.SubscribeOptions{{Topic: filter, QoS: cfg.QoS}},
+		}); err != nil {
+			disconnectSubscribers(subs)
+			return nil, fmt.Errorf("subscriber %d subscribe failed: %w", i, err)
+		}
+	}
+	defer disconnectSubscribers(subs)
+
+	pubs := make([]*benchClient, publishers)
+	for i := range pubs {
+		client, err := connect(ctx, cfg, common.GenerateClientID(fmt.Sprintf("bench-pub-%d", i)), cfg.TopicAlias, nil)
+		if err != nil {
+			disconnectClients(pubs)
+			return nil, fmt.Errorf("publisher %d: %w", i, err)
+		}
+		pubs[i] = client
+	}
+	defer disconnectClients(pubs)
+
+	result := &Result{
+		Scenario: cfg.Scenario,
+		Expected: expected,
+	}
+
+	var published, publishErrs atomic.Uint64
+	start := time.Now()
+
+	// Sever one shared consumer's connection without DISCONNECT once half the
+	// stream is published, so its unacknowledged messages must be redelivered
+	dropped := -1
+	if cfg.DropConsumer {
+		dropped = 0
+		go func() {
+			half := uint64(publishers*cfg.Messages) / 2
+			for published.Load() < half && ctx.Err() == nil {
+				time.Sleep(time.Millisecond)
+			}
+			subs[dropped].client.conn.Close()
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for i, client := range pubs {
+		wg.Add(1)
+		go func(idx int, client *benchClient) {
+			defer wg.Done()
+			publishLoop(ctx, cfg, client, uint32(idx), start, &published, &publishErrs)
+		}(i, client)
+	}
+	wg.Wait()
+	result.PublishTime = time.Since(start)
+
+	// Wait for deliveries until complete, or until no progress within Timeout
+	var last uint64
+	lastProgress := time.Now()
+	for {
+		delivered := totalReceived(subs)
+		if tracker != nil {
+			delivered = tracker.uniqueCount()
+		}
+		if delivered >= result.Expected {
+			break
+		}
+		if delivered != last {
+			last = delivered
+			lastProgress = time.Now()
+		}
+		if time.Since(lastProgress) > cfg.Timeout {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if watch != nil {
+		result.Broker = watch.finish()
+	}
+
+	result.Published = published.Load()
+	result.PublishErrs = publishErrs.Load()
+	result.Delivered = totalReceived(subs)
+	result.collect(cfg, start, subs, publishers)
+	result.collectBytes(cfg, pubs, subs)
+	if tracker != nil {
+		result.collectShared(tracker, subs, dropped)
+	}
+
+	return result, nil
+}
+
+// publishLoop publishes cfg.Messages tagged messages, optionally rate limited
+func publishLoop(ctx context.Context, cfg Config, client *benchClient, pubIdx uint32, start time.Time, published, errs *atomic.Uint64) {
+	var interval time.Duration
+	if cfg.Rate > 0 {
+		interval = time.Second / time.Duration(cfg.Rate)
+	}
+
+	for seq := 0; seq < cfg.Messages; seq++ {
+		if interval > 0 {
+			if wait := time.Until(start.Add(time.Duration(seq) * interval)); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+
+		payload := make([]byte, cfg.PayloadSize)
+		binary.BigEndian.PutUint32(payload[0:4], pubIdx)
+		binary.BigEndian.PutUint32(payload[4:8], uint32(seq))
+		binary.BigEndian.PutUint64(payload[8:16], uint64(time.Now().UnixNano()))
+
+		pub := &paho.Publish{
+			Topic:   cfg.Topic,
+			QoS:     cfg.QoS,
+			Payload: payload,
+		}
+		if client.aliases != nil {
+			client.aliases.Apply(pub)
+		}
+
+		pubCtx, pubCancel := context.WithTimeout(ctx, 10*time.Second)
+		_, err := client.Publish(pubCtx, pub)
+		pubCancel()
+
+		if err != nil {
+			errs.Add(1)
+			continue
+		}
+		if client.aliases != nil {
+			client.aliases.Confirm(cfg.Topic)
+		}
+		published.Add(1)
+	}
+}
+
+// onPublish records a delivery and its end-to-end latency
+func (s *subscriber) onPublish(pr paho.PublishReceived) (bool, error) {
+	now := time.Now()
+	payload := pr.Packet.Payload
+	if len(payload) < headerSize {
+		return true, nil
+	}
+
+	pubIdx := binary.BigEndian.Uint32(payload[0:4])
+	seq := binary.BigEndian.Uint32(payload[4:8])
+	sent := int64(binary.BigEndian.Uint64(payload[8:16]))
+
+	if s.tracker != nil {
+		s.tracker.record(pubIdx, seq)
+	}
+	s.firstNano.CompareAndSwap(0, now.UnixNano())
+
+	s.mu.Lock()
+	s.latencies = append(s.latencies, now.Sub(time.Unix(0, sent)))
+	if int(pubIdx) < len(s.perPub) {
+		s.perPub[pubIdx]++
+		s.perPubAt[pubIdx] = now
+	}
+	s.mu.Unlock()
+
+	s.received.Add(1)
+	s.lastNano.Store(now.UnixNano())
+	return true, nil
+}
+
+// collect derives per-client statistics, skew and latency percentiles
+func (r *Result) collect(cfg Config, start time.Time, subs []*subscriber, publishers int) {
+	var latencies []time.Duration
+	var lastDelivery time.Time
+
+	perSub := uint64(publishers * cfg.Messages)
+	for i, sub := range subs {
+		sub.mu.Lock()
+		latencies = append(latencies, sub.latencies...)
+		sub.mu.Unlock()
+
+		stats := ClientStats{
+			Name:     fmt.Sprintf("subscriber-%d", i),
+			Expected: perSub,
+			Received: sub.received.Load(),
+		}
+		if last := sub.lastNano.Load(); last > 0 {
+			lastAt := time.Unix(0, last)
+			stats.LastReceived = lastAt.Sub(start)
+			if lastAt.After(lastDelivery) {
+				lastDelivery = lastAt
+			}
+		}
+		stats.Completeness = percent(stats.Received, stats.Expected)
+		r.Subscribers = append(r.Subscribers, stats)
+	}
+
+	if cfg.Scenario == ScenarioFanIn {
+		sub := subs[0]
+		sub.mu.Lock()
+		for i, n := range sub.perPub {
+			stats := ClientStats{
+				Name:         fmt.Sprintf("publisher-%d", i),
+				Expected:     uint64(cfg.Messages),
+				Received:     n,
+				Completeness: percent(n, uint64(cfg.Messages)),
+			}
+			if !sub.perPubAt[i].IsZero() {
+				stats.LastReceived = sub.perPubAt[i].Sub(start)
+			}
+			r.Publishers = append(r.Publishers, stats)
+		}
+		sub.mu.Unlock()
+	}
+
+	// Skew is measured across whichever side has multiple clients
+	skewSet := r.Subscribers
+	if cfg.Scenario == ScenarioFanIn {
+		skewSet = r.Publishers
+	}
+	if len(skewSet) > 1 {
+		minC, maxC := skewSet[0].Completeness, skewSet[0].Completeness
+		minT, maxT := skewSet[0].LastReceived, skewSet[0].LastReceived
+		for _, s := range skewSet[1:] {
+			minC = min(minC, s.Completeness)
+			maxC = max(maxC, s.Completeness)
+			minT = min(minT, s.LastReceived)
+			maxT = max(maxT, s.LastReceived)
+		}
+		r.CountSkew = maxC - minC
+		r.TimeSkew = maxT - minT
+	}
+
+	if !lastDelivery.IsZero() {
+		r.TotalTime = lastDelivery.Sub(start)
+	} else {
+		r.TotalTime = time.Since(start)
+	}
+
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var sum time.Duration
+	for _, l := range latencies {
+		sum += l
+	}
+	r.LatencyMin = latencies[0]
+	r.LatencyMax = latencies[len(latencies)-1]
+	r.LatencyAvg = sum / time.Duration(len(latencies))
+	r.LatencyP50 = percentile(latencies, 50)
+	r.LatencyP95 = percentile(latencies, 95)
+	r.LatencyP99 = percentile(latencies, 99)
+}
+
+// collectShared derives each consumer's share of the group's deliveries and
+// the redelivery accounting. The dropped consumer is excluded from the skew.
+func (r *Result) collectShared(tracker *deliveryTracker, subs []*subscriber, dropped int) {
+	r.Unique, r.Duplicates, r.Lost = tracker.summary()
+
+	var total uint64
+	for _, s := range r.Subscribers {
+		total += s.Received
+	}
+
+	r.CountSkew = 0
+	first := true
+	var minShare, maxShare float64
+	for i := range r.Subscribers {
+		stats := &r.Subscribers[i]
+		stats.Expected = r.Expected / uint64(len(subs))
+		stats.Completeness = percent(stats.Received, stats.Expected)
+		stats.Share = percent(stats.Received, total)
+		stats.Dropped = i == dropped
+
+		firstAt, lastAt := subs[i].firstNano.Load(), subs[i].lastNano.Load()
+		if active := time.Duration(lastAt - firstAt); active > 0 {
+			stats.Rate = float64(stats.Received) / active.Seconds()
+		}
+
+		if stats.Dropped {
+			continue
+		}
+		if first || stats.Share < minShare {
+			minShare = stats.Share
+		}
+		if first || stats.Share > maxShare {
+			maxShare = stats.Share
+		}
+		first = false
+	}
+	r.CountSkew = maxShare - minShare
+}
+
+// collectBytes gathers wire byte counters and topic alias savings
+func (r *Result) collectBytes(cfg Config, pubs []*benchClient, subs []*subscriber) {
+	r.AliasRequested = cfg.TopicAlias
+	r.AliasEnabled = cfg.TopicAlias
+
+	for i, p := range pubs {
+		r.PublisherBytesSent += p.conn.BytesWritten()
+		if p.aliases == nil {
+			r.AliasEnabled = false
+			continue
+		}
+		if i == 0 || p.aliases.Max() < r.AliasMax {
+			r.AliasMax = p.aliases.Max()
+		}
+		r.AliasSavings += p.aliases.Savings()
+	}
+	for _, s := range subs {
+		r.SubscriberBytesReceived += s.client.conn.BytesRead()
+	}
+}
+
+// connect dials the broker and connects a MQTT v5 client. When useAliases is
+// set and the broker advertises a Topic Alias Maximum, the returned client
+// carries an Aliaser for its publishes.
+func connect(ctx context.Context, cfg Config, clientID string, useAliases bool, onPublish func(paho.PublishReceived) (bool, error)) (*benchClient, error) {
+	rawConn, err := common.DialBroker(cfg.Broker)
+	if err != nil {
+		return nil, err
+	}
+	conn := common.NewCountingConn(rawConn)
+
+	config := paho.ClientConfig{
+		ClientID: clientID,
+		Conn:     conn,
+	}
+	if onPublish != nil {
+		config.OnPublishReceived = []func(paho.PublishReceived) (bool, error){onPublish}
+	}
+	c := &benchClient{
+		Client: paho.NewClient(config),
+		conn:   conn,
+	}
+
+	cp := &paho.Connect{
+		KeepAlive:  60,
+		ClientID:   clientID,
+		CleanStart: true,
+	}
+	if cfg.Username != "" {
+		cp.UsernameFlag = true
+		cp.Username = cfg.Username
+	}
+	if cfg.Password != "" {
+		cp.PasswordFlag = true
+		cp.Password = []byte(cfg.Password)
+	}
+
+	connectCtx, connectCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer connectCancel()
+
+	connack, err := c.Connect(connectCtx, cp)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	if useAliases && connack.Properties != nil && connack.Properties.TopicAliasMaximum != nil && *connack.Properties.TopicAliasMaximum > 0 {
+		c.aliases = topicalias.New(*connack.Properties.TopicAliasMaximum)
+	}
+	return c, nil
+}
+
+func disconnectSubscribers(subs []*subscriber) {
+	for _, s := range subs {
+		if s != nil && s.client != nil {
+			s.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+		}
+	}
+}
+
+func disconnectClients(clients []*benchClient) {
+	for _, c := range clients {
+		if c != nil {
+			c.Disconnect(&paho.Disconnect{ReasonCode: 0})
+		}
+	}
+}
+
+func totalReceived(subs []*subscriber) uint64 {
+	var total uint64
+	for _, s := range subs {
+		total += s.received.Load()
+	}
+	return total
+}
+
+func percent(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
+
+// percentile returns the p-th percentile of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	idx := (len(sorted) - 1) * p / 100
+	return sorted[idx]
+}
@@ -0,0 +1,309 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// Broker-side quantities sampled alongside the client-side measurements
+const (
+	MetricConnections = "connections"
+	MetricDropped     = "dropped"
+	MetricMemory      = "memory"
+)
+
+// Metrics lists the broker-side quantities in report order
+var Metrics = []string{MetricConnections, MetricDropped, MetricMemory}
+
+// sysMetricTopics are the $SYS topics each quantity is read from, in order
+// of preference. Names follow Mosquitto and Mochi; memory is in bytes.
+var sysMetricTopics = map[string][]string{
+	MetricConnections: {"$SYS/broker/clients/connected"},
+	MetricDropped:     {"$SYS/broker/publish/messages/dropped", "$SYS/broker/messages/dropped"},
+	MetricMemory:      {"$SYS/broker/heap/current", "$SYS/broker/system/memory"},
+}
+
+// promMetricNames are the Prometheus metrics each quantity is read from, in
+// order of preference. Names follow EMQX, HiveMQ and the standard process
+// collector; the values of a metric with several label sets are summed.
+var promMetricNames = map[string][]string{
+	MetricConnections: {"emqx_connections_count", "com_hivemq_networking_connections_current"},
+	MetricDropped:     {"emqx_messages_dropped", "com_hivemq_messages_dropped_count"},
+	MetricMemory:      {"process_resident_memory_bytes"},
+}
+
+const (
+	// sysMetricsWait is how long to wait for $SYS values. Brokers publish
+	// them on an interval, 10 seconds by default on Mosquitto.
+	sysMetricsWait = 12 * time.Second
+	// promInterval is how often the Prometheus endpoint is scraped
+	promInterval = time.Second
+)
+
+// BrokerMetric is a broker-side quantity sampled through the run
+type BrokerMetric struct {
+	Source  string  // $SYS topic or Prometheus metric it was read from
+	Before  float64 // Before the benchmark clients connected
+	After   float64 // After the last delivery, with the clients still connected
+	Peak    float64
+	Samples int
+}
+
+// BrokerMetrics holds the broker-side quantities of a run. Quantities the
+// broker did not report are missing from Values.
+type BrokerMetrics struct {
+	Source string // "$SYS" or the Prometheus URL
+	Values map[string]*BrokerMetric
+	// Stale is set when no $SYS update arrived after the last delivery, so
+	// After may predate the end of the load
+	Stale bool
+}
+
+// brokerWatch samples broker metrics from $SYS or a Prometheus endpoint
+// while a benchmark runs
+type brokerWatch struct {
+	cfg    Config
+	client *benchClient // $SYS subscriber, nil when scraping Prometheus
+	cancel context.CancelFunc
+	done   chan struct{} // Closed when scraping has stopped
+	once   sync.Once
+
+	mu      sync.Mutex
+	metrics BrokerMetrics
+	updates int // $SYS messages received
+}
+
+// startBrokerWatch takes the first sample of the broker metrics and keeps
+// sampling until finish. $SYS is used unless cfg.PrometheusURL is set.
+func startBrokerWatch(ctx context.Context, cfg Config) (*brokerWatch, error) {
+	w := &brokerWatch{
+		cfg:     cfg,
+		done:    make(chan struct{}),
+		metrics: BrokerMetrics{Source: "$SYS", Values: map[string]*BrokerMetric{}},
+	}
+	ctx, w.cancel = context.WithCancel(ctx)
+
+	if cfg.PrometheusURL != "" {
+		w.metrics.Source = cfg.PrometheusURL
+		if err := w.scrape(ctx); err != nil {
+			w.cancel()
+			return nil, fmt.Errorf("prometheus scrape failed: %w", err)
+		}
+		go func() {
+			defer close(w.done)
+			ticker := time.NewTicker(promInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					w.scrape(ctx)
+				}
+			}
+		}()
+		return w, nil
+	}
+
+	client, err := connect(ctx, cfg, common.GenerateClientID("bench-sys"), false, w.onSys)
+	if err != nil {
+		w.cancel()
+		return nil, fmt.Errorf("$SYS watcher: %w", err)
+	}
+	w.client = client
+	var subs []paho.SubscribeOptions
+	for _, q := range Metrics {
+		for _, t := range sysMetricTopics[q] {
+			subs = append(subs, paho.SubscribeOptions{Topic: t})
+		}
+	}
+	if _, err := client.Subscribe(ctx, &paho.Subscribe{Subscriptions: subs}); err != nil {
+		w.stop()
+		return nil, fmt.Errorf("$SYS watcher subscribe failed: %w", err)
+	}
+
+	// Retained $SYS values arrive at once, others with the next update
+	w.wait(sysMetricsWait, func() bool { return len(w.metrics.Values) == len(Metrics) })
+	return w, nil
+}
+
+// finish takes a last sample with the benchmark clients still connected and
+// returns the metrics of the run. For $SYS it waits for an update published
+// after the last delivery.
+func (w *brokerWatch) finish() *BrokerMetrics {
+	defer w.stop()
+	stale := false
+	if w.client == nil {
+		w.cancel()
+		<-w.done
+		w.scrape(context.Background())
+	} else {
+		w.mu.Lock()
+		updates := w.updates
+		w.mu.Unlock()
+		stale = !w.wait(sysMetricsWait, func() bool { return w.updates > updates })
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	m := w.metrics
+	m.Stale = stale
+	m.Values = map[string]*BrokerMetric{}
+	for q, v := range w.metrics.Values {
+		c := *v
+		m.Values[q] = &c
+	}
+	return &m
+}
+
+// stop disconnects the $SYS subscriber and ends scraping. It may be called
+// more than once.
+func (w *brokerWatch) stop() {
+	w.once.Do(func() {
+		w.cancel()
+		if w.client != nil {
+			w.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+		}
+	})
+}
+
+// wait polls until done returns true or d passes, and reports whether done
+// returned true. done is called with w.mu held.
+func (w *brokerWatch) wait(d time.Duration, done func() bool) bool {
+	deadline := time.Now().Add(d)
+	for {
+		w.mu.Lock()
+		ok := done()
+		w.mu.Unlock()
+		if ok {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// record adds a sample of quantity read from source. A quantity keeps the
+// source it was first read from.
+func (w *brokerWatch) record(quantity, source string, v float64) {
+	m, ok := w.metrics.Values[quantity]
+	if !ok {
+		w.metrics.Values[quantity] = &BrokerMetric{Source: source, Before: v, After: v, Peak: v, Samples: 1}
+		return
+	}
+	if m.Source != source {
+		return
+	}
+	m.After = v
+	m.Peak = max(m.Peak, v)
+	m.Samples++
+}
+
+// onSys records a $SYS update. Brokers publish plain numbers or a number and
+// a unit, e.g. "42 seconds".
+func (w *brokerWatch) onSys(pr paho.PublishReceived) (bool, error) {
+	fields := strings.Fields(string(pr.Packet.Payload))
+	if len(fields) == 0 {
+		return true, nil
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return true, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.updates++
+	for q, topics := range sysMetricTopics {
+		for _, t := range topics {
+			if t == pr.Packet.Topic {
+				w.record(q, t, v)
+			}
+		}
+	}
+	return true, nil
+}
+
+// scrape reads the Prometheus endpoint once and records every quantity it
+// reports
+func (w *brokerWatch) scrape(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.cfg.PrometheusURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", w.cfg.PrometheusURL, resp.Status)
+	}
+	values, err := parsePrometheus(bufio.NewScanner(resp.Body))
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, q := range Metrics {
+		names := promMetricNames[q]
+		if name, ok := w.cfg.PrometheusMetrics[q]; ok {
+			names = []string{name}
+		}
+		for _, name := range names {
+			if v, ok := values[name]; ok {
+				w.record(q, name, v)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parsePrometheus reads the Prometheus text exposition format and returns
+// the value of each metric, summed over its label sets
+func parsePrometheus(s *bufio.Scanner) (map[string]float64, error) {
+	values := map[string]float64{}
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, rest := line, ""
+		if i := strings.IndexAny(line, "{ "); i >= 0 {
+			name, rest = line[:i], line[i:]
+		}
+		if strings.HasPrefix(rest, "{") {
+			end := strings.LastIndex(rest, "}")
+			if end < 0 {
+				continue
+			}
+			rest = rest[end+1:]
+		}
+		// A timestamp may follow the value
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		values[name] += v
+	}
+	return values, s.Err()
+}
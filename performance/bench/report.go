@@ -0,0 +1,190 @@
+package bench
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// maxClientRows limits the per-client table so large fan-outs stay readable;
+// the worst served clients are always listed
+const maxClientRows = 20
+
+// PrintReport renders a benchmark result to stdout
+func PrintReport(cfg Config, r *Result) {
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Throughput"))
+	fmt.Printf("  Published:  %d (%d errors) in %v\n", r.Published, r.PublishErrs, r.PublishTime.Round(time.Millisecond))
+	fmt.Printf("  Publish rate: %.1f msg/s\n", rate(r.Published, r.PublishTime))
+	if r.Scenario == ScenarioShared {
+		fmt.Printf("  Delivered:  %s unique (%d total) in %v\n", completeness(r.Unique, r.Expected), r.Delivered, r.TotalTime.Round(time.Millisecond))
+	} else {
+		fmt.Printf("  Delivered:  %s in %v\n", completeness(r.Delivered, r.Expected), r.TotalTime.Round(time.Millisecond))
+	}
+	fmt.Printf("  Delivery rate: %.1f msg/s\n", rate(r.Delivered, r.TotalTime))
+
+	if r.Delivered > 0 {
+		fmt.Printf("\n%s\n", common.SummaryStyle.Render("Latency"))
+		fmt.Printf("  min: %v  avg: %v  max: %v\n", round(r.LatencyMin), round(r.LatencyAvg), round(r.LatencyMax))
+		fmt.Printf("  p50: %v  p95: %v  p99: %v\n", round(r.LatencyP50), round(r.LatencyP95), round(r.LatencyP99))
+	}
+
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Bytes on the Wire"))
+	fmt.Printf("  Publishers sent:      %s (%s/msg)\n", formatBytes(r.PublisherBytesSent), formatBytes(perMessage(r.PublisherBytesSent, r.Published)))
+	fmt.Printf("  Subscribers received: %s (%s/msg)\n", formatBytes(r.SubscriberBytesReceived), formatBytes(perMessage(r.SubscriberBytesReceived, r.Delivered)))
+	switch {
+	case r.AliasEnabled:
+		without := int64(r.PublisherBytesSent) + r.AliasSavings
+		fmt.Printf("  Topic aliases:        enabled (broker maximum %d)\n", r.AliasMax)
+		fmt.Printf("  Alias savings:        %s (%.1f%% of publisher traffic)\n", formatBytes(uint64(max(r.AliasSavings, 0))), float64(r.AliasSavings)/float64(max(without, 1))*100)
+	case r.AliasRequested:
+		fmt.Printf("  Topic aliases:        %s\n", common.FailStyle.Render("requested but not supported by broker (Topic Alias Maximum 0)"))
+	}
+
+	switch r.Scenario {
+	case ScenarioFanOut:
+		printClients("Per-Subscriber Delivery", r.Subscribers)
+	case ScenarioFanIn:
+		printClients("Per-Publisher Delivery", r.Publishers)
+	case ScenarioShared:
+		printShared(r)
+	}
+
+	if len(r.Subscribers) > 1 || len(r.Publishers) > 1 {
+		fmt.Printf("\n%s\n", common.SummaryStyle.Render("Skew"))
+		if r.Scenario == ScenarioShared {
+			fmt.Printf("  Share spread: %.2f%%\n", r.CountSkew)
+		} else {
+			fmt.Printf("  Completeness spread: %.2f%%\n", r.CountSkew)
+		}
+		fmt.Printf("  Last-delivery spread: %v\n", r.TimeSkew.Round(time.Millisecond))
+	}
+
+	if r.Broker != nil {
+		printBroker(r.Broker)
+	}
+}
+
+// printBroker prints the broker-side metrics of the run next to where they
+// were read from
+func printBroker(b *BrokerMetrics) {
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Broker Metrics"))
+	fmt.Printf("  %s\n", common.SubtitleStyle.Render("From "+b.Source+", before the clients connected → after the last delivery"))
+	if len(b.Values) == 0 {
+		fmt.Printf("  %s\n", common.FailStyle.Render("broker reported none of "+strings.Join(Metrics, ", ")))
+		return
+	}
+	for _, q := range Metrics {
+		m, ok := b.Values[q]
+		if !ok {
+			fmt.Printf("  %-12s %s\n", q+":", common.SubtitleStyle.Render("not reported"))
+			continue
+		}
+		format := func(v float64) string { return fmt.Sprintf("%.0f", v) }
+		if q == MetricMemory {
+			format = func(v float64) string { return formatBytes(uint64(max(v, 0))) }
+		}
+		line := fmt.Sprintf("%s → %s (peak %s, %d samples)", format(m.Before), format(m.After), format(m.Peak), m.Samples)
+		if q == MetricDropped && m.After > m.Before {
+			line = common.FailStyle.Render(fmt.Sprintf("%s, %.0f dropped during the run", line, m.After-m.Before))
+		}
+		fmt.Printf("  %-12s %s  %s\n", q+":", line, common.SubtitleStyle.Render(m.Source))
+	}
+	if b.Stale {
+		fmt.Printf("  %s\n", common.SubtitleStyle.Render("No $SYS update after the last delivery; values may predate the end of the load"))
+	}
+}
+
+// printShared prints the $share group distribution and redelivery accounting
+func printShared(r *Result) {
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Shared Group Distribution"))
+	ideal := 100 / float64(max(len(r.Subscribers), 1))
+	for _, c := range r.Subscribers {
+		note := ""
+		if c.Dropped {
+			note = common.FailStyle.Render("  (disconnected mid-stream)")
+		}
+		fmt.Printf("  %-16s %8d msgs  %5.1f%% (ideal %.1f%%)  %8.1f msg/s%s\n", c.Name, c.Received, c.Share, ideal, c.Rate, note)
+	}
+
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Redelivery"))
+	fmt.Printf("  Unique:     %s\n", completeness(r.Unique, r.Expected))
+	fmt.Printf("  Duplicates: %d\n", r.Duplicates)
+	if r.Lost > 0 {
+		fmt.Printf("  Lost:       %s\n", common.FailStyle.Render(fmt.Sprintf("%d", r.Lost)))
+	} else {
+		fmt.Printf("  Lost:       %s\n", common.PassStyle.Render("0"))
+	}
+}
+
+// printClients prints per-client completeness, listing incomplete clients first
+func printClients(title string, clients []ClientStats) {
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render(title))
+
+	shown := 0
+	for _, c := range clients {
+		if c.Received < c.Expected && shown < maxClientRows {
+			printClient(c)
+			shown++
+		}
+	}
+	for _, c := range clients {
+		if c.Received >= c.Expected && shown < maxClientRows {
+			printClient(c)
+			shown++
+		}
+	}
+	if len(clients) > shown {
+		fmt.Printf("  %s\n", common.SubtitleStyle.Render(fmt.Sprintf("... %d more", len(clients)-shown)))
+	}
+}
+
+func printClient(c ClientStats) {
+	last := ""
+	if c.LastReceived > 0 {
+		last = fmt.Sprintf("  last at %v", c.LastReceived.Round(time.Millisecond))
+	}
+	fmt.Printf("  %-16s %s%s\n", c.Name, completeness(c.Received, c.Expected), last)
+}
+
+// completeness renders "n/total (pct%)" styled by whether delivery was complete
+func completeness(n, total uint64) string {
+	s := fmt.Sprintf("%d/%d (%.1f%%)", n, total, percent(n, total))
+	if n < total {
+		return common.FailStyle.Render(s)
+	}
+	return common.PassStyle.Render(s)
+}
+
+func rate(n uint64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+func perMessage(bytes, messages uint64) uint64 {
+	if messages == 0 {
+		return 0
+	}
+	return bytes / messages
+}
+
+// formatBytes renders a byte count with a binary unit suffix
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,70 @@
+package scale
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// PrintReport renders a scale scenario result to stdout
+func PrintReport(r *Result) {
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Setup"))
+	if r.Scenario == ScenarioRetained {
+		fmt.Printf("  Retained:       %d topics stored in %v (%s publish errors)\n", r.Expected/uint64(max(r.Clients, 1)), round(r.Setup), errorCount(r.PublishErrs))
+		fmt.Printf("  Subscriptions:  %d wildcard filters (%s subscribe errors)\n", r.Clients, errorCount(r.ConnectErrs))
+	} else {
+		fmt.Printf("  Clients:        %d (%s connect errors)\n", r.Clients, errorCount(r.ConnectErrs))
+		fmt.Printf("  Setup time:     %v\n", round(r.Setup))
+	}
+	if r.Publish > 0 {
+		fmt.Printf("  Backlog queued: %v (%s publish errors)\n", round(r.Publish), errorCount(r.PublishErrs))
+	}
+	if r.Scenario == ScenarioSessions {
+		fmt.Printf("  Sessions lost:  %s\n", errorCount(r.SessionsLost))
+	}
+
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Delivery"))
+	fmt.Printf("  Delivered:      %s\n", completeness(r.Delivered, r.Expected))
+	fmt.Printf("  Duplicates:     %d\n", r.Duplicates)
+	if r.Unexpected > 0 {
+		fmt.Printf("  Unexpected:     %s\n", common.FailStyle.Render(fmt.Sprintf("%d", r.Unexpected)))
+	}
+	unit, per := "clients", "Per client:"
+	if r.Scenario == ScenarioRetained {
+		unit, per = "subscriptions", "Per filter:"
+	}
+	fmt.Printf("  Complete:       %s %s\n", completeness(r.CompleteClients, uint64(r.Clients)), unit)
+	fmt.Printf("  %-15s min %d  max %d\n", per, r.MinPerClient, r.MaxPerClient)
+
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Timing"))
+	fmt.Printf("  First delivery: %v\n", round(r.FirstDelivery))
+	fmt.Printf("  Last delivery:  %v\n", round(r.Drain))
+	if r.Drain > 0 {
+		fmt.Printf("  Drain rate:     %.1f msg/s\n", float64(r.Delivered)/r.Drain.Seconds())
+	}
+}
+
+// completeness renders "n/total (pct%)" styled by whether delivery was complete
+func completeness(n, total uint64) string {
+	pct := 0.0
+	if total > 0 {
+		pct = float64(n) / float64(total) * 100
+	}
+	s := fmt.Sprintf("%d/%d (%.1f%%)", n, total, pct)
+	if n < total {
+		return common.FailStyle.Render(s)
+	}
+	return common.PassStyle.Render(s)
+}
+
+func errorCount(n uint64) string {
+	if n > 0 {
+		return common.FailStyle.Render(fmt.Sprintf("%d", n))
+	}
+	return "0"
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
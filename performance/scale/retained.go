@@ -0,0 +1,179 @@
+package scale
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// retainedGroup is the number of topics per second-level branch, so wildcard
+// filters with + match a real hierarchy rather than one flat level
+const retainedGroup = 100
+
+// retainedFilters are the broad wildcard subscriptions; each one matches
+// every stored topic and must receive each retained message exactly once
+var retainedFilters = []string{"#", "+/+", "+/#"}
+
+// RunRetained stores retained messages on Topics distinct topics, then
+// subscribes with broad wildcards and verifies every retained message is
+// delivered exactly once per matching subscription, timing the flush.
+// The retained messages are cleared again at the end of the run.
+func RunRetained(cfg Config) (*Result, error) {
+	cfg.defaults("testmqtt/scale/retained")
+	if cfg.Topics <= 0 {
+		return nil, fmt.Errorf("topics must be positive")
+	}
+	if err := common.CheckBrokerReachable(cfg.Broker); err != nil {
+		return nil, fmt.Errorf("broker not reachable: %w", err)
+	}
+
+	ctx := context.Background()
+	result := &Result{
+		Scenario: ScenarioRetained,
+		Clients:  len(retainedFilters),
+		Expected: uint64(cfg.Topics * len(retainedFilters)),
+	}
+
+	topic := func(i int) string {
+		return fmt.Sprintf("%s/%d/%d", cfg.Topic, i/retainedGroup, i%retainedGroup)
+	}
+	index := make(map[string]int, cfg.Topics)
+	for i := 0; i < cfg.Topics; i++ {
+		index[topic(i)] = i
+	}
+
+	publisher, _, _, err := connect(ctx, cfg, &paho.Connect{
+		ClientID:   common.GenerateClientID("scale-retained-pub"),
+		CleanStart: true,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("publisher: %w", err)
+	}
+	defer publisher.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	// Phase 1: store the retained messages
+	cfg.phase("Storing %d retained messages", cfg.Topics)
+	var publishErrs atomic.Uint64
+	payload := make([]byte, cfg.PayloadSize)
+	start := time.Now()
+	forEach(cfg.Topics, cfg.Concurrency, func(i int) error {
+		if _, err := publisher.Publish(ctx, &paho.Publish{Topic: topic(i), QoS: 1, Retain: true, Payload: payload}); err != nil {
+			publishErrs.Add(1)
+			return err
+		}
+		return nil
+	})
+	result.Setup = time.Since(start)
+	result.PublishErrs = publishErrs.Load()
+
+	// Clear everything that was stored, even if the run fails part way
+	defer func() {
+		cfg.phase("Clearing %d retained messages", cfg.Topics)
+		forEach(cfg.Topics, cfg.Concurrency, func(i int) error {
+			_, err := publisher.Publish(ctx, &paho.Publish{Topic: topic(i), QoS: 1, Retain: true})
+			return err
+		})
+	}()
+
+	// Phase 2: subscribe with every wildcard filter at once and count the flush
+	cfg.phase("Subscribing with %d wildcard filters", len(retainedFilters))
+	var mu sync.Mutex
+	counts := make([][]uint32, len(retainedFilters))
+	var delivered, duplicates, unexpected atomic.Uint64
+	clock := &deliveryClock{}
+
+	clients := make([]*paho.Client, len(retainedFilters))
+	for f := range retainedFilters {
+		counts[f] = make([]uint32, cfg.Topics)
+		onPublish := func(pr paho.PublishReceived) (bool, error) {
+			clock.mark()
+			i, ok := index[pr.Packet.Topic]
+			// Retained messages sent because of a new subscription keep
+			// the RETAIN flag [MQTT-3.3.1-9]
+			if !ok || !pr.Packet.Retain {
+				unexpected.Add(1)
+				return true, nil
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			counts[f][i]++
+			if counts[f][i] > 1 {
+				duplicates.Add(1)
+				return true, nil
+			}
+			delivered.Add(1)
+			return true, nil
+		}
+
+		client, _, _, err := connect(ctx, cfg, &paho.Connect{
+			ClientID:   common.GenerateClientID(fmt.Sprintf("scale-retained-sub-%d", f)),
+			CleanStart: true,
+		}, onPublish)
+		if err != nil {
+			disconnectAll(clients)
+			return nil, fmt.Errorf("subscriber %d: %w", f, err)
+		}
+		clients[f] = client
+	}
+	defer disconnectAll(clients)
+
+	clock.begin()
+	var wg sync.WaitGroup
+	for f, filter := range retainedFilters {
+		wg.Add(1)
+		go func(client *paho.Client, filter string) {
+			defer wg.Done()
+			if _, err := client.Subscribe(ctx, &paho.Subscribe{
+				Subscriptions: []paho.SubscribeOptions{{Topic: strings.Join([]string{cfg.Topic, filter}, "/"), QoS: 1}},
+			}); err != nil {
+				atomic.AddUint64(&result.ConnectErrs, 1)
+			}
+		}(clients[f], filter)
+	}
+	wg.Wait()
+
+	cfg.phase("Waiting for the retained flush")
+	waitFor(delivered.Load, result.Expected, cfg.Timeout)
+	result.FirstDelivery = clock.first()
+	result.Drain = clock.last()
+	result.Delivered = delivered.Load()
+	result.Duplicates = duplicates.Load()
+	result.Unexpected = unexpected.Load()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for f := range retainedFilters {
+		var got uint64
+		for _, n := range counts[f] {
+			if n > 0 {
+				got++
+			}
+		}
+		if got == uint64(cfg.Topics) {
+			result.CompleteClients++
+		}
+		if f == 0 || got < result.MinPerClient {
+			result.MinPerClient = got
+		}
+		if f == 0 || got > result.MaxPerClient {
+			result.MaxPerClient = got
+		}
+	}
+
+	return result, nil
+}
+
+func disconnectAll(clients []*paho.Client) {
+	for _, c := range clients {
+		if c != nil {
+			c.Disconnect(&paho.Disconnect{ReasonCode: 0})
+		}
+	}
+}
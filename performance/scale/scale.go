@@ -0,0 +1,200 @@
+package scale
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// Scale scenarios
+const (
+	ScenarioSessions = "sessions" // Offline sessions with a queued backlog
+	ScenarioWills    = "wills"    // Abruptly severed clients with Will Messages
+	ScenarioRetained = "retained" // Retained store flushed to wildcard subscriptions
+)
+
+// Config holds the configuration shared by all scale scenarios
+type Config struct {
+	Broker      string
+	Username    string
+	Password    string
+	Topic       string        // Topic prefix (generated if empty)
+	Clients     int           // Sessions or will clients to create
+	Messages    int           // Queued messages per session (sessions)
+	Topics      int           // Distinct retained topics (retained)
+	PayloadSize int           // Payload size in bytes
+	Concurrency int           // Clients connected in parallel
+	Timeout     time.Duration // Give up waiting for deliveries after this long without progress
+
+	// OnPhase is called when a scenario moves to its next phase
+	OnPhase func(phase string)
+}
+
+// Result holds the outcome of a scale scenario
+type Result struct {
+	Scenario string
+	Clients  int // Clients, or wildcard subscriptions (retained)
+
+	ConnectErrs  uint64 // Clients that failed to connect or subscribe
+	PublishErrs  uint64
+	SessionsLost uint64 // Sessions not present on reconnect (sessions)
+
+	Expected   uint64
+	Delivered  uint64 // Unique deliveries
+	Duplicates uint64
+	Unexpected uint64 // Deliveries that matched no expected message
+
+	CompleteClients uint64 // Clients that received everything they should
+	MinPerClient    uint64
+	MaxPerClient    uint64
+
+	Setup         time.Duration // Time to create sessions, connect clients or store messages
+	Publish       time.Duration // Time to publish the backlog (sessions)
+	FirstDelivery time.Duration // From trigger to the first delivery
+	Drain         time.Duration // From trigger to the last delivery (or timeout)
+}
+
+func (cfg *Config) defaults(prefix string) {
+	if cfg.Topic == "" {
+		cfg.Topic = common.GenerateTopicName(prefix)
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 100
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.PayloadSize < 8 {
+		cfg.PayloadSize = 8
+	}
+}
+
+func (cfg *Config) phase(format string, args ...any) {
+	if cfg.OnPhase != nil {
+		cfg.OnPhase(fmt.Sprintf(format, args...))
+	}
+}
+
+// connect dials the broker and sends a CONNECT built from cp, filling in the
+// credentials from cfg. The raw connection is returned so callers can sever it.
+func connect(ctx context.Context, cfg Config, cp *paho.Connect, onPublish func(paho.PublishReceived) (bool, error)) (*paho.Client, *paho.Connack, net.Conn, error) {
+	conn, err := common.DialBroker(cfg.Broker)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	config := paho.ClientConfig{
+		ClientID: cp.ClientID,
+		Conn:     conn,
+	}
+	if onPublish != nil {
+		config.OnPublishReceived = []func(paho.PublishReceived) (bool, error){onPublish}
+	}
+	client := paho.NewClient(config)
+
+	if cp.KeepAlive == 0 {
+		cp.KeepAlive = 60
+	}
+	if cfg.Username != "" {
+		cp.UsernameFlag = true
+		cp.Username = cfg.Username
+	}
+	if cfg.Password != "" {
+		cp.PasswordFlag = true
+		cp.Password = []byte(cfg.Password)
+	}
+
+	connectCtx, connectCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer connectCancel()
+
+	connack, err := client.Connect(connectCtx, cp)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	return client, connack, conn, nil
+}
+
+// forEach runs fn for 0..n-1 with at most concurrency calls in flight and
+// returns how many calls failed
+func forEach(n, concurrency int, fn func(i int) error) uint64 {
+	var failed atomic.Uint64
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(i); err != nil {
+				failed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return failed.Load()
+}
+
+// waitFor polls count until it reaches expected or stops making progress for
+// timeout
+func waitFor(count func() uint64, expected uint64, timeout time.Duration) {
+	var last uint64
+	lastProgress := time.Now()
+	for {
+		n := count()
+		if n >= expected {
+			return
+		}
+		if n != last {
+			last = n
+			lastProgress = time.Now()
+		}
+		if time.Since(lastProgress) > timeout {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// deliveryClock records the first and last delivery relative to a trigger.
+// Deliveries before the trigger are not timed.
+type deliveryClock struct {
+	startNano atomic.Int64
+	firstNano atomic.Int64
+	lastNano  atomic.Int64
+}
+
+// begin marks the trigger, from which deliveries are timed
+func (c *deliveryClock) begin() {
+	c.startNano.Store(time.Now().UnixNano())
+}
+
+func (c *deliveryClock) mark() {
+	if c.startNano.Load() == 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	c.firstNano.CompareAndSwap(0, now)
+	c.lastNano.Store(now)
+}
+
+func (c *deliveryClock) first() time.Duration {
+	if n := c.firstNano.Load(); n > 0 {
+		return time.Duration(n - c.startNano.Load())
+	}
+	return 0
+}
+
+func (c *deliveryClock) last() time.Duration {
+	if n := c.lastNano.Load(); n > 0 {
+		return time.Duration(n - c.startNano.Load())
+	}
+	return 0
+}
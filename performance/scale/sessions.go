@@ -0,0 +1,207 @@
+package scale
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// sessionExpiry keeps the offline sessions alive for the duration of a run
+const sessionExpiry = 3600
+
+// session tracks the queued messages delivered to one reconnected session
+type session struct {
+	mu   sync.Mutex
+	seen []bool
+	got  uint64
+}
+
+// RunSessions creates Clients persistent sessions, disconnects them, queues
+// Messages QoS 1 messages for each one and then reconnects every session to
+// measure how completely and how quickly the broker drains the backlog
+func RunSessions(cfg Config) (*Result, error) {
+	cfg.defaults("testmqtt/scale/sessions")
+	if cfg.Clients <= 0 || cfg.Messages <= 0 {
+		return nil, fmt.Errorf("clients and messages must be positive")
+	}
+	if err := common.CheckBrokerReachable(cfg.Broker); err != nil {
+		return nil, fmt.Errorf("broker not reachable: %w", err)
+	}
+
+	ctx := context.Background()
+	result := &Result{
+		Scenario: ScenarioSessions,
+		Clients:  cfg.Clients,
+		Expected: uint64(cfg.Clients * cfg.Messages),
+	}
+
+	ids := make([]string, cfg.Clients)
+	for i := range ids {
+		ids[i] = common.GenerateClientID(fmt.Sprintf("scale-sess-%d", i))
+	}
+	topic := func(i int) string { return fmt.Sprintf("%s/%d", cfg.Topic, i) }
+	expiry := uint32(sessionExpiry)
+
+	// Phase 1: create the sessions and their subscriptions, then go offline
+	cfg.phase("Creating %d persistent sessions", cfg.Clients)
+	start := time.Now()
+	created := make([]bool, cfg.Clients)
+	result.ConnectErrs = forEach(cfg.Clients, cfg.Concurrency, func(i int) error {
+		client, _, _, err := connect(ctx, cfg, &paho.Connect{
+			ClientID:   ids[i],
+			CleanStart: true,
+			Properties: &paho.ConnectProperties{SessionExpiryInterval: &expiry},
+		}, nil)
+		if err != nil {
+			return err
+		}
+		defer client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+		if _, err := client.Subscribe(ctx, &paho.Subscribe{
+			Subscriptions: []paho.SubscribeOptions{{Topic: topic(i), QoS: 1}},
+		}); err != nil {
+			return err
+		}
+		created[i] = true
+		return nil
+	})
+	result.Setup = time.Since(start)
+
+	// Phase 2: queue the backlog while every session is offline
+	cfg.phase("Queueing %d QoS 1 messages per session", cfg.Messages)
+	publisher, _, _, err := connect(ctx, cfg, &paho.Connect{
+		ClientID:   common.GenerateClientID("scale-sess-pub"),
+		CleanStart: true,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("publisher: %w", err)
+	}
+
+	var publishErrs atomic.Uint64
+	start = time.Now()
+	forEach(cfg.Clients, cfg.Concurrency, func(i int) error {
+		if !created[i] {
+			return nil
+		}
+		for seq := 0; seq < cfg.Messages; seq++ {
+			payload := make([]byte, cfg.PayloadSize)
+			binary.BigEndian.PutUint32(payload[0:4], uint32(i))
+			binary.BigEndian.PutUint32(payload[4:8], uint32(seq))
+			if _, err := publisher.Publish(ctx, &paho.Publish{Topic: topic(i), QoS: 1, Payload: payload}); err != nil {
+				publishErrs.Add(1)
+			}
+		}
+		return nil
+	})
+	result.Publish = time.Since(start)
+	result.PublishErrs = publishErrs.Load()
+	publisher.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	// Phase 3: bring every session back and let the broker drain its queue
+	cfg.phase("Reconnecting %d sessions", cfg.Clients)
+	sessions := make([]*session, cfg.Clients)
+	var delivered, duplicates, unexpected atomic.Uint64
+	clock := &deliveryClock{}
+	clock.begin()
+
+	var mu sync.Mutex
+	var clients []*paho.Client
+	var sessionsLost atomic.Uint64
+
+	reconnectErrs := forEach(cfg.Clients, cfg.Concurrency, func(i int) error {
+		if !created[i] {
+			return nil
+		}
+		s := &session{seen: make([]bool, cfg.Messages)}
+		sessions[i] = s
+
+		onPublish := func(pr paho.PublishReceived) (bool, error) {
+			clock.mark()
+			payload := pr.Packet.Payload
+			if len(payload) < 8 || int(binary.BigEndian.Uint32(payload[0:4])) != i {
+				unexpected.Add(1)
+				return true, nil
+			}
+			seq := int(binary.BigEndian.Uint32(payload[4:8]))
+			if seq >= cfg.Messages {
+				unexpected.Add(1)
+				return true, nil
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.seen[seq] {
+				duplicates.Add(1)
+				return true, nil
+			}
+			s.seen[seq] = true
+			s.got++
+			delivered.Add(1)
+			return true, nil
+		}
+
+		client, connack, _, err := connect(ctx, cfg, &paho.Connect{
+			ClientID:   ids[i],
+			CleanStart: false,
+			Properties: &paho.ConnectProperties{SessionExpiryInterval: &expiry},
+		}, onPublish)
+		if err != nil {
+			return err
+		}
+		if !connack.SessionPresent {
+			sessionsLost.Add(1)
+		}
+
+		mu.Lock()
+		clients = append(clients, client)
+		mu.Unlock()
+		return nil
+	})
+	result.ConnectErrs += reconnectErrs
+	result.SessionsLost = sessionsLost.Load()
+
+	cfg.phase("Waiting for queued messages")
+	waitFor(delivered.Load, result.Expected, cfg.Timeout)
+	result.FirstDelivery = clock.first()
+	result.Drain = clock.last()
+	result.Delivered = delivered.Load()
+	result.Duplicates = duplicates.Load()
+	result.Unexpected = unexpected.Load()
+
+	first := true
+	for _, s := range sessions {
+		var got uint64
+		if s != nil {
+			s.mu.Lock()
+			got = s.got
+			s.mu.Unlock()
+		}
+		if got >= uint64(cfg.Messages) {
+			result.CompleteClients++
+		}
+		if first || got < result.MinPerClient {
+			result.MinPerClient = got
+		}
+		if first || got > result.MaxPerClient {
+			result.MaxPerClient = got
+		}
+		first = false
+	}
+
+	// Remove the sessions from the broker rather than leaving them to expire
+	zero := uint32(0)
+	for _, client := range clients {
+		client.Disconnect(&paho.Disconnect{
+			ReasonCode: 0,
+			Properties: &paho.DisconnectProperties{SessionExpiryInterval: &zero},
+		})
+	}
+
+	return result, nil
+}
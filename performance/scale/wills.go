@@ -0,0 +1,144 @@
+package scale
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// RunWills connects Clients clients that each carry a Will Message, severs
+// all of their connections at once with a TCP RST and measures whether the
+// broker delivers the resulting will storm completely, and how quickly
+func RunWills(cfg Config) (*Result, error) {
+	cfg.defaults("testmqtt/scale/wills")
+	if cfg.Clients <= 0 {
+		return nil, fmt.Errorf("clients must be positive")
+	}
+	if err := common.CheckBrokerReachable(cfg.Broker); err != nil {
+		return nil, fmt.Errorf("broker not reachable: %w", err)
+	}
+
+	ctx := context.Background()
+	result := &Result{
+		Scenario: ScenarioWills,
+		Clients:  cfg.Clients,
+	}
+
+	var mu sync.Mutex
+	counts := make([]uint64, cfg.Clients) // Wills received per client
+	var delivered, duplicates, unexpected atomic.Uint64
+	clock := &deliveryClock{}
+
+	// The observer must be subscribed before any client connects
+	observer, _, _, err := connect(ctx, cfg, &paho.Connect{
+		ClientID:   common.GenerateClientID("scale-will-observer"),
+		CleanStart: true,
+	}, func(pr paho.PublishReceived) (bool, error) {
+		clock.mark()
+		payload := pr.Packet.Payload
+		if len(payload) < 4 {
+			unexpected.Add(1)
+			return true, nil
+		}
+		idx := int(binary.BigEndian.Uint32(payload[0:4]))
+		if idx >= cfg.Clients {
+			unexpected.Add(1)
+			return true, nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		counts[idx]++
+		if counts[idx] > 1 {
+			duplicates.Add(1)
+			return true, nil
+		}
+		delivered.Add(1)
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("observer: %w", err)
+	}
+	defer observer.Disconnect(&paho.Disconnect{ReasonCode: 0})
+
+	if _, err := observer.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: cfg.Topic + "/#", QoS: 1}},
+	}); err != nil {
+		return nil, fmt.Errorf("observer subscribe failed: %w", err)
+	}
+
+	cfg.phase("Connecting %d clients with Will Messages", cfg.Clients)
+	conns := make([]net.Conn, cfg.Clients)
+	start := time.Now()
+	result.ConnectErrs = forEach(cfg.Clients, cfg.Concurrency, func(i int) error {
+		payload := make([]byte, cfg.PayloadSize)
+		binary.BigEndian.PutUint32(payload[0:4], uint32(i))
+
+		_, _, conn, err := connect(ctx, cfg, &paho.Connect{
+			ClientID:   common.GenerateClientID(fmt.Sprintf("scale-will-%d", i)),
+			CleanStart: true,
+			WillMessage: &paho.WillMessage{
+				Topic:   fmt.Sprintf("%s/%d", cfg.Topic, i),
+				QoS:     1,
+				Payload: payload,
+			},
+		}, nil)
+		if err != nil {
+			return err
+		}
+		conns[i] = conn
+		return nil
+	})
+	result.Setup = time.Since(start)
+	result.Expected = uint64(cfg.Clients) - result.ConnectErrs
+
+	// Sever every connection without DISCONNECT; a zero linger makes the
+	// kernel send RST instead of a graceful FIN
+	cfg.phase("Severing %d connections", result.Expected)
+	clock.begin()
+	for _, conn := range conns {
+		if conn == nil {
+			continue
+		}
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		conn.Close()
+	}
+
+	cfg.phase("Waiting for Will Messages")
+	waitFor(delivered.Load, result.Expected, cfg.Timeout)
+	result.FirstDelivery = clock.first()
+	result.Drain = clock.last()
+	result.Delivered = delivered.Load()
+	result.Duplicates = duplicates.Load()
+	result.Unexpected = unexpected.Load()
+
+	mu.Lock()
+	defer mu.Unlock()
+	first := true
+	for i, conn := range conns {
+		if conn == nil {
+			continue
+		}
+		if counts[i] > 0 {
+			result.CompleteClients++
+		}
+		if first || counts[i] < result.MinPerClient {
+			result.MinPerClient = counts[i]
+		}
+		if first || counts[i] > result.MaxPerClient {
+			result.MaxPerClient = counts[i]
+		}
+		first = false
+	}
+
+	return result, nil
+}
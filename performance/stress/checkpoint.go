@@ -0,0 +1,35 @@
+package stress
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// writeCheckpoint saves the run so far as JSON. The file is written to a
+// temporary name and renamed so a crash never leaves a truncated checkpoint.
+func writeCheckpoint(path string, r *Result) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
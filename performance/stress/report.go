@@ -0,0 +1,118 @@
+package stress
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+)
+
+// PrintSample renders one progress line for a sample window
+func PrintSample(s Sample) {
+	fmt.Printf("%s pub: %d  recv: %d  lost: %s  dup: %d  reconn: %d  p50: %v  p99: %v  heap: %s  goroutines: %d\n",
+		common.SubtitleStyle.Render(fmt.Sprintf("[%s]", formatElapsed(s.Elapsed))),
+		s.Published, s.Delivered, lostStyle(s.Lost), s.Duplicates, s.Reconnects,
+		round(s.LatencyP50), round(s.LatencyP99), formatBytes(s.HeapAlloc), s.Goroutines)
+}
+
+// PrintReport renders the outcome of a stress or soak run, including how
+// latency and memory drifted between the first and last sample windows
+func PrintReport(r *Result) {
+	status := "completed"
+	if !r.Complete {
+		status = "interrupted"
+	}
+
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Summary"))
+	fmt.Printf("  Ran:        %s (%s)\n", formatElapsed(r.Elapsed), status)
+	fmt.Printf("  Published:  %d (%d errors, %.1f msg/s)\n", r.Published, r.PublishErrs, rate(r.Published, r.Elapsed))
+	fmt.Printf("  Delivered:  %d of %d expected\n", r.Delivered, r.Expected)
+	fmt.Printf("  Lost:       %s (%.3f%%)\n", lostStyle(r.Lost), percent(r.Lost, r.Expected))
+	fmt.Printf("  Duplicates: %d\n", r.Duplicates)
+	fmt.Printf("  Reconnects: %d\n", r.Reconnects)
+
+	first, last, ok := driftWindows(r.Samples)
+	if !ok {
+		return
+	}
+
+	fmt.Printf("\n%s\n", common.SummaryStyle.Render("Drift (first → last window)"))
+	fmt.Printf("  Latency p50: %v → %v (%s)\n", round(first.LatencyP50), round(last.LatencyP50), change(int64(first.LatencyP50), int64(last.LatencyP50)))
+	fmt.Printf("  Latency p99: %v → %v (%s)\n", round(first.LatencyP99), round(last.LatencyP99), change(int64(first.LatencyP99), int64(last.LatencyP99)))
+	fmt.Printf("  Heap in use: %s → %s (%s)\n", formatBytes(first.HeapAlloc), formatBytes(last.HeapAlloc), change(int64(first.HeapAlloc), int64(last.HeapAlloc)))
+	fmt.Printf("  Goroutines:  %d → %d\n", first.Goroutines, last.Goroutines)
+
+	var peak Sample
+	for _, s := range r.Samples {
+		if s.LatencyP99 > peak.LatencyP99 {
+			peak = s
+		}
+	}
+	if peak.LatencyP99 > 0 {
+		fmt.Printf("  Worst p99:   %v at %s\n", round(peak.LatencyP99), formatElapsed(peak.Elapsed))
+	}
+}
+
+// driftWindows returns the first and last sample windows that saw traffic
+func driftWindows(samples []Sample) (first, last Sample, ok bool) {
+	var found []Sample
+	for _, s := range samples {
+		if s.LatencyP50 > 0 {
+			found = append(found, s)
+		}
+	}
+	if len(found) < 2 {
+		return Sample{}, Sample{}, false
+	}
+	return found[0], found[len(found)-1], true
+}
+
+func change(from, to int64) string {
+	if from == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", float64(to-from)/float64(from)*100)
+}
+
+func lostStyle(n uint64) string {
+	if n > 0 {
+		return common.FailStyle.Render(fmt.Sprintf("%d", n))
+	}
+	return common.PassStyle.Render("0")
+}
+
+func percent(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
+
+func rate(n uint64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+func formatElapsed(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+// formatBytes renders a byte count with a binary unit suffix
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,548 @@
+package stress
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bromq-dev/testmqtt/conformance/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// headerSize is the number of payload bytes used to tag each message with its
+// publisher index, sequence number and send timestamp
+const headerSize = 16
+
+// maxWindowLatencies bounds the latency reservoir kept per sample window
+const maxWindowLatencies = 10000
+
+// Config holds the configuration for a stress or soak run
+type Config struct {
+	Broker      string        `json:"broker"`
+	Username    string        `json:"username,omitempty"`
+	Password    string        `json:"-"`
+	Topic       string        `json:"topic"` // Topic prefix, one subtopic per --topics
+	Duration    time.Duration `json:"duration"`
+	Publishers  int           `json:"publishers"`
+	Subscribers int           `json:"subscribers"` // Each subscriber receives every topic
+	Topics      int           `json:"topics"`
+	QoS         byte          `json:"qos"`
+	Rate        int           `json:"rate"` // Messages per second per publisher
+	PayloadSize int           `json:"payload_size"`
+	Interval    time.Duration `json:"interval"`             // Sample (and checkpoint) interval
+	Checkpoint  string        `json:"checkpoint,omitempty"` // File rewritten after every sample, empty disables
+
+	// OnSample is called after every sample window, e.g. to print progress
+	OnSample func(Sample) `json:"-"`
+}
+
+// Sample is a snapshot of a run taken once per Interval. Counters are
+// cumulative; latencies cover the window since the previous sample.
+type Sample struct {
+	Time        time.Time     `json:"time"`
+	Elapsed     time.Duration `json:"elapsed"`
+	Published   uint64        `json:"published"`
+	PublishErrs uint64        `json:"publish_errors"`
+	Delivered   uint64        `json:"delivered"`
+	Lost        uint64        `json:"lost"`
+	Duplicates  uint64        `json:"duplicates"`
+	Reconnects  uint64        `json:"reconnects"`
+
+	LatencyP50 time.Duration `json:"latency_p50"`
+	LatencyP99 time.Duration `json:"latency_p99"`
+	LatencyMax time.Duration `json:"latency_max"`
+
+	// Memory of the test process itself, to tell tool leaks from broker issues
+	HeapAlloc  uint64 `json:"heap_alloc"`
+	HeapSys    uint64 `json:"heap_sys"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// Result holds the outcome of a stress or soak run
+type Result struct {
+	Config   Config        `json:"config"`
+	Started  time.Time     `json:"started"`
+	Elapsed  time.Duration `json:"elapsed"`
+	Complete bool          `json:"complete"` // false while running or if interrupted
+	Samples  []Sample      `json:"samples"`
+
+	Published   uint64 `json:"published"`
+	PublishErrs uint64 `json:"publish_errors"`
+	Expected    uint64 `json:"expected"` // Published × subscribers
+	Delivered   uint64 `json:"delivered"`
+	Lost        uint64 `json:"lost"`
+	Duplicates  uint64 `json:"duplicates"`
+	Reconnects  uint64 `json:"reconnects"`
+}
+
+// worker is a client that reconnects on its own whenever the connection drops
+type worker struct {
+	name      string
+	cfg       Config
+	onPublish func(paho.PublishReceived) (bool, error)
+	subscribe bool
+
+	mu     sync.RWMutex
+	client *paho.Client
+	down   chan struct{}
+}
+
+// subscriber detects loss and duplicates from per-publisher sequence numbers
+type subscriber struct {
+	*worker
+	delivered  atomic.Uint64
+	lost       atomic.Uint64
+	duplicates atomic.Uint64
+
+	mu   sync.Mutex
+	next []uint32 // Next expected sequence number per publisher
+}
+
+// latencyWindow keeps a bounded reservoir of latencies since the last sample
+type latencyWindow struct {
+	mu      sync.Mutex
+	seen    int
+	samples []time.Duration
+}
+
+// Run executes a steady pub/sub workload until Duration elapses or ctx is
+// cancelled, sampling throughput, loss, reconnects, latency and memory
+func Run(ctx context.Context, cfg Config) (*Result, error) {
+	if cfg.Topic == "" {
+		cfg.Topic = common.GenerateTopicName("testmqtt/stress")
+	}
+	if cfg.PayloadSize < headerSize {
+		cfg.PayloadSize = headerSize
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.Topics < 1 {
+		cfg.Topics = 1
+	}
+	if cfg.Duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+	if cfg.Publishers < 1 || cfg.Subscribers < 1 {
+		return nil, fmt.Errorf("stress needs at least one publisher and one subscriber")
+	}
+	if cfg.Rate < 1 {
+		return nil, fmt.Errorf("rate must be positive")
+	}
+	if cfg.QoS > 2 {
+		return nil, fmt.Errorf("invalid QoS: %d", cfg.QoS)
+	}
+
+	if err := common.CheckBrokerReachable(cfg.Broker); err != nil {
+		return nil, fmt.Errorf("broker not reachable: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var reconnects atomic.Uint64
+	window := &latencyWindow{}
+
+	subs := make([]*subscriber, cfg.Subscribers)
+	for i := range subs {
+		sub := &subscriber{next: make([]uint32, cfg.Publishers)}
+		sub.worker = &worker{
+			name:      common.GenerateClientID(fmt.Sprintf("stress-sub-%d", i)),
+			cfg:       cfg,
+			onPublish: sub.onPublish(window),
+			subscribe: true,
+		}
+		if err := sub.connect(ctx); err != nil {
+			disconnectSubscribers(subs)
+			return nil, fmt.Errorf("subscriber %d: %w", i, err)
+		}
+		subs[i] = sub
+	}
+	defer disconnectSubscribers(subs)
+
+	pubs := make([]*worker, cfg.Publishers)
+	for i := range pubs {
+		pubs[i] = &worker{name: common.GenerateClientID(fmt.Sprintf("stress-pub-%d", i)), cfg: cfg}
+		if err := pubs[i].connect(ctx); err != nil {
+			disconnectWorkers(pubs)
+			return nil, fmt.Errorf("publisher %d: %w", i, err)
+		}
+	}
+	defer disconnectWorkers(pubs)
+
+	var wg sync.WaitGroup
+	for _, w := range pubs {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			w.reconnectLoop(ctx, &reconnects)
+		}(w)
+	}
+	for _, s := range subs {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			w.reconnectLoop(ctx, &reconnects)
+		}(s.worker)
+	}
+
+	result := &Result{Config: cfg, Started: time.Now()}
+	seqs := make([]atomic.Uint32, cfg.Publishers)
+	var publishErrs atomic.Uint64
+
+	runCtx, stop := context.WithTimeout(ctx, cfg.Duration)
+	defer stop()
+
+	var pubWG sync.WaitGroup
+	for i, w := range pubs {
+		pubWG.Add(1)
+		go func(idx int, w *worker) {
+			defer pubWG.Done()
+			publishLoop(runCtx, cfg, w, uint32(idx), &seqs[idx], &publishErrs)
+		}(i, w)
+	}
+
+	published := func() uint64 {
+		var n uint64
+		for i := range seqs {
+			n += uint64(seqs[i].Load())
+		}
+		return n
+	}
+
+	snapshot := func() Sample {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		p50, p99, maxLatency := window.drain()
+
+		s := Sample{
+			Time:        time.Now(),
+			Elapsed:     time.Since(result.Started),
+			Published:   published(),
+			PublishErrs: publishErrs.Load(),
+			Reconnects:  reconnects.Load(),
+			LatencyP50:  p50,
+			LatencyP99:  p99,
+			LatencyMax:  maxLatency,
+			HeapAlloc:   mem.HeapAlloc,
+			HeapSys:     mem.HeapSys,
+			Goroutines:  runtime.NumGoroutine(),
+		}
+		for _, sub := range subs {
+			s.Delivered += sub.delivered.Load()
+			s.Lost += sub.lost.Load()
+			s.Duplicates += sub.duplicates.Load()
+		}
+		return s
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+sampling:
+	for {
+		select {
+		case <-runCtx.Done():
+			break sampling
+		case <-ticker.C:
+			s := snapshot()
+			result.Samples = append(result.Samples, s)
+			if cfg.OnSample != nil {
+				cfg.OnSample(s)
+			}
+			if err := writeCheckpoint(cfg.Checkpoint, result); err != nil {
+				return result, fmt.Errorf("failed to write checkpoint: %w", err)
+			}
+		}
+	}
+	pubWG.Wait()
+
+	// Give in-flight messages a moment to arrive before counting the tail
+	// of every stream that never showed up as lost
+	drainUntil := time.Now().Add(5 * time.Second)
+	for time.Now().Before(drainUntil) && totalDelivered(subs) < published()*uint64(len(subs)) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	final := snapshot()
+	for _, sub := range subs {
+		sub.mu.Lock()
+		for i, next := range sub.next {
+			if sent := seqs[i].Load(); sent > next {
+				final.Lost += uint64(sent - next)
+			}
+		}
+		sub.mu.Unlock()
+	}
+	result.Samples = append(result.Samples, final)
+
+	result.Elapsed = final.Elapsed
+	result.Complete = ctx.Err() == nil
+	result.Published = final.Published
+	result.PublishErrs = final.PublishErrs
+	result.Expected = final.Published * uint64(len(subs))
+	result.Delivered = final.Delivered
+	result.Lost = final.Lost
+	result.Duplicates = final.Duplicates
+	result.Reconnects = final.Reconnects
+
+	cancel()
+	wg.Wait()
+
+	if err := writeCheckpoint(cfg.Checkpoint, result); err != nil {
+		return result, fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return result, nil
+}
+
+// publishLoop publishes at the configured rate until ctx is done. Sequence
+// numbers only advance on successful publishes so that gaps seen by
+// subscribers are messages the broker accepted but did not deliver.
+func publishLoop(ctx context.Context, cfg Config, w *worker, pubIdx uint32, seq *atomic.Uint32, errs *atomic.Uint64) {
+	ticker := time.NewTicker(time.Second / time.Duration(cfg.Rate))
+	defer ticker.Stop()
+
+	payload := make([]byte, cfg.PayloadSize)
+	binary.BigEndian.PutUint32(payload[0:4], pubIdx)
+	topic := fmt.Sprintf("%s/%d", cfg.Topic, int(pubIdx)%cfg.Topics)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		client := w.current()
+		if client == nil {
+			errs.Add(1)
+			continue
+		}
+
+		// Each message gets its own payload as paho may still reference it
+		// while a QoS 1/2 flow is in flight
+		msg := make([]byte, len(payload))
+		copy(msg, payload)
+		binary.BigEndian.PutUint32(msg[4:8], seq.Load())
+		binary.BigEndian.PutUint64(msg[8:16], uint64(time.Now().UnixNano()))
+
+		pubCtx, pubCancel := context.WithTimeout(ctx, 10*time.Second)
+		_, err := client.Publish(pubCtx, &paho.Publish{
+			Topic:   topic,
+			QoS:     cfg.QoS,
+			Payload: msg,
+		})
+		pubCancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			errs.Add(1)
+			continue
+		}
+		seq.Add(1)
+	}
+}
+
+func (s *subscriber) onPublish(window *latencyWindow) func(paho.PublishReceived) (bool, error) {
+	return func(pr paho.PublishReceived) (bool, error) {
+		now := time.Now()
+		payload := pr.Packet.Payload
+		if len(payload) < headerSize {
+			return true, nil
+		}
+		pubIdx := binary.BigEndian.Uint32(payload[0:4])
+		seq := binary.BigEndian.Uint32(payload[4:8])
+		sent := int64(binary.BigEndian.Uint64(payload[8:16]))
+
+		s.mu.Lock()
+		if int(pubIdx) < len(s.next) {
+			next := s.next[pubIdx]
+			switch {
+			case seq == next:
+				s.next[pubIdx]++
+			case seq > next:
+				s.lost.Add(uint64(seq - next))
+				s.next[pubIdx] = seq + 1
+			default:
+				s.duplicates.Add(1)
+			}
+		}
+		s.mu.Unlock()
+
+		s.delivered.Add(1)
+		window.add(time.Duration(now.UnixNano() - sent))
+		return true, nil
+	}
+}
+
+// connect dials and connects the worker, subscribing if it is a subscriber
+func (w *worker) connect(ctx context.Context) error {
+	conn, err := common.DialBroker(w.cfg.Broker)
+	if err != nil {
+		return err
+	}
+
+	down := make(chan struct{})
+	var once sync.Once
+	signal := func() { once.Do(func() { close(down) }) }
+
+	config := paho.ClientConfig{
+		ClientID:           w.name,
+		Conn:               conn,
+		OnClientError:      func(error) { signal() },
+		OnServerDisconnect: func(*paho.Disconnect) { signal() },
+	}
+	if w.onPublish != nil {
+		config.OnPublishReceived = []func(paho.PublishReceived) (bool, error){w.onPublish}
+	}
+	client := paho.NewClient(config)
+
+	cp := &paho.Connect{
+		KeepAlive:  30,
+		ClientID:   w.name,
+		CleanStart: true,
+	}
+	if w.cfg.Username != "" {
+		cp.UsernameFlag = true
+		cp.Username = w.cfg.Username
+	}
+	if w.cfg.Password != "" {
+		cp.PasswordFlag = true
+		cp.Password = []byte(w.cfg.Password)
+	}
+
+	connectCtx, connectCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer connectCancel()
+
+	if _, err := client.Connect(connectCtx, cp); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	if w.subscribe {
+		if _, err := client.Subscribe(connectCtx, &paho.Subscribe{
+			Subscriptions: []paho.SubscribeOptions{{Topic: w.cfg.Topic + "/#", QoS: w.cfg.QoS}},
+		}); err != nil {
+			client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+			return fmt.Errorf("subscribe failed: %w", err)
+		}
+	}
+
+	w.mu.Lock()
+	w.client = client
+	w.down = down
+	w.mu.Unlock()
+	return nil
+}
+
+// reconnectLoop waits for the connection to drop and reconnects with backoff
+func (w *worker) reconnectLoop(ctx context.Context, reconnects *atomic.Uint64) {
+	for {
+		w.mu.RLock()
+		down := w.down
+		w.mu.RUnlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-down:
+		}
+
+		w.mu.Lock()
+		w.client = nil
+		w.mu.Unlock()
+
+		backoff := 100 * time.Millisecond
+		for {
+			if err := w.connect(ctx); err == nil {
+				reconnects.Add(1)
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 10*time.Second)
+		}
+	}
+}
+
+func (w *worker) current() *paho.Client {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.client
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seen++
+	if len(w.samples) < maxWindowLatencies {
+		w.samples = append(w.samples, d)
+		return
+	}
+	if i := rand.IntN(w.seen); i < maxWindowLatencies {
+		w.samples[i] = d
+	}
+}
+
+// drain returns the window's latency percentiles and resets it
+func (w *latencyWindow) drain() (p50, p99, maxLatency time.Duration) {
+	w.mu.Lock()
+	samples := w.samples
+	w.samples = nil
+	w.seen = 0
+	w.mu.Unlock()
+
+	if len(samples) == 0 {
+		return 0, 0, 0
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return percentile(samples, 50), percentile(samples, 99), samples[len(samples)-1]
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	idx := len(sorted) * p / 100
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func totalDelivered(subs []*subscriber) uint64 {
+	var n uint64
+	for _, s := range subs {
+		n += s.delivered.Load()
+	}
+	return n
+}
+
+func disconnectSubscribers(subs []*subscriber) {
+	for _, s := range subs {
+		if s != nil {
+			disconnect(s.worker)
+		}
+	}
+}
+
+func disconnectWorkers(workers []*worker) {
+	for _, w := range workers {
+		if w != nil {
+			disconnect(w)
+		}
+	}
+}
+
+func disconnect(w *worker) {
+	if client := w.current(); client != nil {
+		client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	}
+}
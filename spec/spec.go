@@ -0,0 +1,240 @@
+// Package spec indexes the normative statements of the MQTT specifications
+// shipped in this directory, so tests can be classified by the requirement
+// level (MUST, SHOULD, MAY) of the statement they verify.
+package spec
+
+import (
+	_ "embed"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Specification versions
+const (
+	V311 = "3.1.1"
+	V5   = "5.0"
+)
+
+// Level is the normative level of a specification statement
+type Level int
+
+const (
+	LevelUnknown Level = iota
+	LevelMay
+	LevelShould
+	LevelMust
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelMust:
+		return "MUST"
+	case LevelShould:
+		return "SHOULD"
+	case LevelMay:
+		return "MAY"
+	}
+	return "UNKNOWN"
+}
+
+// ParseLevel is the inverse of Level.String
+func ParseLevel(s string) Level {
+	for _, l := range []Level{LevelMay, LevelShould, LevelMust} {
+		if l.String() == s {
+			return l
+		}
+	}
+	return LevelUnknown
+}
+
+// Weight is the contribution of a statement at this level to a weighted
+// compliance score
+func (l Level) Weight() int {
+	switch l {
+	case LevelMust:
+		return 3
+	case LevelShould:
+		return 2
+	case LevelMay:
+		return 1
+	}
+	return 1
+}
+
+// Statement is a numbered normative statement such as [MQTT-3.1.0-1]
+type Statement struct {
+	Ref     string // e.g. "MQTT-3.1.0-1"
+	Section string // e.g. "3.1"
+	Level   Level
+	Text    string // The sentence the reference is attached to
+}
+
+//go:embed mqtt-v3.1.1.md
+var v311Doc string
+
+//go:embed mqtt-v5.0.md
+var v5Doc string
+
+// document is a parsed specification
+type document struct {
+	statements []Statement
+	byRef      map[string]Statement
+	sections   map[string]Level // Strongest level used anywhere in a section
+}
+
+var (
+	parseOnce sync.Once
+	documents map[string]*document
+
+	refPattern     = regexp.MustCompile(`\\\[(MQTT-[0-9.]+-[0-9]+)\\\]`)
+	headingPattern = regexp.MustCompile(`^#+ ([0-9]+(?:\.[0-9]+)*)\s`)
+	keywordPattern = regexp.MustCompile(`\b(MUST|SHOULD|MAY|SHALL|REQUIRED)\b`)
+	linkPattern    = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	listPattern    = regexp.MustCompile(`^\s*(?:[-*]|[0-9]+\.)\s+`)
+)
+
+func load(version string) *document {
+	parseOnce.Do(func() {
+		documents = map[string]*document{
+			V311: parse(v311Doc),
+			V5:   parse(v5Doc),
+		}
+	})
+	return documents[version]
+}
+
+func parse(doc string) *document {
+	d := &document{
+		byRef:    make(map[string]Statement),
+		sections: make(map[string]Level),
+	}
+
+	section := ""
+	paragraph := "" // Earlier lines of the current paragraph
+	for _, line := range strings.Split(doc, "\n") {
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			section = m[1]
+			paragraph = ""
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			// A sentence may be broken across a blank line
+			if strings.HasSuffix(strings.TrimSpace(paragraph), ".") {
+				paragraph = ""
+			}
+			continue
+		}
+
+		if level := strongest(line); level > d.sections[section] {
+			d.sections[section] = level
+		}
+
+		// A reference belongs to the sentence it closes; the sentence starts
+		// after the previous full stop or reference on the same line
+		from := 0
+		for _, loc := range refPattern.FindAllStringSubmatchIndex(line, -1) {
+			sentence := line[from:loc[0]]
+			if i := strings.LastIndex(sentence, ". "); i >= 0 {
+				sentence = sentence[i+2:]
+			}
+			ref := line[loc[2]:loc[3]]
+			from = loc[1]
+
+			if _, seen := d.byRef[ref]; seen {
+				continue
+			}
+			// Some statements continue a sentence that carries the keyword,
+			// e.g. a list of allowed characters
+			level := strongest(sentence)
+			if level == LevelUnknown {
+				level = strongest(paragraph + line[:loc[0]])
+			}
+			st := Statement{
+				Ref:     ref,
+				Section: section,
+				Level:   level,
+				Text:    clean(sentence),
+			}
+			d.statements = append(d.statements, st)
+			d.byRef[ref] = st
+		}
+		paragraph += line + "\n"
+	}
+	return d
+}
+
+// strongest returns the strongest normative keyword in text
+func strongest(text string) Level {
+	level := LevelUnknown
+	for _, kw := range keywordPattern.FindAllString(text, -1) {
+		l := LevelMay
+		switch kw {
+		case "MUST", "SHALL", "REQUIRED":
+			l = LevelMust
+		case "SHOULD":
+			l = LevelShould
+		}
+		if l > level {
+			level = l
+		}
+	}
+	return level
+}
+
+// clean strips markdown escapes, links and list markers from a statement
+func clean(text string) string {
+	text = strings.ReplaceAll(text, `\`, "")
+	text = linkPattern.ReplaceAllString(text, "$1")
+	text = listPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(text)
+}
+
+// Statements returns every numbered normative statement of a specification
+// version in document order
+func Statements(version string) []Statement {
+	d := load(version)
+	if d == nil {
+		return nil
+	}
+	return d.statements
+}
+
+// Lookup returns the numbered statement for ref
+func Lookup(version, ref string) (Statement, bool) {
+	d := load(version)
+	if d == nil {
+		return Statement{}, false
+	}
+	st, ok := d.byRef[ref]
+	return st, ok
+}
+
+// LevelOf returns the normative level for a test's spec reference. Refs that
+// are not numbered statements (e.g. "MQTT-3.2.2.3.2" naming a section) fall
+// back to the strongest keyword used in that section.
+func LevelOf(version, ref string) Level {
+	if st, ok := Lookup(version, ref); ok {
+		return st.Level
+	}
+	d := load(version)
+	if d == nil {
+		return LevelUnknown
+	}
+
+	section := strings.TrimPrefix(ref, "MQTT-")
+	if i := strings.Index(section, "-"); i >= 0 {
+		section = section[:i]
+	}
+	for section != "" {
+		if level, ok := d.sections[section]; ok && level != LevelUnknown {
+			return level
+		}
+		i := strings.LastIndex(section, ".")
+		if i < 0 {
+			break
+		}
+		section = section[:i]
+	}
+	return LevelUnknown
+}